@@ -4,23 +4,37 @@ import (
 	"context"
 	"net/http"
 	"net/netip"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/rogerwesterbo/godns/internal/clients"
 	"github.com/rogerwesterbo/godns/internal/dnsserver"
 	"github.com/rogerwesterbo/godns/internal/dnsserver/handlers"
 	"github.com/rogerwesterbo/godns/internal/httpserver"
+	"github.com/rogerwesterbo/godns/internal/models"
 	"github.com/rogerwesterbo/godns/internal/services/seeding"
 	"github.com/rogerwesterbo/godns/internal/services/v1allowedlans"
 	"github.com/rogerwesterbo/godns/internal/services/v1cacheservice"
+	"github.com/rogerwesterbo/godns/internal/services/v1dnssecservice"
 	"github.com/rogerwesterbo/godns/internal/services/v1dnsservice"
+	"github.com/rogerwesterbo/godns/internal/services/v1dynamicupdateservice"
+	"github.com/rogerwesterbo/godns/internal/services/v1filterservice"
 	"github.com/rogerwesterbo/godns/internal/services/v1healthcheckservice"
 	"github.com/rogerwesterbo/godns/internal/services/v1loadbalancerservice"
 	"github.com/rogerwesterbo/godns/internal/services/v1metricsservice"
+	"github.com/rogerwesterbo/godns/internal/services/v1notifyservice"
+	"github.com/rogerwesterbo/godns/internal/services/v1policyservice"
 	"github.com/rogerwesterbo/godns/internal/services/v1querylogservice"
 	"github.com/rogerwesterbo/godns/internal/services/v1ratelimitservice"
+	"github.com/rogerwesterbo/godns/internal/services/v1resolverservice"
+	"github.com/rogerwesterbo/godns/internal/services/v1secondaryservice"
+	"github.com/rogerwesterbo/godns/internal/services/v1tsigservice"
 	"github.com/rogerwesterbo/godns/internal/services/v1upstream"
+	"github.com/rogerwesterbo/godns/internal/services/v1validationservice"
+	"github.com/rogerwesterbo/godns/internal/services/v1viewservice"
 	"github.com/rogerwesterbo/godns/internal/services/v1zoneservice"
+	"github.com/rogerwesterbo/godns/internal/services/v1zonetransferservice"
 	"github.com/rogerwesterbo/godns/internal/settings"
 	"github.com/rogerwesterbo/godns/pkg/consts"
 	"github.com/rogerwesterbo/godns/pkg/validation"
@@ -58,11 +72,16 @@ func main() {
 	// Initialize allowed LANs service with Valkey backend
 	allowedLANsService := v1allowedlans.NewAllowedLANsService(clients.V1ValkeyClient)
 
-	// Initialize upstream DNS service with Valkey backend
-	upstreamService := v1upstream.NewUpstreamService(clients.V1ValkeyClient, 3*time.Second)
-
-	// Initialize zone service for HTTP API and seeding
-	zoneService := v1zoneservice.NewV1ZoneService(clients.V1ValkeyClient)
+	// Initialize NOTIFY service for secondaries of our zones
+	var notifyService *v1notifyservice.NotifyService
+	if viper.GetBool(consts.DNS_NOTIFY_ENABLED) {
+		notifyTimeout := time.Duration(viper.GetInt(consts.DNS_NOTIFY_TIMEOUT_SEC)) * time.Second
+		notifyRetries := viper.GetInt(consts.DNS_NOTIFY_MAX_RETRIES)
+		notifyInterval := time.Duration(viper.GetInt(consts.DNS_NOTIFY_RETRY_INTERVAL_SEC)) * time.Second
+		notifyService = v1notifyservice.NewNotifyService(notifyTimeout, notifyRetries, notifyInterval)
+		defer notifyService.Stop()
+		vlog.Infof("DNS NOTIFY enabled (timeout: %s, retries: %d)", notifyTimeout, notifyRetries)
+	}
 
 	// Initialize DNS cache service
 	var cacheService *v1cacheservice.DNSCache
@@ -73,6 +92,9 @@ func main() {
 		vlog.Infof("DNS cache enabled (size: %d, TTL: %s)", cacheSize, cacheTTL)
 	}
 
+	// Initialize zone service for HTTP API and seeding
+	zoneService := v1zoneservice.NewV1ZoneService(clients.V1ValkeyClient, notifyService, cacheService)
+
 	// Initialize rate limiter
 	var rateLimiter *v1ratelimitservice.RateLimiter
 	if viper.GetBool(consts.DNS_RATE_LIMIT_ENABLED) {
@@ -145,16 +167,41 @@ func main() {
 		}()
 	}
 
+	// Initialize upstream DNS service with Valkey backend
+	upstreamStrategy := viper.GetString(consts.DNS_UPSTREAM_STRATEGY)
+	if !v1upstream.ValidStrategy(upstreamStrategy) {
+		vlog.Fatalf("Invalid upstream strategy %q (sequential, round-robin, fastest, parallel)", upstreamStrategy)
+	}
+	upstreamProbeInterval := time.Duration(viper.GetInt(consts.DNS_UPSTREAM_HEALTH_CHECK_INTERVAL_SEC)) * time.Second
+	upstreamService := v1upstream.NewUpstreamService(clients.V1ValkeyClient, 3*time.Second, upstreamStrategy, viper.GetInt(consts.DNS_UPSTREAM_RACE_COUNT), upstreamProbeInterval, metricsService)
+	vlog.Infof("Upstream strategy: %s", upstreamStrategy)
+
+	// Resolve from the root servers instead of the upstreams, except for conditional forwarders
+	if viper.GetBool(consts.DNS_RECURSION_ENABLED) {
+		// Delegations are cached even when the response cache is disabled
+		delegationCache := cacheService
+		if delegationCache == nil {
+			delegationCache = v1cacheservice.NewDNSCache(viper.GetInt(consts.DNS_CACHE_SIZE), time.Duration(viper.GetInt(consts.DNS_CACHE_TTL_SECONDS))*time.Second)
+		}
+		upstreamService.UseResolver(v1resolverservice.NewV1ResolverService(delegationCache, viper.GetBool(consts.DNS_RECURSION_QNAME_MINIMISATION), viper.GetBool(consts.DNS_RECURSION_IPV6)))
+		vlog.Info("Recursive resolution from the root servers enabled")
+	}
+
 	// Initialize and run seeding service
 	seedingService := seeding.NewSeedingService(allowedLANsService, upstreamService, zoneService)
 
-	// Get default upstream server from config, system, or fallback to Cloudflare
-	defaultUpstream := viper.GetString(consts.DNS_UPSTREAM_SERVER)
-	if defaultUpstream == "" {
-		defaultUpstream = "1.1.1.1:53"
-		vlog.Infof("Using Cloudflare DNS as upstream fallback: %s", defaultUpstream)
+	// Get default upstream servers from config, or fallback to Cloudflare
+	var defaultUpstreams []string
+	for _, upstream := range strings.Split(viper.GetString(consts.DNS_UPSTREAM_SERVER), ",") {
+		if upstream = strings.TrimSpace(upstream); upstream != "" {
+			defaultUpstreams = append(defaultUpstreams, upstream)
+		}
+	}
+	if len(defaultUpstreams) == 0 {
+		defaultUpstreams = []string{"1.1.1.1:53"}
+		vlog.Infof("Using Cloudflare DNS as upstream fallback: %s", defaultUpstreams[0])
 	} else {
-		vlog.Infof("Using configured upstream DNS: %s", defaultUpstream)
+		vlog.Infof("Using configured upstream DNS: %s", strings.Join(defaultUpstreams, ", "))
 	}
 
 	// Seed default configuration (safe for multiple pods - only seeds if not exists)
@@ -167,24 +214,134 @@ func main() {
 			netip.MustParsePrefix("172.16.0.0/12"),  // Private IPv4 (Docker default)
 			netip.MustParsePrefix("fd00::/8"),       // IPv6 ULA
 		},
-		DefaultUpstreamServer: defaultUpstream,
+		DefaultUpstreamServers: defaultUpstreams,
 	}
 	if err := seedingService.SeedDefaults(ctx, seedConfig); err != nil {
 		vlog.Fatalf("failed to seed configuration: %v", err)
 	}
+	// Load the conditional forwarders and probe the upstreams in the background
+	upstreamService.Start()
+	defer upstreamService.Stop()
+
+	// Initialize secondary zone refresh from external primaries
+	var secondaryService *v1secondaryservice.SecondaryService
+	if viper.GetBool(consts.DNS_SECONDARY_ENABLED) {
+		secondaryTimeout := time.Duration(viper.GetInt(consts.DNS_SECONDARY_TIMEOUT_SEC)) * time.Second
+		secondaryInterval := time.Duration(viper.GetInt(consts.DNS_SECONDARY_CHECK_INTERVAL_SEC)) * time.Second
+		secondaryService = v1secondaryservice.NewSecondaryService(zoneService, secondaryTimeout, secondaryInterval)
+		secondaryService.Start()
+		defer secondaryService.Stop()
+	}
+
+	// TSIG keys for signed zone transfers, dynamic updates and NOTIFY: keys from the
+	// configuration plus the keys managed through the API
+	staticTSIGKeys, err := models.ParseTSIGKeys(viper.GetString(consts.DNS_TSIG_KEYS))
+	if err != nil {
+		vlog.Fatalf("invalid TSIG keys: %v", err)
+	}
+	if len(staticTSIGKeys) > 0 {
+		vlog.Infof("Loaded %d TSIG keys from configuration", len(staticTSIGKeys))
+	}
+	tsigService := v1tsigservice.NewV1TSIGService(clients.V1ValkeyClient, staticTSIGKeys)
+
+	// Online DNSSEC signing of zones that enable it; the private keys are stored
+	// encrypted, so signing is only available with an encryption key
+	var dnssecService *v1dnssecservice.V1DNSSECService
+	if encryptionKey := viper.GetString(consts.DNS_DNSSEC_ENCRYPTION_KEY); encryptionKey != "" {
+		rolloverPolicy := v1dnssecservice.RolloverPolicy{
+			ZSKLifetime: time.Duration(viper.GetInt(consts.DNS_DNSSEC_ZSK_LIFETIME_DAYS)) * 24 * time.Hour,
+			KSKLifetime: time.Duration(viper.GetInt(consts.DNS_DNSSEC_KSK_LIFETIME_DAYS)) * 24 * time.Hour,
+		}
+		dnssecService, err = v1dnssecservice.NewV1DNSSECService(clients.V1ValkeyClient, encryptionKey, rolloverPolicy)
+		if err != nil {
+			vlog.Fatalf("failed to initialize DNSSEC: %v", err)
+		}
+
+		// Key rollovers of signed zones
+		rolloverInterval := time.Duration(viper.GetInt(consts.DNS_DNSSEC_ROLLOVER_CHECK_INTERVAL_SEC)) * time.Second
+		rolloverScheduler := v1dnssecservice.NewRolloverScheduler(dnssecService, zoneService, metricsService, rolloverInterval)
+		rolloverScheduler.Start()
+		defer rolloverScheduler.Stop()
+	} else {
+		vlog.Infof("DNSSEC signing disabled, set %s to enable it", consts.DNS_DNSSEC_ENCRYPTION_KEY)
+	}
+
+	// DNSSEC validation of upstream responses, starting from the root trust anchors
+	var validationService *v1validationservice.V1ValidationService
+	if viper.GetBool(consts.DNS_DNSSEC_VALIDATION) {
+		validationService = v1validationservice.NewV1ValidationService(clients.V1ValkeyClient, upstreamService, v1validationservice.RootTrustAnchors())
+		if err := validationService.LoadTrustAnchors(ctx); err != nil {
+			vlog.Fatalf("failed to load DNSSEC trust anchors: %v", err)
+		}
+		validationService.Start()
+		defer validationService.Stop()
+	}
+
+	// Split-horizon views: clients in a view's networks get the view's records of a zone
+	viewService := v1viewservice.NewV1ViewService(clients.V1ValkeyClient)
+	viewService.Start()
+	defer viewService.Stop()
+
+	// Response policy zones and blocklists, checked in their configured order, followed by the
+	// blocklists of filtering profiles
+	policySources, err := models.ParsePolicySources(viper.GetString(consts.DNS_RPZ_POLICIES))
+	if err != nil {
+		vlog.Fatalf("invalid response policies: %v", err)
+	}
+	blocklists, err := models.ParsePolicySources(viper.GetString(consts.DNS_FILTER_BLOCKLISTS))
+	if err != nil {
+		vlog.Fatalf("invalid filter blocklists: %v", err)
+	}
+	for _, blocklist := range blocklists {
+		if slices.ContainsFunc(policySources, func(s models.PolicySource) bool { return s.Name == blocklist.Name }) {
+			vlog.Fatalf("invalid filter blocklists: %s is also a response policy", blocklist.Name)
+		}
+		blocklist.ProfileOnly = true
+		policySources = append(policySources, blocklist)
+	}
+	var policyService *v1policyservice.V1PolicyService
+	if len(policySources) > 0 {
+		policyRefresh := time.Duration(viper.GetInt(consts.DNS_RPZ_REFRESH_INTERVAL_SEC)) * time.Second
+		policyTimeout := time.Duration(viper.GetInt(consts.DNS_RPZ_TIMEOUT_SEC)) * time.Second
+		policyService = v1policyservice.NewV1PolicyService(policySources, tsigService, policyRefresh, policyTimeout)
+		policyService.Start()
+		defer policyService.Stop()
+	}
+
+	// Client groups, filtered with the blocklists, allowed and blocked domains, safe search
+	// and schedules of their profiles
+	var blocklistNames []string
+	if policyService != nil {
+		blocklistNames = policyService.Blocklists()
+	}
+	filterService := v1filterservice.NewV1FilterService(clients.V1ValkeyClient, blocklistNames)
+	filterService.Start()
+	defer filterService.Stop()
+
+	// Dynamic updates (RFC 2136), allowed per zone by its update policy
+	updateService := v1dynamicupdateservice.NewV1DynamicUpdateService(zoneService)
 
 	// Create DNS handler with all services
-	dnsHandler := handlers.NewDNSHandler(
-		dnsService,
-		allowedLANsService,
-		upstreamService,
-		cacheService,
-		rateLimiter,
-		loadBalancer,
-		healthCheckService,
-		queryLogService,
-		metricsService,
-	)
+	dnsHandler := handlers.NewDNSHandler(handlers.DNSHandlerOptions{
+		DNSService:         dnsService,
+		AllowedLANsService: allowedLANsService,
+		UpstreamService:    upstreamService,
+		CacheService:       cacheService,
+		RateLimiter:        rateLimiter,
+		LoadBalancer:       loadBalancer,
+		HealthCheck:        healthCheckService,
+		QueryLog:           queryLogService,
+		Metrics:            metricsService,
+		TransferService:    v1zonetransferservice.NewV1ZoneTransferService(zoneService),
+		SecondaryService:   secondaryService,
+		UpdateService:      updateService,
+		TSIGService:        tsigService,
+		DNSSECService:      dnssecService,
+		ValidationService:  validationService,
+		ViewService:        viewService,
+		PolicyService:      policyService,
+		FilterService:      filterService,
+	})
 
 	createHttpServer := viper.GetBool(consts.DNS_ENABLE_HTTP_API)
 	if createHttpServer {
@@ -198,6 +355,14 @@ func main() {
 			loadBalancer,
 			healthCheckService,
 			queryLogService,
+			secondaryService,
+			tsigService,
+			dnssecService,
+			validationService,
+			upstreamService,
+			viewService,
+			policyService,
+			filterService,
 		)
 		if err != nil {
 			vlog.Fatalf("failed to create HTTP API server: %v", err)
@@ -220,8 +385,59 @@ func main() {
 	if err := validation.ValidateDNSAddress(dnsAddress); err != nil {
 		vlog.Fatalf("Invalid DNS server address: %v", err)
 	}
+	if size := viper.GetInt(consts.DNS_EDNS_UDP_SIZE); size < 512 || size > 4096 {
+		vlog.Fatalf("Invalid EDNS UDP size %d (512-4096)", size)
+	}
+
+	// DNS over TLS, HTTPS and QUIC with certificates reloaded from their files when they are renewed
+	tlsEnabled := viper.GetBool(consts.DNS_TLS_ENABLED)
+	doqEnabled := viper.GetBool(consts.DNS_DOQ_ENABLED)
+	dohEnabled := viper.GetBool(consts.DNS_DOH_ENABLED)
+	certFile := viper.GetString(consts.DNS_TLS_CERT_FILE)
+	var tlsAddress, doqAddress, dohAddress string
+	if tlsEnabled {
+		tlsAddress = viper.GetString(consts.DNS_TLS_PORT)
+		if err := validation.ValidateDNSAddress(tlsAddress); err != nil {
+			vlog.Fatalf("Invalid DNS over TLS address: %v", err)
+		}
+	}
+	if doqEnabled {
+		doqAddress = viper.GetString(consts.DNS_DOQ_PORT)
+		if err := validation.ValidateDNSAddress(doqAddress); err != nil {
+			vlog.Fatalf("Invalid DNS over QUIC address: %v", err)
+		}
+	}
+	if dohEnabled {
+		dohAddress = viper.GetString(consts.DNS_DOH_PORT)
+		if err := validation.ValidateDNSAddress(dohAddress); err != nil {
+			vlog.Fatalf("Invalid DNS over HTTPS address: %v", err)
+		}
+	}
+	var certificates *dnsserver.CertificateReloader
+	if tlsEnabled || doqEnabled || (dohEnabled && certFile != "") {
+		certificates, err = dnsserver.NewCertificateReloader(certFile, viper.GetString(consts.DNS_TLS_KEY_FILE))
+		if err != nil {
+			vlog.Fatalf("failed to load TLS certificate: %v", err)
+		}
+	}
+	dohTrustedProxies, err := dnsserver.ParseTrustedProxies(viper.GetString(consts.DNS_DOH_TRUSTED_PROXIES))
+	if err != nil {
+		vlog.Fatalf("Invalid DNS over HTTPS trusted proxies: %v", err)
+	}
+	tcpIdleTimeout := time.Duration(viper.GetInt(consts.DNS_TCP_IDLE_TIMEOUT_SEC)) * time.Second
 
-	server := dnsserver.New(dnsAddress, livenessProbePort, readinessProbePort, dnsHandler)
+	server := dnsserver.New(dnsHandler, dnsserver.Options{
+		Addr:               dnsAddress,
+		LivenessProbePort:  livenessProbePort,
+		ReadinessProbePort: readinessProbePort,
+		TSIGProvider:       tsigService,
+		TCPIdleTimeout:     tcpIdleTimeout,
+		Certificates:       certificates,
+		TLSAddr:            tlsAddress,
+		DoQAddr:            doqAddress,
+		DoHAddr:            dohAddress,
+		DoHTrustedProxies:  dohTrustedProxies,
+	})
 	if err := server.Start(); err != nil {
 		vlog.Fatalf("server error: %v", err)
 	}
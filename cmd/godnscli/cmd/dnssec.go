@@ -0,0 +1,219 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var dnssecCmd = &cobra.Command{
+	Use:   "dnssec",
+	Short: "Manage DNSSEC validation",
+	Long:  `Show the root trust anchors and manage the negative trust anchors of DNSSEC validation (DNS_DNSSEC_VALIDATION).`,
+}
+
+var dnssecTrustAnchorsCmd = &cobra.Command{
+	Use:   "trust-anchors",
+	Short: "List the root trust anchors",
+	Long:  `List the root trust anchors validation starts from, with their RFC 5011 states.`,
+	RunE:  runDNSSECTrustAnchors,
+}
+
+var dnssecNTACmd = &cobra.Command{
+	Use:   "nta",
+	Short: "Manage negative trust anchors",
+	Long:  `Negative trust anchors turn DNSSEC validation off for domains with broken signatures (RFC 7646).`,
+}
+
+var dnssecNTAListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List negative trust anchors",
+	RunE:  runDNSSECNTAList,
+}
+
+var dnssecNTAAddCmd = &cobra.Command{
+	Use:   "add [domain]",
+	Short: "Add a negative trust anchor",
+	Long: `Turn DNSSEC validation off for a domain and the names below it.
+
+Examples:
+  godnscli dnssec nta add broken.example.com --reason "expired signatures"
+  godnscli dnssec nta add broken.example.com --lifetime 24h`,
+	Args: cobra.ExactArgs(1),
+	RunE: runDNSSECNTAAdd,
+}
+
+var dnssecNTARemoveCmd = &cobra.Command{
+	Use:   "remove [domain]",
+	Short: "Remove a negative trust anchor",
+	Long:  `Turn DNSSEC validation on again for a domain.`,
+	Args:  cobra.ExactArgs(1),
+	RunE:  runDNSSECNTARemove,
+}
+
+func init() {
+	rootCmd.AddCommand(dnssecCmd)
+	dnssecCmd.AddCommand(dnssecTrustAnchorsCmd)
+	dnssecCmd.AddCommand(dnssecNTACmd)
+	dnssecNTACmd.AddCommand(dnssecNTAListCmd)
+	dnssecNTACmd.AddCommand(dnssecNTAAddCmd)
+	dnssecNTACmd.AddCommand(dnssecNTARemoveCmd)
+
+	dnssecCmd.PersistentFlags().String("api-url", "", "GoDNS API URL (default from config)")
+
+	dnssecNTAAddCmd.Flags().String("reason", "", "Why validation is turned off")
+	dnssecNTAAddCmd.Flags().Duration("lifetime", 0, "Remove the anchor after this time, e.g. 24h (default kept until removed)")
+}
+
+type trustAnchor struct {
+	KeyTag    uint16 `json:"key_tag"`
+	Algorithm uint8  `json:"algorithm"`
+	State     string `json:"state"`
+	FirstSeen string `json:"first_seen,omitempty"`
+	LastSeen  string `json:"last_seen,omitempty"`
+}
+
+type negativeTrustAnchor struct {
+	Domain    string     `json:"domain"`
+	Reason    string     `json:"reason,omitempty"`
+	CreatedAt string     `json:"created_at,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+func negativeTrustAnchorsURL(cmd *cobra.Command) string {
+	return fmt.Sprintf("%s/api/v1/dnssec/negative-trust-anchors", getAPIURL(cmd))
+}
+
+func runDNSSECTrustAnchors(cmd *cobra.Command, args []string) error {
+	resp, err := makeAPIRequest("GET", fmt.Sprintf("%s/api/v1/dnssec/trust-anchors", getAPIURL(cmd)), nil)
+	if err != nil {
+		return fmt.Errorf("failed to connect to API: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("API request failed (%d): %s", resp.StatusCode, string(body))
+	}
+
+	var anchors []trustAnchor
+	if err := json.NewDecoder(resp.Body).Decode(&anchors); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	_, _ = fmt.Fprintln(w, "KEY TAG\tALGORITHM\tSTATE\tFIRST SEEN\tLAST SEEN")
+	for _, anchor := range anchors {
+		firstSeen, lastSeen := anchor.FirstSeen, anchor.LastSeen
+		if firstSeen == "" {
+			firstSeen = "-"
+		}
+		if lastSeen == "" {
+			lastSeen = "-"
+		}
+		_, _ = fmt.Fprintf(w, "%d\t%d\t%s\t%s\t%s\n", anchor.KeyTag, anchor.Algorithm, anchor.State, firstSeen, lastSeen)
+	}
+	_ = w.Flush()
+
+	return nil
+}
+
+func runDNSSECNTAList(cmd *cobra.Command, args []string) error {
+	resp, err := makeAPIRequest("GET", negativeTrustAnchorsURL(cmd), nil)
+	if err != nil {
+		return fmt.Errorf("failed to connect to API: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("API request failed (%d): %s", resp.StatusCode, string(body))
+	}
+
+	var ntas []negativeTrustAnchor
+	if err := json.NewDecoder(resp.Body).Decode(&ntas); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	if len(ntas) == 0 {
+		fmt.Println("No negative trust anchors found")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	_, _ = fmt.Fprintln(w, "DOMAIN\tEXPIRES\tREASON")
+	for _, nta := range ntas {
+		expires := "never"
+		if nta.ExpiresAt != nil {
+			expires = nta.ExpiresAt.Format(time.RFC3339)
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\n", nta.Domain, expires, nta.Reason)
+	}
+	_ = w.Flush()
+
+	return nil
+}
+
+func runDNSSECNTAAdd(cmd *cobra.Command, args []string) error {
+	reason, _ := cmd.Flags().GetString("reason")
+	lifetime, _ := cmd.Flags().GetDuration("lifetime")
+
+	nta := negativeTrustAnchor{Domain: args[0], Reason: reason}
+	if lifetime > 0 {
+		expiresAt := time.Now().Add(lifetime).UTC()
+		nta.ExpiresAt = &expiresAt
+	}
+
+	jsonData, err := json.Marshal(nta)
+	if err != nil {
+		return fmt.Errorf("failed to encode negative trust anchor: %w", err)
+	}
+
+	resp, err := makeAPIRequest("POST", negativeTrustAnchorsURL(cmd), bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("failed to connect to API: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusCreated {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("API request failed (%d): %s", resp.StatusCode, string(body))
+	}
+
+	var created negativeTrustAnchor
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	fmt.Printf("✓ DNSSEC validation turned off for '%s'\n", created.Domain)
+	if created.ExpiresAt != nil {
+		fmt.Printf("  until %s\n", created.ExpiresAt.Format(time.RFC3339))
+	}
+	return nil
+}
+
+func runDNSSECNTARemove(cmd *cobra.Command, args []string) error {
+	domain := args[0]
+
+	resp, err := makeAPIRequest("DELETE", fmt.Sprintf("%s/%s", negativeTrustAnchorsURL(cmd), url.PathEscape(domain)), nil)
+	if err != nil {
+		return fmt.Errorf("failed to connect to API: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("API request failed (%d): %s", resp.StatusCode, string(body))
+	}
+
+	fmt.Printf("✓ DNSSEC validation turned on again for '%s'\n", domain)
+	return nil
+}
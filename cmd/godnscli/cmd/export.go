@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	neturl "net/url"
 	"os"
 
 	"github.com/rogerwesterbo/godns/pkg/consts"
@@ -69,7 +70,10 @@ Examples:
 	godnscli export example.lan --format powerdns --api-url %s
 
   # Export to file
-  godnscli export example.lan --format bind --output example.lan.zone`, exampleURL, exampleURL, exampleURL)
+  godnscli export example.lan --format bind --output example.lan.zone
+
+  # Export a zone as the clients of a split-horizon view see it
+  godnscli export example.lan --view office`, exampleURL, exampleURL, exampleURL)
 }
 
 var exportCmd = &cobra.Command{
@@ -82,6 +86,7 @@ var exportCmd = &cobra.Command{
 var (
 	exportFormat string
 	exportOutput string
+	exportView   string
 	apiURL       string
 )
 
@@ -97,6 +102,7 @@ func initExportCommand() {
 
 	exportCmd.Flags().StringVarP(&exportFormat, "format", "f", "bind", "Export format (bind, coredns, powerdns, zonefile)")
 	exportCmd.Flags().StringVarP(&exportOutput, "output", "o", "", "Output file (default: stdout)")
+	exportCmd.Flags().StringVar(&exportView, "view", "", "Export the zones as the clients of this split-horizon view see them")
 	exportCmd.Flags().StringVar(&apiURL, "api-url", getDefaultAPIURL(), "GoDNS API URL")
 }
 
@@ -132,6 +138,10 @@ func runExport(cmd *cobra.Command, args []string) error {
 		}
 	}
 
+	if exportView != "" {
+		url += "&view=" + neturl.QueryEscape(exportView)
+	}
+
 	if verbose {
 		fmt.Fprintf(os.Stderr, "URL: %s\n", url)
 	}
@@ -0,0 +1,393 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+var clientGroupCmd = &cobra.Command{
+	Use:   "client-group",
+	Short: "Manage client groups",
+	Long: `Client groups are named sets of clients, by network or by the client identifier of DNS over
+HTTPS clients using /dns-query/{client-id}, filtered with a profile (see 'godnscli filter-profile').
+A client identifier matches before the networks; among the networks, the group with the longest
+matching prefix wins.`,
+}
+
+var clientGroupListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List client groups",
+	RunE:  runClientGroupList,
+}
+
+var clientGroupAddCmd = &cobra.Command{
+	Use:   "add [name]",
+	Short: "Add a client group",
+	Long: `Add a client group filtered with a profile.
+
+Examples:
+  godnscli client-group add branch-oslo --prefix 10.20.0.0/16 --profile kids
+  godnscli client-group add kiosks --client-id oslo-kiosk --profile kids --description "Kiosks"`,
+	Args: cobra.ExactArgs(1),
+	RunE: runClientGroupAdd,
+}
+
+var clientGroupUpdateCmd = &cobra.Command{
+	Use:   "update [name]",
+	Short: "Replace the clients, profile and description of a client group",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runClientGroupUpdate,
+}
+
+var clientGroupRemoveCmd = &cobra.Command{
+	Use:   "remove [name]",
+	Short: "Remove a client group",
+	Long:  `Filter the clients of a group like clients in no group again.`,
+	Args:  cobra.ExactArgs(1),
+	RunE:  runClientGroupRemove,
+}
+
+var filterProfileCmd = &cobra.Command{
+	Use:   "filter-profile",
+	Short: "Manage filtering profiles",
+	Long: `Filtering profiles are applied to the clients of client groups: blocklists configured in
+DNS_FILTER_BLOCKLISTS, blocked and allowed domains and safe search. A profile with schedules only
+applies during them.`,
+}
+
+var filterProfileListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List filtering profiles",
+	RunE:  runFilterProfileList,
+}
+
+var filterProfileAddCmd = &cobra.Command{
+	Use:   "add [name]",
+	Short: "Add a filtering profile",
+	Long: `Add a filtering profile.
+
+Schedules are "[days] HH:MM-HH:MM"; a window whose end isn't after its start ends on the next day.
+
+Examples:
+  godnscli filter-profile add kids --blocklist social --block tiktok.com --allow school.example.com --safe-search
+  godnscli filter-profile add school-hours --blocklist social --schedule "mon,tue,wed,thu,fri 08:00-16:00" --timezone Europe/Oslo
+  godnscli filter-profile add night --blocklist gaming --schedule "22:00-07:00"`,
+	Args: cobra.ExactArgs(1),
+	RunE: runFilterProfileAdd,
+}
+
+var filterProfileUpdateCmd = &cobra.Command{
+	Use:   "update [name]",
+	Short: "Replace the filtering of a profile",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runFilterProfileUpdate,
+}
+
+var filterProfileRemoveCmd = &cobra.Command{
+	Use:   "remove [name]",
+	Short: "Remove a filtering profile that no client group uses",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runFilterProfileRemove,
+}
+
+func init() {
+	rootCmd.AddCommand(clientGroupCmd)
+	clientGroupCmd.AddCommand(clientGroupListCmd)
+	clientGroupCmd.AddCommand(clientGroupAddCmd)
+	clientGroupCmd.AddCommand(clientGroupUpdateCmd)
+	clientGroupCmd.AddCommand(clientGroupRemoveCmd)
+
+	rootCmd.AddCommand(filterProfileCmd)
+	filterProfileCmd.AddCommand(filterProfileListCmd)
+	filterProfileCmd.AddCommand(filterProfileAddCmd)
+	filterProfileCmd.AddCommand(filterProfileUpdateCmd)
+	filterProfileCmd.AddCommand(filterProfileRemoveCmd)
+
+	clientGroupCmd.PersistentFlags().String("api-url", "", "GoDNS API URL (default from config)")
+	filterProfileCmd.PersistentFlags().String("api-url", "", "GoDNS API URL (default from config)")
+
+	for _, c := range []*cobra.Command{clientGroupAddCmd, clientGroupUpdateCmd} {
+		c.Flags().StringArray("prefix", nil, "Client network in CIDR notation (repeatable)")
+		c.Flags().StringArray("client-id", nil, "Client identifier of DNS over HTTPS clients (repeatable)")
+		c.Flags().String("profile", "", "Filtering profile of the clients (required)")
+		c.Flags().String("description", "", "Description of the client group")
+		_ = c.MarkFlagRequired("profile")
+	}
+
+	for _, c := range []*cobra.Command{filterProfileAddCmd, filterProfileUpdateCmd} {
+		c.Flags().StringArray("blocklist", nil, "Blocklist of DNS_FILTER_BLOCKLISTS to apply (repeatable)")
+		c.Flags().StringArray("block", nil, "Domain to block with the names below it (repeatable)")
+		c.Flags().StringArray("allow", nil, "Domain never blocked or rewritten (repeatable)")
+		c.Flags().Bool("safe-search", false, "Rewrite search engines to their safe search servers")
+		c.Flags().StringArray("schedule", nil, `When the profile applies, as "[days] HH:MM-HH:MM" (repeatable)`)
+		c.Flags().String("timezone", "", "Timezone of the schedules (default: the server's)")
+		c.Flags().String("description", "", "Description of the profile")
+	}
+}
+
+type clientGroup struct {
+	Name        string   `json:"name"`
+	Prefixes    []string `json:"prefixes,omitempty"`
+	ClientIDs   []string `json:"client_ids,omitempty"`
+	Profile     string   `json:"profile"`
+	Description string   `json:"description,omitempty"`
+}
+
+type filterSchedule struct {
+	Days  []string `json:"days,omitempty"`
+	Start string   `json:"start"`
+	End   string   `json:"end"`
+}
+
+type filterProfile struct {
+	Name           string           `json:"name"`
+	Blocklists     []string         `json:"blocklists,omitempty"`
+	BlockedDomains []string         `json:"blocked_domains,omitempty"`
+	AllowedDomains []string         `json:"allowed_domains,omitempty"`
+	SafeSearch     bool             `json:"safe_search,omitempty"`
+	Schedules      []filterSchedule `json:"schedules,omitempty"`
+	Timezone       string           `json:"timezone,omitempty"`
+	Description    string           `json:"description,omitempty"`
+}
+
+func clientGroupsURL(cmd *cobra.Command) string {
+	return fmt.Sprintf("%s/api/v1/client-groups", getAPIURL(cmd))
+}
+
+func filterProfilesURL(cmd *cobra.Command) string {
+	return fmt.Sprintf("%s/api/v1/filter-profiles", getAPIURL(cmd))
+}
+
+// clientGroupFromFlags builds a client group from the add and update flags
+func clientGroupFromFlags(cmd *cobra.Command, name string) clientGroup {
+	prefixes, _ := cmd.Flags().GetStringArray("prefix")
+	ids, _ := cmd.Flags().GetStringArray("client-id")
+	profile, _ := cmd.Flags().GetString("profile")
+	description, _ := cmd.Flags().GetString("description")
+
+	return clientGroup{
+		Name:        name,
+		Prefixes:    prefixes,
+		ClientIDs:   ids,
+		Profile:     profile,
+		Description: description,
+	}
+}
+
+// filterProfileFromFlags builds a filtering profile from the add and update flags
+func filterProfileFromFlags(cmd *cobra.Command, name string) (filterProfile, error) {
+	blocklists, _ := cmd.Flags().GetStringArray("blocklist")
+	blocked, _ := cmd.Flags().GetStringArray("block")
+	allowed, _ := cmd.Flags().GetStringArray("allow")
+	safeSearch, _ := cmd.Flags().GetBool("safe-search")
+	schedules, _ := cmd.Flags().GetStringArray("schedule")
+	timezone, _ := cmd.Flags().GetString("timezone")
+	description, _ := cmd.Flags().GetString("description")
+
+	profile := filterProfile{
+		Name:           name,
+		Blocklists:     blocklists,
+		BlockedDomains: blocked,
+		AllowedDomains: allowed,
+		SafeSearch:     safeSearch,
+		Timezone:       timezone,
+		Description:    description,
+	}
+	for _, s := range schedules {
+		schedule, err := parseSchedule(s)
+		if err != nil {
+			return filterProfile{}, err
+		}
+		profile.Schedules = append(profile.Schedules, schedule)
+	}
+	return profile, nil
+}
+
+// parseSchedule parses a schedule of the form "[days] HH:MM-HH:MM", days separated by commas
+func parseSchedule(s string) (filterSchedule, error) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 || len(fields) > 2 {
+		return filterSchedule{}, fmt.Errorf("invalid schedule %q: expected \"[days] HH:MM-HH:MM\"", s)
+	}
+
+	var schedule filterSchedule
+	if len(fields) == 2 {
+		schedule.Days = strings.Split(fields[0], ",")
+	}
+	start, end, ok := strings.Cut(fields[len(fields)-1], "-")
+	if !ok {
+		return filterSchedule{}, fmt.Errorf("invalid schedule %q: expected \"[days] HH:MM-HH:MM\"", s)
+	}
+	schedule.Start, schedule.End = start, end
+	return schedule, nil
+}
+
+func formatSchedules(schedules []filterSchedule) string {
+	if len(schedules) == 0 {
+		return "always"
+	}
+	parts := make([]string, 0, len(schedules))
+	for _, s := range schedules {
+		window := s.Start + "-" + s.End
+		if len(s.Days) > 0 {
+			window = strings.Join(s.Days, ",") + " " + window
+		}
+		parts = append(parts, window)
+	}
+	return strings.Join(parts, "; ")
+}
+
+// sendFilterRequest sends a request to the filtering API and decodes the response into out, if given
+func sendFilterRequest(method, target string, body any, want int, out any) error {
+	var reader io.Reader
+	if body != nil {
+		jsonData, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+		reader = bytes.NewBuffer(jsonData)
+	}
+
+	resp, err := makeAPIRequest(method, target, reader)
+	if err != nil {
+		return fmt.Errorf("failed to connect to API: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != want && (want != http.StatusNoContent || resp.StatusCode != http.StatusOK) {
+		respBody, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("API request failed (%d): %s", resp.StatusCode, string(respBody))
+	}
+
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return fmt.Errorf("failed to decode response: %w", err)
+		}
+	}
+	return nil
+}
+
+func runClientGroupList(cmd *cobra.Command, args []string) error {
+	var groups []clientGroup
+	if err := sendFilterRequest("GET", clientGroupsURL(cmd), nil, http.StatusOK, &groups); err != nil {
+		return err
+	}
+
+	if len(groups) == 0 {
+		fmt.Println("No client groups found")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	_, _ = fmt.Fprintln(w, "NAME\tPROFILE\tPREFIXES\tCLIENT IDS\tDESCRIPTION")
+	for _, g := range groups {
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", g.Name, g.Profile, strings.Join(g.Prefixes, ", "), strings.Join(g.ClientIDs, ", "), g.Description)
+	}
+	_ = w.Flush()
+
+	return nil
+}
+
+func runClientGroupAdd(cmd *cobra.Command, args []string) error {
+	var created clientGroup
+	if err := sendFilterRequest("POST", clientGroupsURL(cmd), clientGroupFromFlags(cmd, args[0]), http.StatusCreated, &created); err != nil {
+		return err
+	}
+
+	fmt.Printf("✓ Client group '%s' added with profile '%s'\n", created.Name, created.Profile)
+	return nil
+}
+
+func runClientGroupUpdate(cmd *cobra.Command, args []string) error {
+	name := args[0]
+	target := fmt.Sprintf("%s/%s", clientGroupsURL(cmd), url.PathEscape(name))
+	if err := sendFilterRequest("PUT", target, clientGroupFromFlags(cmd, name), http.StatusOK, nil); err != nil {
+		return err
+	}
+
+	fmt.Printf("✓ Client group '%s' updated\n", name)
+	return nil
+}
+
+func runClientGroupRemove(cmd *cobra.Command, args []string) error {
+	name := args[0]
+	target := fmt.Sprintf("%s/%s", clientGroupsURL(cmd), url.PathEscape(name))
+	if err := sendFilterRequest("DELETE", target, nil, http.StatusNoContent, nil); err != nil {
+		return err
+	}
+
+	fmt.Printf("✓ Client group '%s' removed\n", name)
+	return nil
+}
+
+func runFilterProfileList(cmd *cobra.Command, args []string) error {
+	var profiles []filterProfile
+	if err := sendFilterRequest("GET", filterProfilesURL(cmd), nil, http.StatusOK, &profiles); err != nil {
+		return err
+	}
+
+	if len(profiles) == 0 {
+		fmt.Println("No filtering profiles found")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	_, _ = fmt.Fprintln(w, "NAME\tBLOCKLISTS\tBLOCKED\tALLOWED\tSAFE SEARCH\tSCHEDULES")
+	for _, p := range profiles {
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%t\t%s\n", p.Name, strings.Join(p.Blocklists, ", "), len(p.BlockedDomains), len(p.AllowedDomains), p.SafeSearch, formatSchedules(p.Schedules))
+	}
+	_ = w.Flush()
+
+	return nil
+}
+
+func runFilterProfileAdd(cmd *cobra.Command, args []string) error {
+	profile, err := filterProfileFromFlags(cmd, args[0])
+	if err != nil {
+		return err
+	}
+
+	var created filterProfile
+	if err := sendFilterRequest("POST", filterProfilesURL(cmd), profile, http.StatusCreated, &created); err != nil {
+		return err
+	}
+
+	fmt.Printf("✓ Filtering profile '%s' added\n", created.Name)
+	return nil
+}
+
+func runFilterProfileUpdate(cmd *cobra.Command, args []string) error {
+	name := args[0]
+	profile, err := filterProfileFromFlags(cmd, name)
+	if err != nil {
+		return err
+	}
+
+	target := fmt.Sprintf("%s/%s", filterProfilesURL(cmd), url.PathEscape(name))
+	if err := sendFilterRequest("PUT", target, profile, http.StatusOK, nil); err != nil {
+		return err
+	}
+
+	fmt.Printf("✓ Filtering profile '%s' updated\n", name)
+	return nil
+}
+
+func runFilterProfileRemove(cmd *cobra.Command, args []string) error {
+	name := args[0]
+	target := fmt.Sprintf("%s/%s", filterProfilesURL(cmd), url.PathEscape(name))
+	if err := sendFilterRequest("DELETE", target, nil, http.StatusNoContent, nil); err != nil {
+		return err
+	}
+
+	fmt.Printf("✓ Filtering profile '%s' removed\n", name)
+	return nil
+}
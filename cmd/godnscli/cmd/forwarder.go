@@ -0,0 +1,206 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+var forwarderCmd = &cobra.Command{
+	Use:   "forwarder",
+	Short: "Manage conditional forwarders",
+	Long: `Conditional forwarders send queries for a domain and the names below it to their own
+upstream servers instead of the default upstream. The forwarder with the longest matching domain wins.`,
+}
+
+var forwarderListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List conditional forwarders",
+	RunE:  runForwarderList,
+}
+
+var forwarderAddCmd = &cobra.Command{
+	Use:   "add [domain]",
+	Short: "Add a conditional forwarder",
+	Long: `Send queries for a domain to its own upstream servers. Upstreams have the same format as
+DNS_UPSTREAM_SERVER: host:port, tcp://host:port, tls://IP@server-name or https:// URLs.
+
+Examples:
+  godnscli forwarder add corp.internal --upstream 10.0.0.10 --upstream 10.0.0.11 --strategy fastest
+  godnscli forwarder add consul --upstream 127.0.0.1:8600
+  godnscli forwarder add 10.in-addr.arpa --upstream 10.0.0.5 --description "IPAM"`,
+	Args: cobra.ExactArgs(1),
+	RunE: runForwarderAdd,
+}
+
+var forwarderUpdateCmd = &cobra.Command{
+	Use:   "update [domain]",
+	Short: "Replace the upstreams and settings of a conditional forwarder",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runForwarderUpdate,
+}
+
+var forwarderRemoveCmd = &cobra.Command{
+	Use:   "remove [domain]",
+	Short: "Remove a conditional forwarder",
+	Long:  `Send queries for a domain to the default upstream servers again.`,
+	Args:  cobra.ExactArgs(1),
+	RunE:  runForwarderRemove,
+}
+
+func init() {
+	rootCmd.AddCommand(forwarderCmd)
+	forwarderCmd.AddCommand(forwarderListCmd)
+	forwarderCmd.AddCommand(forwarderAddCmd)
+	forwarderCmd.AddCommand(forwarderUpdateCmd)
+	forwarderCmd.AddCommand(forwarderRemoveCmd)
+
+	forwarderCmd.PersistentFlags().String("api-url", "", "GoDNS API URL (default from config)")
+
+	for _, c := range []*cobra.Command{forwarderAddCmd, forwarderUpdateCmd} {
+		c.Flags().StringArray("upstream", nil, "Upstream DNS server (repeatable) (required)")
+		c.Flags().String("strategy", "", "Selection strategy: sequential, round-robin, fastest or parallel (default DNS_UPSTREAM_STRATEGY)")
+		c.Flags().Bool("dnssec-validation", false, "Validate answers with DNSSEC (only for domains signed from the root)")
+		c.Flags().String("description", "", "Description of the forwarder")
+		_ = c.MarkFlagRequired("upstream")
+	}
+}
+
+type conditionalForwarder struct {
+	Domain      string   `json:"domain"`
+	Upstreams   []string `json:"upstreams"`
+	Strategy    string   `json:"strategy,omitempty"`
+	DNSSEC      bool     `json:"dnssec_validation,omitempty"`
+	Description string   `json:"description,omitempty"`
+}
+
+func forwardersURL(cmd *cobra.Command) string {
+	return fmt.Sprintf("%s/api/v1/forwarders", getAPIURL(cmd))
+}
+
+// forwarderFromFlags builds a forwarder for a domain from the add and update flags
+func forwarderFromFlags(cmd *cobra.Command, domain string) conditionalForwarder {
+	upstreams, _ := cmd.Flags().GetStringArray("upstream")
+	strategy, _ := cmd.Flags().GetString("strategy")
+	dnssec, _ := cmd.Flags().GetBool("dnssec-validation")
+	description, _ := cmd.Flags().GetString("description")
+
+	return conditionalForwarder{
+		Domain:      domain,
+		Upstreams:   upstreams,
+		Strategy:    strategy,
+		DNSSEC:      dnssec,
+		Description: description,
+	}
+}
+
+func runForwarderList(cmd *cobra.Command, args []string) error {
+	resp, err := makeAPIRequest("GET", forwardersURL(cmd), nil)
+	if err != nil {
+		return fmt.Errorf("failed to connect to API: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("API request failed (%d): %s", resp.StatusCode, string(body))
+	}
+
+	var forwarders []conditionalForwarder
+	if err := json.NewDecoder(resp.Body).Decode(&forwarders); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	if len(forwarders) == 0 {
+		fmt.Println("No forwarders found")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	_, _ = fmt.Fprintln(w, "DOMAIN\tUPSTREAMS\tSTRATEGY\tDNSSEC\tDESCRIPTION")
+	for _, f := range forwarders {
+		strategy := f.Strategy
+		if strategy == "" {
+			strategy = "default"
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%t\t%s\n", f.Domain, strings.Join(f.Upstreams, ", "), strategy, f.DNSSEC, f.Description)
+	}
+	_ = w.Flush()
+
+	return nil
+}
+
+func runForwarderAdd(cmd *cobra.Command, args []string) error {
+	jsonData, err := json.Marshal(forwarderFromFlags(cmd, args[0]))
+	if err != nil {
+		return fmt.Errorf("failed to encode forwarder: %w", err)
+	}
+
+	resp, err := makeAPIRequest("POST", forwardersURL(cmd), bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("failed to connect to API: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusCreated {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("API request failed (%d): %s", resp.StatusCode, string(body))
+	}
+
+	var created conditionalForwarder
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	fmt.Printf("✓ Queries for '%s' are forwarded to %s\n", created.Domain, strings.Join(created.Upstreams, ", "))
+	return nil
+}
+
+func runForwarderUpdate(cmd *cobra.Command, args []string) error {
+	domain := args[0]
+
+	jsonData, err := json.Marshal(forwarderFromFlags(cmd, domain))
+	if err != nil {
+		return fmt.Errorf("failed to encode forwarder: %w", err)
+	}
+
+	resp, err := makeAPIRequest("PUT", fmt.Sprintf("%s/%s", forwardersURL(cmd), url.PathEscape(domain)), bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("failed to connect to API: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("API request failed (%d): %s", resp.StatusCode, string(body))
+	}
+
+	fmt.Printf("✓ Forwarder for '%s' updated\n", domain)
+	return nil
+}
+
+func runForwarderRemove(cmd *cobra.Command, args []string) error {
+	domain := args[0]
+
+	resp, err := makeAPIRequest("DELETE", fmt.Sprintf("%s/%s", forwardersURL(cmd), url.PathEscape(domain)), nil)
+	if err != nil {
+		return fmt.Errorf("failed to connect to API: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("API request failed (%d): %s", resp.StatusCode, string(body))
+	}
+
+	fmt.Printf("✓ Queries for '%s' go to the default upstream servers again\n", domain)
+	return nil
+}
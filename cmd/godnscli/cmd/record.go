@@ -31,8 +31,8 @@ var recordListCmd = &cobra.Command{
 
 var recordGetCmd = &cobra.Command{
 	Use:   "get [domain] [name] [type]",
-	Short: "Get a specific DNS record",
-	Long:  `Get details of a specific DNS record.`,
+	Short: "Get a DNS record set",
+	Long:  `Get all DNS records (the RRset) with a specific name and type.`,
 	Args:  cobra.ExactArgs(3),
 	RunE:  runRecordGet,
 }
@@ -53,7 +53,13 @@ Examples:
   godnscli record create example.lan --name _http._tcp.example.lan. --type SRV --srv-priority 10 --srv-weight 60 --srv-port 80 --srv-target web.example.lan. --ttl 300
 
   # Create a CAA record
-  godnscli record create example.lan --name example.lan. --type CAA --caa-flags 0 --caa-tag issue --caa-value letsencrypt.org --ttl 300`,
+  godnscli record create example.lan --name example.lan. --type CAA --caa-flags 0 --caa-tag issue --caa-value letsencrypt.org --ttl 300
+
+  # Add a second A record to the same name (records with the same name and type form an RRset)
+  godnscli record create example.lan --name www.example.lan. --type A --value 192.168.1.101 --ttl 300
+
+  # Answer clients in the office view with an internal address
+  godnscli record create example.lan --view office --name app.example.lan. --type A --value 10.0.0.5`,
 	Args: cobra.ExactArgs(1),
 	RunE: runRecordCreate,
 }
@@ -61,17 +67,24 @@ Examples:
 var recordUpdateCmd = &cobra.Command{
 	Use:   "update [domain] [name] [type]",
 	Short: "Update a DNS record",
-	Long:  `Update an existing DNS record.`,
-	Args:  cobra.ExactArgs(3),
-	RunE:  runRecordUpdate,
+	Long: `Update an existing DNS record.
+
+When several records share the name and type, select the one to replace with --current-value.
+
+Examples:
+  godnscli record update example.lan www.example.lan. A --current-value 192.168.1.100 --value 192.168.1.110`,
+	Args: cobra.ExactArgs(3),
+	RunE: runRecordUpdate,
 }
 
 var recordDeleteCmd = &cobra.Command{
 	Use:   "delete [domain] [name] [type]",
 	Short: "Delete a DNS record",
-	Long:  `Delete a DNS record from a zone.`,
-	Args:  cobra.ExactArgs(3),
-	RunE:  runRecordDelete,
+	Long: `Delete a DNS record from a zone.
+
+Without --value every record with the given name and type (the whole RRset) is deleted.`,
+	Args: cobra.ExactArgs(3),
+	RunE: runRecordDelete,
 }
 
 func init() {
@@ -85,7 +98,7 @@ func init() {
 	// Common flags for create/update
 	for _, cmd := range []*cobra.Command{recordCreateCmd, recordUpdateCmd} {
 		cmd.Flags().String("name", "", "Record name (FQDN) (required)")
-		cmd.Flags().String("type", "", "Record type: A, AAAA, CNAME, ALIAS, MX, NS, TXT, PTR, SRV, SOA, CAA (required)")
+		cmd.Flags().String("type", "", "Record type: A, AAAA, CNAME, ALIAS, MX, NS, DS, TXT, PTR, SRV, SOA, CAA (required)")
 		cmd.Flags().Int("ttl", 300, "Time to live in seconds")
 		cmd.Flags().String("value", "", "Record value (for simple record types)")
 
@@ -119,9 +132,15 @@ func init() {
 
 	// Add API URL flag
 	recordCmd.PersistentFlags().String("api-url", "", "GoDNS API URL (default from config)")
+	recordCmd.PersistentFlags().String("view", "", "Split-horizon view the records are served to (default: clients in no view)")
 
 	// List filter flags
 	recordListCmd.Flags().String("type-filter", "", "Filter by record type")
+
+	// RRset member selection flags
+	recordGetCmd.Flags().String("value", "", "Only show the record with this value (RDATA)")
+	recordUpdateCmd.Flags().String("current-value", "", "Current value (RDATA) of the record to update, required when the RRset has several records")
+	recordDeleteCmd.Flags().String("value", "", "Only delete the record with this value (RDATA)")
 }
 
 func buildRecordJSON(cmd *cobra.Command) (map[string]interface{}, error) {
@@ -241,6 +260,21 @@ func buildRecordJSON(cmd *cobra.Command) (map[string]interface{}, error) {
 	return record, nil
 }
 
+// recordQuery returns the query string selecting a record by value, in the view of the --view flag
+func recordQuery(cmd *cobra.Command, value string) string {
+	query := url.Values{}
+	if value != "" {
+		query.Set("value", value)
+	}
+	if view, _ := cmd.Flags().GetString("view"); view != "" {
+		query.Set("view", view)
+	}
+	if len(query) == 0 {
+		return ""
+	}
+	return "?" + query.Encode()
+}
+
 func runRecordList(cmd *cobra.Command, args []string) error {
 	domain := args[0]
 	apiURL := getAPIURL(cmd)
@@ -262,8 +296,17 @@ func runRecordList(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("failed to decode response: %w", err)
 	}
 
-	records, ok := zone["records"].([]interface{})
-	if !ok || len(records) == 0 {
+	records, _ := zone["records"].([]interface{})
+	if view, _ := cmd.Flags().GetString("view"); view != "" {
+		records = nil
+		views, _ := zone["views"].([]interface{})
+		for _, v := range views {
+			if zoneView := v.(map[string]interface{}); zoneView["name"] == view {
+				records, _ = zoneView["records"].([]interface{})
+			}
+		}
+	}
+	if len(records) == 0 {
 		fmt.Println("No records found")
 		return nil
 	}
@@ -342,6 +385,8 @@ func runRecordGet(cmd *cobra.Command, args []string) error {
 	apiURL := getAPIURL(cmd)
 	reqURL := fmt.Sprintf("%s/api/v1/zones/%s/records/%s/%s",
 		apiURL, url.PathEscape(domain), url.PathEscape(name), url.PathEscape(recordType))
+	value, _ := cmd.Flags().GetString("value")
+	reqURL += recordQuery(cmd, value)
 
 	resp, err := makeAPIRequest("GET", reqURL, nil)
 	if err != nil {
@@ -354,13 +399,13 @@ func runRecordGet(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("API request failed (%d): %s", resp.StatusCode, string(body))
 	}
 
-	var record map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&record); err != nil {
+	var records []map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&records); err != nil {
 		return fmt.Errorf("failed to decode response: %w", err)
 	}
 
-	// Pretty print the record
-	data, err := json.MarshalIndent(record, "", "  ")
+	// Pretty print the record set
+	data, err := json.MarshalIndent(records, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to format response: %w", err)
 	}
@@ -372,7 +417,7 @@ func runRecordGet(cmd *cobra.Command, args []string) error {
 func runRecordCreate(cmd *cobra.Command, args []string) error {
 	domain := args[0]
 	apiURL := getAPIURL(cmd)
-	reqURL := fmt.Sprintf("%s/api/v1/zones/%s/records", apiURL, url.PathEscape(domain))
+	reqURL := fmt.Sprintf("%s/api/v1/zones/%s/records", apiURL, url.PathEscape(domain)) + recordQuery(cmd, "")
 
 	record, err := buildRecordJSON(cmd)
 	if err != nil {
@@ -407,6 +452,9 @@ func runRecordUpdate(cmd *cobra.Command, args []string) error {
 	reqURL := fmt.Sprintf("%s/api/v1/zones/%s/records/%s/%s",
 		apiURL, url.PathEscape(domain), url.PathEscape(name), url.PathEscape(recordType))
 
+	currentValue, _ := cmd.Flags().GetString("current-value")
+	reqURL += recordQuery(cmd, currentValue)
+
 	// Override name and type from args
 	_ = cmd.Flags().Set("name", name)
 	_ = cmd.Flags().Set("type", recordType)
@@ -444,8 +492,15 @@ func runRecordDelete(cmd *cobra.Command, args []string) error {
 	reqURL := fmt.Sprintf("%s/api/v1/zones/%s/records/%s/%s",
 		apiURL, url.PathEscape(domain), url.PathEscape(name), url.PathEscape(recordType))
 
+	value, _ := cmd.Flags().GetString("value")
+	target := fmt.Sprintf("all %s records for %s", recordType, name)
+	if value != "" {
+		target = fmt.Sprintf("record '%s %s %s'", name, recordType, value)
+	}
+	reqURL += recordQuery(cmd, value)
+
 	// Confirm deletion
-	fmt.Printf("Are you sure you want to delete record '%s %s' from zone '%s'? (yes/no): ", name, recordType, domain)
+	fmt.Printf("Are you sure you want to delete %s from zone '%s'? (yes/no): ", target, domain)
 	var confirm string
 	_, _ = fmt.Scanln(&confirm)
 	if confirm != "yes" {
@@ -464,6 +519,10 @@ func runRecordDelete(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("API request failed (%d): %s", resp.StatusCode, string(body))
 	}
 
-	fmt.Printf("✓ Record deleted: %s %s\n", name, recordType)
+	if value != "" {
+		fmt.Printf("✓ Record deleted: %s %s %s\n", name, recordType, value)
+	} else {
+		fmt.Printf("✓ Record set deleted: %s %s\n", name, recordType)
+	}
 	return nil
 }
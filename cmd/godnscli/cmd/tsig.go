@@ -0,0 +1,232 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+var tsigCmd = &cobra.Command{
+	Use:   "tsig",
+	Short: "Manage TSIG keys",
+	Long:  `Create, list, rotate, and revoke the TSIG keys that sign zone transfers, dynamic updates, and NOTIFY messages.`,
+}
+
+var tsigListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List TSIG keys",
+	RunE:  runTSIGList,
+}
+
+var tsigCreateCmd = &cobra.Command{
+	Use:   "create [name]",
+	Short: "Create a TSIG key",
+	Long: `Create a TSIG key. A random secret is generated unless --secret is given.
+The secret is printed once and can't be read back later.
+
+Examples:
+  godnscli tsig create ddns-key
+  godnscli tsig create transfer-key --algorithm hmac-sha512 --zone example.lan --operation transfer`,
+	Args: cobra.ExactArgs(1),
+	RunE: runTSIGCreate,
+}
+
+var tsigRotateCmd = &cobra.Command{
+	Use:   "rotate [name]",
+	Short: "Replace the secret of a TSIG key",
+	Long:  `Generate a new secret for a TSIG key. Messages signed with the old secret are rejected from now on.`,
+	Args:  cobra.ExactArgs(1),
+	RunE:  runTSIGRotate,
+}
+
+var tsigRevokeCmd = &cobra.Command{
+	Use:   "revoke [name]",
+	Short: "Revoke a TSIG key",
+	Long:  `Delete a TSIG key. Messages signed with it are rejected from now on.`,
+	Args:  cobra.ExactArgs(1),
+	RunE:  runTSIGRevoke,
+}
+
+func init() {
+	rootCmd.AddCommand(tsigCmd)
+	tsigCmd.AddCommand(tsigListCmd)
+	tsigCmd.AddCommand(tsigCreateCmd)
+	tsigCmd.AddCommand(tsigRotateCmd)
+	tsigCmd.AddCommand(tsigRevokeCmd)
+
+	tsigCmd.PersistentFlags().String("api-url", "", "GoDNS API URL (default from config)")
+
+	tsigCreateCmd.Flags().String("algorithm", "hmac-sha256", "HMAC algorithm (hmac-sha256 or hmac-sha512)")
+	tsigCreateCmd.Flags().String("secret", "", "Base64-encoded secret (generated when empty)")
+	tsigCreateCmd.Flags().StringArray("zone", nil, "Zone the key may be used for (repeatable, default all zones)")
+	tsigCreateCmd.Flags().StringArray("operation", nil, "Operation the key may be used for: transfer, update or notify (repeatable, default all)")
+}
+
+type tsigKey struct {
+	Name       string   `json:"name"`
+	Algorithm  string   `json:"algorithm"`
+	Secret     string   `json:"secret,omitempty"`
+	Zones      []string `json:"zones,omitempty"`
+	Operations []string `json:"operations,omitempty"`
+	CreatedAt  string   `json:"created_at,omitempty"`
+	RotatedAt  string   `json:"rotated_at,omitempty"`
+}
+
+func tsigKeysURL(cmd *cobra.Command) string {
+	return fmt.Sprintf("%s/api/v1/tsig-keys", getAPIURL(cmd))
+}
+
+// printTSIGSecret prints a key with its secret in the formats used by DNS tools
+func printTSIGSecret(key tsigKey) {
+	algorithm := strings.TrimSuffix(key.Algorithm, ".")
+	name := strings.TrimSuffix(key.Name, ".")
+
+	fmt.Printf("Name:      %s\n", key.Name)
+	fmt.Printf("Algorithm: %s\n", algorithm)
+	fmt.Printf("Secret:    %s\n\n", key.Secret)
+	fmt.Println("The secret is not shown again. For nsupdate and dig:")
+	fmt.Printf("  -y %s:%s:%s\n\n", algorithm, name, key.Secret)
+	fmt.Println("For BIND:")
+	fmt.Printf("  key \"%s\" { algorithm %s; secret \"%s\"; };\n", name, algorithm, key.Secret)
+}
+
+func runTSIGList(cmd *cobra.Command, args []string) error {
+	resp, err := makeAPIRequest("GET", tsigKeysURL(cmd), nil)
+	if err != nil {
+		return fmt.Errorf("failed to connect to API: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("API request failed (%d): %s", resp.StatusCode, string(body))
+	}
+
+	var keys []tsigKey
+	if err := json.NewDecoder(resp.Body).Decode(&keys); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	if len(keys) == 0 {
+		fmt.Println("No TSIG keys found")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	_, _ = fmt.Fprintln(w, "NAME\tALGORITHM\tZONES\tOPERATIONS\tROTATED")
+	for _, key := range keys {
+		zones := "(all)"
+		if len(key.Zones) > 0 {
+			zones = strings.Join(key.Zones, ",")
+		}
+		operations := "(all)"
+		if len(key.Operations) > 0 {
+			operations = strings.Join(key.Operations, ",")
+		}
+		rotated := key.RotatedAt
+		if rotated == "" {
+			rotated = "never"
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", key.Name, strings.TrimSuffix(key.Algorithm, "."), zones, operations, rotated)
+	}
+	_ = w.Flush()
+
+	return nil
+}
+
+func runTSIGCreate(cmd *cobra.Command, args []string) error {
+	algorithm, _ := cmd.Flags().GetString("algorithm")
+	secret, _ := cmd.Flags().GetString("secret")
+	zones, _ := cmd.Flags().GetStringArray("zone")
+	operations, _ := cmd.Flags().GetStringArray("operation")
+
+	jsonData, err := json.Marshal(tsigKey{
+		Name:       args[0],
+		Algorithm:  algorithm,
+		Secret:     secret,
+		Zones:      zones,
+		Operations: operations,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode TSIG key: %w", err)
+	}
+
+	resp, err := makeAPIRequest("POST", tsigKeysURL(cmd), bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("failed to connect to API: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusCreated {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("API request failed (%d): %s", resp.StatusCode, string(body))
+	}
+
+	var key tsigKey
+	if err := json.NewDecoder(resp.Body).Decode(&key); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	fmt.Printf("✓ TSIG key '%s' created\n\n", key.Name)
+	printTSIGSecret(key)
+	return nil
+}
+
+func runTSIGRotate(cmd *cobra.Command, args []string) error {
+	name := args[0]
+
+	resp, err := makeAPIRequest("POST", fmt.Sprintf("%s/%s/rotate", tsigKeysURL(cmd), url.PathEscape(name)), nil)
+	if err != nil {
+		return fmt.Errorf("failed to connect to API: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("API request failed (%d): %s", resp.StatusCode, string(body))
+	}
+
+	var key tsigKey
+	if err := json.NewDecoder(resp.Body).Decode(&key); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	fmt.Printf("✓ TSIG key '%s' rotated, the old secret is no longer accepted\n\n", key.Name)
+	printTSIGSecret(key)
+	return nil
+}
+
+func runTSIGRevoke(cmd *cobra.Command, args []string) error {
+	name := args[0]
+
+	// Confirm revocation
+	fmt.Printf("Are you sure you want to revoke TSIG key '%s'? (yes/no): ", name)
+	var confirm string
+	_, _ = fmt.Scanln(&confirm)
+	if confirm != "yes" {
+		fmt.Println("Revocation cancelled")
+		return nil
+	}
+
+	resp, err := makeAPIRequest("DELETE", fmt.Sprintf("%s/%s", tsigKeysURL(cmd), url.PathEscape(name)), nil)
+	if err != nil {
+		return fmt.Errorf("failed to connect to API: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("API request failed (%d): %s", resp.StatusCode, string(body))
+	}
+
+	fmt.Printf("✓ TSIG key '%s' revoked\n", name)
+	return nil
+}
@@ -0,0 +1,193 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+var viewCmd = &cobra.Command{
+	Use:   "view",
+	Short: "Manage split-horizon views",
+	Long: `Views are named sets of client networks. Clients in a view get the records a zone has for
+the view (added with 'godnscli record create --view') instead of its default records. When a
+client is in several views, the view with the longest matching prefix wins.`,
+}
+
+var viewListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List views",
+	RunE:  runViewList,
+}
+
+var viewAddCmd = &cobra.Command{
+	Use:   "add [name]",
+	Short: "Add a view",
+	Long: `Add a view for clients in the given networks.
+
+Examples:
+  godnscli view add office --prefix 10.0.0.0/8 --prefix fd00::/8 --description "Office network"
+  godnscli record create example.lan --view office --name app.example.lan. --type A --value 10.0.0.5`,
+	Args: cobra.ExactArgs(1),
+	RunE: runViewAdd,
+}
+
+var viewUpdateCmd = &cobra.Command{
+	Use:   "update [name]",
+	Short: "Replace the networks and description of a view",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runViewUpdate,
+}
+
+var viewRemoveCmd = &cobra.Command{
+	Use:   "remove [name]",
+	Short: "Remove a view",
+	Long:  `Answer the clients of a view with the default records again. The records of zones for the view are kept.`,
+	Args:  cobra.ExactArgs(1),
+	RunE:  runViewRemove,
+}
+
+func init() {
+	rootCmd.AddCommand(viewCmd)
+	viewCmd.AddCommand(viewListCmd)
+	viewCmd.AddCommand(viewAddCmd)
+	viewCmd.AddCommand(viewUpdateCmd)
+	viewCmd.AddCommand(viewRemoveCmd)
+
+	viewCmd.PersistentFlags().String("api-url", "", "GoDNS API URL (default from config)")
+
+	for _, c := range []*cobra.Command{viewAddCmd, viewUpdateCmd} {
+		c.Flags().StringArray("prefix", nil, "Client network in CIDR notation (repeatable) (required)")
+		c.Flags().String("description", "", "Description of the view")
+		_ = c.MarkFlagRequired("prefix")
+	}
+}
+
+type view struct {
+	Name        string   `json:"name"`
+	Prefixes    []string `json:"prefixes"`
+	Description string   `json:"description,omitempty"`
+}
+
+func viewsURL(cmd *cobra.Command) string {
+	return fmt.Sprintf("%s/api/v1/views", getAPIURL(cmd))
+}
+
+// viewFromFlags builds a view from the add and update flags
+func viewFromFlags(cmd *cobra.Command, name string) view {
+	prefixes, _ := cmd.Flags().GetStringArray("prefix")
+	description, _ := cmd.Flags().GetString("description")
+
+	return view{
+		Name:        name,
+		Prefixes:    prefixes,
+		Description: description,
+	}
+}
+
+func runViewList(cmd *cobra.Command, args []string) error {
+	resp, err := makeAPIRequest("GET", viewsURL(cmd), nil)
+	if err != nil {
+		return fmt.Errorf("failed to connect to API: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("API request failed (%d): %s", resp.StatusCode, string(body))
+	}
+
+	var views []view
+	if err := json.NewDecoder(resp.Body).Decode(&views); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	if len(views) == 0 {
+		fmt.Println("No views found")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	_, _ = fmt.Fprintln(w, "NAME\tPREFIXES\tDESCRIPTION")
+	for _, v := range views {
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\n", v.Name, strings.Join(v.Prefixes, ", "), v.Description)
+	}
+	_ = w.Flush()
+
+	return nil
+}
+
+func runViewAdd(cmd *cobra.Command, args []string) error {
+	jsonData, err := json.Marshal(viewFromFlags(cmd, args[0]))
+	if err != nil {
+		return fmt.Errorf("failed to encode view: %w", err)
+	}
+
+	resp, err := makeAPIRequest("POST", viewsURL(cmd), bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("failed to connect to API: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusCreated {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("API request failed (%d): %s", resp.StatusCode, string(body))
+	}
+
+	var created view
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	fmt.Printf("✓ View '%s' added for %s\n", created.Name, strings.Join(created.Prefixes, ", "))
+	return nil
+}
+
+func runViewUpdate(cmd *cobra.Command, args []string) error {
+	name := args[0]
+
+	jsonData, err := json.Marshal(viewFromFlags(cmd, name))
+	if err != nil {
+		return fmt.Errorf("failed to encode view: %w", err)
+	}
+
+	resp, err := makeAPIRequest("PUT", fmt.Sprintf("%s/%s", viewsURL(cmd), url.PathEscape(name)), bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("failed to connect to API: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("API request failed (%d): %s", resp.StatusCode, string(body))
+	}
+
+	fmt.Printf("✓ View '%s' updated\n", name)
+	return nil
+}
+
+func runViewRemove(cmd *cobra.Command, args []string) error {
+	name := args[0]
+
+	resp, err := makeAPIRequest("DELETE", fmt.Sprintf("%s/%s", viewsURL(cmd), url.PathEscape(name)), nil)
+	if err != nil {
+		return fmt.Errorf("failed to connect to API: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("API request failed (%d): %s", resp.StatusCode, string(body))
+	}
+
+	fmt.Printf("✓ Clients of view '%s' get the default records again\n", name)
+	return nil
+}
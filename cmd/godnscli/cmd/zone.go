@@ -41,11 +41,29 @@ var zoneDeleteCmd = &cobra.Command{
 	RunE:  runZoneDelete,
 }
 
+var zoneRefreshCmd = &cobra.Command{
+	Use:   "refresh [domain]",
+	Short: "Refresh a secondary zone from its primaries",
+	Long:  `Schedule an immediate transfer check of a secondary zone. Use "zone get" to see the result in secondary_status.`,
+	Args:  cobra.ExactArgs(1),
+	RunE:  runZoneRefresh,
+}
+
+var zoneDSCmd = &cobra.Command{
+	Use:   "ds [domain]",
+	Short: "Show the DS records of a signed zone",
+	Long:  `Show the DS records of a DNSSEC signed zone, to be published in the parent zone.`,
+	Args:  cobra.ExactArgs(1),
+	RunE:  runZoneDS,
+}
+
 func init() {
 	rootCmd.AddCommand(zoneCmd)
 	zoneCmd.AddCommand(zoneListCmd)
 	zoneCmd.AddCommand(zoneGetCmd)
 	zoneCmd.AddCommand(zoneDeleteCmd)
+	zoneCmd.AddCommand(zoneRefreshCmd)
+	zoneCmd.AddCommand(zoneDSCmd)
 
 	// Add API URL flag to zone commands
 	zoneCmd.PersistentFlags().String("api-url", "", "GoDNS API URL (default from config)")
@@ -108,14 +126,18 @@ func runZoneList(cmd *cobra.Command, args []string) error {
 
 	// Display zones in a table
 	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
-	_, _ = fmt.Fprintln(w, "DOMAIN\tRECORDS")
+	_, _ = fmt.Fprintln(w, "DOMAIN\tKIND\tRECORDS")
 	for _, zone := range zones {
 		domain := zone["domain"]
+		kind, _ := zone["kind"].(string)
+		if kind == "" {
+			kind = "primary"
+		}
 		recordCount := 0
 		if records, ok := zone["records"].([]interface{}); ok {
 			recordCount = len(records)
 		}
-		_, _ = fmt.Fprintf(w, "%s\t%d\n", domain, recordCount)
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%d\n", domain, kind, recordCount)
 	}
 	_ = w.Flush()
 
@@ -181,3 +203,50 @@ func runZoneDelete(cmd *cobra.Command, args []string) error {
 	fmt.Printf("✓ Zone '%s' deleted successfully\n", domain)
 	return nil
 }
+
+func runZoneRefresh(cmd *cobra.Command, args []string) error {
+	domain := args[0]
+	apiURL := getAPIURL(cmd)
+	url := fmt.Sprintf("%s/api/v1/zones/%s/refresh", apiURL, domain)
+
+	resp, err := makeAPIRequest("POST", url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to connect to API: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusAccepted {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("API request failed (%d): %s", resp.StatusCode, string(body))
+	}
+
+	fmt.Printf("✓ Refresh of zone '%s' scheduled\n", domain)
+	return nil
+}
+
+func runZoneDS(cmd *cobra.Command, args []string) error {
+	domain := args[0]
+	apiURL := getAPIURL(cmd)
+	url := fmt.Sprintf("%s/api/v1/zones/%s/ds", apiURL, domain)
+
+	resp, err := makeAPIRequest("GET", url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to connect to API: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("API request failed (%d): %s", resp.StatusCode, string(body))
+	}
+
+	var signers []map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&signers); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	for _, signer := range signers {
+		fmt.Println(signer["ds"])
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var zoneDNSSECCmd = &cobra.Command{
+	Use:   "dnssec",
+	Short: "Manage DNSSEC keys of signed zones",
+	Long:  `View the signing keys of a zone, start key rollovers and confirm DS updates at the parent zone.`,
+}
+
+var zoneDNSSECStatusCmd = &cobra.Command{
+	Use:   "status [domain]",
+	Short: "Show the signing keys and rollover state of a zone",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runZoneDNSSECStatus,
+}
+
+var zoneDNSSECRolloverCmd = &cobra.Command{
+	Use:   "rollover [domain]",
+	Short: "Start a key rollover now",
+	Long: `Start a ZSK or KSK rollover now instead of at the end of the key's lifetime.
+
+Examples:
+  godnscli zone dnssec rollover example.lan --key zsk
+  godnscli zone dnssec rollover example.lan --key ksk`,
+	Args: cobra.ExactArgs(1),
+	RunE: runZoneDNSSECRollover,
+}
+
+var zoneDNSSECDSPublishedCmd = &cobra.Command{
+	Use:   "ds-published [domain]",
+	Short: "Confirm that the parent zone has the new DS record",
+	Long:  `Confirm that the DS record of the new KSK is published in the parent zone, so the KSK rollover can complete. Not needed when the parent zone is served by GoDNS.`,
+	Args:  cobra.ExactArgs(1),
+	RunE:  runZoneDNSSECDSPublished,
+}
+
+func init() {
+	zoneCmd.AddCommand(zoneDNSSECCmd)
+	zoneDNSSECCmd.AddCommand(zoneDNSSECStatusCmd)
+	zoneDNSSECCmd.AddCommand(zoneDNSSECRolloverCmd)
+	zoneDNSSECCmd.AddCommand(zoneDNSSECDSPublishedCmd)
+
+	zoneDNSSECRolloverCmd.Flags().String("key", "", "Key type to roll over: zsk or ksk (required)")
+	_ = zoneDNSSECRolloverCmd.MarkFlagRequired("key")
+}
+
+// dnssecStatus is the DNSSEC status returned by the API
+type dnssecStatus struct {
+	Zone string `json:"zone"`
+	Keys []struct {
+		KeyTag    uint16    `json:"key_tag"`
+		Flags     uint16    `json:"flags"`
+		Algorithm uint8     `json:"algorithm"`
+		State     string    `json:"state"`
+		CreatedAt time.Time `json:"created_at"`
+	} `json:"keys"`
+	DS []struct {
+		DS string `json:"ds"`
+	} `json:"ds"`
+	DSPending       bool       `json:"ds_pending"`
+	NextZSKRollover *time.Time `json:"next_zsk_rollover"`
+	NextKSKRollover *time.Time `json:"next_ksk_rollover"`
+}
+
+func zoneDNSSECURL(cmd *cobra.Command, domain string, action string) string {
+	u := fmt.Sprintf("%s/api/v1/zones/%s/dnssec", getAPIURL(cmd), url.PathEscape(domain))
+	if action != "" {
+		u += "/" + action
+	}
+	return u
+}
+
+func runZoneDNSSECStatus(cmd *cobra.Command, args []string) error {
+	return requestDNSSECStatus("GET", zoneDNSSECURL(cmd, args[0], ""), nil)
+}
+
+func runZoneDNSSECRollover(cmd *cobra.Command, args []string) error {
+	keyType, _ := cmd.Flags().GetString("key")
+
+	jsonData, err := json.Marshal(map[string]string{"key_type": keyType})
+	if err != nil {
+		return fmt.Errorf("failed to encode rollover request: %w", err)
+	}
+
+	return requestDNSSECStatus("POST", zoneDNSSECURL(cmd, args[0], "rollover"), bytes.NewBuffer(jsonData))
+}
+
+func runZoneDNSSECDSPublished(cmd *cobra.Command, args []string) error {
+	return requestDNSSECStatus("POST", zoneDNSSECURL(cmd, args[0], "ds-published"), nil)
+}
+
+// requestDNSSECStatus sends a DNSSEC request and prints the status in the response
+func requestDNSSECStatus(method, endpoint string, body io.Reader) error {
+	resp, err := makeAPIRequest(method, endpoint, body)
+	if err != nil {
+		return fmt.Errorf("failed to connect to API: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("API request failed (%d): %s", resp.StatusCode, string(body))
+	}
+
+	var status dnssecStatus
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	fmt.Printf("Zone: %s\n\n", status.Zone)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	_, _ = fmt.Fprintln(w, "KEY TAG\tTYPE\tALGORITHM\tSTATE\tCREATED")
+	for _, key := range status.Keys {
+		keyType := "ZSK"
+		if key.Flags == 257 {
+			keyType = "KSK"
+		}
+		_, _ = fmt.Fprintf(w, "%d\t%s\t%d\t%s\t%s\n", key.KeyTag, keyType, key.Algorithm, key.State, key.CreatedAt.Format(time.RFC3339))
+	}
+	_ = w.Flush()
+
+	fmt.Println()
+	for _, ds := range status.DS {
+		fmt.Printf("DS: %s\n", ds.DS)
+	}
+	if status.DSPending {
+		fmt.Println("⚠ The parent zone must be updated with the DS record above, then run 'godnscli zone dnssec ds-published'")
+	}
+	if status.NextZSKRollover != nil {
+		fmt.Printf("Next ZSK rollover: %s\n", status.NextZSKRollover.Format(time.RFC3339))
+	}
+	if status.NextKSKRollover != nil {
+		fmt.Printf("Next KSK rollover: %s\n", status.NextKSKRollover.Format(time.RFC3339))
+	}
+	return nil
+}
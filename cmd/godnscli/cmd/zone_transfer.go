@@ -0,0 +1,142 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var zoneTransferCmd = &cobra.Command{
+	Use:   "transfer",
+	Short: "Manage zone transfer (AXFR/IXFR) access",
+	Long:  `View, set, and delete the ACL that controls which secondaries may transfer a zone.`,
+}
+
+var zoneTransferGetCmd = &cobra.Command{
+	Use:   "get [domain]",
+	Short: "Get the transfer ACL of a zone",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runZoneTransferGet,
+}
+
+var zoneTransferSetCmd = &cobra.Command{
+	Use:   "set [domain]",
+	Short: "Set the transfer ACL of a zone",
+	Long: `Allow client networks to transfer a zone with AXFR/IXFR.
+
+Examples:
+  godnscli zone transfer set example.lan --allow 192.168.1.53 --allow 10.0.0.0/24
+  godnscli zone transfer set example.lan --allow 192.168.1.53 --tsig-key transfer-key.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runZoneTransferSet,
+}
+
+var zoneTransferDeleteCmd = &cobra.Command{
+	Use:   "delete [domain]",
+	Short: "Delete the transfer ACL of a zone (disables transfers)",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runZoneTransferDelete,
+}
+
+func init() {
+	zoneCmd.AddCommand(zoneTransferCmd)
+	zoneTransferCmd.AddCommand(zoneTransferGetCmd)
+	zoneTransferCmd.AddCommand(zoneTransferSetCmd)
+	zoneTransferCmd.AddCommand(zoneTransferDeleteCmd)
+
+	zoneTransferSetCmd.Flags().StringArray("allow", nil, "Client IP address or CIDR prefix allowed to transfer the zone (repeatable) (required)")
+	zoneTransferSetCmd.Flags().StringArray("tsig-key", nil, "TSIG key name that must sign transfer requests (repeatable)")
+	_ = zoneTransferSetCmd.MarkFlagRequired("allow")
+}
+
+func zoneTransferURL(cmd *cobra.Command, domain string) string {
+	return fmt.Sprintf("%s/api/v1/zones/%s/transfer", getAPIURL(cmd), url.PathEscape(domain))
+}
+
+func runZoneTransferGet(cmd *cobra.Command, args []string) error {
+	domain := args[0]
+
+	resp, err := makeAPIRequest("GET", zoneTransferURL(cmd, domain), nil)
+	if err != nil {
+		return fmt.Errorf("failed to connect to API: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode == http.StatusNotFound {
+		fmt.Printf("No transfer ACL for zone '%s' (transfers are disabled)\n", domain)
+		return nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("API request failed (%d): %s", resp.StatusCode, string(body))
+	}
+
+	var acl struct {
+		AllowPrefixes []string `json:"allow_prefixes"`
+		TSIGKeys      []string `json:"tsig_keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&acl); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	fmt.Printf("Zone:      %s\n", domain)
+	fmt.Printf("Allow:     %s\n", strings.Join(acl.AllowPrefixes, ", "))
+	if len(acl.TSIGKeys) > 0 {
+		fmt.Printf("TSIG keys: %s\n", strings.Join(acl.TSIGKeys, ", "))
+	} else {
+		fmt.Println("TSIG keys: (none required)")
+	}
+	return nil
+}
+
+func runZoneTransferSet(cmd *cobra.Command, args []string) error {
+	domain := args[0]
+	allow, _ := cmd.Flags().GetStringArray("allow")
+	keys, _ := cmd.Flags().GetStringArray("tsig-key")
+
+	jsonData, err := json.Marshal(map[string]interface{}{
+		"allow_prefixes": allow,
+		"tsig_keys":      keys,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode transfer ACL: %w", err)
+	}
+
+	resp, err := makeAPIRequest("PUT", zoneTransferURL(cmd, domain), bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("failed to connect to API: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("API request failed (%d): %s", resp.StatusCode, string(body))
+	}
+
+	fmt.Printf("✓ Transfer ACL for zone '%s' updated\n", domain)
+	return nil
+}
+
+func runZoneTransferDelete(cmd *cobra.Command, args []string) error {
+	domain := args[0]
+
+	resp, err := makeAPIRequest("DELETE", zoneTransferURL(cmd, domain), nil)
+	if err != nil {
+		return fmt.Errorf("failed to connect to API: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("API request failed (%d): %s", resp.StatusCode, string(body))
+	}
+
+	fmt.Printf("✓ Transfer ACL for zone '%s' deleted, transfers are disabled\n", domain)
+	return nil
+}
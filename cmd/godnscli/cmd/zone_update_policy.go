@@ -0,0 +1,172 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var zoneUpdatePolicyCmd = &cobra.Command{
+	Use:   "update-policy",
+	Short: "Manage dynamic update (RFC 2136) access",
+	Long:  `View, set, and delete the policy that controls which TSIG keys may change a zone with DNS UPDATE.`,
+}
+
+var zoneUpdatePolicyGetCmd = &cobra.Command{
+	Use:   "get [domain]",
+	Short: "Get the update policy of a zone",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runZoneUpdatePolicyGet,
+}
+
+var zoneUpdatePolicySetCmd = &cobra.Command{
+	Use:   "set [domain]",
+	Short: "Set the update policy of a zone",
+	Long: `Allow TSIG keys to update names in a zone with DNS UPDATE.
+
+Each grant has the form key:names[:types], with comma-separated names and types.
+Names are relative to the zone or FQDNs; "@" is the apex and "*.dhcp" matches
+every name below dhcp.<zone>. Without types, all record types may be updated.
+
+Examples:
+  godnscli zone update-policy set example.lan --grant 'dhcp-key.:*.dhcp:A,AAAA'
+  godnscli zone update-policy set example.lan --grant 'acme-key.:_acme-challenge,_acme-challenge.www:TXT'`,
+	Args: cobra.ExactArgs(1),
+	RunE: runZoneUpdatePolicySet,
+}
+
+var zoneUpdatePolicyDeleteCmd = &cobra.Command{
+	Use:   "delete [domain]",
+	Short: "Delete the update policy of a zone (disables dynamic updates)",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runZoneUpdatePolicyDelete,
+}
+
+func init() {
+	zoneCmd.AddCommand(zoneUpdatePolicyCmd)
+	zoneUpdatePolicyCmd.AddCommand(zoneUpdatePolicyGetCmd)
+	zoneUpdatePolicyCmd.AddCommand(zoneUpdatePolicySetCmd)
+	zoneUpdatePolicyCmd.AddCommand(zoneUpdatePolicyDeleteCmd)
+
+	zoneUpdatePolicySetCmd.Flags().StringArray("grant", nil, "Grant in key:names[:types] form (repeatable) (required)")
+	_ = zoneUpdatePolicySetCmd.MarkFlagRequired("grant")
+}
+
+type updateGrant struct {
+	TSIGKey string   `json:"tsig_key"`
+	Names   []string `json:"names"`
+	Types   []string `json:"types,omitempty"`
+}
+
+func zoneUpdatePolicyURL(cmd *cobra.Command, domain string) string {
+	return fmt.Sprintf("%s/api/v1/zones/%s/update-policy", getAPIURL(cmd), url.PathEscape(domain))
+}
+
+// parseUpdateGrant parses a grant in key:names[:types] form
+func parseUpdateGrant(spec string) (updateGrant, error) {
+	parts := strings.Split(spec, ":")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+		return updateGrant{}, fmt.Errorf("invalid grant %q: expected key:names[:types]", spec)
+	}
+
+	grant := updateGrant{TSIGKey: parts[0], Names: strings.Split(parts[1], ",")}
+	if len(parts) == 3 && parts[2] != "" {
+		grant.Types = strings.Split(parts[2], ",")
+	}
+	return grant, nil
+}
+
+func runZoneUpdatePolicyGet(cmd *cobra.Command, args []string) error {
+	domain := args[0]
+
+	resp, err := makeAPIRequest("GET", zoneUpdatePolicyURL(cmd, domain), nil)
+	if err != nil {
+		return fmt.Errorf("failed to connect to API: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode == http.StatusNotFound {
+		fmt.Printf("No update policy for zone '%s' (dynamic updates are disabled)\n", domain)
+		return nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("API request failed (%d): %s", resp.StatusCode, string(body))
+	}
+
+	var policy struct {
+		Grants []updateGrant `json:"grants"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&policy); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	fmt.Printf("Zone: %s\n\n", domain)
+	fmt.Printf("%-25s %-40s %s\n", "TSIG KEY", "NAMES", "TYPES")
+	fmt.Println(strings.Repeat("-", 80))
+	for _, grant := range policy.Grants {
+		types := "(all)"
+		if len(grant.Types) > 0 {
+			types = strings.Join(grant.Types, ", ")
+		}
+		fmt.Printf("%-25s %-40s %s\n", grant.TSIGKey, strings.Join(grant.Names, ", "), types)
+	}
+	return nil
+}
+
+func runZoneUpdatePolicySet(cmd *cobra.Command, args []string) error {
+	domain := args[0]
+	specs, _ := cmd.Flags().GetStringArray("grant")
+
+	grants := make([]updateGrant, 0, len(specs))
+	for _, spec := range specs {
+		grant, err := parseUpdateGrant(spec)
+		if err != nil {
+			return err
+		}
+		grants = append(grants, grant)
+	}
+
+	jsonData, err := json.Marshal(map[string]interface{}{"grants": grants})
+	if err != nil {
+		return fmt.Errorf("failed to encode update policy: %w", err)
+	}
+
+	resp, err := makeAPIRequest("PUT", zoneUpdatePolicyURL(cmd, domain), bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("failed to connect to API: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("API request failed (%d): %s", resp.StatusCode, string(body))
+	}
+
+	fmt.Printf("✓ Update policy for zone '%s' updated\n", domain)
+	return nil
+}
+
+func runZoneUpdatePolicyDelete(cmd *cobra.Command, args []string) error {
+	domain := args[0]
+
+	resp, err := makeAPIRequest("DELETE", zoneUpdatePolicyURL(cmd, domain), nil)
+	if err != nil {
+		return fmt.Errorf("failed to connect to API: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("API request failed (%d): %s", resp.StatusCode, string(body))
+	}
+
+	fmt.Printf("✓ Update policy for zone '%s' deleted, dynamic updates are disabled\n", domain)
+	return nil
+}
@@ -0,0 +1,130 @@
+package dnsserver
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/vitistack/common/pkg/loggers/vlog"
+)
+
+// certificateCheckInterval is how often the certificate files are checked for changes
+const certificateCheckInterval = 30 * time.Second
+
+// CertificateReloader serves a TLS certificate from files and reloads it when the files change,
+// so renewed certificates are picked up without a restart
+type CertificateReloader struct {
+	certFile string
+	keyFile  string
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	modTime time.Time
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewCertificateReloader loads a certificate and its private key from PEM files
+func NewCertificateReloader(certFile, keyFile string) (*CertificateReloader, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &CertificateReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+
+	if _, err := c.Reload(); err != nil {
+		cancel()
+		return nil, err
+	}
+	return c, nil
+}
+
+// GetCertificate returns the current certificate, for tls.Config.GetCertificate
+func (c *CertificateReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.cert, nil
+}
+
+// Reload loads the certificate again when one of the files changed since the last load
+// It reports whether a new certificate was loaded. On errors the current certificate is kept.
+func (c *CertificateReloader) Reload() (bool, error) {
+	modTime, err := c.latestModTime()
+	if err != nil {
+		return false, err
+	}
+
+	c.mu.RLock()
+	unchanged := c.cert != nil && !modTime.After(c.modTime)
+	c.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return false, fmt.Errorf("failed to load TLS certificate %s: %w", c.certFile, err)
+	}
+
+	c.mu.Lock()
+	c.cert = &cert
+	c.modTime = modTime
+	c.mu.Unlock()
+	return true, nil
+}
+
+// Start checks the certificate files for changes in the background
+func (c *CertificateReloader) Start() {
+	c.wg.Add(1)
+	go c.run()
+}
+
+// Stop stops checking the certificate files
+func (c *CertificateReloader) Stop() {
+	c.cancel()
+	c.wg.Wait()
+}
+
+func (c *CertificateReloader) run() {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(certificateCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+			reloaded, err := c.Reload()
+			if err != nil {
+				// The files may be half written, the next check tries again
+				vlog.Warnf("failed to reload TLS certificate: %v", err)
+			} else if reloaded {
+				vlog.Infof("Reloaded TLS certificate %s", c.certFile)
+			}
+		}
+	}
+}
+
+// latestModTime returns the modification time of the most recently changed file
+func (c *CertificateReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, file := range []string{c.certFile, c.keyFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("failed to read TLS certificate file: %w", err)
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
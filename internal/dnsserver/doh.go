@@ -0,0 +1,435 @@
+package dnsserver
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"github.com/miekg/dns"
+	"github.com/rogerwesterbo/godns/internal/dnsserver/handlers"
+	"github.com/rogerwesterbo/godns/internal/models"
+	"github.com/vitistack/common/pkg/loggers/vlog"
+)
+
+const (
+	// DoHPath is the path DNS over HTTPS queries are served on (RFC 8484 section 4.1)
+	DoHPath = "/dns-query"
+
+	dohMessageContentType = "application/dns-message"
+	dohJSONContentType    = "application/dns-json"
+
+	// dohMaxMessageSize is the largest DNS message, the limit of POST bodies
+	dohMaxMessageSize = dns.MaxMsgSize
+)
+
+// DoHHandler serves DNS over HTTPS (RFC 8484) with the DNS handler
+// Queries are sent as DNS messages with GET (base64url in the dns parameter) or POST
+// (application/dns-message), or as name and type parameters with GET for the JSON API
+// (application/dns-json). The client address comes from the connection, or from the
+// X-Forwarded-For header when the connection is from a trusted proxy, so rate limiting
+// and the allowed LANs apply to the actual client. Queries to /dns-query/{client-id}
+// carry a client identifier that selects the client group of the client.
+type DoHHandler struct {
+	dnsHandler     dns.Handler
+	tsigProvider   dns.TsigProvider
+	trustedProxies []netip.Prefix
+}
+
+// NewDoHHandler creates a DNS over HTTPS handler
+// tsigProvider verifies and signs messages with TSIG, like on the other transports.
+func NewDoHHandler(dnsHandler dns.Handler, tsigProvider dns.TsigProvider, trustedProxies []netip.Prefix) *DoHHandler {
+	return &DoHHandler{
+		dnsHandler:     dnsHandler,
+		tsigProvider:   tsigProvider,
+		trustedProxies: trustedProxies,
+	}
+}
+
+// ParseTrustedProxies parses a comma-separated list of addresses and prefixes
+func ParseTrustedProxies(s string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, field := range strings.Split(s, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		if addr, err := netip.ParseAddr(field); err == nil {
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(field)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", field, err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+func (h *DoHHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if _, err := dohClientID(req.URL.Path); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	var query []byte
+	switch req.Method {
+	case http.MethodGet:
+		if wantsJSON(req) {
+			h.serveJSON(w, req)
+			return
+		}
+		param := req.URL.Query().Get("dns")
+		if param == "" {
+			http.Error(w, "Missing dns parameter", http.StatusBadRequest)
+			return
+		}
+		// base64url without padding, though padded queries are accepted too
+		data, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(param, "="))
+		if err != nil {
+			http.Error(w, "Invalid dns parameter: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		query = data
+	case http.MethodPost:
+		if contentType := strings.TrimSpace(strings.Split(req.Header.Get("Content-Type"), ";")[0]); contentType != dohMessageContentType {
+			http.Error(w, "Content-Type must be "+dohMessageContentType, http.StatusUnsupportedMediaType)
+			return
+		}
+		data, err := io.ReadAll(io.LimitReader(req.Body, dohMaxMessageSize+1))
+		if err != nil {
+			http.Error(w, "Failed to read request body", http.StatusBadRequest)
+			return
+		}
+		if len(data) > dohMaxMessageSize {
+			http.Error(w, "DNS message too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		query = data
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	r := new(dns.Msg)
+	if err := r.Unpack(query); err != nil {
+		http.Error(w, "Invalid DNS message: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if r.Response || len(r.Question) != 1 {
+		http.Error(w, "Invalid DNS message: expected a query with one question", http.StatusBadRequest)
+		return
+	}
+
+	resp, data, err := h.exchange(req, r, query)
+	if err != nil {
+		vlog.Warnf("DNS over HTTPS query for %s failed: %v", r.Question[0].Name, err)
+		http.Error(w, "Failed to answer the query", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", dohMessageContentType)
+	w.Header().Set("Cache-Control", cacheControl(resp))
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	_, _ = w.Write(data)
+}
+
+// exchange answers a query with the DNS handler; raw is the query as received, for TSIG verification
+// It returns the response and its wire format.
+func (h *DoHHandler) exchange(req *http.Request, r *dns.Msg, raw []byte) (*dns.Msg, []byte, error) {
+	clientID, _ := dohClientID(req.URL.Path)
+	writer := &dohWriter{
+		messageTSIG: messageTSIG{provider: h.tsigProvider},
+		remote:      &net.TCPAddr{IP: h.clientIP(req).AsSlice()},
+		clientID:    clientID,
+	}
+	if local, ok := req.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+		writer.local = local
+	}
+
+	// A transfer takes several messages, an HTTP response carries one
+	if r.Question[0].Qtype == dns.TypeAXFR || r.Question[0].Qtype == dns.TypeIXFR {
+		m := new(dns.Msg)
+		m.SetRcode(r, dns.RcodeRefused)
+		if err := writer.WriteMsg(m); err != nil {
+			return nil, nil, err
+		}
+		return writer.msg, writer.data, nil
+	}
+
+	writer.verify(raw, r)
+	h.dnsHandler.ServeDNS(writer, r)
+	if writer.msg == nil {
+		// The handler dropped the query, e.g. for a response policy. An HTTP response
+		// carries a message either way, so the query is refused instead.
+		m := new(dns.Msg)
+		m.SetRcode(r, dns.RcodeRefused)
+		if err := writer.WriteMsg(m); err != nil {
+			return nil, nil, err
+		}
+	}
+	return writer.msg, writer.data, nil
+}
+
+// dohClientID returns the client identifier in the path of a query, "" for queries to DoHPath
+func dohClientID(path string) (string, error) {
+	id, ok := strings.CutPrefix(path, DoHPath+"/")
+	if !ok {
+		return "", nil
+	}
+	id = strings.ToLower(id)
+	if err := models.ValidateClientID(id); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// clientIP returns the address of the client that sent a request
+// X-Forwarded-For is read from the right, where trusted proxies appended the address they
+// received the request from; the first address that is not a trusted proxy is the client.
+func (h *DoHHandler) clientIP(req *http.Request) netip.Addr {
+	addrPort, err := netip.ParseAddrPort(req.RemoteAddr)
+	if err != nil {
+		return netip.Addr{}
+	}
+	ip := addrPort.Addr().Unmap()
+	if !h.trustedProxy(ip) {
+		return ip
+	}
+
+	forwarded := strings.Split(strings.Join(req.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(forwarded[i]))
+		if err != nil {
+			break
+		}
+		ip = addr.Unmap()
+		if !h.trustedProxy(ip) {
+			break
+		}
+	}
+	return ip
+}
+
+func (h *DoHHandler) trustedProxy(ip netip.Addr) bool {
+	for _, prefix := range h.trustedProxies {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// cacheControl returns the Cache-Control header of a response: the lowest TTL of its records,
+// or of the SOA record's negative caching TTL for negative answers (RFC 8484 section 5.1)
+func cacheControl(m *dns.Msg) string {
+	if m.Rcode != dns.RcodeSuccess && m.Rcode != dns.RcodeNameError {
+		return "no-store"
+	}
+
+	ttl := -1
+	lower := func(t uint32) {
+		if ttl < 0 || int(t) < ttl {
+			ttl = int(t)
+		}
+	}
+	for _, section := range [][]dns.RR{m.Answer, m.Ns, m.Extra} {
+		for _, rr := range section {
+			switch v := rr.(type) {
+			case *dns.OPT, *dns.TSIG:
+				continue
+			case *dns.SOA:
+				if len(m.Answer) == 0 {
+					lower(v.Minttl)
+				}
+			}
+			lower(rr.Header().Ttl)
+		}
+	}
+	if ttl < 0 {
+		return "no-store"
+	}
+	return fmt.Sprintf("max-age=%d", ttl)
+}
+
+// dohWriter collects the response of the DNS handler to a DNS over HTTPS query
+type dohWriter struct {
+	messageTSIG
+	local    net.Addr
+	remote   net.Addr
+	clientID string
+
+	msg  *dns.Msg
+	data []byte
+}
+
+func (w *dohWriter) LocalAddr() net.Addr  { return w.local }
+func (w *dohWriter) RemoteAddr() net.Addr { return w.remote }
+
+// Transport returns the transport of the query, see handlers.TransportWriter
+func (w *dohWriter) Transport() string { return handlers.TransportHTTPS }
+
+// ClientID returns the client identifier in the path of the query, see handlers.ClientIDWriter
+func (w *dohWriter) ClientID() string { return w.clientID }
+
+func (w *dohWriter) WriteMsg(m *dns.Msg) error {
+	if w.msg != nil {
+		return errors.New("DNS over HTTPS carries one response per query")
+	}
+
+	data, err := w.pack(m)
+	if err != nil {
+		return err
+	}
+
+	w.msg, w.data = m, data
+	return nil
+}
+
+func (w *dohWriter) Write(data []byte) (int, error) {
+	m := new(dns.Msg)
+	if err := m.Unpack(data); err != nil {
+		return 0, err
+	}
+	if w.msg != nil {
+		return 0, errors.New("DNS over HTTPS carries one response per query")
+	}
+	w.msg, w.data = m, data
+	return len(data), nil
+}
+
+func (w *dohWriter) Close() error                          { return nil }
+func (w *dohWriter) Hijack()                               {}
+func (w *dohWriter) ConnectionState() *tls.ConnectionState { return nil }
+
+// dohJSONResponse is a response of the JSON API, in the format of the public DNS over HTTPS resolvers
+type dohJSONResponse struct {
+	Status     int               `json:"Status"`
+	TC         bool              `json:"TC"`
+	RD         bool              `json:"RD"`
+	RA         bool              `json:"RA"`
+	AD         bool              `json:"AD"`
+	CD         bool              `json:"CD"`
+	Question   []dohJSONQuestion `json:"Question"`
+	Answer     []dohJSONRecord   `json:"Answer,omitempty"`
+	Authority  []dohJSONRecord   `json:"Authority,omitempty"`
+	Additional []dohJSONRecord   `json:"Additional,omitempty"`
+}
+
+type dohJSONQuestion struct {
+	Name string `json:"name"`
+	Type uint16 `json:"type"`
+}
+
+type dohJSONRecord struct {
+	Name string `json:"name"`
+	Type uint16 `json:"type"`
+	TTL  uint32 `json:"TTL"`
+	Data string `json:"data"`
+}
+
+// wantsJSON reports whether a GET request is for the JSON API
+func wantsJSON(req *http.Request) bool {
+	query := req.URL.Query()
+	if query.Get("ct") == dohJSONContentType || strings.Contains(req.Header.Get("Accept"), dohJSONContentType) {
+		return true
+	}
+	return query.Get("dns") == "" && query.Get("name") != ""
+}
+
+// serveJSON answers a query of the JSON API, with the name, type, do and cd parameters
+func (h *DoHHandler) serveJSON(w http.ResponseWriter, req *http.Request) {
+	params := req.URL.Query()
+	name := params.Get("name")
+	if name == "" {
+		http.Error(w, "Missing name parameter", http.StatusBadRequest)
+		return
+	}
+	if _, ok := dns.IsDomainName(name); !ok {
+		http.Error(w, "Invalid name parameter", http.StatusBadRequest)
+		return
+	}
+
+	qtype := dns.TypeA
+	if t := params.Get("type"); t != "" {
+		if n, err := strconv.ParseUint(t, 10, 16); err == nil {
+			qtype = uint16(n)
+		} else if n, ok := dns.StringToType[strings.ToUpper(t)]; ok {
+			qtype = n
+		} else {
+			http.Error(w, "Invalid type parameter", http.StatusBadRequest)
+			return
+		}
+	}
+
+	r := new(dns.Msg)
+	r.SetQuestion(dns.Fqdn(name), qtype)
+	r.CheckingDisabled = flagParam(params.Get("cd"))
+	r.SetEdns0(dns.DefaultMsgSize, flagParam(params.Get("do")))
+
+	raw, err := r.Pack()
+	if err != nil {
+		http.Error(w, "Invalid query: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	resp, _, err := h.exchange(req, r, raw)
+	if err != nil {
+		vlog.Warnf("DNS over HTTPS query for %s failed: %v", r.Question[0].Name, err)
+		http.Error(w, "Failed to answer the query", http.StatusInternalServerError)
+		return
+	}
+
+	out := dohJSONResponse{
+		Status:     resp.Rcode,
+		TC:         resp.Truncated,
+		RD:         resp.RecursionDesired,
+		RA:         resp.RecursionAvailable,
+		AD:         resp.AuthenticatedData,
+		CD:         resp.CheckingDisabled,
+		Answer:     jsonRecords(resp.Answer),
+		Authority:  jsonRecords(resp.Ns),
+		Additional: jsonRecords(resp.Extra),
+	}
+	for _, q := range resp.Question {
+		out.Question = append(out.Question, dohJSONQuestion{Name: q.Name, Type: q.Qtype})
+	}
+
+	w.Header().Set("Content-Type", dohJSONContentType)
+	w.Header().Set("Cache-Control", cacheControl(resp))
+	if err := json.NewEncoder(w).Encode(out); err != nil {
+		vlog.Errorf("failed to encode DNS over HTTPS response: %v", err)
+	}
+}
+
+// jsonRecords converts records to the JSON API format, leaving out OPT and TSIG records
+func jsonRecords(rrs []dns.RR) []dohJSONRecord {
+	var records []dohJSONRecord
+	for _, rr := range rrs {
+		switch rr.(type) {
+		case *dns.OPT, *dns.TSIG:
+			continue
+		}
+		hdr := rr.Header()
+		records = append(records, dohJSONRecord{
+			Name: hdr.Name,
+			Type: hdr.Rrtype,
+			TTL:  hdr.Ttl,
+			Data: strings.TrimPrefix(rr.String(), hdr.String()),
+		})
+	}
+	return records
+}
+
+// flagParam parses a boolean parameter of the JSON API, which may be 1, true or empty
+func flagParam(v string) bool {
+	return v == "1" || strings.EqualFold(v, "true")
+}
@@ -0,0 +1,340 @@
+package dnsserver
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/rogerwesterbo/godns/internal/dnsserver/handlers"
+)
+
+// dohTestHandler answers A queries with the client address and transport it sees, and
+// other queries with NXDOMAIN. Queries for drop.example.lan. get no answer.
+func dohTestHandler() dns.Handler {
+	return dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		if r.Question[0].Name == "drop.example.lan." {
+			return
+		}
+
+		m := new(dns.Msg)
+		m.SetReply(r)
+		if r.Question[0].Qtype != dns.TypeA {
+			m.SetRcode(r, dns.RcodeNameError)
+			m.Ns = append(m.Ns, &dns.SOA{
+				Hdr:    dns.RR_Header{Name: "example.lan.", Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: 3600},
+				Ns:     "ns1.example.lan.",
+				Mbox:   "admin.example.lan.",
+				Minttl: 120,
+			})
+			_ = w.WriteMsg(m)
+			return
+		}
+
+		transport := "unknown"
+		if tw, ok := w.(handlers.TransportWriter); ok {
+			transport = tw.Transport()
+		}
+		hdr := dns.RR_Header{Name: r.Question[0].Name, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 300}
+		m.Answer = append(m.Answer,
+			&dns.TXT{Hdr: hdr, Txt: []string{w.RemoteAddr().String()}},
+			&dns.TXT{Hdr: dns.RR_Header{Name: hdr.Name, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 60}, Txt: []string{transport}},
+		)
+		_ = w.WriteMsg(m)
+	})
+}
+
+func packQuery(t *testing.T, name string, qtype uint16) []byte {
+	t.Helper()
+	q := new(dns.Msg)
+	q.SetQuestion(name, qtype)
+	q.Id = 0 // RFC 8484 section 4.1: an ID of 0 makes GET requests cacheable
+	data, err := q.Pack()
+	if err != nil {
+		t.Fatalf("Pack() error = %v", err)
+	}
+	return data
+}
+
+func TestDoHHandler(t *testing.T) {
+	trusted, err := ParseTrustedProxies("10.0.0.1, 10.1.0.0/16")
+	if err != nil {
+		t.Fatalf("ParseTrustedProxies() error = %v", err)
+	}
+	h := NewDoHHandler(dohTestHandler(), nil, trusted)
+	query := packQuery(t, "www.example.lan.", dns.TypeA)
+
+	tests := []struct {
+		name         string
+		request      func() *http.Request
+		wantStatus   int
+		wantCache    string
+		wantClientIP string
+	}{
+		{
+			name: "GET",
+			request: func() *http.Request {
+				return httptest.NewRequest(http.MethodGet, DoHPath+"?dns="+base64.RawURLEncoding.EncodeToString(query), nil)
+			},
+			wantStatus:   http.StatusOK,
+			wantCache:    "max-age=60",
+			wantClientIP: "192.0.2.1",
+		},
+		{
+			name: "GET with padding",
+			request: func() *http.Request {
+				return httptest.NewRequest(http.MethodGet, DoHPath+"?dns="+base64.URLEncoding.EncodeToString(query), nil)
+			},
+			wantStatus:   http.StatusOK,
+			wantCache:    "max-age=60",
+			wantClientIP: "192.0.2.1",
+		},
+		{
+			name: "POST",
+			request: func() *http.Request {
+				req := httptest.NewRequest(http.MethodPost, DoHPath, bytes.NewReader(query))
+				req.Header.Set("Content-Type", dohMessageContentType)
+				return req
+			},
+			wantStatus:   http.StatusOK,
+			wantCache:    "max-age=60",
+			wantClientIP: "192.0.2.1",
+		},
+		{
+			name: "negative answer is cached for the SOA minimum",
+			request: func() *http.Request {
+				data := packQuery(t, "missing.example.lan.", dns.TypeAAAA)
+				return httptest.NewRequest(http.MethodGet, DoHPath+"?dns="+base64.RawURLEncoding.EncodeToString(data), nil)
+			},
+			wantStatus: http.StatusOK,
+			wantCache:  "max-age=120",
+		},
+		{
+			name: "client behind trusted proxies",
+			request: func() *http.Request {
+				req := httptest.NewRequest(http.MethodGet, DoHPath+"?dns="+base64.RawURLEncoding.EncodeToString(query), nil)
+				req.RemoteAddr = "10.0.0.1:40000"
+				req.Header.Set("X-Forwarded-For", "203.0.113.99, 198.51.100.7, 10.1.2.3")
+				return req
+			},
+			wantStatus:   http.StatusOK,
+			wantCache:    "max-age=60",
+			wantClientIP: "198.51.100.7",
+		},
+		{
+			name: "X-Forwarded-For from an untrusted peer is ignored",
+			request: func() *http.Request {
+				req := httptest.NewRequest(http.MethodGet, DoHPath+"?dns="+base64.RawURLEncoding.EncodeToString(query), nil)
+				req.Header.Set("X-Forwarded-For", "198.51.100.7")
+				return req
+			},
+			wantStatus:   http.StatusOK,
+			wantCache:    "max-age=60",
+			wantClientIP: "192.0.2.1",
+		},
+		{
+			name: "POST without the DNS message content type",
+			request: func() *http.Request {
+				req := httptest.NewRequest(http.MethodPost, DoHPath, bytes.NewReader(query))
+				req.Header.Set("Content-Type", "application/octet-stream")
+				return req
+			},
+			wantStatus: http.StatusUnsupportedMediaType,
+		},
+		{
+			name: "invalid base64",
+			request: func() *http.Request {
+				return httptest.NewRequest(http.MethodGet, DoHPath+"?dns=!!!", nil)
+			},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "missing dns parameter",
+			request: func() *http.Request {
+				return httptest.NewRequest(http.MethodGet, DoHPath, nil)
+			},
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name: "unsupported method",
+			request: func() *http.Request {
+				return httptest.NewRequest(http.MethodPut, DoHPath, bytes.NewReader(query))
+			},
+			wantStatus: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, tt.request())
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			if got := rec.Header().Get("Content-Type"); got != dohMessageContentType {
+				t.Errorf("Content-Type = %s, want %s", got, dohMessageContentType)
+			}
+			if got := rec.Header().Get("Cache-Control"); got != tt.wantCache {
+				t.Errorf("Cache-Control = %s, want %s", got, tt.wantCache)
+			}
+
+			resp := new(dns.Msg)
+			if err := resp.Unpack(rec.Body.Bytes()); err != nil {
+				t.Fatalf("Unpack() error = %v", err)
+			}
+			if tt.wantClientIP == "" {
+				return
+			}
+			if len(resp.Answer) != 2 {
+				t.Fatalf("answer = %v, want the client address and transport", resp.Answer)
+			}
+			if got := resp.Answer[0].(*dns.TXT).Txt[0]; !strings.HasPrefix(got, tt.wantClientIP+":") {
+				t.Errorf("client address = %s, want %s", got, tt.wantClientIP)
+			}
+			if got := resp.Answer[1].(*dns.TXT).Txt[0]; got != handlers.TransportHTTPS {
+				t.Errorf("transport = %s, want %s", got, handlers.TransportHTTPS)
+			}
+		})
+	}
+}
+
+func TestDoHHandlerDroppedQuery(t *testing.T) {
+	h := NewDoHHandler(dohTestHandler(), nil, nil)
+
+	t.Run("DNS message", func(t *testing.T) {
+		query := packQuery(t, "drop.example.lan.", dns.TypeA)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, DoHPath+"?dns="+base64.RawURLEncoding.EncodeToString(query), nil))
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+		}
+		resp := new(dns.Msg)
+		if err := resp.Unpack(rec.Body.Bytes()); err != nil {
+			t.Fatalf("Unpack() error = %v", err)
+		}
+		if resp.Rcode != dns.RcodeRefused {
+			t.Errorf("rcode = %s, want REFUSED", dns.RcodeToString[resp.Rcode])
+		}
+		if got := rec.Header().Get("Cache-Control"); got != "no-store" {
+			t.Errorf("Cache-Control = %s, want no-store", got)
+		}
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, DoHPath+"?name=drop.example.lan", nil))
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+		}
+		var resp dohJSONResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Unmarshal() error = %v", err)
+		}
+		if resp.Status != dns.RcodeRefused {
+			t.Errorf("Status = %d, want %d", resp.Status, dns.RcodeRefused)
+		}
+	})
+}
+
+func TestDoHHandlerJSON(t *testing.T) {
+	h := NewDoHHandler(dohTestHandler(), nil, nil)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, DoHPath+"?name=www.example.lan&type=A", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", rec.Code, rec.Body.String())
+	}
+	if got := rec.Header().Get("Content-Type"); got != dohJSONContentType {
+		t.Errorf("Content-Type = %s, want %s", got, dohJSONContentType)
+	}
+
+	var resp dohJSONResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if resp.Status != dns.RcodeSuccess || len(resp.Question) != 1 || resp.Question[0].Name != "www.example.lan." {
+		t.Errorf("response = %+v, want a NOERROR answer for www.example.lan.", resp)
+	}
+	if len(resp.Answer) != 2 || resp.Answer[1].Data != `"https"` || resp.Answer[1].TTL != 60 {
+		t.Errorf("answer = %+v, want the TXT records of the test handler", resp.Answer)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, DoHPath+"?name=www.example.lan&type=BOGUS", nil))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("status for an unknown type = %d, want 400", rec.Code)
+	}
+}
+
+func TestDoHHandlerClientID(t *testing.T) {
+	var clientID string
+	h := NewDoHHandler(dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		clientID = w.(handlers.ClientIDWriter).ClientID()
+		m := new(dns.Msg)
+		m.SetReply(r)
+		_ = w.WriteMsg(m)
+	}), nil, nil)
+	param := "?dns=" + base64.RawURLEncoding.EncodeToString(packQuery(t, "www.example.lan.", dns.TypeA))
+
+	tests := []struct {
+		path         string
+		wantStatus   int
+		wantClientID string
+	}{
+		{DoHPath, http.StatusOK, ""},
+		{DoHPath + "/Kiosk-1", http.StatusOK, "kiosk-1"},
+		{DoHPath + "/kiosk/1", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			clientID = ""
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path+param, nil))
+			if rec.Code != tt.wantStatus || clientID != tt.wantClientID {
+				t.Errorf("status %d, client id %q, want %d, %q", rec.Code, clientID, tt.wantStatus, tt.wantClientID)
+			}
+		})
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    []netip.Prefix
+		wantErr bool
+	}{
+		{input: "", want: nil},
+		{input: "10.0.0.1", want: []netip.Prefix{netip.MustParsePrefix("10.0.0.1/32")}},
+		{input: "10.0.0.0/8, 2001:db8::/32", want: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("2001:db8::/32")}},
+		{input: "10.1.2.3/16", want: []netip.Prefix{netip.MustParsePrefix("10.1.0.0/16")}},
+		{input: "proxy.example.lan", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseTrustedProxies(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseTrustedProxies() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("ParseTrustedProxies() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("ParseTrustedProxies()[%d] = %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,256 @@
+package dnsserver
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/quic-go/quic-go"
+	"github.com/rogerwesterbo/godns/internal/dnsserver/handlers"
+	"github.com/vitistack/common/pkg/loggers/vlog"
+)
+
+// DNS over QUIC error codes (RFC 9250 section 4.3), for connections and streams
+const (
+	doqNoError          = 0x0
+	doqInternalError    = 0x1
+	doqProtocolError    = 0x2
+	doqRequestCancelled = 0x3
+)
+
+// doqReadTimeout is how long a stream may take to send its query
+const doqReadTimeout = 5 * time.Second
+
+// quicServer serves DNS over QUIC (RFC 9250): each bidirectional stream carries one query
+// and its response, both with a two-byte length prefix like on TCP
+// Clients resuming a session may send queries in 0-RTT data, which an attacker can replay.
+// Queries without side effects are answered right away; anything else, like UPDATE, NOTIFY
+// or zone transfers, waits until the handshake completed and proved the client is live.
+type quicServer struct {
+	addr         string
+	handler      dns.Handler
+	tsigProvider dns.TsigProvider
+	tlsConfig    *tls.Config
+	idleTimeout  time.Duration
+
+	mu       sync.Mutex
+	listener *quic.EarlyListener
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func newQUICServer(addr string, handler dns.Handler, tsigProvider dns.TsigProvider, tlsConfig *tls.Config, idleTimeout time.Duration) *quicServer {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &quicServer{
+		addr:         addr,
+		handler:      handler,
+		tsigProvider: tsigProvider,
+		tlsConfig:    tlsConfig,
+		idleTimeout:  idleTimeout,
+		ctx:          ctx,
+		cancel:       cancel,
+	}
+}
+
+// ListenAndServe listens on the UDP address and serves connections until Shutdown
+func (s *quicServer) ListenAndServe() error {
+	listener, err := quic.ListenAddrEarly(s.addr, s.tlsConfig, &quic.Config{
+		MaxIdleTimeout: s.idleTimeout,
+		Allow0RTT:      true,
+	})
+	if err != nil {
+		return err
+	}
+	return s.serve(listener)
+}
+
+func (s *quicServer) serve(listener *quic.EarlyListener) error {
+	s.mu.Lock()
+	s.listener = listener
+	s.mu.Unlock()
+
+	for {
+		conn, err := listener.Accept(s.ctx)
+		if err != nil {
+			if s.ctx.Err() != nil || errors.Is(err, quic.ErrServerClosed) {
+				return nil
+			}
+			return err
+		}
+		s.wg.Add(1)
+		go s.serveConn(conn)
+	}
+}
+
+// Shutdown closes the listener and its connections
+func (s *quicServer) Shutdown() error {
+	s.cancel()
+	s.mu.Lock()
+	listener := s.listener
+	s.mu.Unlock()
+
+	var err error
+	if listener != nil {
+		err = listener.Close()
+	}
+	s.wg.Wait()
+	return err
+}
+
+func (s *quicServer) serveConn(conn *quic.Conn) {
+	defer s.wg.Done()
+
+	var streams sync.WaitGroup
+	defer streams.Wait()
+
+	for {
+		stream, err := conn.AcceptStream(s.ctx)
+		if err != nil {
+			if s.ctx.Err() != nil {
+				_ = conn.CloseWithError(doqNoError, "")
+			}
+			return
+		}
+		streams.Add(1)
+		go func() {
+			defer streams.Done()
+			s.serveStream(conn, stream)
+		}()
+	}
+}
+
+func (s *quicServer) serveStream(conn *quic.Conn, stream *quic.Stream) {
+	_ = stream.SetReadDeadline(time.Now().Add(doqReadTimeout))
+	raw, err := readStreamMsg(stream)
+	if err != nil {
+		stream.CancelRead(doqRequestCancelled)
+		stream.CancelWrite(doqRequestCancelled)
+		return
+	}
+
+	r := new(dns.Msg)
+	if err := r.Unpack(raw); err != nil || r.Response || r.Id != 0 || len(r.Question) != 1 || hasKeepaliveOption(r) {
+		// The message ID must be 0 and the keepalive option is meaningless on QUIC (RFC 9250 section 4.2.1, 5.5.2)
+		_ = conn.CloseWithError(doqProtocolError, "invalid query")
+		return
+	}
+
+	select {
+	case <-conn.HandshakeComplete():
+	default:
+		// 0-RTT data
+		if !replaySafe(r) {
+			select {
+			case <-conn.HandshakeComplete():
+			case <-conn.Context().Done():
+				return
+			}
+		}
+	}
+
+	w := &doqWriter{
+		messageTSIG: messageTSIG{provider: s.tsigProvider},
+		stream:      stream,
+		local:       conn.LocalAddr(),
+		remote:      streamAddr(conn.RemoteAddr()),
+	}
+	w.verify(raw, r)
+
+	s.handler.ServeDNS(w, r)
+	if w.written == 0 {
+		vlog.Warnf("DNS over QUIC query for %s from %s got no response", r.Question[0].Name, conn.RemoteAddr())
+		stream.CancelWrite(doqInternalError)
+		return
+	}
+	// The end of the stream tells the client the response is complete
+	_ = stream.Close()
+}
+
+// replaySafe reports whether a query may be answered from 0-RTT data: a replayed copy
+// must not change anything, so only plain queries other than zone transfers qualify
+func replaySafe(r *dns.Msg) bool {
+	if r.Opcode != dns.OpcodeQuery {
+		return false
+	}
+	qtype := r.Question[0].Qtype
+	return qtype != dns.TypeAXFR && qtype != dns.TypeIXFR
+}
+
+func hasKeepaliveOption(r *dns.Msg) bool {
+	opt := r.IsEdns0()
+	return opt != nil && hasKeepalive(opt)
+}
+
+// streamAddr returns the client address of a QUIC connection as a stream address
+// The DNS handler tells datagram transports by *net.UDPAddr and truncates their responses,
+// but QUIC streams are reliable and carry messages of any size, like TCP.
+func streamAddr(addr net.Addr) net.Addr {
+	if udp, ok := addr.(*net.UDPAddr); ok {
+		return &net.TCPAddr{IP: udp.IP, Port: udp.Port, Zone: udp.Zone}
+	}
+	return addr
+}
+
+// readStreamMsg reads a message with a two-byte length prefix
+func readStreamMsg(r io.Reader) ([]byte, error) {
+	var length [2]byte
+	if _, err := io.ReadFull(r, length[:]); err != nil {
+		return nil, err
+	}
+	msg := make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// doqWriter writes the responses to a query on its QUIC stream
+// Zone transfers write several messages to the same stream.
+type doqWriter struct {
+	messageTSIG
+	stream  *quic.Stream
+	local   net.Addr
+	remote  net.Addr
+	written int
+}
+
+func (w *doqWriter) LocalAddr() net.Addr  { return w.local }
+func (w *doqWriter) RemoteAddr() net.Addr { return w.remote }
+
+// Transport returns the transport of the query, see handlers.TransportWriter
+func (w *doqWriter) Transport() string { return handlers.TransportQUIC }
+
+func (w *doqWriter) WriteMsg(m *dns.Msg) error {
+	data, err := w.pack(m)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+func (w *doqWriter) Write(data []byte) (int, error) {
+	if len(data) > dns.MaxMsgSize {
+		return 0, fmt.Errorf("DNS message of %d bytes is too large", len(data))
+	}
+	buf := make([]byte, 2+len(data))
+	binary.BigEndian.PutUint16(buf, uint16(len(data))) // #nosec G115 -- checked against MaxMsgSize above
+	copy(buf[2:], data)
+	if _, err := w.stream.Write(buf); err != nil {
+		return 0, err
+	}
+	w.written++
+	return len(data), nil
+}
+
+func (w *doqWriter) Close() error { return w.stream.Close() }
+func (w *doqWriter) Hijack()      {}
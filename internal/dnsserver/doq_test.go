@@ -0,0 +1,145 @@
+package dnsserver
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/quic-go/quic-go"
+	"github.com/rogerwesterbo/godns/internal/dnsserver/handlers"
+)
+
+// doqExchange sends a query on a new stream and reads the response
+func doqExchange(ctx context.Context, conn *quic.Conn, q *dns.Msg) (*dns.Msg, error) {
+	stream, err := conn.OpenStreamSync(ctx)
+	if err != nil {
+		return nil, err
+	}
+	data, err := q.Pack()
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 2+len(data))
+	binary.BigEndian.PutUint16(buf, uint16(len(data))) // #nosec G115 -- test queries are small
+	copy(buf[2:], data)
+	if _, err := stream.Write(buf); err != nil {
+		return nil, err
+	}
+	_ = stream.Close()
+
+	raw, err := readStreamMsg(stream)
+	if err != nil {
+		return nil, err
+	}
+	// The server ends the stream after the response
+	if _, err := stream.Read(make([]byte, 1)); !errors.Is(err, io.EOF) {
+		return nil, errors.New("stream not closed after the response")
+	}
+	resp := new(dns.Msg)
+	return resp, resp.Unpack(raw)
+}
+
+func TestDNSOverQUIC(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	writeCertificate(t, certFile, keyFile, "dns.example.lan")
+	certificates, err := NewCertificateReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("NewCertificateReloader() error = %v", err)
+	}
+
+	// Answers with the client address and transport it sees
+	handler := dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		transport := "unknown"
+		if tw, ok := w.(handlers.TransportWriter); ok {
+			transport = tw.Transport()
+		}
+		_, isTCP := w.RemoteAddr().(*net.TCPAddr)
+		hdr := dns.RR_Header{Name: r.Question[0].Name, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 60}
+		m.Answer = append(m.Answer, &dns.TXT{Hdr: hdr, Txt: []string{transport}})
+		if !isTCP {
+			m.Answer = append(m.Answer, &dns.TXT{Hdr: hdr, Txt: []string{"datagram address"}})
+		}
+		_ = w.WriteMsg(m)
+	})
+
+	tlsConfig := &tls.Config{GetCertificate: certificates.GetCertificate, MinVersion: tls.VersionTLS13, NextProtos: []string{"doq"}}
+	server := newQUICServer("127.0.0.1:0", handler, nil, tlsConfig, 10*time.Second)
+	listener, err := quic.ListenAddrEarly(server.addr, tlsConfig, &quic.Config{Allow0RTT: true})
+	if err != nil {
+		t.Fatalf("ListenAddrEarly() error = %v", err)
+	}
+	go func() { _ = server.serve(listener) }()
+	defer func() { _ = server.Shutdown() }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	clientConfig := &tls.Config{InsecureSkipVerify: true, NextProtos: []string{"doq"}} // #nosec G402 -- self-signed test certificate
+	conn, err := quic.DialAddr(ctx, listener.Addr().String(), clientConfig, nil)
+	if err != nil {
+		t.Fatalf("DialAddr() error = %v", err)
+	}
+	defer func() { _ = conn.CloseWithError(doqNoError, "") }()
+
+	// One query per stream, several on the same connection
+	for _, name := range []string{"a.example.lan.", "b.example.lan."} {
+		q := new(dns.Msg)
+		q.SetQuestion(name, dns.TypeTXT)
+		q.Id = 0
+		resp, err := doqExchange(ctx, conn, q)
+		if err != nil {
+			t.Fatalf("exchange for %s error = %v", name, err)
+		}
+		if resp.Id != 0 || resp.Question[0].Name != name {
+			t.Errorf("response = %v, want ID 0 and question %s", resp, name)
+		}
+		if len(resp.Answer) != 1 || resp.Answer[0].(*dns.TXT).Txt[0] != handlers.TransportQUIC {
+			t.Errorf("answer = %v, want transport %s with a stream address", resp.Answer, handlers.TransportQUIC)
+		}
+	}
+
+	// A query with a message ID other than 0 is a protocol error that closes the connection
+	q := new(dns.Msg)
+	q.SetQuestion("c.example.lan.", dns.TypeTXT)
+	q.Id = 1234
+	_, err = doqExchange(ctx, conn, q)
+	var appErr *quic.ApplicationError
+	if !errors.As(err, &appErr) || appErr.ErrorCode != doqProtocolError {
+		t.Errorf("exchange with message ID 1234 error = %v, want DOQ_PROTOCOL_ERROR", err)
+	}
+}
+
+func TestReplaySafe(t *testing.T) {
+	tests := []struct {
+		name   string
+		opcode int
+		qtype  uint16
+		want   bool
+	}{
+		{name: "query", opcode: dns.OpcodeQuery, qtype: dns.TypeA, want: true},
+		{name: "AXFR", opcode: dns.OpcodeQuery, qtype: dns.TypeAXFR, want: false},
+		{name: "IXFR", opcode: dns.OpcodeQuery, qtype: dns.TypeIXFR, want: false},
+		{name: "UPDATE", opcode: dns.OpcodeUpdate, qtype: dns.TypeSOA, want: false},
+		{name: "NOTIFY", opcode: dns.OpcodeNotify, qtype: dns.TypeSOA, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := new(dns.Msg)
+			r.SetQuestion("example.lan.", tt.qtype)
+			r.Opcode = tt.opcode
+			if got := replaySafe(r); got != tt.want {
+				t.Errorf("replaySafe() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -4,24 +4,38 @@ import (
 	"context"
 	"net"
 	"net/netip"
+	"strings"
 	"time"
 
 	"github.com/miekg/dns"
 	"github.com/spf13/viper"
 
+	"github.com/rogerwesterbo/godns/internal/models"
 	"github.com/rogerwesterbo/godns/internal/services/v1allowedlans"
 	"github.com/rogerwesterbo/godns/internal/services/v1cacheservice"
+	"github.com/rogerwesterbo/godns/internal/services/v1dnssecservice"
 	"github.com/rogerwesterbo/godns/internal/services/v1dnsservice"
+	"github.com/rogerwesterbo/godns/internal/services/v1dynamicupdateservice"
+	"github.com/rogerwesterbo/godns/internal/services/v1filterservice"
 	"github.com/rogerwesterbo/godns/internal/services/v1healthcheckservice"
 	"github.com/rogerwesterbo/godns/internal/services/v1loadbalancerservice"
 	"github.com/rogerwesterbo/godns/internal/services/v1metricsservice"
+	"github.com/rogerwesterbo/godns/internal/services/v1policyservice"
 	"github.com/rogerwesterbo/godns/internal/services/v1querylogservice"
 	"github.com/rogerwesterbo/godns/internal/services/v1ratelimitservice"
+	"github.com/rogerwesterbo/godns/internal/services/v1secondaryservice"
+	"github.com/rogerwesterbo/godns/internal/services/v1tsigservice"
 	"github.com/rogerwesterbo/godns/internal/services/v1upstream"
+	"github.com/rogerwesterbo/godns/internal/services/v1validationservice"
+	"github.com/rogerwesterbo/godns/internal/services/v1viewservice"
+	"github.com/rogerwesterbo/godns/internal/services/v1zonetransferservice"
 	"github.com/rogerwesterbo/godns/pkg/consts"
 	"github.com/vitistack/common/pkg/loggers/vlog"
 )
 
+// maxCNAMEChain is the maximum number of CNAME hops followed for a single query
+const maxCNAMEChain = 8
+
 type DNSHandler struct {
 	dnsService         *v1dnsservice.DNSService
 	allowedLANsService *v1allowedlans.AllowedLANsService
@@ -32,30 +46,61 @@ type DNSHandler struct {
 	healthCheck        *v1healthcheckservice.HealthCheckService
 	queryLog           *v1querylogservice.QueryLogService
 	metrics            *v1metricsservice.MetricsService
+	transferService    *v1zonetransferservice.V1ZoneTransferService
+	secondaryService   *v1secondaryservice.SecondaryService
+	updateService      *v1dynamicupdateservice.V1DynamicUpdateService
+	tsigService        *v1tsigservice.V1TSIGService
+	dnssecService      *v1dnssecservice.V1DNSSECService
+	validationService  *v1validationservice.V1ValidationService
+	viewService        *v1viewservice.V1ViewService
+	policyService      *v1policyservice.V1PolicyService
+	filterService      *v1filterservice.V1FilterService
+}
+
+// DNSHandlerOptions holds the services of a DNS handler
+// DNSService is required; a nil optional service disables its feature.
+type DNSHandlerOptions struct {
+	DNSService         *v1dnsservice.DNSService
+	AllowedLANsService *v1allowedlans.AllowedLANsService
+	UpstreamService    *v1upstream.UpstreamService
+	CacheService       *v1cacheservice.DNSCache
+	RateLimiter        *v1ratelimitservice.RateLimiter
+	LoadBalancer       *v1loadbalancerservice.LoadBalancer
+	HealthCheck        *v1healthcheckservice.HealthCheckService
+	QueryLog           *v1querylogservice.QueryLogService
+	Metrics            *v1metricsservice.MetricsService
+	TransferService    *v1zonetransferservice.V1ZoneTransferService
+	SecondaryService   *v1secondaryservice.SecondaryService
+	UpdateService      *v1dynamicupdateservice.V1DynamicUpdateService
+	TSIGService        *v1tsigservice.V1TSIGService
+	DNSSECService      *v1dnssecservice.V1DNSSECService
+	ValidationService  *v1validationservice.V1ValidationService
+	ViewService        *v1viewservice.V1ViewService
+	PolicyService      *v1policyservice.V1PolicyService
+	FilterService      *v1filterservice.V1FilterService
 }
 
-// NewDNSHandler creates a new DNS handler with all optional services
-func NewDNSHandler(
-	dnsService *v1dnsservice.DNSService,
-	allowedLANsService *v1allowedlans.AllowedLANsService,
-	upstreamService *v1upstream.UpstreamService,
-	cacheService *v1cacheservice.DNSCache,
-	rateLimiter *v1ratelimitservice.RateLimiter,
-	loadBalancer *v1loadbalancerservice.LoadBalancer,
-	healthCheck *v1healthcheckservice.HealthCheckService,
-	queryLog *v1querylogservice.QueryLogService,
-	metrics *v1metricsservice.MetricsService,
-) *DNSHandler {
+// NewDNSHandler creates a new DNS handler with the services in opts
+func NewDNSHandler(opts DNSHandlerOptions) *DNSHandler {
 	return &DNSHandler{
-		dnsService:         dnsService,
-		allowedLANsService: allowedLANsService,
-		upstreamService:    upstreamService,
-		cacheService:       cacheService,
-		rateLimiter:        rateLimiter,
-		loadBalancer:       loadBalancer,
-		healthCheck:        healthCheck,
-		queryLog:           queryLog,
-		metrics:            metrics,
+		dnsService:         opts.DNSService,
+		allowedLANsService: opts.AllowedLANsService,
+		upstreamService:    opts.UpstreamService,
+		cacheService:       opts.CacheService,
+		rateLimiter:        opts.RateLimiter,
+		loadBalancer:       opts.LoadBalancer,
+		healthCheck:        opts.HealthCheck,
+		queryLog:           opts.QueryLog,
+		metrics:            opts.Metrics,
+		transferService:    opts.TransferService,
+		secondaryService:   opts.SecondaryService,
+		updateService:      opts.UpdateService,
+		tsigService:        opts.TSIGService,
+		dnssecService:      opts.DNSSECService,
+		validationService:  opts.ValidationService,
+		viewService:        opts.ViewService,
+		policyService:      opts.PolicyService,
+		filterService:      opts.FilterService,
 	}
 }
 
@@ -65,7 +110,6 @@ func (h *DNSHandler) HandleDNS(w dns.ResponseWriter, r *dns.Msg) {
 
 	m := new(dns.Msg)
 	m.SetReply(r)
-	m.Authoritative = true
 
 	// Extract peer IP
 	peerAddr := w.RemoteAddr()
@@ -76,13 +120,32 @@ func (h *DNSHandler) HandleDNS(w dns.ResponseWriter, r *dns.Msg) {
 		srcIP, _ = netip.AddrFromSlice(tcp.IP)
 	}
 
+	transport := transportOf(w)
+
 	// Use context with timeout for all operations
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	// Track if query was blocked/rate-limited
+	// Clients in a split-horizon view are answered with the view's records
+	view := ""
+	if h.viewService != nil {
+		view = h.viewService.Select(srcIP)
+		ctx = v1dnsservice.WithView(ctx, view)
+	}
+
+	// Clients in a client group are filtered with the group's profile
+	var filter *v1filterservice.Filter
+	if h.filterService != nil {
+		filter = h.filterService.Select(srcIP, clientIDOf(w), startTime)
+	}
+
+	// Responses carry our OPT record and fit the client's UDP payload size
+	w = newEDNSWriter(w, r)
+
+	// Track if query was blocked/rate-limited, and the response policy rule it matched
 	wasBlocked := false
 	wasUpstream := false
+	var policyHit *models.PolicyHit
 
 	// Track cache hit status
 	cacheHit := false
@@ -99,14 +162,18 @@ func (h *DNSHandler) HandleDNS(w dns.ResponseWriter, r *dns.Msg) {
 
 		// Log the query if query logging is enabled
 		if h.queryLog != nil {
-			h.queryLog.LogQuery(ctx, srcIP, question, m, latency, cacheHit, wasUpstream, wasBlocked)
+			var clientGroup, profile string
+			if filter != nil {
+				clientGroup, profile = filter.Group, filter.Profile
+			}
+			h.queryLog.LogQuery(ctx, srcIP, question, m, latency, cacheHit, wasUpstream, wasBlocked, policyHit, clientGroup, profile, transport)
 		}
 
 		// Record metrics if metrics service is enabled
 		if h.metrics != nil {
 			qtypeStr := dns.TypeToString[question.Qtype]
 			rcodeStr := dns.RcodeToString[m.Rcode]
-			h.metrics.RecordQuery(qtypeStr, rcodeStr, latency.Seconds())
+			h.metrics.RecordQuery(qtypeStr, rcodeStr, transport, latency.Seconds())
 
 			if cacheHit {
 				h.metrics.RecordCacheHit()
@@ -132,6 +199,43 @@ func (h *DNSHandler) HandleDNS(w dns.ResponseWriter, r *dns.Msg) {
 		}
 	}
 
+	// Queries with several OPT records or an EDNS version we don't support
+	if rcode := ednsRcode(r); rcode != dns.RcodeSuccess {
+		m.Rcode = rcode
+		if err := w.WriteMsg(m); err != nil {
+			vlog.Warnf("failed to write EDNS error response: %v", err)
+		}
+		return
+	}
+
+	// NOTIFY from the primary of a secondary zone
+	if r.Opcode == dns.OpcodeNotify {
+		m.Rcode = h.handleNotify(ctx, w, r, m, srcIP)
+		return
+	}
+
+	// Dynamic updates (RFC 2136)
+	if r.Opcode == dns.OpcodeUpdate {
+		m.Rcode = h.handleUpdate(ctx, w, r, srcIP)
+		return
+	}
+
+	// Zone transfers are streamed over several messages and bypass the cache
+	if isTransfer(r) {
+		m.Rcode = h.handleTransfer(ctx, w, r, srcIP)
+		return
+	}
+
+	// Clients set the DO bit to receive DNSSEC records (RFC 3225)
+	dnssecOK := false
+	if opt := r.IsEdns0(); opt != nil {
+		dnssecOK = opt.Do()
+	}
+
+	// Queries with the CD bit want the upstream data unvalidated, so they bypass the
+	// validated answers in the cache
+	useCache := h.cacheService != nil && !(h.validationService != nil && r.CheckingDisabled)
+
 	// Answer each question
 	for _, q := range r.Question {
 		name := dns.Fqdn(q.Name)
@@ -139,16 +243,36 @@ func (h *DNSHandler) HandleDNS(w dns.ResponseWriter, r *dns.Msg) {
 
 		vlog.Debugf("DNS query from %v: %s (type %d)", srcIP, name, qtype)
 
+		// Response policies matching the query name are applied before the cache
+		if hit := h.checkQueryPolicy(name, filter, policyHit); hit != nil {
+			policyHit = &hit.PolicyHit
+			if policyHit.Blocks() {
+				wasBlocked = true
+				m = h.respondPolicy(ctx, w, r, hit, srcIP)
+				return
+			}
+		}
+
 		// 2. Cache Lookup
-		if h.cacheService != nil {
-			cacheKey := name + ":" + dns.TypeToString[qtype]
-			cachedMsg, found := h.cacheService.Get(ctx, cacheKey)
+		if useCache {
+			cachedMsg, validation, found := h.cacheService.GetValidated(ctx, cacheKey(name, qtype, dnssecOK, view))
 			if found && cachedMsg != nil {
 				vlog.Debugf("Cache hit for %s (type %d)", name, qtype)
 				cacheHit = true
-				// Set reply from cache
+				// Set reply from cache, keeping the cached rcode (SetReply resets it)
 				m = cachedMsg
+				rcode := m.Rcode
 				m.SetReply(r)
+				m.Rcode = rcode
+				m = v1validationservice.Respond(r, m, validation)
+				if hit := h.checkResponsePolicy(m, filter, policyHit); hit != nil {
+					policyHit = &hit.PolicyHit
+					if policyHit.Blocks() {
+						wasBlocked = true
+						m = h.respondPolicy(ctx, w, r, hit, srcIP)
+						return
+					}
+				}
 				if err := w.WriteMsg(m); err != nil {
 					vlog.Warnf("failed to write cached response: %v", err)
 				}
@@ -156,85 +280,62 @@ func (h *DNSHandler) HandleDNS(w dns.ResponseWriter, r *dns.Msg) {
 			}
 		}
 
-		// 3. Check if we have this zone in our dynamic storage
-		_, hasZone := h.dnsService.HasZone(ctx, name)
-		vlog.Debugf("HasZone check for %s: %v", name, hasZone)
+		// 3. Check if we have this zone in our dynamic storage, its data is loaded once for the answer
+		zone, hasZone, err := h.dnsService.ServingZone(ctx, name)
+		vlog.Debugf("Zone check for %s: %v", name, hasZone)
 
 		if hasZone {
-			// We have this zone - lookup record from Valkey
-			records, err := h.dnsService.LookupRecord(ctx, name, qtype)
+			cacheable, upstream := false, false
 			if err != nil {
-				vlog.Warnf("failed to lookup record %s: %v", name, err)
-			} else if len(records) > 0 {
-				vlog.Debugf("Found %d records for %s", len(records), name)
-
-				// 4. Load Balancing - if multiple records and load balancer enabled
-				if h.loadBalancer != nil && len(records) > 1 {
-					// Use load balancer to select best record
-					recordTypeStr := dns.TypeToString[qtype]
-					selectedRecord, found := h.loadBalancer.GetBackend(ctx, name, recordTypeStr)
-					if found {
-						selectedValue := selectedRecord.GetRData()
-						vlog.Debugf("Load balancer selected backend: %s", selectedValue)
-						// Find the matching DNS record and return it
-						for _, rec := range records {
-							if aRec, ok := rec.(*dns.A); ok && aRec.A.String() == selectedValue {
-								m.Answer = append(m.Answer, rec)
-								break
-							} else if aaaaRec, ok := rec.(*dns.AAAA); ok && aaaaRec.AAAA.String() == selectedValue {
-								m.Answer = append(m.Answer, rec)
-								break
-							}
-						}
-					} else {
-						// No healthy backend via load balancer, return all records
-						m.Answer = append(m.Answer, records...)
-					}
-				} else {
-					// No load balancing needed, return all records
-					m.Answer = append(m.Answer, records...)
-				}
-
-				// 5. Cache the successful response
-				if h.cacheService != nil {
-					cacheKey := name + ":" + dns.TypeToString[qtype]
-					h.cacheService.Set(ctx, cacheKey, m)
-				}
+				vlog.Warnf("failed to answer %s from its zone: %v", name, err)
+				m.Rcode = dns.RcodeServerFailure
 			} else {
-				vlog.Debugf("Zone exists but no records found for %s (type %d)", name, qtype)
+				cacheable, upstream = h.answerFromZone(ctx, m, zone, name, qtype, srcIP)
+			}
+			wasUpstream = wasUpstream || upstream
+
+			// 8. Sign the answer for clients asking for DNSSEC records
+			if dnssecOK {
+				h.addDNSSEC(ctx, m, name, qtype)
+			}
+
+			if cacheable && useCache {
+				h.cacheService.Set(ctx, cacheKey(name, qtype, dnssecOK, view), m)
 			}
 			continue
 		}
 
 		// Not in our zone: optionally forward if allowed
-		var isAllowed bool
-		if viper.GetBool(consts.DNS_ENABLE_ALLOWED_LANS_CHECK) {
-			isAllowed = h.allowedLANsService.IsAllowed(srcIP)
-			vlog.Debugf("IsAllowed check for %v: %v (check enabled)", srcIP, isAllowed)
-		} else {
-			isAllowed = true
-			vlog.Debugf("IsAllowed check bypassed (check disabled), allowing %v", srcIP)
-		}
-
-		if isAllowed {
+		if h.forwardingAllowed(srcIP) {
 			vlog.Debugf("Forwarding query for %s to upstream", name)
-			resp, err := h.upstreamService.Forward(ctx, r)
+			resp, validation, err := h.forward(ctx, r)
 			if err == nil && resp != nil {
 				vlog.Debugf("Upstream responded successfully for %s", name)
 				wasUpstream = true
 
-				// Cache the upstream response
-				if h.cacheService != nil && resp.Rcode == dns.RcodeSuccess {
-					cacheKey := name + ":" + dns.TypeToString[qtype]
-					h.cacheService.Set(ctx, cacheKey, resp)
+				// Cache the upstream response together with its validation result
+				if useCache && (resp.Rcode == dns.RcodeSuccess || (validation != nil && validation.Security == models.DNSSECBogus)) {
+					h.cacheService.SetValidated(ctx, cacheKey(name, qtype, dnssecOK, view), resp, validation)
 				}
 
 				// Record upstream metrics
 				if h.metrics != nil {
 					h.metrics.RecordUpstreamQuery(time.Since(startTime).Seconds())
+					if validation != nil {
+						h.metrics.RecordDNSSECValidation(validation.Security)
+					}
 				}
 
-				if err := w.WriteMsg(resp); err != nil {
+				m = v1validationservice.Respond(r, resp, validation)
+				if hit := h.checkResponsePolicy(m, filter, policyHit); hit != nil {
+					policyHit = &hit.PolicyHit
+					if policyHit.Blocks() {
+						wasBlocked = true
+						m = h.respondPolicy(ctx, w, r, hit, srcIP)
+						return
+					}
+				}
+				if err := w.WriteMsg(m); err != nil {
 					vlog.Warnf("failed to write upstream response: %v", err)
 				}
 				return
@@ -250,6 +351,15 @@ func (h *DNSHandler) HandleDNS(w dns.ResponseWriter, r *dns.Msg) {
 		m.Rcode = dns.RcodeNameError
 	}
 
+	if hit := h.checkResponsePolicy(m, filter, policyHit); hit != nil {
+		policyHit = &hit.PolicyHit
+		if policyHit.Blocks() {
+			wasBlocked = true
+			m = h.respondPolicy(ctx, w, r, hit, srcIP)
+			return
+		}
+	}
+
 	vlog.Debugf("Sending final response with %d answers, rcode=%d", len(m.Answer), m.Rcode)
 	if err := w.WriteMsg(m); err != nil {
 		vlog.Warnf("failed to write DNS response: %v", err)
@@ -257,3 +367,365 @@ func (h *DNSHandler) HandleDNS(w dns.ResponseWriter, r *dns.Msg) {
 		vlog.Debugf("Successfully wrote DNS response to %v", w.RemoteAddr())
 	}
 }
+
+// forward sends a query to the upstream server, through the validating resolver when DNSSEC
+// validation is enabled and not turned off by the conditional forwarder of the name.
+// The validation result is nil for responses that weren't validated.
+func (h *DNSHandler) forward(ctx context.Context, r *dns.Msg) (*dns.Msg, *models.DNSSECValidation, error) {
+	if h.validationService != nil && (len(r.Question) == 0 || h.upstreamService.ValidatesDNSSEC(r.Question[0].Name)) {
+		return h.validationService.Forward(ctx, r)
+	}
+	resp, err := h.upstreamService.Forward(ctx, r)
+	return resp, nil, err
+}
+
+// checkQueryPolicy applies the filtering profile of the client and the QNAME triggers of the
+// response policies to a query name. The profile comes first, so its allowed domains are
+// exceptions to the policies. Queries that already matched a rule, which can only be a
+// passthru, are not checked again.
+func (h *DNSHandler) checkQueryPolicy(name string, filter *v1filterservice.Filter, matched *models.PolicyHit) *v1policyservice.Hit {
+	if matched != nil {
+		return nil
+	}
+	if hit := filter.CheckQuery(name); hit != nil {
+		return hit
+	}
+	if h.policyService == nil {
+		return nil
+	}
+	return h.policyService.CheckQuery(name, filter.Blocklists())
+}
+
+// checkResponsePolicy applies the blocked domains of the client's filtering profile and the
+// response IP, NS name and CNAME target triggers of the response policies to a response
+// before it is sent
+func (h *DNSHandler) checkResponsePolicy(resp *dns.Msg, filter *v1filterservice.Filter, matched *models.PolicyHit) *v1policyservice.Hit {
+	if matched != nil {
+		return nil
+	}
+	if hit := filter.CheckResponse(resp); hit != nil {
+		return hit
+	}
+	if h.policyService == nil {
+		return nil
+	}
+	return h.policyService.CheckResponse(resp, filter.Blocklists())
+}
+
+// respondPolicy answers a query with the action of a response policy rule and returns the
+// answer. Local data with a CNAME is followed like a CNAME in our zones; dropped queries
+// get no answer.
+func (h *DNSHandler) respondPolicy(ctx context.Context, w dns.ResponseWriter, r *dns.Msg, hit *v1policyservice.Hit, srcIP netip.Addr) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetReply(r)
+	vlog.Debugf("Response policy %s rule %s (%s) matched %s: %s", hit.Policy, hit.Rule, hit.Trigger, r.Question[0].Name, hit.Action)
+	if hit.Action == models.PolicyActionDrop {
+		return m
+	}
+
+	qtype := r.Question[0].Qtype
+	hit.Answer(m, r.Question[0].Name, qtype)
+	if cname := aliasCNAME(m.Answer, qtype); cname != nil {
+		h.followCNAME(ctx, m, cname, qtype, h.forwardingAllowed(srcIP))
+	}
+	if err := w.WriteMsg(m); err != nil {
+		vlog.Warnf("failed to write response policy answer: %v", err)
+	}
+	return m
+}
+
+// answerFromZone answers a query for a name in one of our zones from the zone's data and appends
+// the answer to m. It reports whether the response may be cached and whether the upstream server was used.
+func (h *DNSHandler) answerFromZone(ctx context.Context, m *dns.Msg, zone *models.DNSZone, name string, qtype uint16, srcIP netip.Addr) (bool, bool) {
+	// Names at or below a zone cut are answered with a referral to the child zone's servers.
+	// The DS RRset at a cut belongs to the parent zone and is answered from our own data.
+	referral, err := h.dnsService.FindReferral(zone, name)
+	if err != nil {
+		vlog.Warnf("failed to check delegation for %s: %v", name, err)
+		m.Rcode = dns.RcodeServerFailure
+		return false, false
+	}
+	if referral != nil && !(qtype == dns.TypeDS && len(referral.NS) > 0 && strings.EqualFold(referral.NS[0].Header().Name, name)) {
+		vlog.Debugf("Referral for %s to %d name servers", name, len(referral.NS))
+		m.Authoritative = false
+		m.Ns = append(m.Ns, referral.NS...)
+		m.Extra = append(m.Extra, referral.Glue...)
+		return true, false
+	}
+
+	// DNSKEY and NSEC3PARAM records of signed zones are not stored with the zone's records
+	if records := h.dnssecRecords(ctx, zone, name, qtype); len(records) > 0 {
+		m.Authoritative = true
+		m.Answer = append(m.Answer, records...)
+		return true, false
+	}
+
+	// We have this zone - lookup record from Valkey
+	records, err := h.dnsService.LookupRecord(zone, name, qtype)
+	if err != nil {
+		vlog.Warnf("failed to lookup record %s: %v", name, err)
+		m.Rcode = dns.RcodeServerFailure
+		return false, false
+	}
+
+	if cname := aliasCNAME(records, qtype); cname != nil {
+		// The name is an alias - answer with the CNAME and follow the chain
+		m.Authoritative = true
+		m.Answer = append(m.Answer, records...)
+		upstream := h.followCNAME(ctx, m, cname, qtype, h.forwardingAllowed(srcIP))
+		return m.Rcode == dns.RcodeSuccess || m.Rcode == dns.RcodeNameError, upstream
+	}
+
+	if len(records) > 0 {
+		m.Authoritative = true
+		vlog.Debugf("Found %d records for %s", len(records), name)
+
+		// 4. Load Balancing - if multiple address records and load balancer enabled
+		loadBalanced := false
+		if h.loadBalancer != nil && len(records) > 1 && (qtype == dns.TypeA || qtype == dns.TypeAAAA) {
+			// Use load balancer to select best record from the RRset
+			recordTypeStr := dns.TypeToString[qtype]
+			h.loadBalancer.SyncBackends(ctx, name, recordTypeStr, backendRecords(records))
+			selectedRecord, found := h.loadBalancer.GetBackend(ctx, name, recordTypeStr)
+			if found {
+				selectedValue := selectedRecord.GetRData()
+				vlog.Debugf("Load balancer selected backend: %s", selectedValue)
+				// Find the matching DNS record and return it
+				for _, rec := range records {
+					if aRec, ok := rec.(*dns.A); ok && aRec.A.String() == selectedValue {
+						m.Answer = append(m.Answer, rec)
+						loadBalanced = true
+						break
+					} else if aaaaRec, ok := rec.(*dns.AAAA); ok && aaaaRec.AAAA.String() == selectedValue {
+						m.Answer = append(m.Answer, rec)
+						loadBalanced = true
+						break
+					}
+				}
+			} else {
+				// No healthy backend via load balancer, return all records
+				m.Answer = append(m.Answer, records...)
+			}
+		} else {
+			// No load balancing needed, return all records
+			m.Answer = append(m.Answer, records...)
+		}
+
+		// 5. Cache the successful response (load-balanced answers are not cached,
+		// otherwise every client would get the same backend until the entry expires)
+		return !loadBalanced, false
+	}
+
+	// 6. ALIAS flattening - answer A/AAAA queries with the records of the alias target
+	upstream := false
+	if qtype == dns.TypeA || qtype == dns.TypeAAAA {
+		target, found, err := h.dnsService.LookupAlias(zone, name)
+		if err != nil {
+			vlog.Warnf("failed to lookup ALIAS for %s: %v", name, err)
+		} else if found {
+			var answers []dns.RR
+			answers, upstream = h.resolveAlias(ctx, name, target, qtype)
+			if len(answers) > 0 {
+				m.Authoritative = true
+				m.Answer = append(m.Answer, answers...)
+				return true, upstream
+			}
+		}
+	}
+
+	// 7. Negative answer - NXDOMAIN or NODATA with the zone SOA in the authority section
+	rcode, soa, err := h.dnsService.NegativeResponse(zone, name)
+	if err != nil {
+		vlog.Warnf("failed to build negative response for %s: %v", name, err)
+		m.Rcode = dns.RcodeServerFailure
+		return false, upstream
+	}
+
+	vlog.Debugf("No %s records for %s, answering %s", dns.TypeToString[qtype], name, dns.RcodeToString[rcode])
+	m.Authoritative = true
+	m.Rcode = rcode
+	m.Ns = append(m.Ns, soa)
+	return true, upstream
+}
+
+// cacheKey returns the cache key of a query; answers with DNSSEC records and answers for
+// split-horizon views are cached apart
+func cacheKey(name string, qtype uint16, dnssecOK bool, view string) string {
+	key := name + ":" + dns.TypeToString[qtype]
+	if dnssecOK {
+		key += ":DO"
+	}
+	if view != "" {
+		key += "@" + view
+	}
+	return key
+}
+
+// forwardingAllowed reports whether queries from the client may be forwarded upstream
+func (h *DNSHandler) forwardingAllowed(srcIP netip.Addr) bool {
+	if !viper.GetBool(consts.DNS_ENABLE_ALLOWED_LANS_CHECK) {
+		vlog.Debugf("IsAllowed check bypassed (check disabled), allowing %v", srcIP)
+		return true
+	}
+
+	isAllowed := h.allowedLANsService.IsAllowed(srcIP)
+	vlog.Debugf("IsAllowed check for %v: %v (check enabled)", srcIP, isAllowed)
+	return isAllowed
+}
+
+// followCNAME follows a CNAME chain starting at an authoritative answer and appends each step to m.
+// Targets in our zones are resolved locally; the first target outside them is resolved through
+// the upstream server when allowUpstream is set. A loop or a chain longer than maxCNAMEChain
+// answers SERVFAIL. It reports whether the upstream server was used.
+func (h *DNSHandler) followCNAME(ctx context.Context, m *dns.Msg, cname *dns.CNAME, qtype uint16, allowUpstream bool) bool {
+	seen := map[string]bool{strings.ToLower(cname.Hdr.Name): true}
+	target := dns.Fqdn(cname.Target)
+
+	for depth := 1; ; depth++ {
+		if seen[strings.ToLower(target)] {
+			vlog.Warnf("CNAME loop detected for %s at %s", cname.Hdr.Name, target)
+			m.Rcode = dns.RcodeServerFailure
+			return false
+		}
+		if depth > maxCNAMEChain {
+			vlog.Warnf("CNAME chain for %s exceeds %d hops", cname.Hdr.Name, maxCNAMEChain)
+			m.Rcode = dns.RcodeServerFailure
+			return false
+		}
+		seen[strings.ToLower(target)] = true
+
+		zone, hasZone, err := h.dnsService.ServingZone(ctx, target)
+		if !hasZone {
+			if !allowUpstream {
+				// The client's resolver continues from the last CNAME
+				return false
+			}
+			return h.resolveUpstreamTarget(ctx, m, target, qtype)
+		}
+
+		var records []dns.RR
+		if err == nil {
+			records, err = h.dnsService.LookupRecord(zone, target, qtype)
+		}
+		if err != nil {
+			vlog.Warnf("failed to lookup CNAME target %s: %v", target, err)
+			m.Rcode = dns.RcodeServerFailure
+			return false
+		}
+
+		if len(records) == 0 {
+			// The rcode and SOA describe the end of the chain (RFC 6604)
+			rcode, soa, err := h.dnsService.NegativeResponse(zone, target)
+			if err != nil {
+				vlog.Warnf("failed to build negative response for CNAME target %s: %v", target, err)
+				m.Rcode = dns.RcodeServerFailure
+				return false
+			}
+			m.Rcode = rcode
+			m.Ns = append(m.Ns, soa)
+			return false
+		}
+
+		m.Answer = append(m.Answer, records...)
+
+		next := aliasCNAME(records, qtype)
+		if next == nil {
+			return false
+		}
+		target = dns.Fqdn(next.Target)
+	}
+}
+
+// resolveUpstreamTarget resolves a CNAME target outside our zones through the upstream server
+// and appends its answers. When forwarding fails the chain is returned as is and the client's
+// resolver continues from the last CNAME.
+func (h *DNSHandler) resolveUpstreamTarget(ctx context.Context, m *dns.Msg, target string, qtype uint16) bool {
+	query := new(dns.Msg)
+	query.SetQuestion(target, qtype)
+	query.RecursionDesired = true
+
+	start := time.Now()
+	resp, err := h.upstreamService.Forward(ctx, query)
+	if err != nil || resp == nil {
+		vlog.Warnf("failed to resolve CNAME target %s upstream: %v", target, err)
+		if h.metrics != nil {
+			h.metrics.RecordUpstreamError()
+		}
+		return false
+	}
+
+	if h.metrics != nil {
+		h.metrics.RecordUpstreamQuery(time.Since(start).Seconds())
+	}
+
+	m.Answer = append(m.Answer, resp.Answer...)
+	if resp.Rcode == dns.RcodeNameError {
+		m.Rcode = dns.RcodeNameError
+		m.Ns = append(m.Ns, resp.Ns...)
+	}
+
+	return true
+}
+
+// resolveAlias flattens an ALIAS record: the A or AAAA records of the target are looked up in our
+// zones or through the upstream server and returned with the alias owner name. The records keep the
+// target's TTL, so cached answers expire together with the target data. ALIAS targets are part of
+// our own zone data, so they are resolved regardless of the client's forwarding permissions.
+// It reports whether the upstream server was used.
+func (h *DNSHandler) resolveAlias(ctx context.Context, name, target string, qtype uint16) ([]dns.RR, bool) {
+	resolved := new(dns.Msg)
+	upstream := false
+
+	if zone, hasZone, err := h.dnsService.ServingZone(ctx, target); hasZone {
+		var records []dns.RR
+		if err == nil {
+			records, err = h.dnsService.LookupRecord(zone, target, qtype)
+		}
+		if err != nil {
+			vlog.Warnf("failed to lookup ALIAS target %s: %v", target, err)
+			return nil, false
+		}
+		resolved.Answer = append(resolved.Answer, records...)
+		if cname := aliasCNAME(records, qtype); cname != nil {
+			upstream = h.followCNAME(ctx, resolved, cname, qtype, true)
+		}
+	} else {
+		upstream = h.resolveUpstreamTarget(ctx, resolved, target, qtype)
+	}
+
+	answers := make([]dns.RR, 0, len(resolved.Answer))
+	for _, rr := range resolved.Answer {
+		if rr.Header().Rrtype != qtype {
+			continue
+		}
+		synth := dns.Copy(rr)
+		synth.Header().Name = name
+		answers = append(answers, synth)
+	}
+
+	vlog.Debugf("ALIAS %s -> %s resolved to %d %s records", name, target, len(answers), dns.TypeToString[qtype])
+	return answers, upstream
+}
+
+// aliasCNAME returns the CNAME a lookup answered with in place of the queried type, if any
+func aliasCNAME(records []dns.RR, qtype uint16) *dns.CNAME {
+	if len(records) == 0 || qtype == dns.TypeCNAME {
+		return nil
+	}
+	cname, _ := records[0].(*dns.CNAME)
+	return cname
+}
+
+// backendRecords converts A/AAAA answers into records the load balancer can track
+func backendRecords(records []dns.RR) []models.DNSRecord {
+	result := make([]models.DNSRecord, 0, len(records))
+	for _, rr := range records {
+		switch v := rr.(type) {
+		case *dns.A:
+			result = append(result, models.NewARecord(v.Hdr.Name, v.A.String(), v.Hdr.Ttl))
+		case *dns.AAAA:
+			result = append(result, models.NewAAAARecord(v.Hdr.Name, v.AAAA.String(), v.Hdr.Ttl))
+		}
+	}
+	return result
+}
@@ -0,0 +1,555 @@
+package handlers
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/rogerwesterbo/godns/internal/models"
+	"github.com/rogerwesterbo/godns/internal/services/v1allowedlans"
+	"github.com/rogerwesterbo/godns/internal/services/v1cacheservice"
+	"github.com/rogerwesterbo/godns/internal/services/v1dnsservice"
+	"github.com/rogerwesterbo/godns/internal/services/v1filterservice"
+	"github.com/rogerwesterbo/godns/internal/services/v1policyservice"
+	"github.com/rogerwesterbo/godns/internal/services/v1querylogservice"
+	"github.com/rogerwesterbo/godns/internal/services/v1recordservice"
+	"github.com/rogerwesterbo/godns/internal/services/v1viewservice"
+	"github.com/rogerwesterbo/godns/internal/services/v1zoneservice"
+	"github.com/rogerwesterbo/godns/internal/services/v1zonetransferservice"
+	"github.com/rogerwesterbo/godns/internal/testutil/valkeytest"
+	"github.com/rogerwesterbo/godns/pkg/consts"
+	"github.com/spf13/viper"
+)
+
+// recordingWriter captures the responses written by the handler
+type recordingWriter struct {
+	msg  *dns.Msg
+	msgs []*dns.Msg
+	tcp  bool
+	ip   net.IP // client address, 127.0.0.1 when not set
+}
+
+func (w *recordingWriter) LocalAddr() net.Addr {
+	return &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 53}
+}
+
+func (w *recordingWriter) RemoteAddr() net.Addr {
+	ip := w.ip
+	if ip == nil {
+		ip = net.IPv4(127, 0, 0, 1)
+	}
+	if w.tcp {
+		return &net.TCPAddr{IP: ip, Port: 40000}
+	}
+	return &net.UDPAddr{IP: ip, Port: 40000}
+}
+
+func (w *recordingWriter) WriteMsg(m *dns.Msg) error {
+	w.msg = m
+	w.msgs = append(w.msgs, m)
+	return nil
+}
+
+func (w *recordingWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w *recordingWriter) Close() error                { return nil }
+func (w *recordingWriter) TsigStatus() error           { return nil }
+func (w *recordingWriter) TsigTimersOnly(bool)         {}
+func (w *recordingWriter) Hijack()                     {}
+
+// newTestHandler returns a handler serving the given zone from in-memory storage
+func newTestHandler(t *testing.T, zone *models.DNSZone) *DNSHandler {
+	t.Helper()
+
+	client := valkeytest.NewMemoryValkey()
+	zoneService := v1zoneservice.NewV1ZoneService(client, nil, nil)
+	if err := zoneService.CreateZone(context.Background(), zone); err != nil {
+		t.Fatalf("failed to create zone: %v", err)
+	}
+
+	return NewDNSHandler(DNSHandlerOptions{DNSService: v1dnsservice.NewDNSService(client), TransferService: v1zonetransferservice.NewV1ZoneTransferService(zoneService)})
+}
+
+// query sends a question to the handler and returns the response
+func query(t *testing.T, h *DNSHandler, name string, qtype uint16) *dns.Msg {
+	t.Helper()
+
+	req := new(dns.Msg)
+	req.SetQuestion(name, qtype)
+
+	w := &recordingWriter{}
+	h.HandleDNS(w, req)
+	if w.msg == nil {
+		t.Fatalf("no response for %s %s", name, dns.TypeToString[qtype])
+	}
+	return w.msg
+}
+
+func testZone() *models.DNSZone {
+	return &models.DNSZone{
+		Domain: "example.lan.",
+		Records: []models.DNSRecord{
+			models.NewSOARecord("example.lan.", "ns1.example.lan.", "hostmaster.example.lan.", 2024110601, 3600, 1800, 604800, 60, 3600),
+			models.NewNSRecord("example.lan.", "ns1.example.lan.", 3600),
+			models.NewARecord("ns1.example.lan.", "192.168.100.1", 3600),
+			models.NewARecord("web.example.lan.", "192.168.100.10", 300),
+			models.NewCNAMERecord("www.example.lan.", "web.example.lan.", 300),
+			models.NewCNAMERecord("loop1.example.lan.", "loop2.example.lan.", 300),
+			models.NewCNAMERecord("loop2.example.lan.", "loop1.example.lan.", 300),
+			models.NewCNAMERecord("dangling.example.lan.", "missing.example.lan.", 300),
+			models.NewALIASRecord("example.lan.", "web.example.lan.", 300),
+			models.NewARecord("*.apps.example.lan.", "192.168.100.20", 300),
+		},
+	}
+}
+
+func TestHandleDNSAuthoritativeAnswers(t *testing.T) {
+	h := newTestHandler(t, testZone())
+
+	tests := []struct {
+		name       string
+		qname      string
+		qtype      uint16
+		wantRcode  int
+		wantAnswer int
+		wantSOA    bool
+	}{
+		{"direct answer", "web.example.lan.", dns.TypeA, dns.RcodeSuccess, 1, false},
+		{"NODATA", "web.example.lan.", dns.TypeAAAA, dns.RcodeSuccess, 0, true},
+		{"NXDOMAIN", "missing.example.lan.", dns.TypeA, dns.RcodeNameError, 0, true},
+		{"wildcard", "pr-1.apps.example.lan.", dns.TypeA, dns.RcodeSuccess, 1, false},
+		{"wildcard one-character label", "a.apps.example.lan.", dns.TypeA, dns.RcodeSuccess, 1, false},
+		{"CNAME chain", "www.example.lan.", dns.TypeA, dns.RcodeSuccess, 2, false},
+		{"CNAME query", "www.example.lan.", dns.TypeCNAME, dns.RcodeSuccess, 1, false},
+		{"CNAME loop", "loop1.example.lan.", dns.TypeA, dns.RcodeServerFailure, 2, false},
+		{"dangling CNAME", "dangling.example.lan.", dns.TypeA, dns.RcodeNameError, 1, true},
+		{"ALIAS at apex", "example.lan.", dns.TypeA, dns.RcodeSuccess, 1, false},
+		{"ALIAS target without AAAA", "example.lan.", dns.TypeAAAA, dns.RcodeSuccess, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := query(t, h, tt.qname, tt.qtype)
+			if resp.Rcode != tt.wantRcode {
+				t.Errorf("rcode = %s, want %s", dns.RcodeToString[resp.Rcode], dns.RcodeToString[tt.wantRcode])
+			}
+			if len(resp.Answer) != tt.wantAnswer {
+				t.Errorf("got %d answers, want %d: %v", len(resp.Answer), tt.wantAnswer, resp.Answer)
+			}
+			if len(resp.Answer) > 0 && resp.Answer[0].Header().Name != tt.qname {
+				t.Errorf("answer owner = %s, want %s", resp.Answer[0].Header().Name, tt.qname)
+			}
+			hasSOA := len(resp.Ns) > 0 && resp.Ns[0].Header().Rrtype == dns.TypeSOA
+			if hasSOA != tt.wantSOA {
+				t.Errorf("SOA in authority = %v, want %v", hasSOA, tt.wantSOA)
+			}
+			if tt.wantRcode != dns.RcodeServerFailure && !resp.Authoritative {
+				t.Error("expected AA bit on authoritative answer")
+			}
+		})
+	}
+}
+
+// readCounter counts the reads of stored data
+// Lookups of missing keys, like the parent names tried while finding a zone, are not counted.
+type readCounter struct {
+	*valkeytest.MemoryValkey
+	reads atomic.Int32
+}
+
+func (c *readCounter) GetData(ctx context.Context, key string) (string, error) {
+	data, err := c.MemoryValkey.GetData(ctx, key)
+	if err == nil {
+		c.reads.Add(1)
+	}
+	return data, err
+}
+
+func TestHandleDNSLoadsZoneOnce(t *testing.T) {
+	client := &readCounter{MemoryValkey: valkeytest.NewMemoryValkey()}
+	if err := v1zoneservice.NewV1ZoneService(client, nil, nil).CreateZone(context.Background(), testZone()); err != nil {
+		t.Fatalf("failed to create zone: %v", err)
+	}
+	h := NewDNSHandler(DNSHandlerOptions{DNSService: v1dnsservice.NewDNSService(client)})
+
+	// A NODATA answer checks for a referral, the records, a CNAME, an ALIAS and the SOA,
+	// all from the zone data
+	tests := []struct {
+		name  string
+		qtype uint16
+		want  int
+	}{
+		{name: "answer", qtype: dns.TypeA, want: 1},
+		{name: "NODATA", qtype: dns.TypeAAAA, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client.reads.Store(0)
+			if resp := query(t, h, "web.example.lan.", tt.qtype); resp.Rcode != dns.RcodeSuccess || len(resp.Answer) != tt.want {
+				t.Fatalf("response = %v, want %d answers", resp, tt.want)
+			}
+			if reads := client.reads.Load(); reads != 1 {
+				t.Errorf("stored data read %d times, want once", reads)
+			}
+		})
+	}
+}
+
+func TestHandleDNSReferral(t *testing.T) {
+	zone := testZone()
+	zone.Records = append(zone.Records,
+		models.NewNSRecord("lab.example.lan.", "ns1.lab.example.lan.", 3600),
+		models.NewNSRecord("lab.example.lan.", "ns.team.example.com.", 3600),
+		models.NewARecord("ns1.lab.example.lan.", "192.168.200.1", 3600),
+	)
+	h := newTestHandler(t, zone)
+
+	for _, qname := range []string{"lab.example.lan.", "host.lab.example.lan."} {
+		t.Run(qname, func(t *testing.T) {
+			resp := query(t, h, qname, dns.TypeA)
+			if resp.Rcode != dns.RcodeSuccess {
+				t.Errorf("rcode = %s, want NOERROR", dns.RcodeToString[resp.Rcode])
+			}
+			if resp.Authoritative {
+				t.Error("referral must not set the AA bit")
+			}
+			if len(resp.Answer) != 0 {
+				t.Errorf("referral must not have answers, got %v", resp.Answer)
+			}
+			if len(resp.Ns) != 2 || resp.Ns[0].Header().Rrtype != dns.TypeNS {
+				t.Errorf("expected 2 NS records in authority section, got %v", resp.Ns)
+			}
+			if len(resp.Extra) != 1 || resp.Extra[0].Header().Name != "ns1.lab.example.lan." {
+				t.Errorf("expected glue for ns1.lab.example.lan. only, got %v", resp.Extra)
+			}
+		})
+	}
+
+	// The apex NS RRset is authoritative data, not a delegation
+	resp := query(t, h, "example.lan.", dns.TypeNS)
+	if !resp.Authoritative || len(resp.Answer) != 1 {
+		t.Errorf("expected authoritative apex NS answer, got %v", resp)
+	}
+}
+
+func TestHandleDNSViews(t *testing.T) {
+	ctx := context.Background()
+	client := valkeytest.NewMemoryValkey()
+	zone := testZone()
+	zone.Records = append(zone.Records, models.NewARecord("app.example.lan.", "203.0.113.5", 300))
+	zone.Views = []models.ZoneView{{Name: "office", Records: []models.DNSRecord{
+		models.NewARecord("app.example.lan.", "10.0.0.5", 300),
+	}}}
+	if err := v1zoneservice.NewV1ZoneService(client, nil, nil).CreateZone(ctx, zone); err != nil {
+		t.Fatalf("failed to create zone: %v", err)
+	}
+	viewService := v1viewservice.NewV1ViewService(client)
+	if err := viewService.CreateView(ctx, &models.View{Name: "office", Prefixes: []string{"10.0.0.0/8"}}); err != nil {
+		t.Fatalf("failed to create view: %v", err)
+	}
+	cache := v1cacheservice.NewDNSCache(100, time.Minute)
+	h := NewDNSHandler(DNSHandlerOptions{DNSService: v1dnsservice.NewDNSService(client), CacheService: cache, ViewService: viewService})
+
+	tests := []struct {
+		client string
+		want   string
+	}{
+		{"10.1.2.3", "10.0.0.5"},
+		{"192.168.1.10", "203.0.113.5"},
+	}
+	// The second round is answered from the cache
+	for round := 0; round < 2; round++ {
+		for _, tt := range tests {
+			req := new(dns.Msg)
+			req.SetQuestion("app.example.lan.", dns.TypeA)
+			w := &recordingWriter{ip: net.ParseIP(tt.client)}
+			h.HandleDNS(w, req)
+
+			if w.msg == nil || len(w.msg.Answer) != 1 {
+				t.Fatalf("round %d: answer for %s = %v, want one A record", round, tt.client, w.msg)
+			}
+			if got := w.msg.Answer[0].(*dns.A).A.String(); got != tt.want {
+				t.Errorf("round %d: answer for %s = %s, want %s", round, tt.client, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestHandleDNSCacheInvalidation(t *testing.T) {
+	ctx := context.Background()
+	client := valkeytest.NewMemoryValkey()
+	cache := v1cacheservice.NewDNSCache(100, time.Minute)
+	zoneService := v1zoneservice.NewV1ZoneService(client, nil, cache)
+	if err := zoneService.CreateZone(ctx, testZone()); err != nil {
+		t.Fatalf("failed to create zone: %v", err)
+	}
+	recordService := v1recordservice.NewV1RecordService(zoneService)
+	h := NewDNSHandler(DNSHandlerOptions{DNSService: v1dnsservice.NewDNSService(client), CacheService: cache})
+
+	tests := []struct {
+		name   string
+		change func() error
+		want   string // empty when no answer is expected
+	}{
+		{"record changed", func() error {
+			record := models.NewARecord("web.example.lan.", "192.168.100.11", 300)
+			return recordService.UpdateRecord(ctx, "example.lan.", "", "web.example.lan.", "A", "", &record)
+		}, "192.168.100.11"},
+		{"zone updated", func() error {
+			zone := testZone()
+			zone.Enabled = true
+			zone.Records[3] = models.NewARecord("web.example.lan.", "192.168.100.12", 300)
+			return zoneService.UpdateZone(ctx, "example.lan.", zone)
+		}, "192.168.100.12"},
+		{"zone disabled", func() error {
+			return zoneService.SetZoneEnabled(ctx, "example.lan.", false)
+		}, ""},
+	}
+
+	// Cache the first answer
+	if resp := query(t, h, "web.example.lan.", dns.TypeA); len(resp.Answer) != 1 {
+		t.Fatalf("answer = %v, want one A record", resp.Answer)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.change(); err != nil {
+				t.Fatalf("change failed: %v", err)
+			}
+
+			resp := query(t, h, "web.example.lan.", dns.TypeA)
+			if tt.want == "" {
+				if len(resp.Answer) != 0 {
+					t.Errorf("answer = %v, want none", resp.Answer)
+				}
+				return
+			}
+			if len(resp.Answer) != 1 || resp.Answer[0].(*dns.A).A.String() != tt.want {
+				t.Errorf("answer = %v, want %s", resp.Answer, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleDNSPolicies(t *testing.T) {
+	zone := testZone()
+	zone.Records = append(zone.Records, models.NewARecord("tracker.example.lan.", "192.168.100.66", 300))
+	h := newTestHandler(t, zone)
+
+	policyZone := filepath.Join(t.TempDir(), "policy.rpz")
+	if err := os.WriteFile(policyZone, []byte(`$ORIGIN rpz.test.
+@ 300 IN SOA ns.rpz.test. hostmaster.rpz.test. 1 3600 600 86400 60
+@ 300 IN NS ns.rpz.test.
+blocked.example.lan CNAME .
+*.apps.example.lan CNAME *.
+pass.apps.example.lan CNAME rpz-passthru.
+redirect.example.lan A 192.168.100.99
+garden.example.lan CNAME web.example.lan.
+drop.example.lan CNAME rpz-drop.
+32.66.100.168.192.rpz-ip CNAME .
+`), 0o600); err != nil {
+		t.Fatalf("failed to write policy zone: %v", err)
+	}
+	h.policyService = v1policyservice.NewV1PolicyService([]models.PolicySource{{Name: "local", Type: models.PolicyTypeRPZ, Location: policyZone}}, nil, time.Hour, time.Second)
+	h.policyService.Refresh()
+	h.queryLog = v1querylogservice.NewQueryLogService(100, time.Hour, nil)
+	defer h.queryLog.Stop()
+
+	tests := []struct {
+		qname       string
+		wantRcode   int
+		want        []string
+		wantRule    string
+		wantBlocked bool
+	}{
+		{"blocked.example.lan.", dns.RcodeNameError, nil, "blocked.example.lan", true},
+		{"host.apps.example.lan.", dns.RcodeSuccess, nil, "*.apps.example.lan", true},
+		{"pass.apps.example.lan.", dns.RcodeSuccess, []string{"192.168.100.20"}, "pass.apps.example.lan", false},
+		{"redirect.example.lan.", dns.RcodeSuccess, []string{"192.168.100.99"}, "redirect.example.lan", true},
+		{"garden.example.lan.", dns.RcodeSuccess, []string{"web.example.lan.", "192.168.100.10"}, "garden.example.lan", true},
+		{"tracker.example.lan.", dns.RcodeNameError, nil, "192.168.100.66/32", true},
+		{"web.example.lan.", dns.RcodeSuccess, []string{"192.168.100.10"}, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.qname, func(t *testing.T) {
+			resp := query(t, h, tt.qname, dns.TypeA)
+			if resp.Rcode != tt.wantRcode {
+				t.Errorf("Rcode = %s, want %s", dns.RcodeToString[resp.Rcode], dns.RcodeToString[tt.wantRcode])
+			}
+			var got []string
+			for _, rr := range resp.Answer {
+				switch v := rr.(type) {
+				case *dns.A:
+					got = append(got, v.A.String())
+				case *dns.CNAME:
+					got = append(got, v.Target)
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Answer = %v, want %v", got, tt.want)
+			}
+
+			logged := h.queryLog.GetRecentQueries(context.Background(), 1)[0]
+			var rule string
+			if logged.Policy != nil {
+				rule = logged.Policy.Rule
+			}
+			if rule != tt.wantRule || logged.Blocked != tt.wantBlocked {
+				t.Errorf("logged rule %q, blocked %t, want %q, %t", rule, logged.Blocked, tt.wantRule, tt.wantBlocked)
+			}
+		})
+	}
+
+	// Dropped queries get no answer
+	req := new(dns.Msg)
+	req.SetQuestion("drop.example.lan.", dns.TypeA)
+	w := &recordingWriter{}
+	h.HandleDNS(w, req)
+	if w.msg != nil {
+		t.Errorf("dropped query answered with %v", w.msg)
+	}
+
+	if status := h.policyService.Status(); status[0].Hits != 7 {
+		t.Errorf("policy hits = %d, want 7", status[0].Hits)
+	}
+}
+
+// clientIDWriter records the response to a query sent with a client identifier
+type clientIDWriter struct {
+	recordingWriter
+	id string
+}
+
+func (w *clientIDWriter) ClientID() string { return w.id }
+
+func TestHandleDNSFilterProfiles(t *testing.T) {
+	ctx := context.Background()
+	zone := testZone()
+	zone.Records = append(zone.Records,
+		models.NewARecord("videos.example.lan.", "192.168.100.30", 300),
+		models.NewARecord("pass.apps.example.lan.", "192.168.100.20", 300),
+	)
+	h := newTestHandler(t, zone)
+
+	dir := t.TempDir()
+	policyZone := filepath.Join(dir, "policy.rpz")
+	social := filepath.Join(dir, "social.txt")
+	if err := os.WriteFile(policyZone, []byte(`$ORIGIN rpz.test.
+@ 300 IN SOA ns.rpz.test. hostmaster.rpz.test. 1 3600 600 86400 60
+videos.example.lan CNAME .
+`), 0o600); err != nil {
+		t.Fatalf("failed to write policy zone: %v", err)
+	}
+	if err := os.WriteFile(social, []byte("apps.example.lan\n"), 0o600); err != nil {
+		t.Fatalf("failed to write blocklist: %v", err)
+	}
+	h.policyService = v1policyservice.NewV1PolicyService([]models.PolicySource{
+		{Name: "local", Type: models.PolicyTypeRPZ, Location: policyZone},
+		{Name: "social", Type: models.PolicyTypeDomains, Location: social, ProfileOnly: true},
+	}, nil, time.Hour, time.Second)
+	h.policyService.Refresh()
+
+	h.filterService = v1filterservice.NewV1FilterService(valkeytest.NewMemoryValkey(), h.policyService.Blocklists())
+	profile := &models.FilterProfile{
+		Name:           "kids",
+		Blocklists:     []string{"social"},
+		BlockedDomains: []string{"web.example.lan"},
+		AllowedDomains: []string{"videos.example.lan"},
+		SafeSearch:     true,
+	}
+	if err := h.filterService.CreateFilterProfile(ctx, profile); err != nil {
+		t.Fatalf("failed to create profile: %v", err)
+	}
+	if err := h.filterService.CreateClientGroup(ctx, &models.ClientGroup{Name: "branch", Prefixes: []string{"10.0.0.0/8"}, ClientIDs: []string{"kiosk"}, Profile: "kids"}); err != nil {
+		t.Fatalf("failed to create client group: %v", err)
+	}
+	h.queryLog = v1querylogservice.NewQueryLogService(100, time.Hour, nil)
+	defer h.queryLog.Stop()
+
+	// Safe search targets are left unresolved: the clients aren't allowed to use the upstream
+	viper.Set(consts.DNS_ENABLE_ALLOWED_LANS_CHECK, true)
+	defer viper.Set(consts.DNS_ENABLE_ALLOWED_LANS_CHECK, false)
+	h.allowedLANsService = v1allowedlans.NewAllowedLANsService(valkeytest.NewMemoryValkey())
+
+	tests := []struct {
+		name      string
+		client    string
+		clientID  string
+		qname     string
+		wantRcode int
+		want      []string
+		wantRule  string
+	}{
+		{"allowed domain", "10.1.2.3", "", "videos.example.lan.", dns.RcodeSuccess, []string{"192.168.100.30"}, "videos.example.lan"},
+		{"response policy", "192.168.1.10", "", "videos.example.lan.", dns.RcodeNameError, nil, "videos.example.lan"},
+		{"blocklist", "10.1.2.3", "", "pass.apps.example.lan.", dns.RcodeNameError, nil, "apps.example.lan"},
+		{"blocklist of other clients", "192.168.1.10", "", "pass.apps.example.lan.", dns.RcodeSuccess, []string{"192.168.100.20"}, ""},
+		{"blocked domain", "10.1.2.3", "", "web.example.lan.", dns.RcodeNameError, nil, "web.example.lan"},
+		{"blocked CNAME target", "10.1.2.3", "", "www.example.lan.", dns.RcodeNameError, nil, "web.example.lan"},
+		{"client id", "192.168.1.10", "kiosk", "web.example.lan.", dns.RcodeNameError, nil, "web.example.lan"},
+		{"safe search", "10.1.2.3", "", "www.bing.com.", dns.RcodeSuccess, []string{"strict.bing.com."}, "www.bing.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := new(dns.Msg)
+			req.SetQuestion(tt.qname, dns.TypeA)
+			w := &clientIDWriter{recordingWriter: recordingWriter{ip: net.ParseIP(tt.client)}, id: tt.clientID}
+			h.HandleDNS(w, req)
+			if w.msg == nil {
+				t.Fatal("no response")
+			}
+
+			if w.msg.Rcode != tt.wantRcode {
+				t.Errorf("Rcode = %s, want %s", dns.RcodeToString[w.msg.Rcode], dns.RcodeToString[tt.wantRcode])
+			}
+			var got []string
+			for _, rr := range w.msg.Answer {
+				switch v := rr.(type) {
+				case *dns.A:
+					got = append(got, v.A.String())
+				case *dns.CNAME:
+					got = append(got, v.Target)
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Answer = %v, want %v", got, tt.want)
+			}
+
+			logged := h.queryLog.GetRecentQueries(ctx, 1)[0]
+			var rule string
+			if logged.Policy != nil {
+				rule = logged.Policy.Rule
+			}
+			wantGroup, wantProfile := "", ""
+			if tt.client == "10.1.2.3" || tt.clientID != "" {
+				wantGroup, wantProfile = "branch", "kids"
+			}
+			if rule != tt.wantRule || logged.ClientGroup != wantGroup || logged.Profile != wantProfile {
+				t.Errorf("logged rule %q, group %q, profile %q, want %q, %q, %q", rule, logged.ClientGroup, logged.Profile, tt.wantRule, wantGroup, wantProfile)
+			}
+		})
+	}
+
+	// Outside the schedules of its profile, the group is filtered like other clients
+	later := time.Now().UTC().Add(48 * time.Hour).Weekday()
+	profile.Schedules = []models.FilterSchedule{{Days: []string{later.String()}, Start: "00:00", End: "24:00"}}
+	profile.Timezone = "UTC"
+	if err := h.filterService.UpdateFilterProfile(ctx, "kids", profile); err != nil {
+		t.Fatalf("failed to update profile: %v", err)
+	}
+	w := &recordingWriter{ip: net.ParseIP("10.1.2.3")}
+	req := new(dns.Msg)
+	req.SetQuestion("web.example.lan.", dns.TypeA)
+	h.HandleDNS(w, req)
+	if w.msg == nil || w.msg.Rcode != dns.RcodeSuccess || len(w.msg.Answer) != 1 {
+		t.Errorf("answer outside the schedule = %v, want the A record", w.msg)
+	}
+	if logged := h.queryLog.GetRecentQueries(ctx, 1)[0]; logged.ClientGroup != "branch" || logged.Profile != "" {
+		t.Errorf("logged group %q, profile %q outside the schedule, want branch and no profile", logged.ClientGroup, logged.Profile)
+	}
+}
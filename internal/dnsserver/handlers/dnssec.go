@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"context"
+	"strings"
+
+	"github.com/miekg/dns"
+	"github.com/rogerwesterbo/godns/internal/models"
+	"github.com/rogerwesterbo/godns/internal/services/v1dnsservice"
+	"github.com/vitistack/common/pkg/loggers/vlog"
+)
+
+// dnssecRecords returns the DNSKEY or NSEC3PARAM RRset queried at the apex of a signed zone
+func (h *DNSHandler) dnssecRecords(ctx context.Context, zone *models.DNSZone, name string, qtype uint16) []dns.RR {
+	if h.dnssecService == nil || (qtype != dns.TypeDNSKEY && qtype != dns.TypeNSEC3PARAM) {
+		return nil
+	}
+
+	if !zone.Signed() || !strings.EqualFold(dns.Fqdn(zone.Domain), name) {
+		return nil
+	}
+
+	if qtype == dns.TypeNSEC3PARAM {
+		if zone.DNSSEC.Denial != models.DNSSECDenialNSEC3 {
+			return nil
+		}
+		return []dns.RR{v1dnsservice.NSEC3PARAM(zone)}
+	}
+
+	keys, err := h.dnssecService.DNSKEYs(ctx, zone.Domain)
+	if err != nil {
+		vlog.Warnf("failed to get DNSKEYs of zone %s: %v", zone.Domain, err)
+		return nil
+	}
+	return keys
+}
+
+// addDNSSEC adds the DNSSEC records to an answer from our zones for a client that set the DO bit:
+// the proofs of non-existence for negative and wildcard answers, the DS records or their absence
+// for referrals, and the RRSIGs of every RRset from a signed zone
+func (h *DNSHandler) addDNSSEC(ctx context.Context, m *dns.Msg, name string, qtype uint16) {
+	if h.dnssecService == nil || m.Rcode == dns.RcodeServerFailure {
+		return
+	}
+
+	zones := make(map[string]*models.DNSZone)
+	signedZone := func(owner string) *models.DNSZone {
+		owner = strings.ToLower(owner)
+		if zone, ok := zones[owner]; ok {
+			return zone
+		}
+		zone := h.dnsService.SignedZone(ctx, owner)
+		zones[owner] = zone
+		return zone
+	}
+
+	var proofs []dns.RR
+	if !m.Authoritative && len(m.Ns) > 0 && m.Ns[0].Header().Rrtype == dns.TypeNS {
+		// Referral: the DS RRset of the cut or the proof that the child zone is unsigned
+		cut := m.Ns[0].Header().Name
+		if zone := signedZone(cut); zone != nil {
+			rrs, err := h.dnsService.DelegationProof(zone, cut)
+			if err != nil {
+				vlog.Warnf("failed to prove delegation %s: %v", cut, err)
+			}
+			proofs = append(proofs, rrs...)
+		}
+	} else {
+		// Negative answer at the end of the CNAME chain
+		final := chainEnd(m.Answer, name, qtype)
+		if !hasRRset(m.Answer, final, qtype) && (m.Rcode == dns.RcodeSuccess || m.Rcode == dns.RcodeNameError) {
+			if zone := signedZone(final); zone != nil {
+				rrs, rcode, err := h.dnsService.DenialOfExistence(zone, final, qtype)
+				if err != nil {
+					vlog.Warnf("failed to prove non-existence of %s: %v", final, err)
+				} else {
+					proofs = append(proofs, rrs...)
+					m.Rcode = rcode
+				}
+			}
+		}
+
+		// Answers synthesised from a wildcard come with the proof that no closer match exists
+		seen := make(map[string]bool)
+		for _, rr := range m.Answer {
+			owner := strings.ToLower(rr.Header().Name)
+			if seen[owner] {
+				continue
+			}
+			seen[owner] = true
+			zone := signedZone(owner)
+			if zone == nil || v1dnsservice.SynthesisSource(zone, owner) == "" {
+				continue
+			}
+			rrs, err := h.dnsService.WildcardProof(zone, owner)
+			if err != nil {
+				vlog.Warnf("failed to prove wildcard answer for %s: %v", owner, err)
+			}
+			proofs = append(proofs, rrs...)
+		}
+	}
+
+	m.Ns = append(m.Ns, proofs...)
+
+	m.Answer = h.signSection(ctx, m.Answer, signedZone, true)
+	m.Ns = h.signSection(ctx, m.Ns, signedZone, m.Authoritative)
+}
+
+// signSection appends the RRSIGs of the RRsets in a message section that belong to signed zones.
+// The NS RRset of a referral is not authoritative and stays unsigned.
+func (h *DNSHandler) signSection(ctx context.Context, section []dns.RR, signedZone func(string) *models.DNSZone, authoritative bool) []dns.RR {
+	var sigs []dns.RR
+	for _, rrset := range rrsets(section) {
+		hdr := rrset[0].Header()
+		if hdr.Rrtype == dns.TypeRRSIG || (hdr.Rrtype == dns.TypeNS && !authoritative) {
+			continue
+		}
+
+		// NSEC3 owner names are hashes, so their zone is found from the signed chain's apex
+		owner := hdr.Name
+		if hdr.Rrtype == dns.TypeNSEC3 {
+			_, apex, _ := strings.Cut(owner, ".")
+			owner = apex
+		}
+		zone := signedZone(owner)
+		if zone == nil {
+			continue
+		}
+
+		wildcard := ""
+		if zone.DNSSEC.Denial != models.DNSSECDenialBlackLies && hdr.Rrtype != dns.TypeNSEC && hdr.Rrtype != dns.TypeNSEC3 {
+			wildcard = v1dnsservice.SynthesisSource(zone, hdr.Name)
+		}
+
+		rrsigs, err := h.dnssecService.SignRRset(ctx, zone.Domain, rrset, wildcard)
+		if err != nil {
+			vlog.Warnf("failed to sign %s %s: %v", hdr.Name, dns.TypeToString[hdr.Rrtype], err)
+			continue
+		}
+		for _, sig := range rrsigs {
+			sigs = append(sigs, sig)
+		}
+	}
+	return append(section, sigs...)
+}
+
+// rrsets groups the records of a section into RRsets, in order of first appearance
+func rrsets(section []dns.RR) [][]dns.RR {
+	var sets [][]dns.RR
+	index := make(map[string]int)
+	for _, rr := range section {
+		key := strings.ToLower(rr.Header().Name) + "/" + dns.TypeToString[rr.Header().Rrtype]
+		if i, ok := index[key]; ok {
+			sets[i] = append(sets[i], rr)
+			continue
+		}
+		index[key] = len(sets)
+		sets = append(sets, []dns.RR{rr})
+	}
+	return sets
+}
+
+// chainEnd returns the last name of the CNAME chain in an answer starting at name
+func chainEnd(answer []dns.RR, name string, qtype uint16) string {
+	if qtype == dns.TypeCNAME {
+		return name
+	}
+	for _, rr := range answer {
+		if cname, ok := rr.(*dns.CNAME); ok && strings.EqualFold(cname.Hdr.Name, name) {
+			name = dns.Fqdn(cname.Target)
+		}
+	}
+	return name
+}
+
+// hasRRset reports whether an answer holds records of qtype at name
+func hasRRset(answer []dns.RR, name string, qtype uint16) bool {
+	for _, rr := range answer {
+		if rr.Header().Rrtype == qtype && strings.EqualFold(rr.Header().Name, name) {
+			return true
+		}
+	}
+	return false
+}
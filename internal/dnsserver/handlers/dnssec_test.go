@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/rogerwesterbo/godns/internal/models"
+	"github.com/rogerwesterbo/godns/internal/services/v1cacheservice"
+	"github.com/rogerwesterbo/godns/internal/services/v1dnssecservice"
+	"github.com/rogerwesterbo/godns/internal/services/v1dnsservice"
+	"github.com/rogerwesterbo/godns/internal/services/v1zoneservice"
+	"github.com/rogerwesterbo/godns/internal/testutil/valkeytest"
+)
+
+// newSignedTestHandler returns a handler serving a signed zone, and the zone's DNSKEYs
+func newSignedTestHandler(t *testing.T, denial string) (*DNSHandler, []dns.RR) {
+	t.Helper()
+	ctx := context.Background()
+
+	zone := testZone()
+	zone.Records = append(zone.Records,
+		models.NewNSRecord("lab.example.lan.", "ns1.lab.example.lan.", 3600),
+		models.NewARecord("ns1.lab.example.lan.", "192.168.200.1", 3600),
+		models.NewNSRecord("secure.example.lan.", "ns1.example.lan.", 3600),
+		models.DNSRecord{Name: "secure.example.lan.", Type: "DS", Value: "12345 13 2 " + strings.Repeat("ab", 32), TTL: 3600},
+	)
+	zone.DNSSEC = &models.DNSSECSettings{Enabled: true, Denial: denial}
+
+	client := valkeytest.NewMemoryValkey()
+	zoneService := v1zoneservice.NewV1ZoneService(client, nil, nil)
+	if err := zoneService.CreateZone(ctx, zone); err != nil {
+		t.Fatalf("failed to create zone: %v", err)
+	}
+	dnssecService, err := v1dnssecservice.NewV1DNSSECService(client, "test-encryption-key", v1dnssecservice.RolloverPolicy{})
+	if err != nil {
+		t.Fatalf("failed to create DNSSEC service: %v", err)
+	}
+	if err := dnssecService.EnsureKeys(ctx, zone.Domain, zone.DNSSEC); err != nil {
+		t.Fatalf("failed to generate keys: %v", err)
+	}
+	keys, err := dnssecService.DNSKEYs(ctx, zone.Domain)
+	if err != nil {
+		t.Fatalf("failed to get keys: %v", err)
+	}
+
+	cache := v1cacheservice.NewDNSCache(100, time.Minute)
+	h := NewDNSHandler(DNSHandlerOptions{DNSService: v1dnsservice.NewDNSService(client), CacheService: cache, DNSSECService: dnssecService})
+	return h, keys
+}
+
+// queryDO sends a question with the DNSSEC OK bit set over TCP, so the response is not truncated
+func queryDO(t *testing.T, h *DNSHandler, name string, qtype uint16) *dns.Msg {
+	t.Helper()
+
+	req := new(dns.Msg)
+	req.SetQuestion(name, qtype)
+	req.SetEdns0(defaultUDPSize, true)
+
+	w := &recordingWriter{tcp: true}
+	h.HandleDNS(w, req)
+	if w.msg == nil {
+		t.Fatalf("no response for %s %s", name, dns.TypeToString[qtype])
+	}
+	return w.msg
+}
+
+// verifySignatures checks that every RRset in a section carries a valid RRSIG
+func verifySignatures(t *testing.T, section []dns.RR, keys []dns.RR) {
+	t.Helper()
+
+	for _, rrset := range rrsets(section) {
+		hdr := rrset[0].Header()
+		if hdr.Rrtype == dns.TypeRRSIG {
+			continue
+		}
+
+		var verified bool
+		for _, rr := range section {
+			sig, ok := rr.(*dns.RRSIG)
+			if !ok || sig.TypeCovered != hdr.Rrtype || !strings.EqualFold(sig.Hdr.Name, hdr.Name) {
+				continue
+			}
+			for _, key := range keys {
+				if key.(*dns.DNSKEY).KeyTag() == sig.KeyTag && sig.Verify(key.(*dns.DNSKEY), rrset) == nil {
+					verified = true
+				}
+			}
+		}
+		if !verified {
+			t.Errorf("no valid RRSIG for %s %s", hdr.Name, dns.TypeToString[hdr.Rrtype])
+		}
+	}
+}
+
+func countType(section []dns.RR, rrtype uint16) int {
+	var n int
+	for _, rr := range section {
+		if rr.Header().Rrtype == rrtype {
+			n++
+		}
+	}
+	return n
+}
+
+func TestHandleDNSSECSignedAnswers(t *testing.T) {
+	tests := []struct {
+		denial    string
+		qname     string
+		qtype     uint16
+		wantRcode int
+		wantType  uint16 // record type expected in the answer
+		wantProof uint16 // record type expected in the authority section
+	}{
+		{models.DNSSECDenialNSEC, "web.example.lan.", dns.TypeA, dns.RcodeSuccess, dns.TypeA, 0},
+		{models.DNSSECDenialNSEC, "example.lan.", dns.TypeDNSKEY, dns.RcodeSuccess, dns.TypeDNSKEY, 0},
+		{models.DNSSECDenialNSEC, "www.example.lan.", dns.TypeA, dns.RcodeSuccess, dns.TypeA, 0},
+		{models.DNSSECDenialNSEC, "pr-1.apps.example.lan.", dns.TypeA, dns.RcodeSuccess, dns.TypeA, dns.TypeNSEC},
+		{models.DNSSECDenialNSEC, "missing.example.lan.", dns.TypeA, dns.RcodeNameError, 0, dns.TypeNSEC},
+		{models.DNSSECDenialNSEC, "web.example.lan.", dns.TypeTXT, dns.RcodeSuccess, 0, dns.TypeNSEC},
+		{models.DNSSECDenialNSEC, "host.lab.example.lan.", dns.TypeA, dns.RcodeSuccess, 0, dns.TypeNSEC},
+		{models.DNSSECDenialNSEC, "host.secure.example.lan.", dns.TypeA, dns.RcodeSuccess, 0, dns.TypeDS},
+		{models.DNSSECDenialNSEC3, "missing.example.lan.", dns.TypeA, dns.RcodeNameError, 0, dns.TypeNSEC3},
+		{models.DNSSECDenialNSEC3, "pr-1.apps.example.lan.", dns.TypeA, dns.RcodeSuccess, dns.TypeA, dns.TypeNSEC3},
+		{models.DNSSECDenialNSEC3, "example.lan.", dns.TypeNSEC3PARAM, dns.RcodeSuccess, dns.TypeNSEC3PARAM, 0},
+		{models.DNSSECDenialBlackLies, "missing.example.lan.", dns.TypeA, dns.RcodeSuccess, 0, dns.TypeNSEC},
+		{models.DNSSECDenialBlackLies, "pr-1.apps.example.lan.", dns.TypeA, dns.RcodeSuccess, dns.TypeA, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.denial+" "+tt.qname+" "+dns.TypeToString[tt.qtype], func(t *testing.T) {
+			h, keys := newSignedTestHandler(t, tt.denial)
+
+			resp := queryDO(t, h, tt.qname, tt.qtype)
+			if resp.Rcode != tt.wantRcode {
+				t.Errorf("rcode = %s, want %s", dns.RcodeToString[resp.Rcode], dns.RcodeToString[tt.wantRcode])
+			}
+			if opt := resp.IsEdns0(); opt == nil || !opt.Do() {
+				t.Error("expected the DO bit in the response")
+			}
+			if tt.wantType != 0 && countType(resp.Answer, tt.wantType) == 0 {
+				t.Errorf("no %s in answer: %v", dns.TypeToString[tt.wantType], resp.Answer)
+			}
+			if tt.wantProof != 0 && countType(resp.Ns, tt.wantProof) == 0 {
+				t.Errorf("no %s in authority: %v", dns.TypeToString[tt.wantProof], resp.Ns)
+			}
+
+			verifySignatures(t, resp.Answer, keys)
+			if resp.Authoritative {
+				verifySignatures(t, resp.Ns, keys)
+			} else {
+				// The NS RRset of a referral stays unsigned, its DS or NSEC proof is signed
+				var proof []dns.RR
+				for _, rr := range resp.Ns {
+					if rr.Header().Rrtype != dns.TypeNS {
+						proof = append(proof, rr)
+					}
+				}
+				verifySignatures(t, proof, keys)
+			}
+		})
+	}
+}
+
+func TestHandleDNSSECCache(t *testing.T) {
+	h, _ := newSignedTestHandler(t, models.DNSSECDenialNSEC)
+
+	for range 2 {
+		if resp := queryDO(t, h, "web.example.lan.", dns.TypeA); countType(resp.Answer, dns.TypeRRSIG) == 0 {
+			t.Errorf("expected RRSIG for DO query, got %v", resp.Answer)
+		}
+		if resp := query(t, h, "web.example.lan.", dns.TypeA); countType(resp.Answer, dns.TypeRRSIG) != 0 || resp.IsEdns0() != nil {
+			t.Errorf("unexpected DNSSEC records for plain query: %v", resp)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+
+	"github.com/miekg/dns"
+	"github.com/rogerwesterbo/godns/internal/models"
+	"github.com/rogerwesterbo/godns/internal/services/v1dynamicupdateservice"
+	"github.com/vitistack/common/pkg/loggers/vlog"
+)
+
+// handleUpdate applies a DNS UPDATE (RFC 2136) and returns the response code
+// Updates must be signed with a TSIG key that the zone's update policy grants the
+// changed names. The response is signed with the same key.
+func (h *DNSHandler) handleUpdate(ctx context.Context, w dns.ResponseWriter, r *dns.Msg, srcIP netip.Addr) int {
+	m := new(dns.Msg)
+	m.SetReply(r)
+	m.Rcode = h.updateRcode(ctx, w, r, srcIP)
+
+	signResponse(w, r, m)
+	if err := w.WriteMsg(m); err != nil {
+		vlog.Warnf("failed to write UPDATE response: %v", err)
+	}
+	return m.Rcode
+}
+
+// updateRcode checks and applies an update
+func (h *DNSHandler) updateRcode(ctx context.Context, w dns.ResponseWriter, r *dns.Msg, srcIP netip.Addr) int {
+	// The zone section holds exactly one SOA question naming the zone
+	if len(r.Question) != 1 || r.Question[0].Qtype != dns.TypeSOA || r.Question[0].Qclass != dns.ClassINET {
+		return dns.RcodeFormatError
+	}
+	domain := dns.CanonicalName(r.Question[0].Name)
+
+	if h.updateService == nil {
+		return dns.RcodeNotImplemented
+	}
+
+	tsigKey, rcode := h.verifiedTSIGKey(ctx, w, r, domain, models.TSIGOperationUpdate, srcIP)
+	if rcode != dns.RcodeSuccess {
+		return rcode
+	}
+
+	// The update service drops the cached answers of the zone when it changed
+	if _, err := h.updateService.Update(ctx, domain, tsigKey, r.Answer, r.Ns); err != nil {
+		var updateErr *v1dynamicupdateservice.UpdateError
+		if errors.As(err, &updateErr) {
+			vlog.Infof("UPDATE of %s from %s rejected: %v", domain, srcIP, err)
+			return updateErr.Rcode
+		}
+		vlog.Warnf("UPDATE of %s from %s failed: %v", domain, srcIP, err)
+		return dns.RcodeServerFailure
+	}
+	return dns.RcodeSuccess
+}
@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/rogerwesterbo/godns/internal/models"
+	"github.com/rogerwesterbo/godns/internal/services/v1dnsservice"
+	"github.com/rogerwesterbo/godns/internal/services/v1dynamicupdateservice"
+	"github.com/rogerwesterbo/godns/internal/services/v1tsigservice"
+	"github.com/rogerwesterbo/godns/internal/services/v1zoneservice"
+	"github.com/rogerwesterbo/godns/internal/testutil/valkeytest"
+)
+
+func mustRR(t *testing.T, s string) dns.RR {
+	t.Helper()
+	rr, err := dns.NewRR(s)
+	if err != nil {
+		t.Fatalf("failed to parse %q: %v", s, err)
+	}
+	return rr
+}
+
+func TestHandleDynamicUpdate(t *testing.T) {
+	ctx := context.Background()
+	client := valkeytest.NewMemoryValkey()
+	zoneService := v1zoneservice.NewV1ZoneService(client, nil, nil)
+	if err := zoneService.CreateZone(ctx, testZone()); err != nil {
+		t.Fatalf("failed to create zone: %v", err)
+	}
+
+	updateService := v1dynamicupdateservice.NewV1DynamicUpdateService(zoneService)
+	policy := &models.ZoneUpdatePolicy{Grants: []models.UpdateGrant{
+		{TSIGKey: "dhcp-key", Names: []string{"*.dhcp"}, Types: []string{"A", "AAAA"}},
+		{TSIGKey: "acme-key", Names: []string{"_acme-challenge"}, Types: []string{"TXT"}},
+	}}
+	if err := updateService.SetPolicy(ctx, "example.lan.", policy); err != nil {
+		t.Fatalf("failed to set update policy: %v", err)
+	}
+
+	h := NewDNSHandler(DNSHandlerOptions{DNSService: v1dnsservice.NewDNSService(client), UpdateService: updateService})
+
+	update := func(key string, build func(m *dns.Msg)) *dns.Msg {
+		t.Helper()
+		m := new(dns.Msg)
+		m.SetUpdate("example.lan.")
+		build(m)
+		if key != "" {
+			m.SetTsig(key, dns.HmacSHA256, 300, time.Now().Unix())
+		}
+		w := &recordingWriter{}
+		h.HandleDNS(w, m)
+		if w.msg == nil {
+			t.Fatal("no response")
+		}
+		return w.msg
+	}
+
+	tests := []struct {
+		name      string
+		key       string
+		build     func(m *dns.Msg)
+		wantRcode int
+	}{
+		{"unsigned", "", func(m *dns.Msg) {
+			m.Insert([]dns.RR{mustRR(t, "host1.dhcp.example.lan. 300 IN A 192.168.100.50")})
+		}, dns.RcodeRefused},
+		{"add address", "dhcp-key.", func(m *dns.Msg) {
+			m.NameNotUsed([]dns.RR{mustRR(t, "host1.dhcp.example.lan. 0 IN A 0.0.0.0")})
+			m.Insert([]dns.RR{mustRR(t, "host1.dhcp.example.lan. 300 IN A 192.168.100.50")})
+		}, dns.RcodeSuccess},
+		{"name in use", "dhcp-key.", func(m *dns.Msg) {
+			m.NameNotUsed([]dns.RR{mustRR(t, "host1.dhcp.example.lan. 0 IN A 0.0.0.0")})
+			m.Insert([]dns.RR{mustRR(t, "host1.dhcp.example.lan. 300 IN A 192.168.100.51")})
+		}, dns.RcodeYXDomain},
+		{"value prerequisite", "dhcp-key.", func(m *dns.Msg) {
+			m.Used([]dns.RR{mustRR(t, "host1.dhcp.example.lan. 0 IN A 192.168.100.50")})
+			m.RemoveRRset([]dns.RR{mustRR(t, "host1.dhcp.example.lan. 0 IN A 0.0.0.0")})
+			m.Insert([]dns.RR{mustRR(t, "host1.dhcp.example.lan. 300 IN A 192.168.100.52")})
+		}, dns.RcodeSuccess},
+		{"name outside grant", "dhcp-key.", func(m *dns.Msg) {
+			m.Insert([]dns.RR{mustRR(t, "web.example.lan. 300 IN A 192.168.100.99")})
+		}, dns.RcodeRefused},
+		{"type outside grant", "dhcp-key.", func(m *dns.Msg) {
+			m.Insert([]dns.RR{mustRR(t, "host1.dhcp.example.lan. 300 IN TXT \"x\"")})
+		}, dns.RcodeRefused},
+		{"outside zone", "dhcp-key.", func(m *dns.Msg) {
+			m.Insert([]dns.RR{mustRR(t, "host1.dhcp.example.com. 300 IN A 192.168.100.50")})
+		}, dns.RcodeNotZone},
+		{"acme challenge", "acme-key.", func(m *dns.Msg) {
+			m.Insert([]dns.RR{mustRR(t, "_acme-challenge.example.lan. 60 IN TXT \"token\"")})
+		}, dns.RcodeSuccess},
+		{"missing RRset", "acme-key.", func(m *dns.Msg) {
+			m.RRsetUsed([]dns.RR{mustRR(t, "_acme-challenge.example.lan. 0 IN A 0.0.0.0")})
+			m.Remove([]dns.RR{mustRR(t, "_acme-challenge.example.lan. 60 IN TXT \"token\"")})
+		}, dns.RcodeNXRrset},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := update(tt.key, tt.build)
+			if resp.Rcode != tt.wantRcode {
+				t.Errorf("rcode = %s, want %s", dns.RcodeToString[resp.Rcode], dns.RcodeToString[tt.wantRcode])
+			}
+			if resp.Opcode != dns.OpcodeUpdate {
+				t.Errorf("opcode = %s, want UPDATE", dns.OpcodeToString[resp.Opcode])
+			}
+		})
+	}
+
+	resp := query(t, h, "host1.dhcp.example.lan.", dns.TypeA)
+	if len(resp.Answer) != 1 || resp.Answer[0].(*dns.A).A.String() != "192.168.100.52" {
+		t.Errorf("expected the replaced address, got %v", resp.Answer)
+	}
+	resp = query(t, h, "_acme-challenge.example.lan.", dns.TypeTXT)
+	if len(resp.Answer) != 1 {
+		t.Errorf("expected the ACME challenge, got %v", resp.Answer)
+	}
+
+	zone, err := zoneService.GetZone(ctx, "example.lan.")
+	if err != nil {
+		t.Fatalf("failed to get zone: %v", err)
+	}
+	if !models.SerialGreater(zone.SOASerial(), 2024110601) {
+		t.Errorf("SOA serial %d was not bumped", zone.SOASerial())
+	}
+}
+
+func TestDynamicUpdateKeyScope(t *testing.T) {
+	ctx := context.Background()
+	client := valkeytest.NewMemoryValkey()
+	zoneService := v1zoneservice.NewV1ZoneService(client, nil, nil)
+	if err := zoneService.CreateZone(ctx, testZone()); err != nil {
+		t.Fatalf("failed to create zone: %v", err)
+	}
+
+	tsigService := v1tsigservice.NewV1TSIGService(client, nil)
+	keys := []*models.TSIGKey{
+		{Name: "update-key", Zones: []string{"example.lan"}, Operations: []string{"update"}},
+		{Name: "transfer-key", Operations: []string{"transfer"}},
+		{Name: "other-zone-key", Zones: []string{"example.com"}},
+	}
+	updateService := v1dynamicupdateservice.NewV1DynamicUpdateService(zoneService)
+	policy := &models.ZoneUpdatePolicy{}
+	for _, key := range keys {
+		if err := tsigService.CreateKey(ctx, key); err != nil {
+			t.Fatalf("failed to create TSIG key: %v", err)
+		}
+		policy.Grants = append(policy.Grants, models.UpdateGrant{TSIGKey: key.Name, Names: []string{"*"}})
+	}
+	if err := updateService.SetPolicy(ctx, "example.lan.", policy); err != nil {
+		t.Fatalf("failed to set update policy: %v", err)
+	}
+
+	h := NewDNSHandler(DNSHandlerOptions{DNSService: v1dnsservice.NewDNSService(client), UpdateService: updateService, TSIGService: tsigService})
+
+	tests := []struct {
+		key       string
+		wantRcode int
+	}{
+		{"update-key.", dns.RcodeSuccess},
+		{"transfer-key.", dns.RcodeRefused},
+		{"other-zone-key.", dns.RcodeRefused},
+		{"revoked-key.", dns.RcodeRefused},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			m := new(dns.Msg)
+			m.SetUpdate("example.lan.")
+			m.Insert([]dns.RR{mustRR(t, "host.example.lan. 300 IN A 192.168.100.60")})
+			m.SetTsig(tt.key, dns.HmacSHA256, 300, time.Now().Unix())
+
+			w := &recordingWriter{}
+			h.HandleDNS(w, m)
+			if w.msg == nil {
+				t.Fatal("no response")
+			}
+			if w.msg.Rcode != tt.wantRcode {
+				t.Errorf("rcode = %s, want %s", dns.RcodeToString[w.msg.Rcode], dns.RcodeToString[tt.wantRcode])
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"net"
+
+	"github.com/miekg/dns"
+	"github.com/rogerwesterbo/godns/pkg/consts"
+	"github.com/spf13/viper"
+)
+
+// defaultUDPSize is the EDNS0 payload size advertised to clients when DNS_EDNS_UDP_SIZE isn't
+// set, small enough to avoid IP fragmentation (DNS flag day 2020)
+const defaultUDPSize = 1232
+
+// tsigMACReserve is the room kept for the MAC of a TSIG record, which is only computed when the
+// response is packed; HMAC-SHA512 is the longest at 64 bytes
+const tsigMACReserve = 64
+
+// ednsWriter writes the responses to a query with EDNS0 (RFC 6891): responses to a query with an
+// OPT record carry our own, with our payload size and the DO bit of the query, and responses
+// over UDP are truncated to the payload size of the client, 512 bytes without EDNS0.
+type ednsWriter struct {
+	dns.ResponseWriter
+	opt     *dns.OPT // OPT record of the query, nil without EDNS0
+	udpSize uint16   // payload size we advertise
+}
+
+func newEDNSWriter(w dns.ResponseWriter, r *dns.Msg) *ednsWriter {
+	udpSize := viper.GetInt(consts.DNS_EDNS_UDP_SIZE)
+	if udpSize < dns.MinMsgSize || udpSize > dns.MaxMsgSize {
+		udpSize = defaultUDPSize
+	}
+	return &ednsWriter{ResponseWriter: w, opt: r.IsEdns0(), udpSize: uint16(udpSize)}
+}
+
+func (w *ednsWriter) WriteMsg(m *dns.Msg) error {
+	setEDNS(m, w.opt, w.udpSize)
+	if _, ok := w.RemoteAddr().(*net.UDPAddr); ok {
+		truncate(m, w.maxUDPSize())
+	}
+	return w.ResponseWriter.WriteMsg(m)
+}
+
+// maxUDPSize returns the largest response the client can receive over UDP: the smaller of its
+// payload size and ours, at least 512 bytes
+func (w *ednsWriter) maxUDPSize() int {
+	if w.opt == nil {
+		return dns.MinMsgSize
+	}
+	return max(int(min(w.opt.UDPSize(), w.udpSize)), dns.MinMsgSize)
+}
+
+// ednsRcode checks the OPT record of a query: a query with several is malformed and one with an
+// EDNS version other than 0 is answered with BADVERS (RFC 6891 section 6.1.3)
+func ednsRcode(r *dns.Msg) int {
+	var opts []*dns.OPT
+	for _, rr := range r.Extra {
+		if opt, ok := rr.(*dns.OPT); ok {
+			opts = append(opts, opt)
+		}
+	}
+	switch {
+	case len(opts) > 1:
+		return dns.RcodeFormatError
+	case len(opts) == 1 && opts[0].Version() != 0:
+		return dns.RcodeBadVers
+	}
+	return dns.RcodeSuccess
+}
+
+// setEDNS replaces the OPT record of a response, which may come from an upstream or the cache,
+// with ours when the query had one and removes it otherwise. Options are hop-by-hop, so only
+// Extended DNS Errors (RFC 8914) are kept; transports add their own options when writing.
+func setEDNS(m *dns.Msg, queryOpt *dns.OPT, udpSize uint16) {
+	var options []dns.EDNS0
+	extra := make([]dns.RR, 0, len(m.Extra)+1)
+	for _, rr := range m.Extra {
+		opt, ok := rr.(*dns.OPT)
+		if !ok {
+			extra = append(extra, rr)
+			continue
+		}
+		for _, o := range opt.Option {
+			if o.Option() == dns.EDNS0EDE {
+				options = append(options, o)
+			}
+		}
+	}
+
+	if queryOpt == nil {
+		// Extended response codes need an OPT record
+		if m.Rcode > 0xF {
+			m.Rcode = dns.RcodeServerFailure
+		}
+		m.Extra = extra
+		return
+	}
+
+	opt := &dns.OPT{Hdr: dns.RR_Header{Name: ".", Rrtype: dns.TypeOPT}, Option: options}
+	opt.SetUDPSize(udpSize)
+	opt.SetDo(queryOpt.Do())
+
+	// The TSIG record stays last (RFC 8945 section 5.3)
+	if n := len(extra); n > 0 && extra[n-1].Header().Rrtype == dns.TypeTSIG {
+		m.Extra = append(extra[:n-1:n-1], opt, extra[n-1])
+		return
+	}
+	m.Extra = append(extra, opt)
+}
+
+// truncate fits a response in size bytes, setting the TC bit when records are left out so the
+// client retries over TCP. Room is kept for the MAC of a TSIG record, which stays in the response.
+func truncate(m *dns.Msg, size int) {
+	tsig := m.IsTsig()
+	if tsig == nil {
+		m.Truncate(size)
+		return
+	}
+	m.Extra = m.Extra[:len(m.Extra)-1]
+	m.Truncate(size - dns.Len(tsig) - tsigMACReserve)
+	m.Extra = append(m.Extra, tsig)
+}
@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/rogerwesterbo/godns/internal/models"
+)
+
+// ednsTestHandler serves a zone with a TXT RRset of about 2000 bytes at big.example.lan.
+func ednsTestHandler(t *testing.T) *DNSHandler {
+	t.Helper()
+
+	zone := testZone()
+	for i := range 8 {
+		zone.Records = append(zone.Records, models.NewTXTRecord("big.example.lan.", fmt.Sprintf("%d-%s", i, strings.Repeat("x", 240)), 300))
+	}
+	return newTestHandler(t, zone)
+}
+
+func TestHandleDNSEDNS(t *testing.T) {
+	h := ednsTestHandler(t)
+
+	tests := []struct {
+		name        string
+		qname       string
+		udpSize     uint16 // 0 for a query without EDNS0
+		do          bool
+		version     uint8
+		tcp         bool
+		wantRcode   int
+		wantOPT     bool
+		wantTC      bool
+		wantMaxSize int
+	}{
+		{name: "small answer without EDNS0", qname: "web.example.lan.", wantMaxSize: 512},
+		{name: "large answer without EDNS0 is truncated to 512 bytes", qname: "big.example.lan.", wantTC: true, wantMaxSize: 512},
+		{name: "large answer over TCP is whole", qname: "big.example.lan.", tcp: true},
+		{name: "OPT record is echoed with the DO bit", qname: "web.example.lan.", udpSize: 4096, do: true, wantOPT: true},
+		{name: "payload size of 4096 is capped to ours", qname: "big.example.lan.", udpSize: 4096, wantOPT: true, wantTC: true, wantMaxSize: defaultUDPSize},
+		{name: "payload sizes below 512 count as 512", qname: "big.example.lan.", udpSize: 100, wantOPT: true, wantTC: true, wantMaxSize: 512},
+		{name: "unsupported EDNS version", qname: "web.example.lan.", udpSize: 1232, version: 1, wantRcode: dns.RcodeBadVers, wantOPT: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := new(dns.Msg)
+			req.SetQuestion(tt.qname, dns.TypeTXT)
+			if tt.udpSize > 0 {
+				req.SetEdns0(tt.udpSize, tt.do)
+				req.IsEdns0().SetVersion(tt.version)
+			}
+
+			w := &recordingWriter{tcp: tt.tcp}
+			h.HandleDNS(w, req)
+			if w.msg == nil {
+				t.Fatal("no response")
+			}
+
+			// Pack and unpack the response like a client receives it
+			packed, err := w.msg.Pack()
+			if err != nil {
+				t.Fatalf("failed to pack response: %v", err)
+			}
+			resp := new(dns.Msg)
+			if err := resp.Unpack(packed); err != nil {
+				t.Fatalf("failed to unpack response: %v", err)
+			}
+
+			if resp.Rcode != tt.wantRcode {
+				t.Errorf("rcode = %s, want %s", dns.RcodeToString[resp.Rcode], dns.RcodeToString[tt.wantRcode])
+			}
+			if resp.Truncated != tt.wantTC {
+				t.Errorf("TC = %v, want %v", resp.Truncated, tt.wantTC)
+			}
+			if tt.wantMaxSize > 0 && len(packed) > tt.wantMaxSize {
+				t.Errorf("response is %d bytes, want at most %d", len(packed), tt.wantMaxSize)
+			}
+			if tt.tcp && len(packed) <= defaultUDPSize {
+				t.Errorf("response over TCP is %d bytes, want the whole answer", len(packed))
+			}
+
+			opt := resp.IsEdns0()
+			if (opt != nil) != tt.wantOPT {
+				t.Fatalf("OPT record = %v, want %v", opt, tt.wantOPT)
+			}
+			if opt != nil {
+				if opt.UDPSize() != defaultUDPSize || opt.Version() != 0 || opt.Do() != tt.do {
+					t.Errorf("OPT = %v, want payload size %d, version 0 and DO %v", opt, defaultUDPSize, tt.do)
+				}
+			}
+		})
+	}
+}
+
+func TestHandleDNSMultipleOPT(t *testing.T) {
+	h := newTestHandler(t, testZone())
+
+	req := new(dns.Msg)
+	req.SetQuestion("web.example.lan.", dns.TypeA)
+	req.SetEdns0(1232, false)
+	req.Extra = append(req.Extra, req.Extra[0])
+
+	w := &recordingWriter{}
+	h.HandleDNS(w, req)
+	if w.msg == nil || w.msg.Rcode != dns.RcodeFormatError {
+		t.Fatalf("got %v, want FORMERR", w.msg)
+	}
+}
+
+func TestSetEDNS(t *testing.T) {
+	upstreamResponse := func() *dns.Msg {
+		m := new(dns.Msg)
+		m.SetQuestion("example.com.", dns.TypeA)
+		m.SetEdns0(4096, true)
+		opt := m.IsEdns0()
+		opt.Option = append(opt.Option,
+			&dns.EDNS0_COOKIE{Code: dns.EDNS0COOKIE, Cookie: "0102030405060708"},
+			&dns.EDNS0_EDE{InfoCode: dns.ExtendedErrorCodeStaleAnswer},
+			&dns.EDNS0_LOCAL{Code: 65001, Data: []byte{1}})
+		return m
+	}
+
+	t.Run("options other than EDE are stripped", func(t *testing.T) {
+		m := upstreamResponse()
+		queryOpt := &dns.OPT{Hdr: dns.RR_Header{Name: ".", Rrtype: dns.TypeOPT}}
+		queryOpt.SetUDPSize(512)
+		setEDNS(m, queryOpt, defaultUDPSize)
+
+		opt := m.IsEdns0()
+		if opt == nil || opt.UDPSize() != defaultUDPSize || opt.Do() {
+			t.Fatalf("OPT = %v, want payload size %d without DO", opt, defaultUDPSize)
+		}
+		if len(opt.Option) != 1 || opt.Option[0].Option() != dns.EDNS0EDE {
+			t.Errorf("options = %v, want only the EDE", opt.Option)
+		}
+	})
+
+	t.Run("OPT record is removed for clients without EDNS0", func(t *testing.T) {
+		m := upstreamResponse()
+		m.Rcode = dns.RcodeBadCookie
+		setEDNS(m, nil, defaultUDPSize)
+		if m.IsEdns0() != nil {
+			t.Error("expected no OPT record")
+		}
+		if m.Rcode != dns.RcodeServerFailure {
+			t.Errorf("rcode = %s, want SERVFAIL", dns.RcodeToString[m.Rcode])
+		}
+	})
+
+	t.Run("TSIG stays last", func(t *testing.T) {
+		m := new(dns.Msg)
+		m.SetQuestion("example.com.", dns.TypeA)
+		m.SetTsig("key.", dns.HmacSHA256, 300, 0)
+		queryOpt := &dns.OPT{Hdr: dns.RR_Header{Name: ".", Rrtype: dns.TypeOPT}}
+		setEDNS(m, queryOpt, defaultUDPSize)
+
+		if len(m.Extra) != 2 || m.Extra[0].Header().Rrtype != dns.TypeOPT || m.IsTsig() == nil {
+			t.Errorf("additional section = %v, want the OPT then the TSIG record", m.Extra)
+		}
+	})
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"context"
+	"net/netip"
+
+	"github.com/miekg/dns"
+	"github.com/rogerwesterbo/godns/internal/models"
+	"github.com/vitistack/common/pkg/loggers/vlog"
+)
+
+// handleNotify answers a NOTIFY (RFC 1996) for a secondary zone and returns the response code
+// NOTIFY is only accepted from one of the zone's primaries. The zone is refreshed
+// in the background, the primary gets its acknowledgement right away. A signed
+// NOTIFY must verify with a key allowed to notify the zone.
+func (h *DNSHandler) handleNotify(ctx context.Context, w dns.ResponseWriter, r *dns.Msg, m *dns.Msg, srcIP netip.Addr) int {
+	m.Rcode = h.notifyRcode(ctx, w, r, srcIP)
+	if m.Rcode == dns.RcodeSuccess {
+		m.Authoritative = true
+	}
+	signResponse(w, r, m)
+
+	if err := w.WriteMsg(m); err != nil {
+		vlog.Warnf("failed to write NOTIFY response: %v", err)
+	}
+	return m.Rcode
+}
+
+// notifyRcode checks a NOTIFY and triggers the refresh of the zone
+func (h *DNSHandler) notifyRcode(ctx context.Context, w dns.ResponseWriter, r *dns.Msg, srcIP netip.Addr) int {
+	if len(r.Question) != 1 || r.Question[0].Qtype != dns.TypeSOA {
+		return dns.RcodeFormatError
+	}
+	domain := dns.CanonicalName(r.Question[0].Name)
+
+	if _, rcode := h.verifiedTSIGKey(ctx, w, r, domain, models.TSIGOperationNotify, srcIP); rcode != dns.RcodeSuccess {
+		return rcode
+	}
+
+	if h.secondaryService == nil || !h.secondaryService.IsPrimary(ctx, domain, srcIP) {
+		vlog.Infof("NOTIFY for %s from %s refused: not a primary of the zone", domain, srcIP)
+		return dns.RcodeRefused
+	}
+
+	vlog.Infof("NOTIFY for %s from %s, refreshing zone", domain, srcIP)
+	h.secondaryService.Trigger(domain)
+	return dns.RcodeSuccess
+}
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/rogerwesterbo/godns/internal/models"
+	"github.com/rogerwesterbo/godns/internal/services/v1dnsservice"
+	"github.com/rogerwesterbo/godns/internal/services/v1secondaryservice"
+	"github.com/rogerwesterbo/godns/internal/services/v1zoneservice"
+	"github.com/rogerwesterbo/godns/internal/testutil/valkeytest"
+)
+
+func TestHandleNotify(t *testing.T) {
+	client := valkeytest.NewMemoryValkey()
+	zoneService := v1zoneservice.NewV1ZoneService(client, nil, nil)
+	ctx := context.Background()
+
+	zones := []*models.DNSZone{
+		{Domain: "secondary.lan.", Kind: models.ZoneKindSecondary, Primaries: []string{"127.0.0.1"}, Enabled: true},
+		{Domain: "other.lan.", Kind: models.ZoneKindSecondary, Primaries: []string{"192.0.2.1:5353"}, Enabled: true},
+		testZone(),
+	}
+	for _, zone := range zones {
+		if err := zoneService.CreateZone(ctx, zone); err != nil {
+			t.Fatalf("failed to create zone %s: %v", zone.Domain, err)
+		}
+	}
+
+	// The service is not started, so triggered refreshes stay queued
+	secondaryService := v1secondaryservice.NewSecondaryService(zoneService, time.Second, time.Minute)
+	h := NewDNSHandler(DNSHandlerOptions{DNSService: v1dnsservice.NewDNSService(client), SecondaryService: secondaryService})
+
+	tests := []struct {
+		name      string
+		zone      string
+		qtype     uint16
+		wantRcode int
+	}{
+		{"from primary", "secondary.lan.", dns.TypeSOA, dns.RcodeSuccess},
+		{"not from primary", "other.lan.", dns.TypeSOA, dns.RcodeRefused},
+		{"primary zone", "example.lan.", dns.TypeSOA, dns.RcodeRefused},
+		{"unknown zone", "unknown.lan.", dns.TypeSOA, dns.RcodeRefused},
+		{"wrong type", "secondary.lan.", dns.TypeA, dns.RcodeFormatError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := new(dns.Msg)
+			req.SetNotify(tt.zone)
+			req.Question[0].Qtype = tt.qtype
+
+			w := &recordingWriter{}
+			h.HandleDNS(w, req)
+			if w.msg == nil {
+				t.Fatal("no response")
+			}
+			if w.msg.Opcode != dns.OpcodeNotify || !w.msg.Response {
+				t.Errorf("response opcode = %s, response = %v", dns.OpcodeToString[w.msg.Opcode], w.msg.Response)
+			}
+			if w.msg.Rcode != tt.wantRcode {
+				t.Errorf("rcode = %s, want %s", dns.RcodeToString[w.msg.Rcode], dns.RcodeToString[tt.wantRcode])
+			}
+			if tt.wantRcode == dns.RcodeSuccess && !w.msg.Authoritative {
+				t.Error("expected AA bit on NOTIFY response")
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"net"
+
+	"github.com/miekg/dns"
+)
+
+// Transports queries arrive over, used to label query logs and metrics
+const (
+	TransportUDP   = "udp"
+	TransportTCP   = "tcp"
+	TransportTLS   = "tls"   // DNS over TLS (RFC 7858)
+	TransportHTTPS = "https" // DNS over HTTPS (RFC 8484)
+	TransportQUIC  = "quic"  // DNS over QUIC (RFC 9250)
+)
+
+// TransportWriter is a response writer that knows the transport of the query
+// Transports that can't be told apart by the client address, like DNS over TLS,
+// which is TCP underneath, wrap the writer of their server with it or implement it.
+type TransportWriter interface {
+	dns.ResponseWriter
+	Transport() string
+}
+
+// transportOf returns the transport a query arrived over
+func transportOf(w dns.ResponseWriter) string {
+	if tw, ok := w.(TransportWriter); ok {
+		return tw.Transport()
+	}
+	if _, ok := w.RemoteAddr().(*net.UDPAddr); ok {
+		return TransportUDP
+	}
+	return TransportTCP
+}
+
+// ClientIDWriter is a response writer that knows the identifier the client sent with the
+// query, like the path of DNS over HTTPS queries to /dns-query/{client-id}. Client
+// identifiers select the client group of clients whose address doesn't tell them apart.
+type ClientIDWriter interface {
+	dns.ResponseWriter
+	ClientID() string
+}
+
+// clientIDOf returns the client identifier of a query, or ""
+func clientIDOf(w dns.ResponseWriter) string {
+	if cw, ok := w.(ClientIDWriter); ok {
+		return cw.ClientID()
+	}
+	return ""
+}
@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"context"
+	"net/netip"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/vitistack/common/pkg/loggers/vlog"
+)
+
+// verifiedTSIGKey returns the name of the TSIG key that signed a message for an operation on a zone
+// An unsigned message has no key. A message whose signature failed verification is
+// answered with NOTAUTH and one signed with a key not scoped to the operation on the
+// zone with REFUSED; otherwise the returned rcode is NOERROR.
+func (h *DNSHandler) verifiedTSIGKey(ctx context.Context, w dns.ResponseWriter, r *dns.Msg, domain, operation string, srcIP netip.Addr) (string, int) {
+	tsig := r.IsTsig()
+	if tsig == nil {
+		return "", dns.RcodeSuccess
+	}
+
+	// A message with a TSIG record that failed verification must not be treated as unsigned
+	if err := w.TsigStatus(); err != nil {
+		vlog.Warnf("%s of %s from %s: TSIG verification failed: %v", operation, domain, srcIP, err)
+		return "", dns.RcodeNotAuth
+	}
+
+	if h.tsigService != nil && !h.tsigService.Permits(ctx, tsig.Hdr.Name, domain, operation) {
+		vlog.Warnf("%s of %s from %s: TSIG key %s is not allowed for this zone or operation", operation, domain, srcIP, tsig.Hdr.Name)
+		return "", dns.RcodeRefused
+	}
+
+	return tsig.Hdr.Name, dns.RcodeSuccess
+}
+
+// signResponse signs a response with the key of the request once the request's signature verified
+func signResponse(w dns.ResponseWriter, r, m *dns.Msg) {
+	if tsig := r.IsTsig(); tsig != nil && w.TsigStatus() == nil {
+		m.SetTsig(tsig.Hdr.Name, tsig.Algorithm, tsig.Fudge, time.Now().Unix())
+	}
+}
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"strings"
+
+	"github.com/miekg/dns"
+	"github.com/rogerwesterbo/godns/internal/models"
+	"github.com/vitistack/common/pkg/loggers/vlog"
+)
+
+// transferChunkSize is the number of resource records sent per zone transfer message
+const transferChunkSize = 100
+
+// isTransfer reports whether a query asks for a zone transfer
+func isTransfer(r *dns.Msg) bool {
+	if len(r.Question) != 1 {
+		return false
+	}
+	qtype := r.Question[0].Qtype
+	return qtype == dns.TypeAXFR || qtype == dns.TypeIXFR
+}
+
+// handleTransfer answers AXFR and IXFR queries and returns the response code
+// Transfers are only allowed for clients in the zone's transfer ACL. Over UDP, AXFR is
+// refused and IXFR is answered with the current SOA so the secondary retries over TCP.
+func (h *DNSHandler) handleTransfer(ctx context.Context, w dns.ResponseWriter, r *dns.Msg, srcIP netip.Addr) int {
+	q := r.Question[0]
+	domain := dns.CanonicalName(q.Name)
+
+	if h.transferService == nil {
+		return h.writeTransferError(w, r, dns.RcodeRefused)
+	}
+
+	tsigKey, rcode := h.verifiedTSIGKey(ctx, w, r, domain, models.TSIGOperationTransfer, srcIP)
+	if rcode != dns.RcodeSuccess {
+		return h.writeTransferError(w, r, rcode)
+	}
+
+	if !h.transferService.IsAllowed(ctx, domain, srcIP, tsigKey) {
+		vlog.Infof("zone transfer of %s refused for %s", domain, srcIP)
+		return h.writeTransferError(w, r, dns.RcodeRefused)
+	}
+
+	_, isUDP := w.RemoteAddr().(*net.UDPAddr)
+
+	var rrs []dns.RR
+	var err error
+	switch q.Qtype {
+	case dns.TypeAXFR:
+		if isUDP {
+			return h.writeTransferError(w, r, dns.RcodeNotImplemented)
+		}
+		rrs, err = h.transferService.AXFR(ctx, domain)
+	case dns.TypeIXFR:
+		clientSOA, ok := ixfrClientSOA(r)
+		if !ok {
+			return h.writeTransferError(w, r, dns.RcodeFormatError)
+		}
+		rrs, err = h.transferService.IXFR(ctx, domain, clientSOA.Serial)
+		if err == nil && isUDP {
+			// Only the current SOA fits reliably, the secondary then retries over TCP
+			rrs = rrs[:1]
+		}
+	}
+	if err != nil {
+		vlog.Warnf("zone transfer of %s for %s failed: %v", domain, srcIP, err)
+		if strings.Contains(err.Error(), "not found") || strings.Contains(err.Error(), "disabled") {
+			return h.writeTransferError(w, r, dns.RcodeNotAuth)
+		}
+		return h.writeTransferError(w, r, dns.RcodeServerFailure)
+	}
+
+	ch := make(chan *dns.Envelope, len(rrs)/transferChunkSize+1)
+	for start := 0; start < len(rrs); start += transferChunkSize {
+		end := min(start+transferChunkSize, len(rrs))
+		ch <- &dns.Envelope{RR: rrs[start:end]}
+	}
+	close(ch)
+
+	tr := new(dns.Transfer)
+	if err := tr.Out(w, r, ch); err != nil {
+		vlog.Warnf("failed to send zone transfer of %s to %s: %v", domain, srcIP, err)
+		return dns.RcodeServerFailure
+	}
+
+	vlog.Infof("sent %s of %s to %s (%d records)", dns.TypeToString[q.Qtype], domain, srcIP, len(rrs))
+	return dns.RcodeSuccess
+}
+
+// writeTransferError answers a transfer request with an error code
+func (h *DNSHandler) writeTransferError(w dns.ResponseWriter, r *dns.Msg, rcode int) int {
+	m := new(dns.Msg)
+	m.SetRcode(r, rcode)
+	signResponse(w, r, m)
+	if err := w.WriteMsg(m); err != nil {
+		vlog.Warnf("failed to write zone transfer response: %v", err)
+	}
+	return rcode
+}
+
+// ixfrClientSOA returns the secondary's SOA from the authority section of an IXFR query
+func ixfrClientSOA(r *dns.Msg) (*dns.SOA, bool) {
+	for _, rr := range r.Ns {
+		if soa, ok := rr.(*dns.SOA); ok {
+			return soa, true
+		}
+	}
+	return nil, false
+}
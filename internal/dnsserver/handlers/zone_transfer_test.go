@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/rogerwesterbo/godns/internal/models"
+	"github.com/rogerwesterbo/godns/internal/services/v1dnsservice"
+	"github.com/rogerwesterbo/godns/internal/services/v1zoneservice"
+	"github.com/rogerwesterbo/godns/internal/services/v1zonetransferservice"
+	"github.com/rogerwesterbo/godns/internal/testutil/valkeytest"
+)
+
+// transfer sends a zone transfer request and returns all response messages
+func transfer(t *testing.T, h *DNSHandler, req *dns.Msg, tcp bool) []*dns.Msg {
+	t.Helper()
+
+	w := &recordingWriter{tcp: tcp}
+	h.HandleDNS(w, req)
+	if len(w.msgs) == 0 {
+		t.Fatal("no response for zone transfer")
+	}
+	return w.msgs
+}
+
+// transferRRs flattens the answers of a zone transfer
+func transferRRs(msgs []*dns.Msg) []dns.RR {
+	var rrs []dns.RR
+	for _, m := range msgs {
+		rrs = append(rrs, m.Answer...)
+	}
+	return rrs
+}
+
+func TestHandleZoneTransfer(t *testing.T) {
+	ctx := context.Background()
+	client := valkeytest.NewMemoryValkey()
+	zoneService := v1zoneservice.NewV1ZoneService(client, nil, nil)
+	transferService := v1zonetransferservice.NewV1ZoneTransferService(zoneService)
+	h := NewDNSHandler(DNSHandlerOptions{DNSService: v1dnsservice.NewDNSService(client), TransferService: transferService})
+
+	if err := zoneService.CreateZone(ctx, testZone()); err != nil {
+		t.Fatalf("failed to create zone: %v", err)
+	}
+
+	axfr := new(dns.Msg)
+	axfr.SetAxfr("example.lan.")
+
+	// Zones without an ACL cannot be transferred
+	if resp := transfer(t, h, axfr, true); resp[0].Rcode != dns.RcodeRefused {
+		t.Fatalf("rcode without ACL = %s, want REFUSED", dns.RcodeToString[resp[0].Rcode])
+	}
+
+	acl := &models.ZoneTransferACL{AllowPrefixes: []string{"127.0.0.1"}}
+	if err := transferService.SetACL(ctx, "example.lan.", acl); err != nil {
+		t.Fatalf("SetACL() error = %v", err)
+	}
+
+	t.Run("AXFR over UDP", func(t *testing.T) {
+		if resp := transfer(t, h, axfr, false); resp[0].Rcode != dns.RcodeNotImplemented {
+			t.Errorf("rcode = %s, want NOTIMP", dns.RcodeToString[resp[0].Rcode])
+		}
+	})
+
+	t.Run("AXFR", func(t *testing.T) {
+		rrs := transferRRs(transfer(t, h, axfr, true))
+		// SOA, the zone without its SOA and the ALIAS record, SOA
+		want := len(testZone().Records) - 2 + 2
+		if len(rrs) != want {
+			t.Fatalf("got %d records, want %d: %v", len(rrs), want, rrs)
+		}
+		if rrs[0].Header().Rrtype != dns.TypeSOA || rrs[len(rrs)-1].Header().Rrtype != dns.TypeSOA {
+			t.Errorf("transfer must start and end with the SOA: %v", rrs)
+		}
+	})
+
+	// Change the zone with a new serial so the journal has an entry
+	zone, err := zoneService.GetZone(ctx, "example.lan.")
+	if err != nil {
+		t.Fatalf("GetZone() error = %v", err)
+	}
+	for i := range zone.Records {
+		if zone.Records[i].Type == "SOA" {
+			zone.Records[i] = models.NewSOARecord("example.lan.", "ns1.example.lan.", "hostmaster.example.lan.", 2024110602, 3600, 1800, 604800, 60, 3600)
+		}
+	}
+	zone.Records = append(zone.Records, models.NewARecord("new.example.lan.", "192.168.100.30", 300))
+	if err := zoneService.UpdateZone(ctx, "example.lan.", zone); err != nil {
+		t.Fatalf("UpdateZone() error = %v", err)
+	}
+
+	ixfr := func(serial uint32) *dns.Msg {
+		req := new(dns.Msg)
+		req.SetIxfr("example.lan.", serial, "ns1.example.lan.", "hostmaster.example.lan.")
+		return req
+	}
+
+	t.Run("IXFR up to date", func(t *testing.T) {
+		rrs := transferRRs(transfer(t, h, ixfr(2024110602), true))
+		if len(rrs) != 1 || rrs[0].(*dns.SOA).Serial != 2024110602 {
+			t.Errorf("expected the current SOA only, got %v", rrs)
+		}
+	})
+
+	t.Run("IXFR from journal", func(t *testing.T) {
+		rrs := transferRRs(transfer(t, h, ixfr(2024110601), true))
+		// current SOA, old SOA, new SOA, added A record, current SOA
+		if len(rrs) != 5 {
+			t.Fatalf("got %d records, want 5: %v", len(rrs), rrs)
+		}
+		if rrs[1].(*dns.SOA).Serial != 2024110601 || rrs[2].(*dns.SOA).Serial != 2024110602 {
+			t.Errorf("unexpected difference sequence: %v", rrs)
+		}
+		if rrs[3].Header().Name != "new.example.lan." {
+			t.Errorf("expected added record new.example.lan., got %v", rrs[3])
+		}
+	})
+
+	t.Run("IXFR unknown serial falls back to AXFR", func(t *testing.T) {
+		rrs := transferRRs(transfer(t, h, ixfr(2023010101), true))
+		if len(rrs) != len(zone.Records)-2+2 {
+			t.Errorf("expected full zone, got %d records", len(rrs))
+		}
+	})
+
+	t.Run("IXFR newer serial gets the current SOA", func(t *testing.T) {
+		rrs := transferRRs(transfer(t, h, ixfr(2024110603), true))
+		if len(rrs) != 1 || rrs[0].(*dns.SOA).Serial != 2024110602 {
+			t.Errorf("expected the current SOA only, got %v", rrs)
+		}
+	})
+
+	t.Run("IXFR over UDP", func(t *testing.T) {
+		rrs := transferRRs(transfer(t, h, ixfr(2024110601), false))
+		if len(rrs) != 1 || rrs[0].Header().Rrtype != dns.TypeSOA {
+			t.Errorf("expected the current SOA only, got %v", rrs)
+		}
+	})
+}
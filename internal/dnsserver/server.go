@@ -1,6 +1,10 @@
 package dnsserver
 
 import (
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"net/netip"
 	"os"
 	"os/signal"
 	"time"
@@ -11,22 +15,130 @@ import (
 	"github.com/vitistack/common/pkg/loggers/vlog"
 )
 
-// Server represents the DNS server with both UDP and TCP listeners
+// Server represents the DNS server with UDP and TCP listeners, and DNS over TLS,
+// DNS over HTTPS and DNS over QUIC listeners when configured
 type Server struct {
 	udpServer    *dns.Server
 	tcpServer    *dns.Server
+	tlsServer    *dns.Server
+	dohServer    *http.Server
+	doqServer    *quicServer
+	certificates *CertificateReloader
 	healthServer *healthserver.Server
 	dnsHandler   *handlers.DNSHandler
 }
 
-// New creates a new DNS server instance
-func New(addr, livenessProbePort, readinessProbePort string, dnsHandler *handlers.DNSHandler) *Server {
-	return &Server{
-		udpServer:    &dns.Server{Addr: addr, Net: "udp"},
-		tcpServer:    &dns.Server{Addr: addr, Net: "tcp"},
-		healthServer: healthserver.New(livenessProbePort, readinessProbePort),
+// Options configures the listeners of a DNS server
+type Options struct {
+	// Addr is the address of the UDP and TCP listeners
+	Addr               string
+	LivenessProbePort  string
+	ReadinessProbePort string
+	// TSIGProvider looks up TSIG keys by name; signed messages are verified with it
+	// and responses to signed messages are signed. It replaces a static TsigSecret map
+	// so keys can be created, rotated and revoked while the server runs.
+	TSIGProvider dns.TsigProvider
+	// TCPIdleTimeout closes TCP, TLS and QUIC connections without a query for that long;
+	// until then they serve any number of pipelined queries (RFC 7766)
+	TCPIdleTimeout time.Duration
+	// Certificates are served by the DNS over TLS, DNS over QUIC and DNS over HTTPS listeners
+	Certificates *CertificateReloader
+	// TLSAddr is the address of the DNS over TLS listener (RFC 7858), only started with certificates
+	TLSAddr string
+	// DoQAddr is the address of the DNS over QUIC listener (RFC 9250), only started with certificates
+	DoQAddr string
+	// DoHAddr is the address of the DNS over HTTPS listener (RFC 8484). It serves HTTPS
+	// with certificates, and plain HTTP without them for a proxy that terminates TLS.
+	DoHAddr string
+	// DoHTrustedProxies are the proxies whose requests carry the client address in X-Forwarded-For
+	DoHTrustedProxies []netip.Prefix
+}
+
+// New creates a new DNS server instance serving dnsHandler on the listeners in opts
+// An empty address disables a listener.
+func New(dnsHandler *handlers.DNSHandler, opts Options) *Server {
+	idleTimeout := func() time.Duration { return opts.TCPIdleTimeout }
+
+	s := &Server{
+		udpServer: &dns.Server{
+			Addr:          opts.Addr,
+			Net:           "udp",
+			Handler:       dns.HandlerFunc(dnsHandler.HandleDNS),
+			TsigProvider:  opts.TSIGProvider,
+			MsgAcceptFunc: acceptMsg,
+			UDPSize:       dns.DefaultMsgSize, // queries over 512 bytes, like signed updates, are read whole
+		},
+		tcpServer: &dns.Server{
+			Addr:          opts.Addr,
+			Net:           "tcp",
+			Handler:       streamHandler(dns.HandlerFunc(dnsHandler.HandleDNS), handlers.TransportTCP, opts.TCPIdleTimeout),
+			TsigProvider:  opts.TSIGProvider,
+			MsgAcceptFunc: acceptMsg,
+			IdleTimeout:   idleTimeout,
+			MaxTCPQueries: -1,
+		},
+		certificates: opts.Certificates,
+		healthServer: healthserver.New(opts.LivenessProbePort, opts.ReadinessProbePort),
 		dnsHandler:   dnsHandler,
 	}
+
+	if opts.TLSAddr != "" && opts.Certificates != nil {
+		s.tlsServer = &dns.Server{
+			Addr:          opts.TLSAddr,
+			Net:           "tcp-tls",
+			Handler:       streamHandler(dns.HandlerFunc(dnsHandler.HandleDNS), handlers.TransportTLS, opts.TCPIdleTimeout),
+			TsigProvider:  opts.TSIGProvider,
+			MsgAcceptFunc: acceptMsg,
+			IdleTimeout:   idleTimeout,
+			MaxTCPQueries: -1,
+			TLSConfig: &tls.Config{
+				GetCertificate: opts.Certificates.GetCertificate,
+				MinVersion:     tls.VersionTLS12,
+				NextProtos:     []string{"dot"},
+			},
+		}
+	}
+
+	if opts.DoQAddr != "" && opts.Certificates != nil {
+		s.doqServer = newQUICServer(opts.DoQAddr, dns.HandlerFunc(dnsHandler.HandleDNS), opts.TSIGProvider, &tls.Config{
+			GetCertificate: opts.Certificates.GetCertificate,
+			MinVersion:     tls.VersionTLS13,
+			NextProtos:     []string{"doq"},
+		}, opts.TCPIdleTimeout)
+	}
+
+	if opts.DoHAddr != "" {
+		mux := http.NewServeMux()
+		dohHandler := NewDoHHandler(dns.HandlerFunc(dnsHandler.HandleDNS), opts.TSIGProvider, opts.DoHTrustedProxies)
+		mux.Handle(DoHPath, dohHandler)
+		mux.Handle(DoHPath+"/", dohHandler)
+		s.dohServer = &http.Server{
+			Addr:         opts.DoHAddr,
+			Handler:      mux,
+			ReadTimeout:  15 * time.Second,
+			WriteTimeout: 15 * time.Second,
+			IdleTimeout:  60 * time.Second,
+		}
+		if opts.Certificates != nil {
+			s.dohServer.TLSConfig = &tls.Config{
+				GetCertificate: opts.Certificates.GetCertificate,
+				MinVersion:     tls.VersionTLS12,
+			}
+		}
+	}
+
+	return s
+}
+
+// acceptMsg accepts DNS UPDATE requests (RFC 2136) in addition to the messages
+// accepted by default, which rejects them as not implemented
+func acceptMsg(dh dns.Header) dns.MsgAcceptAction {
+	const qrBit = 1 << 15
+	opcode := int(dh.Bits>>11) & 0xF
+	if opcode == dns.OpcodeUpdate && dh.Bits&qrBit == 0 && dh.Qdcount == 1 {
+		return dns.MsgAccept
+	}
+	return dns.DefaultMsgAcceptFunc(dh)
 }
 
 // Start begins listening on both UDP and TCP
@@ -36,11 +148,8 @@ func (s *Server) Start() error {
 		return err
 	}
 
-	// Register handler
-	dns.HandleFunc(".", s.dnsHandler.HandleDNS)
-
 	// Start servers
-	errCh := make(chan error, 2)
+	errCh := make(chan error, 5)
 	go func() {
 		vlog.Infof("Starting DNS server (UDP) on %s", s.udpServer.Addr)
 		if err := s.udpServer.ListenAndServe(); err != nil {
@@ -56,9 +165,57 @@ func (s *Server) Start() error {
 		}
 	}()
 
+	if s.certificates != nil {
+		s.certificates.Start()
+	}
+	if s.tlsServer != nil {
+		go func() {
+			vlog.Infof("Starting DNS server (TLS) on %s", s.tlsServer.Addr)
+			if err := s.tlsServer.ListenAndServe(); err != nil {
+				vlog.Errorf("TLS server error: %v", err)
+				errCh <- err
+			}
+		}()
+	}
+
+	if s.doqServer != nil {
+		go func() {
+			vlog.Infof("Starting DNS server (QUIC) on %s", s.doqServer.addr)
+			if err := s.doqServer.ListenAndServe(); err != nil {
+				vlog.Errorf("DNS over QUIC server error: %v", err)
+				errCh <- err
+			}
+		}()
+	}
+	if s.dohServer != nil {
+		go func() {
+			var err error
+			if s.dohServer.TLSConfig != nil {
+				vlog.Infof("Starting DNS server (HTTPS) on %s", s.dohServer.Addr)
+				err = s.dohServer.ListenAndServeTLS("", "")
+			} else {
+				vlog.Infof("Starting DNS server (HTTP, behind a TLS proxy) on %s", s.dohServer.Addr)
+				err = s.dohServer.ListenAndServe()
+			}
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				vlog.Errorf("DNS over HTTPS server error: %v", err)
+				errCh <- err
+			}
+		}()
+	}
+
 	// Give servers a moment to start
 	time.Sleep(100 * time.Millisecond)
 	vlog.Infof("DNS server listening on %s (udp/tcp)", s.udpServer.Addr)
+	if s.tlsServer != nil {
+		vlog.Infof("DNS over TLS listening on %s", s.tlsServer.Addr)
+	}
+	if s.doqServer != nil {
+		vlog.Infof("DNS over QUIC listening on %s", s.doqServer.addr)
+	}
+	if s.dohServer != nil {
+		vlog.Infof("DNS over HTTPS listening on %s%s", s.dohServer.Addr, DoHPath)
+	}
 
 	// Mark service as ready once DNS servers are started
 	s.healthServer.SetReady(true)
@@ -72,16 +229,18 @@ func (s *Server) Start() error {
 		s.healthServer.SetReady(false)
 		_ = s.udpServer.Shutdown()
 		_ = s.tcpServer.Shutdown()
+		s.shutdownEncrypted()
 		_ = s.healthServer.Shutdown()
 		return nil
 	case err := <-errCh:
 		s.healthServer.SetReady(false)
+		s.shutdownEncrypted()
 		_ = s.healthServer.Shutdown()
 		return err
 	}
 }
 
-// Shutdown gracefully shuts down both UDP and TCP servers
+// Shutdown gracefully shuts down the UDP, TCP, TLS, HTTPS and QUIC servers
 func (s *Server) Shutdown() error {
 	s.healthServer.SetReady(false)
 	if err := s.udpServer.Shutdown(); err != nil {
@@ -90,5 +249,22 @@ func (s *Server) Shutdown() error {
 	if err := s.tcpServer.Shutdown(); err != nil {
 		return err
 	}
+	s.shutdownEncrypted()
 	return s.healthServer.Shutdown()
 }
+
+// shutdownEncrypted stops the DNS over TLS, HTTPS and QUIC listeners and the certificate reloads
+func (s *Server) shutdownEncrypted() {
+	if s.tlsServer != nil {
+		_ = s.tlsServer.Shutdown()
+	}
+	if s.dohServer != nil {
+		_ = s.dohServer.Close()
+	}
+	if s.doqServer != nil {
+		_ = s.doqServer.Shutdown()
+	}
+	if s.certificates != nil {
+		s.certificates.Stop()
+	}
+}
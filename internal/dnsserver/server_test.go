@@ -0,0 +1,201 @@
+package dnsserver
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/rogerwesterbo/godns/internal/dnsserver/handlers"
+)
+
+// writeCertificate writes a self-signed certificate for commonName to PEM files
+func writeCertificate(t *testing.T, certFile, keyFile, commonName string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     []string{commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate() error = %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("MarshalECPrivateKey() error = %v", err)
+	}
+
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+}
+
+func commonName(t *testing.T, c *CertificateReloader) string {
+	t.Helper()
+	cert, _ := c.GetCertificate(nil)
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatalf("ParseCertificate() error = %v", err)
+	}
+	return leaf.Subject.CommonName
+}
+
+func TestCertificateReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	writeCertificate(t, certFile, keyFile, "dns1.example.lan")
+
+	c, err := NewCertificateReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("NewCertificateReloader() error = %v", err)
+	}
+	if got := commonName(t, c); got != "dns1.example.lan" {
+		t.Fatalf("certificate = %s, want dns1.example.lan", got)
+	}
+
+	if reloaded, err := c.Reload(); err != nil || reloaded {
+		t.Errorf("Reload() of unchanged files = %v, %v, want false, nil", reloaded, err)
+	}
+
+	// A renewed certificate is picked up
+	writeCertificate(t, certFile, keyFile, "dns2.example.lan")
+	later := time.Now().Add(time.Minute)
+	for _, file := range []string{certFile, keyFile} {
+		if err := os.Chtimes(file, later, later); err != nil {
+			t.Fatalf("Chtimes() error = %v", err)
+		}
+	}
+	if reloaded, err := c.Reload(); err != nil || !reloaded {
+		t.Fatalf("Reload() of changed files = %v, %v, want true, nil", reloaded, err)
+	}
+	if got := commonName(t, c); got != "dns2.example.lan" {
+		t.Errorf("certificate = %s, want dns2.example.lan", got)
+	}
+
+	// A broken file keeps the current certificate
+	if err := os.WriteFile(keyFile, []byte("not a key"), 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	evenLater := later.Add(time.Minute)
+	if err := os.Chtimes(keyFile, evenLater, evenLater); err != nil {
+		t.Fatalf("Chtimes() error = %v", err)
+	}
+	if _, err := c.Reload(); err == nil {
+		t.Error("Reload() of a broken key succeeded")
+	}
+	if got := commonName(t, c); got != "dns2.example.lan" {
+		t.Errorf("certificate after a failed reload = %s, want dns2.example.lan", got)
+	}
+}
+
+func TestDNSOverTLS(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	writeCertificate(t, certFile, keyFile, "dns.example.lan")
+	certificates, err := NewCertificateReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("NewCertificateReloader() error = %v", err)
+	}
+
+	// Answers with the transport the query arrived over
+	handler := dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(r)
+		transport := "unknown"
+		if tw, ok := w.(handlers.TransportWriter); ok {
+			transport = tw.Transport()
+		}
+		m.Answer = append(m.Answer, &dns.TXT{
+			Hdr: dns.RR_Header{Name: r.Question[0].Name, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 60},
+			Txt: []string{transport},
+		})
+		_ = w.WriteMsg(m)
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	started := make(chan struct{})
+	server := &dns.Server{
+		Listener:          tls.NewListener(ln, &tls.Config{GetCertificate: certificates.GetCertificate}),
+		Net:               "tcp-tls",
+		Handler:           streamHandler(handler, handlers.TransportTLS, 10*time.Second),
+		IdleTimeout:       func() time.Duration { return 10 * time.Second },
+		MaxTCPQueries:     -1,
+		NotifyStartedFunc: func() { close(started) },
+	}
+	go func() { _ = server.ActivateAndServe() }()
+	defer func() { _ = server.Shutdown() }()
+	<-started
+
+	client := &dns.Client{Net: "tcp-tls", TLSConfig: &tls.Config{InsecureSkipVerify: true}} // #nosec G402 -- self-signed test certificate
+	conn, err := client.Dial(ln.Addr().String())
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	// Pipelined queries on one connection, the first asking for the keepalive timeout
+	names := []string{"a.example.lan.", "b.example.lan.", "c.example.lan."}
+	for i, name := range names {
+		q := new(dns.Msg)
+		q.SetQuestion(name, dns.TypeTXT)
+		if i == 0 {
+			q.SetEdns0(dns.DefaultMsgSize, false)
+			opt := q.IsEdns0()
+			opt.Option = append(opt.Option, &dns.EDNS0_TCP_KEEPALIVE{Code: dns.EDNS0TCPKEEPALIVE})
+		}
+		if err := conn.WriteMsg(q); err != nil {
+			t.Fatalf("WriteMsg() error = %v", err)
+		}
+	}
+
+	for i, name := range names {
+		resp, err := conn.ReadMsg()
+		if err != nil {
+			t.Fatalf("ReadMsg() error = %v", err)
+		}
+		if resp.Question[0].Name != name {
+			t.Errorf("response %d is for %s, want %s", i, resp.Question[0].Name, name)
+		}
+		if len(resp.Answer) != 1 || resp.Answer[0].(*dns.TXT).Txt[0] != handlers.TransportTLS {
+			t.Errorf("response %d answer = %v, want transport %s", i, resp.Answer, handlers.TransportTLS)
+		}
+
+		var keepalive *dns.EDNS0_TCP_KEEPALIVE
+		if opt := resp.IsEdns0(); opt != nil {
+			for _, o := range opt.Option {
+				if k, ok := o.(*dns.EDNS0_TCP_KEEPALIVE); ok {
+					keepalive = k
+				}
+			}
+		}
+		switch {
+		case i == 0 && (keepalive == nil || keepalive.Timeout != 100):
+			t.Errorf("response %d keepalive = %v, want a timeout of 100 (10 seconds)", i, keepalive)
+		case i > 0 && keepalive != nil:
+			t.Errorf("response %d has a keepalive option the query didn't ask for", i)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package dnsserver
+
+import (
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// streamWriter is the response writer of a connection-oriented transport (TCP, TLS)
+// When the client asks for the edns-tcp-keepalive option, responses tell it how long
+// an idle connection is kept open (RFC 7828).
+type streamWriter struct {
+	dns.ResponseWriter
+	transport   string
+	idleTimeout time.Duration
+	keepalive   bool
+}
+
+// Transport returns the transport of the connection, see handlers.TransportWriter
+func (w *streamWriter) Transport() string {
+	return w.transport
+}
+
+func (w *streamWriter) WriteMsg(m *dns.Msg) error {
+	if w.keepalive {
+		opt := m.IsEdns0()
+		if opt == nil {
+			m.SetEdns0(dns.DefaultMsgSize, false)
+			opt = m.IsEdns0()
+		}
+		if !hasKeepalive(opt) {
+			// The timeout is in units of 100 milliseconds
+			opt.Option = append(opt.Option, &dns.EDNS0_TCP_KEEPALIVE{
+				Code:    dns.EDNS0TCPKEEPALIVE,
+				Timeout: uint16(min(w.idleTimeout/(100*time.Millisecond), 0xFFFF)),
+			})
+		}
+	}
+	return w.ResponseWriter.WriteMsg(m)
+}
+
+// streamHandler serves the queries of a connection-oriented transport with the DNS handler
+func streamHandler(dnsHandler dns.Handler, transport string, idleTimeout time.Duration) dns.Handler {
+	return dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+		keepalive := false
+		if opt := r.IsEdns0(); opt != nil {
+			keepalive = hasKeepalive(opt)
+		}
+		dnsHandler.ServeDNS(&streamWriter{ResponseWriter: w, transport: transport, idleTimeout: idleTimeout, keepalive: keepalive}, r)
+	})
+}
+
+func hasKeepalive(opt *dns.OPT) bool {
+	for _, o := range opt.Option {
+		if o.Option() == dns.EDNS0TCPKEEPALIVE {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,47 @@
+package dnsserver
+
+import (
+	"github.com/miekg/dns"
+)
+
+// messageTSIG verifies and signs the messages of a transport served outside dns.Server,
+// as dns.Server does for UDP, TCP and TLS
+// Embedded in a response writer, it provides TsigStatus and TsigTimersOnly.
+type messageTSIG struct {
+	provider   dns.TsigProvider
+	status     error
+	requestMAC string
+	timersOnly bool
+}
+
+// verify checks the signature of a query; raw is the query as received
+// A signed query can't be verified without a provider, so the handler treats it as failed.
+func (t *messageTSIG) verify(raw []byte, r *dns.Msg) {
+	tsig := r.IsTsig()
+	if tsig == nil {
+		return
+	}
+	if t.provider == nil {
+		t.status = dns.ErrSecret
+		return
+	}
+	t.status = dns.TsigVerifyWithProvider(raw, t.provider, "", false)
+	t.requestMAC = tsig.MAC
+}
+
+// pack packs a response, signing it when the handler added a TSIG record
+// The MAC of each signed message is chained into the next, for multi-message zone transfers.
+func (t *messageTSIG) pack(m *dns.Msg) ([]byte, error) {
+	if t.provider == nil || m.IsTsig() == nil {
+		return m.Pack()
+	}
+	data, mac, err := dns.TsigGenerateWithProvider(m, t.provider, t.requestMAC, t.timersOnly)
+	if err != nil {
+		return nil, err
+	}
+	t.requestMAC = mac
+	return data, nil
+}
+
+func (t *messageTSIG) TsigStatus() error          { return t.status }
+func (t *messageTSIG) TsigTimersOnly(timers bool) { t.timersOnly = timers }
@@ -5,13 +5,17 @@ import (
 	"fmt"
 	"math"
 	"net/http"
+	"time"
 
 	"github.com/rogerwesterbo/godns/internal/httpserver/helpers"
 	"github.com/rogerwesterbo/godns/internal/services/v1cacheservice"
 	"github.com/rogerwesterbo/godns/internal/services/v1healthcheckservice"
 	"github.com/rogerwesterbo/godns/internal/services/v1loadbalancerservice"
+	"github.com/rogerwesterbo/godns/internal/services/v1notifyservice"
+	"github.com/rogerwesterbo/godns/internal/services/v1policyservice"
 	"github.com/rogerwesterbo/godns/internal/services/v1querylogservice"
 	"github.com/rogerwesterbo/godns/internal/services/v1ratelimitservice"
+	"github.com/rogerwesterbo/godns/internal/services/v1upstream"
 	"github.com/vitistack/common/pkg/loggers/vlog"
 )
 
@@ -22,6 +26,9 @@ type AdminHandler struct {
 	loadBalancer *v1loadbalancerservice.LoadBalancer
 	healthCheck  *v1healthcheckservice.HealthCheckService
 	queryLog     *v1querylogservice.QueryLogService
+	notify       *v1notifyservice.NotifyService
+	upstream     *v1upstream.UpstreamService
+	policy       *v1policyservice.V1PolicyService
 }
 
 // NewAdminHandler creates a new admin handler
@@ -31,6 +38,9 @@ func NewAdminHandler(
 	loadBalancer *v1loadbalancerservice.LoadBalancer,
 	healthCheck *v1healthcheckservice.HealthCheckService,
 	queryLog *v1querylogservice.QueryLogService,
+	notify *v1notifyservice.NotifyService,
+	upstream *v1upstream.UpstreamService,
+	policy *v1policyservice.V1PolicyService,
 ) *AdminHandler {
 	return &AdminHandler{
 		cacheService: cacheService,
@@ -38,6 +48,9 @@ func NewAdminHandler(
 		loadBalancer: loadBalancer,
 		healthCheck:  healthCheck,
 		queryLog:     queryLog,
+		notify:       notify,
+		upstream:     upstream,
+		policy:       policy,
 	}
 }
 
@@ -119,6 +132,81 @@ type QueryLogStats struct {
 	BlockedRate    float64 `json:"blocked_rate"`
 }
 
+// NotifyStats represents DNS NOTIFY statistics
+type NotifyStats struct {
+	Enabled   bool               `json:"enabled"`
+	Sent      uint64             `json:"sent"`
+	Succeeded uint64             `json:"succeeded"`
+	Failed    uint64             `json:"failed"`
+	Pending   int                `json:"pending"`
+	Targets   []NotifyTargetInfo `json:"targets,omitempty"`
+}
+
+// NotifyTargetInfo represents the latest NOTIFY of a zone to one secondary
+type NotifyTargetInfo struct {
+	Zone        string `json:"zone"`
+	Target      string `json:"target"`
+	Serial      uint32 `json:"serial"`
+	Attempts    int    `json:"attempts"`
+	Pending     bool   `json:"pending"`
+	Success     bool   `json:"success"`
+	LastAttempt string `json:"last_attempt,omitempty"`
+	LastSuccess string `json:"last_success,omitempty"`
+	LastError   string `json:"last_error,omitempty"`
+}
+
+// UpstreamStats represents upstream DNS server statistics
+type UpstreamStats struct {
+	Strategy         string          `json:"strategy"`
+	Recursive        bool            `json:"recursive"`
+	TotalUpstreams   int             `json:"total_upstreams"`
+	HealthyUpstreams int             `json:"healthy_upstreams"`
+	Upstreams        []UpstreamInfo  `json:"upstreams,omitempty"`
+	Forwarders       []ForwarderInfo `json:"forwarders,omitempty"`
+}
+
+// ForwarderInfo represents the upstream DNS servers of a conditional forwarder
+type ForwarderInfo struct {
+	Domain    string         `json:"domain"`
+	Strategy  string         `json:"strategy"`
+	Upstreams []UpstreamInfo `json:"upstreams"`
+}
+
+// UpstreamInfo represents the health and latency of one upstream DNS server
+type UpstreamInfo struct {
+	Address             string  `json:"address"`
+	Healthy             bool    `json:"healthy"`
+	RTTMs               float64 `json:"rtt_ms"`
+	Queries             uint64  `json:"queries"`
+	Failures            uint64  `json:"failures"`
+	ConsecutiveFailures int     `json:"consecutive_failures"`
+	LastSuccess         string  `json:"last_success,omitempty"`
+	LastFailure         string  `json:"last_failure,omitempty"`
+	LastError           string  `json:"last_error,omitempty"`
+}
+
+// PolicyStats represents response policy statistics
+type PolicyStats struct {
+	Enabled   bool         `json:"enabled"`
+	TotalHits uint64       `json:"total_hits"`
+	Policies  []PolicyInfo `json:"policies,omitempty"`
+}
+
+// PolicyInfo represents the rules and hits of one response policy
+type PolicyInfo struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Location    string `json:"location"`
+	ProfileOnly bool   `json:"profile_only,omitempty"` // Blocklist of DNS_FILTER_BLOCKLISTS, only applied by filtering profiles
+	Loaded      bool   `json:"loaded"`
+	Rules       int    `json:"rules"`
+	Skipped     int    `json:"skipped,omitempty"`
+	Serial      uint32 `json:"serial,omitempty"`
+	Hits        uint64 `json:"hits"`
+	LastLoad    string `json:"last_load,omitempty"`
+	LastError   string `json:"last_error,omitempty"`
+}
+
 // SystemStats represents overall system statistics
 type SystemStats struct {
 	Cache        CacheStats        `json:"cache"`
@@ -126,6 +214,9 @@ type SystemStats struct {
 	LoadBalancer LoadBalancerStats `json:"load_balancer"`
 	HealthCheck  HealthCheckStats  `json:"health_check"`
 	QueryLog     QueryLogStats     `json:"query_log"`
+	Notify       NotifyStats       `json:"notify"`
+	Upstream     UpstreamStats     `json:"upstream"`
+	Policies     PolicyStats       `json:"policies"`
 }
 
 // GetSystemStats returns overall system statistics
@@ -146,6 +237,9 @@ func (h *AdminHandler) GetSystemStats(w http.ResponseWriter, r *http.Request) {
 		LoadBalancer: h.getLoadBalancerStats(ctx, false), // without backends list
 		HealthCheck:  h.getHealthCheckStats(ctx, false),  // without results list
 		QueryLog:     h.getQueryLogStats(ctx),
+		Notify:       h.getNotifyStats(ctx, false),   // without targets list
+		Upstream:     h.getUpstreamStats(ctx, false), // without upstreams list
+		Policies:     h.getPolicyStats(ctx),
 	}
 
 	helpers.RespondJSON(w, stats)
@@ -248,6 +342,51 @@ func (h *AdminHandler) GetRateLimiterStats(w http.ResponseWriter, r *http.Reques
 	helpers.RespondJSON(w, stats)
 }
 
+// GetNotifyStats returns DNS NOTIFY statistics
+// @Summary Get NOTIFY statistics
+// @Description Get the results of DNS NOTIFY messages sent to the secondaries of each zone, including pending retries and failures
+// @Tags Admin
+// @Produce json
+// @Success 200 {object} NotifyStats
+// @Security BearerAuth
+// @Security OAuth2Password
+// @Router /api/v1/admin/notify/stats [get]
+func (h *AdminHandler) GetNotifyStats(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	stats := h.getNotifyStats(ctx, true) // with targets list
+	helpers.RespondJSON(w, stats)
+}
+
+// GetUpstreamStats returns upstream DNS server statistics
+// @Summary Get upstream statistics
+// @Description Get the strategy and the health, latency and failures of each upstream DNS server queries are forwarded to, including the upstreams of conditional forwarders
+// @Tags Admin
+// @Produce json
+// @Success 200 {object} UpstreamStats
+// @Security BearerAuth
+// @Security OAuth2Password
+// @Router /api/v1/admin/upstream/stats [get]
+func (h *AdminHandler) GetUpstreamStats(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	stats := h.getUpstreamStats(ctx, true) // with upstreams list
+	helpers.RespondJSON(w, stats)
+}
+
+// GetPolicyStats returns response policy statistics
+// @Summary Get response policy statistics
+// @Description Get the response policy zones and blocklists in the order they are checked, with their rules, load state and the number of queries each policy matched
+// @Tags Admin
+// @Produce json
+// @Success 200 {object} PolicyStats
+// @Security BearerAuth
+// @Security OAuth2Password
+// @Router /api/v1/admin/policies/stats [get]
+func (h *AdminHandler) GetPolicyStats(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	stats := h.getPolicyStats(ctx)
+	helpers.RespondJSON(w, stats)
+}
+
 // Helper methods to gather stats from each service
 
 func (h *AdminHandler) getCacheStats(ctx context.Context) CacheStats {
@@ -380,3 +519,125 @@ func (h *AdminHandler) getCacheStatsDetailed(ctx context.Context) CacheStatsDeta
 
 	return stats
 }
+
+func (h *AdminHandler) getNotifyStats(ctx context.Context, includeTargets bool) NotifyStats {
+	stats := NotifyStats{
+		Enabled: h.notify != nil,
+	}
+
+	if h.notify != nil {
+		notifyStats := h.notify.Stats()
+		stats.Sent = notifyStats.Sent
+		stats.Succeeded = notifyStats.Succeeded
+		stats.Failed = notifyStats.Failed
+
+		for _, target := range notifyStats.Targets {
+			if target.Pending {
+				stats.Pending++
+			}
+			if !includeTargets {
+				continue
+			}
+
+			info := NotifyTargetInfo{
+				Zone:      target.Zone,
+				Target:    target.Target,
+				Serial:    target.Serial,
+				Attempts:  target.Attempts,
+				Pending:   target.Pending,
+				Success:   target.Success,
+				LastError: target.LastError,
+			}
+			if !target.LastAttempt.IsZero() {
+				info.LastAttempt = target.LastAttempt.Format(time.RFC3339)
+			}
+			if !target.LastSuccess.IsZero() {
+				info.LastSuccess = target.LastSuccess.Format(time.RFC3339)
+			}
+			stats.Targets = append(stats.Targets, info)
+		}
+	}
+
+	return stats
+}
+
+func (h *AdminHandler) getUpstreamStats(ctx context.Context, includeUpstreams bool) UpstreamStats {
+	stats := UpstreamStats{}
+
+	if h.upstream != nil {
+		upstreamStats := h.upstream.Stats()
+		stats.Strategy = upstreamStats.Strategy
+		stats.Recursive = upstreamStats.Recursive
+		stats.TotalUpstreams = len(upstreamStats.Upstreams)
+
+		for _, upstream := range upstreamStats.Upstreams {
+			if upstream.Healthy {
+				stats.HealthyUpstreams++
+			}
+			if includeUpstreams {
+				stats.Upstreams = append(stats.Upstreams, upstreamInfo(upstream))
+			}
+		}
+
+		if includeUpstreams {
+			for _, forwarder := range upstreamStats.Forwarders {
+				info := ForwarderInfo{Domain: forwarder.Domain, Strategy: forwarder.Strategy}
+				for _, upstream := range forwarder.Upstreams {
+					info.Upstreams = append(info.Upstreams, upstreamInfo(upstream))
+				}
+				stats.Forwarders = append(stats.Forwarders, info)
+			}
+		}
+	}
+
+	return stats
+}
+
+func (h *AdminHandler) getPolicyStats(ctx context.Context) PolicyStats {
+	stats := PolicyStats{
+		Enabled: h.policy != nil,
+	}
+
+	if h.policy != nil {
+		for _, policy := range h.policy.Status() {
+			info := PolicyInfo{
+				Name:        policy.Name,
+				Type:        policy.Type,
+				Location:    policy.Location,
+				ProfileOnly: policy.ProfileOnly,
+				Loaded:      policy.Loaded,
+				Rules:       policy.Rules,
+				Skipped:     policy.Skipped,
+				Serial:      policy.Serial,
+				Hits:        policy.Hits,
+				LastError:   policy.LastError,
+			}
+			if !policy.LastLoad.IsZero() {
+				info.LastLoad = policy.LastLoad.Format(time.RFC3339)
+			}
+			stats.TotalHits += policy.Hits
+			stats.Policies = append(stats.Policies, info)
+		}
+	}
+
+	return stats
+}
+
+func upstreamInfo(upstream v1upstream.UpstreamStatus) UpstreamInfo {
+	info := UpstreamInfo{
+		Address:             upstream.Address,
+		Healthy:             upstream.Healthy,
+		RTTMs:               float64(upstream.RTT.Microseconds()) / 1000,
+		Queries:             upstream.Queries,
+		Failures:            upstream.Failures,
+		ConsecutiveFailures: upstream.ConsecutiveFailures,
+		LastError:           upstream.LastError,
+	}
+	if !upstream.LastSuccess.IsZero() {
+		info.LastSuccess = upstream.LastSuccess.Format(time.RFC3339)
+	}
+	if !upstream.LastFailure.IsZero() {
+		info.LastFailure = upstream.LastFailure.Format(time.RFC3339)
+	}
+	return info
+}
@@ -0,0 +1,183 @@
+package v1dnssechandler
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/rogerwesterbo/godns/internal/httpserver/helpers"
+	"github.com/rogerwesterbo/godns/internal/models"
+	"github.com/rogerwesterbo/godns/internal/services/v1dnssecservice"
+	"github.com/rogerwesterbo/godns/internal/services/v1zoneservice"
+	"github.com/vitistack/common/pkg/loggers/vlog"
+)
+
+// DNSSECHandler handles DNSSEC endpoints of signed zones
+type DNSSECHandler struct {
+	zoneService   *v1zoneservice.V1ZoneService
+	dnssecService *v1dnssecservice.V1DNSSECService
+}
+
+// NewDNSSECHandler creates a new DNSSEC handler
+// dnssecService is nil when no DNSSEC encryption key is configured.
+func NewDNSSECHandler(zoneService *v1zoneservice.V1ZoneService, dnssecService *v1dnssecservice.V1DNSSECService) *DNSSECHandler {
+	return &DNSSECHandler{
+		zoneService:   zoneService,
+		dnssecService: dnssecService,
+	}
+}
+
+// @Summary Export DS records
+// @Description Get the DS records the parent zone should have for a signed zone: those of the active KSK, or of the new KSK while a rollover waits for the parent
+// @Tags DNSSEC
+// @Produce json
+// @Param zone path string true "Zone name (e.g., example.lan)"
+// @Success 200 {array} models.DelegationSigner "DS records"
+// @Failure 400 {object} map[string]string "DNSSEC is not enabled for the zone"
+// @Failure 404 {object} map[string]string "Zone not found"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Security BearerAuth
+// @Security OAuth2Password
+// @Router /api/v1/zones/{zone}/ds [get]
+func (h *DNSSECHandler) GetDS(w http.ResponseWriter, req *http.Request, domain string) {
+	zone, ok := h.signedZone(w, req, domain)
+	if !ok {
+		return
+	}
+
+	signers, err := h.dnssecService.DS(req.Context(), zone.Domain)
+	if err != nil {
+		vlog.Errorf("Failed to get DS records of zone %s: %v", zone.Domain, err)
+		helpers.SendError(w, http.StatusInternalServerError, "Failed to get DS records")
+		return
+	}
+
+	helpers.SendJSON(w, http.StatusOK, signers)
+}
+
+// @Summary Get DNSSEC status
+// @Description Get the signing keys of a signed zone with their rollover states, the DS records the parent should have and when the next rollovers are due
+// @Tags DNSSEC
+// @Produce json
+// @Param zone path string true "Zone name (e.g., example.lan)"
+// @Success 200 {object} models.DNSSECStatus "DNSSEC status"
+// @Failure 400 {object} map[string]string "DNSSEC is not enabled for the zone"
+// @Failure 404 {object} map[string]string "Zone not found"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Security BearerAuth
+// @Security OAuth2Password
+// @Router /api/v1/zones/{zone}/dnssec [get]
+func (h *DNSSECHandler) GetStatus(w http.ResponseWriter, req *http.Request, domain string) {
+	zone, ok := h.signedZone(w, req, domain)
+	if !ok {
+		return
+	}
+	h.sendStatus(w, req, zone)
+}
+
+// @Summary Start a key rollover
+// @Description Start a ZSK or KSK rollover now instead of at the end of the key's lifetime
+// @Tags DNSSEC
+// @Accept json
+// @Produce json
+// @Param zone path string true "Zone name (e.g., example.lan)"
+// @Param request body RolloverRequest true "Key type to roll over"
+// @Success 200 {object} models.DNSSECStatus "DNSSEC status"
+// @Failure 400 {object} map[string]string "Invalid key type, rollover already in progress or DNSSEC not enabled"
+// @Failure 404 {object} map[string]string "Zone not found"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Security BearerAuth
+// @Security OAuth2Password
+// @Router /api/v1/zones/{zone}/dnssec/rollover [post]
+func (h *DNSSECHandler) StartRollover(w http.ResponseWriter, req *http.Request, domain string) {
+	zone, ok := h.signedZone(w, req, domain)
+	if !ok {
+		return
+	}
+
+	var request RolloverRequest
+	if err := helpers.DecodeJSON(req.Body, &request); err != nil {
+		helpers.SendError(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := h.dnssecService.StartRollover(req.Context(), zone, request.KeyType); err != nil {
+		vlog.Errorf("Failed to start key rollover of zone %s: %v", zone.Domain, err)
+		if strings.Contains(err.Error(), "invalid") {
+			helpers.SendError(w, http.StatusBadRequest, err.Error())
+		} else {
+			helpers.SendError(w, http.StatusInternalServerError, "Failed to start key rollover")
+		}
+		return
+	}
+
+	h.sendStatus(w, req, zone)
+}
+
+// @Summary Confirm the DS update at the parent
+// @Description Confirm that the parent zone has the DS record of the new KSK, completing the parent side of a KSK rollover. Not needed when the parent zone is served by GoDNS.
+// @Tags DNSSEC
+// @Produce json
+// @Param zone path string true "Zone name (e.g., example.lan)"
+// @Success 200 {object} models.DNSSECStatus "DNSSEC status"
+// @Failure 400 {object} map[string]string "No KSK rollover waits for the parent or DNSSEC not enabled"
+// @Failure 404 {object} map[string]string "Zone not found"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Security BearerAuth
+// @Security OAuth2Password
+// @Router /api/v1/zones/{zone}/dnssec/ds-published [post]
+func (h *DNSSECHandler) ConfirmDS(w http.ResponseWriter, req *http.Request, domain string) {
+	zone, ok := h.signedZone(w, req, domain)
+	if !ok {
+		return
+	}
+
+	if err := h.dnssecService.ConfirmDS(req.Context(), zone.Domain); err != nil {
+		vlog.Errorf("Failed to confirm DS update of zone %s: %v", zone.Domain, err)
+		if strings.Contains(err.Error(), "invalid") {
+			helpers.SendError(w, http.StatusBadRequest, err.Error())
+		} else {
+			helpers.SendError(w, http.StatusInternalServerError, "Failed to confirm DS update")
+		}
+		return
+	}
+
+	h.sendStatus(w, req, zone)
+}
+
+// RolloverRequest selects the key type of a manual rollover
+type RolloverRequest struct {
+	KeyType string `json:"key_type" example:"zsk"` // zsk or ksk
+}
+
+// signedZone returns a zone with DNSSEC enabled, or sends the error response
+func (h *DNSSECHandler) signedZone(w http.ResponseWriter, req *http.Request, domain string) (*models.DNSZone, bool) {
+	zone, err := h.zoneService.GetZone(req.Context(), domain)
+	if err != nil {
+		vlog.Errorf("Failed to get zone %s: %v", domain, err)
+		if strings.Contains(err.Error(), "not found") {
+			helpers.SendError(w, http.StatusNotFound, "Zone not found")
+		} else {
+			helpers.SendError(w, http.StatusInternalServerError, "Failed to get zone")
+		}
+		return nil, false
+	}
+
+	if !zone.Signed() || h.dnssecService == nil {
+		helpers.SendError(w, http.StatusBadRequest, "DNSSEC is not enabled for zone "+zone.Domain)
+		return nil, false
+	}
+
+	return zone, true
+}
+
+// sendStatus sends the DNSSEC status of a zone
+func (h *DNSSECHandler) sendStatus(w http.ResponseWriter, req *http.Request, zone *models.DNSZone) {
+	status, err := h.dnssecService.Status(req.Context(), zone)
+	if err != nil {
+		vlog.Errorf("Failed to get DNSSEC status of zone %s: %v", zone.Domain, err)
+		helpers.SendError(w, http.StatusInternalServerError, "Failed to get DNSSEC status")
+		return
+	}
+
+	helpers.SendJSON(w, http.StatusOK, status)
+}
@@ -0,0 +1,109 @@
+package v1dynamicupdatehandler
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/rogerwesterbo/godns/internal/httpserver/helpers"
+	"github.com/rogerwesterbo/godns/internal/models"
+	"github.com/rogerwesterbo/godns/internal/services/v1dynamicupdateservice"
+	"github.com/vitistack/common/pkg/loggers/vlog"
+)
+
+// DynamicUpdateHandler handles dynamic update policy endpoints
+type DynamicUpdateHandler struct {
+	updateService *v1dynamicupdateservice.V1DynamicUpdateService
+}
+
+// NewDynamicUpdateHandler creates a new dynamic update handler
+func NewDynamicUpdateHandler(updateService *v1dynamicupdateservice.V1DynamicUpdateService) *DynamicUpdateHandler {
+	return &DynamicUpdateHandler{
+		updateService: updateService,
+	}
+}
+
+// @Summary Get dynamic update policy
+// @Description Get the TSIG keys allowed to change a zone with RFC 2136 dynamic updates
+// @Tags Dynamic Updates
+// @Produce json
+// @Param zone path string true "Zone name (e.g., example.lan)"
+// @Success 200 {object} models.ZoneUpdatePolicy "Update policy"
+// @Failure 404 {object} map[string]string "Update policy not found"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Security BearerAuth
+// @Security OAuth2Password
+// @Router /api/v1/zones/{zone}/update-policy [get]
+func (h *DynamicUpdateHandler) GetPolicy(w http.ResponseWriter, req *http.Request, domain string) {
+	policy, err := h.updateService.GetPolicy(req.Context(), domain)
+	if err != nil {
+		vlog.Errorf("Failed to get update policy for %s: %v", domain, err)
+		if strings.Contains(err.Error(), "not found") {
+			helpers.SendError(w, http.StatusNotFound, "Update policy not found")
+		} else {
+			helpers.SendError(w, http.StatusInternalServerError, "Failed to get update policy")
+		}
+		return
+	}
+
+	helpers.SendJSON(w, http.StatusOK, policy)
+}
+
+// @Summary Set dynamic update policy
+// @Description Allow TSIG keys to change names and record types of a zone with RFC 2136 dynamic updates
+// @Tags Dynamic Updates
+// @Accept json
+// @Produce json
+// @Param zone path string true "Zone name (e.g., example.lan)"
+// @Param policy body models.ZoneUpdatePolicy true "Update policy"
+// @Success 200 {object} models.ZoneUpdatePolicy "Update policy saved"
+// @Failure 400 {object} map[string]string "Invalid request body"
+// @Failure 404 {object} map[string]string "Zone not found"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Security BearerAuth
+// @Security OAuth2Password
+// @Router /api/v1/zones/{zone}/update-policy [put]
+func (h *DynamicUpdateHandler) SetPolicy(w http.ResponseWriter, req *http.Request, domain string) {
+	var policy models.ZoneUpdatePolicy
+	if err := helpers.DecodeJSON(req.Body, &policy); err != nil {
+		helpers.SendError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	if err := h.updateService.SetPolicy(req.Context(), domain, &policy); err != nil {
+		vlog.Errorf("Failed to set update policy for %s: %v", domain, err)
+		if strings.Contains(err.Error(), "not found") {
+			helpers.SendError(w, http.StatusNotFound, "Zone not found")
+		} else if strings.Contains(err.Error(), "invalid") {
+			helpers.SendError(w, http.StatusBadRequest, err.Error())
+		} else {
+			helpers.SendError(w, http.StatusInternalServerError, "Failed to set update policy")
+		}
+		return
+	}
+
+	helpers.SendJSON(w, http.StatusOK, policy)
+}
+
+// @Summary Delete dynamic update policy
+// @Description Remove the update policy of a zone, which disables dynamic updates for it
+// @Tags Dynamic Updates
+// @Param zone path string true "Zone name (e.g., example.lan)"
+// @Success 204 "Update policy deleted"
+// @Failure 404 {object} map[string]string "Update policy not found"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Security BearerAuth
+// @Security OAuth2Password
+// @Router /api/v1/zones/{zone}/update-policy [delete]
+func (h *DynamicUpdateHandler) DeletePolicy(w http.ResponseWriter, req *http.Request, domain string) {
+	if err := h.updateService.DeletePolicy(req.Context(), domain); err != nil {
+		vlog.Errorf("Failed to delete update policy for %s: %v", domain, err)
+		if strings.Contains(err.Error(), "not found") {
+			helpers.SendError(w, http.StatusNotFound, "Update policy not found")
+		} else {
+			helpers.SendError(w, http.StatusInternalServerError, "Failed to delete update policy")
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
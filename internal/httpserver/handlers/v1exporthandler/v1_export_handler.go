@@ -27,6 +27,7 @@ func NewExportHandler(exportService *v1exportservice.V1ExportService) *ExportHan
 // @Tags Export
 // @Produce plain
 // @Param format query string false "Export format: coredns, powerdns, bind, or zonefile" default(bind)
+// @Param view query string false "Export the zones as the clients of this split-horizon view see them"
 // @Success 200 {string} string "Exported zone configuration"
 // @Failure 400 {object} map[string]string "Invalid format"
 // @Failure 500 {object} map[string]string "Internal server error"
@@ -47,7 +48,7 @@ func (h *ExportHandler) ExportAll(w http.ResponseWriter, req *http.Request) {
 	}
 
 	// Export all zones
-	exported, err := h.exportService.ExportAllZones(req.Context(), v1exportservice.ExportFormat(format))
+	exported, err := h.exportService.ExportAllZones(req.Context(), req.URL.Query().Get("view"), v1exportservice.ExportFormat(format))
 	if err != nil {
 		vlog.Errorf("Failed to export zones: %v", err)
 		helpers.SendError(w, http.StatusInternalServerError, "Failed to export zones")
@@ -66,6 +67,7 @@ func (h *ExportHandler) ExportAll(w http.ResponseWriter, req *http.Request) {
 // @Produce plain
 // @Param zone path string true "Zone name (e.g., example.lan)"
 // @Param format query string false "Export format: coredns, powerdns, bind, or zonefile" default(bind)
+// @Param view query string false "Export the zones as the clients of this split-horizon view see them"
 // @Success 200 {string} string "Exported zone configuration"
 // @Failure 400 {object} map[string]string "Invalid format"
 // @Failure 404 {object} map[string]string "Zone not found"
@@ -92,7 +94,7 @@ func (h *ExportHandler) ExportZone(w http.ResponseWriter, req *http.Request, dom
 	}
 
 	// Export the zone
-	exported, err := h.exportService.ExportZone(req.Context(), domain, v1exportservice.ExportFormat(format))
+	exported, err := h.exportService.ExportZone(req.Context(), domain, req.URL.Query().Get("view"), v1exportservice.ExportFormat(format))
 	if err != nil {
 		vlog.Errorf("Failed to export zone %s: %v", domain, err)
 		if strings.Contains(err.Error(), "not found") {
@@ -0,0 +1,308 @@
+package v1filterhandler
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/rogerwesterbo/godns/internal/httpserver/helpers"
+	"github.com/rogerwesterbo/godns/internal/models"
+	"github.com/rogerwesterbo/godns/internal/services/v1filterservice"
+	"github.com/vitistack/common/pkg/loggers/vlog"
+)
+
+// FilterHandler handles client group and filtering profile endpoints
+type FilterHandler struct {
+	filterService *v1filterservice.V1FilterService
+}
+
+// NewFilterHandler creates a new filter handler
+func NewFilterHandler(filterService *v1filterservice.V1FilterService) *FilterHandler {
+	return &FilterHandler{
+		filterService: filterService,
+	}
+}
+
+// @Summary List client groups
+// @Description List the client groups: clients, by network or client identifier, filtered with a profile
+// @Tags Filtering
+// @Produce json
+// @Success 200 {array} models.ClientGroup "Client groups"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Security BearerAuth
+// @Security OAuth2Password
+// @Router /api/v1/client-groups [get]
+func (h *FilterHandler) ListClientGroups(w http.ResponseWriter, req *http.Request) {
+	groups, err := h.filterService.ListClientGroups(req.Context())
+	if err != nil {
+		vlog.Errorf("Failed to list client groups: %v", err)
+		helpers.SendError(w, http.StatusInternalServerError, "Failed to list client groups")
+		return
+	}
+
+	helpers.SendJSON(w, http.StatusOK, groups)
+}
+
+// @Summary Create client group
+// @Description Create a client group. Its clients are filtered with its profile; a client identifier matches before the networks, and the group with the longest matching prefix wins.
+// @Tags Filtering
+// @Accept json
+// @Produce json
+// @Param group body models.ClientGroup true "Client group"
+// @Success 201 {object} models.ClientGroup "Client group created"
+// @Failure 400 {object} map[string]string "Invalid request body or unknown profile"
+// @Failure 409 {object} map[string]string "Client group already exists"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Security BearerAuth
+// @Security OAuth2Password
+// @Router /api/v1/client-groups [post]
+func (h *FilterHandler) CreateClientGroup(w http.ResponseWriter, req *http.Request) {
+	var group models.ClientGroup
+	if err := helpers.DecodeJSON(req.Body, &group); err != nil {
+		helpers.SendError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	if err := h.filterService.CreateClientGroup(req.Context(), &group); err != nil {
+		vlog.Errorf("Failed to create client group %s: %v", group.Name, err)
+		if strings.Contains(err.Error(), "already exists") {
+			helpers.SendError(w, http.StatusConflict, err.Error())
+		} else if strings.Contains(err.Error(), "invalid") {
+			helpers.SendError(w, http.StatusBadRequest, err.Error())
+		} else {
+			helpers.SendError(w, http.StatusInternalServerError, "Failed to create client group")
+		}
+		return
+	}
+
+	helpers.SendJSON(w, http.StatusCreated, group)
+}
+
+// @Summary Get client group
+// @Description Get a client group by name
+// @Tags Filtering
+// @Produce json
+// @Param name path string true "Client group name (e.g., branch-oslo)"
+// @Success 200 {object} models.ClientGroup "Client group"
+// @Failure 404 {object} map[string]string "Client group not found"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Security BearerAuth
+// @Security OAuth2Password
+// @Router /api/v1/client-groups/{name} [get]
+func (h *FilterHandler) GetClientGroup(w http.ResponseWriter, req *http.Request, name string) {
+	group, err := h.filterService.GetClientGroup(req.Context(), name)
+	if err != nil {
+		vlog.Errorf("Failed to get client group %s: %v", name, err)
+		if strings.Contains(err.Error(), "not found") {
+			helpers.SendError(w, http.StatusNotFound, "Client group not found")
+		} else {
+			helpers.SendError(w, http.StatusInternalServerError, "Failed to get client group")
+		}
+		return
+	}
+
+	helpers.SendJSON(w, http.StatusOK, group)
+}
+
+// @Summary Update client group
+// @Description Replace the clients, profile and description of a client group
+// @Tags Filtering
+// @Accept json
+// @Produce json
+// @Param name path string true "Client group name (e.g., branch-oslo)"
+// @Param group body models.ClientGroup true "Client group"
+// @Success 200 {object} models.ClientGroup "Client group updated"
+// @Failure 400 {object} map[string]string "Invalid request body or unknown profile"
+// @Failure 404 {object} map[string]string "Client group not found"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Security BearerAuth
+// @Security OAuth2Password
+// @Router /api/v1/client-groups/{name} [put]
+func (h *FilterHandler) UpdateClientGroup(w http.ResponseWriter, req *http.Request, name string) {
+	var group models.ClientGroup
+	if err := helpers.DecodeJSON(req.Body, &group); err != nil {
+		helpers.SendError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	if err := h.filterService.UpdateClientGroup(req.Context(), name, &group); err != nil {
+		vlog.Errorf("Failed to update client group %s: %v", name, err)
+		if strings.Contains(err.Error(), "invalid") {
+			helpers.SendError(w, http.StatusBadRequest, err.Error())
+		} else if strings.Contains(err.Error(), "not found") {
+			helpers.SendError(w, http.StatusNotFound, "Client group not found")
+		} else {
+			helpers.SendError(w, http.StatusInternalServerError, "Failed to update client group")
+		}
+		return
+	}
+
+	helpers.SendJSON(w, http.StatusOK, group)
+}
+
+// @Summary Delete client group
+// @Description Delete a client group; its clients are filtered like clients in no group
+// @Tags Filtering
+// @Param name path string true "Client group name (e.g., branch-oslo)"
+// @Success 204 "Client group deleted"
+// @Failure 404 {object} map[string]string "Client group not found"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Security BearerAuth
+// @Security OAuth2Password
+// @Router /api/v1/client-groups/{name} [delete]
+func (h *FilterHandler) DeleteClientGroup(w http.ResponseWriter, req *http.Request, name string) {
+	if err := h.filterService.DeleteClientGroup(req.Context(), name); err != nil {
+		vlog.Errorf("Failed to delete client group %s: %v", name, err)
+		if strings.Contains(err.Error(), "not found") {
+			helpers.SendError(w, http.StatusNotFound, "Client group not found")
+		} else {
+			helpers.SendError(w, http.StatusInternalServerError, "Failed to delete client group")
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Summary List filtering profiles
+// @Description List the filtering profiles of client groups
+// @Tags Filtering
+// @Produce json
+// @Success 200 {array} models.FilterProfile "Filtering profiles"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Security BearerAuth
+// @Security OAuth2Password
+// @Router /api/v1/filter-profiles [get]
+func (h *FilterHandler) ListFilterProfiles(w http.ResponseWriter, req *http.Request) {
+	profiles, err := h.filterService.ListFilterProfiles(req.Context())
+	if err != nil {
+		vlog.Errorf("Failed to list filtering profiles: %v", err)
+		helpers.SendError(w, http.StatusInternalServerError, "Failed to list filtering profiles")
+		return
+	}
+
+	helpers.SendJSON(w, http.StatusOK, profiles)
+}
+
+// @Summary Create filtering profile
+// @Description Create a filtering profile: blocklists of DNS_FILTER_BLOCKLISTS, blocked and allowed domains, safe search and the schedules during which the profile applies
+// @Tags Filtering
+// @Accept json
+// @Produce json
+// @Param profile body models.FilterProfile true "Filtering profile"
+// @Success 201 {object} models.FilterProfile "Filtering profile created"
+// @Failure 400 {object} map[string]string "Invalid request body, domain, schedule or unknown blocklist"
+// @Failure 409 {object} map[string]string "Filtering profile already exists"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Security BearerAuth
+// @Security OAuth2Password
+// @Router /api/v1/filter-profiles [post]
+func (h *FilterHandler) CreateFilterProfile(w http.ResponseWriter, req *http.Request) {
+	var profile models.FilterProfile
+	if err := helpers.DecodeJSON(req.Body, &profile); err != nil {
+		helpers.SendError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	if err := h.filterService.CreateFilterProfile(req.Context(), &profile); err != nil {
+		vlog.Errorf("Failed to create filtering profile %s: %v", profile.Name, err)
+		if strings.Contains(err.Error(), "already exists") {
+			helpers.SendError(w, http.StatusConflict, err.Error())
+		} else if strings.Contains(err.Error(), "invalid") {
+			helpers.SendError(w, http.StatusBadRequest, err.Error())
+		} else {
+			helpers.SendError(w, http.StatusInternalServerError, "Failed to create filtering profile")
+		}
+		return
+	}
+
+	helpers.SendJSON(w, http.StatusCreated, profile)
+}
+
+// @Summary Get filtering profile
+// @Description Get a filtering profile by name
+// @Tags Filtering
+// @Produce json
+// @Param name path string true "Profile name (e.g., kids)"
+// @Success 200 {object} models.FilterProfile "Filtering profile"
+// @Failure 404 {object} map[string]string "Filtering profile not found"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Security BearerAuth
+// @Security OAuth2Password
+// @Router /api/v1/filter-profiles/{name} [get]
+func (h *FilterHandler) GetFilterProfile(w http.ResponseWriter, req *http.Request, name string) {
+	profile, err := h.filterService.GetFilterProfile(req.Context(), name)
+	if err != nil {
+		vlog.Errorf("Failed to get filtering profile %s: %v", name, err)
+		if strings.Contains(err.Error(), "not found") {
+			helpers.SendError(w, http.StatusNotFound, "Filtering profile not found")
+		} else {
+			helpers.SendError(w, http.StatusInternalServerError, "Failed to get filtering profile")
+		}
+		return
+	}
+
+	helpers.SendJSON(w, http.StatusOK, profile)
+}
+
+// @Summary Update filtering profile
+// @Description Replace the filtering of a profile; its client groups are filtered with the new settings
+// @Tags Filtering
+// @Accept json
+// @Produce json
+// @Param name path string true "Profile name (e.g., kids)"
+// @Param profile body models.FilterProfile true "Filtering profile"
+// @Success 200 {object} models.FilterProfile "Filtering profile updated"
+// @Failure 400 {object} map[string]string "Invalid request body, domain, schedule or unknown blocklist"
+// @Failure 404 {object} map[string]string "Filtering profile not found"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Security BearerAuth
+// @Security OAuth2Password
+// @Router /api/v1/filter-profiles/{name} [put]
+func (h *FilterHandler) UpdateFilterProfile(w http.ResponseWriter, req *http.Request, name string) {
+	var profile models.FilterProfile
+	if err := helpers.DecodeJSON(req.Body, &profile); err != nil {
+		helpers.SendError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	if err := h.filterService.UpdateFilterProfile(req.Context(), name, &profile); err != nil {
+		vlog.Errorf("Failed to update filtering profile %s: %v", name, err)
+		if strings.Contains(err.Error(), "not found") {
+			helpers.SendError(w, http.StatusNotFound, "Filtering profile not found")
+		} else if strings.Contains(err.Error(), "invalid") {
+			helpers.SendError(w, http.StatusBadRequest, err.Error())
+		} else {
+			helpers.SendError(w, http.StatusInternalServerError, "Failed to update filtering profile")
+		}
+		return
+	}
+
+	helpers.SendJSON(w, http.StatusOK, profile)
+}
+
+// @Summary Delete filtering profile
+// @Description Delete a filtering profile that no client group uses
+// @Tags Filtering
+// @Param name path string true "Profile name (e.g., kids)"
+// @Success 204 "Filtering profile deleted"
+// @Failure 404 {object} map[string]string "Filtering profile not found"
+// @Failure 409 {object} map[string]string "Filtering profile is used by a client group"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Security BearerAuth
+// @Security OAuth2Password
+// @Router /api/v1/filter-profiles/{name} [delete]
+func (h *FilterHandler) DeleteFilterProfile(w http.ResponseWriter, req *http.Request, name string) {
+	if err := h.filterService.DeleteFilterProfile(req.Context(), name); err != nil {
+		vlog.Errorf("Failed to delete filtering profile %s: %v", name, err)
+		if strings.Contains(err.Error(), "not found") {
+			helpers.SendError(w, http.StatusNotFound, "Filtering profile not found")
+		} else if strings.Contains(err.Error(), "is used by") {
+			helpers.SendError(w, http.StatusConflict, err.Error())
+		} else {
+			helpers.SendError(w, http.StatusInternalServerError, "Failed to delete filtering profile")
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
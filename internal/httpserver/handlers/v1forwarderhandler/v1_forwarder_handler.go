@@ -0,0 +1,164 @@
+package v1forwarderhandler
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/rogerwesterbo/godns/internal/httpserver/helpers"
+	"github.com/rogerwesterbo/godns/internal/models"
+	"github.com/rogerwesterbo/godns/internal/services/v1upstream"
+	"github.com/vitistack/common/pkg/loggers/vlog"
+)
+
+// ForwarderHandler handles conditional forwarder endpoints
+type ForwarderHandler struct {
+	upstreamService *v1upstream.UpstreamService
+}
+
+// NewForwarderHandler creates a new conditional forwarder handler
+func NewForwarderHandler(upstreamService *v1upstream.UpstreamService) *ForwarderHandler {
+	return &ForwarderHandler{
+		upstreamService: upstreamService,
+	}
+}
+
+// @Summary List forwarders
+// @Description List the conditional forwarders that send queries for a domain to their own upstream servers
+// @Tags Forwarders
+// @Produce json
+// @Success 200 {array} models.ConditionalForwarder "Conditional forwarders"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Security BearerAuth
+// @Security OAuth2Password
+// @Router /api/v1/forwarders [get]
+func (h *ForwarderHandler) ListForwarders(w http.ResponseWriter, req *http.Request) {
+	forwarders, err := h.upstreamService.ListForwarders(req.Context())
+	if err != nil {
+		vlog.Errorf("Failed to list forwarders: %v", err)
+		helpers.SendError(w, http.StatusInternalServerError, "Failed to list forwarders")
+		return
+	}
+
+	helpers.SendJSON(w, http.StatusOK, forwarders)
+}
+
+// @Summary Create forwarder
+// @Description Send queries for a domain and the names below it to its own upstream servers instead of the default upstream. The forwarder with the longest matching domain wins.
+// @Tags Forwarders
+// @Accept json
+// @Produce json
+// @Param forwarder body models.ConditionalForwarder true "Conditional forwarder"
+// @Success 201 {object} models.ConditionalForwarder "Forwarder created"
+// @Failure 400 {object} map[string]string "Invalid request body"
+// @Failure 409 {object} map[string]string "Forwarder already exists"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Security BearerAuth
+// @Security OAuth2Password
+// @Router /api/v1/forwarders [post]
+func (h *ForwarderHandler) CreateForwarder(w http.ResponseWriter, req *http.Request) {
+	var forwarder models.ConditionalForwarder
+	if err := helpers.DecodeJSON(req.Body, &forwarder); err != nil {
+		helpers.SendError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	if err := h.upstreamService.CreateForwarder(req.Context(), &forwarder); err != nil {
+		vlog.Errorf("Failed to create forwarder %s: %v", forwarder.Domain, err)
+		if strings.Contains(err.Error(), "already exists") {
+			helpers.SendError(w, http.StatusConflict, err.Error())
+		} else if strings.Contains(err.Error(), "invalid") {
+			helpers.SendError(w, http.StatusBadRequest, err.Error())
+		} else {
+			helpers.SendError(w, http.StatusInternalServerError, "Failed to create forwarder")
+		}
+		return
+	}
+
+	helpers.SendJSON(w, http.StatusCreated, forwarder)
+}
+
+// @Summary Get forwarder
+// @Description Get the conditional forwarder of a domain
+// @Tags Forwarders
+// @Produce json
+// @Param domain path string true "Domain (e.g., corp.internal)"
+// @Success 200 {object} models.ConditionalForwarder "Conditional forwarder"
+// @Failure 404 {object} map[string]string "Forwarder not found"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Security BearerAuth
+// @Security OAuth2Password
+// @Router /api/v1/forwarders/{domain} [get]
+func (h *ForwarderHandler) GetForwarder(w http.ResponseWriter, req *http.Request, domain string) {
+	forwarder, err := h.upstreamService.GetForwarder(req.Context(), domain)
+	if err != nil {
+		vlog.Errorf("Failed to get forwarder %s: %v", domain, err)
+		if strings.Contains(err.Error(), "not found") {
+			helpers.SendError(w, http.StatusNotFound, "Forwarder not found")
+		} else {
+			helpers.SendError(w, http.StatusInternalServerError, "Failed to get forwarder")
+		}
+		return
+	}
+
+	helpers.SendJSON(w, http.StatusOK, forwarder)
+}
+
+// @Summary Update forwarder
+// @Description Replace the upstream servers and settings of the conditional forwarder of a domain
+// @Tags Forwarders
+// @Accept json
+// @Produce json
+// @Param domain path string true "Domain (e.g., corp.internal)"
+// @Param forwarder body models.ConditionalForwarder true "Conditional forwarder"
+// @Success 200 {object} models.ConditionalForwarder "Forwarder updated"
+// @Failure 400 {object} map[string]string "Invalid request body"
+// @Failure 404 {object} map[string]string "Forwarder not found"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Security BearerAuth
+// @Security OAuth2Password
+// @Router /api/v1/forwarders/{domain} [put]
+func (h *ForwarderHandler) UpdateForwarder(w http.ResponseWriter, req *http.Request, domain string) {
+	var forwarder models.ConditionalForwarder
+	if err := helpers.DecodeJSON(req.Body, &forwarder); err != nil {
+		helpers.SendError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	if err := h.upstreamService.UpdateForwarder(req.Context(), domain, &forwarder); err != nil {
+		vlog.Errorf("Failed to update forwarder %s: %v", domain, err)
+		if strings.Contains(err.Error(), "not found") {
+			helpers.SendError(w, http.StatusNotFound, "Forwarder not found")
+		} else if strings.Contains(err.Error(), "invalid") {
+			helpers.SendError(w, http.StatusBadRequest, err.Error())
+		} else {
+			helpers.SendError(w, http.StatusInternalServerError, "Failed to update forwarder")
+		}
+		return
+	}
+
+	helpers.SendJSON(w, http.StatusOK, forwarder)
+}
+
+// @Summary Delete forwarder
+// @Description Send queries for a domain to the default upstream servers again
+// @Tags Forwarders
+// @Param domain path string true "Domain (e.g., corp.internal)"
+// @Success 204 "Forwarder deleted"
+// @Failure 404 {object} map[string]string "Forwarder not found"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Security BearerAuth
+// @Security OAuth2Password
+// @Router /api/v1/forwarders/{domain} [delete]
+func (h *ForwarderHandler) DeleteForwarder(w http.ResponseWriter, req *http.Request, domain string) {
+	if err := h.upstreamService.DeleteForwarder(req.Context(), domain); err != nil {
+		vlog.Errorf("Failed to delete forwarder %s: %v", domain, err)
+		if strings.Contains(err.Error(), "not found") {
+			helpers.SendError(w, http.StatusNotFound, "Forwarder not found")
+		} else {
+			helpers.SendError(w, http.StatusInternalServerError, "Failed to delete forwarder")
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -23,16 +23,17 @@ func NewRecordHandler(recordService *v1recordservice.V1RecordService) *RecordHan
 }
 
 // @Summary Create a DNS record
-// @Description Add a new DNS record to an existing zone
+// @Description Add a new DNS record to an existing zone. Records with the same name and type form an RRset. With the view query parameter the record is only served to the clients of that view, replacing the zone's RRset of the same name and type.
 // @Tags Records
 // @Accept json
 // @Produce json
 // @Param zone path string true "Zone name (e.g., example.lan)"
+// @Param view query string false "Split-horizon view the record is served to (default: all clients not in a view)"
 // @Param record body models.DNSRecord true "Record to create"
 // @Success 201 {object} models.DNSRecord "Record created"
 // @Failure 400 {object} map[string]string "Invalid request body"
 // @Failure 404 {object} map[string]string "Zone not found"
-// @Failure 409 {object} map[string]string "Record already exists"
+// @Failure 409 {object} map[string]string "Identical record already exists or zone is read-only"
 // @Failure 500 {object} map[string]string "Internal server error"
 // @Security BearerAuth
 // @Security OAuth2Password
@@ -44,11 +45,11 @@ func (h *RecordHandler) CreateRecord(w http.ResponseWriter, req *http.Request, d
 		return
 	}
 
-	if err := h.recordService.CreateRecord(req.Context(), domain, &record); err != nil {
+	if err := h.recordService.CreateRecord(req.Context(), domain, req.URL.Query().Get("view"), &record); err != nil {
 		vlog.Errorf("Failed to create record in zone %s: %v", domain, err)
 		if strings.Contains(err.Error(), "not found") {
 			helpers.SendError(w, http.StatusNotFound, "Zone not found")
-		} else if strings.Contains(err.Error(), "already exists") {
+		} else if strings.Contains(err.Error(), "already exists") || strings.Contains(err.Error(), "read-only") {
 			helpers.SendError(w, http.StatusConflict, err.Error())
 		} else if strings.Contains(err.Error(), "invalid") {
 			helpers.SendError(w, http.StatusBadRequest, err.Error())
@@ -61,46 +62,67 @@ func (h *RecordHandler) CreateRecord(w http.ResponseWriter, req *http.Request, d
 	helpers.SendJSON(w, http.StatusCreated, record)
 }
 
-// @Summary Get a DNS record
-// @Description Get a specific DNS record by name and type
+// @Summary Get a DNS record set
+// @Description Get all DNS records (the RRset) with a specific name and type
 // @Tags Records
 // @Produce json
 // @Param zone path string true "Zone name (e.g., example.lan)"
+// @Param view query string false "Split-horizon view the record is served to (default: all clients not in a view)"
 // @Param name path string true "Record name (e.g., www.example.lan.)"
 // @Param type path string true "Record type (e.g., A, AAAA, CNAME)"
-// @Success 200 {object} models.DNSRecord "Record details"
+// @Param value query string false "Only return the record with this value (RDATA)"
+// @Success 200 {array} models.DNSRecord "Records in the RRset"
 // @Failure 404 {object} map[string]string "Zone or record not found"
 // @Failure 500 {object} map[string]string "Internal server error"
 // @Security BearerAuth
 // @Security OAuth2Password
 // @Router /api/v1/zones/{zone}/records/{name}/{type} [get]
 func (h *RecordHandler) GetRecord(w http.ResponseWriter, req *http.Request, domain, name, recordType string) {
-	record, err := h.recordService.GetRecord(req.Context(), domain, name, recordType)
+	var records []models.DNSRecord
+	var err error
+
+	view := req.URL.Query().Get("view")
+
+	if value := req.URL.Query().Get("value"); value != "" {
+		var record *models.DNSRecord
+		record, err = h.recordService.GetRecord(req.Context(), domain, view, name, recordType, value)
+		if record != nil {
+			records = []models.DNSRecord{*record}
+		}
+	} else {
+		records, err = h.recordService.GetRecordSet(req.Context(), domain, view, name, recordType)
+	}
+
 	if err != nil {
 		vlog.Errorf("Failed to get record %s/%s in zone %s: %v", name, recordType, domain, err)
 		if strings.Contains(err.Error(), "not found") {
 			helpers.SendError(w, http.StatusNotFound, "Record not found")
+		} else if strings.Contains(err.Error(), "invalid") {
+			helpers.SendError(w, http.StatusBadRequest, err.Error())
 		} else {
 			helpers.SendError(w, http.StatusInternalServerError, "Failed to get record")
 		}
 		return
 	}
 
-	helpers.SendJSON(w, http.StatusOK, record)
+	helpers.SendJSON(w, http.StatusOK, records)
 }
 
 // @Summary Update a DNS record
-// @Description Update an existing DNS record
+// @Description Update an existing DNS record. When the RRset holds more than one record, the value query parameter selects which one to replace.
 // @Tags Records
 // @Accept json
 // @Produce json
 // @Param zone path string true "Zone name (e.g., example.lan)"
+// @Param view query string false "Split-horizon view the record is served to (default: all clients not in a view)"
 // @Param name path string true "Record name (e.g., www.example.lan.)"
 // @Param type path string true "Record type (e.g., A, AAAA, CNAME)"
+// @Param value query string false "Current value (RDATA) of the record to update"
 // @Param record body models.DNSRecord true "Updated record data"
 // @Success 200 {object} models.DNSRecord "Record updated"
 // @Failure 400 {object} map[string]string "Invalid request body"
 // @Failure 404 {object} map[string]string "Zone or record not found"
+// @Failure 409 {object} map[string]string "Record is ambiguous, already exists or zone is read-only"
 // @Failure 500 {object} map[string]string "Internal server error"
 // @Security BearerAuth
 // @Security OAuth2Password
@@ -112,10 +134,13 @@ func (h *RecordHandler) UpdateRecord(w http.ResponseWriter, req *http.Request, d
 		return
 	}
 
-	if err := h.recordService.UpdateRecord(req.Context(), domain, name, recordType, &record); err != nil {
+	value := req.URL.Query().Get("value")
+	if err := h.recordService.UpdateRecord(req.Context(), domain, req.URL.Query().Get("view"), name, recordType, value, &record); err != nil {
 		vlog.Errorf("Failed to update record %s/%s in zone %s: %v", name, recordType, domain, err)
 		if strings.Contains(err.Error(), "not found") {
 			helpers.SendError(w, http.StatusNotFound, "Record not found")
+		} else if strings.Contains(err.Error(), "ambiguous") || strings.Contains(err.Error(), "already exists") || strings.Contains(err.Error(), "read-only") {
+			helpers.SendError(w, http.StatusConflict, err.Error())
 		} else if strings.Contains(err.Error(), "invalid") {
 			helpers.SendError(w, http.StatusBadRequest, err.Error())
 		} else {
@@ -128,22 +153,30 @@ func (h *RecordHandler) UpdateRecord(w http.ResponseWriter, req *http.Request, d
 }
 
 // @Summary Delete a DNS record
-// @Description Delete a specific DNS record from a zone
+// @Description Delete a DNS record from a zone. Without the value query parameter the whole RRset is deleted.
 // @Tags Records
 // @Param zone path string true "Zone name (e.g., example.lan)"
+// @Param view query string false "Split-horizon view the record is served to (default: all clients not in a view)"
 // @Param name path string true "Record name (e.g., www.example.lan.)"
 // @Param type path string true "Record type (e.g., A, AAAA, CNAME)"
+// @Param value query string false "Value (RDATA) of the single record to delete"
 // @Success 204 "Record deleted"
 // @Failure 404 {object} map[string]string "Zone or record not found"
+// @Failure 409 {object} map[string]string "Zone is read-only"
 // @Failure 500 {object} map[string]string "Internal server error"
 // @Security BearerAuth
 // @Security OAuth2Password
 // @Router /api/v1/zones/{zone}/records/{name}/{type} [delete]
 func (h *RecordHandler) DeleteRecord(w http.ResponseWriter, req *http.Request, domain, name, recordType string) {
-	if err := h.recordService.DeleteRecord(req.Context(), domain, name, recordType); err != nil {
+	value := req.URL.Query().Get("value")
+	if err := h.recordService.DeleteRecord(req.Context(), domain, req.URL.Query().Get("view"), name, recordType, value); err != nil {
 		vlog.Errorf("Failed to delete record %s/%s in zone %s: %v", name, recordType, domain, err)
 		if strings.Contains(err.Error(), "not found") {
 			helpers.SendError(w, http.StatusNotFound, "Record not found")
+		} else if strings.Contains(err.Error(), "read-only") {
+			helpers.SendError(w, http.StatusConflict, err.Error())
+		} else if strings.Contains(err.Error(), "invalid") {
+			helpers.SendError(w, http.StatusBadRequest, err.Error())
 		} else {
 			helpers.SendError(w, http.StatusInternalServerError, "Failed to delete record")
 		}
@@ -154,16 +187,19 @@ func (h *RecordHandler) DeleteRecord(w http.ResponseWriter, req *http.Request, d
 }
 
 // @Summary Set DNS record status
-// @Description Enable or disable a specific DNS record
+// @Description Enable or disable a DNS record. Without the value query parameter every record in the RRset is updated.
 // @Tags Records
 // @Accept json
 // @Param zone path string true "Zone name (e.g., example.lan)"
+// @Param view query string false "Split-horizon view the record is served to (default: all clients not in a view)"
 // @Param name path string true "Record name (e.g., www.example.lan.)"
 // @Param type path string true "Record type (e.g., A, AAAA, CNAME)"
+// @Param value query string false "Value (RDATA) of the single record to update"
 // @Param status body object{enabled=bool} true "Record status"
 // @Success 204 "Record status updated"
 // @Failure 400 {object} map[string]string "Invalid request body"
 // @Failure 404 {object} map[string]string "Zone or record not found"
+// @Failure 409 {object} map[string]string "Zone is read-only"
 // @Failure 500 {object} map[string]string "Internal server error"
 // @Security BearerAuth
 // @Security OAuth2Password
@@ -178,10 +214,15 @@ func (h *RecordHandler) SetRecordStatus(w http.ResponseWriter, req *http.Request
 		return
 	}
 
-	if err := h.recordService.SetRecordEnabled(req.Context(), domain, name, recordType, statusReq.Enabled); err != nil {
+	value := req.URL.Query().Get("value")
+	if err := h.recordService.SetRecordEnabled(req.Context(), domain, req.URL.Query().Get("view"), name, recordType, value, statusReq.Enabled); err != nil {
 		vlog.Errorf("Failed to set record status for %s/%s in zone %s: %v", name, recordType, domain, err)
 		if strings.Contains(err.Error(), "not found") {
 			helpers.SendError(w, http.StatusNotFound, "Record not found")
+		} else if strings.Contains(err.Error(), "read-only") {
+			helpers.SendError(w, http.StatusConflict, err.Error())
+		} else if strings.Contains(err.Error(), "invalid") {
+			helpers.SendError(w, http.StatusBadRequest, err.Error())
 		} else {
 			helpers.SendError(w, http.StatusInternalServerError, "Failed to update record status")
 		}
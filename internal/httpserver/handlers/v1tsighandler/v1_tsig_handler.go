@@ -0,0 +1,154 @@
+package v1tsighandler
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/rogerwesterbo/godns/internal/httpserver/helpers"
+	"github.com/rogerwesterbo/godns/internal/models"
+	"github.com/rogerwesterbo/godns/internal/services/v1tsigservice"
+	"github.com/vitistack/common/pkg/loggers/vlog"
+)
+
+// TSIGHandler handles TSIG key endpoints
+type TSIGHandler struct {
+	tsigService *v1tsigservice.V1TSIGService
+}
+
+// NewTSIGHandler creates a new TSIG key handler
+func NewTSIGHandler(tsigService *v1tsigservice.V1TSIGService) *TSIGHandler {
+	return &TSIGHandler{
+		tsigService: tsigService,
+	}
+}
+
+// @Summary List TSIG keys
+// @Description List the TSIG keys managed through the API. Secrets are not returned.
+// @Tags TSIG Keys
+// @Produce json
+// @Success 200 {array} models.TSIGKey "List of TSIG keys"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Security BearerAuth
+// @Security OAuth2Password
+// @Router /api/v1/tsig-keys [get]
+func (h *TSIGHandler) ListKeys(w http.ResponseWriter, req *http.Request) {
+	keys, err := h.tsigService.ListKeys(req.Context())
+	if err != nil {
+		vlog.Errorf("Failed to list TSIG keys: %v", err)
+		helpers.SendError(w, http.StatusInternalServerError, "Failed to list TSIG keys")
+		return
+	}
+
+	helpers.SendJSON(w, http.StatusOK, keys)
+}
+
+// @Summary Create TSIG key
+// @Description Create a TSIG key (hmac-sha256 or hmac-sha512), optionally scoped to zones and operations (transfer, update, notify). A secret is generated when none is given; it is only returned in this response.
+// @Tags TSIG Keys
+// @Accept json
+// @Produce json
+// @Param key body models.TSIGKey true "TSIG key"
+// @Success 201 {object} models.TSIGKey "TSIG key created, with its secret"
+// @Failure 400 {object} map[string]string "Invalid request body"
+// @Failure 409 {object} map[string]string "TSIG key already exists"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Security BearerAuth
+// @Security OAuth2Password
+// @Router /api/v1/tsig-keys [post]
+func (h *TSIGHandler) CreateKey(w http.ResponseWriter, req *http.Request) {
+	var key models.TSIGKey
+	if err := helpers.DecodeJSON(req.Body, &key); err != nil {
+		helpers.SendError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	if err := h.tsigService.CreateKey(req.Context(), &key); err != nil {
+		vlog.Errorf("Failed to create TSIG key %s: %v", key.Name, err)
+		if strings.Contains(err.Error(), "already exists") {
+			helpers.SendError(w, http.StatusConflict, err.Error())
+		} else if strings.Contains(err.Error(), "invalid") {
+			helpers.SendError(w, http.StatusBadRequest, err.Error())
+		} else {
+			helpers.SendError(w, http.StatusInternalServerError, "Failed to create TSIG key")
+		}
+		return
+	}
+
+	helpers.SendJSON(w, http.StatusCreated, key)
+}
+
+// @Summary Get TSIG key
+// @Description Get a TSIG key without its secret
+// @Tags TSIG Keys
+// @Produce json
+// @Param name path string true "Key name (e.g., ddns-key.)"
+// @Success 200 {object} models.TSIGKey "TSIG key"
+// @Failure 404 {object} map[string]string "TSIG key not found"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Security BearerAuth
+// @Security OAuth2Password
+// @Router /api/v1/tsig-keys/{name} [get]
+func (h *TSIGHandler) GetKey(w http.ResponseWriter, req *http.Request, name string) {
+	key, err := h.tsigService.GetKey(req.Context(), name)
+	if err != nil {
+		vlog.Errorf("Failed to get TSIG key %s: %v", name, err)
+		if strings.Contains(err.Error(), "not found") {
+			helpers.SendError(w, http.StatusNotFound, "TSIG key not found")
+		} else {
+			helpers.SendError(w, http.StatusInternalServerError, "Failed to get TSIG key")
+		}
+		return
+	}
+
+	helpers.SendJSON(w, http.StatusOK, key)
+}
+
+// @Summary Rotate TSIG key
+// @Description Replace the secret of a TSIG key. The new secret is only returned in this response; messages signed with the old secret are rejected from now on.
+// @Tags TSIG Keys
+// @Produce json
+// @Param name path string true "Key name (e.g., ddns-key.)"
+// @Success 200 {object} models.TSIGKey "TSIG key with its new secret"
+// @Failure 404 {object} map[string]string "TSIG key not found"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Security BearerAuth
+// @Security OAuth2Password
+// @Router /api/v1/tsig-keys/{name}/rotate [post]
+func (h *TSIGHandler) RotateKey(w http.ResponseWriter, req *http.Request, name string) {
+	key, err := h.tsigService.RotateKey(req.Context(), name)
+	if err != nil {
+		vlog.Errorf("Failed to rotate TSIG key %s: %v", name, err)
+		if strings.Contains(err.Error(), "not found") {
+			helpers.SendError(w, http.StatusNotFound, "TSIG key not found")
+		} else {
+			helpers.SendError(w, http.StatusInternalServerError, "Failed to rotate TSIG key")
+		}
+		return
+	}
+
+	helpers.SendJSON(w, http.StatusOK, key)
+}
+
+// @Summary Revoke TSIG key
+// @Description Delete a TSIG key; messages signed with it are rejected from now on
+// @Tags TSIG Keys
+// @Param name path string true "Key name (e.g., ddns-key.)"
+// @Success 204 "TSIG key revoked"
+// @Failure 404 {object} map[string]string "TSIG key not found"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Security BearerAuth
+// @Security OAuth2Password
+// @Router /api/v1/tsig-keys/{name} [delete]
+func (h *TSIGHandler) RevokeKey(w http.ResponseWriter, req *http.Request, name string) {
+	if err := h.tsigService.RevokeKey(req.Context(), name); err != nil {
+		vlog.Errorf("Failed to revoke TSIG key %s: %v", name, err)
+		if strings.Contains(err.Error(), "not found") {
+			helpers.SendError(w, http.StatusNotFound, "TSIG key not found")
+		} else {
+			helpers.SendError(w, http.StatusInternalServerError, "Failed to revoke TSIG key")
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
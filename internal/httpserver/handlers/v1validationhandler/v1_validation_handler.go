@@ -0,0 +1,143 @@
+package v1validationhandler
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/rogerwesterbo/godns/internal/httpserver/helpers"
+	"github.com/rogerwesterbo/godns/internal/models"
+	"github.com/rogerwesterbo/godns/internal/services/v1validationservice"
+	"github.com/vitistack/common/pkg/loggers/vlog"
+)
+
+// ValidationHandler handles the trust anchor endpoints of DNSSEC validation
+type ValidationHandler struct {
+	validationService *v1validationservice.V1ValidationService
+}
+
+// NewValidationHandler creates a new DNSSEC validation handler
+// validationService is nil when DNSSEC validation is disabled.
+func NewValidationHandler(validationService *v1validationservice.V1ValidationService) *ValidationHandler {
+	return &ValidationHandler{
+		validationService: validationService,
+	}
+}
+
+// @Summary List trust anchors
+// @Description List the root trust anchors DNSSEC validation starts from, with their RFC 5011 states (add-pending, valid, missing, revoked)
+// @Tags DNSSEC Validation
+// @Produce json
+// @Success 200 {array} models.TrustAnchor "Trust anchors"
+// @Failure 400 {object} map[string]string "DNSSEC validation is not enabled"
+// @Security BearerAuth
+// @Security OAuth2Password
+// @Router /api/v1/dnssec/trust-anchors [get]
+func (h *ValidationHandler) ListTrustAnchors(w http.ResponseWriter, req *http.Request) {
+	if !h.enabled(w) {
+		return
+	}
+
+	helpers.SendJSON(w, http.StatusOK, h.validationService.TrustAnchors())
+}
+
+// @Summary List negative trust anchors
+// @Description List the domains DNSSEC validation is turned off for (RFC 7646)
+// @Tags DNSSEC Validation
+// @Produce json
+// @Success 200 {array} models.NegativeTrustAnchor "Negative trust anchors"
+// @Failure 400 {object} map[string]string "DNSSEC validation is not enabled"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Security BearerAuth
+// @Security OAuth2Password
+// @Router /api/v1/dnssec/negative-trust-anchors [get]
+func (h *ValidationHandler) ListNegativeTrustAnchors(w http.ResponseWriter, req *http.Request) {
+	if !h.enabled(w) {
+		return
+	}
+
+	ntas, err := h.validationService.ListNegativeTrustAnchors(req.Context())
+	if err != nil {
+		vlog.Errorf("Failed to list negative trust anchors: %v", err)
+		helpers.SendError(w, http.StatusInternalServerError, "Failed to list negative trust anchors")
+		return
+	}
+
+	helpers.SendJSON(w, http.StatusOK, ntas)
+}
+
+// @Summary Add negative trust anchor
+// @Description Turn DNSSEC validation off for a domain and the names below it, e.g. while its operator fixes broken signatures. Set expires_at to remove the anchor automatically.
+// @Tags DNSSEC Validation
+// @Accept json
+// @Produce json
+// @Param anchor body models.NegativeTrustAnchor true "Negative trust anchor"
+// @Success 201 {object} models.NegativeTrustAnchor "Negative trust anchor added"
+// @Failure 400 {object} map[string]string "Invalid request body or DNSSEC validation is not enabled"
+// @Failure 409 {object} map[string]string "Negative trust anchor already exists"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Security BearerAuth
+// @Security OAuth2Password
+// @Router /api/v1/dnssec/negative-trust-anchors [post]
+func (h *ValidationHandler) AddNegativeTrustAnchor(w http.ResponseWriter, req *http.Request) {
+	if !h.enabled(w) {
+		return
+	}
+
+	var nta models.NegativeTrustAnchor
+	if err := helpers.DecodeJSON(req.Body, &nta); err != nil {
+		helpers.SendError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	if err := h.validationService.AddNegativeTrustAnchor(req.Context(), &nta); err != nil {
+		vlog.Errorf("Failed to add negative trust anchor %s: %v", nta.Domain, err)
+		if strings.Contains(err.Error(), "already exists") {
+			helpers.SendError(w, http.StatusConflict, err.Error())
+		} else if strings.Contains(err.Error(), "invalid") {
+			helpers.SendError(w, http.StatusBadRequest, err.Error())
+		} else {
+			helpers.SendError(w, http.StatusInternalServerError, "Failed to add negative trust anchor")
+		}
+		return
+	}
+
+	helpers.SendJSON(w, http.StatusCreated, nta)
+}
+
+// @Summary Delete negative trust anchor
+// @Description Turn DNSSEC validation on again for a domain
+// @Tags DNSSEC Validation
+// @Param domain path string true "Domain (e.g., broken.example.com)"
+// @Success 204 "Negative trust anchor deleted"
+// @Failure 400 {object} map[string]string "DNSSEC validation is not enabled"
+// @Failure 404 {object} map[string]string "Negative trust anchor not found"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Security BearerAuth
+// @Security OAuth2Password
+// @Router /api/v1/dnssec/negative-trust-anchors/{domain} [delete]
+func (h *ValidationHandler) DeleteNegativeTrustAnchor(w http.ResponseWriter, req *http.Request, domain string) {
+	if !h.enabled(w) {
+		return
+	}
+
+	if err := h.validationService.DeleteNegativeTrustAnchor(req.Context(), domain); err != nil {
+		vlog.Errorf("Failed to delete negative trust anchor %s: %v", domain, err)
+		if strings.Contains(err.Error(), "not found") {
+			helpers.SendError(w, http.StatusNotFound, "Negative trust anchor not found")
+		} else {
+			helpers.SendError(w, http.StatusInternalServerError, "Failed to delete negative trust anchor")
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// enabled reports whether DNSSEC validation is enabled, and sends an error when it isn't
+func (h *ValidationHandler) enabled(w http.ResponseWriter) bool {
+	if h.validationService == nil {
+		helpers.SendError(w, http.StatusBadRequest, "DNSSEC validation is not enabled")
+		return false
+	}
+	return true
+}
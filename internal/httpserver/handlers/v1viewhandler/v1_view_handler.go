@@ -0,0 +1,164 @@
+package v1viewhandler
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/rogerwesterbo/godns/internal/httpserver/helpers"
+	"github.com/rogerwesterbo/godns/internal/models"
+	"github.com/rogerwesterbo/godns/internal/services/v1viewservice"
+	"github.com/vitistack/common/pkg/loggers/vlog"
+)
+
+// ViewHandler handles split-horizon view endpoints
+type ViewHandler struct {
+	viewService *v1viewservice.V1ViewService
+}
+
+// NewViewHandler creates a new view handler
+func NewViewHandler(viewService *v1viewservice.V1ViewService) *ViewHandler {
+	return &ViewHandler{
+		viewService: viewService,
+	}
+}
+
+// @Summary List views
+// @Description List the split-horizon views: named sets of client networks that get their own records of a zone
+// @Tags Views
+// @Produce json
+// @Success 200 {array} models.View "Views"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Security BearerAuth
+// @Security OAuth2Password
+// @Router /api/v1/views [get]
+func (h *ViewHandler) ListViews(w http.ResponseWriter, req *http.Request) {
+	views, err := h.viewService.ListViews(req.Context())
+	if err != nil {
+		vlog.Errorf("Failed to list views: %v", err)
+		helpers.SendError(w, http.StatusInternalServerError, "Failed to list views")
+		return
+	}
+
+	helpers.SendJSON(w, http.StatusOK, views)
+}
+
+// @Summary Create view
+// @Description Create a split-horizon view. Clients in its prefixes get the view's records of a zone instead of the default records; the view with the longest matching prefix wins.
+// @Tags Views
+// @Accept json
+// @Produce json
+// @Param view body models.View true "View"
+// @Success 201 {object} models.View "View created"
+// @Failure 400 {object} map[string]string "Invalid request body"
+// @Failure 409 {object} map[string]string "View already exists"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Security BearerAuth
+// @Security OAuth2Password
+// @Router /api/v1/views [post]
+func (h *ViewHandler) CreateView(w http.ResponseWriter, req *http.Request) {
+	var view models.View
+	if err := helpers.DecodeJSON(req.Body, &view); err != nil {
+		helpers.SendError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	if err := h.viewService.CreateView(req.Context(), &view); err != nil {
+		vlog.Errorf("Failed to create view %s: %v", view.Name, err)
+		if strings.Contains(err.Error(), "already exists") {
+			helpers.SendError(w, http.StatusConflict, err.Error())
+		} else if strings.Contains(err.Error(), "invalid") {
+			helpers.SendError(w, http.StatusBadRequest, err.Error())
+		} else {
+			helpers.SendError(w, http.StatusInternalServerError, "Failed to create view")
+		}
+		return
+	}
+
+	helpers.SendJSON(w, http.StatusCreated, view)
+}
+
+// @Summary Get view
+// @Description Get a split-horizon view by name
+// @Tags Views
+// @Produce json
+// @Param name path string true "View name (e.g., office)"
+// @Success 200 {object} models.View "View"
+// @Failure 404 {object} map[string]string "View not found"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Security BearerAuth
+// @Security OAuth2Password
+// @Router /api/v1/views/{name} [get]
+func (h *ViewHandler) GetView(w http.ResponseWriter, req *http.Request, name string) {
+	view, err := h.viewService.GetView(req.Context(), name)
+	if err != nil {
+		vlog.Errorf("Failed to get view %s: %v", name, err)
+		if strings.Contains(err.Error(), "not found") {
+			helpers.SendError(w, http.StatusNotFound, "View not found")
+		} else {
+			helpers.SendError(w, http.StatusInternalServerError, "Failed to get view")
+		}
+		return
+	}
+
+	helpers.SendJSON(w, http.StatusOK, view)
+}
+
+// @Summary Update view
+// @Description Replace the client prefixes and description of a split-horizon view
+// @Tags Views
+// @Accept json
+// @Produce json
+// @Param name path string true "View name (e.g., office)"
+// @Param view body models.View true "View"
+// @Success 200 {object} models.View "View updated"
+// @Failure 400 {object} map[string]string "Invalid request body"
+// @Failure 404 {object} map[string]string "View not found"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Security BearerAuth
+// @Security OAuth2Password
+// @Router /api/v1/views/{name} [put]
+func (h *ViewHandler) UpdateView(w http.ResponseWriter, req *http.Request, name string) {
+	var view models.View
+	if err := helpers.DecodeJSON(req.Body, &view); err != nil {
+		helpers.SendError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	if err := h.viewService.UpdateView(req.Context(), name, &view); err != nil {
+		vlog.Errorf("Failed to update view %s: %v", name, err)
+		if strings.Contains(err.Error(), "not found") {
+			helpers.SendError(w, http.StatusNotFound, "View not found")
+		} else if strings.Contains(err.Error(), "invalid") {
+			helpers.SendError(w, http.StatusBadRequest, err.Error())
+		} else {
+			helpers.SendError(w, http.StatusInternalServerError, "Failed to update view")
+		}
+		return
+	}
+
+	helpers.SendJSON(w, http.StatusOK, view)
+}
+
+// @Summary Delete view
+// @Description Delete a split-horizon view; its clients get the default records again. The records of zones for the view are kept.
+// @Tags Views
+// @Param name path string true "View name (e.g., office)"
+// @Success 204 "View deleted"
+// @Failure 404 {object} map[string]string "View not found"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Security BearerAuth
+// @Security OAuth2Password
+// @Router /api/v1/views/{name} [delete]
+func (h *ViewHandler) DeleteView(w http.ResponseWriter, req *http.Request, name string) {
+	if err := h.viewService.DeleteView(req.Context(), name); err != nil {
+		vlog.Errorf("Failed to delete view %s: %v", name, err)
+		if strings.Contains(err.Error(), "not found") {
+			helpers.SendError(w, http.StatusNotFound, "View not found")
+		} else {
+			helpers.SendError(w, http.StatusInternalServerError, "Failed to delete view")
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
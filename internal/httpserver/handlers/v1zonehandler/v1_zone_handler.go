@@ -6,19 +6,29 @@ import (
 
 	"github.com/rogerwesterbo/godns/internal/httpserver/helpers"
 	"github.com/rogerwesterbo/godns/internal/models"
+	"github.com/rogerwesterbo/godns/internal/services/v1dnssecservice"
+	"github.com/rogerwesterbo/godns/internal/services/v1secondaryservice"
 	"github.com/rogerwesterbo/godns/internal/services/v1zoneservice"
 	"github.com/vitistack/common/pkg/loggers/vlog"
 )
 
+// dnssecUnavailable is the error for zones enabling DNSSEC on a server without an encryption key
+const dnssecUnavailable = "invalid zone: DNSSEC is not available, the server has no DNS_DNSSEC_ENCRYPTION_KEY configured"
+
 // ZoneHandler handles DNS zone endpoints
 type ZoneHandler struct {
-	zoneService *v1zoneservice.V1ZoneService
+	zoneService      *v1zoneservice.V1ZoneService
+	secondaryService *v1secondaryservice.SecondaryService
+	dnssecService    *v1dnssecservice.V1DNSSECService
 }
 
 // NewZoneHandler creates a new zone handler
-func NewZoneHandler(zoneService *v1zoneservice.V1ZoneService) *ZoneHandler {
+// dnssecService is nil when no DNSSEC encryption key is configured; zones can't enable DNSSEC then.
+func NewZoneHandler(zoneService *v1zoneservice.V1ZoneService, secondaryService *v1secondaryservice.SecondaryService, dnssecService *v1dnssecservice.V1DNSSECService) *ZoneHandler {
 	return &ZoneHandler{
-		zoneService: zoneService,
+		zoneService:      zoneService,
+		secondaryService: secondaryService,
+		dnssecService:    dnssecService,
 	}
 }
 
@@ -43,7 +53,7 @@ func (h *ZoneHandler) ListZones(w http.ResponseWriter, req *http.Request) {
 }
 
 // @Summary Create a new DNS zone
-// @Description Create a new DNS zone with optional records
+// @Description Create a new DNS zone with optional records. Set dnssec.enabled to sign the zone's responses; its keys are generated on creation.
 // @Tags Zones
 // @Accept json
 // @Produce json
@@ -61,6 +71,10 @@ func (h *ZoneHandler) CreateZone(w http.ResponseWriter, req *http.Request) {
 		helpers.SendError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
 		return
 	}
+	if zone.Signed() && h.dnssecService == nil {
+		helpers.SendError(w, http.StatusBadRequest, dnssecUnavailable)
+		return
+	}
 
 	if err := h.zoneService.CreateZone(req.Context(), &zone); err != nil {
 		vlog.Errorf("Failed to create zone: %v", err)
@@ -73,6 +87,9 @@ func (h *ZoneHandler) CreateZone(w http.ResponseWriter, req *http.Request) {
 		}
 		return
 	}
+	if !h.ensureDNSSECKeys(w, req, &zone) {
+		return
+	}
 
 	helpers.SendJSON(w, http.StatusCreated, zone)
 }
@@ -104,7 +121,7 @@ func (h *ZoneHandler) GetZone(w http.ResponseWriter, req *http.Request, domain s
 }
 
 // @Summary Update a DNS zone
-// @Description Update an existing DNS zone (replaces all records)
+// @Description Update an existing DNS zone (replaces all records and settings). Enabling DNSSEC generates the zone's keys; changing the algorithm replaces them.
 // @Tags Zones
 // @Accept json
 // @Produce json
@@ -123,6 +140,10 @@ func (h *ZoneHandler) UpdateZone(w http.ResponseWriter, req *http.Request, domai
 		helpers.SendError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
 		return
 	}
+	if zone.Signed() && h.dnssecService == nil {
+		helpers.SendError(w, http.StatusBadRequest, dnssecUnavailable)
+		return
+	}
 
 	if err := h.zoneService.UpdateZone(req.Context(), domain, &zone); err != nil {
 		vlog.Errorf("Failed to update zone %s: %v", domain, err)
@@ -135,6 +156,9 @@ func (h *ZoneHandler) UpdateZone(w http.ResponseWriter, req *http.Request, domai
 		}
 		return
 	}
+	if !h.ensureDNSSECKeys(w, req, &zone) {
+		return
+	}
 
 	helpers.SendJSON(w, http.StatusOK, zone)
 }
@@ -198,3 +222,56 @@ func (h *ZoneHandler) SetZoneStatus(w http.ResponseWriter, req *http.Request, do
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// @Summary Refresh a secondary zone
+// @Description Schedule an immediate refresh of a secondary zone from its primaries. The result is reported in the zone's secondary_status.
+// @Tags Zones
+// @Param domain path string true "Domain name (e.g., example.lan)"
+// @Success 202 "Refresh scheduled"
+// @Failure 400 {object} map[string]string "Zone is not a secondary zone"
+// @Failure 404 {object} map[string]string "Zone not found"
+// @Failure 503 {object} map[string]string "Secondary zones are disabled"
+// @Security BearerAuth
+// @Security OAuth2Password
+// @Router /api/v1/zones/{domain}/refresh [post]
+func (h *ZoneHandler) RefreshZone(w http.ResponseWriter, req *http.Request, domain string) {
+	zone, err := h.zoneService.GetZone(req.Context(), domain)
+	if err != nil {
+		vlog.Errorf("Failed to get zone %s: %v", domain, err)
+		if strings.Contains(err.Error(), "not found") {
+			helpers.SendError(w, http.StatusNotFound, "Zone not found")
+		} else {
+			helpers.SendError(w, http.StatusInternalServerError, "Failed to get zone")
+		}
+		return
+	}
+
+	if !zone.IsSecondary() {
+		helpers.SendError(w, http.StatusBadRequest, "Zone "+zone.Domain+" is not a secondary zone")
+		return
+	}
+
+	if h.secondaryService == nil {
+		helpers.SendError(w, http.StatusServiceUnavailable, "Secondary zones are disabled")
+		return
+	}
+
+	h.secondaryService.Trigger(zone.Domain)
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// ensureDNSSECKeys generates the signing keys of a saved zone that enables DNSSEC
+// It reports whether the response can be sent; otherwise an error was sent.
+func (h *ZoneHandler) ensureDNSSECKeys(w http.ResponseWriter, req *http.Request, zone *models.DNSZone) bool {
+	if !zone.Signed() {
+		return true
+	}
+
+	if err := h.dnssecService.EnsureKeys(req.Context(), zone.Domain, zone.DNSSEC); err != nil {
+		vlog.Errorf("Failed to generate DNSSEC keys for zone %s: %v", zone.Domain, err)
+		helpers.SendError(w, http.StatusInternalServerError, "Zone saved, but its DNSSEC keys could not be generated")
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,109 @@
+package v1zonetransferhandler
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/rogerwesterbo/godns/internal/httpserver/helpers"
+	"github.com/rogerwesterbo/godns/internal/models"
+	"github.com/rogerwesterbo/godns/internal/services/v1zonetransferservice"
+	"github.com/vitistack/common/pkg/loggers/vlog"
+)
+
+// ZoneTransferHandler handles zone transfer ACL endpoints
+type ZoneTransferHandler struct {
+	transferService *v1zonetransferservice.V1ZoneTransferService
+}
+
+// NewZoneTransferHandler creates a new zone transfer handler
+func NewZoneTransferHandler(transferService *v1zonetransferservice.V1ZoneTransferService) *ZoneTransferHandler {
+	return &ZoneTransferHandler{
+		transferService: transferService,
+	}
+}
+
+// @Summary Get zone transfer ACL
+// @Description Get the clients allowed to transfer a zone with AXFR/IXFR
+// @Tags Zone Transfers
+// @Produce json
+// @Param zone path string true "Zone name (e.g., example.lan)"
+// @Success 200 {object} models.ZoneTransferACL "Transfer ACL"
+// @Failure 404 {object} map[string]string "Transfer ACL not found"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Security BearerAuth
+// @Security OAuth2Password
+// @Router /api/v1/zones/{zone}/transfer [get]
+func (h *ZoneTransferHandler) GetACL(w http.ResponseWriter, req *http.Request, domain string) {
+	acl, err := h.transferService.GetACL(req.Context(), domain)
+	if err != nil {
+		vlog.Errorf("Failed to get transfer ACL for %s: %v", domain, err)
+		if strings.Contains(err.Error(), "not found") {
+			helpers.SendError(w, http.StatusNotFound, "Transfer ACL not found")
+		} else {
+			helpers.SendError(w, http.StatusInternalServerError, "Failed to get transfer ACL")
+		}
+		return
+	}
+
+	helpers.SendJSON(w, http.StatusOK, acl)
+}
+
+// @Summary Set zone transfer ACL
+// @Description Allow client networks (and optionally TSIG keys) to transfer a zone with AXFR/IXFR
+// @Tags Zone Transfers
+// @Accept json
+// @Produce json
+// @Param zone path string true "Zone name (e.g., example.lan)"
+// @Param acl body models.ZoneTransferACL true "Transfer ACL"
+// @Success 200 {object} models.ZoneTransferACL "Transfer ACL saved"
+// @Failure 400 {object} map[string]string "Invalid request body"
+// @Failure 404 {object} map[string]string "Zone not found"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Security BearerAuth
+// @Security OAuth2Password
+// @Router /api/v1/zones/{zone}/transfer [put]
+func (h *ZoneTransferHandler) SetACL(w http.ResponseWriter, req *http.Request, domain string) {
+	var acl models.ZoneTransferACL
+	if err := helpers.DecodeJSON(req.Body, &acl); err != nil {
+		helpers.SendError(w, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return
+	}
+
+	if err := h.transferService.SetACL(req.Context(), domain, &acl); err != nil {
+		vlog.Errorf("Failed to set transfer ACL for %s: %v", domain, err)
+		if strings.Contains(err.Error(), "not found") {
+			helpers.SendError(w, http.StatusNotFound, "Zone not found")
+		} else if strings.Contains(err.Error(), "invalid") {
+			helpers.SendError(w, http.StatusBadRequest, err.Error())
+		} else {
+			helpers.SendError(w, http.StatusInternalServerError, "Failed to set transfer ACL")
+		}
+		return
+	}
+
+	helpers.SendJSON(w, http.StatusOK, acl)
+}
+
+// @Summary Delete zone transfer ACL
+// @Description Remove the transfer ACL of a zone, which disables AXFR/IXFR for it
+// @Tags Zone Transfers
+// @Param zone path string true "Zone name (e.g., example.lan)"
+// @Success 204 "Transfer ACL deleted"
+// @Failure 404 {object} map[string]string "Transfer ACL not found"
+// @Failure 500 {object} map[string]string "Internal server error"
+// @Security BearerAuth
+// @Security OAuth2Password
+// @Router /api/v1/zones/{zone}/transfer [delete]
+func (h *ZoneTransferHandler) DeleteACL(w http.ResponseWriter, req *http.Request, domain string) {
+	if err := h.transferService.DeleteACL(req.Context(), domain); err != nil {
+		vlog.Errorf("Failed to delete transfer ACL for %s: %v", domain, err)
+		if strings.Contains(err.Error(), "not found") {
+			helpers.SendError(w, http.StatusNotFound, "Transfer ACL not found")
+		} else {
+			helpers.SendError(w, http.StatusInternalServerError, "Failed to delete transfer ACL")
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -9,26 +9,42 @@ import (
 	"github.com/rogerwesterbo/godns/internal/httpserver/httproutes"
 	"github.com/rogerwesterbo/godns/internal/httpserver/middleware"
 	"github.com/rogerwesterbo/godns/internal/services/v1cacheservice"
+	"github.com/rogerwesterbo/godns/internal/services/v1dnssecservice"
+	"github.com/rogerwesterbo/godns/internal/services/v1filterservice"
 	"github.com/rogerwesterbo/godns/internal/services/v1healthcheckservice"
 	"github.com/rogerwesterbo/godns/internal/services/v1loadbalancerservice"
+	"github.com/rogerwesterbo/godns/internal/services/v1policyservice"
 	"github.com/rogerwesterbo/godns/internal/services/v1querylogservice"
 	"github.com/rogerwesterbo/godns/internal/services/v1ratelimitservice"
+	"github.com/rogerwesterbo/godns/internal/services/v1secondaryservice"
+	"github.com/rogerwesterbo/godns/internal/services/v1tsigservice"
+	"github.com/rogerwesterbo/godns/internal/services/v1upstream"
+	"github.com/rogerwesterbo/godns/internal/services/v1validationservice"
+	"github.com/rogerwesterbo/godns/internal/services/v1viewservice"
 	"github.com/rogerwesterbo/godns/internal/services/v1zoneservice"
 	"github.com/vitistack/common/pkg/loggers/vlog"
 )
 
 // HTTPServer represents the HTTP API server
 type HTTPServer struct {
-	address        string
-	server         *http.Server
-	zoneService    *v1zoneservice.V1ZoneService
-	cacheService   *v1cacheservice.DNSCache
-	rateLimiter    *v1ratelimitservice.RateLimiter
-	loadBalancer   *v1loadbalancerservice.LoadBalancer
-	healthCheck    *v1healthcheckservice.HealthCheckService
-	queryLog       *v1querylogservice.QueryLogService
-	authMiddleware *middleware.AuthMiddleware
-	corsMiddleware *middleware.CORSMiddleware
+	address           string
+	server            *http.Server
+	zoneService       *v1zoneservice.V1ZoneService
+	cacheService      *v1cacheservice.DNSCache
+	rateLimiter       *v1ratelimitservice.RateLimiter
+	loadBalancer      *v1loadbalancerservice.LoadBalancer
+	healthCheck       *v1healthcheckservice.HealthCheckService
+	queryLog          *v1querylogservice.QueryLogService
+	secondaryService  *v1secondaryservice.SecondaryService
+	tsigService       *v1tsigservice.V1TSIGService
+	dnssecService     *v1dnssecservice.V1DNSSECService
+	validationService *v1validationservice.V1ValidationService
+	upstreamService   *v1upstream.UpstreamService
+	viewService       *v1viewservice.V1ViewService
+	policyService     *v1policyservice.V1PolicyService
+	filterService     *v1filterservice.V1FilterService
+	authMiddleware    *middleware.AuthMiddleware
+	corsMiddleware    *middleware.CORSMiddleware
 }
 
 // New creates a new HTTP server instance
@@ -40,6 +56,14 @@ func New(
 	loadBalancer *v1loadbalancerservice.LoadBalancer,
 	healthCheck *v1healthcheckservice.HealthCheckService,
 	queryLog *v1querylogservice.QueryLogService,
+	secondaryService *v1secondaryservice.SecondaryService,
+	tsigService *v1tsigservice.V1TSIGService,
+	dnssecService *v1dnssecservice.V1DNSSECService,
+	validationService *v1validationservice.V1ValidationService,
+	upstreamService *v1upstream.UpstreamService,
+	viewService *v1viewservice.V1ViewService,
+	policyService *v1policyservice.V1PolicyService,
+	filterService *v1filterservice.V1FilterService,
 ) (*HTTPServer, error) {
 	// Initialize authentication middleware
 	authMiddleware, err := middleware.NewAuthMiddleware()
@@ -51,15 +75,23 @@ func New(
 	corsMiddleware := middleware.NewCORSMiddleware()
 
 	return &HTTPServer{
-		address:        address,
-		zoneService:    zoneService,
-		cacheService:   cacheService,
-		rateLimiter:    rateLimiter,
-		loadBalancer:   loadBalancer,
-		healthCheck:    healthCheck,
-		queryLog:       queryLog,
-		authMiddleware: authMiddleware,
-		corsMiddleware: corsMiddleware,
+		address:           address,
+		zoneService:       zoneService,
+		cacheService:      cacheService,
+		rateLimiter:       rateLimiter,
+		loadBalancer:      loadBalancer,
+		healthCheck:       healthCheck,
+		queryLog:          queryLog,
+		secondaryService:  secondaryService,
+		tsigService:       tsigService,
+		dnssecService:     dnssecService,
+		validationService: validationService,
+		upstreamService:   upstreamService,
+		viewService:       viewService,
+		policyService:     policyService,
+		filterService:     filterService,
+		authMiddleware:    authMiddleware,
+		corsMiddleware:    corsMiddleware,
 	}, nil
 }
 
@@ -73,6 +105,14 @@ func (s *HTTPServer) Start() error {
 		s.loadBalancer,
 		s.healthCheck,
 		s.queryLog,
+		s.secondaryService,
+		s.tsigService,
+		s.dnssecService,
+		s.validationService,
+		s.upstreamService,
+		s.viewService,
+		s.policyService,
+		s.filterService,
 		s.authMiddleware,
 	)
 
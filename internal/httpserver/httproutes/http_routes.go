@@ -5,33 +5,59 @@ import (
 	"strings"
 
 	"github.com/rogerwesterbo/godns/internal/httpserver/handlers/v1adminhandler"
+	"github.com/rogerwesterbo/godns/internal/httpserver/handlers/v1dnssechandler"
+	"github.com/rogerwesterbo/godns/internal/httpserver/handlers/v1dynamicupdatehandler"
 	"github.com/rogerwesterbo/godns/internal/httpserver/handlers/v1exporthandler"
+	"github.com/rogerwesterbo/godns/internal/httpserver/handlers/v1filterhandler"
+	"github.com/rogerwesterbo/godns/internal/httpserver/handlers/v1forwarderhandler"
 	"github.com/rogerwesterbo/godns/internal/httpserver/handlers/v1recordhandler"
 	"github.com/rogerwesterbo/godns/internal/httpserver/handlers/v1searchhandler"
+	"github.com/rogerwesterbo/godns/internal/httpserver/handlers/v1tsighandler"
+	"github.com/rogerwesterbo/godns/internal/httpserver/handlers/v1validationhandler"
+	"github.com/rogerwesterbo/godns/internal/httpserver/handlers/v1viewhandler"
 	"github.com/rogerwesterbo/godns/internal/httpserver/handlers/v1zonehandler"
+	"github.com/rogerwesterbo/godns/internal/httpserver/handlers/v1zonetransferhandler"
 	"github.com/rogerwesterbo/godns/internal/httpserver/middleware"
 	_ "github.com/rogerwesterbo/godns/internal/httpserver/swaggerdocs" // swagger docs
 	"github.com/rogerwesterbo/godns/internal/services/v1cacheservice"
+	"github.com/rogerwesterbo/godns/internal/services/v1dnssecservice"
+	"github.com/rogerwesterbo/godns/internal/services/v1dynamicupdateservice"
 	"github.com/rogerwesterbo/godns/internal/services/v1exportservice"
+	"github.com/rogerwesterbo/godns/internal/services/v1filterservice"
 	"github.com/rogerwesterbo/godns/internal/services/v1healthcheckservice"
 	"github.com/rogerwesterbo/godns/internal/services/v1loadbalancerservice"
+	"github.com/rogerwesterbo/godns/internal/services/v1policyservice"
 	"github.com/rogerwesterbo/godns/internal/services/v1querylogservice"
 	"github.com/rogerwesterbo/godns/internal/services/v1ratelimitservice"
 	"github.com/rogerwesterbo/godns/internal/services/v1recordservice"
 	"github.com/rogerwesterbo/godns/internal/services/v1searchservice"
+	"github.com/rogerwesterbo/godns/internal/services/v1secondaryservice"
+	"github.com/rogerwesterbo/godns/internal/services/v1tsigservice"
+	"github.com/rogerwesterbo/godns/internal/services/v1upstream"
+	"github.com/rogerwesterbo/godns/internal/services/v1validationservice"
+	"github.com/rogerwesterbo/godns/internal/services/v1viewservice"
 	"github.com/rogerwesterbo/godns/internal/services/v1zoneservice"
+	"github.com/rogerwesterbo/godns/internal/services/v1zonetransferservice"
 	httpSwagger "github.com/swaggo/http-swagger"
 )
 
 // Router holds the handlers and provides HTTP routing
 type Router struct {
-	mux            *http.ServeMux
-	zoneHandler    *v1zonehandler.ZoneHandler
-	recordHandler  *v1recordhandler.RecordHandler
-	exportHandler  *v1exporthandler.ExportHandler
-	searchHandler  *v1searchhandler.SearchHandler
-	adminHandler   *v1adminhandler.AdminHandler
-	authMiddleware *middleware.AuthMiddleware
+	mux               *http.ServeMux
+	zoneHandler       *v1zonehandler.ZoneHandler
+	recordHandler     *v1recordhandler.RecordHandler
+	exportHandler     *v1exporthandler.ExportHandler
+	searchHandler     *v1searchhandler.SearchHandler
+	adminHandler      *v1adminhandler.AdminHandler
+	transferHandler   *v1zonetransferhandler.ZoneTransferHandler
+	updateHandler     *v1dynamicupdatehandler.DynamicUpdateHandler
+	tsigHandler       *v1tsighandler.TSIGHandler
+	dnssecHandler     *v1dnssechandler.DNSSECHandler
+	validationHandler *v1validationhandler.ValidationHandler
+	forwarderHandler  *v1forwarderhandler.ForwarderHandler
+	viewHandler       *v1viewhandler.ViewHandler
+	filterHandler     *v1filterhandler.FilterHandler
+	authMiddleware    *middleware.AuthMiddleware
 }
 
 // NewRouter creates a new HTTP router with all routes configured
@@ -42,19 +68,35 @@ func NewRouter(
 	loadBalancer *v1loadbalancerservice.LoadBalancer,
 	healthCheck *v1healthcheckservice.HealthCheckService,
 	queryLog *v1querylogservice.QueryLogService,
+	secondaryService *v1secondaryservice.SecondaryService,
+	tsigService *v1tsigservice.V1TSIGService,
+	dnssecService *v1dnssecservice.V1DNSSECService,
+	validationService *v1validationservice.V1ValidationService,
+	upstreamService *v1upstream.UpstreamService,
+	viewService *v1viewservice.V1ViewService,
+	policyService *v1policyservice.V1PolicyService,
+	filterService *v1filterservice.V1FilterService,
 	authMiddleware *middleware.AuthMiddleware,
 ) *http.ServeMux {
 	exportService := v1exportservice.NewV1ExportService(zoneService)
 	searchService := v1searchservice.NewV1SearchService(zoneService)
 
 	r := &Router{
-		mux:            http.NewServeMux(),
-		zoneHandler:    v1zonehandler.NewZoneHandler(zoneService),
-		recordHandler:  v1recordhandler.NewRecordHandler(v1recordservice.NewV1RecordService(zoneService.GetClient())),
-		exportHandler:  v1exporthandler.NewExportHandler(exportService),
-		searchHandler:  v1searchhandler.NewSearchHandler(searchService),
-		adminHandler:   v1adminhandler.NewAdminHandler(cacheService, rateLimiter, loadBalancer, healthCheck, queryLog),
-		authMiddleware: authMiddleware,
+		mux:               http.NewServeMux(),
+		zoneHandler:       v1zonehandler.NewZoneHandler(zoneService, secondaryService, dnssecService),
+		recordHandler:     v1recordhandler.NewRecordHandler(v1recordservice.NewV1RecordService(zoneService)),
+		exportHandler:     v1exporthandler.NewExportHandler(exportService),
+		searchHandler:     v1searchhandler.NewSearchHandler(searchService),
+		adminHandler:      v1adminhandler.NewAdminHandler(cacheService, rateLimiter, loadBalancer, healthCheck, queryLog, zoneService.GetNotifyService(), upstreamService, policyService),
+		transferHandler:   v1zonetransferhandler.NewZoneTransferHandler(v1zonetransferservice.NewV1ZoneTransferService(zoneService)),
+		updateHandler:     v1dynamicupdatehandler.NewDynamicUpdateHandler(v1dynamicupdateservice.NewV1DynamicUpdateService(zoneService)),
+		tsigHandler:       v1tsighandler.NewTSIGHandler(tsigService),
+		dnssecHandler:     v1dnssechandler.NewDNSSECHandler(zoneService, dnssecService),
+		validationHandler: v1validationhandler.NewValidationHandler(validationService),
+		forwarderHandler:  v1forwarderhandler.NewForwarderHandler(upstreamService),
+		viewHandler:       v1viewhandler.NewViewHandler(viewService),
+		filterHandler:     v1filterhandler.NewFilterHandler(filterService),
+		authMiddleware:    authMiddleware,
 	}
 
 	r.registerRoutes()
@@ -105,6 +147,32 @@ func (r *Router) handleAPIRoutes(w http.ResponseWriter, req *http.Request) {
 		r.handleExport(w, req)
 	case strings.HasPrefix(path, "/api/v1/export/"):
 		r.handleExportZone(w, req)
+	case path == "/api/v1/tsig-keys":
+		r.handleTSIGKeys(w, req)
+	case strings.HasPrefix(path, "/api/v1/tsig-keys/"):
+		r.handleTSIGKeyOperations(w, req)
+	case path == "/api/v1/dnssec/trust-anchors":
+		r.handleTrustAnchors(w, req)
+	case path == "/api/v1/dnssec/negative-trust-anchors":
+		r.handleNegativeTrustAnchors(w, req)
+	case strings.HasPrefix(path, "/api/v1/dnssec/negative-trust-anchors/"):
+		r.handleNegativeTrustAnchorOperations(w, req)
+	case path == "/api/v1/forwarders":
+		r.handleForwarders(w, req)
+	case strings.HasPrefix(path, "/api/v1/forwarders/"):
+		r.handleForwarderOperations(w, req)
+	case path == "/api/v1/views":
+		r.handleViews(w, req)
+	case strings.HasPrefix(path, "/api/v1/views/"):
+		r.handleViewOperations(w, req)
+	case path == "/api/v1/client-groups":
+		r.handleClientGroups(w, req)
+	case strings.HasPrefix(path, "/api/v1/client-groups/"):
+		r.handleClientGroupOperations(w, req)
+	case path == "/api/v1/filter-profiles":
+		r.handleFilterProfiles(w, req)
+	case strings.HasPrefix(path, "/api/v1/filter-profiles/"):
+		r.handleFilterProfileOperations(w, req)
 	case strings.HasPrefix(path, "/api/v1/admin/"):
 		r.handleAdmin(w, req)
 	default:
@@ -158,9 +226,224 @@ func (r *Router) handleZones(w http.ResponseWriter, req *http.Request) {
 	}
 }
 
+// Handle TSIG key list and create
+func (r *Router) handleTSIGKeys(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		r.tsigHandler.ListKeys(w, req)
+	case http.MethodPost:
+		r.tsigHandler.CreateKey(w, req)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// Handle individual TSIG key operations
+func (r *Router) handleTSIGKeyOperations(w http.ResponseWriter, req *http.Request) {
+	// Parse path: /api/v1/tsig-keys/{name}[/rotate]
+	path := strings.TrimPrefix(req.URL.Path, "/api/v1/tsig-keys/")
+	parts := strings.Split(path, "/")
+
+	if len(parts) == 0 || parts[0] == "" {
+		http.Error(w, "Key name is required", http.StatusBadRequest)
+		return
+	}
+
+	name := parts[0]
+
+	if len(parts) >= 2 && parts[1] == "rotate" {
+		if req.Method == http.MethodPost {
+			r.tsigHandler.RotateKey(w, req, name)
+		} else {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	switch req.Method {
+	case http.MethodGet:
+		r.tsigHandler.GetKey(w, req, name)
+	case http.MethodDelete:
+		r.tsigHandler.RevokeKey(w, req, name)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// Handle trust anchor list
+func (r *Router) handleTrustAnchors(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	r.validationHandler.ListTrustAnchors(w, req)
+}
+
+// Handle negative trust anchor list and add
+func (r *Router) handleNegativeTrustAnchors(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		r.validationHandler.ListNegativeTrustAnchors(w, req)
+	case http.MethodPost:
+		r.validationHandler.AddNegativeTrustAnchor(w, req)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// Handle individual negative trust anchor operations
+func (r *Router) handleNegativeTrustAnchorOperations(w http.ResponseWriter, req *http.Request) {
+	// Parse path: /api/v1/dnssec/negative-trust-anchors/{domain}
+	domain := strings.TrimPrefix(req.URL.Path, "/api/v1/dnssec/negative-trust-anchors/")
+	if domain == "" {
+		http.Error(w, "Domain is required", http.StatusBadRequest)
+		return
+	}
+
+	if req.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	r.validationHandler.DeleteNegativeTrustAnchor(w, req, domain)
+}
+
+// Handle forwarder list and create
+func (r *Router) handleForwarders(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		r.forwarderHandler.ListForwarders(w, req)
+	case http.MethodPost:
+		r.forwarderHandler.CreateForwarder(w, req)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// Handle individual forwarder operations
+func (r *Router) handleForwarderOperations(w http.ResponseWriter, req *http.Request) {
+	// Parse path: /api/v1/forwarders/{domain}
+	domain := strings.TrimPrefix(req.URL.Path, "/api/v1/forwarders/")
+	if domain == "" {
+		http.Error(w, "Domain is required", http.StatusBadRequest)
+		return
+	}
+
+	switch req.Method {
+	case http.MethodGet:
+		r.forwarderHandler.GetForwarder(w, req, domain)
+	case http.MethodPut:
+		r.forwarderHandler.UpdateForwarder(w, req, domain)
+	case http.MethodDelete:
+		r.forwarderHandler.DeleteForwarder(w, req, domain)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// Handle view list and create
+func (r *Router) handleViews(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		r.viewHandler.ListViews(w, req)
+	case http.MethodPost:
+		r.viewHandler.CreateView(w, req)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// Handle individual view operations
+func (r *Router) handleViewOperations(w http.ResponseWriter, req *http.Request) {
+	// Parse path: /api/v1/views/{name}
+	name := strings.TrimPrefix(req.URL.Path, "/api/v1/views/")
+	if name == "" {
+		http.Error(w, "View name is required", http.StatusBadRequest)
+		return
+	}
+
+	switch req.Method {
+	case http.MethodGet:
+		r.viewHandler.GetView(w, req, name)
+	case http.MethodPut:
+		r.viewHandler.UpdateView(w, req, name)
+	case http.MethodDelete:
+		r.viewHandler.DeleteView(w, req, name)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// Handle client group list and create
+func (r *Router) handleClientGroups(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		r.filterHandler.ListClientGroups(w, req)
+	case http.MethodPost:
+		r.filterHandler.CreateClientGroup(w, req)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// Handle individual client group operations
+func (r *Router) handleClientGroupOperations(w http.ResponseWriter, req *http.Request) {
+	// Parse path: /api/v1/client-groups/{name}
+	name := strings.TrimPrefix(req.URL.Path, "/api/v1/client-groups/")
+	if name == "" {
+		http.Error(w, "Client group name is required", http.StatusBadRequest)
+		return
+	}
+
+	switch req.Method {
+	case http.MethodGet:
+		r.filterHandler.GetClientGroup(w, req, name)
+	case http.MethodPut:
+		r.filterHandler.UpdateClientGroup(w, req, name)
+	case http.MethodDelete:
+		r.filterHandler.DeleteClientGroup(w, req, name)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// Handle filtering profile list and create
+func (r *Router) handleFilterProfiles(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		r.filterHandler.ListFilterProfiles(w, req)
+	case http.MethodPost:
+		r.filterHandler.CreateFilterProfile(w, req)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// Handle individual filtering profile operations
+func (r *Router) handleFilterProfileOperations(w http.ResponseWriter, req *http.Request) {
+	// Parse path: /api/v1/filter-profiles/{name}
+	name := strings.TrimPrefix(req.URL.Path, "/api/v1/filter-profiles/")
+	if name == "" {
+		http.Error(w, "Profile name is required", http.StatusBadRequest)
+		return
+	}
+
+	switch req.Method {
+	case http.MethodGet:
+		r.filterHandler.GetFilterProfile(w, req, name)
+	case http.MethodPut:
+		r.filterHandler.UpdateFilterProfile(w, req, name)
+	case http.MethodDelete:
+		r.filterHandler.DeleteFilterProfile(w, req, name)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
 // Handle individual zone operations and records
 func (r *Router) handleZoneOperations(w http.ResponseWriter, req *http.Request) {
-	// Parse path: /api/v1/zones/{domain}[/records[/{name}/{type}]]
+	// Parse path: /api/v1/zones/{domain}[/status|/refresh|/transfer|/update-policy|/ds|/dnssec[/rollover|/ds-published]|/records[/{name}/{type}]]
 	path := strings.TrimPrefix(req.URL.Path, "/api/v1/zones/")
 	parts := strings.Split(path, "/")
 
@@ -181,6 +464,75 @@ func (r *Router) handleZoneOperations(w http.ResponseWriter, req *http.Request)
 		return
 	}
 
+	// Check if this is a secondary zone refresh
+	if len(parts) >= 2 && parts[1] == "refresh" {
+		if req.Method == http.MethodPost {
+			r.zoneHandler.RefreshZone(w, req, domain)
+		} else {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	// Check if this is a zone transfer ACL operation
+	if len(parts) >= 2 && parts[1] == "transfer" {
+		switch req.Method {
+		case http.MethodGet:
+			r.transferHandler.GetACL(w, req, domain)
+		case http.MethodPut:
+			r.transferHandler.SetACL(w, req, domain)
+		case http.MethodDelete:
+			r.transferHandler.DeleteACL(w, req, domain)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	// Check if this is a dynamic update policy operation
+	if len(parts) >= 2 && parts[1] == "update-policy" {
+		switch req.Method {
+		case http.MethodGet:
+			r.updateHandler.GetPolicy(w, req, domain)
+		case http.MethodPut:
+			r.updateHandler.SetPolicy(w, req, domain)
+		case http.MethodDelete:
+			r.updateHandler.DeletePolicy(w, req, domain)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	// Check if this is a DS record export
+	if len(parts) >= 2 && parts[1] == "ds" {
+		if req.Method == http.MethodGet {
+			r.dnssecHandler.GetDS(w, req, domain)
+		} else {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	// Check if this is a DNSSEC key operation
+	if len(parts) >= 2 && parts[1] == "dnssec" {
+		action := ""
+		if len(parts) >= 3 {
+			action = parts[2]
+		}
+		switch {
+		case action == "" && req.Method == http.MethodGet:
+			r.dnssecHandler.GetStatus(w, req, domain)
+		case action == "rollover" && req.Method == http.MethodPost:
+			r.dnssecHandler.StartRollover(w, req, domain)
+		case action == "ds-published" && req.Method == http.MethodPost:
+			r.dnssecHandler.ConfirmDS(w, req, domain)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
 	// Check if this is a record operation
 	if len(parts) >= 2 && parts[1] == "records" {
 		r.handleRecordOperations(w, req, domain, parts[2:])
@@ -298,6 +650,27 @@ func (r *Router) handleAdmin(w http.ResponseWriter, req *http.Request) {
 		}
 		r.adminHandler.GetRateLimiterStats(w, req)
 
+	case "notify/stats":
+		if req.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		r.adminHandler.GetNotifyStats(w, req)
+
+	case "upstream/stats":
+		if req.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		r.adminHandler.GetUpstreamStats(w, req)
+
+	case "policies/stats":
+		if req.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		r.adminHandler.GetPolicyStats(w, req)
+
 	default:
 		http.NotFound(w, req)
 	}
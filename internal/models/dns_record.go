@@ -1,6 +1,12 @@
 package models
 
-import "fmt"
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/miekg/dns"
+)
 
 // DNSRecord represents a DNS record stored in the system
 // Each record type has common fields (Name, Type, TTL) plus type-specific fields
@@ -41,17 +47,29 @@ type DNSRecord struct {
 
 // DNSZone represents a DNS zone configuration
 type DNSZone struct {
-	Domain  string      `json:"domain" example:"example.lan."` // e.g., "example.lan."
-	Records []DNSRecord `json:"records"`                       // DNS records in this zone
-	Enabled bool        `json:"enabled"`                       // Whether the zone is enabled/active
+	Domain     string      `json:"domain" example:"example.lan."`                               // e.g., "example.lan."
+	Records    []DNSRecord `json:"records"`                                                     // DNS records in this zone
+	Enabled    bool        `json:"enabled"`                                                     // Whether the zone is enabled/active
+	AlsoNotify []string    `json:"also_notify,omitempty" example:"192.168.1.53,10.0.0.53:5353"` // Secondaries sent a NOTIFY when the zone changes
+	Serial     uint32      `json:"serial,omitempty" example:"2024110601"`                       // SOA serial for zones without a SOA record (maintained automatically)
+	Kind       string      `json:"kind,omitempty" example:"primary"`                            // primary (default) or secondary
+	Primaries  []string    `json:"primaries,omitempty" example:"192.168.1.10"`                  // Primary servers a secondary zone is transferred from
+
+	DNSSEC *DNSSECSettings `json:"dnssec,omitempty"` // Online DNSSEC signing of the zone's responses
+
+	SecondaryStatus *SecondaryStatus `json:"secondary_status,omitempty"` // Transfer state of a secondary zone (read-only)
+
+	Views []ZoneView `json:"views,omitempty"` // Records served instead to the clients of split-horizon views
 }
 
 // GetRData returns the RDATA (resource data) string for the DNS record
 // This converts type-specific fields into the wire format string
 func (r *DNSRecord) GetRData() string {
 	switch r.Type {
-	case "A", "AAAA", "CNAME", "ALIAS", "NS", "PTR", "TXT":
+	case "A", "AAAA", "CNAME", "ALIAS", "NS", "PTR":
 		return r.Value
+	case "TXT":
+		return quoteTXT(r.Value)
 	case "MX":
 		if r.MXPriority != nil && r.MXHost != nil {
 			return fmt.Sprintf("%d %s", *r.MXPriority, *r.MXHost)
@@ -80,6 +98,18 @@ func (r *DNSRecord) GetRData() string {
 	}
 }
 
+// MatchesValue reports whether value identifies this record within its RRset.
+// Both the RDATA representation and the raw value field are accepted, so a TXT
+// record can be addressed with or without its surrounding quotes.
+func (r *DNSRecord) MatchesValue(value string) bool {
+	return r.GetRData() == value || (r.Value != "" && r.Value == value)
+}
+
+// SameRRSet reports whether two records belong to the same RRset (owner name and type)
+func (r *DNSRecord) SameRRSet(other *DNSRecord) bool {
+	return r.Name == other.Name && r.Type == other.Type
+}
+
 // Validate checks if the DNS record has all required fields for its type
 func (r *DNSRecord) Validate() error {
 	if r.Name == "" {
@@ -88,9 +118,18 @@ func (r *DNSRecord) Validate() error {
 	if r.Type == "" {
 		return fmt.Errorf("record type is required")
 	}
+	if strings.Contains(r.Name, "*") {
+		// RFC 4592: the asterisk must be the complete leftmost label
+		if !r.IsWildcard() || strings.Contains(r.Name[2:], "*") {
+			return fmt.Errorf("invalid wildcard name %s: '*' must be the entire leftmost label", r.Name)
+		}
+		if r.Type == "SOA" || r.Type == "NS" {
+			return fmt.Errorf("%s record cannot have a wildcard name", r.Type)
+		}
+	}
 
 	switch r.Type {
-	case "A", "AAAA", "CNAME", "ALIAS", "NS", "PTR", "TXT":
+	case "A", "AAAA", "CNAME", "ALIAS", "NS", "PTR", "TXT", "DS":
 		if r.Value == "" {
 			return fmt.Errorf("%s record requires a value", r.Type)
 		}
@@ -125,6 +164,85 @@ func (r *DNSRecord) Validate() error {
 	return nil
 }
 
+// IsWildcard reports whether the record owner name is a wildcard (e.g. *.apps.example.lan.)
+func (r *DNSRecord) IsWildcard() bool {
+	return strings.HasPrefix(r.Name, "*.")
+}
+
+// MatchesWildcard reports whether name is covered by the record's wildcard owner name,
+// i.e. name has at least one label in place of the asterisk. Closer names that exist in
+// the zone take precedence over the wildcard when answering queries (RFC 4592).
+func (r *DNSRecord) MatchesWildcard(name string) bool {
+	if !r.IsWildcard() {
+		return false
+	}
+	parent := dns.Fqdn(r.Name[2:])
+	name = dns.Fqdn(name)
+	return dns.IsSubDomain(parent, name) && dns.CountLabel(name) > dns.CountLabel(parent)
+}
+
+// CheckCNAMEConflicts enforces that a CNAME is the only record at its owner name (RFC 1034 section 3.6.2)
+// A name can hold at most one CNAME and no other record types next to it.
+func CheckCNAMEConflicts(records []DNSRecord) error {
+	for i := range records {
+		if records[i].Type != "CNAME" {
+			continue
+		}
+		for j := range records {
+			if i == j || !strings.EqualFold(records[i].Name, records[j].Name) {
+				continue
+			}
+			if records[j].Type == "CNAME" {
+				return fmt.Errorf("name %s cannot have more than one CNAME record", records[i].Name)
+			}
+			return fmt.Errorf("CNAME record %s cannot coexist with %s record at the same name", records[i].Name, records[j].Type)
+		}
+	}
+	return nil
+}
+
+// FilterRecordSet returns the records that make up the RRset for name and type
+func FilterRecordSet(records []DNSRecord, name, recordType string) []DNSRecord {
+	result := make([]DNSRecord, 0)
+	for _, record := range records {
+		if record.Name == name && record.Type == recordType {
+			result = append(result, record)
+		}
+	}
+	return result
+}
+
+// DecodeRecordSet decodes a stored RRset
+// RRsets are stored as a JSON array; a single JSON object written by older
+// versions is accepted and returned as a one-element set.
+func DecodeRecordSet(data string) ([]DNSRecord, error) {
+	trimmed := strings.TrimSpace(data)
+	if strings.HasPrefix(trimmed, "[") {
+		var records []DNSRecord
+		if err := json.Unmarshal([]byte(trimmed), &records); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal record set: %w", err)
+		}
+		return records, nil
+	}
+
+	var record DNSRecord
+	if err := json.Unmarshal([]byte(trimmed), &record); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal record: %w", err)
+	}
+	return []DNSRecord{record}, nil
+}
+
+// quoteTXT wraps TXT data in quotes so it is parsed as a single character-string
+// Values that are already quoted are returned unchanged.
+func quoteTXT(value string) string {
+	if strings.HasPrefix(value, "\"") && strings.HasSuffix(value, "\"") && len(value) > 1 {
+		return value
+	}
+	escaped := strings.ReplaceAll(value, `\`, `\\`)
+	escaped = strings.ReplaceAll(escaped, `"`, `\"`)
+	return "\"" + escaped + "\""
+}
+
 // Helper functions to create common record types
 
 // NewARecord creates an A record
@@ -0,0 +1,152 @@
+package models
+
+import (
+	"testing"
+)
+
+func TestDecodeRecordSet(t *testing.T) {
+	tests := []struct {
+		name      string
+		data      string
+		wantCount int
+		wantErr   bool
+	}{
+		{
+			name:      "record set array",
+			data:      `[{"name":"www.example.lan.","type":"A","ttl":300,"value":"192.168.1.1"},{"name":"www.example.lan.","type":"A","ttl":300,"value":"192.168.1.2"}]`,
+			wantCount: 2,
+		},
+		{
+			name:      "legacy single record",
+			data:      `{"name":"www.example.lan.","type":"A","ttl":300,"value":"192.168.1.1"}`,
+			wantCount: 1,
+		},
+		{
+			name:    "invalid data",
+			data:    `not json`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, err := DecodeRecordSet(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DecodeRecordSet() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(records) != tt.wantCount {
+				t.Errorf("DecodeRecordSet() returned %d records, want %d", len(records), tt.wantCount)
+			}
+		})
+	}
+}
+
+func TestFilterRecordSet(t *testing.T) {
+	records := []DNSRecord{
+		NewARecord("www.example.lan.", "192.168.1.1", 300),
+		NewARecord("www.example.lan.", "192.168.1.2", 300),
+		NewAAAARecord("www.example.lan.", "fd00::1", 300),
+		NewARecord("mail.example.lan.", "192.168.1.3", 300),
+	}
+
+	set := FilterRecordSet(records, "www.example.lan.", "A")
+	if len(set) != 2 {
+		t.Fatalf("FilterRecordSet() returned %d records, want 2", len(set))
+	}
+	if set[0].Value != "192.168.1.1" || set[1].Value != "192.168.1.2" {
+		t.Errorf("FilterRecordSet() did not keep record order: %v", set)
+	}
+}
+
+func TestGetRDataQuotesTXT(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{`v=spf1 mx -all`, `"v=spf1 mx -all"`},
+		{`"already quoted"`, `"already quoted"`},
+		{`say "hi"`, `"say \"hi\""`},
+	}
+
+	for _, tt := range tests {
+		record := NewTXTRecord("example.lan.", tt.value, 300)
+		if got := record.GetRData(); got != tt.want {
+			t.Errorf("GetRData(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+		if !record.MatchesValue(tt.value) {
+			t.Errorf("MatchesValue(%q) = false, want true", tt.value)
+		}
+	}
+}
+
+func TestValidateWildcard(t *testing.T) {
+	tests := []struct {
+		name       string
+		record     DNSRecord
+		wantErr    bool
+		matches    string
+		wantsMatch bool
+	}{
+		{"wildcard A", NewARecord("*.apps.example.lan.", "10.0.1.100", 300), false, "pr-1.apps.example.lan.", true},
+		{"wildcard one-character label", NewARecord("*.apps.example.lan.", "10.0.1.100", 300), false, "a.apps.example.lan.", true},
+		{"wildcard several labels", NewARecord("*.apps.example.lan.", "10.0.1.100", 300), false, "a.b.apps.example.lan.", true},
+		{"wildcard case-insensitive", NewARecord("*.apps.example.lan.", "10.0.1.100", 300), false, "A.Apps.Example.LAN.", true},
+		{"wildcard does not match a name ending in its parent label", NewARecord("*.apps.example.lan.", "10.0.1.100", 300), false, "xapps.example.lan.", false},
+		{"wildcard does not match its parent", NewARecord("*.apps.example.lan.", "10.0.1.100", 300), false, "apps.example.lan.", false},
+		{"partial label", NewARecord("web*.example.lan.", "10.0.1.100", 300), true, "", false},
+		{"asterisk in inner label", NewARecord("a.*.example.lan.", "10.0.1.100", 300), true, "", false},
+		{"wildcard NS", NewNSRecord("*.example.lan.", "ns1.example.lan.", 300), true, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.record.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.matches != "" && tt.record.MatchesWildcard(tt.matches) != tt.wantsMatch {
+				t.Errorf("MatchesWildcard(%q) = %v, want %v", tt.matches, !tt.wantsMatch, tt.wantsMatch)
+			}
+		})
+	}
+}
+
+func TestCheckCNAMEConflicts(t *testing.T) {
+	tests := []struct {
+		name    string
+		records []DNSRecord
+		wantErr bool
+	}{
+		{
+			name: "single CNAME",
+			records: []DNSRecord{
+				NewCNAMERecord("www.example.lan.", "web.example.lan.", 300),
+				NewARecord("web.example.lan.", "192.168.1.10", 300),
+			},
+		},
+		{
+			name: "CNAME next to A",
+			records: []DNSRecord{
+				NewCNAMERecord("www.example.lan.", "web.example.lan.", 300),
+				NewARecord("www.example.lan.", "192.168.1.10", 300),
+			},
+			wantErr: true,
+		},
+		{
+			name: "two CNAMEs",
+			records: []DNSRecord{
+				NewCNAMERecord("www.example.lan.", "web1.example.lan.", 300),
+				NewCNAMERecord("WWW.example.lan.", "web2.example.lan.", 300),
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := CheckCNAMEConflicts(tt.records); (err != nil) != tt.wantErr {
+				t.Errorf("CheckCNAMEConflicts() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
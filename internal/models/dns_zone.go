@@ -0,0 +1,173 @@
+package models
+
+import (
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Defaults used when a zone has no SOA record of its own
+const (
+	DefaultSOATTL     = 3600
+	DefaultSOARefresh = 3600
+	DefaultSOARetry   = 1800
+	DefaultSOAExpire  = 604800
+	DefaultSOAMinimum = 300
+)
+
+// SOARecord returns the enabled SOA record of the zone
+// When the zone has none, a SOA is synthesised from defaults, using the first
+// NS record as primary name server.
+func (z *DNSZone) SOARecord() DNSRecord {
+	for _, record := range z.Records {
+		if record.Type == "SOA" && !record.Disabled {
+			return record
+		}
+	}
+
+	domain := dns.Fqdn(z.Domain)
+	mname := domain
+	for _, record := range z.Records {
+		if record.Type == "NS" && !record.Disabled {
+			mname = dns.Fqdn(record.Value)
+			break
+		}
+	}
+
+	serial := z.Serial
+	if serial == 0 {
+		serial = 1
+	}
+
+	return NewSOARecord(domain, mname, "hostmaster."+domain, serial,
+		DefaultSOARefresh, DefaultSOARetry, DefaultSOAExpire, DefaultSOAMinimum, DefaultSOATTL)
+}
+
+// SOASerial returns the SOA serial of the zone
+func (z *DNSZone) SOASerial() uint32 {
+	soa := z.SOARecord()
+	return soa.SOASerialValue()
+}
+
+// BumpSerial advances the SOA serial after a change to the zone
+// previous is the serial before the change. A serial that was already raised
+// by the caller is kept; otherwise the next serial is written to the SOA record,
+// or to the zone itself when it has no SOA record.
+func (z *DNSZone) BumpSerial(previous uint32, now time.Time) uint32 {
+	if current := z.SOASerial(); SerialGreater(current, previous) {
+		return current
+	}
+
+	next := NextSerial(previous, now)
+	for i := range z.Records {
+		record := &z.Records[i]
+		if record.Type != "SOA" || record.Disabled {
+			continue
+		}
+		record.setSOASerial(next)
+		return next
+	}
+
+	z.Serial = next
+	return next
+}
+
+// setSOASerial replaces the serial of a SOA record
+// A new value is allocated, copies of the record keep their serial.
+func (r *DNSRecord) setSOASerial(serial uint32) {
+	if r.SOASerial == nil {
+		fields := strings.Fields(r.Value)
+		if len(fields) >= 3 {
+			fields[2] = strconv.FormatUint(uint64(serial), 10)
+			r.Value = strings.Join(fields, " ")
+			return
+		}
+	}
+	r.SOASerial = &serial
+}
+
+// NextSerial returns the serial following current, using the YYYYMMDDnn convention
+// Serials below today's date based serial jump to it, others are incremented.
+func NextSerial(current uint32, now time.Time) uint32 {
+	now = now.UTC()
+	today := uint32(now.Year()*1000000 + int(now.Month())*10000 + now.Day()*100) // #nosec G115 -- dates fit in uint32 until year 4294
+	if SerialGreater(today, current) {
+		return today
+	}
+	return current + 1
+}
+
+// SerialGreater reports whether serial a is newer than b using RFC 1982 arithmetic
+func SerialGreater(a, b uint32) bool {
+	return a != b && a-b < 1<<31
+}
+
+// ValidateAlsoNotify checks and normalizes the also-notify targets to ip:port
+// Targets without a port use port 53.
+func (z *DNSZone) ValidateAlsoNotify() error {
+	for i, target := range z.AlsoNotify {
+		addrPort, err := ParseServerAddr(target)
+		if err != nil {
+			return fmt.Errorf("invalid also-notify target: %w", err)
+		}
+		z.AlsoNotify[i] = addrPort.String()
+	}
+	return nil
+}
+
+// ParseServerAddr parses a name server IP address with an optional port (default 53)
+func ParseServerAddr(target string) (netip.AddrPort, error) {
+	target = strings.TrimSpace(target)
+	if addrPort, err := netip.ParseAddrPort(target); err == nil {
+		return addrPort, nil
+	}
+
+	addr, err := netip.ParseAddr(strings.Trim(target, "[]"))
+	if err != nil {
+		return netip.AddrPort{}, fmt.Errorf("%q must be an IP address with optional port", target)
+	}
+	return netip.AddrPortFrom(addr.Unmap(), 53), nil
+}
+
+// SOASerialValue returns the serial of a SOA record, reading the legacy value field if needed
+func (r *DNSRecord) SOASerialValue() uint32 {
+	if r.SOASerial != nil {
+		return *r.SOASerial
+	}
+
+	fields := strings.Fields(r.Value)
+	if len(fields) < 3 {
+		return 0
+	}
+	serial, err := strconv.ParseUint(fields[2], 10, 32)
+	if err != nil {
+		return 0
+	}
+	return uint32(serial)
+}
+
+// ToRR converts the record to a miekg/dns resource record
+// ALIAS records have no wire format and cannot be converted.
+func (r *DNSRecord) ToRR() (dns.RR, error) {
+	if r.Type == "ALIAS" {
+		return nil, fmt.Errorf("ALIAS record %s has no wire format", r.Name)
+	}
+
+	// Build the RR string format: "name TTL class type rdata"
+	// GetRData renders the type-specific fields (MX, SRV, SOA, CAA)
+	rrString := fmt.Sprintf("%s %d IN %s %s", r.Name, r.TTL, r.Type, r.GetRData())
+
+	rr, err := dns.NewRR(rrString)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create RR from string: %w", err)
+	}
+	if rr == nil {
+		return nil, fmt.Errorf("empty RR for record %s", r.Name)
+	}
+
+	return rr, nil
+}
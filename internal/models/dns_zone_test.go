@@ -0,0 +1,105 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBumpSerial(t *testing.T) {
+	now := time.Date(2025, 1, 15, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		zone     DNSZone
+		previous uint32
+		want     uint32
+	}{
+		{
+			name:     "older serial jumps to today",
+			zone:     DNSZone{Domain: "example.lan.", Records: []DNSRecord{NewSOARecord("example.lan.", "ns1.example.lan.", "hostmaster.example.lan.", 2024110601, 3600, 1800, 604800, 300, 3600)}},
+			previous: 2024110601,
+			want:     2025011500,
+		},
+		{
+			name:     "serial of today is incremented",
+			zone:     DNSZone{Domain: "example.lan.", Records: []DNSRecord{NewSOARecord("example.lan.", "ns1.example.lan.", "hostmaster.example.lan.", 2025011507, 3600, 1800, 604800, 300, 3600)}},
+			previous: 2025011507,
+			want:     2025011508,
+		},
+		{
+			name:     "serial raised by the caller is kept",
+			zone:     DNSZone{Domain: "example.lan.", Records: []DNSRecord{NewSOARecord("example.lan.", "ns1.example.lan.", "hostmaster.example.lan.", 2025020100, 3600, 1800, 604800, 300, 3600)}},
+			previous: 2025011507,
+			want:     2025020100,
+		},
+		{
+			name:     "zone without SOA record",
+			zone:     DNSZone{Domain: "example.lan."},
+			previous: 1,
+			want:     2025011500,
+		},
+		{
+			name: "legacy SOA value",
+			zone: DNSZone{Domain: "example.lan.", Records: []DNSRecord{
+				{Name: "example.lan.", Type: "SOA", TTL: 3600, Value: "ns1.example.lan. hostmaster.example.lan. 7 3600 1800 604800 300"},
+			}},
+			previous: 7,
+			want:     2025011500,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := tt.zone
+			before.Records = append([]DNSRecord(nil), tt.zone.Records...)
+			original := before.SOASerial()
+
+			if got := tt.zone.BumpSerial(tt.previous, now); got != tt.want {
+				t.Errorf("BumpSerial() = %d, want %d", got, tt.want)
+			}
+			if got := tt.zone.SOASerial(); got != tt.want {
+				t.Errorf("SOASerial() after bump = %d, want %d", got, tt.want)
+			}
+			if got := before.SOASerial(); got != original {
+				t.Errorf("BumpSerial() changed the serial of a copied record to %d", got)
+			}
+		})
+	}
+}
+
+func TestSerialGreater(t *testing.T) {
+	tests := []struct {
+		a, b uint32
+		want bool
+	}{
+		{2, 1, true},
+		{1, 2, false},
+		{1, 1, false},
+		{0, 4294967295, true}, // wrap-around
+	}
+
+	for _, tt := range tests {
+		if got := SerialGreater(tt.a, tt.b); got != tt.want {
+			t.Errorf("SerialGreater(%d, %d) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestValidateAlsoNotify(t *testing.T) {
+	zone := DNSZone{AlsoNotify: []string{"192.168.1.53", "10.0.0.53:5353", "fd00::53"}}
+	if err := zone.ValidateAlsoNotify(); err != nil {
+		t.Fatalf("ValidateAlsoNotify() error = %v", err)
+	}
+
+	want := []string{"192.168.1.53:53", "10.0.0.53:5353", "[fd00::53]:53"}
+	for i := range want {
+		if zone.AlsoNotify[i] != want[i] {
+			t.Errorf("AlsoNotify[%d] = %q, want %q", i, zone.AlsoNotify[i], want[i])
+		}
+	}
+
+	invalid := DNSZone{AlsoNotify: []string{"ns2.example.lan"}}
+	if err := invalid.ValidateAlsoNotify(); err == nil {
+		t.Error("ValidateAlsoNotify() accepted a host name")
+	}
+}
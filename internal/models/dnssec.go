@@ -0,0 +1,157 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// DNSSEC signing algorithms
+const (
+	DNSSECAlgorithmECDSAP256SHA256 = "ECDSAP256SHA256"
+	DNSSECAlgorithmED25519         = "ED25519"
+)
+
+// Authenticated denial of existence modes
+const (
+	DNSSECDenialNSEC      = "nsec"       // A full NSEC chain over the zone's names
+	DNSSECDenialNSEC3     = "nsec3"      // A hashed NSEC3 chain (no salt, no extra iterations, RFC 9276)
+	DNSSECDenialBlackLies = "black-lies" // Minimal NSEC records that answer NXDOMAIN as NODATA
+)
+
+// DNSSEC key flags (RFC 4034 section 2.1.1)
+const (
+	DNSKEYFlagsKSK = 257 // Zone key with the secure entry point bit, signs the DNSKEY RRset
+	DNSKEYFlagsZSK = 256 // Zone key, signs all other RRsets
+)
+
+// DNSSEC key states during rollovers
+// A published key is in the DNSKEY RRset; a published KSK already signs the DNSKEY RRset
+// (double signature) while its DS record is not yet at the parent. An active ZSK signs the
+// zone data, an active KSK is the one the parent's DS record points to. A retired key stays
+// in the DNSKEY RRset until the records it signed have expired from caches, then it is removed.
+const (
+	DNSSECKeyPublished = "published"
+	DNSSECKeyActive    = "active"
+	DNSSECKeyRetired   = "retired"
+	DNSSECKeyRemoved   = "removed"
+)
+
+// DNSSECSettings enables online signing for a zone
+type DNSSECSettings struct {
+	Enabled         bool   `json:"enabled"`                                       // Sign the zone's responses
+	Algorithm       string `json:"algorithm,omitempty" example:"ECDSAP256SHA256"` // ECDSAP256SHA256 (default) or ED25519
+	Denial          string `json:"denial,omitempty" example:"nsec"`               // nsec (default), nsec3 or black-lies
+	ZSKLifetimeDays int    `json:"zsk_lifetime_days,omitempty" example:"30"`      // Days between ZSK rollovers (default from the server configuration)
+	KSKLifetimeDays int    `json:"ksk_lifetime_days,omitempty" example:"365"`     // Days between KSK rollovers (default from the server configuration)
+}
+
+// DNSSECKey is a signing key of a zone
+// The private key is stored encrypted and never returned by the API.
+type DNSSECKey struct {
+	KeyTag      uint16     `json:"key_tag" example:"12345"`
+	Flags       uint16     `json:"flags" example:"257"` // 257 for a key signing key, 256 for a zone signing key
+	Algorithm   uint8      `json:"algorithm" example:"13"`
+	PublicKey   string     `json:"public_key"`            // Base64 public key as in the DNSKEY record
+	PrivateKey  string     `json:"private_key,omitempty"` // Encrypted private key
+	State       string     `json:"state" example:"active"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ActivatedAt *time.Time `json:"activated_at,omitempty"`
+	RetiredAt   *time.Time `json:"retired_at,omitempty"`
+	RemovedAt   *time.Time `json:"removed_at,omitempty"`
+}
+
+// DNSSECStatus is the signing state of a zone
+type DNSSECStatus struct {
+	Zone            string             `json:"zone" example:"example.lan."`
+	Settings        DNSSECSettings     `json:"settings"`
+	Keys            []DNSSECKey        `json:"keys"`
+	DS              []DelegationSigner `json:"ds"`         // DS records the parent zone should have now
+	DSPending       bool               `json:"ds_pending"` // A new KSK waits for its DS record at the parent
+	NextZSKRollover *time.Time         `json:"next_zsk_rollover,omitempty"`
+	NextKSKRollover *time.Time         `json:"next_ksk_rollover,omitempty"`
+}
+
+// DelegationSigner is a DS record to publish in the parent zone
+type DelegationSigner struct {
+	KeyTag     uint16 `json:"key_tag" example:"12345"`
+	Algorithm  uint8  `json:"algorithm" example:"13"`
+	DigestType uint8  `json:"digest_type" example:"2"`
+	Digest     string `json:"digest"`
+	DS         string `json:"ds" example:"example.lan. 3600 IN DS 12345 13 2 4A1B..."` // DS record in zone file format
+	DNSKEY     string `json:"dnskey"`                                                  // DNSKEY record the DS refers to, for registrars that want the key
+}
+
+// Signed reports whether the zone's responses are signed
+func (z *DNSZone) Signed() bool {
+	return z.DNSSEC != nil && z.DNSSEC.Enabled
+}
+
+// ValidateDNSSEC checks and normalizes the DNSSEC settings of the zone
+func (z *DNSZone) ValidateDNSSEC() error {
+	if z.DNSSEC == nil {
+		return nil
+	}
+	if z.DNSSEC.Enabled && z.IsSecondary() {
+		return fmt.Errorf("invalid zone: DNSSEC can't be enabled for secondary zones")
+	}
+	return z.DNSSEC.Validate()
+}
+
+// Validate checks the settings and fills in the default algorithm and denial mode
+func (s *DNSSECSettings) Validate() error {
+	s.Algorithm = strings.ToUpper(strings.TrimSpace(s.Algorithm))
+	switch s.Algorithm {
+	case "":
+		s.Algorithm = DNSSECAlgorithmECDSAP256SHA256
+	case DNSSECAlgorithmECDSAP256SHA256, DNSSECAlgorithmED25519:
+	default:
+		return fmt.Errorf("invalid DNSSEC algorithm %q: must be %s or %s", s.Algorithm, DNSSECAlgorithmECDSAP256SHA256, DNSSECAlgorithmED25519)
+	}
+
+	s.Denial = strings.ToLower(strings.TrimSpace(s.Denial))
+	switch s.Denial {
+	case "":
+		s.Denial = DNSSECDenialNSEC
+	case DNSSECDenialNSEC, DNSSECDenialNSEC3, DNSSECDenialBlackLies:
+	default:
+		return fmt.Errorf("invalid DNSSEC denial %q: must be %s, %s or %s", s.Denial, DNSSECDenialNSEC, DNSSECDenialNSEC3, DNSSECDenialBlackLies)
+	}
+
+	if s.ZSKLifetimeDays < 0 || s.KSKLifetimeDays < 0 {
+		return fmt.Errorf("invalid DNSSEC key lifetime: must not be negative")
+	}
+
+	return nil
+}
+
+// AlgorithmNumber returns the DNSSEC algorithm number of the settings
+func (s *DNSSECSettings) AlgorithmNumber() uint8 {
+	if s.Algorithm == DNSSECAlgorithmED25519 {
+		return dns.ED25519
+	}
+	return dns.ECDSAP256SHA256
+}
+
+// IsKSK reports whether the key is a key signing key
+func (k *DNSSECKey) IsKSK() bool {
+	return k.Flags == DNSKEYFlagsKSK
+}
+
+// Removed reports whether the key has left the zone's DNSKEY RRset
+func (k *DNSSECKey) Removed() bool {
+	return k.State == DNSSECKeyRemoved
+}
+
+// DNSKEY returns the DNSKEY record of the key for the zone
+func (k *DNSSECKey) DNSKEY(zone string, ttl uint32) *dns.DNSKEY {
+	return &dns.DNSKEY{
+		Hdr:       dns.RR_Header{Name: dns.CanonicalName(zone), Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: ttl},
+		Flags:     k.Flags,
+		Protocol:  3,
+		Algorithm: k.Algorithm,
+		PublicKey: k.PublicKey,
+	}
+}
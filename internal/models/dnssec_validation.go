@@ -0,0 +1,120 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// DNSSEC validation results (RFC 4035 section 4.3)
+const (
+	DNSSECSecure   = "secure"   // The chain of trust from a trust anchor covers the response
+	DNSSECInsecure = "insecure" // The response is from an unsigned zone, proven by the chain of trust
+	DNSSECBogus    = "bogus"    // The response should be signed but its signatures or proofs don't validate
+)
+
+// DNSSECValidation is the validation result of an upstream response
+type DNSSECValidation struct {
+	Security string `json:"security"`
+	InfoCode uint16 `json:"info_code,omitempty"` // Extended DNS Error info code of a bogus response (RFC 8914)
+	Reason   string `json:"reason,omitempty"`
+}
+
+// Trust anchor states (RFC 5011 section 4)
+// A new key in the root DNSKEY RRset is added pending until it has been seen for the hold-down
+// time, then it is trusted. A trusted key that left the RRset is missing but still trusted;
+// a key that was revoked by its owner is never trusted again.
+const (
+	TrustAnchorAddPending = "add-pending"
+	TrustAnchorValid      = "valid"
+	TrustAnchorMissing    = "missing"
+	TrustAnchorRevoked    = "revoked"
+)
+
+// TrustAnchor is a root key signing key validation starts from
+type TrustAnchor struct {
+	KeyTag     uint16     `json:"key_tag" example:"20326"`
+	Algorithm  uint8      `json:"algorithm" example:"8"`
+	DigestType uint8      `json:"digest_type" example:"2"`
+	Digest     string     `json:"digest" example:"E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D"`
+	DNSKEY     string     `json:"dnskey,omitempty"` // DNSKEY record, once seen in the root zone
+	State      string     `json:"state" example:"valid"`
+	FirstSeen  *time.Time `json:"first_seen,omitempty"`
+	LastSeen   *time.Time `json:"last_seen,omitempty"`
+}
+
+// NegativeTrustAnchor disables validation for a domain with broken DNSSEC (RFC 7646)
+type NegativeTrustAnchor struct {
+	Domain    string     `json:"domain" example:"broken.example.com."`
+	Reason    string     `json:"reason,omitempty" example:"Expired signatures, reported to the operator"`
+	CreatedAt time.Time  `json:"created_at,omitzero" example:"2025-01-15T10:30:00Z"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty" example:"2025-01-16T10:30:00Z"` // The anchor is removed at this time (kept until deleted when empty)
+}
+
+// ParseTrustAnchor parses a trust anchor from a DS record in presentation format
+func ParseTrustAnchor(ds string) (TrustAnchor, error) {
+	rr, err := dns.NewRR(". IN DS " + ds)
+	if err != nil {
+		return TrustAnchor{}, fmt.Errorf("invalid trust anchor %q: %w", ds, err)
+	}
+	return NewTrustAnchor(rr.(*dns.DS), TrustAnchorValid), nil
+}
+
+// NewTrustAnchor creates a trust anchor from a DS record
+func NewTrustAnchor(ds *dns.DS, state string) TrustAnchor {
+	return TrustAnchor{
+		KeyTag:     ds.KeyTag,
+		Algorithm:  ds.Algorithm,
+		DigestType: ds.DigestType,
+		Digest:     strings.ToUpper(ds.Digest),
+		State:      state,
+	}
+}
+
+// Trusted reports whether validation may start from the anchor
+func (a *TrustAnchor) Trusted() bool {
+	return a.State == TrustAnchorValid || a.State == TrustAnchorMissing
+}
+
+// DS returns the DS record of the anchor
+func (a *TrustAnchor) DS() *dns.DS {
+	return &dns.DS{
+		Hdr:        dns.RR_Header{Name: ".", Rrtype: dns.TypeDS, Class: dns.ClassINET},
+		KeyTag:     a.KeyTag,
+		Algorithm:  a.Algorithm,
+		DigestType: a.DigestType,
+		Digest:     a.Digest,
+	}
+}
+
+// Matches reports whether the anchor refers to the key; the revoke bit is ignored (RFC 5011 section 2.1)
+func (a *TrustAnchor) Matches(key *dns.DNSKEY) bool {
+	unrevoked := *key
+	unrevoked.Flags &^= dns.REVOKE
+	ds := unrevoked.ToDS(a.DigestType)
+	return ds != nil && ds.KeyTag == a.KeyTag && ds.Algorithm == a.Algorithm && strings.EqualFold(ds.Digest, a.Digest)
+}
+
+// Validate checks and normalizes the negative trust anchor
+func (n *NegativeTrustAnchor) Validate() error {
+	n.Domain = dns.CanonicalName(strings.TrimSpace(n.Domain))
+	if n.Domain == "." {
+		return fmt.Errorf("invalid negative trust anchor: domain is required and can't be the root")
+	}
+	if _, ok := dns.IsDomainName(n.Domain); !ok {
+		return fmt.Errorf("invalid negative trust anchor: %s is not a domain name", n.Domain)
+	}
+	return nil
+}
+
+// Covers reports whether the anchor disables validation of a name
+func (n *NegativeTrustAnchor) Covers(name string, now time.Time) bool {
+	return !n.Expired(now) && dns.IsSubDomain(n.Domain, dns.CanonicalName(name))
+}
+
+// Expired reports whether the anchor has expired
+func (n *NegativeTrustAnchor) Expired(now time.Time) bool {
+	return n.ExpiresAt != nil && !now.Before(*n.ExpiresAt)
+}
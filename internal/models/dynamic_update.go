@@ -0,0 +1,135 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// ZoneUpdatePolicy controls which TSIG keys may change a zone with dynamic updates (RFC 2136)
+// Unsigned updates are always refused.
+type ZoneUpdatePolicy struct {
+	Grants []UpdateGrant `json:"grants"` // Keys and the names and types they may update
+}
+
+// UpdateGrant allows one TSIG key to update records matching name patterns and types
+// A pattern is a name relative to the zone or an FQDN. "@" is the zone apex,
+// "*.dhcp" matches every name below dhcp.<zone> and "*" every name below the apex.
+type UpdateGrant struct {
+	TSIGKey string   `json:"tsig_key" example:"dhcp-key."`           // Name of the key that must sign the update
+	Names   []string `json:"names" example:"*.dhcp,_acme-challenge"` // Name patterns the key may update
+	Types   []string `json:"types,omitempty" example:"A,AAAA,TXT"`   // Record types the key may update (all types when empty)
+}
+
+// Validate checks the policy and normalizes its name patterns to FQDNs within zone
+func (p *ZoneUpdatePolicy) Validate(zone string) error {
+	zone = dns.CanonicalName(zone)
+
+	if len(p.Grants) == 0 {
+		return fmt.Errorf("invalid update policy: at least one grant is required")
+	}
+
+	for i := range p.Grants {
+		grant := &p.Grants[i]
+
+		if strings.TrimSpace(grant.TSIGKey) == "" {
+			return fmt.Errorf("invalid update policy: grant %d has no TSIG key", i+1)
+		}
+		grant.TSIGKey = dns.CanonicalName(strings.TrimSpace(grant.TSIGKey))
+
+		if len(grant.Names) == 0 {
+			return fmt.Errorf("invalid update policy: grant for %s has no name patterns", grant.TSIGKey)
+		}
+		for j, pattern := range grant.Names {
+			name, err := normalizeUpdatePattern(zone, pattern)
+			if err != nil {
+				return fmt.Errorf("invalid update policy: %w", err)
+			}
+			grant.Names[j] = name
+		}
+
+		for j, t := range grant.Types {
+			t = strings.ToUpper(strings.TrimSpace(t))
+			if _, ok := dns.StringToType[t]; !ok {
+				return fmt.Errorf("invalid update policy: unknown record type %q", t)
+			}
+			grant.Types[j] = t
+		}
+	}
+
+	return nil
+}
+
+// Allows reports whether tsigKey may update records of the given name and type
+func (p *ZoneUpdatePolicy) Allows(tsigKey, name, recordType string) bool {
+	if tsigKey == "" {
+		return false
+	}
+	name = dns.CanonicalName(name)
+
+	for _, grant := range p.Grants {
+		if !strings.EqualFold(grant.TSIGKey, dns.Fqdn(tsigKey)) {
+			continue
+		}
+		if len(grant.Types) > 0 && !containsFold(grant.Types, recordType) {
+			continue
+		}
+		for _, pattern := range grant.Names {
+			if matchUpdatePattern(pattern, name) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// normalizeUpdatePattern converts a name pattern to an FQDN pattern within zone
+func normalizeUpdatePattern(zone, pattern string) (string, error) {
+	pattern = strings.TrimSpace(pattern)
+
+	var name string
+	switch {
+	case pattern == "":
+		return "", fmt.Errorf("empty name pattern")
+	case pattern == "@":
+		name = zone
+	case pattern == "*":
+		name = "*." + zone
+	case dns.IsFqdn(pattern):
+		name = dns.CanonicalName(pattern)
+	default:
+		name = dns.CanonicalName(pattern + "." + zone)
+	}
+
+	if strings.Contains(strings.TrimPrefix(name, "*."), "*") {
+		return "", fmt.Errorf("invalid name pattern %q: '*' must be the entire leftmost label", pattern)
+	}
+	if _, ok := dns.IsDomainName(name); !ok {
+		return "", fmt.Errorf("invalid name pattern %q", pattern)
+	}
+	if !dns.IsSubDomain(zone, strings.TrimPrefix(name, "*.")) {
+		return "", fmt.Errorf("name pattern %q is outside zone %s", pattern, zone)
+	}
+
+	return name, nil
+}
+
+// matchUpdatePattern reports whether a canonical name matches a normalized pattern
+func matchUpdatePattern(pattern, name string) bool {
+	if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+		return name != suffix && dns.IsSubDomain(suffix, name)
+	}
+	return pattern == name
+}
+
+// containsFold reports whether values holds s, ignoring case
+func containsFold(values []string, s string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,70 @@
+package models
+
+import "testing"
+
+func TestZoneUpdatePolicyAllows(t *testing.T) {
+	policy := &ZoneUpdatePolicy{Grants: []UpdateGrant{
+		{TSIGKey: "dhcp-key", Names: []string{"*.dhcp", "@"}, Types: []string{"a", "AAAA"}},
+		{TSIGKey: "acme-key.", Names: []string{"_acme-challenge.www.example.lan."}, Types: []string{"TXT"}},
+	}}
+	if err := policy.Validate("example.lan"); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	if grant := policy.Grants[0]; grant.TSIGKey != "dhcp-key." || grant.Names[0] != "*.dhcp.example.lan." || grant.Names[1] != "example.lan." || grant.Types[0] != "A" {
+		t.Errorf("Validate() did not normalize the grant: %+v", grant)
+	}
+
+	tests := []struct {
+		name       string
+		key        string
+		recordName string
+		recordType string
+		want       bool
+	}{
+		{"below wildcard", "dhcp-key.", "host1.dhcp.example.lan.", "A", true},
+		{"case-insensitive", "DHCP-KEY.", "Host1.DHCP.example.lan.", "AAAA", true},
+		{"wildcard owner itself", "dhcp-key.", "dhcp.example.lan.", "A", false},
+		{"apex", "dhcp-key.", "example.lan.", "A", true},
+		{"type not granted", "dhcp-key.", "host1.dhcp.example.lan.", "TXT", false},
+		{"exact name", "acme-key.", "_acme-challenge.www.example.lan.", "TXT", true},
+		{"other key", "acme-key.", "host1.dhcp.example.lan.", "A", false},
+		{"unsigned", "", "host1.dhcp.example.lan.", "A", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := policy.Allows(tt.key, tt.recordName, tt.recordType); got != tt.want {
+				t.Errorf("Allows(%q, %s, %s) = %v, want %v", tt.key, tt.recordName, tt.recordType, got, tt.want)
+			}
+		})
+	}
+
+	invalid := []*ZoneUpdatePolicy{
+		{},
+		{Grants: []UpdateGrant{{Names: []string{"*"}}}},
+		{Grants: []UpdateGrant{{TSIGKey: "k", Names: []string{"host.example.com."}}}},
+		{Grants: []UpdateGrant{{TSIGKey: "k", Names: []string{"a.*.dhcp"}}}},
+		{Grants: []UpdateGrant{{TSIGKey: "k", Names: []string{"*"}, Types: []string{"BOGUS"}}}},
+	}
+	for _, p := range invalid {
+		if err := p.Validate("example.lan."); err == nil {
+			t.Errorf("Validate() accepted %+v", p.Grants)
+		}
+	}
+}
+
+func TestParseTSIGKeys(t *testing.T) {
+	keys, err := ParseTSIGKeys("dhcp-key:c2VjcmV0, acme-key.:hmac-sha512:c2VjcmV0")
+	if err != nil {
+		t.Fatalf("ParseTSIGKeys() error = %v", err)
+	}
+	if len(keys) != 2 || keys[0].Name != "dhcp-key." || keys[0].Algorithm != "hmac-sha256." || keys[1].Algorithm != "hmac-sha512." {
+		t.Errorf("ParseTSIGKeys() = %+v", keys)
+	}
+
+	for _, spec := range []string{"dhcp-key", "dhcp-key:hmac-md5.sig-alg.reg.int.:c2VjcmV0", "dhcp-key:not base64"} {
+		if _, err := ParseTSIGKeys(spec); err == nil {
+			t.Errorf("ParseTSIGKeys(%q) accepted an invalid key", spec)
+		}
+	}
+}
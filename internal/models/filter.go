@@ -0,0 +1,223 @@
+package models
+
+import (
+	"fmt"
+	"net/netip"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// ClientGroup is a named set of clients, by network or client identifier, filtered with a
+// profile. A client identifier matches before the networks; among the networks, the group
+// with the longest matching prefix wins.
+type ClientGroup struct {
+	Name        string    `json:"name" example:"branch-oslo"`
+	Prefixes    []string  `json:"prefixes,omitempty" example:"10.20.0.0/16"` // Client networks in the group
+	ClientIDs   []string  `json:"client_ids,omitempty" example:"oslo-kiosk"` // Client identifiers of DNS over HTTPS clients, from /dns-query/{client-id}
+	Profile     string    `json:"profile" example:"kids"`                    // Filtering profile of the clients
+	Description string    `json:"description,omitempty" example:"Oslo branch office"`
+	CreatedAt   time.Time `json:"created_at,omitzero" example:"2025-01-15T10:30:00Z"`
+	UpdatedAt   time.Time `json:"updated_at,omitzero" example:"2025-01-15T10:30:00Z"`
+}
+
+// FilterProfile is the filtering applied to the clients of a group: blocklists, blocked and
+// allowed domains and safe search. When it has schedules, the profile only applies during
+// them; other times its clients are filtered like clients in no group.
+type FilterProfile struct {
+	Name           string           `json:"name" example:"kids"`
+	Blocklists     []string         `json:"blocklists,omitempty" example:"social,gambling"`          // Blocklists of DNS_FILTER_BLOCKLISTS to apply
+	BlockedDomains []string         `json:"blocked_domains,omitempty" example:"tiktok.com."`         // Domains blocked with the names below them
+	AllowedDomains []string         `json:"allowed_domains,omitempty" example:"school.example.com."` // Exceptions: never blocked or rewritten
+	SafeSearch     bool             `json:"safe_search,omitempty"`                                   // Rewrite search engines to their safe search servers
+	Schedules      []FilterSchedule `json:"schedules,omitempty"`                                     // When the profile applies; always when empty
+	Timezone       string           `json:"timezone,omitempty" example:"Europe/Oslo"`                // Timezone of the schedules (default: the server's)
+	Description    string           `json:"description,omitempty" example:"Kiosks and guest devices"`
+	CreatedAt      time.Time        `json:"created_at,omitzero" example:"2025-01-15T10:30:00Z"`
+	UpdatedAt      time.Time        `json:"updated_at,omitzero" example:"2025-01-15T10:30:00Z"`
+}
+
+// FilterSchedule is a weekly time window. A window whose end isn't after its start spans
+// midnight and ends on the next day.
+type FilterSchedule struct {
+	Days  []string `json:"days,omitempty" example:"mon,tue,wed,thu,fri"` // Days the window starts on; every day when empty
+	Start string   `json:"start" example:"08:00"`
+	End   string   `json:"end" example:"16:00"` // Up to 24:00
+}
+
+var filterNamePattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9_-]{0,61}[a-z0-9])?$`)
+
+// clientIDPattern matches client identifiers, which are single DNS labels
+var clientIDPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+var weekdays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// ValidateFilterName checks the name of a client group or filtering profile
+func ValidateFilterName(kind, name string) error {
+	if !filterNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid %s name %q: use lowercase letters, digits, '-' and '_'", kind, name)
+	}
+	return nil
+}
+
+// ValidateClientID checks a client identifier: a DNS label of lowercase letters, digits and '-'
+func ValidateClientID(id string) error {
+	if !clientIDPattern.MatchString(id) {
+		return fmt.Errorf("invalid client id %q: use lowercase letters, digits and '-'", id)
+	}
+	return nil
+}
+
+// Validate checks and normalizes the client group; the profile is checked by the filter service
+func (g *ClientGroup) Validate() error {
+	g.Name = strings.ToLower(strings.TrimSpace(g.Name))
+	if err := ValidateFilterName("client group", g.Name); err != nil {
+		return err
+	}
+	g.Profile = strings.ToLower(strings.TrimSpace(g.Profile))
+	if g.Profile == "" {
+		return fmt.Errorf("invalid client group %s: profile is required", g.Name)
+	}
+
+	prefixes := make([]string, 0, len(g.Prefixes))
+	for _, s := range g.Prefixes {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return fmt.Errorf("invalid client group %s: %w", g.Name, err)
+		}
+		prefixes = append(prefixes, prefix.Masked().String())
+	}
+	ids := make([]string, 0, len(g.ClientIDs))
+	for _, id := range g.ClientIDs {
+		if id = strings.ToLower(strings.TrimSpace(id)); id == "" {
+			continue
+		}
+		if err := ValidateClientID(id); err != nil {
+			return fmt.Errorf("invalid client group %s: %w", g.Name, err)
+		}
+		ids = append(ids, id)
+	}
+	if len(prefixes) == 0 && len(ids) == 0 {
+		return fmt.Errorf("invalid client group %s: at least one prefix or client id is required", g.Name)
+	}
+	g.Prefixes, g.ClientIDs = prefixes, ids
+	return nil
+}
+
+// Validate checks and normalizes the profile; the blocklists are checked by the filter service
+func (p *FilterProfile) Validate() error {
+	p.Name = strings.ToLower(strings.TrimSpace(p.Name))
+	if err := ValidateFilterName("profile", p.Name); err != nil {
+		return err
+	}
+
+	var blocklists []string
+	for _, name := range p.Blocklists {
+		if name = strings.TrimSpace(name); name != "" && !slices.Contains(blocklists, name) {
+			blocklists = append(blocklists, name)
+		}
+	}
+	p.Blocklists = blocklists
+
+	var err error
+	if p.BlockedDomains, err = normalizeDomains(p.BlockedDomains); err != nil {
+		return fmt.Errorf("invalid profile %s: %w", p.Name, err)
+	}
+	if p.AllowedDomains, err = normalizeDomains(p.AllowedDomains); err != nil {
+		return fmt.Errorf("invalid profile %s: %w", p.Name, err)
+	}
+
+	for i := range p.Schedules {
+		if err := p.Schedules[i].validate(); err != nil {
+			return fmt.Errorf("invalid profile %s: %w", p.Name, err)
+		}
+	}
+	if _, err := p.Location(); err != nil {
+		return fmt.Errorf("invalid profile %s: %w", p.Name, err)
+	}
+	return nil
+}
+
+// Location returns the timezone of the schedules
+func (p *FilterProfile) Location() (*time.Location, error) {
+	if p.Timezone == "" {
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(p.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("unknown timezone %q", p.Timezone)
+	}
+	return loc, nil
+}
+
+func normalizeDomains(domains []string) ([]string, error) {
+	var names []string
+	for _, domain := range domains {
+		if domain = strings.TrimSpace(domain); domain == "" {
+			continue
+		}
+		name := dns.CanonicalName(domain)
+		if _, ok := dns.IsDomainName(name); !ok || name == "." {
+			return nil, fmt.Errorf("%q is not a domain name", domain)
+		}
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+func (s *FilterSchedule) validate() error {
+	days := make([]string, 0, len(s.Days))
+	for _, day := range s.Days {
+		day = strings.ToLower(strings.TrimSpace(day))
+		weekday := slices.IndexFunc(weekdays, func(d string) bool { return strings.HasPrefix(day, d) })
+		if weekday < 0 || (day != weekdays[weekday] && day != strings.ToLower(time.Weekday(weekday).String())) {
+			return fmt.Errorf("unknown day %q in schedule", day)
+		}
+		days = append(days, weekdays[weekday])
+	}
+	s.Days = days
+
+	if _, err := parseClock(s.Start); err != nil {
+		return err
+	}
+	if _, err := parseClock(s.End); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Covers reports whether a time, in the timezone of the schedule, is in the window
+func (s FilterSchedule) Covers(t time.Time) bool {
+	start, _ := parseClock(s.Start)
+	end, _ := parseClock(s.End)
+	minute := t.Hour()*60 + t.Minute()
+	if start < end {
+		return s.startsOn(t.Weekday()) && minute >= start && minute < end
+	}
+	// The window spans midnight: from the start on its day to the end on the next day
+	return (s.startsOn(t.Weekday()) && minute >= start) || (s.startsOn((t.Weekday()+6)%7) && minute < end)
+}
+
+func (s FilterSchedule) startsOn(day time.Weekday) bool {
+	return len(s.Days) == 0 || slices.Contains(s.Days, weekdays[day])
+}
+
+// parseClock parses a time of day in HH:MM form into minutes after midnight
+func parseClock(s string) (int, error) {
+	hours, minutes, ok := strings.Cut(strings.TrimSpace(s), ":")
+	h, err1 := strconv.Atoi(hours)
+	m, err2 := strconv.Atoi(minutes)
+	if !ok || err1 != nil || err2 != nil || h < 0 || m < 0 || m > 59 || h*60+m > 24*60 {
+		return 0, fmt.Errorf("invalid time %q in schedule: expected HH:MM", s)
+	}
+	return h*60 + m, nil
+}
@@ -0,0 +1,89 @@
+package models
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestClientGroupValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		group   ClientGroup
+		wantErr bool
+	}{
+		{"prefixes and client ids", ClientGroup{Name: " Branch ", Prefixes: []string{"10.20.1.2/16", ""}, ClientIDs: []string{"Kiosk-1"}, Profile: "Kids"}, false},
+		{"client ids only", ClientGroup{Name: "branch", ClientIDs: []string{"kiosk-1"}, Profile: "kids"}, false},
+		{"no clients", ClientGroup{Name: "branch", Profile: "kids"}, true},
+		{"no profile", ClientGroup{Name: "branch", Prefixes: []string{"10.20.0.0/16"}}, true},
+		{"invalid client id", ClientGroup{Name: "branch", ClientIDs: []string{"kiosk.1"}, Profile: "kids"}, true},
+		{"invalid prefix", ClientGroup{Name: "branch", Prefixes: []string{"10.20.0.0/33"}, Profile: "kids"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.group.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && (tt.group.Name != "branch" || tt.group.Profile != "kids" || !slices.Equal(tt.group.ClientIDs, []string{"kiosk-1"})) {
+				t.Errorf("Validate() = %+v, want the normalized name, profile and client ids", tt.group)
+			}
+		})
+	}
+}
+
+func TestFilterProfileValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile FilterProfile
+		wantErr bool
+	}{
+		{"normalized", FilterProfile{Name: "Kids", BlockedDomains: []string{"TikTok.com", "tiktok.com.", ""}, Schedules: []FilterSchedule{{Days: []string{"Monday", "fri"}, Start: "08:00", End: "16:30"}}, Timezone: "UTC"}, false},
+		{"invalid domain", FilterProfile{Name: "kids", AllowedDomains: []string{"example..com"}}, true},
+		{"invalid day", FilterProfile{Name: "kids", Schedules: []FilterSchedule{{Days: []string{"monkey"}, Start: "08:00", End: "16:00"}}}, true},
+		{"invalid time", FilterProfile{Name: "kids", Schedules: []FilterSchedule{{Start: "8", End: "25:00"}}}, true},
+		{"unknown timezone", FilterProfile{Name: "kids", Timezone: "Mars/Olympus"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.profile.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && (!slices.Equal(tt.profile.BlockedDomains, []string{"tiktok.com."}) || !slices.Equal(tt.profile.Schedules[0].Days, []string{"mon", "fri"})) {
+				t.Errorf("Validate() = %+v, want the normalized domains and days", tt.profile)
+			}
+		})
+	}
+}
+
+func TestFilterScheduleCovers(t *testing.T) {
+	school := FilterSchedule{Days: []string{"mon", "tue", "wed", "thu", "fri"}, Start: "08:00", End: "16:00"}
+	night := FilterSchedule{Days: []string{"fri"}, Start: "22:00", End: "06:00"}
+
+	// 2025-01-13 is a Monday
+	at := func(day, hour, minute int) time.Time { return time.Date(2025, 1, 13+day, hour, minute, 0, 0, time.UTC) }
+	tests := []struct {
+		name     string
+		schedule FilterSchedule
+		t        time.Time
+		want     bool
+	}{
+		{"during", school, at(0, 8, 0), true},
+		{"end is excluded", school, at(0, 16, 0), false},
+		{"other day", school, at(5, 10, 0), false},
+		{"spans midnight, before", night, at(4, 23, 0), true},
+		{"spans midnight, after", night, at(5, 5, 59), true},
+		{"spans midnight, next evening", night, at(5, 23, 0), false},
+		{"every day", FilterSchedule{Start: "00:00", End: "24:00"}, at(6, 23, 59), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.schedule.Covers(tt.t); got != tt.want {
+				t.Errorf("Covers(%s) = %t, want %t", tt.t.Format(time.RFC1123), got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// ConditionalForwarder sends queries for a domain and the names below it to its own upstream servers
+// instead of the default upstream, e.g. an internal domain to its domain controllers. When several
+// forwarders match a name, the one with the longest domain wins.
+type ConditionalForwarder struct {
+	Domain      string    `json:"domain" example:"corp.internal."`
+	Upstreams   []string  `json:"upstreams" example:"10.0.0.10:53,tls://10.0.0.11@dc2.corp.internal"` // Same format as DNS_UPSTREAM_SERVER
+	Strategy    string    `json:"strategy,omitempty" example:"fastest"`                               // Selection strategy (default DNS_UPSTREAM_STRATEGY)
+	DNSSEC      bool      `json:"dnssec_validation,omitempty"`                                        // Validate answers with DNSSEC; private domains usually can't be
+	Description string    `json:"description,omitempty" example:"Active Directory domain controllers"`
+	CreatedAt   time.Time `json:"created_at,omitzero" example:"2025-01-15T10:30:00Z"`
+	UpdatedAt   time.Time `json:"updated_at,omitzero" example:"2025-01-15T10:30:00Z"`
+}
+
+// Validate checks and normalizes the forwarder; the upstreams are parsed by the upstream service
+func (f *ConditionalForwarder) Validate() error {
+	f.Domain = dns.CanonicalName(strings.TrimSpace(f.Domain))
+	if f.Domain == "." {
+		return fmt.Errorf("invalid forwarder: domain is required and can't be the root, which uses the default upstream")
+	}
+	if _, ok := dns.IsDomainName(f.Domain); !ok {
+		return fmt.Errorf("invalid forwarder: %s is not a domain name", f.Domain)
+	}
+
+	upstreams := make([]string, 0, len(f.Upstreams))
+	for _, upstream := range f.Upstreams {
+		if upstream = strings.TrimSpace(upstream); upstream != "" {
+			upstreams = append(upstreams, upstream)
+		}
+	}
+	if len(upstreams) == 0 {
+		return fmt.Errorf("invalid forwarder %s: at least one upstream is required", f.Domain)
+	}
+	f.Upstreams = upstreams
+	return nil
+}
+
+// Matches reports whether queries for a name go to the forwarder
+func (f *ConditionalForwarder) Matches(name string) bool {
+	return dns.IsSubDomain(f.Domain, dns.CanonicalName(name))
+}
@@ -0,0 +1,135 @@
+package models
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// Response policy sources
+const (
+	PolicyTypeRPZ     = "rpz"     // RPZ zone file
+	PolicyTypeAXFR    = "axfr"    // RPZ zone transferred from a primary
+	PolicyTypeHosts   = "hosts"   // hosts file: the listed names, sinkholed or redirected to their address
+	PolicyTypeDomains = "domains" // one domain per line: the domains and the names below them
+)
+
+// Response policy actions
+const (
+	PolicyActionNXDomain = "nxdomain" // answer NXDOMAIN
+	PolicyActionNoData   = "nodata"   // answer NOERROR without records
+	PolicyActionDrop     = "drop"     // don't answer
+	PolicyActionPassthru = "passthru" // answer normally, skipping the later policies
+	PolicyActionRedirect = "redirect" // answer with the local data of the rule
+)
+
+// Response policy triggers
+const (
+	PolicyTriggerQName      = "qname"       // the query name or a CNAME target in the answer
+	PolicyTriggerResponseIP = "response-ip" // an address in the answer
+	PolicyTriggerNSDName    = "nsdname"     // a name server in the response
+)
+
+// PolicySource is a response policy zone or blocklist
+// Sources are configured in DNS_RPZ_POLICIES, and in DNS_FILTER_BLOCKLISTS for the blocklists
+// of filtering profiles, and checked in that order; the first policy with a matching rule
+// decides the answer.
+type PolicySource struct {
+	Name        string
+	Type        string // rpz, axfr, hosts or domains
+	Location    string // File, or the zone of an axfr policy
+	Primary     string // Primary of an axfr policy
+	TSIGKey     string // Key signing the transfers of an axfr policy
+	ProfileOnly bool   // Only applied to the clients of filtering profiles listing it
+}
+
+// PolicyHit is the rule of a response policy that matched a query
+type PolicyHit struct {
+	Policy  string `json:"policy" example:"ads"`
+	Rule    string `json:"rule" example:"*.doubleclick.net"` // Trigger of the rule as written in the policy
+	Trigger string `json:"trigger" example:"qname"`          // qname, response-ip or nsdname
+	Action  string `json:"action" example:"nxdomain"`        // nxdomain, nodata, drop, passthru or redirect
+}
+
+// Blocks reports whether the rule changed the answer
+func (h *PolicyHit) Blocks() bool {
+	return h != nil && h.Action != PolicyActionPassthru
+}
+
+var policyTypes = []string{PolicyTypeRPZ, PolicyTypeAXFR, PolicyTypeHosts, PolicyTypeDomains}
+
+// ParsePolicySources parses the response policies of DNS_RPZ_POLICIES: comma-separated
+// name=type:location entries, where the location of an axfr policy is zone@primary, with an
+// optional /key to sign the transfers with a TSIG key
+func ParsePolicySources(spec string) ([]PolicySource, error) {
+	var sources []PolicySource
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		name, rest, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid policy %q: expected name=type:location", entry)
+		}
+		kind, location, ok := strings.Cut(rest, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid policy %q: expected name=type:location", entry)
+		}
+
+		source := PolicySource{
+			Name:     strings.TrimSpace(name),
+			Type:     strings.ToLower(strings.TrimSpace(kind)),
+			Location: strings.TrimSpace(location),
+		}
+		if err := source.Validate(); err != nil {
+			return nil, err
+		}
+		if slices.ContainsFunc(sources, func(s PolicySource) bool { return s.Name == source.Name }) {
+			return nil, fmt.Errorf("invalid policy %s: duplicate name", source.Name)
+		}
+		sources = append(sources, source)
+	}
+
+	return sources, nil
+}
+
+// Validate checks and normalizes the source, splitting the location of axfr policies
+func (s *PolicySource) Validate() error {
+	if s.Name == "" {
+		return fmt.Errorf("invalid policy: name is required")
+	}
+	if !slices.Contains(policyTypes, s.Type) {
+		return fmt.Errorf("invalid policy %s: unknown type %q (expected %s)", s.Name, s.Type, strings.Join(policyTypes, ", "))
+	}
+	if s.Location == "" {
+		return fmt.Errorf("invalid policy %s: location is required", s.Name)
+	}
+	if s.Type != PolicyTypeAXFR {
+		return nil
+	}
+
+	zone, primary, ok := strings.Cut(s.Location, "@")
+	if !ok {
+		return fmt.Errorf("invalid policy %s: expected zone@primary", s.Name)
+	}
+	if primary, key, ok := strings.Cut(primary, "/"); ok {
+		s.Primary, s.TSIGKey = primary, dns.CanonicalName(key)
+	} else {
+		s.Primary = primary
+	}
+	if _, ok := dns.IsDomainName(zone); !ok || zone == "" {
+		return fmt.Errorf("invalid policy %s: invalid zone %q", s.Name, zone)
+	}
+	s.Location = dns.CanonicalName(zone)
+
+	addrPort, err := ParseServerAddr(s.Primary)
+	if err != nil {
+		return fmt.Errorf("invalid policy %s: %w", s.Name, err)
+	}
+	s.Primary = addrPort.String()
+	return nil
+}
@@ -0,0 +1,29 @@
+package models
+
+import "testing"
+
+func TestParsePolicySources(t *testing.T) {
+	sources, err := ParsePolicySources("ads=hosts:/etc/godns/ads.hosts, feed=AXFR:RPZ.example.net@192.0.2.1/feed-key, corp=axfr:rpz.corp@[2001:db8::1]:5353")
+	if err != nil {
+		t.Fatalf("ParsePolicySources() error = %v", err)
+	}
+	want := []PolicySource{
+		{Name: "ads", Type: PolicyTypeHosts, Location: "/etc/godns/ads.hosts"},
+		{Name: "feed", Type: PolicyTypeAXFR, Location: "rpz.example.net.", Primary: "192.0.2.1:53", TSIGKey: "feed-key."},
+		{Name: "corp", Type: PolicyTypeAXFR, Location: "rpz.corp.", Primary: "[2001:db8::1]:5353"},
+	}
+	if len(sources) != len(want) {
+		t.Fatalf("ParsePolicySources() = %+v, want %+v", sources, want)
+	}
+	for i := range want {
+		if sources[i] != want[i] {
+			t.Errorf("ParsePolicySources()[%d] = %+v, want %+v", i, sources[i], want[i])
+		}
+	}
+
+	for _, spec := range []string{"ads", "ads=/etc/godns/ads.hosts", "ads=adblock:/etc/godns/ads", "ads=hosts:", "feed=axfr:rpz.example.net", "feed=axfr:rpz.example.net@rpz-primary", "a=hosts:/a,a=domains:/b"} {
+		if _, err := ParsePolicySources(spec); err == nil {
+			t.Errorf("ParsePolicySources(%q) accepted an invalid policy", spec)
+		}
+	}
+}
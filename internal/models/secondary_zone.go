@@ -0,0 +1,104 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Zone kinds
+const (
+	ZoneKindPrimary   = "primary"
+	ZoneKindSecondary = "secondary"
+)
+
+// SecondaryStatus is the transfer state of a secondary zone
+type SecondaryStatus struct {
+	Loaded      bool      `json:"loaded"`               // The zone has been transferred at least once
+	Expired     bool      `json:"expired"`              // The primaries were unreachable for longer than the SOA expire time
+	Primary     string    `json:"primary,omitempty"`    // Primary of the last successful refresh
+	LastRefresh time.Time `json:"last_refresh"`         // Last time the zone was confirmed current with a primary
+	LastCheck   time.Time `json:"last_check"`           // Last refresh attempt
+	NextCheck   time.Time `json:"next_check"`           // Next scheduled refresh
+	LastError   string    `json:"last_error,omitempty"` // Error of the last failed refresh
+}
+
+// IsSecondary reports whether the zone is transferred from external primaries
+func (z *DNSZone) IsSecondary() bool {
+	return z.Kind == ZoneKindSecondary
+}
+
+// Serving reports whether the zone is answered from
+// Secondary zones are only served once loaded and until they expire.
+func (z *DNSZone) Serving() bool {
+	if !z.Enabled {
+		return false
+	}
+	if z.IsSecondary() {
+		return z.SecondaryStatus != nil && z.SecondaryStatus.Loaded && !z.SecondaryStatus.Expired
+	}
+	return true
+}
+
+// ValidateKind checks the zone kind and normalizes the primaries to ip:port
+func (z *DNSZone) ValidateKind() error {
+	z.Kind = strings.ToLower(strings.TrimSpace(z.Kind))
+
+	switch z.Kind {
+	case "", ZoneKindPrimary:
+		if len(z.Primaries) > 0 {
+			return fmt.Errorf("invalid zone: primaries are only used by secondary zones")
+		}
+		z.SecondaryStatus = nil
+	case ZoneKindSecondary:
+		if len(z.Primaries) == 0 {
+			return fmt.Errorf("invalid zone: a secondary zone needs at least one primary")
+		}
+		for i, primary := range z.Primaries {
+			addrPort, err := ParseServerAddr(primary)
+			if err != nil {
+				return fmt.Errorf("invalid primary: %w", err)
+			}
+			z.Primaries[i] = addrPort.String()
+		}
+	default:
+		return fmt.Errorf("invalid zone kind %q: must be %s or %s", z.Kind, ZoneKindPrimary, ZoneKindSecondary)
+	}
+
+	return nil
+}
+
+// RecordFromRR converts a resource record received in a zone transfer
+// It returns false for record types GoDNS does not store.
+func RecordFromRR(rr dns.RR) (DNSRecord, bool) {
+	hdr := rr.Header()
+	name, ttl := hdr.Name, hdr.Ttl
+
+	switch r := rr.(type) {
+	case *dns.A:
+		return NewARecord(name, r.A.String(), ttl), true
+	case *dns.AAAA:
+		return NewAAAARecord(name, r.AAAA.String(), ttl), true
+	case *dns.CNAME:
+		return NewCNAMERecord(name, r.Target, ttl), true
+	case *dns.NS:
+		return NewNSRecord(name, r.Ns, ttl), true
+	case *dns.PTR:
+		return DNSRecord{Name: name, Type: "PTR", TTL: ttl, Value: r.Ptr}, true
+	case *dns.MX:
+		return NewMXRecord(name, r.Preference, r.Mx, ttl), true
+	case *dns.SRV:
+		return NewSRVRecord(name, r.Priority, r.Weight, r.Port, r.Target, ttl), true
+	case *dns.SOA:
+		return NewSOARecord(name, r.Ns, r.Mbox, r.Serial, r.Refresh, r.Retry, r.Expire, r.Minttl, ttl), true
+	case *dns.TXT:
+		// Character-strings of one TXT record are concatenated, as readers of SPF/DKIM do
+		return NewTXTRecord(name, strings.Join(r.Txt, ""), ttl), true
+	case *dns.CAA:
+		return NewCAARecord(name, r.Flag, r.Tag, r.Value, ttl), true
+	}
+
+	return DNSRecord{}, false
+}
@@ -0,0 +1,141 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Operations a TSIG key can be scoped to
+const (
+	TSIGOperationTransfer = "transfer" // AXFR/IXFR requests
+	TSIGOperationUpdate   = "update"   // Dynamic updates (RFC 2136)
+	TSIGOperationNotify   = "notify"   // NOTIFY messages from primaries
+)
+
+// TSIGKey is a shared secret used to sign DNS messages (RFC 8945)
+type TSIGKey struct {
+	Name       string    `json:"name" example:"ddns-key."`                           // Key name, as sent in the TSIG record
+	Algorithm  string    `json:"algorithm" example:"hmac-sha256."`                   // HMAC algorithm
+	Secret     string    `json:"secret,omitempty"`                                   // Base64-encoded secret, only returned when created or rotated
+	Zones      []string  `json:"zones,omitempty" example:"example.lan."`             // Zones the key may be used for (all zones when empty)
+	Operations []string  `json:"operations,omitempty" example:"transfer,update"`     // Operations the key may be used for (all operations when empty)
+	CreatedAt  time.Time `json:"created_at,omitzero" example:"2025-01-15T10:30:00Z"` // When the key was created
+	RotatedAt  time.Time `json:"rotated_at,omitzero" example:"2025-01-15T10:30:00Z"` // When the secret was last replaced
+}
+
+// tsigAlgorithms lists the supported HMAC algorithms and their secret sizes in bytes
+var tsigAlgorithms = map[string]int{
+	dns.HmacSHA256: 32,
+	dns.HmacSHA512: 64,
+}
+
+// tsigOperations lists the operations a key can be scoped to
+var tsigOperations = []string{TSIGOperationTransfer, TSIGOperationUpdate, TSIGOperationNotify}
+
+// Validate checks and normalizes the key
+// The name and algorithm are converted to FQDNs; "hmac-sha256" is the default algorithm.
+func (k *TSIGKey) Validate() error {
+	if strings.TrimSpace(k.Name) == "" {
+		return fmt.Errorf("invalid TSIG key: name is required")
+	}
+	k.Name = dns.CanonicalName(strings.TrimSpace(k.Name))
+
+	if k.Algorithm == "" {
+		k.Algorithm = dns.HmacSHA256
+	}
+	k.Algorithm = dns.CanonicalName(strings.TrimSpace(k.Algorithm))
+	if _, ok := tsigAlgorithms[k.Algorithm]; !ok {
+		return fmt.Errorf("invalid TSIG key %s: unsupported algorithm %s", k.Name, k.Algorithm)
+	}
+
+	secret, err := base64.StdEncoding.DecodeString(k.Secret)
+	if err != nil || len(secret) == 0 {
+		return fmt.Errorf("invalid TSIG key %s: secret must be base64-encoded", k.Name)
+	}
+
+	return k.validateScope()
+}
+
+// validateScope checks and normalizes the zones and operations of the key
+func (k *TSIGKey) validateScope() error {
+	for i, zone := range k.Zones {
+		zone = strings.TrimSpace(zone)
+		if _, ok := dns.IsDomainName(zone); !ok || zone == "" {
+			return fmt.Errorf("invalid TSIG key %s: invalid zone %q", k.Name, zone)
+		}
+		k.Zones[i] = dns.CanonicalName(zone)
+	}
+
+	for i, op := range k.Operations {
+		op = strings.ToLower(strings.TrimSpace(op))
+		if !slices.Contains(tsigOperations, op) {
+			return fmt.Errorf("invalid TSIG key %s: unknown operation %q (expected %s)", k.Name, op, strings.Join(tsigOperations, ", "))
+		}
+		k.Operations[i] = op
+	}
+
+	return nil
+}
+
+// GenerateSecret replaces the secret with random bytes of the algorithm's hash size
+func (k *TSIGKey) GenerateSecret() error {
+	size, ok := tsigAlgorithms[dns.CanonicalName(k.Algorithm)]
+	if !ok {
+		return fmt.Errorf("invalid TSIG key %s: unsupported algorithm %s", k.Name, k.Algorithm)
+	}
+
+	secret := make([]byte, size)
+	if _, err := rand.Read(secret); err != nil {
+		return fmt.Errorf("failed to generate TSIG secret: %w", err)
+	}
+	k.Secret = base64.StdEncoding.EncodeToString(secret)
+
+	return nil
+}
+
+// Permits reports whether the key may sign messages for an operation on a zone
+func (k *TSIGKey) Permits(zone, operation string) bool {
+	if len(k.Operations) > 0 && !slices.Contains(k.Operations, operation) {
+		return false
+	}
+	if len(k.Zones) == 0 {
+		return true
+	}
+	return slices.Contains(k.Zones, dns.CanonicalName(zone))
+}
+
+// ParseTSIGKeys parses a comma-separated list of keys in name:algorithm:secret form
+// The algorithm may be omitted (name:secret) to use hmac-sha256.
+func ParseTSIGKeys(spec string) ([]TSIGKey, error) {
+	var keys []TSIGKey
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		var key TSIGKey
+		parts := strings.SplitN(entry, ":", 3)
+		switch len(parts) {
+		case 2:
+			key = TSIGKey{Name: parts[0], Secret: parts[1]}
+		case 3:
+			key = TSIGKey{Name: parts[0], Algorithm: parts[1], Secret: parts[2]}
+		default:
+			return nil, fmt.Errorf("invalid TSIG key %q: expected name:algorithm:secret", entry)
+		}
+
+		if err := key.Validate(); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
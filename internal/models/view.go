@@ -0,0 +1,103 @@
+package models
+
+import (
+	"fmt"
+	"net/netip"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// View is a named set of client networks for split-horizon DNS. Clients in a view get the
+// records of a zone's overlay for that view, e.g. internal addresses for office clients,
+// while other clients get the zone's default records. When a client is in several views,
+// the view with the longest matching prefix wins.
+type View struct {
+	Name        string    `json:"name" example:"office"`
+	Prefixes    []string  `json:"prefixes" example:"10.0.0.0/8,fd00::/8"` // Client networks in the view
+	Description string    `json:"description,omitempty" example:"Office network"`
+	CreatedAt   time.Time `json:"created_at,omitzero" example:"2025-01-15T10:30:00Z"`
+	UpdatedAt   time.Time `json:"updated_at,omitzero" example:"2025-01-15T10:30:00Z"`
+}
+
+// ZoneView holds the records a zone serves to the clients of a view
+type ZoneView struct {
+	Name    string      `json:"name" example:"office"` // Name of the view
+	Records []DNSRecord `json:"records"`               // Records replacing the zone's RRsets of the same name and type
+}
+
+var viewNamePattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9_-]{0,61}[a-z0-9])?$`)
+
+// ValidateViewName checks the name of a view
+func ValidateViewName(name string) error {
+	if !viewNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid view name %q: use lowercase letters, digits, '-' and '_'", name)
+	}
+	return nil
+}
+
+// Validate checks and normalizes the view
+func (v *View) Validate() error {
+	v.Name = strings.ToLower(strings.TrimSpace(v.Name))
+	if err := ValidateViewName(v.Name); err != nil {
+		return err
+	}
+
+	prefixes := make([]string, 0, len(v.Prefixes))
+	for _, s := range v.Prefixes {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return fmt.Errorf("invalid view %s: %w", v.Name, err)
+		}
+		prefixes = append(prefixes, prefix.Masked().String())
+	}
+	if len(prefixes) == 0 {
+		return fmt.Errorf("invalid view %s: at least one prefix is required", v.Name)
+	}
+	v.Prefixes = prefixes
+	return nil
+}
+
+// View returns the overlay of the zone for a view, or nil when the zone has none
+func (z *DNSZone) View(name string) *ZoneView {
+	for i := range z.Views {
+		if z.Views[i].Name == name {
+			return &z.Views[i]
+		}
+	}
+	return nil
+}
+
+// InView returns the zone as the clients of a view see it: the view's RRsets replace the
+// default RRsets of the same name and type. A CNAME in the view replaces every default
+// record at its name, and other records in the view replace a default CNAME at their name.
+// Disabled records in the view don't replace anything.
+// The zone itself is returned when it has no overlay for the view.
+func (z *DNSZone) InView(name string) *DNSZone {
+	view := z.View(name)
+	if view == nil {
+		return z
+	}
+
+	replaced := func(record DNSRecord) bool {
+		for _, r := range view.Records {
+			if r.Disabled || !strings.EqualFold(r.Name, record.Name) {
+				continue
+			}
+			if r.Type == record.Type || r.Type == "CNAME" || record.Type == "CNAME" {
+				return true
+			}
+		}
+		return false
+	}
+
+	merged := *z
+	merged.Records = slices.DeleteFunc(slices.Clone(z.Records), replaced)
+	merged.Records = append(merged.Records, view.Records...)
+	merged.Views = nil
+	return &merged
+}
@@ -0,0 +1,81 @@
+package models
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestViewValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		view    View
+		wantErr bool
+	}{
+		{"prefixes are masked", View{Name: " Office ", Prefixes: []string{"10.1.2.3/8", " fd00::/8", ""}}, false},
+		{"no prefixes", View{Name: "office"}, true},
+		{"invalid prefix", View{Name: "office", Prefixes: []string{"10.0.0.0/33"}}, true},
+		{"invalid name", View{Name: "office net", Prefixes: []string{"10.0.0.0/8"}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.view.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && (tt.view.Name != "office" || !slices.Equal(tt.view.Prefixes, []string{"10.0.0.0/8", "fd00::/8"})) {
+				t.Errorf("Validate() = %+v, want the normalized name and prefixes", tt.view)
+			}
+		})
+	}
+}
+
+func TestZoneInView(t *testing.T) {
+	disabled := NewARecord("mail.example.lan.", "10.0.0.25", 300)
+	disabled.Disabled = true
+	zone := &DNSZone{
+		Domain: "example.lan.",
+		Records: []DNSRecord{
+			NewARecord("app.example.lan.", "203.0.113.5", 300),
+			NewARecord("app.example.lan.", "203.0.113.6", 300),
+			NewAAAARecord("app.example.lan.", "2001:db8::5", 300),
+			NewCNAMERecord("www.example.lan.", "app.example.lan.", 300),
+			NewARecord("api.example.lan.", "203.0.113.7", 300),
+			NewTXTRecord("api.example.lan.", "public", 300),
+			NewARecord("mail.example.lan.", "203.0.113.25", 300),
+		},
+		Views: []ZoneView{{Name: "office", Records: []DNSRecord{
+			NewARecord("app.example.lan.", "10.0.0.5", 300),
+			NewARecord("www.example.lan.", "10.0.0.80", 300),
+			NewCNAMERecord("api.example.lan.", "api.office.example.lan.", 300),
+			disabled,
+		}}},
+	}
+
+	if got := zone.InView("guest"); got != zone {
+		t.Error("InView() of a view without records should return the zone itself")
+	}
+
+	got := zone.InView("office")
+	var records []string
+	for _, r := range got.Records {
+		if !r.Disabled {
+			records = append(records, r.Name+" "+r.Type+" "+r.GetRData())
+		}
+	}
+	want := []string{
+		// The AAAA RRset isn't replaced by the view's A RRset
+		"app.example.lan. AAAA 2001:db8::5",
+		"mail.example.lan. A 203.0.113.25",
+		"app.example.lan. A 10.0.0.5",
+		// Records in the view replace a CNAME, a CNAME in the view replaces every record
+		"www.example.lan. A 10.0.0.80",
+		"api.example.lan. CNAME api.office.example.lan.",
+	}
+	if !slices.Equal(records, want) {
+		t.Errorf("InView() records = %q, want %q", records, want)
+	}
+	if len(zone.Records) != 7 || len(got.Views) != 0 {
+		t.Error("InView() must not change the zone")
+	}
+}
@@ -0,0 +1,89 @@
+package models
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// ZoneTransferACL controls which secondaries may transfer a zone (AXFR/IXFR)
+// A transfer is allowed when the client address matches one of the prefixes and,
+// if TSIG keys are listed, the request is signed with one of them.
+type ZoneTransferACL struct {
+	AllowPrefixes []string `json:"allow_prefixes" example:"192.168.1.53/32,10.0.0.0/24"` // Client networks allowed to transfer the zone
+	TSIGKeys      []string `json:"tsig_keys,omitempty" example:"transfer-key."`          // Optional TSIG key names, one of which must sign the request
+}
+
+// Validate checks and normalizes the ACL
+// Bare IP addresses are converted to single-host prefixes and key names to FQDNs.
+func (a *ZoneTransferACL) Validate() error {
+	if len(a.AllowPrefixes) == 0 {
+		return fmt.Errorf("invalid transfer ACL: at least one allowed prefix is required")
+	}
+
+	for i, value := range a.AllowPrefixes {
+		prefix, err := ParsePrefixOrAddr(value)
+		if err != nil {
+			return fmt.Errorf("invalid transfer ACL: %w", err)
+		}
+		a.AllowPrefixes[i] = prefix.String()
+	}
+
+	for i, key := range a.TSIGKeys {
+		if strings.TrimSpace(key) == "" {
+			return fmt.Errorf("invalid transfer ACL: empty TSIG key name")
+		}
+		a.TSIGKeys[i] = dns.CanonicalName(key)
+	}
+
+	return nil
+}
+
+// Allows reports whether a client may transfer the zone
+// tsigKey is the name of the key that signed the request (verified), or empty.
+func (a *ZoneTransferACL) Allows(addr netip.Addr, tsigKey string) bool {
+	addr = addr.Unmap()
+
+	matched := false
+	for _, value := range a.AllowPrefixes {
+		prefix, err := ParsePrefixOrAddr(value)
+		if err == nil && prefix.Contains(addr) {
+			matched = true
+			break
+		}
+	}
+	if !matched {
+		return false
+	}
+
+	if len(a.TSIGKeys) == 0 {
+		return true
+	}
+	for _, key := range a.TSIGKeys {
+		if tsigKey != "" && strings.EqualFold(dns.Fqdn(key), dns.Fqdn(tsigKey)) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParsePrefixOrAddr parses a CIDR prefix or a single IP address (as a host prefix)
+func ParsePrefixOrAddr(value string) (netip.Prefix, error) {
+	value = strings.TrimSpace(value)
+	if strings.Contains(value, "/") {
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("invalid prefix %q: %w", value, err)
+		}
+		return prefix.Masked(), nil
+	}
+
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid address %q: %w", value, err)
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
@@ -0,0 +1,45 @@
+package models
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestZoneTransferACLAllows(t *testing.T) {
+	acl := &ZoneTransferACL{
+		AllowPrefixes: []string{"192.168.1.53", "10.0.0.0/24"},
+		TSIGKeys:      []string{"transfer-key"},
+	}
+	if err := acl.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	if acl.AllowPrefixes[0] != "192.168.1.53/32" || acl.TSIGKeys[0] != "transfer-key." {
+		t.Errorf("Validate() did not normalize the ACL: %+v", acl)
+	}
+
+	tests := []struct {
+		name string
+		addr string
+		key  string
+		want bool
+	}{
+		{"host with key", "192.168.1.53", "transfer-key.", true},
+		{"network with key", "10.0.0.7", "TRANSFER-KEY.", true},
+		{"IPv4-mapped address", "::ffff:10.0.0.7", "transfer-key.", true},
+		{"unsigned request", "192.168.1.53", "", false},
+		{"other key", "192.168.1.53", "other-key.", false},
+		{"address outside ACL", "192.168.1.54", "transfer-key.", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := acl.Allows(netip.MustParseAddr(tt.addr), tt.key); got != tt.want {
+				t.Errorf("Allows(%s, %q) = %v, want %v", tt.addr, tt.key, got, tt.want)
+			}
+		})
+	}
+
+	if err := (&ZoneTransferACL{}).Validate(); err == nil {
+		t.Error("Validate() accepted an ACL without prefixes")
+	}
+}
@@ -39,6 +39,11 @@ func NewSeedingService(
 func (s *SeedingService) SeedDefaults(ctx context.Context, config SeedConfig) error {
 	vlog.Info("starting configuration seeding...")
 
+	// Seed upstream DNS servers, or load the stored ones; queries can't be forwarded without them
+	if err := s.upstreamService.SeedDefault(ctx, config.DefaultUpstreamServers); err != nil {
+		return err
+	}
+
 	// Seed test data if in development mode
 	if viper.GetBool(consts.DEVELOPMENT) {
 		// Seed allowed LANs
@@ -46,11 +51,6 @@ func (s *SeedingService) SeedDefaults(ctx context.Context, config SeedConfig) er
 			return err
 		}
 
-		// Seed upstream DNS server
-		if err := s.upstreamService.SeedDefault(ctx, config.DefaultUpstreamServer); err != nil {
-			return err
-		}
-
 		vlog.Info("development mode detected - seeding test data...")
 		if err := s.seedTestData(ctx); err != nil {
 			vlog.Warnf("failed to seed test data: %v", err)
@@ -67,7 +67,7 @@ func (s *SeedingService) SeedDefaults(ctx context.Context, config SeedConfig) er
 // SeedConfig holds the default configuration values to seed
 type SeedConfig struct {
 	DefaultAllowedPrefixes []netip.Prefix
-	DefaultUpstreamServer  string
+	DefaultUpstreamServers []string
 }
 
 // seedTestData seeds test zones and records for development/testing
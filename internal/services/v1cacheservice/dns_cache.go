@@ -2,17 +2,24 @@ package v1cacheservice
 
 import (
 	"context"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/miekg/dns"
+	"github.com/rogerwesterbo/godns/internal/models"
 	"github.com/vitistack/common/pkg/loggers/vlog"
 )
 
+// bogusTTL limits how long bogus responses are cached (RFC 4035 section 4.7)
+const bogusTTL = time.Minute
+
 // CacheEntry represents a cached DNS response
 type CacheEntry struct {
 	Response  *dns.Msg
 	ExpiresAt time.Time
+	// Validation is the DNSSEC validation result of an upstream response, nil when it wasn't validated
+	Validation *models.DNSSECValidation
 }
 
 // DNSCache implements a thread-safe DNS response cache with TTL and LRU eviction
@@ -49,13 +56,19 @@ func NewDNSCache(maxSize int, defaultTTL time.Duration) *DNSCache {
 
 // Get retrieves a DNS response from the cache
 func (c *DNSCache) Get(ctx context.Context, key string) (*dns.Msg, bool) {
+	response, _, found := c.GetValidated(ctx, key)
+	return response, found
+}
+
+// GetValidated retrieves a DNS response and its DNSSEC validation result from the cache
+func (c *DNSCache) GetValidated(ctx context.Context, key string) (*dns.Msg, *models.DNSSECValidation, bool) {
 	c.mu.RLock()
 	entry, exists := c.entries[key]
 	c.mu.RUnlock()
 
 	if !exists {
 		c.misses++
-		return nil, false
+		return nil, nil, false
 	}
 
 	// Check if expired
@@ -64,7 +77,7 @@ func (c *DNSCache) Get(ctx context.Context, key string) (*dns.Msg, bool) {
 		delete(c.entries, key)
 		c.mu.Unlock()
 		c.misses++
-		return nil, false
+		return nil, nil, false
 	}
 
 	// Update access list for LRU
@@ -72,11 +85,17 @@ func (c *DNSCache) Get(ctx context.Context, key string) (*dns.Msg, bool) {
 
 	c.hits++
 	// Return a copy to avoid modifications
-	return entry.Response.Copy(), true
+	return entry.Response.Copy(), entry.Validation, true
 }
 
 // Set stores a DNS response in the cache
 func (c *DNSCache) Set(ctx context.Context, key string, response *dns.Msg) {
+	c.SetValidated(ctx, key, response, nil)
+}
+
+// SetValidated stores a DNS response together with its DNSSEC validation result
+// Bogus responses are kept for at most a minute, so a fixed zone is picked up soon.
+func (c *DNSCache) SetValidated(ctx context.Context, key string, response *dns.Msg, validation *models.DNSSECValidation) {
 	if response == nil {
 		return
 	}
@@ -90,11 +109,17 @@ func (c *DNSCache) Set(ctx context.Context, key string, response *dns.Msg) {
 	}
 
 	// Determine TTL from the response or use default
+	// Negative answers and referrals carry their records in the authority section;
+	// for negative answers that is the SOA, whose TTL is the negative TTL (RFC 2308).
 	ttl := c.ttl
-	if len(response.Answer) > 0 {
+	records := response.Answer
+	if len(records) == 0 {
+		records = response.Ns
+	}
+	if len(records) > 0 {
 		// Use the minimum TTL from all records
 		minTTL := uint32(c.ttl.Seconds())
-		for _, rr := range response.Answer {
+		for _, rr := range records {
 			if rr.Header().Ttl < minTTL {
 				minTTL = rr.Header().Ttl
 			}
@@ -103,10 +128,14 @@ func (c *DNSCache) Set(ctx context.Context, key string, response *dns.Msg) {
 			ttl = time.Duration(minTTL) * time.Second
 		}
 	}
+	if validation != nil && validation.Security == models.DNSSECBogus && ttl > bogusTTL {
+		ttl = bogusTTL
+	}
 
 	c.entries[key] = &CacheEntry{
-		Response:  response.Copy(),
-		ExpiresAt: time.Now().Add(ttl),
+		Response:   response.Copy(),
+		ExpiresAt:  time.Now().Add(ttl),
+		Validation: validation,
 	}
 
 	c.accessList.add(key)
@@ -121,6 +150,33 @@ func (c *DNSCache) Delete(ctx context.Context, key string) {
 	c.accessList.remove(key)
 }
 
+// DeleteZone removes the entries for names at or below a zone
+// It is used after a zone changed, so no stale answers are served from the cache.
+// Calls on a nil cache are ignored, so callers with the cache disabled need no checks.
+func (c *DNSCache) DeleteZone(ctx context.Context, zone string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	zone = dns.Fqdn(zone)
+	removed := 0
+	for key := range c.entries {
+		name, _, _ := strings.Cut(key, ":")
+		if dns.IsSubDomain(zone, name) {
+			delete(c.entries, key)
+			c.accessList.remove(key)
+			removed++
+		}
+	}
+
+	if removed > 0 {
+		vlog.Debugf("Removed %d cache entries of zone %s", removed, zone)
+	}
+}
+
 // Clear removes all entries from the cache
 func (c *DNSCache) Clear(ctx context.Context) {
 	c.mu.Lock()
@@ -0,0 +1,60 @@
+package v1dnssecservice
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+)
+
+// keyCipher encrypts private keys with AES-256-GCM
+// The zone name is authenticated with each key, so a stored key can't be moved to another zone.
+type keyCipher struct {
+	aead cipher.AEAD
+}
+
+// newKeyCipher derives the AES key from the configured encryption key
+func newKeyCipher(encryptionKey string) (*keyCipher, error) {
+	if encryptionKey == "" {
+		return nil, fmt.Errorf("a DNSSEC encryption key is required")
+	}
+
+	sum := sha256.Sum256([]byte(encryptionKey))
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+
+	return &keyCipher{aead: aead}, nil
+}
+
+// encrypt returns the base64 encoded nonce and ciphertext
+func (c *keyCipher) encrypt(plain []byte, zone string) (string, error) {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	sealed := c.aead.Seal(nonce, nonce, plain, []byte(zone))
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decrypt reverses encrypt; it fails when the encryption key or zone differ
+func (c *keyCipher) decrypt(encoded string, zone string) ([]byte, error) {
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < c.aead.NonceSize() {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+
+	nonce, ciphertext := sealed[:c.aead.NonceSize()], sealed[c.aead.NonceSize():]
+	return c.aead.Open(nil, nonce, ciphertext, []byte(zone))
+}
@@ -0,0 +1,356 @@
+package v1dnssecservice
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/rogerwesterbo/godns/internal/models"
+	"github.com/vitistack/common/pkg/loggers/vlog"
+)
+
+// Key types of rollovers
+const (
+	KeyTypeZSK = "zsk"
+	KeyTypeKSK = "ksk"
+)
+
+const (
+	// rolloverSafety is added to every wait for records to expire from resolver caches
+	rolloverSafety = time.Hour
+
+	// keyPropagation is how long a changed DNSKEY RRset takes to replace the old one in caches
+	keyPropagation = DNSKEYTTL*time.Second + rolloverSafety
+
+	// parentDSTTL is the TTL assumed for DS records in the parent zone; the old KSK stays
+	// until DS records pointing at it have expired
+	parentDSTTL = 24 * time.Hour
+
+	// removedKeyRetention is how long removed keys are kept for the record
+	removedKeyRetention = 30 * 24 * time.Hour
+)
+
+// RolloverPolicy sets the lifetimes after which keys are rolled over
+// A zero lifetime disables automatic rollovers of that key type.
+type RolloverPolicy struct {
+	ZSKLifetime time.Duration
+	KSKLifetime time.Duration
+}
+
+// ForZone returns the policy with the key lifetimes a zone sets itself
+func (p RolloverPolicy) ForZone(settings *models.DNSSECSettings) RolloverPolicy {
+	if settings == nil {
+		return p
+	}
+	if settings.ZSKLifetimeDays > 0 {
+		p.ZSKLifetime = time.Duration(settings.ZSKLifetimeDays) * 24 * time.Hour
+	}
+	if settings.KSKLifetimeDays > 0 {
+		p.KSKLifetime = time.Duration(settings.KSKLifetimeDays) * 24 * time.Hour
+	}
+	return p
+}
+
+// Rollover advances the key rollovers of a signed zone and returns the key types of the rollovers
+// it started. Rollovers start when a key reached the lifetime of the zone's policy.
+//
+// A ZSK is rolled over with pre-publication: the new key is published, becomes active once the
+// DNSKEY RRset with it has propagated, and the old key is removed once the signatures it made
+// have expired from caches. A KSK is rolled over with double signatures: the new key signs the
+// DNSKEY RRset next to the old one until the parent has its DS record (see ConfirmDS), then the
+// old key is removed once the old DS record has expired.
+func (s *V1DNSSECService) Rollover(ctx context.Context, zone *models.DNSZone) ([]string, error) {
+	if !zone.Signed() {
+		return nil, nil
+	}
+	domain := dns.CanonicalName(zone.Domain)
+	policy := s.policy.ForZone(zone.DNSSEC)
+
+	s.rolloverMu.Lock()
+	defer s.rolloverMu.Unlock()
+
+	keys, err := s.getKeys(ctx, domain)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	now := s.now().UTC()
+	changed := false
+	var started []string
+
+	for _, keyType := range []string{KeyTypeZSK, KeyTypeKSK} {
+		lifetime := policy.ZSKLifetime
+		if keyType == KeyTypeKSK {
+			lifetime = policy.KSKLifetime
+		}
+		active, published := rolloverKeys(keys, keyType)
+		if lifetime <= 0 || published != nil || active == nil || now.Before(activatedAt(active).Add(lifetime)) {
+			continue
+		}
+
+		key, err := s.generateKey(domain, keyFlags(keyType), active.Algorithm, models.DNSSECKeyPublished)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *key)
+		changed = true
+		started = append(started, keyType)
+		vlog.Infof("Started %s rollover of zone %s: published key %d to replace key %d", strings.ToUpper(keyType), domain, key.KeyTag, active.KeyTag)
+	}
+
+	// A published ZSK takes over signing once it is in every cached DNSKEY RRset
+	if _, published := rolloverKeys(keys, KeyTypeZSK); published != nil && !now.Before(published.CreatedAt.Add(keyPropagation)) {
+		for i := range keys {
+			if !keys[i].IsKSK() && keys[i].State == models.DNSSECKeyActive {
+				retire(&keys[i], now)
+			}
+		}
+		published.State = models.DNSSECKeyActive
+		published.ActivatedAt = &now
+		changed = true
+		vlog.Infof("Activated ZSK %d of zone %s", published.KeyTag, domain)
+	}
+
+	maxTTL := zoneMaxTTL(zone)
+	kept := make([]models.DNSSECKey, 0, len(keys))
+	for i := range keys {
+		key := &keys[i]
+		switch {
+		case key.State == models.DNSSECKeyRetired && !now.Before(key.RetiredAt.Add(retiredKeyWait(key, maxTTL))):
+			key.State = models.DNSSECKeyRemoved
+			key.RemovedAt = &now
+			key.PrivateKey = ""
+			changed = true
+			vlog.Infof("Removed retired key %d from zone %s", key.KeyTag, domain)
+		case key.Removed() && key.RemovedAt != nil && now.After(key.RemovedAt.Add(removedKeyRetention)):
+			changed = true
+			continue
+		}
+		kept = append(kept, *key)
+	}
+
+	if !changed {
+		return nil, nil
+	}
+	if err := s.saveKeys(ctx, domain, kept); err != nil {
+		return nil, err
+	}
+	return started, nil
+}
+
+// StartRollover starts a rollover of the zone's ZSK or KSK now instead of at the end of its lifetime
+func (s *V1DNSSECService) StartRollover(ctx context.Context, zone *models.DNSZone, keyType string) error {
+	domain := dns.CanonicalName(zone.Domain)
+	keyType = strings.ToLower(keyType)
+	if keyType != KeyTypeZSK && keyType != KeyTypeKSK {
+		return fmt.Errorf("invalid key type %q: must be %s or %s", keyType, KeyTypeZSK, KeyTypeKSK)
+	}
+
+	s.rolloverMu.Lock()
+	defer s.rolloverMu.Unlock()
+
+	keys, err := s.getKeys(ctx, domain)
+	if err != nil {
+		return err
+	}
+	active, published := rolloverKeys(keys, keyType)
+	if active == nil {
+		return fmt.Errorf("DNSSEC keys of zone %s not found", domain)
+	}
+	if published != nil {
+		return fmt.Errorf("invalid rollover: a %s rollover of zone %s is already in progress", strings.ToUpper(keyType), domain)
+	}
+
+	key, err := s.generateKey(domain, keyFlags(keyType), active.Algorithm, models.DNSSECKeyPublished)
+	if err != nil {
+		return err
+	}
+	if err := s.saveKeys(ctx, domain, append(keys, *key)); err != nil {
+		return err
+	}
+
+	vlog.Infof("Started %s rollover of zone %s: published key %d to replace key %d", strings.ToUpper(keyType), domain, key.KeyTag, active.KeyTag)
+	return nil
+}
+
+// ConfirmDS completes the parent side of a KSK rollover: the parent has the DS record of the new
+// KSK, which becomes active, and the old KSK is retired
+func (s *V1DNSSECService) ConfirmDS(ctx context.Context, zone string) error {
+	zone = dns.CanonicalName(zone)
+
+	s.rolloverMu.Lock()
+	defer s.rolloverMu.Unlock()
+
+	keys, err := s.getKeys(ctx, zone)
+	if err != nil {
+		return err
+	}
+	_, published := rolloverKeys(keys, KeyTypeKSK)
+	if published == nil {
+		return fmt.Errorf("invalid request: zone %s has no KSK waiting for its DS record", zone)
+	}
+
+	now := s.now().UTC()
+	if ready := published.CreatedAt.Add(keyPropagation); now.Before(ready) {
+		return fmt.Errorf("invalid request: the new KSK %d of zone %s is propagating, its DS record can be published from %s", published.KeyTag, zone, ready.Format(time.RFC3339))
+	}
+
+	for i := range keys {
+		if !keys[i].IsKSK() {
+			continue
+		}
+		switch keys[i].State {
+		case models.DNSSECKeyActive:
+			retire(&keys[i], now)
+		case models.DNSSECKeyPublished:
+			keys[i].State = models.DNSSECKeyActive
+			keys[i].ActivatedAt = &now
+		}
+	}
+	if err := s.saveKeys(ctx, zone, keys); err != nil {
+		return err
+	}
+
+	vlog.Infof("DS record of KSK %d of zone %s is at the parent, the KSK is active", published.KeyTag, zone)
+	return nil
+}
+
+// Status returns the signing keys of a zone, the DS records the parent should have
+// and when the next rollovers are due
+func (s *V1DNSSECService) Status(ctx context.Context, zone *models.DNSZone) (*models.DNSSECStatus, error) {
+	domain := dns.CanonicalName(zone.Domain)
+	policy := s.policy.ForZone(zone.DNSSEC)
+
+	keys, err := s.Keys(ctx, domain)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("DNSSEC keys of zone %s not found", domain)
+	}
+
+	status := &models.DNSSECStatus{
+		Zone: domain,
+		Keys: keys,
+	}
+	if zone.DNSSEC != nil {
+		status.Settings = *zone.DNSSEC
+	}
+
+	ksks, pending := parentKSKs(keys, s.now())
+	status.DSPending = pending
+	if status.DS, err = delegationSigners(domain, ksks); err != nil {
+		return nil, err
+	}
+
+	status.NextZSKRollover = nextRollover(keys, KeyTypeZSK, policy.ZSKLifetime)
+	status.NextKSKRollover = nextRollover(keys, KeyTypeKSK, policy.KSKLifetime)
+	return status, nil
+}
+
+// PendingDS returns the DS records a zone waits for at the parent during a KSK rollover,
+// or none when no rollover waits for the parent
+func (s *V1DNSSECService) PendingDS(ctx context.Context, zone string) ([]models.DelegationSigner, error) {
+	zone = dns.CanonicalName(zone)
+
+	keys, err := s.getKeys(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	ksks, pending := parentKSKs(keys, s.now())
+	if !pending {
+		return nil, nil
+	}
+	return delegationSigners(zone, ksks)
+}
+
+// parentKSKs returns the key signing keys the parent's DS records should point to: the new KSK
+// of a rollover once its DNSKEY has propagated (pending is true), otherwise the active KSK
+func parentKSKs(keys []models.DNSSECKey, now time.Time) (ksks []models.DNSSECKey, pending bool) {
+	for i := range keys {
+		key := keys[i]
+		if key.IsKSK() && key.State == models.DNSSECKeyPublished && !now.Before(key.CreatedAt.Add(keyPropagation)) {
+			return []models.DNSSECKey{key}, true
+		}
+	}
+	for i := range keys {
+		if keys[i].IsKSK() && keys[i].State == models.DNSSECKeyActive {
+			ksks = append(ksks, keys[i])
+		}
+	}
+	return ksks, false
+}
+
+// rolloverKeys returns the active key of a type and the published key replacing it, if any
+func rolloverKeys(keys []models.DNSSECKey, keyType string) (active, published *models.DNSSECKey) {
+	for i := range keys {
+		key := &keys[i]
+		if key.IsKSK() != (keyType == KeyTypeKSK) {
+			continue
+		}
+		switch key.State {
+		case models.DNSSECKeyActive:
+			if active == nil || activatedAt(key).After(activatedAt(active)) {
+				active = key
+			}
+		case models.DNSSECKeyPublished:
+			published = key
+		}
+	}
+	return active, published
+}
+
+// nextRollover returns when the next rollover of a key type starts, or nil while one is in progress
+func nextRollover(keys []models.DNSSECKey, keyType string, lifetime time.Duration) *time.Time {
+	active, published := rolloverKeys(keys, keyType)
+	if lifetime <= 0 || active == nil || published != nil {
+		return nil
+	}
+	next := activatedAt(active).Add(lifetime)
+	return &next
+}
+
+// retiredKeyWait is how long a retired key stays in the DNSKEY RRset: until the records
+// signed with a ZSK or the DS records pointing at a KSK have expired from caches
+func retiredKeyWait(key *models.DNSSECKey, maxTTL time.Duration) time.Duration {
+	if key.IsKSK() {
+		return parentDSTTL + rolloverSafety
+	}
+	return maxTTL + rolloverSafety
+}
+
+// retire marks a key as retired at now
+func retire(key *models.DNSSECKey, now time.Time) {
+	key.State = models.DNSSECKeyRetired
+	key.RetiredAt = &now
+}
+
+// activatedAt returns when a key became active
+func activatedAt(key *models.DNSSECKey) time.Time {
+	if key.ActivatedAt != nil {
+		return *key.ActivatedAt
+	}
+	return key.CreatedAt
+}
+
+// keyFlags returns the DNSKEY flags of a key type
+func keyFlags(keyType string) uint16 {
+	if keyType == KeyTypeKSK {
+		return models.DNSKEYFlagsKSK
+	}
+	return models.DNSKEYFlagsZSK
+}
+
+// zoneMaxTTL returns the highest TTL of the zone's RRsets and DNSKEY RRset
+func zoneMaxTTL(zone *models.DNSZone) time.Duration {
+	maxTTL := uint32(DNSKEYTTL)
+	for _, record := range zone.Records {
+		maxTTL = max(maxTTL, record.TTL)
+	}
+	return time.Duration(maxTTL) * time.Second
+}
@@ -0,0 +1,173 @@
+package v1dnssecservice
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/rogerwesterbo/godns/internal/models"
+	"github.com/rogerwesterbo/godns/internal/services/v1metricsservice"
+	"github.com/rogerwesterbo/godns/internal/services/v1zoneservice"
+	"github.com/vitistack/common/pkg/loggers/vlog"
+)
+
+// RolloverScheduler rolls the keys of signed zones over when they reach their lifetime
+// A KSK rollover waits for the new DS record at the parent. When the parent zone is one of
+// ours, the DS record is detected there; otherwise the rollover continues once the DS update
+// is confirmed through the API. Zones waiting for their parent are reported in the metrics.
+type RolloverScheduler struct {
+	dnssecService *V1DNSSECService
+	zoneService   *v1zoneservice.V1ZoneService
+	metrics       *v1metricsservice.MetricsService
+	checkInterval time.Duration
+
+	// warned holds the zones whose pending DS update was logged
+	warned map[string]bool
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewRolloverScheduler creates a scheduler for the key rollovers of signed zones
+// metrics may be nil when metrics are disabled.
+func NewRolloverScheduler(dnssecService *V1DNSSECService, zoneService *v1zoneservice.V1ZoneService, metrics *v1metricsservice.MetricsService, checkInterval time.Duration) *RolloverScheduler {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &RolloverScheduler{
+		dnssecService: dnssecService,
+		zoneService:   zoneService,
+		metrics:       metrics,
+		checkInterval: checkInterval,
+		warned:        make(map[string]bool),
+		ctx:           ctx,
+		cancel:        cancel,
+	}
+}
+
+// Start begins checking the zones for due rollover steps in the background
+func (s *RolloverScheduler) Start() {
+	s.wg.Add(1)
+	go s.run()
+	vlog.Infof("DNSSEC key rollovers started (ZSK lifetime: %v, KSK lifetime: %v, check interval: %v)", s.dnssecService.policy.ZSKLifetime, s.dnssecService.policy.KSKLifetime, s.checkInterval)
+}
+
+// Stop stops the background checks
+func (s *RolloverScheduler) Stop() {
+	s.cancel()
+	s.wg.Wait()
+}
+
+func (s *RolloverScheduler) run() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.checkInterval)
+	defer ticker.Stop()
+
+	s.Check(s.ctx)
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+			s.Check(s.ctx)
+		}
+	}
+}
+
+// Check advances the rollovers of every signed zone and updates the pending DS metric
+func (s *RolloverScheduler) Check(ctx context.Context) {
+	zones, err := s.zoneService.ListZones(ctx)
+	if err != nil {
+		vlog.Warnf("failed to list zones for DNSSEC key rollovers: %v", err)
+		return
+	}
+
+	var pending []string
+	for i := range zones {
+		zone := &zones[i]
+		if !zone.Signed() || zone.IsSecondary() {
+			continue
+		}
+		domain := dns.CanonicalName(zone.Domain)
+
+		started, err := s.dnssecService.Rollover(ctx, zone)
+		if err != nil {
+			vlog.Warnf("DNSSEC key rollover of zone %s failed: %v", domain, err)
+			continue
+		}
+		if s.metrics != nil {
+			for _, keyType := range started {
+				s.metrics.RecordDNSSECKeyRollover(domain, keyType)
+			}
+		}
+
+		if s.waitsForParent(ctx, domain) {
+			pending = append(pending, domain)
+		}
+	}
+
+	if s.metrics != nil {
+		s.metrics.UpdateDNSSECDSPending(pending)
+	}
+}
+
+// waitsForParent completes the KSK rollover of a zone whose new DS record is in a parent zone
+// we serve, and reports whether the zone still waits for the DS update at its parent
+func (s *RolloverScheduler) waitsForParent(ctx context.Context, domain string) bool {
+	signers, err := s.dnssecService.PendingDS(ctx, domain)
+	if err != nil {
+		vlog.Warnf("failed to check pending DS of zone %s: %v", domain, err)
+		return false
+	}
+	if len(signers) == 0 {
+		delete(s.warned, domain)
+		return false
+	}
+
+	if s.parentHasDS(ctx, domain, signers) {
+		if err := s.dnssecService.ConfirmDS(ctx, domain); err != nil {
+			vlog.Warnf("failed to complete KSK rollover of zone %s: %v", domain, err)
+			return true
+		}
+		delete(s.warned, domain)
+		return false
+	}
+
+	if !s.warned[domain] {
+		s.warned[domain] = true
+		vlog.Warnf("KSK rollover of zone %s waits for the parent zone: publish %s and confirm it at /api/v1/zones/%s/dnssec/ds-published", domain, signers[0].DS, strings.TrimSuffix(domain, "."))
+	}
+	return true
+}
+
+// parentHasDS reports whether the closest parent zone we serve has one of the DS records
+func (s *RolloverScheduler) parentHasDS(ctx context.Context, domain string, signers []models.DelegationSigner) bool {
+	labels := dns.SplitDomainName(domain)
+	for i := 1; i < len(labels); i++ {
+		parent, err := s.zoneService.GetZone(ctx, dns.Fqdn(strings.Join(labels[i:], ".")))
+		if err != nil {
+			continue
+		}
+
+		for _, record := range parent.Records {
+			if record.Type != "DS" || !strings.EqualFold(dns.CanonicalName(record.Name), domain) {
+				continue
+			}
+			rr, err := dns.NewRR(domain + " IN DS " + record.Value)
+			if err != nil {
+				continue
+			}
+			ds := rr.(*dns.DS)
+			for _, signer := range signers {
+				if ds.KeyTag == signer.KeyTag && ds.Algorithm == signer.Algorithm && ds.DigestType == signer.DigestType && strings.EqualFold(ds.Digest, signer.Digest) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	return false
+}
@@ -0,0 +1,246 @@
+package v1dnssecservice
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/rogerwesterbo/godns/internal/models"
+	"github.com/rogerwesterbo/godns/internal/services/v1zoneservice"
+	"github.com/rogerwesterbo/godns/internal/testutil/valkeytest"
+)
+
+// rolloverTestService returns a service with a signed example.lan. zone and a clock the test sets
+func rolloverTestService(t *testing.T, policy RolloverPolicy) (*V1DNSSECService, *models.DNSZone, *time.Time) {
+	t.Helper()
+
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	s, err := NewV1DNSSECService(valkeytest.NewMemoryValkey(), "test-encryption-key", policy)
+	if err != nil {
+		t.Fatalf("NewV1DNSSECService() error = %v", err)
+	}
+	s.now = func() time.Time { return now }
+
+	zone := &models.DNSZone{
+		Domain:  "example.lan.",
+		Records: []models.DNSRecord{models.NewARecord("web.example.lan.", "192.168.100.10", 300)},
+		Enabled: true,
+		DNSSEC:  &models.DNSSECSettings{Enabled: true},
+	}
+	if err := s.EnsureKeys(context.Background(), zone.Domain, zone.DNSSEC); err != nil {
+		t.Fatalf("EnsureKeys() error = %v", err)
+	}
+	return s, zone, &now
+}
+
+// keyStates returns the states of the zone's keys of one type, oldest key first
+func keyStates(t *testing.T, s *V1DNSSECService, keyType string) []string {
+	t.Helper()
+
+	keys, err := s.Keys(context.Background(), "example.lan.")
+	if err != nil {
+		t.Fatalf("Keys() error = %v", err)
+	}
+	var states []string
+	for i := range keys {
+		if keys[i].IsKSK() == (keyType == KeyTypeKSK) {
+			states = append(states, keys[i].State)
+		}
+	}
+	return states
+}
+
+// signingKeyTags returns the key tags of the signatures over an RRset
+func signingKeyTags(t *testing.T, s *V1DNSSECService, rrset []dns.RR) []uint16 {
+	t.Helper()
+
+	// Drop the decrypted keys so the states saved by the test are used
+	s.mu.Lock()
+	s.keys = make(map[string]*zoneKeys)
+	s.mu.Unlock()
+
+	sigs, err := s.SignRRset(context.Background(), "example.lan.", rrset, "")
+	if err != nil {
+		t.Fatalf("SignRRset() error = %v", err)
+	}
+	tags := make([]uint16, len(sigs))
+	for i, sig := range sigs {
+		tags[i] = sig.KeyTag
+	}
+	return tags
+}
+
+func TestZSKRollover(t *testing.T) {
+	ctx := context.Background()
+	s, zone, now := rolloverTestService(t, RolloverPolicy{ZSKLifetime: 30 * 24 * time.Hour})
+	rrset := []dns.RR{mustRR(t, "web.example.lan. 300 IN A 192.168.100.10")}
+	oldZSK := signingKeyTags(t, s, rrset)[0]
+
+	steps := []struct {
+		after       time.Duration
+		wantStarted int
+		wantStates  []string
+		wantDNSKEYs int
+		wantOldSign bool
+	}{
+		{24 * time.Hour, 0, []string{"active"}, 2, true},
+		{30 * 24 * time.Hour, 1, []string{"active", "published"}, 3, true},
+		{30*24*time.Hour + time.Hour, 0, []string{"active", "published"}, 3, true},
+		{30*24*time.Hour + keyPropagation, 0, []string{"retired", "active"}, 3, false},
+		{30*24*time.Hour + keyPropagation + DNSKEYTTL*time.Second + rolloverSafety, 0, []string{"removed", "active"}, 2, false},
+		// The removed key is dropped, and the new ZSK reached its lifetime as well
+		{30*24*time.Hour + keyPropagation + DNSKEYTTL*time.Second + rolloverSafety + removedKeyRetention + time.Hour, 1, []string{"active", "published"}, 3, false},
+	}
+
+	start := *now
+	for _, step := range steps {
+		*now = start.Add(step.after)
+		started, err := s.Rollover(ctx, zone)
+		if err != nil {
+			t.Fatalf("Rollover() after %v error = %v", step.after, err)
+		}
+		if len(started) != step.wantStarted {
+			t.Errorf("after %v: started %v, want %d rollovers", step.after, started, step.wantStarted)
+		}
+		if states := keyStates(t, s, KeyTypeZSK); strings.Join(states, ",") != strings.Join(step.wantStates, ",") {
+			t.Errorf("after %v: ZSK states %v, want %v", step.after, states, step.wantStates)
+		}
+		if dnskeys, _ := s.DNSKEYs(ctx, "example.lan."); len(dnskeys) != step.wantDNSKEYs {
+			t.Errorf("after %v: %d DNSKEYs, want %d", step.after, len(dnskeys), step.wantDNSKEYs)
+		}
+		if tags := signingKeyTags(t, s, rrset); len(tags) != 1 || (tags[0] == oldZSK) != step.wantOldSign {
+			t.Errorf("after %v: signed with %v, old ZSK %d signing = %v", step.after, tags, oldZSK, step.wantOldSign)
+		}
+	}
+}
+
+func TestKSKRollover(t *testing.T) {
+	ctx := context.Background()
+	s, zone, now := rolloverTestService(t, RolloverPolicy{})
+	start := *now
+
+	oldDS, err := s.DS(ctx, "example.lan.")
+	if err != nil {
+		t.Fatalf("DS() error = %v", err)
+	}
+
+	if err := s.StartRollover(ctx, zone, "ksk"); err != nil {
+		t.Fatalf("StartRollover() error = %v", err)
+	}
+	if err := s.StartRollover(ctx, zone, "ksk"); err == nil || !strings.Contains(err.Error(), "invalid") {
+		t.Errorf("second StartRollover() error = %v, want an invalid rollover error", err)
+	}
+
+	// Both KSKs sign the DNSKEY RRset from the start
+	dnskeys, _ := s.DNSKEYs(ctx, "example.lan.")
+	if tags := signingKeyTags(t, s, dnskeys); len(tags) != 2 {
+		t.Errorf("DNSKEY RRset signed by %v, want both KSKs", tags)
+	}
+
+	// The DS can't be published before the new DNSKEY RRset has propagated
+	if pending, _ := s.PendingDS(ctx, "example.lan."); len(pending) != 0 {
+		t.Errorf("PendingDS() = %v before propagation, want none", pending)
+	}
+	if err := s.ConfirmDS(ctx, "example.lan."); err == nil || !strings.Contains(err.Error(), "invalid") {
+		t.Errorf("early ConfirmDS() error = %v, want an invalid request error", err)
+	}
+
+	*now = start.Add(keyPropagation)
+	pending, err := s.PendingDS(ctx, "example.lan.")
+	if err != nil || len(pending) != 1 || pending[0].KeyTag == oldDS[0].KeyTag {
+		t.Fatalf("PendingDS() = %v, %v, want the DS of the new KSK", pending, err)
+	}
+	status, err := s.Status(ctx, zone)
+	if err != nil || !status.DSPending || status.DS[0].KeyTag != pending[0].KeyTag {
+		t.Errorf("Status() = %+v, %v, want the pending DS of the new KSK", status, err)
+	}
+
+	// Without confirmation the rollover waits for the parent
+	if _, err := s.Rollover(ctx, zone); err != nil {
+		t.Fatalf("Rollover() error = %v", err)
+	}
+	if states := keyStates(t, s, KeyTypeKSK); strings.Join(states, ",") != "active,published" {
+		t.Errorf("KSK states %v while waiting for the parent", states)
+	}
+
+	if err := s.ConfirmDS(ctx, "example.lan."); err != nil {
+		t.Fatalf("ConfirmDS() error = %v", err)
+	}
+	if states := keyStates(t, s, KeyTypeKSK); strings.Join(states, ",") != "retired,active" {
+		t.Errorf("KSK states %v after the DS update, want retired,active", states)
+	}
+	if tags := signingKeyTags(t, s, dnskeys); len(tags) != 2 {
+		t.Errorf("DNSKEY RRset signed by %v, want the retired KSK until the old DS expired", tags)
+	}
+
+	*now = start.Add(keyPropagation + parentDSTTL + rolloverSafety)
+	if _, err := s.Rollover(ctx, zone); err != nil {
+		t.Fatalf("Rollover() error = %v", err)
+	}
+	if states := keyStates(t, s, KeyTypeKSK); strings.Join(states, ",") != "removed,active" {
+		t.Errorf("KSK states %v after the old DS expired, want removed,active", states)
+	}
+	dnskeys, _ = s.DNSKEYs(ctx, "example.lan.")
+	if tags := signingKeyTags(t, s, dnskeys); len(dnskeys) != 2 || len(tags) != 1 || tags[0] != pending[0].KeyTag {
+		t.Errorf("DNSKEY RRset %v signed by %v, want only the new KSK", dnskeys, tags)
+	}
+}
+
+func TestRolloverSchedulerParentDS(t *testing.T) {
+	ctx := context.Background()
+	client := valkeytest.NewMemoryValkey()
+	zoneService := v1zoneservice.NewV1ZoneService(client, nil, nil)
+
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	s, err := NewV1DNSSECService(client, "test-encryption-key", RolloverPolicy{KSKLifetime: 365 * 24 * time.Hour})
+	if err != nil {
+		t.Fatalf("NewV1DNSSECService() error = %v", err)
+	}
+	s.now = func() time.Time { return now }
+
+	parent := &models.DNSZone{
+		Domain: "lan.",
+		Records: []models.DNSRecord{
+			models.NewNSRecord("example.lan.", "ns1.example.lan.", 3600),
+		},
+	}
+	child := &models.DNSZone{
+		Domain:  "example.lan.",
+		Records: []models.DNSRecord{models.NewARecord("web.example.lan.", "192.168.100.10", 300)},
+		DNSSEC:  &models.DNSSECSettings{Enabled: true},
+	}
+	for _, zone := range []*models.DNSZone{parent, child} {
+		if err := zoneService.CreateZone(ctx, zone); err != nil {
+			t.Fatalf("CreateZone() error = %v", err)
+		}
+	}
+	if err := s.EnsureKeys(ctx, child.Domain, child.DNSSEC); err != nil {
+		t.Fatalf("EnsureKeys() error = %v", err)
+	}
+
+	scheduler := NewRolloverScheduler(s, zoneService, nil, time.Minute)
+
+	// The KSK reaches its lifetime and the new one has propagated
+	now = now.Add(365 * 24 * time.Hour)
+	scheduler.Check(ctx)
+	now = now.Add(keyPropagation)
+	scheduler.Check(ctx)
+	pending, err := s.PendingDS(ctx, child.Domain)
+	if err != nil || len(pending) != 1 {
+		t.Fatalf("PendingDS() = %v, %v, want the DS of the new KSK", pending, err)
+	}
+
+	// Publishing the DS in the parent zone completes the rollover
+	_, dsValue, _ := strings.Cut(pending[0].DS, "\tDS\t")
+	parent.Records = append(parent.Records, models.DNSRecord{Name: "example.lan.", Type: "DS", Value: dsValue, TTL: 3600})
+	if err := zoneService.UpdateZone(ctx, parent.Domain, parent); err != nil {
+		t.Fatalf("UpdateZone() error = %v", err)
+	}
+	scheduler.Check(ctx)
+
+	if states := keyStates(t, s, KeyTypeKSK); strings.Join(states, ",") != "retired,active" {
+		t.Errorf("KSK states %v after the DS was published in the parent, want retired,active", states)
+	}
+}
@@ -0,0 +1,435 @@
+package v1dnssecservice
+
+import (
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/rogerwesterbo/godns/internal/models"
+	"github.com/rogerwesterbo/godns/pkg/interfaces/valkeyinterface"
+	"github.com/vitistack/common/pkg/loggers/vlog"
+)
+
+const (
+	dnssecKeysKeyPrefix = "dnssec:keys:"
+
+	// DNSKEYTTL is the TTL of the DNSKEY RRset and of the DS records exported for the parent
+	DNSKEYTTL = 3600
+
+	// Signatures are valid from an hour in the past, to allow for clock skew, for a week.
+	// Cached signatures are replaced once less than half of their validity is left.
+	signatureInception  = time.Hour
+	signatureValidity   = 7 * 24 * time.Hour
+	signatureRefreshAge = signatureValidity / 2
+
+	// keyCacheTTL is how long decrypted keys are used before they are read from Valkey again,
+	// so keys changed through another instance are picked up
+	keyCacheTTL = time.Minute
+
+	// maxCachedSignatures bounds the signature cache; it is emptied when full
+	maxCachedSignatures = 50000
+)
+
+// V1DNSSECService manages the signing keys of DNSSEC-enabled zones and signs RRsets with them
+// Private keys are stored in Valkey encrypted with a key derived from the configured
+// encryption key. Signatures are created on the fly and cached until they near expiry.
+type V1DNSSECService struct {
+	client valkeyinterface.ValkeyInterface
+	cipher *keyCipher
+	policy RolloverPolicy
+	now    func() time.Time
+
+	// rolloverMu serializes changes to the key states
+	rolloverMu sync.Mutex
+
+	mu         sync.Mutex
+	keys       map[string]*zoneKeys
+	signatures map[string]*dns.RRSIG
+}
+
+// signingKey is a decrypted key ready for signing
+type signingKey struct {
+	dnskey *dns.DNSKEY
+	signer crypto.Signer
+}
+
+// zoneKeys are the decrypted keys of a zone: the KSKs that sign the DNSKEY RRset
+// and the active ZSK, the most recently activated first
+type zoneKeys struct {
+	ksk      []signingKey
+	zsk      []signingKey
+	loadedAt time.Time
+}
+
+// NewV1DNSSECService creates a new DNSSEC service
+// encryptionKey protects the private keys stored in Valkey and must be the same on every instance.
+// policy holds the key lifetimes of zones that don't set their own.
+func NewV1DNSSECService(client valkeyinterface.ValkeyInterface, encryptionKey string, policy RolloverPolicy) (*V1DNSSECService, error) {
+	keyCipher, err := newKeyCipher(encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &V1DNSSECService{
+		client:     client,
+		cipher:     keyCipher,
+		policy:     policy,
+		now:        time.Now,
+		keys:       make(map[string]*zoneKeys),
+		signatures: make(map[string]*dns.RRSIG),
+	}, nil
+}
+
+// EnsureKeys makes sure a zone has a key signing key and a zone signing key for the algorithm
+// of its DNSSEC settings. Existing keys are kept; keys of another algorithm are left from before
+// the zone was turned insecure, which the zone service requires for an algorithm change, and
+// are replaced.
+func (s *V1DNSSECService) EnsureKeys(ctx context.Context, zone string, settings *models.DNSSECSettings) error {
+	zone = dns.CanonicalName(zone)
+	algorithm := settings.AlgorithmNumber()
+
+	s.rolloverMu.Lock()
+	defer s.rolloverMu.Unlock()
+
+	keys, err := s.getKeys(ctx, zone)
+	if err != nil {
+		return err
+	}
+
+	hasKSK, hasZSK := false, false
+	for i := range keys {
+		if keys[i].Algorithm != algorithm || keys[i].Removed() {
+			continue
+		}
+		hasKSK = hasKSK || keys[i].IsKSK()
+		hasZSK = hasZSK || !keys[i].IsKSK()
+	}
+	if hasKSK && hasZSK {
+		return nil
+	}
+
+	if len(keys) > 0 {
+		vlog.Infof("Replacing DNSSEC keys of zone %s for algorithm %s, the parent needs the new DS record", zone, settings.Algorithm)
+	}
+
+	ksk, err := s.generateKey(zone, models.DNSKEYFlagsKSK, algorithm, models.DNSSECKeyActive)
+	if err != nil {
+		return err
+	}
+	zsk, err := s.generateKey(zone, models.DNSKEYFlagsZSK, algorithm, models.DNSSECKeyActive)
+	if err != nil {
+		return err
+	}
+
+	if err := s.saveKeys(ctx, zone, []models.DNSSECKey{*ksk, *zsk}); err != nil {
+		return err
+	}
+
+	vlog.Infof("Generated DNSSEC keys for zone %s (%s, KSK %d, ZSK %d)", zone, settings.Algorithm, ksk.KeyTag, zsk.KeyTag)
+	return nil
+}
+
+// Keys returns the keys of a zone without their private keys
+func (s *V1DNSSECService) Keys(ctx context.Context, zone string) ([]models.DNSSECKey, error) {
+	keys, err := s.getKeys(ctx, dns.CanonicalName(zone))
+	if err != nil {
+		return nil, err
+	}
+	for i := range keys {
+		keys[i].PrivateKey = ""
+	}
+	return keys, nil
+}
+
+// DNSKEYs returns the DNSKEY RRset of a zone
+func (s *V1DNSSECService) DNSKEYs(ctx context.Context, zone string) ([]dns.RR, error) {
+	zone = dns.CanonicalName(zone)
+
+	keys, err := s.getKeys(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+
+	rrs := make([]dns.RR, 0, len(keys))
+	for i := range keys {
+		if !keys[i].Removed() {
+			rrs = append(rrs, keys[i].DNSKEY(zone, DNSKEYTTL))
+		}
+	}
+	return rrs, nil
+}
+
+// DS returns the DS records (SHA-256 digests) the parent zone should have: those of the
+// active key signing key, or of the new one once a KSK rollover waits for the parent
+func (s *V1DNSSECService) DS(ctx context.Context, zone string) ([]models.DelegationSigner, error) {
+	zone = dns.CanonicalName(zone)
+
+	keys, err := s.getKeys(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+
+	ksks, _ := parentKSKs(keys, s.now())
+	if len(ksks) == 0 {
+		return nil, fmt.Errorf("DNSSEC keys of zone %s not found", zone)
+	}
+	return delegationSigners(zone, ksks)
+}
+
+// delegationSigners returns the DS records of key signing keys
+func delegationSigners(zone string, ksks []models.DNSSECKey) ([]models.DelegationSigner, error) {
+	signers := make([]models.DelegationSigner, 0, len(ksks))
+	for i := range ksks {
+		dnskey := ksks[i].DNSKEY(zone, DNSKEYTTL)
+		ds := dnskey.ToDS(dns.SHA256)
+		if ds == nil {
+			return nil, fmt.Errorf("failed to compute DS for key %d of zone %s", ksks[i].KeyTag, zone)
+		}
+		signers = append(signers, models.DelegationSigner{
+			KeyTag:     ds.KeyTag,
+			Algorithm:  ds.Algorithm,
+			DigestType: ds.DigestType,
+			Digest:     ds.Digest,
+			DS:         ds.String(),
+			DNSKEY:     dnskey.String(),
+		})
+	}
+	return signers, nil
+}
+
+// SignRRset returns the RRSIGs for an RRset of a signed zone
+// The DNSKEY RRset is signed with every key signing key in it, so it validates with the old
+// and the new DS record during a KSK rollover; all other RRsets with the active zone signing key.
+// For an RRset synthesised from a wildcard, wildcard is the wildcard owner name: the signature
+// covers the wildcard RRset and is returned with the owner name of the answer (RFC 4035 section 5.3.4).
+func (s *V1DNSSECService) SignRRset(ctx context.Context, zone string, rrset []dns.RR, wildcard string) ([]*dns.RRSIG, error) {
+	if len(rrset) == 0 {
+		return nil, fmt.Errorf("empty RRset")
+	}
+	zone = dns.CanonicalName(zone)
+
+	keys, err := s.zoneKeys(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	var signers []signingKey
+	switch {
+	case rrset[0].Header().Rrtype == dns.TypeDNSKEY:
+		signers = keys.ksk
+	case len(keys.zsk) > 0:
+		signers = keys.zsk[:1]
+	}
+	if len(signers) == 0 {
+		return nil, fmt.Errorf("DNSSEC keys of zone %s not found", zone)
+	}
+
+	sigs := make([]*dns.RRSIG, 0, len(signers))
+	for _, key := range signers {
+		sig, err := s.sign(zone, key, rrset, wildcard)
+		if err != nil {
+			return nil, err
+		}
+		sigs = append(sigs, sig)
+	}
+	return sigs, nil
+}
+
+// sign returns the RRSIG of an RRset made with one key, from the cache while it is fresh
+func (s *V1DNSSECService) sign(zone string, key signingKey, rrset []dns.RR, wildcard string) (*dns.RRSIG, error) {
+	owner := rrset[0].Header().Name
+	signed := rrset
+	if wildcard != "" {
+		signed = make([]dns.RR, len(rrset))
+		for i, rr := range rrset {
+			signed[i] = dns.Copy(rr)
+			signed[i].Header().Name = dns.CanonicalName(wildcard)
+		}
+	}
+
+	cacheKey := signatureCacheKey(key.dnskey.KeyTag(), signed)
+	now := s.now()
+
+	s.mu.Lock()
+	cached, found := s.signatures[cacheKey]
+	s.mu.Unlock()
+	if found && time.Unix(int64(cached.Expiration), 0).Sub(now) > signatureRefreshAge {
+		return withOwner(cached, owner), nil
+	}
+
+	sig := &dns.RRSIG{
+		Hdr:        dns.RR_Header{Ttl: signed[0].Header().Ttl},
+		Algorithm:  key.dnskey.Algorithm,
+		SignerName: zone,
+		KeyTag:     key.dnskey.KeyTag(),
+		Inception:  uint32(now.Add(-signatureInception).Unix()), // #nosec G115 -- RRSIG times are 32-bit serial numbers (RFC 4034 section 3.1.5)
+		Expiration: uint32(now.Add(signatureValidity).Unix()),   // #nosec G115 -- RRSIG times are 32-bit serial numbers (RFC 4034 section 3.1.5)
+	}
+	if err := sig.Sign(key.signer, signed); err != nil {
+		return nil, fmt.Errorf("failed to sign %s %s: %w", owner, dns.TypeToString[signed[0].Header().Rrtype], err)
+	}
+
+	s.mu.Lock()
+	if len(s.signatures) >= maxCachedSignatures {
+		vlog.Debugf("DNSSEC signature cache full, clearing %d signatures", len(s.signatures))
+		s.signatures = make(map[string]*dns.RRSIG)
+	}
+	s.signatures[cacheKey] = sig
+	s.mu.Unlock()
+
+	return withOwner(sig, owner), nil
+}
+
+// withOwner returns a copy of a signature with the owner name of the signed answer
+func withOwner(sig *dns.RRSIG, owner string) *dns.RRSIG {
+	out := dns.Copy(sig).(*dns.RRSIG)
+	out.Hdr.Name = owner
+	return out
+}
+
+// signatureCacheKey identifies a signature by signing key and canonical RRset content
+func signatureCacheKey(keyTag uint16, rrset []dns.RR) string {
+	lines := make([]string, len(rrset))
+	for i, rr := range rrset {
+		lines[i] = strings.ToLower(rr.String())
+	}
+	sort.Strings(lines)
+
+	sum := sha256.Sum256([]byte(strings.Join(lines, "\n")))
+	return fmt.Sprintf("%d:%s", keyTag, hex.EncodeToString(sum[:]))
+}
+
+// generateKey creates a key pair in the given state and encrypts its private key for storage
+func (s *V1DNSSECService) generateKey(zone string, flags uint16, algorithm uint8, state string) (*models.DNSSECKey, error) {
+	dnskey := &dns.DNSKEY{
+		Hdr:       dns.RR_Header{Name: zone, Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: DNSKEYTTL},
+		Flags:     flags,
+		Protocol:  3,
+		Algorithm: algorithm,
+	}
+	// Both ECDSAP256SHA256 and ED25519 use 256 bit keys
+	privateKey, err := dnskey.Generate(256)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate DNSSEC key: %w", err)
+	}
+
+	encrypted, err := s.cipher.encrypt([]byte(dnskey.PrivateKeyString(privateKey)), zone)
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.now().UTC()
+	key := &models.DNSSECKey{
+		KeyTag:     dnskey.KeyTag(),
+		Flags:      flags,
+		Algorithm:  algorithm,
+		PublicKey:  dnskey.PublicKey,
+		PrivateKey: encrypted,
+		State:      state,
+		CreatedAt:  now,
+	}
+	if state == models.DNSSECKeyActive {
+		key.ActivatedAt = &now
+	}
+	return key, nil
+}
+
+// zoneKeys returns the decrypted keys of a zone, reading them from Valkey when the cached copy is stale
+func (s *V1DNSSECService) zoneKeys(ctx context.Context, zone string) (*zoneKeys, error) {
+	s.mu.Lock()
+	cached, found := s.keys[zone]
+	s.mu.Unlock()
+	if found && time.Since(cached.loadedAt) < keyCacheTTL {
+		return cached, nil
+	}
+
+	keys, err := s.getKeys(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("DNSSEC keys of zone %s not found", zone)
+	}
+
+	// Should several ZSKs be active, the one activated last signs
+	sort.SliceStable(keys, func(i, j int) bool {
+		return activatedAt(&keys[i]).After(activatedAt(&keys[j]))
+	})
+
+	loaded := &zoneKeys{loadedAt: time.Now()}
+	for i := range keys {
+		key := &keys[i]
+		if key.Removed() || (!key.IsKSK() && key.State != models.DNSSECKeyActive) {
+			continue
+		}
+		dnskey := key.DNSKEY(zone, DNSKEYTTL)
+
+		plain, err := s.cipher.decrypt(key.PrivateKey, zone)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt DNSSEC key %d of zone %s: %w", key.KeyTag, zone, err)
+		}
+		privateKey, err := dnskey.NewPrivateKey(string(plain))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse DNSSEC key %d of zone %s: %w", key.KeyTag, zone, err)
+		}
+		signer, ok := privateKey.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("DNSSEC key %d of zone %s can't sign", key.KeyTag, zone)
+		}
+
+		if key.IsKSK() {
+			loaded.ksk = append(loaded.ksk, signingKey{dnskey: dnskey, signer: signer})
+		} else {
+			loaded.zsk = append(loaded.zsk, signingKey{dnskey: dnskey, signer: signer})
+		}
+	}
+
+	s.mu.Lock()
+	s.keys[zone] = loaded
+	s.mu.Unlock()
+
+	return loaded, nil
+}
+
+// getKeys reads the stored keys of a zone; a zone without keys has none
+func (s *V1DNSSECService) getKeys(ctx context.Context, zone string) ([]models.DNSSECKey, error) {
+	data, err := s.client.GetData(ctx, dnssecKeysKeyPrefix+zone)
+	if err != nil {
+		if strings.Contains(err.Error(), "key not found") {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get DNSSEC keys: %w", err)
+	}
+
+	var keys []models.DNSSECKey
+	if err := json.Unmarshal([]byte(data), &keys); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal DNSSEC keys: %w", err)
+	}
+
+	return keys, nil
+}
+
+// saveKeys stores the keys of a zone and drops the cached copy
+func (s *V1DNSSECService) saveKeys(ctx context.Context, zone string, keys []models.DNSSECKey) error {
+	data, err := json.Marshal(keys)
+	if err != nil {
+		return fmt.Errorf("failed to marshal DNSSEC keys: %w", err)
+	}
+
+	if err := s.client.SetData(ctx, dnssecKeysKeyPrefix+zone, string(data)); err != nil {
+		return fmt.Errorf("failed to save DNSSEC keys: %w", err)
+	}
+
+	s.mu.Lock()
+	delete(s.keys, zone)
+	s.mu.Unlock()
+
+	return nil
+}
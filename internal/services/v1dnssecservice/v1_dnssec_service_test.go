@@ -0,0 +1,141 @@
+package v1dnssecservice
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/rogerwesterbo/godns/internal/models"
+	"github.com/rogerwesterbo/godns/internal/testutil/valkeytest"
+)
+
+func TestSignRRset(t *testing.T) {
+	ctx := context.Background()
+
+	for _, algorithm := range []string{models.DNSSECAlgorithmECDSAP256SHA256, models.DNSSECAlgorithmED25519} {
+		t.Run(algorithm, func(t *testing.T) {
+			client := valkeytest.NewMemoryValkey()
+			s, err := NewV1DNSSECService(client, "test-encryption-key", RolloverPolicy{})
+			if err != nil {
+				t.Fatalf("NewV1DNSSECService() error = %v", err)
+			}
+
+			settings := &models.DNSSECSettings{Enabled: true, Algorithm: algorithm}
+			if err := s.EnsureKeys(ctx, "example.lan.", settings); err != nil {
+				t.Fatalf("EnsureKeys() error = %v", err)
+			}
+			stored, _ := client.GetData(ctx, dnssecKeysKeyPrefix+"example.lan.")
+			if err := s.EnsureKeys(ctx, "example.lan.", settings); err != nil {
+				t.Fatalf("EnsureKeys() error = %v", err)
+			}
+			if again, _ := client.GetData(ctx, dnssecKeysKeyPrefix+"example.lan."); again != stored {
+				t.Error("EnsureKeys() replaced existing keys")
+			}
+			if strings.Contains(stored, "Private-key-format") {
+				t.Error("private key stored unencrypted")
+			}
+
+			keys, err := s.DNSKEYs(ctx, "example.lan.")
+			if err != nil || len(keys) != 2 {
+				t.Fatalf("DNSKEYs() = %v, %v, want a KSK and a ZSK", keys, err)
+			}
+			dnskeys := make(map[uint16]*dns.DNSKEY)
+			for _, rr := range keys {
+				key := rr.(*dns.DNSKEY)
+				dnskeys[key.KeyTag()] = key
+			}
+
+			verify := func(sigs []*dns.RRSIG, rrset []dns.RR, wantFlags uint16) {
+				t.Helper()
+				if len(sigs) != 1 {
+					t.Fatalf("got %d signatures, want 1", len(sigs))
+				}
+				sig := sigs[0]
+				key := dnskeys[sig.KeyTag]
+				if key == nil || key.Flags != wantFlags {
+					t.Fatalf("signed with key %d, want a key with flags %d", sig.KeyTag, wantFlags)
+				}
+				if err := sig.Verify(key, rrset); err != nil {
+					t.Errorf("Verify() error = %v", err)
+				}
+				if !sig.ValidityPeriod(time.Now()) {
+					t.Error("signature not valid now")
+				}
+			}
+
+			rrset := []dns.RR{mustRR(t, "web.example.lan. 300 IN A 192.168.100.10")}
+			sigs, err := s.SignRRset(ctx, "example.lan.", rrset, "")
+			if err != nil {
+				t.Fatalf("SignRRset() error = %v", err)
+			}
+			verify(sigs, rrset, models.DNSKEYFlagsZSK)
+
+			cached, err := s.SignRRset(ctx, "example.lan.", rrset, "")
+			if err != nil || cached[0].Signature != sigs[0].Signature {
+				t.Errorf("SignRRset() did not reuse the cached signature")
+			}
+
+			sigs, err = s.SignRRset(ctx, "example.lan.", keys, "")
+			if err != nil {
+				t.Fatalf("SignRRset() error = %v", err)
+			}
+			verify(sigs, keys, models.DNSKEYFlagsKSK)
+
+			// A synthesised answer validates against the wildcard it was expanded from
+			synthesised := []dns.RR{mustRR(t, "pr-42.apps.example.lan. 300 IN A 192.168.100.20")}
+			sigs, err = s.SignRRset(ctx, "example.lan.", synthesised, "*.apps.example.lan.")
+			if err != nil {
+				t.Fatalf("SignRRset() error = %v", err)
+			}
+			if sigs[0].Hdr.Name != "pr-42.apps.example.lan." || sigs[0].Labels != 3 {
+				t.Errorf("wildcard signature owner %s labels %d, want pr-42.apps.example.lan. with 3 labels", sigs[0].Hdr.Name, sigs[0].Labels)
+			}
+			verify(sigs, synthesised, models.DNSKEYFlagsZSK)
+
+			signers, err := s.DS(ctx, "example.lan.")
+			if err != nil || len(signers) != 1 {
+				t.Fatalf("DS() = %v, %v, want one DS", signers, err)
+			}
+			if ksk := dnskeys[signers[0].KeyTag]; ksk == nil || ksk.ToDS(dns.SHA256).Digest != signers[0].Digest {
+				t.Errorf("DS %s does not match the KSK", signers[0].DS)
+			}
+		})
+	}
+}
+
+func TestEncryptionKey(t *testing.T) {
+	ctx := context.Background()
+	client := valkeytest.NewMemoryValkey()
+
+	s, err := NewV1DNSSECService(client, "first-key", RolloverPolicy{})
+	if err != nil {
+		t.Fatalf("NewV1DNSSECService() error = %v", err)
+	}
+	if err := s.EnsureKeys(ctx, "example.lan.", &models.DNSSECSettings{Enabled: true}); err != nil {
+		t.Fatalf("EnsureKeys() error = %v", err)
+	}
+
+	other, err := NewV1DNSSECService(client, "second-key", RolloverPolicy{})
+	if err != nil {
+		t.Fatalf("NewV1DNSSECService() error = %v", err)
+	}
+	rrset := []dns.RR{mustRR(t, "web.example.lan. 300 IN A 192.168.100.10")}
+	if _, err := other.SignRRset(ctx, "example.lan.", rrset, ""); err == nil {
+		t.Error("SignRRset() with another encryption key succeeded")
+	}
+
+	if _, err := NewV1DNSSECService(client, "", RolloverPolicy{}); err == nil {
+		t.Error("NewV1DNSSECService() without encryption key succeeded")
+	}
+}
+
+func mustRR(t *testing.T, s string) dns.RR {
+	t.Helper()
+	rr, err := dns.NewRR(s)
+	if err != nil {
+		t.Fatalf("failed to parse %q: %v", s, err)
+	}
+	return rr
+}
@@ -0,0 +1,376 @@
+package v1dnsservice
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/miekg/dns"
+	"github.com/rogerwesterbo/godns/internal/models"
+)
+
+// SignedZone returns the data of the served, DNSSEC-enabled zone a name belongs to, as the
+// view in the context sees it. nil means the name is not in one of our zones or its zone is not signed.
+func (s *DNSService) SignedZone(ctx context.Context, name string) *models.DNSZone {
+	zone, _, err := s.ServingZone(ctx, name)
+	if err != nil || zone == nil || !zone.Signed() {
+		return nil
+	}
+
+	return zone
+}
+
+// SynthesisSource returns the wildcard owner name an answer for name was synthesised from,
+// or an empty string when name exists in the zone or no wildcard covers it
+func SynthesisSource(zone *models.DNSZone, name string) string {
+	if zoneHasName(zone, name) {
+		return ""
+	}
+	if source := wildcardSource(zone, name); source != "" {
+		return dns.CanonicalName(source)
+	}
+	return ""
+}
+
+// NSEC3PARAM returns the NSEC3PARAM record published at the apex of zones using NSEC3
+func NSEC3PARAM(zone *models.DNSZone) *dns.NSEC3PARAM {
+	return &dns.NSEC3PARAM{
+		Hdr:  dns.RR_Header{Name: dns.CanonicalName(zone.Domain), Rrtype: dns.TypeNSEC3PARAM, Class: dns.ClassINET, Ttl: 0},
+		Hash: dns.SHA1,
+	}
+}
+
+// DenialOfExistence returns the NSEC or NSEC3 records proving that name has no data of qtype
+// in a signed zone, together with the rcode to answer with. Black lies answer a name that does
+// not exist with NOERROR and a single NSEC record at the name itself.
+func (s *DNSService) DenialOfExistence(zone *models.DNSZone, name string, qtype uint16) ([]dns.RR, int, error) {
+	c, err := s.newDenialChain(zone)
+	if err != nil {
+		return nil, dns.RcodeServerFailure, err
+	}
+	name = dns.CanonicalName(name)
+
+	// The name exists, possibly as an empty non-terminal: NODATA
+	if _, exists := c.types[name]; exists {
+		return c.noData(name), dns.RcodeSuccess, nil
+	}
+
+	// A wildcard covers the name but has no data of qtype: wildcard NODATA
+	if source := SynthesisSource(zone, name); source != "" {
+		return c.wildcardNoData(name, source), dns.RcodeSuccess, nil
+	}
+
+	if c.mode == models.DNSSECDenialBlackLies {
+		return []dns.RR{c.lie(name, nil)}, dns.RcodeSuccess, nil
+	}
+	return c.nameError(name), dns.RcodeNameError, nil
+}
+
+// WildcardProof returns the records proving that no closer match exists for an answer synthesised
+// from a wildcard (RFC 4035 section 3.1.3.3). Black lies sign such answers as if the name existed.
+func (s *DNSService) WildcardProof(zone *models.DNSZone, name string) ([]dns.RR, error) {
+	c, err := s.newDenialChain(zone)
+	if err != nil {
+		return nil, err
+	}
+	name = dns.CanonicalName(name)
+
+	switch c.mode {
+	case models.DNSSECDenialNSEC:
+		return []dns.RR{c.coverNSEC(name)}, nil
+	case models.DNSSECDenialNSEC3:
+		encloser := strings.TrimPrefix(SynthesisSource(zone, name), "*.")
+		return []dns.RR{c.coverNSEC3(nextCloser(name, encloser))}, nil
+	default:
+		return nil, nil
+	}
+}
+
+// DelegationProof returns the DS RRset of a zone cut, or the records proving it has none,
+// for the authority section of a referral from a signed zone
+func (s *DNSService) DelegationProof(zone *models.DNSZone, cut string) ([]dns.RR, error) {
+	cut = dns.CanonicalName(cut)
+
+	var ds []dns.RR
+	for i := range zone.Records {
+		record := &zone.Records[i]
+		if record.Disabled || record.Type != "DS" || !strings.EqualFold(dns.Fqdn(record.Name), cut) {
+			continue
+		}
+		rr, err := s.convertToRR(record)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert DS record: %w", err)
+		}
+		ds = append(ds, rr)
+	}
+	if len(ds) > 0 {
+		return ds, nil
+	}
+
+	c, err := s.newDenialChain(zone)
+	if err != nil {
+		return nil, err
+	}
+	return c.noData(cut), nil
+}
+
+// denialChain holds the authoritative names of a signed zone with their types, in the order
+// the NSEC or NSEC3 chain links them
+type denialChain struct {
+	apex  string
+	mode  string
+	ttl   uint32
+	types map[string][]uint16 // Authoritative names, empty non-terminals have no types
+
+	names  []string          // NSEC: names owning data, in canonical order
+	hashes []string          // NSEC3: hashes of all names, sorted
+	hashed map[string]string // NSEC3: name by hash
+}
+
+// newDenialChain collects the names of a zone. Names below a zone cut are not authoritative and
+// left out; a cut itself only holds its NS and DS records.
+func (s *DNSService) newDenialChain(zone *models.DNSZone) (*denialChain, error) {
+	soa, err := s.zoneSOA(zone)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &denialChain{
+		apex:  dns.CanonicalName(zone.Domain),
+		mode:  zone.DNSSEC.Denial,
+		ttl:   soa.Hdr.Ttl, // The negative TTL, as for the SOA (RFC 9077)
+		types: make(map[string][]uint16),
+	}
+
+	apexTypes := []uint16{dns.TypeSOA, dns.TypeDNSKEY}
+	if c.mode == models.DNSSECDenialNSEC3 {
+		apexTypes = append(apexTypes, dns.TypeNSEC3PARAM)
+	}
+	c.add(c.apex, apexTypes...)
+
+	for i := range zone.Records {
+		record := &zone.Records[i]
+		if record.Disabled {
+			continue
+		}
+
+		owner := dns.CanonicalName(record.Name)
+		if !dns.IsSubDomain(c.apex, owner) {
+			continue
+		}
+		if cut := delegationPoint(zone, owner); cut != "" && (owner != cut || (record.Type != "NS" && record.Type != "DS")) {
+			continue
+		}
+
+		switch record.Type {
+		case "ALIAS":
+			c.add(owner, dns.TypeA, dns.TypeAAAA)
+		default:
+			if rrtype, ok := dns.StringToType[record.Type]; ok {
+				c.add(owner, rrtype)
+			}
+		}
+	}
+
+	// Every name owning data is signed: its RRSIGs and the NSEC record itself exist at the name.
+	// Only an insecure delegation has no signed data (RFC 4035 section 2.3).
+	for name, types := range c.types {
+		if len(types) == 0 {
+			continue
+		}
+		insecure := slices.Contains(types, dns.TypeNS) && !slices.Contains(types, dns.TypeDS) && name != c.apex
+		if c.mode == models.DNSSECDenialNSEC3 {
+			if !insecure {
+				c.types[name] = sortedTypes(append(types, dns.TypeRRSIG))
+			}
+			continue
+		}
+		c.types[name] = sortedTypes(append(types, dns.TypeRRSIG, dns.TypeNSEC))
+	}
+
+	switch c.mode {
+	case models.DNSSECDenialNSEC:
+		for name, types := range c.types {
+			if len(types) > 0 {
+				c.names = append(c.names, name)
+			}
+		}
+		sort.Slice(c.names, func(i, j int) bool { return canonicalLess(c.names[i], c.names[j]) })
+	case models.DNSSECDenialNSEC3:
+		c.hashed = make(map[string]string, len(c.types))
+		for name := range c.types {
+			hash := nsec3Hash(name)
+			c.hashed[hash] = name
+			c.hashes = append(c.hashes, hash)
+		}
+		sort.Strings(c.hashes)
+	}
+
+	return c, nil
+}
+
+// add records types at a name and creates the empty non-terminals between it and the apex
+func (c *denialChain) add(name string, types ...uint16) {
+	c.types[name] = append(c.types[name], types...)
+	for off, end := dns.NextLabel(name, 0); !end; off, end = dns.NextLabel(name, off) {
+		parent := name[off:]
+		if !dns.IsSubDomain(c.apex, parent) {
+			break
+		}
+		if _, ok := c.types[parent]; !ok {
+			c.types[parent] = nil
+		}
+	}
+}
+
+// noData proves that an existing name has no data of the queried type
+func (c *denialChain) noData(name string) []dns.RR {
+	switch c.mode {
+	case models.DNSSECDenialNSEC3:
+		return []dns.RR{c.matchNSEC3(name)}
+	case models.DNSSECDenialBlackLies:
+		return []dns.RR{c.lie(name, c.types[name])}
+	default:
+		if len(c.types[name]) == 0 {
+			// An empty non-terminal owns no NSEC, the record covering it proves it is empty
+			return []dns.RR{c.coverNSEC(name)}
+		}
+		return []dns.RR{c.matchNSEC(name)}
+	}
+}
+
+// wildcardNoData proves that name does not exist and the wildcard covering it has no data of the queried type
+func (c *denialChain) wildcardNoData(name, source string) []dns.RR {
+	switch c.mode {
+	case models.DNSSECDenialNSEC3:
+		encloser := strings.TrimPrefix(source, "*.")
+		return dedupe(c.matchNSEC3(encloser), c.coverNSEC3(nextCloser(name, encloser)), c.matchNSEC3(source))
+	case models.DNSSECDenialBlackLies:
+		return []dns.RR{c.lie(name, c.types[source])}
+	default:
+		return dedupe(c.coverNSEC(name), c.matchNSEC(source))
+	}
+}
+
+// nameError proves that neither name nor a wildcard covering it exists
+func (c *denialChain) nameError(name string) []dns.RR {
+	encloser := c.closestEncloser(name)
+	if c.mode == models.DNSSECDenialNSEC3 {
+		return dedupe(c.matchNSEC3(encloser), c.coverNSEC3(nextCloser(name, encloser)), c.coverNSEC3("*."+encloser))
+	}
+	return dedupe(c.coverNSEC(name), c.coverNSEC("*."+encloser))
+}
+
+// closestEncloser returns the longest existing ancestor of a name that does not exist
+func (c *denialChain) closestEncloser(name string) string {
+	for off, end := dns.NextLabel(name, 0); !end; off, end = dns.NextLabel(name, off) {
+		if _, ok := c.types[name[off:]]; ok {
+			return name[off:]
+		}
+	}
+	return c.apex
+}
+
+// lie returns a black lies NSEC record at name: the next name is the immediate successor
+// "\000.<name>", so the record covers nothing but the name itself
+func (c *denialChain) lie(name string, types []uint16) *dns.NSEC {
+	bitmap := []uint16{dns.TypeRRSIG, dns.TypeNSEC}
+	for _, t := range types {
+		if !slices.Contains(bitmap, t) {
+			bitmap = append(bitmap, t)
+		}
+	}
+	return c.nsec(name, "\\000."+name, sortedTypes(bitmap))
+}
+
+// matchNSEC returns the NSEC record owned by name
+func (c *denialChain) matchNSEC(name string) *dns.NSEC {
+	i, _ := slices.BinarySearchFunc(c.names, name, canonicalCompare)
+	return c.nsec(name, c.names[(i+1)%len(c.names)], c.types[name])
+}
+
+// coverNSEC returns the NSEC record whose span covers a name that owns no NSEC
+func (c *denialChain) coverNSEC(name string) *dns.NSEC {
+	i, _ := slices.BinarySearchFunc(c.names, name, canonicalCompare)
+	// The apex sorts first, so every name in the zone has a predecessor
+	prev := c.names[(i-1+len(c.names))%len(c.names)]
+	return c.nsec(prev, c.names[i%len(c.names)], c.types[prev])
+}
+
+func (c *denialChain) nsec(owner, next string, types []uint16) *dns.NSEC {
+	return &dns.NSEC{
+		Hdr:        dns.RR_Header{Name: owner, Rrtype: dns.TypeNSEC, Class: dns.ClassINET, Ttl: c.ttl},
+		NextDomain: next,
+		TypeBitMap: types,
+	}
+}
+
+// matchNSEC3 returns the NSEC3 record of an existing name
+func (c *denialChain) matchNSEC3(name string) *dns.NSEC3 {
+	hash := nsec3Hash(name)
+	i, _ := slices.BinarySearch(c.hashes, hash)
+	return c.nsec3(hash, c.hashes[(i+1)%len(c.hashes)], c.types[name])
+}
+
+// coverNSEC3 returns the NSEC3 record whose span covers the hash of a name that does not exist
+func (c *denialChain) coverNSEC3(name string) *dns.NSEC3 {
+	i, _ := slices.BinarySearch(c.hashes, nsec3Hash(name))
+	prev := c.hashes[(i-1+len(c.hashes))%len(c.hashes)]
+	return c.nsec3(prev, c.hashes[i%len(c.hashes)], c.types[c.hashed[prev]])
+}
+
+func (c *denialChain) nsec3(hash, next string, types []uint16) *dns.NSEC3 {
+	return &dns.NSEC3{
+		Hdr:        dns.RR_Header{Name: strings.ToLower(hash) + "." + c.apex, Rrtype: dns.TypeNSEC3, Class: dns.ClassINET, Ttl: c.ttl},
+		Hash:       dns.SHA1,
+		HashLength: 20,
+		NextDomain: next,
+		TypeBitMap: types,
+	}
+}
+
+// nsec3Hash hashes a name with SHA-1, no salt and no extra iterations as RFC 9276 recommends
+func nsec3Hash(name string) string {
+	return dns.HashName(name, dns.SHA1, 0, "")
+}
+
+// nextCloser returns the ancestor of name one label longer than its closest encloser
+func nextCloser(name, encloser string) string {
+	labels := dns.SplitDomainName(name)
+	return dns.Fqdn(strings.Join(labels[len(labels)-dns.CountLabel(encloser)-1:], "."))
+}
+
+// canonicalCompare orders names as in RFC 4034 section 6.1: label by label from the root,
+// a name sorting before its descendants
+func canonicalCompare(a, b string) int {
+	la, lb := dns.SplitDomainName(a), dns.SplitDomainName(b)
+	for i := 1; i <= len(la) && i <= len(lb); i++ {
+		if c := strings.Compare(strings.ToLower(la[len(la)-i]), strings.ToLower(lb[len(lb)-i])); c != 0 {
+			return c
+		}
+	}
+	return len(la) - len(lb)
+}
+
+func canonicalLess(a, b string) bool {
+	return canonicalCompare(a, b) < 0
+}
+
+// sortedTypes returns the types in ascending order without duplicates, as type bitmaps list them
+func sortedTypes(types []uint16) []uint16 {
+	slices.Sort(types)
+	return slices.Compact(types)
+}
+
+// dedupe drops repeated records, a single record can prove several facts
+func dedupe(rrs ...dns.RR) []dns.RR {
+	out := make([]dns.RR, 0, len(rrs))
+	for _, rr := range rrs {
+		if !slices.ContainsFunc(out, func(o dns.RR) bool { return dns.IsDuplicate(o, rr) }) {
+			out = append(out, rr)
+		}
+	}
+	return out
+}
@@ -0,0 +1,161 @@
+package v1dnsservice
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/rogerwesterbo/godns/internal/models"
+)
+
+func signedTestZone(denial string) *models.DNSZone {
+	return &models.DNSZone{
+		Domain: "example.lan.",
+		Records: []models.DNSRecord{
+			models.NewSOARecord("example.lan.", "ns1.example.lan.", "hostmaster.example.lan.", 2024110601, 3600, 1800, 604800, 60, 3600),
+			models.NewNSRecord("example.lan.", "ns1.example.lan.", 3600),
+			models.NewARecord("ns1.example.lan.", "192.168.100.1", 3600),
+			models.NewARecord("web.example.lan.", "192.168.100.10", 300),
+			models.NewARecord("host.lab.example.lan.", "192.168.100.11", 300),
+			models.NewARecord("*.apps.example.lan.", "192.168.100.20", 300),
+			models.NewNSRecord("sub.example.lan.", "ns.sub.example.lan.", 3600),
+			models.NewARecord("ns.sub.example.lan.", "192.168.100.30", 3600),
+			models.NewNSRecord("secure.example.lan.", "ns1.example.lan.", 3600),
+			{Name: "secure.example.lan.", Type: "DS", Value: "12345 13 2 " + strings.Repeat("ab", 32), TTL: 3600},
+		},
+		Enabled: true,
+		DNSSEC:  &models.DNSSECSettings{Enabled: true, Denial: denial},
+	}
+}
+
+// matchesName reports whether one of the records is the NSEC or NSEC3 record of name,
+// and returns its type bitmap
+func matchesName(rrs []dns.RR, name string) ([]uint16, bool) {
+	for _, rr := range rrs {
+		switch v := rr.(type) {
+		case *dns.NSEC:
+			if strings.EqualFold(v.Hdr.Name, name) {
+				return v.TypeBitMap, true
+			}
+		case *dns.NSEC3:
+			if v.Match(name) {
+				return v.TypeBitMap, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// coversName reports whether one of the records proves that name does not exist
+func coversName(rrs []dns.RR, name string) bool {
+	for _, rr := range rrs {
+		switch v := rr.(type) {
+		case *dns.NSEC:
+			after := canonicalCompare(v.Hdr.Name, name) < 0
+			before := canonicalCompare(name, v.NextDomain) < 0 || canonicalCompare(v.NextDomain, v.Hdr.Name) <= 0
+			if after && before {
+				return true
+			}
+		case *dns.NSEC3:
+			if v.Cover(name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func TestDenialOfExistence(t *testing.T) {
+	s := &DNSService{}
+
+	tests := []struct {
+		denial    string
+		name      string
+		qtype     uint16
+		wantRcode int
+		matches   []string
+		covers    []string
+	}{
+		{models.DNSSECDenialNSEC, "missing.example.lan.", dns.TypeA, dns.RcodeNameError, nil, []string{"missing.example.lan.", "*.example.lan."}},
+		{models.DNSSECDenialNSEC, "web.example.lan.", dns.TypeTXT, dns.RcodeSuccess, []string{"web.example.lan."}, nil},
+		{models.DNSSECDenialNSEC, "lab.example.lan.", dns.TypeA, dns.RcodeSuccess, nil, []string{"lab.example.lan."}},
+		{models.DNSSECDenialNSEC, "x.apps.example.lan.", dns.TypeTXT, dns.RcodeSuccess, []string{"*.apps.example.lan."}, []string{"x.apps.example.lan."}},
+		{models.DNSSECDenialNSEC, "sub.example.lan.", dns.TypeDS, dns.RcodeSuccess, []string{"sub.example.lan."}, nil},
+		{models.DNSSECDenialNSEC3, "missing.example.lan.", dns.TypeA, dns.RcodeNameError, []string{"example.lan."}, []string{"missing.example.lan.", "*.example.lan."}},
+		{models.DNSSECDenialNSEC3, "a.b.missing.example.lan.", dns.TypeA, dns.RcodeNameError, []string{"example.lan."}, []string{"missing.example.lan.", "*.example.lan."}},
+		{models.DNSSECDenialNSEC3, "web.example.lan.", dns.TypeTXT, dns.RcodeSuccess, []string{"web.example.lan."}, nil},
+		{models.DNSSECDenialNSEC3, "lab.example.lan.", dns.TypeA, dns.RcodeSuccess, []string{"lab.example.lan."}, nil},
+		{models.DNSSECDenialNSEC3, "x.apps.example.lan.", dns.TypeTXT, dns.RcodeSuccess, []string{"apps.example.lan.", "*.apps.example.lan."}, []string{"x.apps.example.lan."}},
+		{models.DNSSECDenialBlackLies, "missing.example.lan.", dns.TypeA, dns.RcodeSuccess, []string{"missing.example.lan."}, nil},
+		{models.DNSSECDenialBlackLies, "web.example.lan.", dns.TypeTXT, dns.RcodeSuccess, []string{"web.example.lan."}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.denial+" "+tt.name+" "+dns.TypeToString[tt.qtype], func(t *testing.T) {
+			zone := signedTestZone(tt.denial)
+			rrs, rcode, err := s.DenialOfExistence(zone, tt.name, tt.qtype)
+			if err != nil {
+				t.Fatalf("DenialOfExistence() error = %v", err)
+			}
+			if rcode != tt.wantRcode {
+				t.Errorf("rcode = %s, want %s", dns.RcodeToString[rcode], dns.RcodeToString[tt.wantRcode])
+			}
+
+			for _, name := range tt.matches {
+				types, ok := matchesName(rrs, name)
+				if !ok {
+					t.Errorf("no record matching %s in %v", name, rrs)
+					continue
+				}
+				if slices.Contains(types, tt.qtype) {
+					t.Errorf("bitmap of %s lists the denied type %s", name, dns.TypeToString[tt.qtype])
+				}
+			}
+			for _, name := range tt.covers {
+				if !coversName(rrs, name) {
+					t.Errorf("no record covering %s in %v", name, rrs)
+				}
+			}
+		})
+	}
+}
+
+func TestDelegationProof(t *testing.T) {
+	s := &DNSService{}
+
+	for _, denial := range []string{models.DNSSECDenialNSEC, models.DNSSECDenialNSEC3} {
+		zone := signedTestZone(denial)
+
+		rrs, err := s.DelegationProof(zone, "sub.example.lan.")
+		if err != nil {
+			t.Fatalf("DelegationProof() error = %v", err)
+		}
+		types, ok := matchesName(rrs, "sub.example.lan.")
+		if !ok || !slices.Contains(types, dns.TypeNS) || slices.Contains(types, dns.TypeDS) {
+			t.Errorf("%s: insecure delegation not proven, got %v", denial, rrs)
+		}
+
+		rrs, err = s.DelegationProof(zone, "secure.example.lan.")
+		if err != nil {
+			t.Fatalf("DelegationProof() error = %v", err)
+		}
+		if len(rrs) != 1 || rrs[0].Header().Rrtype != dns.TypeDS {
+			t.Errorf("%s: expected the DS record of the secure delegation, got %v", denial, rrs)
+		}
+	}
+}
+
+func TestWildcardProof(t *testing.T) {
+	s := &DNSService{}
+
+	for _, denial := range []string{models.DNSSECDenialNSEC, models.DNSSECDenialNSEC3} {
+		rrs, err := s.WildcardProof(signedTestZone(denial), "x.apps.example.lan.")
+		if err != nil {
+			t.Fatalf("WildcardProof() error = %v", err)
+		}
+		if !coversName(rrs, "x.apps.example.lan.") {
+			t.Errorf("%s: no record covering the synthesised name, got %v", denial, rrs)
+		}
+	}
+}
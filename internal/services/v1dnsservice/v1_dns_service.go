@@ -11,12 +11,14 @@ import (
 	"github.com/rogerwesterbo/godns/pkg/interfaces/valkeyinterface"
 )
 
-const (
-	// Valkey key prefix for DNS zones
-	zoneKeyPrefix = "zone:"
-	// Valkey key prefix for DNS records
-	recordKeyPrefix = "record:"
-)
+// Valkey key prefix for DNS zones
+const zoneKeyPrefix = "zone:"
+
+// Referral holds the delegation for a name below a zone cut
+type Referral struct {
+	NS   []dns.RR // NS records of the delegation point, for the authority section
+	Glue []dns.RR // In-zone A/AAAA records of the name servers, for the additional section
+}
 
 // DNSService handles DNS record management and storage
 type DNSService struct {
@@ -30,179 +32,317 @@ func NewDNSService(valkeyClient valkeyinterface.ValkeyInterface) *DNSService {
 	}
 }
 
-// GetRecord retrieves a DNS record from Valkey
-func (s *DNSService) GetRecord(ctx context.Context, name string, recordType string) (*models.DNSRecord, error) {
-	key := s.buildRecordKey(name, recordType)
+// GetZone retrieves all records for a zone
+func (s *DNSService) GetZone(ctx context.Context, domain string) (*models.DNSZone, error) {
+	key := zoneKeyPrefix + domain
 
 	data, err := s.valkeyClient.GetData(ctx, key)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get DNS record: %w", err)
+		return nil, fmt.Errorf("failed to get DNS zone: %w", err)
 	}
 
-	var record models.DNSRecord
-	if err := json.Unmarshal([]byte(data), &record); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal DNS record: %w", err)
+	var zone models.DNSZone
+	if err := json.Unmarshal([]byte(data), &zone); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal DNS zone: %w", err)
 	}
 
-	return &record, nil
+	return &zone, nil
 }
 
-// SetRecord stores a DNS record in Valkey
-func (s *DNSService) SetRecord(ctx context.Context, record *models.DNSRecord) error {
-	key := s.buildRecordKey(record.Name, record.Type)
+// LookupRecord performs a DNS lookup in the zone the name belongs to and returns DNS resource records
+// When the name has no records of the queried type but owns a CNAME, the CNAME is returned instead.
+func (s *DNSService) LookupRecord(zoneData *models.DNSZone, name string, qtype uint16) ([]dns.RR, error) {
+	recordType := dns.TypeToString[qtype]
+
+	owner := ownerName(zoneData, name)
+	if owner == "" {
+		return nil, nil
+	}
 
-	data, err := json.Marshal(record)
+	rrs, err := s.lookupRecordSet(zoneData, owner, recordType)
+	if err == nil && len(rrs) == 0 && qtype != dns.TypeCNAME {
+		// A name with a CNAME has no other data, the caller follows the alias
+		rrs, err = s.lookupRecordSet(zoneData, owner, "CNAME")
+	}
 	if err != nil {
-		return fmt.Errorf("failed to marshal DNS record: %w", err)
+		return nil, err
 	}
 
-	if err := s.valkeyClient.SetData(ctx, key, string(data)); err != nil {
-		return fmt.Errorf("failed to set DNS record: %w", err)
+	// Synthesised answers carry the queried owner name
+	if owner != name {
+		for _, rr := range rrs {
+			rr.Header().Name = name
+		}
 	}
 
-	return nil
+	return rrs, nil
 }
 
-// DeleteRecord removes a DNS record from Valkey
-func (s *DNSService) DeleteRecord(ctx context.Context, name string, recordType string) error {
-	key := s.buildRecordKey(name, recordType)
-
-	if err := s.valkeyClient.DeleteData(ctx, key); err != nil {
-		return fmt.Errorf("failed to delete DNS record: %w", err)
+// FindReferral returns the delegation covering a name when it lies at or below a zone cut,
+// i.e. an NS RRset at a name other than the zone apex. The topmost cut wins (RFC 1034 section 4.3.2).
+// A nil referral means the name is answered from our own authoritative data.
+func (s *DNSService) FindReferral(zoneData *models.DNSZone, name string) (*Referral, error) {
+	cut := delegationPoint(zoneData, name)
+	if cut == "" {
+		return nil, nil
 	}
 
-	return nil
-}
-
-// GetZone retrieves all records for a zone
-func (s *DNSService) GetZone(ctx context.Context, domain string) (*models.DNSZone, error) {
-	key := zoneKeyPrefix + domain
+	referral := &Referral{}
+	for i := range zoneData.Records {
+		record := &zoneData.Records[i]
+		if record.Disabled || record.Type != "NS" || !strings.EqualFold(dns.Fqdn(record.Name), cut) {
+			continue
+		}
 
-	data, err := s.valkeyClient.GetData(ctx, key)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get DNS zone: %w", err)
-	}
+		rr, err := s.convertToRR(record)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert NS record: %w", err)
+		}
+		referral.NS = append(referral.NS, rr)
 
-	var zone models.DNSZone
-	if err := json.Unmarshal([]byte(data), &zone); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal DNS zone: %w", err)
+		glue, err := s.glueRecords(zoneData, dns.Fqdn(record.Value))
+		if err != nil {
+			return nil, err
+		}
+		referral.Glue = append(referral.Glue, glue...)
 	}
 
-	return &zone, nil
+	return referral, nil
 }
 
-// SetZone stores a complete zone configuration
-func (s *DNSService) SetZone(ctx context.Context, zone *models.DNSZone) error {
-	key := zoneKeyPrefix + zone.Domain
-
-	data, err := json.Marshal(zone)
-	if err != nil {
-		return fmt.Errorf("failed to marshal DNS zone: %w", err)
-	}
-
-	if err := s.valkeyClient.SetData(ctx, key, string(data)); err != nil {
-		return fmt.Errorf("failed to set DNS zone: %w", err)
+// LookupAlias returns the ALIAS target of a name in the zone it belongs to
+// The boolean is false when the name holds no enabled ALIAS record.
+func (s *DNSService) LookupAlias(zoneData *models.DNSZone, name string) (string, bool, error) {
+	owner := ownerName(zoneData, name)
+	if owner == "" {
+		return "", false, nil
 	}
 
-	// Also store individual records for faster lookup
-	for _, record := range zone.Records {
-		if err := s.SetRecord(ctx, &record); err != nil {
-			return fmt.Errorf("failed to set record in zone: %w", err)
+	// ALIAS is not a wire type, so the RRset is read without converting it
+	records := models.FilterRecordSet(zoneData.Records, owner, "ALIAS")
+	for i := range records {
+		if !records[i].Disabled {
+			return dns.Fqdn(records[i].Value), true, nil
 		}
 	}
 
-	return nil
+	return "", false, nil
 }
 
-// LookupRecord performs a DNS lookup and returns DNS resource records
-func (s *DNSService) LookupRecord(ctx context.Context, name string, qtype uint16) ([]dns.RR, error) {
-	recordType := dns.TypeToString[qtype]
-
-	// First find which zone this record belongs to
-	zone, hasZone := s.HasZone(ctx, name)
-	if !hasZone {
-		return nil, fmt.Errorf("no zone found for %s", name)
-	}
+// lookupRecordSet converts the enabled records of the RRset for name and type to DNS RRs
+// The RRset is taken from the zone data, which holds the view of the query and is read
+// with one storage lookup per query; a missing RRset is not an error, the caller decides
+// between NXDOMAIN and NODATA.
+func (s *DNSService) lookupRecordSet(zone *models.DNSZone, name, recordType string) ([]dns.RR, error) {
+	records := models.FilterRecordSet(zone.Records, name, recordType)
+
+	// Convert every enabled record of the RRset to DNS RR format
+	rrs := make([]dns.RR, 0, len(records))
+	for i := range records {
+		if records[i].Disabled {
+			continue
+		}
 
-	// Check if the zone is enabled
-	zoneData, err := s.GetZone(ctx, zone)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get zone: %w", err)
-	}
-	if !zoneData.Enabled {
-		return nil, fmt.Errorf("zone %s is disabled", zone)
+		rr, err := s.convertToRR(&records[i])
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert record to RR: %w", err)
+		}
+		rrs = append(rrs, rr)
 	}
 
-	// Build the correct record key with zone
-	key := s.buildRecordKeyWithZone(zone, name, recordType)
+	return rrs, nil
+}
 
-	data, err := s.valkeyClient.GetData(ctx, key)
+// NegativeResponse determines the response code for a name in the zone it belongs to that has no
+// records of the queried type, and returns the zone SOA for the authority section.
+// The rcode is NXDOMAIN when the name does not exist at all and NOERROR (NODATA) otherwise.
+// The SOA TTL is lowered to the SOA minimum as described in RFC 2308.
+func (s *DNSService) NegativeResponse(zoneData *models.DNSZone, name string) (int, *dns.SOA, error) {
+	soa, err := s.zoneSOA(zoneData)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get DNS record: %w", err)
+		return dns.RcodeServerFailure, nil, err
 	}
 
-	var record models.DNSRecord
-	if err := json.Unmarshal([]byte(data), &record); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal DNS record: %w", err)
+	// A name covered by a wildcard exists too, it just has no records of the queried type
+	if zoneHasName(zoneData, name) || wildcardSource(zoneData, name) != "" {
+		return dns.RcodeSuccess, soa, nil
 	}
 
-	// Check if the record is disabled
-	if record.Disabled {
-		return nil, fmt.Errorf("record %s is disabled", name)
-	}
+	return dns.RcodeNameError, soa, nil
+}
 
-	// Convert the record to DNS RR format
-	rr, err := s.convertToRR(&record)
-	if err != nil {
-		return nil, fmt.Errorf("failed to convert record to RR: %w", err)
+// ServingZone returns the data of the zone a name belongs to, as the view in the context sees it
+// The zone is loaded once per query and passed to the lookups. The boolean is false when the name
+// is not in one of our zones; an error is returned when its zone is not served.
+func (s *DNSService) ServingZone(ctx context.Context, name string) (*models.DNSZone, bool, error) {
+	domain, zone := s.findZone(ctx, name)
+	if zone == nil {
+		return nil, false, nil
+	}
+	if !zone.Serving() {
+		return nil, true, fmt.Errorf("zone %s is disabled or not loaded", domain)
 	}
 
-	return []dns.RR{rr}, nil
+	return zone.InView(ViewFromContext(ctx)), true, nil
 }
 
-// HasZone checks if a domain is managed by this DNS server
-func (s *DNSService) HasZone(ctx context.Context, name string) (string, bool) {
-	// Try to find if the name belongs to any configured zone
-	// We'll check common zone patterns
+// findZone returns the closest zone a name belongs to and its domain, or a nil zone when the
+// name is not in one of our zones
+func (s *DNSService) findZone(ctx context.Context, name string) (string, *models.DNSZone) {
 	parts := strings.Split(strings.TrimSuffix(name, "."), ".")
 
 	// Try progressively larger domain parts
 	for i := 0; i < len(parts); i++ {
 		domain := strings.Join(parts[i:], ".") + "."
 
-		_, err := s.GetZone(ctx, domain)
+		zone, err := s.GetZone(ctx, domain)
 		if err == nil {
-			return domain, true
+			return domain, zone
 		}
 	}
 
-	return "", false
+	return "", nil
 }
 
-// buildRecordKey creates a Valkey key for a DNS record (legacy, for compatibility)
-func (s *DNSService) buildRecordKey(name string, recordType string) string {
-	return fmt.Sprintf("%s%s:%s", recordKeyPrefix, name, recordType)
+// zoneHasName reports whether a name exists in the zone. A name exists when it owns at least one
+// enabled record, or when it is an empty non-terminal (a record exists somewhere below it).
+func zoneHasName(zone *models.DNSZone, name string) bool {
+	name = dns.Fqdn(name)
+	if strings.EqualFold(name, dns.Fqdn(zone.Domain)) {
+		return true
+	}
+
+	for i := range zone.Records {
+		record := &zone.Records[i]
+		if record.Disabled {
+			continue
+		}
+		if dns.IsSubDomain(name, dns.Fqdn(record.Name)) {
+			return true
+		}
+	}
+
+	return false
 }
 
-// buildRecordKeyWithZone creates a Valkey key for a DNS record with zone prefix
-// This matches the format used by v1zoneservice: record:domain:name:type
-func (s *DNSService) buildRecordKeyWithZone(domain, name, recordType string) string {
-	return fmt.Sprintf("%s%s:%s:%s", recordKeyPrefix, domain, name, recordType)
+// delegationPoint returns the topmost zone cut at or above name, or an empty string when the
+// name is not delegated. A zone cut is any name below the apex that owns enabled NS records.
+func delegationPoint(zone *models.DNSZone, name string) string {
+	name = dns.Fqdn(name)
+	domain := dns.Fqdn(zone.Domain)
+
+	cut := ""
+	for i := range zone.Records {
+		record := &zone.Records[i]
+		if record.Disabled || record.Type != "NS" {
+			continue
+		}
+
+		owner := dns.Fqdn(record.Name)
+		if strings.EqualFold(owner, domain) || !dns.IsSubDomain(owner, name) {
+			continue
+		}
+		if cut == "" || dns.CountLabel(owner) < dns.CountLabel(cut) {
+			cut = owner
+		}
+	}
+
+	return strings.ToLower(cut)
 }
 
-// convertToRR converts a DNSRecord model to a dns.RR
-func (s *DNSService) convertToRR(record *models.DNSRecord) (dns.RR, error) {
-	// Use GetRData() to get the appropriate string representation for the record type
-	// This handles type-specific fields (MX, SRV, SOA, CAA) correctly
-	rdata := record.GetRData()
+// glueRecords returns the in-zone A and AAAA records for a name server
+func (s *DNSService) glueRecords(zone *models.DNSZone, nameServer string) ([]dns.RR, error) {
+	if !dns.IsSubDomain(dns.Fqdn(zone.Domain), nameServer) {
+		return nil, nil
+	}
+
+	glue := make([]dns.RR, 0)
+	for i := range zone.Records {
+		record := &zone.Records[i]
+		if record.Disabled || (record.Type != "A" && record.Type != "AAAA") {
+			continue
+		}
+		if !strings.EqualFold(dns.Fqdn(record.Name), nameServer) {
+			continue
+		}
+
+		rr, err := s.convertToRR(record)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert glue record: %w", err)
+		}
+		glue = append(glue, rr)
+	}
 
-	// Build the RR string format: "name TTL class type rdata"
-	rrString := fmt.Sprintf("%s %d IN %s %s", record.Name, record.TTL, record.Type, rdata)
+	return glue, nil
+}
+
+// ownerName returns the owner name holding the data for name: the name itself when it exists
+// in the zone, otherwise the wildcard covering it (RFC 4592). An empty string means neither exists.
+func ownerName(zone *models.DNSZone, name string) string {
+	if zoneHasName(zone, name) {
+		return name
+	}
+	return wildcardSource(zone, name)
+}
+
+// wildcardSource returns the wildcard owner name that answers for a name that does not exist in the zone.
+// Following RFC 4592 the closest encloser is the longest existing ancestor of the name, and only the
+// wildcard directly below it ("*.<closest encloser>") may be used. An empty string means no wildcard applies.
+func wildcardSource(zone *models.DNSZone, name string) string {
+	name = dns.Fqdn(name)
+	domain := dns.Fqdn(zone.Domain)
+	if !dns.IsSubDomain(domain, name) || dns.CountLabel(name) <= dns.CountLabel(domain) {
+		return ""
+	}
+
+	// An ancestor exists when a record is at or below it, so the closest encloser shares the
+	// most labels with a record name. It is a proper ancestor of the name, at least the apex.
+	labels := dns.CountLabel(domain)
+	for i := range zone.Records {
+		if !zone.Records[i].Disabled {
+			labels = max(labels, dns.CompareDomainName(name, dns.Fqdn(zone.Records[i].Name)))
+		}
+	}
+	labels = min(labels, dns.CountLabel(name)-1)
+
+	encloser := "."
+	if labels > 0 {
+		indexes := dns.Split(name)
+		encloser = name[indexes[len(indexes)-labels]:]
+	}
+	source := "*." + encloser
+	for i := range zone.Records {
+		if !zone.Records[i].Disabled && strings.EqualFold(dns.Fqdn(zone.Records[i].Name), source) {
+			return zone.Records[i].Name
+		}
+	}
+
+	return ""
+}
 
-	rr, err := dns.NewRR(rrString)
+// zoneSOA returns the SOA record of a zone for use in the authority section of negative answers.
+// A SOA is synthesised from defaults when the zone does not define one.
+func (s *DNSService) zoneSOA(zone *models.DNSZone) (*dns.SOA, error) {
+	record := zone.SOARecord()
+	rr, err := s.convertToRR(&record)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create RR from string: %w", err)
+		return nil, fmt.Errorf("failed to convert SOA record: %w", err)
+	}
+
+	soa, ok := rr.(*dns.SOA)
+	if !ok {
+		return nil, fmt.Errorf("invalid SOA record for zone %s", zone.Domain)
 	}
 
-	return rr, nil
+	// Negative answers are cached for the lower of the SOA TTL and the SOA minimum (RFC 2308)
+	if soa.Minttl < soa.Hdr.Ttl {
+		soa.Hdr.Ttl = soa.Minttl
+	}
+
+	return soa, nil
+}
+
+// convertToRR converts a DNSRecord model to a dns.RR
+func (s *DNSService) convertToRR(record *models.DNSRecord) (dns.RR, error) {
+	return record.ToRR()
 }
@@ -0,0 +1,119 @@
+package v1dnsservice
+
+import (
+	"testing"
+
+	"github.com/rogerwesterbo/godns/internal/models"
+)
+
+func TestZoneHasName(t *testing.T) {
+	disabled := models.NewARecord("old.example.lan.", "192.168.1.9", 300)
+	disabled.Disabled = true
+
+	zone := &models.DNSZone{
+		Domain: "example.lan.",
+		Records: []models.DNSRecord{
+			models.NewARecord("www.example.lan.", "192.168.1.1", 300),
+			models.NewARecord("host.lab.example.lan.", "192.168.1.2", 300),
+			disabled,
+		},
+		Enabled: true,
+	}
+
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"example.lan.", true},
+		{"www.example.lan.", true},
+		{"WWW.example.lan.", true},
+		{"lab.example.lan.", true}, // empty non-terminal
+		{"host.lab.example.lan.", true},
+		{"missing.example.lan.", false},
+		{"old.example.lan.", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := zoneHasName(zone, tt.name); got != tt.want {
+				t.Errorf("zoneHasName(%q) = %v, want %v", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestZoneSOA(t *testing.T) {
+	s := &DNSService{}
+
+	t.Run("zone SOA with negative TTL", func(t *testing.T) {
+		zone := &models.DNSZone{
+			Domain: "example.lan.",
+			Records: []models.DNSRecord{
+				models.NewSOARecord("example.lan.", "ns1.example.lan.", "hostmaster.example.lan.", 2024110601, 3600, 1800, 604800, 60, 3600),
+			},
+		}
+
+		soa, err := s.zoneSOA(zone)
+		if err != nil {
+			t.Fatalf("zoneSOA() error = %v", err)
+		}
+		if soa.Serial != 2024110601 {
+			t.Errorf("zoneSOA() serial = %d, want 2024110601", soa.Serial)
+		}
+		if soa.Hdr.Ttl != 60 {
+			t.Errorf("zoneSOA() TTL = %d, want SOA minimum 60", soa.Hdr.Ttl)
+		}
+	})
+
+	t.Run("synthesised SOA", func(t *testing.T) {
+		zone := &models.DNSZone{
+			Domain: "example.lan.",
+			Records: []models.DNSRecord{
+				models.NewNSRecord("example.lan.", "ns1.example.lan.", 3600),
+			},
+		}
+
+		soa, err := s.zoneSOA(zone)
+		if err != nil {
+			t.Fatalf("zoneSOA() error = %v", err)
+		}
+		if soa.Hdr.Name != "example.lan." || soa.Ns != "ns1.example.lan." {
+			t.Errorf("zoneSOA() = %s, want synthesised SOA for example.lan. with ns1.example.lan.", soa.String())
+		}
+		if soa.Hdr.Ttl != models.DefaultSOAMinimum {
+			t.Errorf("zoneSOA() TTL = %d, want %d", soa.Hdr.Ttl, models.DefaultSOAMinimum)
+		}
+	})
+}
+
+func TestWildcardSource(t *testing.T) {
+	zone := &models.DNSZone{
+		Domain: "example.lan.",
+		Records: []models.DNSRecord{
+			models.NewARecord("*.apps.example.lan.", "10.0.1.100", 300),
+			models.NewARecord("db.apps.example.lan.", "10.0.1.50", 300),
+			models.NewTXTRecord("x.apps.example.lan.", "owner=team-a", 300),
+		},
+		Enabled: true,
+	}
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"pr-42.apps.example.lan.", "*.apps.example.lan."},
+		{"PR-42.apps.example.lan.", "*.apps.example.lan."},
+		{"db.apps.example.lan.", "*.apps.example.lan."}, // callers check existence first
+		{"y.x.apps.example.lan.", ""},                   // closest encloser x.apps has no wildcard
+		{"a.b.apps.example.lan.", "*.apps.example.lan."},
+		{"www.example.lan.", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := wildcardSource(zone, tt.name); got != tt.want {
+				t.Errorf("wildcardSource(%q) = %q, want %q", tt.name, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,20 @@
+package v1dnsservice
+
+import "context"
+
+// viewKey is the context key of the split-horizon view of a query
+type viewKey struct{}
+
+// WithView returns a context for answering a query from clients in a split-horizon view
+func WithView(ctx context.Context, view string) context.Context {
+	if view == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, viewKey{}, view)
+}
+
+// ViewFromContext returns the split-horizon view of a query, or "" for the default view
+func ViewFromContext(ctx context.Context) string {
+	view, _ := ctx.Value(viewKey{}).(string)
+	return view
+}
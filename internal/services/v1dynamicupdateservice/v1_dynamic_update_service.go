@@ -0,0 +1,439 @@
+package v1dynamicupdateservice
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/miekg/dns"
+	"github.com/rogerwesterbo/godns/internal/models"
+	"github.com/rogerwesterbo/godns/internal/services/v1recordservice"
+	"github.com/rogerwesterbo/godns/internal/services/v1zoneservice"
+	"github.com/rogerwesterbo/godns/pkg/interfaces/valkeyinterface"
+	"github.com/vitistack/common/pkg/loggers/vlog"
+)
+
+// Valkey key prefix for dynamic update policies
+const updatePolicyKeyPrefix = "update:policy:"
+
+// UpdateError is a failed dynamic update with the response code for the client
+type UpdateError struct {
+	Rcode   int
+	Message string
+}
+
+func (e *UpdateError) Error() string {
+	return fmt.Sprintf("%s: %s", dns.RcodeToString[e.Rcode], e.Message)
+}
+
+// updateErrorf returns an UpdateError with a formatted message
+func updateErrorf(rcode int, format string, args ...any) *UpdateError {
+	return &UpdateError{Rcode: rcode, Message: fmt.Sprintf(format, args...)}
+}
+
+// V1DynamicUpdateService applies DNS UPDATE messages (RFC 2136) and manages update policies
+// Changes are saved through V1RecordService, like record changes made over the HTTP API.
+type V1DynamicUpdateService struct {
+	client        valkeyinterface.ValkeyInterface
+	zoneService   *v1zoneservice.V1ZoneService
+	recordService *v1recordservice.V1RecordService
+}
+
+// NewV1DynamicUpdateService creates a new dynamic update service
+func NewV1DynamicUpdateService(zoneService *v1zoneservice.V1ZoneService) *V1DynamicUpdateService {
+	return &V1DynamicUpdateService{
+		client:        zoneService.GetClient(),
+		zoneService:   zoneService,
+		recordService: v1recordservice.NewV1RecordService(zoneService),
+	}
+}
+
+// GetPolicy returns the update policy of a zone
+func (s *V1DynamicUpdateService) GetPolicy(ctx context.Context, domain string) (*models.ZoneUpdatePolicy, error) {
+	domain = dns.CanonicalName(domain)
+
+	data, err := s.client.GetData(ctx, updatePolicyKeyPrefix+domain)
+	if err != nil {
+		if strings.Contains(err.Error(), "key not found") {
+			return nil, fmt.Errorf("update policy for zone %s not found", domain)
+		}
+		return nil, fmt.Errorf("failed to get update policy: %w", err)
+	}
+
+	var policy models.ZoneUpdatePolicy
+	if err := json.Unmarshal([]byte(data), &policy); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal update policy: %w", err)
+	}
+
+	return &policy, nil
+}
+
+// SetPolicy validates and stores the update policy of a zone
+func (s *V1DynamicUpdateService) SetPolicy(ctx context.Context, domain string, policy *models.ZoneUpdatePolicy) error {
+	domain = dns.CanonicalName(domain)
+
+	zone, err := s.zoneService.GetZone(ctx, domain)
+	if err != nil {
+		return fmt.Errorf("zone not found: %w", err)
+	}
+	if zone.IsSecondary() {
+		return fmt.Errorf("invalid update policy: zone %s is a secondary zone and read-only", domain)
+	}
+
+	if err := policy.Validate(domain); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(policy)
+	if err != nil {
+		return fmt.Errorf("failed to marshal update policy: %w", err)
+	}
+
+	if err := s.client.SetData(ctx, updatePolicyKeyPrefix+domain, string(data)); err != nil {
+		return fmt.Errorf("failed to save update policy: %w", err)
+	}
+
+	return nil
+}
+
+// DeletePolicy removes the update policy of a zone, which disables dynamic updates for it
+func (s *V1DynamicUpdateService) DeletePolicy(ctx context.Context, domain string) error {
+	domain = dns.CanonicalName(domain)
+
+	if _, err := s.GetPolicy(ctx, domain); err != nil {
+		return err
+	}
+
+	if err := s.client.DeleteData(ctx, updatePolicyKeyPrefix+domain); err != nil {
+		return fmt.Errorf("failed to delete update policy: %w", err)
+	}
+
+	return nil
+}
+
+// Update applies a dynamic update to a zone and reports whether the zone changed
+// tsigKey is the name of the key that signed the update after successful
+// verification. Prerequisites are checked and all updates applied as one change;
+// when anything fails, the zone is left untouched. Errors are *UpdateError values
+// carrying the response code.
+func (s *V1DynamicUpdateService) Update(ctx context.Context, domain, tsigKey string, prereqs, updates []dns.RR) (bool, error) {
+	domain = dns.CanonicalName(domain)
+
+	zone, err := s.zoneService.GetZone(ctx, domain)
+	if err != nil {
+		return false, updateErrorf(dns.RcodeNotAuth, "zone %s not found", domain)
+	}
+	if zone.IsSecondary() {
+		return false, updateErrorf(dns.RcodeRefused, "zone %s is a secondary zone", domain)
+	}
+
+	policy, err := s.GetPolicy(ctx, domain)
+	if err != nil {
+		return false, updateErrorf(dns.RcodeRefused, "dynamic updates are not enabled for zone %s", domain)
+	}
+	if tsigKey == "" {
+		return false, updateErrorf(dns.RcodeRefused, "update of zone %s is not signed", domain)
+	}
+
+	if err := checkUpdates(domain, policy, tsigKey, updates); err != nil {
+		return false, err
+	}
+
+	changed, err := s.recordService.UpdateZoneRecords(ctx, domain, func(zone *models.DNSZone) error {
+		if err := checkPrerequisites(zone, prereqs); err != nil {
+			return err
+		}
+		for _, rr := range updates {
+			applyUpdate(zone, rr)
+		}
+		return nil
+	})
+	if err != nil {
+		var updateErr *UpdateError
+		if errors.As(err, &updateErr) {
+			return false, updateErr
+		}
+		if strings.Contains(err.Error(), "invalid") {
+			return false, updateErrorf(dns.RcodeRefused, "%v", err)
+		}
+		return false, updateErrorf(dns.RcodeServerFailure, "%v", err)
+	}
+
+	if changed {
+		vlog.Infof("Dynamic update of zone %s by key %s applied (%d changes)", domain, tsigKey, len(updates))
+	}
+	return changed, nil
+}
+
+// checkUpdates prescans the update section (RFC 2136 section 3.4.1) and checks the policy
+func checkUpdates(domain string, policy *models.ZoneUpdatePolicy, tsigKey string, updates []dns.RR) error {
+	for _, rr := range updates {
+		hdr := rr.Header()
+		name := dns.CanonicalName(hdr.Name)
+		recordType := dns.TypeToString[hdr.Rrtype]
+
+		if !dns.IsSubDomain(domain, name) {
+			return updateErrorf(dns.RcodeNotZone, "%s is outside zone %s", name, domain)
+		}
+
+		switch hdr.Class {
+		case dns.ClassINET:
+			if hdr.Rrtype == dns.TypeANY || hdr.Rrtype == dns.TypeAXFR || hdr.Rrtype == dns.TypeIXFR {
+				return updateErrorf(dns.RcodeFormatError, "cannot add %s records", recordType)
+			}
+			if _, ok := models.RecordFromRR(rr); !ok {
+				return updateErrorf(dns.RcodeRefused, "record type %s is not supported", recordType)
+			}
+		case dns.ClassANY:
+			if hdr.Ttl != 0 || hdr.Rdlength != 0 || hdr.Rrtype == dns.TypeAXFR || hdr.Rrtype == dns.TypeIXFR {
+				return updateErrorf(dns.RcodeFormatError, "invalid RRset deletion for %s", name)
+			}
+		case dns.ClassNONE:
+			if hdr.Ttl != 0 || hdr.Rrtype == dns.TypeANY || hdr.Rrtype == dns.TypeAXFR || hdr.Rrtype == dns.TypeIXFR {
+				return updateErrorf(dns.RcodeFormatError, "invalid record deletion for %s", name)
+			}
+		default:
+			return updateErrorf(dns.RcodeFormatError, "invalid class %s in update", dns.ClassToString[hdr.Class])
+		}
+
+		if !policy.Allows(tsigKey, name, recordType) {
+			return updateErrorf(dns.RcodeRefused, "key %s may not update %s %s", tsigKey, name, recordType)
+		}
+	}
+
+	return nil
+}
+
+// checkPrerequisites checks the prerequisite section (RFC 2136 section 3.2)
+// Disabled records are not served and do not satisfy prerequisites.
+func checkPrerequisites(zone *models.DNSZone, prereqs []dns.RR) error {
+	domain := dns.CanonicalName(zone.Domain)
+
+	// Value-dependent prerequisites, grouped by RRset
+	expected := make(map[string][]string)
+
+	for _, rr := range prereqs {
+		hdr := rr.Header()
+		name := dns.CanonicalName(hdr.Name)
+		recordType := dns.TypeToString[hdr.Rrtype]
+
+		if hdr.Ttl != 0 {
+			return updateErrorf(dns.RcodeFormatError, "prerequisite for %s has a non-zero TTL", name)
+		}
+		if !dns.IsSubDomain(domain, name) {
+			return updateErrorf(dns.RcodeNotZone, "prerequisite %s is outside zone %s", name, domain)
+		}
+
+		switch hdr.Class {
+		case dns.ClassANY:
+			if hdr.Rdlength != 0 {
+				return updateErrorf(dns.RcodeFormatError, "prerequisite for %s has data", name)
+			}
+			if hdr.Rrtype == dns.TypeANY {
+				if !nameInUse(zone, name) {
+					return updateErrorf(dns.RcodeNameError, "name %s is not in use", name)
+				}
+			} else if len(rrsetKeys(zone, name, recordType)) == 0 {
+				return updateErrorf(dns.RcodeNXRrset, "RRset %s %s does not exist", name, recordType)
+			}
+		case dns.ClassNONE:
+			if hdr.Rdlength != 0 {
+				return updateErrorf(dns.RcodeFormatError, "prerequisite for %s has data", name)
+			}
+			if hdr.Rrtype == dns.TypeANY {
+				if nameInUse(zone, name) {
+					return updateErrorf(dns.RcodeYXDomain, "name %s is in use", name)
+				}
+			} else if len(rrsetKeys(zone, name, recordType)) > 0 {
+				return updateErrorf(dns.RcodeYXRrset, "RRset %s %s exists", name, recordType)
+			}
+		case dns.ClassINET:
+			key := name + " " + recordType
+			expected[key] = append(expected[key], rrKey(rr))
+		default:
+			return updateErrorf(dns.RcodeFormatError, "invalid class %s in prerequisite", dns.ClassToString[hdr.Class])
+		}
+	}
+
+	for set, want := range expected {
+		name, recordType, _ := strings.Cut(set, " ")
+		if !sameKeys(rrsetKeys(zone, name, recordType), want) {
+			return updateErrorf(dns.RcodeNXRrset, "RRset %s %s does not match", name, recordType)
+		}
+	}
+
+	return nil
+}
+
+// applyUpdate applies one RR of the update section (RFC 2136 section 3.4.2)
+func applyUpdate(zone *models.DNSZone, rr dns.RR) {
+	hdr := rr.Header()
+	name := dns.CanonicalName(hdr.Name)
+	recordType := dns.TypeToString[hdr.Rrtype]
+	apex := strings.EqualFold(name, dns.CanonicalName(zone.Domain))
+
+	switch hdr.Class {
+	case dns.ClassINET:
+		addRecord(zone, rr, name, recordType, apex)
+
+	case dns.ClassANY:
+		// Delete an RRset, or all RRsets of a name; the apex SOA and NS records are kept
+		zone.Records = removeRecords(zone.Records, func(r *models.DNSRecord) bool {
+			if !sameName(r, name) || (hdr.Rrtype != dns.TypeANY && r.Type != recordType) {
+				return false
+			}
+			return !apex || (r.Type != "SOA" && r.Type != "NS")
+		})
+
+	case dns.ClassNONE:
+		// Delete a single record; the SOA and the last apex NS record cannot be deleted
+		if hdr.Rrtype == dns.TypeSOA {
+			return
+		}
+		key := rrKey(rr)
+		if apex && hdr.Rrtype == dns.TypeNS {
+			remaining := rrsetKeys(zone, name, "NS")
+			if len(remaining) == 1 && remaining[0] == key {
+				return
+			}
+		}
+		zone.Records = removeRecords(zone.Records, func(r *models.DNSRecord) bool {
+			return sameName(r, name) && r.Type == recordType && recordKey(r) == key
+		})
+	}
+}
+
+// addRecord adds a record to the zone following the RFC 2136 rules for CNAME and SOA records
+func addRecord(zone *models.DNSZone, rr dns.RR, name, recordType string, apex bool) {
+	record, ok := models.RecordFromRR(rr)
+	if !ok {
+		return
+	}
+	record.Name = name
+
+	for i := range zone.Records {
+		existing := &zone.Records[i]
+		if !sameName(existing, name) {
+			continue
+		}
+
+		switch {
+		case recordType == "CNAME" && existing.Type != "CNAME":
+			// A CNAME cannot be added to a name that holds other records
+			return
+		case recordType != "CNAME" && existing.Type == "CNAME":
+			// Other records cannot be added to a name that holds a CNAME
+			return
+		}
+	}
+
+	if recordType == "SOA" {
+		// The SOA is replaced only by one with a higher serial
+		if !apex {
+			return
+		}
+		current := zone.SOARecord()
+		if !models.SerialGreater(record.SOASerialValue(), current.SOASerialValue()) {
+			return
+		}
+	}
+
+	// Keep the spelling of an existing RRset so it is stored under the same key
+	for i := range zone.Records {
+		if sameName(&zone.Records[i], name) {
+			record.Name = zone.Records[i].Name
+			break
+		}
+	}
+
+	// A CNAME or SOA replaces the existing one, other records replace a duplicate
+	key := rrKey(rr)
+	zone.Records = removeRecords(zone.Records, func(r *models.DNSRecord) bool {
+		if !sameName(r, name) || r.Type != recordType {
+			return false
+		}
+		return recordType == "CNAME" || recordType == "SOA" || recordKey(r) == key
+	})
+	zone.Records = append(zone.Records, record)
+}
+
+// nameInUse reports whether the zone holds an enabled record at name
+func nameInUse(zone *models.DNSZone, name string) bool {
+	for i := range zone.Records {
+		if !zone.Records[i].Disabled && sameName(&zone.Records[i], name) {
+			return true
+		}
+	}
+	return false
+}
+
+// rrsetKeys returns the keys of the enabled records of an RRset
+func rrsetKeys(zone *models.DNSZone, name, recordType string) []string {
+	var keys []string
+	for i := range zone.Records {
+		record := &zone.Records[i]
+		if record.Disabled || record.Type != recordType || !sameName(record, name) {
+			continue
+		}
+		keys = append(keys, recordKey(record))
+	}
+	return keys
+}
+
+// removeRecords returns the records for which remove reports false
+func removeRecords(records []models.DNSRecord, remove func(r *models.DNSRecord) bool) []models.DNSRecord {
+	kept := make([]models.DNSRecord, 0, len(records))
+	for i := range records {
+		if !remove(&records[i]) {
+			kept = append(kept, records[i])
+		}
+	}
+	return kept
+}
+
+// sameName reports whether a record is owned by a canonical name
+func sameName(record *models.DNSRecord, name string) bool {
+	return strings.EqualFold(dns.Fqdn(record.Name), name)
+}
+
+// recordKey identifies a stored record by its wire representation
+// Records that have no wire format (ALIAS) are identified by type and value.
+func recordKey(record *models.DNSRecord) string {
+	rr, err := record.ToRR()
+	if err != nil {
+		return record.Type + " " + record.GetRData()
+	}
+	return rrKey(rr)
+}
+
+// rrKey identifies a resource record independent of its TTL and name case
+func rrKey(rr dns.RR) string {
+	c := dns.Copy(rr)
+	c.Header().Ttl = 0
+	c.Header().Class = dns.ClassINET
+	c.Header().Name = dns.CanonicalName(c.Header().Name)
+	return c.String()
+}
+
+// sameKeys reports whether two lists hold the same keys, ignoring order and duplicates
+func sameKeys(a, b []string) bool {
+	set := func(keys []string) map[string]bool {
+		m := make(map[string]bool, len(keys))
+		for _, key := range keys {
+			m[key] = true
+		}
+		return m
+	}
+	as, bs := set(a), set(b)
+	if len(as) != len(bs) {
+		return false
+	}
+	for key := range as {
+		if !bs[key] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,48 @@
+package v1exportservice
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rogerwesterbo/godns/internal/models"
+)
+
+// flattenAlias translates an ALIAS record for zone file formats that have no ALIAS type
+// The A and AAAA records of an in-zone target are copied to the alias owner name, the same
+// way GoDNS answers ALIAS queries. Targets outside the zone cannot be flattened offline.
+func flattenAlias(zone *models.DNSZone, alias *models.DNSRecord) []models.DNSRecord {
+	target := absoluteName(alias.Value)
+
+	flattened := make([]models.DNSRecord, 0)
+	for _, record := range zone.Records {
+		if record.Disabled || (record.Type != "A" && record.Type != "AAAA") {
+			continue
+		}
+		if !strings.EqualFold(absoluteName(record.Name), target) {
+			continue
+		}
+		record.Name = alias.Name
+		flattened = append(flattened, record)
+	}
+
+	return flattened
+}
+
+// formatFlattenedAlias renders an ALIAS record as a comment followed by its flattened records
+func formatFlattenedAlias(zone *models.DNSZone, alias *models.DNSRecord, format func(record *models.DNSRecord) string) string {
+	var sb strings.Builder
+
+	flattened := flattenAlias(zone, alias)
+	if len(flattened) == 0 {
+		sb.WriteString(fmt.Sprintf("; ALIAS %s -> %s: target is outside the zone, add A/AAAA records manually\n",
+			relativeName(zone.Domain, alias.Name), alias.Value))
+		return sb.String()
+	}
+
+	sb.WriteString(fmt.Sprintf("; ALIAS %s -> %s (flattened)\n", relativeName(zone.Domain, alias.Name), alias.Value))
+	for i := range flattened {
+		sb.WriteString(format(&flattened[i]))
+	}
+
+	return sb.String()
+}
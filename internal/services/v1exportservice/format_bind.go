@@ -50,11 +50,18 @@ func FormatBINDZone(zone *models.DNSZone) string {
 	}
 
 	// Output records by type
-	typeOrder := []string{"NS", "A", "AAAA", "CNAME", "MX", "TXT", "SRV", "PTR", "CAA"}
+	typeOrder := []string{"NS", "DS", "A", "AAAA", "ALIAS", "CNAME", "MX", "TXT", "SRV", "PTR", "CAA"}
 	for _, recordType := range typeOrder {
 		if records, exists := recordsByType[recordType]; exists {
 			sb.WriteString(fmt.Sprintf("; %s Records\n", recordType))
 			for _, record := range records {
+				if record.Type == "ALIAS" {
+					// BIND has no ALIAS type, write the flattened address records instead
+					sb.WriteString(formatFlattenedAlias(zone, &record, func(r *models.DNSRecord) string {
+						return formatBINDRecord(zone.Domain, r)
+					}))
+					continue
+				}
 				sb.WriteString(formatBINDRecord(zone.Domain, &record))
 			}
 			sb.WriteString("\n")
@@ -76,19 +83,11 @@ func FormatBINDZone(zone *models.DNSZone) string {
 
 // formatBINDRecord formats a single DNS record in BIND format
 func formatBINDRecord(zoneDomain string, record *models.DNSRecord) string {
-	name := record.Name
-
-	// Convert FQDN to relative name if within the zone
-	if name == zoneDomain {
-		name = "@"
-	} else if strings.HasSuffix(name, "."+zoneDomain) {
-		// Make it relative to the zone
-		name = strings.TrimSuffix(name, "."+zoneDomain)
-	}
+	name := relativeName(zoneDomain, record.Name)
 
 	// Handle SOA records specially for better formatting
 	if record.Type == "SOA" {
-		parts := strings.Fields(record.Value)
+		parts := strings.Fields(record.GetRData())
 		if len(parts) >= 7 {
 			return fmt.Sprintf("@\t%d\tIN\tSOA\t%s %s (\n"+
 				"\t\t\t\t%s          ; Serial\n"+
@@ -100,11 +99,29 @@ func formatBINDRecord(zoneDomain string, record *models.DNSRecord) string {
 		}
 	}
 
-	// Handle MX records with priority
-	if record.Type == "MX" {
-		return fmt.Sprintf("%s\t%d\tIN\t%s\t%s\n", name, record.TTL, record.Type, record.Value)
+	// Standard format for all other records (GetRData renders MX, SRV and CAA fields)
+	return fmt.Sprintf("%s\t%d\tIN\t%s\t%s\n", name, record.TTL, record.Type, record.GetRData())
+}
+
+// relativeName converts an owner name to a name relative to the zone origin ("@" for the apex)
+// Wildcard owners keep their asterisk label, e.g. *.apps.example.lan. becomes *.apps.
+func relativeName(zoneDomain, name string) string {
+	name = absoluteName(name)
+	zoneDomain = absoluteName(zoneDomain)
+
+	if strings.EqualFold(name, zoneDomain) {
+		return "@"
 	}
+	if suffix := "." + zoneDomain; len(name) > len(suffix) && strings.EqualFold(name[len(name)-len(suffix):], suffix) {
+		return name[:len(name)-len(suffix)]
+	}
+	return name
+}
 
-	// Standard format for all other records
-	return fmt.Sprintf("%s\t%d\tIN\t%s\t%s\n", name, record.TTL, record.Type, record.Value)
+// absoluteName returns the owner name as a fully qualified name
+func absoluteName(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+	return name + "."
 }
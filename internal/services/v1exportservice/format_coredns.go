@@ -29,7 +29,7 @@ func FormatCoreDNSZone(zone *models.DNSZone) string {
 	hasSOA := false
 	for _, record := range zone.Records {
 		if record.Type == "SOA" && !record.Disabled {
-			sb.WriteString(fmt.Sprintf("@\t%d\tIN\tSOA\t%s\n", record.TTL, record.Value))
+			sb.WriteString(fmt.Sprintf("@\t%d\tIN\tSOA\t%s\n", record.TTL, record.GetRData()))
 			hasSOA = true
 			break
 		}
@@ -47,16 +47,18 @@ func FormatCoreDNSZone(zone *models.DNSZone) string {
 			continue // Skip SOA (already handled) and disabled records
 		}
 
-		name := record.Name
-		if name == zone.Domain {
-			name = "@"
-		} else if strings.HasSuffix(name, "."+zone.Domain) {
-			// Make it relative to the zone
-			name = strings.TrimSuffix(name, "."+zone.Domain)
+		if record.Type == "ALIAS" {
+			// The CoreDNS file plugin has no ALIAS type, write the flattened address records instead
+			_, _ = sb.WriteString(formatFlattenedAlias(zone, &record, func(r *models.DNSRecord) string {
+				return fmt.Sprintf("%s\t%d\tIN\t%s\t%s\n", relativeName(zone.Domain, r.Name), r.TTL, r.Type, r.GetRData())
+			}))
+			continue
 		}
 
+		name := relativeName(zone.Domain, record.Name)
+
 		_, _ = sb.WriteString(fmt.Sprintf("%s\t%d\tIN\t%s\t%s\n",
-			name, record.TTL, record.Type, record.Value))
+			name, record.TTL, record.Type, record.GetRData()))
 	}
 
 	return sb.String()
@@ -44,36 +44,44 @@ func FormatPowerDNSZone(zone *models.DNSZone) string {
 	}
 
 	// Group records by name and type
+	// All records of an RRset share one TTL in PowerDNS, so the lowest TTL wins.
 	rrsetMap := make(map[string]*PowerDNSRRset)
+	order := make([]string, 0)
 
 	for _, record := range zone.Records {
-		key := record.Name + ":" + record.Type
+		// PowerDNS expects fully qualified owner names, wildcards included (*.apps.example.lan.)
+		name := absoluteName(record.Name)
+		key := name + ":" + record.Type
+		content := PowerDNSRecord{
+			Content:  record.GetRData(),
+			Disabled: record.Disabled,
+		}
+		if record.Type == "ALIAS" {
+			// PowerDNS supports ALIAS natively and needs a fully qualified target
+			content.Content = absoluteName(record.Value)
+		}
 
 		if rrset, exists := rrsetMap[key]; exists {
 			// Add to existing RRset
-			rrset.Records = append(rrset.Records, PowerDNSRecord{
-				Content:  record.Value,
-				Disabled: record.Disabled,
-			})
+			rrset.Records = append(rrset.Records, content)
+			if record.TTL < rrset.TTL {
+				rrset.TTL = record.TTL
+			}
 		} else {
 			// Create new RRset
 			rrsetMap[key] = &PowerDNSRRset{
-				Name: record.Name,
-				Type: record.Type,
-				TTL:  record.TTL,
-				Records: []PowerDNSRecord{
-					{
-						Content:  record.Value,
-						Disabled: record.Disabled,
-					},
-				},
+				Name:    name,
+				Type:    record.Type,
+				TTL:     record.TTL,
+				Records: []PowerDNSRecord{content},
 			}
+			order = append(order, key)
 		}
 	}
 
-	// Convert map to slice
-	for _, rrset := range rrsetMap {
-		pdnsZone.RRsets = append(pdnsZone.RRsets, *rrset)
+	// Convert map to slice, keeping the order records appear in the zone
+	for _, key := range order {
+		pdnsZone.RRsets = append(pdnsZone.RRsets, *rrsetMap[key])
 	}
 
 	// Add default SOA if not present
@@ -112,7 +120,14 @@ func FormatPowerDNSZone(zone *models.DNSZone) string {
 	sb.WriteString("# PowerDNS API Zone Configuration\n")
 	sb.WriteString(fmt.Sprintf("# Zone: %s\n", zone.Domain))
 	sb.WriteString("# Use this with: pdnsutil load-zone <zone-name> <file>\n")
-	sb.WriteString("# Or via API: POST /api/v1/servers/localhost/zones\n\n")
+	sb.WriteString("# Or via API: POST /api/v1/servers/localhost/zones\n")
+	for _, rrset := range pdnsZone.RRsets {
+		if rrset.Type == "ALIAS" {
+			sb.WriteString("# ALIAS records need the resolver and expand-alias settings in pdns.conf\n")
+			break
+		}
+	}
+	sb.WriteString("\n")
 	sb.WriteString(string(jsonData))
 
 	return sb.String()
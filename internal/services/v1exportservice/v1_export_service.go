@@ -31,7 +31,8 @@ func NewV1ExportService(zoneService *v1zoneservice.V1ZoneService) *V1ExportServi
 }
 
 // ExportZone exports a single zone in the specified format
-func (s *V1ExportService) ExportZone(ctx context.Context, domain string, format ExportFormat) (string, error) {
+// With a view the zone is exported as the clients of the view see it.
+func (s *V1ExportService) ExportZone(ctx context.Context, domain, view string, format ExportFormat) (string, error) {
 	zone, err := s.zoneService.GetZone(ctx, domain)
 	if err != nil {
 		return "", fmt.Errorf("failed to get zone: %w", err)
@@ -42,12 +43,12 @@ func (s *V1ExportService) ExportZone(ctx context.Context, domain string, format
 		return "", fmt.Errorf("zone %s is disabled and cannot be exported", domain)
 	}
 
-	return s.formatZone(zone, format)
+	return s.formatZone(zone.InView(view), format)
 }
 
 // ExportAllZones exports all zones in the specified format
-// Only exports zones that are enabled
-func (s *V1ExportService) ExportAllZones(ctx context.Context, format ExportFormat) (string, error) {
+// Only exports zones that are enabled, as the clients of view see them when view is set
+func (s *V1ExportService) ExportAllZones(ctx context.Context, view string, format ExportFormat) (string, error) {
 	zones, err := s.zoneService.ListZones(ctx)
 	if err != nil {
 		return "", fmt.Errorf("failed to list zones: %w", err)
@@ -61,7 +62,7 @@ func (s *V1ExportService) ExportAllZones(ctx context.Context, format ExportForma
 			continue
 		}
 
-		formatted, err := s.formatZone(&zone, format)
+		formatted, err := s.formatZone(zone.InView(view), format)
 		if err != nil {
 			return "", fmt.Errorf("failed to format zone %s: %w", zone.Domain, err)
 		}
@@ -152,3 +152,102 @@ func findSubstring(s, substr string) bool {
 	}
 	return false
 }
+
+func TestFormatPowerDNSZoneGroupsRRsets(t *testing.T) {
+	zone := &models.DNSZone{
+		Domain: "example.lan.",
+		Records: []models.DNSRecord{
+			models.NewMXRecord("example.lan.", 10, "mail1.example.lan.", 300),
+			models.NewMXRecord("example.lan.", 20, "mail2.example.lan.", 600),
+			models.NewTXTRecord("example.lan.", "v=spf1 mx -all", 300),
+			models.NewTXTRecord("example.lan.", "verification=abc123", 300),
+		},
+	}
+
+	result := FormatPowerDNSZone(zone)
+
+	if !contains(result, `"content": "10 mail1.example.lan."`) || !contains(result, `"content": "20 mail2.example.lan."`) {
+		t.Error("Expected both MX records rendered from structured fields")
+	}
+
+	if !contains(result, `"content": "\"verification=abc123\""`) {
+		t.Error("Expected quoted TXT content")
+	}
+}
+
+func TestFormatBINDZoneStructuredRecords(t *testing.T) {
+	zone := &models.DNSZone{
+		Domain: "example.lan.",
+		Records: []models.DNSRecord{
+			models.NewMXRecord("example.lan.", 10, "mail.example.lan.", 300),
+			models.NewSRVRecord("_http._tcp.example.lan.", 10, 60, 80, "web.example.lan.", 300),
+		},
+	}
+
+	result := FormatBINDZone(zone)
+
+	if !contains(result, "MX\t10 mail.example.lan.") {
+		t.Error("Expected MX record with priority and host")
+	}
+	if !contains(result, "SRV\t10 60 80 web.example.lan.") {
+		t.Error("Expected SRV record with all fields")
+	}
+}
+
+func TestFormatZonesWildcardRecords(t *testing.T) {
+	zone := &models.DNSZone{
+		Domain: "example.lan.",
+		Records: []models.DNSRecord{
+			models.NewARecord("*.apps.example.lan.", "10.0.1.100", 300),
+			models.NewARecord("*.example.lan.", "10.0.1.101", 300),
+		},
+	}
+
+	bind := FormatBINDZone(zone)
+	if !contains(bind, "*.apps\t300\tIN\tA\t10.0.1.100") || !contains(bind, "*\t300\tIN\tA\t10.0.1.101") {
+		t.Errorf("Expected relative wildcard names in BIND output, got:\n%s", bind)
+	}
+
+	coredns := FormatCoreDNSZone(zone)
+	if !contains(coredns, "*.apps\t300\tIN\tA\t10.0.1.100") {
+		t.Errorf("Expected relative wildcard name in CoreDNS output, got:\n%s", coredns)
+	}
+
+	pdns := FormatPowerDNSZone(zone)
+	if !contains(pdns, `"name": "*.apps.example.lan."`) {
+		t.Errorf("Expected fully qualified wildcard name in PowerDNS output, got:\n%s", pdns)
+	}
+}
+
+func TestFormatZonesALIASRecords(t *testing.T) {
+	zone := &models.DNSZone{
+		Domain: "example.lan.",
+		Records: []models.DNSRecord{
+			models.NewALIASRecord("example.lan.", "www.example.lan.", 300),
+			models.NewARecord("www.example.lan.", "192.168.100.10", 120),
+			models.NewAAAARecord("www.example.lan.", "fd00::10", 120),
+			models.NewALIASRecord("cdn.example.lan.", "edge.cdn.example.com.", 300),
+		},
+	}
+
+	bind := FormatBINDZone(zone)
+	if contains(bind, "IN\tALIAS") {
+		t.Error("BIND output must not contain ALIAS records")
+	}
+	if !contains(bind, "@\t120\tIN\tA\t192.168.100.10") || !contains(bind, "@\t120\tIN\tAAAA\tfd00::10") {
+		t.Errorf("Expected flattened apex records in BIND output, got:\n%s", bind)
+	}
+	if !contains(bind, "; ALIAS cdn -> edge.cdn.example.com.: target is outside the zone") {
+		t.Errorf("Expected note for out-of-zone ALIAS target in BIND output, got:\n%s", bind)
+	}
+
+	coredns := FormatCoreDNSZone(zone)
+	if contains(coredns, "IN\tALIAS") || !contains(coredns, "@\t120\tIN\tA\t192.168.100.10") {
+		t.Errorf("Expected flattened apex records in CoreDNS output, got:\n%s", coredns)
+	}
+
+	pdns := FormatPowerDNSZone(zone)
+	if !contains(pdns, `"type": "ALIAS"`) || !contains(pdns, `"content": "www.example.lan."`) {
+		t.Errorf("Expected native ALIAS RRset in PowerDNS output, got:\n%s", pdns)
+	}
+}
@@ -0,0 +1,52 @@
+package v1filterservice
+
+import (
+	"github.com/miekg/dns"
+)
+
+// googleSafeSearch is the host answering Google searches with SafeSearch enforced
+const googleSafeSearch = "forcesafesearch.google.com."
+
+// safeSearchHosts maps search engine hosts to the hosts that enforce their safe search
+var safeSearchHosts = map[string]string{
+	"bing.com.":                 "strict.bing.com.",
+	"www.bing.com.":             "strict.bing.com.",
+	"duckduckgo.com.":           "safe.duckduckgo.com.",
+	"www.duckduckgo.com.":       "safe.duckduckgo.com.",
+	"start.duckduckgo.com.":     "safe.duckduckgo.com.",
+	"www.youtube.com.":          "restrict.youtube.com.",
+	"m.youtube.com.":            "restrict.youtube.com.",
+	"youtubei.googleapis.com.":  "restrict.youtube.com.",
+	"youtube.googleapis.com.":   "restrict.youtube.com.",
+	"www.youtube-nocookie.com.": "restrict.youtube.com.",
+}
+
+// safeSearchTarget returns the safe search host a canonical name is rewritten to, or ""
+func safeSearchTarget(name string) string {
+	if target, ok := safeSearchHosts[name]; ok {
+		return target
+	}
+	if isGoogleSearch(name) {
+		return googleSafeSearch
+	}
+	return ""
+}
+
+// isGoogleSearch reports whether a name is a Google search domain: google.com, google.<cc>,
+// google.co.<cc> or google.com.<cc>, with or without www
+func isGoogleSearch(name string) bool {
+	labels := dns.SplitDomainName(name)
+	if len(labels) > 0 && labels[0] == "www" {
+		labels = labels[1:]
+	}
+	if len(labels) < 2 || labels[0] != "google" {
+		return false
+	}
+	switch len(labels) {
+	case 2:
+		return labels[1] == "com" || len(labels[1]) == 2
+	case 3:
+		return (labels[1] == "co" || labels[1] == "com") && len(labels[2]) == 2
+	}
+	return false
+}
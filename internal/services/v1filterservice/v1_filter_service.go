@@ -0,0 +1,574 @@
+package v1filterservice
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/rogerwesterbo/godns/internal/models"
+	"github.com/rogerwesterbo/godns/internal/services/v1policyservice"
+	"github.com/rogerwesterbo/godns/pkg/interfaces/valkeyinterface"
+	"github.com/vitistack/common/pkg/loggers/vlog"
+)
+
+const (
+	clientGroupsKey   = "dns:config:clientgroups"
+	filterProfilesKey = "dns:config:filterprofiles"
+
+	// filterReload is how often groups and profiles changed on other instances are picked up
+	filterReload = time.Minute
+
+	// safeSearchTTL is the TTL of the CNAME records of safe search rewrites
+	safeSearchTTL = 300
+)
+
+// groupPrefix is a client network of a group
+type groupPrefix struct {
+	prefix netip.Prefix
+	group  string
+}
+
+// profile is a filtering profile prepared for matching
+type profile struct {
+	models.FilterProfile
+	location *time.Location
+	blocked  map[string]bool
+	allowed  map[string]bool
+}
+
+// V1FilterService manages client groups and their filtering profiles, and selects the
+// filtering of DNS clients
+type V1FilterService struct {
+	valkeyClient valkeyinterface.ValkeyInterface
+	blocklists   []string // Names of the configured blocklists profiles can apply
+
+	mu       sync.RWMutex
+	groups   map[string]models.ClientGroup
+	clientID map[string]string // Client identifier to group
+	prefixes []groupPrefix     // sorted from the longest prefix to the shortest
+	profiles map[string]*profile
+
+	// configMu serializes changes to the stored groups and profiles, which are checked
+	// against each other: a group needs its profile and a profile in use can't be deleted
+	configMu sync.Mutex
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewV1FilterService creates a new filter service
+// blocklists are the names of the policies of DNS_FILTER_BLOCKLISTS profiles can apply.
+func NewV1FilterService(valkeyClient valkeyinterface.ValkeyInterface, blocklists []string) *V1FilterService {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &V1FilterService{
+		valkeyClient: valkeyClient,
+		blocklists:   blocklists,
+		ctx:          ctx,
+		cancel:       cancel,
+	}
+}
+
+// Start loads the groups and profiles and picks up changes made on other instances
+func (s *V1FilterService) Start() {
+	if _, _, err := s.load(s.ctx); err != nil {
+		vlog.Warnf("failed to load client groups: %v", err)
+	}
+
+	s.wg.Add(1)
+	go s.run()
+}
+
+// Stop stops reloading the groups and profiles
+func (s *V1FilterService) Stop() {
+	s.cancel()
+	s.wg.Wait()
+}
+
+func (s *V1FilterService) run() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(filterReload)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+			// A reload between reading and saving a change would apply the old groups and profiles
+			s.configMu.Lock()
+			if _, _, err := s.load(s.ctx); err != nil {
+				vlog.Warnf("failed to reload client groups: %v", err)
+			}
+			s.configMu.Unlock()
+		}
+	}
+}
+
+// Filter is the filtering of a client: its group, and the group's profile when it applies
+// at the time of the query
+type Filter struct {
+	Group   string
+	Profile string // Empty outside the schedules of the profile
+	profile *profile
+}
+
+// Select returns the filtering of a client at a time, or nil for clients in no group
+// A client identifier selects its group before the client's address.
+func (s *V1FilterService) Select(ip netip.Addr, clientID string, now time.Time) *Filter {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	group, ok := s.clientID[strings.ToLower(clientID)]
+	if !ok && ip.IsValid() {
+		// IPv4 clients on dual-stack sockets have IPv4-mapped addresses
+		ip = ip.Unmap()
+		for _, p := range s.prefixes {
+			if p.prefix.Contains(ip) {
+				group, ok = p.group, true
+				break
+			}
+		}
+	}
+	if !ok {
+		return nil
+	}
+
+	f := &Filter{Group: group}
+	p := s.profiles[s.groups[group].Profile]
+	if p != nil && p.active(now) {
+		f.Profile, f.profile = p.Name, p
+	}
+	return f
+}
+
+// active reports whether the profile applies at a time
+func (p *profile) active(now time.Time) bool {
+	if len(p.Schedules) == 0 {
+		return true
+	}
+	now = now.In(p.location)
+	return slices.ContainsFunc(p.Schedules, func(schedule models.FilterSchedule) bool {
+		return schedule.Covers(now)
+	})
+}
+
+// Blocklists returns the blocklists the profile applies to the client
+func (f *Filter) Blocklists() []string {
+	if f == nil || f.profile == nil {
+		return nil
+	}
+	return f.profile.Blocklists
+}
+
+// CheckQuery applies the profile to a query name: allowed domains are answered normally,
+// search engines are rewritten to their safe search hosts and blocked domains get NXDOMAIN
+func (f *Filter) CheckQuery(name string) *v1policyservice.Hit {
+	if f == nil || f.profile == nil {
+		return nil
+	}
+	name = dns.CanonicalName(name)
+
+	if domain := matchDomain(f.profile.allowed, name); domain != "" {
+		return f.hit(domain, models.PolicyActionPassthru, nil)
+	}
+	if f.profile.SafeSearch {
+		if target := safeSearchTarget(name); target != "" {
+			cname := &dns.CNAME{Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeCNAME, Class: dns.ClassINET, Ttl: safeSearchTTL}, Target: target}
+			return f.hit(name, models.PolicyActionRedirect, []dns.RR{cname})
+		}
+	}
+	if domain := matchDomain(f.profile.blocked, name); domain != "" {
+		return f.hit(domain, models.PolicyActionNXDomain, nil)
+	}
+	return nil
+}
+
+// CheckResponse applies the blocked domains of the profile to the CNAME targets of a response
+func (f *Filter) CheckResponse(resp *dns.Msg) *v1policyservice.Hit {
+	if f == nil || f.profile == nil || len(f.profile.blocked) == 0 {
+		return nil
+	}
+	for _, rr := range resp.Answer {
+		if cname, ok := rr.(*dns.CNAME); ok {
+			if domain := matchDomain(f.profile.blocked, dns.CanonicalName(cname.Target)); domain != "" {
+				return f.hit(domain, models.PolicyActionNXDomain, nil)
+			}
+		}
+	}
+	return nil
+}
+
+func (f *Filter) hit(rule, action string, records []dns.RR) *v1policyservice.Hit {
+	return v1policyservice.NewHit(models.PolicyHit{
+		Policy:  f.Profile,
+		Rule:    strings.TrimSuffix(rule, "."),
+		Trigger: models.PolicyTriggerQName,
+		Action:  action,
+	}, records)
+}
+
+// matchDomain returns the domain of a set that is a name or one of its parents, or ""
+func matchDomain(domains map[string]bool, name string) string {
+	for _, i := range dns.Split(name) {
+		if domains[name[i:]] {
+			return name[i:]
+		}
+	}
+	return ""
+}
+
+// ListClientGroups returns the client groups
+func (s *V1FilterService) ListClientGroups(ctx context.Context) ([]models.ClientGroup, error) {
+	groups, _, err := s.load(ctx)
+	return groups, err
+}
+
+// GetClientGroup returns a client group by name
+func (s *V1FilterService) GetClientGroup(ctx context.Context, name string) (*models.ClientGroup, error) {
+	name = strings.ToLower(name)
+	groups, _, err := s.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, g := range groups {
+		if g.Name == name {
+			return &g, nil
+		}
+	}
+	return nil, fmt.Errorf("client group %s not found", name)
+}
+
+// CreateClientGroup adds a client group
+func (s *V1FilterService) CreateClientGroup(ctx context.Context, g *models.ClientGroup) error {
+	if err := g.Validate(); err != nil {
+		return err
+	}
+
+	s.configMu.Lock()
+	defer s.configMu.Unlock()
+
+	groups, profiles, err := s.load(ctx)
+	if err != nil {
+		return err
+	}
+	if slices.ContainsFunc(groups, func(existing models.ClientGroup) bool { return existing.Name == g.Name }) {
+		return fmt.Errorf("client group %s already exists", g.Name)
+	}
+	if err := checkGroup(g, groups, profiles); err != nil {
+		return err
+	}
+
+	g.CreatedAt = time.Now().UTC()
+	g.UpdatedAt = g.CreatedAt
+	if err := s.saveGroups(ctx, append(groups, *g), profiles); err != nil {
+		return err
+	}
+
+	vlog.Infof("Added client group %s with profile %s", g.Name, g.Profile)
+	return nil
+}
+
+// UpdateClientGroup replaces the clients, profile and description of a client group
+func (s *V1FilterService) UpdateClientGroup(ctx context.Context, name string, g *models.ClientGroup) error {
+	g.Name = name
+	if err := g.Validate(); err != nil {
+		return err
+	}
+
+	s.configMu.Lock()
+	defer s.configMu.Unlock()
+
+	groups, profiles, err := s.load(ctx)
+	if err != nil {
+		return err
+	}
+	i := slices.IndexFunc(groups, func(existing models.ClientGroup) bool { return existing.Name == g.Name })
+	if i < 0 {
+		return fmt.Errorf("client group %s not found", g.Name)
+	}
+	if err := checkGroup(g, slices.Delete(slices.Clone(groups), i, i+1), profiles); err != nil {
+		return err
+	}
+
+	g.CreatedAt = groups[i].CreatedAt
+	g.UpdatedAt = time.Now().UTC()
+	groups[i] = *g
+	if err := s.saveGroups(ctx, groups, profiles); err != nil {
+		return err
+	}
+
+	vlog.Infof("Updated client group %s with profile %s", g.Name, g.Profile)
+	return nil
+}
+
+// DeleteClientGroup removes a client group; its clients are filtered like clients in no group
+func (s *V1FilterService) DeleteClientGroup(ctx context.Context, name string) error {
+	name = strings.ToLower(name)
+
+	s.configMu.Lock()
+	defer s.configMu.Unlock()
+
+	groups, profiles, err := s.load(ctx)
+	if err != nil {
+		return err
+	}
+	kept := slices.DeleteFunc(slices.Clone(groups), func(g models.ClientGroup) bool { return g.Name == name })
+	if len(kept) == len(groups) {
+		return fmt.Errorf("client group %s not found", name)
+	}
+	if err := s.saveGroups(ctx, kept, profiles); err != nil {
+		return err
+	}
+
+	vlog.Infof("Deleted client group %s", name)
+	return nil
+}
+
+// checkGroup checks the profile of a group and that its client identifiers are in no other group
+func checkGroup(g *models.ClientGroup, others []models.ClientGroup, profiles []models.FilterProfile) error {
+	if !slices.ContainsFunc(profiles, func(p models.FilterProfile) bool { return p.Name == g.Profile }) {
+		return fmt.Errorf("invalid client group %s: unknown profile %s", g.Name, g.Profile)
+	}
+	for _, other := range others {
+		for _, id := range g.ClientIDs {
+			if slices.Contains(other.ClientIDs, id) {
+				return fmt.Errorf("invalid client group %s: client id %s is in client group %s", g.Name, id, other.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// ListFilterProfiles returns the filtering profiles
+func (s *V1FilterService) ListFilterProfiles(ctx context.Context) ([]models.FilterProfile, error) {
+	_, profiles, err := s.load(ctx)
+	return profiles, err
+}
+
+// GetFilterProfile returns a filtering profile by name
+func (s *V1FilterService) GetFilterProfile(ctx context.Context, name string) (*models.FilterProfile, error) {
+	name = strings.ToLower(name)
+	_, profiles, err := s.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range profiles {
+		if p.Name == name {
+			return &p, nil
+		}
+	}
+	return nil, fmt.Errorf("profile %s not found", name)
+}
+
+// CreateFilterProfile adds a filtering profile
+func (s *V1FilterService) CreateFilterProfile(ctx context.Context, p *models.FilterProfile) error {
+	if err := s.validateProfile(p); err != nil {
+		return err
+	}
+
+	s.configMu.Lock()
+	defer s.configMu.Unlock()
+
+	groups, profiles, err := s.load(ctx)
+	if err != nil {
+		return err
+	}
+	if slices.ContainsFunc(profiles, func(existing models.FilterProfile) bool { return existing.Name == p.Name }) {
+		return fmt.Errorf("profile %s already exists", p.Name)
+	}
+
+	p.CreatedAt = time.Now().UTC()
+	p.UpdatedAt = p.CreatedAt
+	if err := s.saveProfiles(ctx, groups, append(profiles, *p)); err != nil {
+		return err
+	}
+
+	vlog.Infof("Added filtering profile %s", p.Name)
+	return nil
+}
+
+// UpdateFilterProfile replaces the filtering of a profile
+func (s *V1FilterService) UpdateFilterProfile(ctx context.Context, name string, p *models.FilterProfile) error {
+	p.Name = name
+	if err := s.validateProfile(p); err != nil {
+		return err
+	}
+
+	s.configMu.Lock()
+	defer s.configMu.Unlock()
+
+	groups, profiles, err := s.load(ctx)
+	if err != nil {
+		return err
+	}
+	i := slices.IndexFunc(profiles, func(existing models.FilterProfile) bool { return existing.Name == p.Name })
+	if i < 0 {
+		return fmt.Errorf("profile %s not found", p.Name)
+	}
+
+	p.CreatedAt = profiles[i].CreatedAt
+	p.UpdatedAt = time.Now().UTC()
+	profiles[i] = *p
+	if err := s.saveProfiles(ctx, groups, profiles); err != nil {
+		return err
+	}
+
+	vlog.Infof("Updated filtering profile %s", p.Name)
+	return nil
+}
+
+// DeleteFilterProfile removes a filtering profile that no client group uses
+func (s *V1FilterService) DeleteFilterProfile(ctx context.Context, name string) error {
+	name = strings.ToLower(name)
+
+	s.configMu.Lock()
+	defer s.configMu.Unlock()
+
+	groups, profiles, err := s.load(ctx)
+	if err != nil {
+		return err
+	}
+	kept := slices.DeleteFunc(slices.Clone(profiles), func(p models.FilterProfile) bool { return p.Name == name })
+	if len(kept) == len(profiles) {
+		return fmt.Errorf("profile %s not found", name)
+	}
+	for _, g := range groups {
+		if g.Profile == name {
+			return fmt.Errorf("profile %s is used by client group %s", name, g.Name)
+		}
+	}
+	if err := s.saveProfiles(ctx, groups, kept); err != nil {
+		return err
+	}
+
+	vlog.Infof("Deleted filtering profile %s", name)
+	return nil
+}
+
+// validateProfile validates a profile and checks that its blocklists are configured
+func (s *V1FilterService) validateProfile(p *models.FilterProfile) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	for _, name := range p.Blocklists {
+		if !slices.Contains(s.blocklists, name) {
+			return fmt.Errorf("invalid profile %s: unknown blocklist %s, blocklists are configured in DNS_FILTER_BLOCKLISTS", p.Name, name)
+		}
+	}
+	return nil
+}
+
+// load reads the groups and profiles from Valkey and applies them
+func (s *V1FilterService) load(ctx context.Context) ([]models.ClientGroup, []models.FilterProfile, error) {
+	var groups []models.ClientGroup
+	if err := s.get(ctx, clientGroupsKey, &groups); err != nil {
+		return nil, nil, fmt.Errorf("failed to get client groups: %w", err)
+	}
+	var profiles []models.FilterProfile
+	if err := s.get(ctx, filterProfilesKey, &profiles); err != nil {
+		return nil, nil, fmt.Errorf("failed to get filtering profiles: %w", err)
+	}
+
+	s.apply(groups, profiles)
+	return groups, profiles, nil
+}
+
+// get reads a JSON value from Valkey, leaving v unchanged when the key doesn't exist
+func (s *V1FilterService) get(ctx context.Context, key string, v any) error {
+	data, err := s.valkeyClient.GetData(ctx, key)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return nil
+		}
+		return err
+	}
+	return json.Unmarshal([]byte(data), v)
+}
+
+func (s *V1FilterService) saveGroups(ctx context.Context, groups []models.ClientGroup, profiles []models.FilterProfile) error {
+	data, err := json.Marshal(groups)
+	if err != nil {
+		return fmt.Errorf("failed to marshal client groups: %w", err)
+	}
+	if err := s.valkeyClient.SetData(ctx, clientGroupsKey, string(data)); err != nil {
+		return fmt.Errorf("failed to save client groups: %w", err)
+	}
+
+	s.apply(groups, profiles)
+	return nil
+}
+
+func (s *V1FilterService) saveProfiles(ctx context.Context, groups []models.ClientGroup, profiles []models.FilterProfile) error {
+	data, err := json.Marshal(profiles)
+	if err != nil {
+		return fmt.Errorf("failed to marshal filtering profiles: %w", err)
+	}
+	if err := s.valkeyClient.SetData(ctx, filterProfilesKey, string(data)); err != nil {
+		return fmt.Errorf("failed to save filtering profiles: %w", err)
+	}
+
+	s.apply(groups, profiles)
+	return nil
+}
+
+// apply replaces the groups and profiles used to select the filtering of clients
+func (s *V1FilterService) apply(groups []models.ClientGroup, profiles []models.FilterProfile) {
+	byName := make(map[string]models.ClientGroup, len(groups))
+	clientID := make(map[string]string)
+	var prefixes []groupPrefix
+	for _, g := range groups {
+		byName[g.Name] = g
+		for _, id := range g.ClientIDs {
+			clientID[id] = g.Name
+		}
+		for _, p := range g.Prefixes {
+			prefix, err := netip.ParsePrefix(p)
+			if err != nil {
+				vlog.Warnf("invalid prefix in client group %s: %s: %v", g.Name, p, err)
+				continue
+			}
+			prefixes = append(prefixes, groupPrefix{prefix: prefix, group: g.Name})
+		}
+	}
+	slices.SortStableFunc(prefixes, func(a, b groupPrefix) int {
+		return b.prefix.Bits() - a.prefix.Bits()
+	})
+
+	compiled := make(map[string]*profile, len(profiles))
+	for _, p := range profiles {
+		location, err := p.Location()
+		if err != nil {
+			vlog.Warnf("invalid timezone in profile %s, using the server's: %v", p.Name, err)
+			location = time.Local
+		}
+		compiled[p.Name] = &profile{
+			FilterProfile: p,
+			location:      location,
+			blocked:       domainSet(p.BlockedDomains),
+			allowed:       domainSet(p.AllowedDomains),
+		}
+	}
+
+	s.mu.Lock()
+	s.groups = byName
+	s.clientID = clientID
+	s.prefixes = prefixes
+	s.profiles = compiled
+	s.mu.Unlock()
+}
+
+func domainSet(domains []string) map[string]bool {
+	set := make(map[string]bool, len(domains))
+	for _, domain := range domains {
+		set[dns.CanonicalName(domain)] = true
+	}
+	return set
+}
@@ -0,0 +1,181 @@
+package v1filterservice
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/rogerwesterbo/godns/internal/models"
+	"github.com/rogerwesterbo/godns/internal/testutil/valkeytest"
+)
+
+func TestSelect(t *testing.T) {
+	ctx := context.Background()
+	s := NewV1FilterService(valkeytest.NewMemoryValkey(), []string{"social"})
+
+	if err := s.CreateClientGroup(ctx, &models.ClientGroup{Name: "branch", Prefixes: []string{"10.0.0.0/8"}, Profile: "kids"}); err == nil || !strings.Contains(err.Error(), "unknown profile") {
+		t.Errorf("CreateClientGroup() with an unknown profile error = %v, want unknown profile", err)
+	}
+	if err := s.CreateFilterProfile(ctx, &models.FilterProfile{Name: "kids", Blocklists: []string{"ads"}}); err == nil || !strings.Contains(err.Error(), "unknown blocklist") {
+		t.Errorf("CreateFilterProfile() with an unknown blocklist error = %v, want unknown blocklist", err)
+	}
+	for _, p := range []models.FilterProfile{
+		{Name: "kids", Blocklists: []string{"social"}},
+		{Name: "night", Schedules: []models.FilterSchedule{{Start: "22:00", End: "06:00"}}, Timezone: "UTC"},
+	} {
+		if err := s.CreateFilterProfile(ctx, &p); err != nil {
+			t.Fatalf("CreateFilterProfile(%s) error = %v", p.Name, err)
+		}
+	}
+	for _, g := range []models.ClientGroup{
+		{Name: "branch", Prefixes: []string{"10.0.0.0/8"}, ClientIDs: []string{"kiosk"}, Profile: "kids"},
+		{Name: "dorm", Prefixes: []string{"10.20.0.0/16"}, Profile: "night"},
+	} {
+		if err := s.CreateClientGroup(ctx, &g); err != nil {
+			t.Fatalf("CreateClientGroup(%s) error = %v", g.Name, err)
+		}
+	}
+	if err := s.CreateClientGroup(ctx, &models.ClientGroup{Name: "lobby", ClientIDs: []string{"kiosk"}, Profile: "kids"}); err == nil || !strings.Contains(err.Error(), "invalid") {
+		t.Errorf("CreateClientGroup() with a client id of another group error = %v, want invalid", err)
+	}
+
+	noon := time.Date(2025, 1, 13, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		ip          string
+		clientID    string
+		at          time.Time
+		wantGroup   string
+		wantProfile string
+	}{
+		{"10.1.2.3", "", noon, "branch", "kids"},
+		{"::ffff:10.1.2.3", "", noon, "branch", "kids"},
+		{"10.20.1.1", "", noon, "dorm", ""},
+		{"10.20.1.1", "", noon.Add(11 * time.Hour), "dorm", "night"},
+		{"10.20.1.1", "Kiosk", noon, "branch", "kids"},
+		{"192.168.1.10", "", noon, "", ""},
+	}
+	for _, tt := range tests {
+		var group, profile string
+		if f := s.Select(netip.MustParseAddr(tt.ip), tt.clientID, tt.at); f != nil {
+			group, profile = f.Group, f.Profile
+		}
+		if group != tt.wantGroup || profile != tt.wantProfile {
+			t.Errorf("Select(%s, %q, %s) = %q %q, want %q %q", tt.ip, tt.clientID, tt.at.Format(time.Kitchen), group, profile, tt.wantGroup, tt.wantProfile)
+		}
+	}
+
+	if err := s.DeleteFilterProfile(ctx, "kids"); err == nil || !strings.Contains(err.Error(), "is used by") {
+		t.Errorf("DeleteFilterProfile() of a profile in use error = %v, want is used by", err)
+	}
+	if err := s.DeleteClientGroup(ctx, "branch"); err != nil {
+		t.Fatalf("DeleteClientGroup() error = %v", err)
+	}
+	if err := s.DeleteFilterProfile(ctx, "kids"); err != nil {
+		t.Fatalf("DeleteFilterProfile() error = %v", err)
+	}
+	if f := s.Select(netip.MustParseAddr("10.1.2.3"), "kiosk", noon); f != nil {
+		t.Errorf("Select() after deleting the group = %+v, want nil", f)
+	}
+}
+
+func TestCheckQuery(t *testing.T) {
+	ctx := context.Background()
+	s := NewV1FilterService(valkeytest.NewMemoryValkey(), nil)
+	if err := s.CreateFilterProfile(ctx, &models.FilterProfile{
+		Name:           "kids",
+		BlockedDomains: []string{"games.example", "google.co.uk"},
+		AllowedDomains: []string{"chess.games.example"},
+		SafeSearch:     true,
+	}); err != nil {
+		t.Fatalf("CreateFilterProfile() error = %v", err)
+	}
+	if err := s.CreateClientGroup(ctx, &models.ClientGroup{Name: "branch", Prefixes: []string{"10.0.0.0/8"}, Profile: "kids"}); err != nil {
+		t.Fatalf("CreateClientGroup() error = %v", err)
+	}
+	f := s.Select(netip.MustParseAddr("10.1.2.3"), "", time.Now())
+
+	tests := []struct {
+		name       string
+		wantRule   string
+		wantAction string
+		wantTarget string
+	}{
+		{"www.games.example.", "games.example", models.PolicyActionNXDomain, ""},
+		{"chess.games.example.", "chess.games.example", models.PolicyActionPassthru, ""},
+		{"WWW.Google.com.", "www.google.com", models.PolicyActionRedirect, "forcesafesearch.google.com."},
+		{"google.co.uk.", "google.co.uk", models.PolicyActionRedirect, "forcesafesearch.google.com."},
+		{"www.youtube.com.", "www.youtube.com", models.PolicyActionRedirect, "restrict.youtube.com."},
+		{"google.example.com.", "", "", ""},
+		{"mail.google.com.", "", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var rule, action, target string
+			if hit := f.CheckQuery(tt.name); hit != nil {
+				rule, action = hit.Rule, hit.Action
+				m := new(dns.Msg)
+				hit.Answer(m, tt.name, dns.TypeA)
+				if len(m.Answer) > 0 {
+					target = m.Answer[0].(*dns.CNAME).Target
+				}
+			}
+			if rule != tt.wantRule || action != tt.wantAction || target != tt.wantTarget {
+				t.Errorf("CheckQuery() = %q %q %q, want %q %q %q", rule, action, target, tt.wantRule, tt.wantAction, tt.wantTarget)
+			}
+		})
+	}
+
+	if (*Filter)(nil).CheckQuery("www.games.example.") != nil {
+		t.Error("CheckQuery() of clients in no group should match nothing")
+	}
+}
+
+func TestClientGroupsConcurrent(t *testing.T) {
+	ctx := context.Background()
+	s := NewV1FilterService(valkeytest.NewSlowValkey(), []string{"social"})
+
+	const changes = 5
+	for i := range changes {
+		if err := s.CreateFilterProfile(ctx, &models.FilterProfile{Name: fmt.Sprintf("profile%d", i), Blocklists: []string{"social"}}); err != nil {
+			t.Fatalf("CreateFilterProfile(%d) error = %v", i, err)
+		}
+	}
+
+	// Each profile is deleted while a group is created with it, so one of both fails
+	var wg sync.WaitGroup
+	for i := range changes {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_ = s.CreateClientGroup(ctx, &models.ClientGroup{Name: fmt.Sprintf("group%d", i), ClientIDs: []string{fmt.Sprintf("client%d", i)}, Profile: fmt.Sprintf("profile%d", i)})
+		}()
+		go func() {
+			defer wg.Done()
+			_ = s.DeleteFilterProfile(ctx, fmt.Sprintf("profile%d", i))
+		}()
+	}
+	wg.Wait()
+
+	groups, err := s.ListClientGroups(ctx)
+	if err != nil {
+		t.Fatalf("ListClientGroups() error = %v", err)
+	}
+	profiles, err := s.ListFilterProfiles(ctx)
+	if err != nil {
+		t.Fatalf("ListFilterProfiles() error = %v", err)
+	}
+	// A group exists with its profile, or the profile was deleted before the group was created
+	for i := range changes {
+		group := slices.ContainsFunc(groups, func(g models.ClientGroup) bool { return g.Name == fmt.Sprintf("group%d", i) })
+		profile := slices.ContainsFunc(profiles, func(p models.FilterProfile) bool { return p.Name == fmt.Sprintf("profile%d", i) })
+		if group != profile {
+			t.Errorf("group%d exists = %v, but profile%d exists = %v", i, group, i, profile)
+		}
+	}
+}
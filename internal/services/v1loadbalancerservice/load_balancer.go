@@ -83,6 +83,50 @@ func (lb *LoadBalancer) AddBackend(ctx context.Context, record models.DNSRecord,
 	vlog.Debugf("Added backend: %s -> %s (weight: %d)", record.Name, record.Value, weight)
 }
 
+// SyncBackends makes the backend group for a name/type match the given RRset
+// New records are added as healthy backends, records no longer present are removed,
+// and existing backends keep their health state and weight.
+func (lb *LoadBalancer) SyncBackends(ctx context.Context, name, recordType string, records []models.DNSRecord) {
+	key := makeKey(name, recordType)
+
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	group, exists := lb.backends[key]
+	if !exists {
+		group = &BackendGroup{
+			Backends: make([]*Backend, 0, len(records)),
+			Strategy: lb.strategy,
+		}
+		lb.backends[key] = group
+	}
+
+	group.mu.Lock()
+	defer group.mu.Unlock()
+
+	current := make(map[string]*Backend, len(group.Backends))
+	for _, backend := range group.Backends {
+		current[backend.Record.GetRData()] = backend
+	}
+
+	backends := make([]*Backend, 0, len(records))
+	for _, record := range records {
+		if backend, ok := current[record.GetRData()]; ok {
+			backend.Record = record
+			backends = append(backends, backend)
+			continue
+		}
+		backends = append(backends, &Backend{
+			Record:  record,
+			Weight:  1,
+			Healthy: true,
+			Enabled: true,
+		})
+		vlog.Debugf("Added backend: %s -> %s", record.Name, record.GetRData())
+	}
+	group.Backends = backends
+}
+
 // GetBackend returns the next backend according to the load balancing strategy
 func (lb *LoadBalancer) GetBackend(ctx context.Context, name, recordType string) (*models.DNSRecord, bool) {
 	key := makeKey(name, recordType)
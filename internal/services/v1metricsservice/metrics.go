@@ -41,6 +41,16 @@ type MetricsService struct {
 	UpstreamErrors   prometheus.Counter
 	UpstreamDuration prometheus.Histogram
 
+	// Per upstream server metrics
+	UpstreamServerQueries  *prometheus.CounterVec
+	UpstreamServerDuration *prometheus.HistogramVec
+	UpstreamServerHealthy  *prometheus.GaugeVec
+
+	// DNSSEC metrics
+	DNSSECDSPending    *prometheus.GaugeVec
+	DNSSECKeyRollovers *prometheus.CounterVec
+	DNSSECValidations  *prometheus.CounterVec
+
 	registry *prometheus.Registry
 }
 
@@ -56,7 +66,7 @@ func NewMetricsService() *MetricsService {
 			Name: "godns_query_total",
 			Help: "Total number of DNS queries",
 		},
-		[]string{"type", "rcode"},
+		[]string{"type", "rcode", "transport"},
 	)
 
 	ms.QueryDuration = prometheus.NewHistogramVec(
@@ -65,7 +75,7 @@ func NewMetricsService() *MetricsService {
 			Help:    "DNS query duration in seconds",
 			Buckets: prometheus.DefBuckets,
 		},
-		[]string{"type"},
+		[]string{"type", "transport"},
 	)
 
 	ms.QueryErrors = prometheus.NewCounterVec(
@@ -199,6 +209,57 @@ func NewMetricsService() *MetricsService {
 		},
 	)
 
+	// Per upstream server metrics
+	ms.UpstreamServerQueries = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "godns_upstream_server_queries_total",
+			Help: "Total number of queries and probes sent to each upstream server, by result (success, failure)",
+		},
+		[]string{"upstream", "result"},
+	)
+
+	ms.UpstreamServerDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "godns_upstream_server_duration_seconds",
+			Help:    "Round-trip time of queries to each upstream server in seconds",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"upstream"},
+	)
+
+	ms.UpstreamServerHealthy = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "godns_upstream_server_healthy",
+			Help: "Whether an upstream server is used (1) or skipped after repeated failures (0)",
+		},
+		[]string{"upstream"},
+	)
+
+	// DNSSEC metrics
+	ms.DNSSECDSPending = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "godns_dnssec_ds_pending",
+			Help: "Zones whose KSK rollover waits for the new DS record at the parent (1 while pending)",
+		},
+		[]string{"zone"},
+	)
+
+	ms.DNSSECKeyRollovers = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "godns_dnssec_key_rollovers_total",
+			Help: "Total number of DNSSEC key rollovers started",
+		},
+		[]string{"zone", "key_type"},
+	)
+
+	ms.DNSSECValidations = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "godns_dnssec_validations_total",
+			Help: "Total number of upstream responses validated, by result (secure, insecure, bogus)",
+		},
+		[]string{"result"},
+	)
+
 	// Register all metrics
 	ms.registerMetrics()
 
@@ -237,6 +298,14 @@ func (ms *MetricsService) registerMetrics() {
 	ms.registry.MustRegister(ms.UpstreamQueries)
 	ms.registry.MustRegister(ms.UpstreamErrors)
 	ms.registry.MustRegister(ms.UpstreamDuration)
+	ms.registry.MustRegister(ms.UpstreamServerQueries)
+	ms.registry.MustRegister(ms.UpstreamServerDuration)
+	ms.registry.MustRegister(ms.UpstreamServerHealthy)
+
+	// DNSSEC metrics
+	ms.registry.MustRegister(ms.DNSSECDSPending)
+	ms.registry.MustRegister(ms.DNSSECKeyRollovers)
+	ms.registry.MustRegister(ms.DNSSECValidations)
 
 	vlog.Info("Metrics registered successfully")
 }
@@ -248,10 +317,10 @@ func (ms *MetricsService) Handler() http.Handler {
 	})
 }
 
-// RecordQuery records a DNS query
-func (ms *MetricsService) RecordQuery(queryType string, rcode string, duration float64) {
-	ms.QueryTotal.WithLabelValues(queryType, rcode).Inc()
-	ms.QueryDuration.WithLabelValues(queryType).Observe(duration)
+// RecordQuery records a DNS query and the transport it arrived over
+func (ms *MetricsService) RecordQuery(queryType string, rcode string, transport string, duration float64) {
+	ms.QueryTotal.WithLabelValues(queryType, rcode, transport).Inc()
+	ms.QueryDuration.WithLabelValues(queryType, transport).Observe(duration)
 }
 
 // RecordQueryError records a DNS query error
@@ -330,3 +399,36 @@ func (ms *MetricsService) RecordUpstreamQuery(duration float64) {
 func (ms *MetricsService) RecordUpstreamError() {
 	ms.UpstreamErrors.Inc()
 }
+
+// RecordUpstreamServerQuery records a query or probe sent to an upstream server
+func (ms *MetricsService) RecordUpstreamServerQuery(upstream string, result string, duration float64) {
+	ms.UpstreamServerQueries.WithLabelValues(upstream, result).Inc()
+	ms.UpstreamServerDuration.WithLabelValues(upstream).Observe(duration)
+}
+
+// UpdateUpstreamServerHealth sets whether an upstream server is used
+func (ms *MetricsService) UpdateUpstreamServerHealth(upstream string, healthy bool) {
+	value := 0.0
+	if healthy {
+		value = 1
+	}
+	ms.UpstreamServerHealthy.WithLabelValues(upstream).Set(value)
+}
+
+// UpdateDNSSECDSPending sets the zones that wait for a DS update at their parent
+func (ms *MetricsService) UpdateDNSSECDSPending(zones []string) {
+	ms.DNSSECDSPending.Reset()
+	for _, zone := range zones {
+		ms.DNSSECDSPending.WithLabelValues(zone).Set(1)
+	}
+}
+
+// RecordDNSSECKeyRollover records a started key rollover
+func (ms *MetricsService) RecordDNSSECKeyRollover(zone string, keyType string) {
+	ms.DNSSECKeyRollovers.WithLabelValues(zone, keyType).Inc()
+}
+
+// RecordDNSSECValidation records the validation result of an upstream response
+func (ms *MetricsService) RecordDNSSECValidation(result string) {
+	ms.DNSSECValidations.WithLabelValues(result).Inc()
+}
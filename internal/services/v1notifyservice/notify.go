@@ -0,0 +1,234 @@
+package v1notifyservice
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/rogerwesterbo/godns/internal/models"
+	"github.com/vitistack/common/pkg/loggers/vlog"
+)
+
+// TargetStatus is the outcome of the latest NOTIFY for a zone and secondary
+type TargetStatus struct {
+	Zone        string
+	Target      string
+	Serial      uint32
+	Attempts    int
+	Pending     bool
+	Success     bool
+	LastAttempt time.Time
+	LastSuccess time.Time
+	LastError   string
+}
+
+// Stats holds NOTIFY counters and the status of every zone and secondary
+type Stats struct {
+	Sent      uint64
+	Succeeded uint64
+	Failed    uint64
+	Targets   []TargetStatus
+}
+
+// NotifyService sends DNS NOTIFY messages (RFC 1996) to the secondaries of a zone
+// Unanswered notifications are retried with exponential backoff. A newer change
+// of the zone replaces the retries still pending for the previous serial.
+type NotifyService struct {
+	timeout        time.Duration
+	maxRetries     int
+	initialBackoff time.Duration
+	exchange       func(ctx context.Context, m *dns.Msg, addr string) (*dns.Msg, error)
+
+	mu        sync.RWMutex
+	status    map[string]*TargetStatus
+	cancels   map[string]context.CancelFunc
+	sent      uint64
+	succeeded uint64
+	failed    uint64
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewNotifyService creates a new NOTIFY service
+func NewNotifyService(timeout time.Duration, maxRetries int, initialBackoff time.Duration) *NotifyService {
+	ctx, cancel := context.WithCancel(context.Background())
+	client := &dns.Client{Net: "udp", Timeout: timeout}
+
+	return &NotifyService{
+		timeout:        timeout,
+		maxRetries:     maxRetries,
+		initialBackoff: initialBackoff,
+		exchange: func(ctx context.Context, m *dns.Msg, addr string) (*dns.Msg, error) {
+			resp, _, err := client.ExchangeContext(ctx, m, addr)
+			return resp, err
+		},
+		status:  make(map[string]*TargetStatus),
+		cancels: make(map[string]context.CancelFunc),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+}
+
+// ZoneChanged notifies the also-notify targets of a zone about its current serial
+// It returns immediately; delivery and retries happen in the background.
+// Disabled zones are not announced.
+func (n *NotifyService) ZoneChanged(zone *models.DNSZone) {
+	if n == nil || zone == nil || !zone.Enabled || len(zone.AlsoNotify) == 0 {
+		return
+	}
+
+	soaRecord := zone.SOARecord()
+	soa, err := soaRecord.ToRR()
+	if err != nil {
+		vlog.Warnf("failed to build SOA for NOTIFY of zone %s: %v", zone.Domain, err)
+		return
+	}
+	serial := soa.(*dns.SOA).Serial
+
+	for _, target := range zone.AlsoNotify {
+		addrPort, err := models.ParseServerAddr(target)
+		if err != nil {
+			vlog.Warnf("skipping NOTIFY of zone %s: %v", zone.Domain, err)
+			continue
+		}
+		n.start(zone.Domain, addrPort.String(), serial, soa)
+	}
+}
+
+// Stats returns NOTIFY statistics
+func (n *NotifyService) Stats() Stats {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	stats := Stats{
+		Sent:      n.sent,
+		Succeeded: n.succeeded,
+		Failed:    n.failed,
+		Targets:   make([]TargetStatus, 0, len(n.status)),
+	}
+	for _, status := range n.status {
+		stats.Targets = append(stats.Targets, *status)
+	}
+	sort.Slice(stats.Targets, func(i, j int) bool {
+		if stats.Targets[i].Zone != stats.Targets[j].Zone {
+			return stats.Targets[i].Zone < stats.Targets[j].Zone
+		}
+		return stats.Targets[i].Target < stats.Targets[j].Target
+	})
+
+	return stats
+}
+
+// Stop cancels pending notifications and waits for them to finish
+func (n *NotifyService) Stop() {
+	n.cancel()
+	n.wg.Wait()
+}
+
+// start begins notifying one target, replacing a pending notification of the same zone
+func (n *NotifyService) start(zone, target string, serial uint32, soa dns.RR) {
+	key := zone + "|" + target
+
+	n.mu.Lock()
+	if cancel, ok := n.cancels[key]; ok {
+		cancel()
+	}
+	ctx, cancel := context.WithCancel(n.ctx)
+	n.cancels[key] = cancel
+	n.status[key] = &TargetStatus{
+		Zone:        zone,
+		Target:      target,
+		Serial:      serial,
+		Pending:     true,
+		LastSuccess: n.lastSuccess(key),
+	}
+	n.mu.Unlock()
+
+	n.wg.Add(1)
+	go func() {
+		defer n.wg.Done()
+		defer cancel()
+		n.run(ctx, key, zone, target, soa)
+	}()
+}
+
+// run sends the NOTIFY until it is acknowledged, retries are exhausted or it is superseded
+func (n *NotifyService) run(ctx context.Context, key, zone, target string, soa dns.RR) {
+	backoff := n.initialBackoff
+	for attempt := 1; attempt <= n.maxRetries+1; attempt++ {
+		err := n.send(ctx, zone, target, soa)
+
+		n.mu.Lock()
+		if ctx.Err() != nil {
+			// Superseded by a newer change or shutting down
+			n.mu.Unlock()
+			return
+		}
+		status := n.status[key]
+		status.Attempts = attempt
+		status.LastAttempt = time.Now()
+		n.sent++
+		if err == nil {
+			status.Pending = false
+			status.Success = true
+			status.LastSuccess = status.LastAttempt
+			status.LastError = ""
+			n.succeeded++
+			delete(n.cancels, key)
+			n.mu.Unlock()
+			vlog.Infof("NOTIFY for zone %s (serial %d) acknowledged by %s", zone, status.Serial, target)
+			return
+		}
+		status.LastError = err.Error()
+		if attempt > n.maxRetries {
+			status.Pending = false
+			n.failed++
+			delete(n.cancels, key)
+			n.mu.Unlock()
+			vlog.Warnf("NOTIFY for zone %s to %s failed after %d attempts: %v", zone, target, attempt, err)
+			return
+		}
+		n.mu.Unlock()
+
+		vlog.Debugf("NOTIFY for zone %s to %s failed (attempt %d), retrying in %s: %v", zone, target, attempt, backoff, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// send delivers one NOTIFY message and checks the acknowledgement
+func (n *NotifyService) send(ctx context.Context, zone, target string, soa dns.RR) error {
+	m := new(dns.Msg)
+	m.SetNotify(zone)
+	m.Answer = []dns.RR{soa}
+
+	ctx, cancel := context.WithTimeout(ctx, n.timeout)
+	defer cancel()
+
+	resp, err := n.exchange(ctx, m, target)
+	if err != nil {
+		return err
+	}
+	if resp.Rcode != dns.RcodeSuccess {
+		return fmt.Errorf("secondary answered %s", dns.RcodeToString[resp.Rcode])
+	}
+	return nil
+}
+
+// lastSuccess returns the time of the last acknowledged NOTIFY for a key
+// The caller must hold the lock.
+func (n *NotifyService) lastSuccess(key string) time.Time {
+	if status, ok := n.status[key]; ok {
+		return status.LastSuccess
+	}
+	return time.Time{}
+}
@@ -0,0 +1,76 @@
+package v1notifyservice
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/rogerwesterbo/godns/internal/models"
+)
+
+func TestZoneChangedRetries(t *testing.T) {
+	n := NewNotifyService(time.Second, 2, time.Millisecond)
+	defer n.Stop()
+
+	var mu sync.Mutex
+	calls := make(map[string]int)
+	n.exchange = func(ctx context.Context, m *dns.Msg, addr string) (*dns.Msg, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls[addr]++
+
+		if m.Opcode != dns.OpcodeNotify || len(m.Answer) != 1 {
+			t.Errorf("unexpected NOTIFY message: %v", m)
+		}
+		// The first secondary answers on the second attempt, the second never does
+		if addr == "192.168.1.53:53" && calls[addr] == 2 {
+			resp := new(dns.Msg)
+			resp.SetReply(m)
+			return resp, nil
+		}
+		return nil, errors.New("i/o timeout")
+	}
+
+	zone := &models.DNSZone{
+		Domain:     "example.lan.",
+		Enabled:    true,
+		AlsoNotify: []string{"192.168.1.53", "192.168.1.54"},
+	}
+	n.ZoneChanged(zone)
+	n.wg.Wait()
+
+	stats := n.Stats()
+	if stats.Sent != 5 || stats.Succeeded != 1 || stats.Failed != 1 {
+		t.Errorf("stats = sent %d, succeeded %d, failed %d, want 5, 1, 1", stats.Sent, stats.Succeeded, stats.Failed)
+	}
+	if len(stats.Targets) != 2 {
+		t.Fatalf("got %d targets, want 2", len(stats.Targets))
+	}
+
+	ok, failed := stats.Targets[0], stats.Targets[1]
+	if !ok.Success || ok.Attempts != 2 || ok.LastSuccess.IsZero() {
+		t.Errorf("unexpected status for acknowledged target: %+v", ok)
+	}
+	if failed.Success || failed.Pending || failed.Attempts != 3 || failed.LastError == "" {
+		t.Errorf("unexpected status for failed target: %+v", failed)
+	}
+}
+
+func TestZoneChangedSkipsDisabledZones(t *testing.T) {
+	n := NewNotifyService(time.Second, 0, time.Millisecond)
+	defer n.Stop()
+
+	n.exchange = func(ctx context.Context, m *dns.Msg, addr string) (*dns.Msg, error) {
+		t.Errorf("unexpected NOTIFY to %s", addr)
+		return nil, errors.New("unexpected")
+	}
+
+	n.ZoneChanged(&models.DNSZone{Domain: "example.lan.", AlsoNotify: []string{"192.168.1.53"}})
+	n.wg.Wait()
+
+	var nilService *NotifyService
+	nilService.ZoneChanged(&models.DNSZone{Domain: "example.lan.", Enabled: true, AlsoNotify: []string{"192.168.1.53"}})
+}
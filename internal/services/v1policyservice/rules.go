@@ -0,0 +1,312 @@
+package v1policyservice
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/miekg/dns"
+	"github.com/rogerwesterbo/godns/internal/models"
+)
+
+// defaultTTL is the TTL of the records redirected to by hosts files and of the records of
+// policy zone files without a TTL
+const defaultTTL = 300
+
+// Special CNAME targets of RPZ rules
+const (
+	rpzNXDomain = "."
+	rpzNoData   = "*."
+	rpzPassthru = "rpz-passthru."
+	rpzDrop     = "rpz-drop."
+)
+
+// rule is a trigger of a policy and the action taken when it matches
+type rule struct {
+	name    string // Trigger as written in the policy
+	trigger string
+	action  string
+	records []dns.RR // Local data of redirect rules
+}
+
+// nameTriggers matches names against the names and wildcards of rules
+type nameTriggers struct {
+	exact    map[string]*rule
+	wildcard map[string]*rule // Keyed by the name below the "*." of the wildcard
+}
+
+func newNameTriggers() nameTriggers {
+	return nameTriggers{exact: make(map[string]*rule), wildcard: make(map[string]*rule)}
+}
+
+func (t nameTriggers) add(name string, r *rule) {
+	if parent, ok := strings.CutPrefix(name, "*."); ok {
+		t.wildcard[parent] = r
+	} else {
+		t.exact[name] = r
+	}
+}
+
+// match returns the rule of a name: an exact match, else the closest wildcard above it
+func (t nameTriggers) match(name string) *rule {
+	name = dns.CanonicalName(name)
+	if r, ok := t.exact[name]; ok {
+		return r
+	}
+	for _, i := range dns.Split(name)[1:] {
+		if r, ok := t.wildcard[name[i:]]; ok {
+			return r
+		}
+	}
+	return nil
+}
+
+// ipRule is a response IP trigger
+type ipRule struct {
+	prefix netip.Prefix
+	rule   *rule
+}
+
+// rules holds the triggers of a loaded policy
+type rules struct {
+	qname   nameTriggers
+	nsdname nameTriggers
+	ips     []ipRule // Sorted from the longest prefix to the shortest
+	soa     *dns.SOA // SOA of policy zones, used in negative answers
+	count   int      // Number of rules
+	skipped int      // Records with unsupported triggers or actions
+}
+
+func newRules() *rules {
+	return &rules{qname: newNameTriggers(), nsdname: newNameTriggers()}
+}
+
+// matchIP returns the rule of the longest prefix containing an address
+func (rs *rules) matchIP(addr netip.Addr) *rule {
+	addr = addr.Unmap()
+	for _, ip := range rs.ips {
+		if ip.prefix.Contains(addr) {
+			return ip.rule
+		}
+	}
+	return nil
+}
+
+// compileZone builds the rules of a response policy zone
+// Owner names below the zone are QNAME triggers, owners below rpz-ip and rpz-nsdname are
+// response IP and NS name triggers. A CNAME to ".", "*.", rpz-passthru. or rpz-drop. selects
+// an action, any other records are the local data the query is redirected to.
+func compileZone(origin string, rrs []dns.RR) (*rules, error) {
+	origin = dns.CanonicalName(origin)
+	rs := newRules()
+
+	// Records of the same owner form one rule
+	var owners []string
+	byOwner := make(map[string][]dns.RR)
+	for _, rr := range rrs {
+		owner := dns.CanonicalName(rr.Header().Name)
+		switch {
+		case rr.Header().Rrtype == dns.TypeSOA && owner == origin:
+			rs.soa = rr.(*dns.SOA)
+			continue
+		case owner == origin, !dns.IsSubDomain(origin, owner):
+			continue
+		}
+		if _, ok := byOwner[owner]; !ok {
+			owners = append(owners, owner)
+		}
+		byOwner[owner] = append(byOwner[owner], rr)
+	}
+	if rs.soa == nil {
+		return nil, fmt.Errorf("policy zone %s has no SOA record", origin)
+	}
+
+	for _, owner := range owners {
+		name := strings.TrimSuffix(owner, "."+origin)
+		r := &rule{name: name}
+
+		var triggers *nameTriggers
+		var prefix netip.Prefix
+		switch {
+		case strings.HasSuffix(name, ".rpz-ip"):
+			p, err := parseRPZPrefix(strings.TrimSuffix(name, ".rpz-ip"))
+			if err != nil {
+				rs.skipped++
+				continue
+			}
+			r.name, r.trigger, prefix = p.String(), models.PolicyTriggerResponseIP, p
+		case strings.HasSuffix(name, ".rpz-nsdname"):
+			r.name, r.trigger, triggers = strings.TrimSuffix(name, ".rpz-nsdname"), models.PolicyTriggerNSDName, &rs.nsdname
+		case strings.HasSuffix(name, ".rpz-client-ip"), strings.HasSuffix(name, ".rpz-nsip"):
+			rs.skipped++
+			continue
+		default:
+			r.trigger, triggers = models.PolicyTriggerQName, &rs.qname
+		}
+
+		if !setAction(r, byOwner[owner]) {
+			rs.skipped++
+			continue
+		}
+		if triggers != nil {
+			triggers.add(r.name+".", r)
+		} else {
+			rs.ips = append(rs.ips, ipRule{prefix: prefix, rule: r})
+		}
+		rs.count++
+	}
+
+	slices.SortStableFunc(rs.ips, func(a, b ipRule) int {
+		return b.prefix.Bits() - a.prefix.Bits()
+	})
+	return rs, nil
+}
+
+// setAction sets the action of a rule from its records and reports whether it is supported
+func setAction(r *rule, records []dns.RR) bool {
+	if cname, ok := records[0].(*dns.CNAME); ok {
+		if len(records) > 1 {
+			return false
+		}
+		switch target := dns.CanonicalName(cname.Target); {
+		case target == rpzNXDomain:
+			r.action = models.PolicyActionNXDomain
+			return true
+		case target == rpzNoData:
+			r.action = models.PolicyActionNoData
+			return true
+		case target == rpzPassthru, target == r.name+".":
+			// A CNAME to the trigger itself is the old form of rpz-passthru.
+			r.action = models.PolicyActionPassthru
+			return true
+		case target == rpzDrop:
+			r.action = models.PolicyActionDrop
+			return true
+		case strings.HasPrefix(target, "rpz-"), strings.HasPrefix(target, "*."):
+			// rpz-tcp-only. and wildcard targets aren't supported
+			return false
+		}
+	}
+
+	for _, rr := range records {
+		if rr.Header().Rrtype == dns.TypeCNAME && len(records) > 1 {
+			return false
+		}
+	}
+	r.action = models.PolicyActionRedirect
+	r.records = records
+	return true
+}
+
+// parseRPZPrefix parses the prefix of a response IP trigger: the prefix length followed by
+// the address in reverse order, with "zz" for the "::" of IPv6 addresses, e.g. 24.0.2.0.192
+// for 192.0.2.0/24 and 48.zz.db8.2001 for 2001:db8::/48
+func parseRPZPrefix(s string) (netip.Prefix, error) {
+	labels := strings.Split(s, ".")
+	bits, err := strconv.Atoi(labels[0])
+	if err != nil || len(labels) < 2 {
+		return netip.Prefix{}, fmt.Errorf("invalid response IP trigger %q", s)
+	}
+
+	parts := labels[1:]
+	slices.Reverse(parts)
+	var address string
+	if len(parts) == 4 && !slices.Contains(parts, "zz") {
+		address = strings.Join(parts, ".")
+	} else {
+		address = strings.Join(parts, ":")
+		address = strings.Replace(address, "zz", "", 1)
+		if strings.HasPrefix(address, ":") {
+			address = ":" + address
+		}
+		if strings.HasSuffix(address, ":") {
+			address += ":"
+		}
+	}
+
+	addr, err := netip.ParseAddr(address)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid response IP trigger %q: %w", s, err)
+	}
+	prefix, err := addr.Prefix(bits)
+	if err != nil || prefix.Addr() != addr {
+		return netip.Prefix{}, fmt.Errorf("invalid response IP trigger %q", s)
+	}
+	return prefix, nil
+}
+
+// compileList builds the rules of a hosts file or domain list
+// Names in a hosts file mapped to an unspecified or loopback address are answered NXDOMAIN,
+// names mapped to another address are redirected to it. Domains in a domain list are answered
+// NXDOMAIN together with the names below them.
+func compileList(kind string, r io.Reader) (*rules, error) {
+	rs := newRules()
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		if kind == models.PolicyTypeDomains {
+			for _, domain := range fields {
+				name := dns.CanonicalName(domain)
+				if _, ok := dns.IsDomainName(name); !ok || name == "." {
+					rs.skipped++
+					continue
+				}
+				r := &rule{name: strings.TrimSuffix(domain, "."), trigger: models.PolicyTriggerQName, action: models.PolicyActionNXDomain}
+				rs.qname.add(name, r)
+				if !strings.HasPrefix(name, "*.") {
+					rs.qname.add("*."+name, r)
+				}
+				rs.count++
+			}
+			continue
+		}
+
+		addr, err := netip.ParseAddr(fields[0])
+		if err != nil {
+			rs.skipped++
+			continue
+		}
+		for _, host := range fields[1:] {
+			name := dns.CanonicalName(host)
+			if _, ok := dns.IsDomainName(name); !ok || isLocalHost(name) {
+				continue
+			}
+			r := &rule{name: strings.TrimSuffix(host, "."), trigger: models.PolicyTriggerQName, action: models.PolicyActionNXDomain}
+			if !addr.IsUnspecified() && !addr.IsLoopback() {
+				r.action = models.PolicyActionRedirect
+				r.records = []dns.RR{addressRecord(name, addr.Unmap())}
+			}
+			rs.qname.add(name, r)
+			rs.count++
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return rs, nil
+}
+
+// isLocalHost reports whether a name is one of the local names hosts files map to themselves
+func isLocalHost(name string) bool {
+	switch name {
+	case "localhost.", "localhost.localdomain.", "local.", "broadcasthost.", "ip6-localhost.", "ip6-loopback.", "0.0.0.0.":
+		return true
+	}
+	return false
+}
+
+func addressRecord(name string, addr netip.Addr) dns.RR {
+	if addr.Is4() {
+		return &dns.A{Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: defaultTTL}, A: addr.AsSlice()}
+	}
+	return &dns.AAAA{Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeAAAA, Class: dns.ClassINET, Ttl: defaultTTL}, AAAA: addr.AsSlice()}
+}
@@ -0,0 +1,422 @@
+package v1policyservice
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/rogerwesterbo/godns/internal/models"
+	"github.com/rogerwesterbo/godns/internal/services/v1tsigservice"
+	"github.com/vitistack/common/pkg/loggers/vlog"
+)
+
+// policy is a configured response policy and its loaded rules
+type policy struct {
+	source models.PolicySource
+	rules  atomic.Pointer[rules]
+	hits   atomic.Uint64
+
+	modTime    time.Time // Modification time of the loaded file, only used by refreshes
+	lastSerial uint32    // Serial of the loaded policy zone, only written by refreshes
+
+	// Refresh state, guarded by the service mutex
+	lastLoad  time.Time
+	lastError string
+}
+
+// PolicyStatus is the state of a response policy
+type PolicyStatus struct {
+	Name        string
+	Type        string
+	Location    string
+	ProfileOnly bool
+	Loaded      bool
+	Rules       int
+	Skipped     int
+	Serial      uint32
+	Hits        uint64
+	LastLoad    time.Time
+	LastError   string
+}
+
+// V1PolicyService applies response policy zones (RPZ) and blocklists to DNS queries
+// The policies are checked in their configured order and the first matching rule decides
+// the answer. Their sources are reloaded on a schedule; a policy that fails to load keeps
+// its previous rules.
+type V1PolicyService struct {
+	policies []*policy
+	tsig     *v1tsigservice.V1TSIGService
+	refresh  time.Duration
+	timeout  time.Duration
+
+	refreshing sync.Mutex // Serializes refreshes
+	mu         sync.Mutex // Guards the refresh state of the policies
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewV1PolicyService creates a new response policy service
+// tsig signs the transfers of policy zones with a TSIG key; timeout applies to each message of
+// a transfer.
+func NewV1PolicyService(sources []models.PolicySource, tsig *v1tsigservice.V1TSIGService, refresh, timeout time.Duration) *V1PolicyService {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	s := &V1PolicyService{
+		tsig:    tsig,
+		refresh: refresh,
+		timeout: timeout,
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+	for _, source := range sources {
+		s.policies = append(s.policies, &policy{source: source})
+	}
+	return s
+}
+
+// Start loads the policies and refreshes them in the background
+func (s *V1PolicyService) Start() {
+	s.Refresh()
+
+	s.wg.Add(1)
+	go s.run()
+	vlog.Infof("Response policies started (%d policies, refresh interval: %v)", len(s.policies), s.refresh)
+}
+
+// Stop stops refreshing the policies
+func (s *V1PolicyService) Stop() {
+	s.cancel()
+	s.wg.Wait()
+}
+
+func (s *V1PolicyService) run() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.refresh)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+			s.Refresh()
+		}
+	}
+}
+
+// Refresh reloads the policies whose source changed
+func (s *V1PolicyService) Refresh() {
+	s.refreshing.Lock()
+	defer s.refreshing.Unlock()
+
+	for _, p := range s.policies {
+		loaded, err := s.load(p)
+
+		s.mu.Lock()
+		if err != nil {
+			p.lastError = err.Error()
+		} else {
+			p.lastError = ""
+		}
+		if loaded != nil {
+			p.rules.Store(loaded)
+			p.lastLoad = time.Now()
+			if loaded.soa != nil {
+				p.lastSerial = loaded.soa.Serial
+			}
+		}
+		s.mu.Unlock()
+
+		if err != nil {
+			vlog.Warnf("failed to load response policy %s: %v", p.source.Name, err)
+			continue
+		}
+		if loaded == nil {
+			continue
+		}
+		if loaded.skipped > 0 {
+			vlog.Warnf("Response policy %s: skipped %d rules with unsupported triggers or actions", p.source.Name, loaded.skipped)
+		}
+		vlog.Infof("Loaded response policy %s (%d rules)", p.source.Name, loaded.count)
+	}
+}
+
+// load reads the rules of a policy from its source, or returns nil when it didn't change
+func (s *V1PolicyService) load(p *policy) (*rules, error) {
+	if p.source.Type == models.PolicyTypeAXFR {
+		return s.transfer(p)
+	}
+
+	info, err := os.Stat(p.source.Location)
+	if err != nil {
+		return nil, err
+	}
+	if p.rules.Load() != nil && info.ModTime().Equal(p.modTime) {
+		return nil, nil
+	}
+
+	f, err := os.Open(p.source.Location)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+
+	var loaded *rules
+	if p.source.Type == models.PolicyTypeRPZ {
+		loaded, err = parseZoneFile(f, p.source.Location)
+	} else {
+		loaded, err = compileList(p.source.Type, f)
+	}
+	if err != nil {
+		return nil, err
+	}
+	p.modTime = info.ModTime()
+	return loaded, nil
+}
+
+// parseZoneFile reads an RPZ zone file; its origin is the owner of the SOA record
+func parseZoneFile(f *os.File, filename string) (*rules, error) {
+	var rrs []dns.RR
+	origin := ""
+	zp := dns.NewZoneParser(f, "", filename)
+	zp.SetDefaultTTL(defaultTTL)
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		if soa, ok := rr.(*dns.SOA); ok && origin == "" {
+			origin = soa.Hdr.Name
+		}
+		rrs = append(rrs, rr)
+	}
+	if err := zp.Err(); err != nil {
+		return nil, err
+	}
+	if origin == "" {
+		return nil, fmt.Errorf("%s has no SOA record", filename)
+	}
+	return compileZone(origin, rrs)
+}
+
+// transfer runs an AXFR of a policy zone when the serial of its primary changed
+func (s *V1PolicyService) transfer(p *policy) (*rules, error) {
+	zone, primary := p.source.Location, p.source.Primary
+
+	if p.rules.Load() != nil {
+		serial, err := s.querySerial(zone, primary)
+		if err != nil {
+			return nil, err
+		}
+		if serial == p.lastSerial {
+			return nil, nil
+		}
+	}
+
+	m := new(dns.Msg)
+	m.SetAxfr(zone)
+	t := &dns.Transfer{DialTimeout: s.timeout, ReadTimeout: s.timeout, WriteTimeout: s.timeout}
+	if p.source.TSIGKey != "" {
+		algorithm, err := s.tsig.Algorithm(s.ctx, p.source.TSIGKey)
+		if err != nil {
+			return nil, fmt.Errorf("TSIG key %s: %w", p.source.TSIGKey, err)
+		}
+		m.SetTsig(p.source.TSIGKey, algorithm, 300, time.Now().Unix())
+		t.TsigProvider = s.tsig
+	}
+
+	envelopes, err := t.In(m, primary)
+	if err != nil {
+		return nil, fmt.Errorf("AXFR of %s from %s failed: %w", zone, primary, err)
+	}
+	var rrs []dns.RR
+	for envelope := range envelopes {
+		if envelope.Error != nil {
+			return nil, fmt.Errorf("AXFR of %s from %s failed: %w", zone, primary, envelope.Error)
+		}
+		rrs = append(rrs, envelope.RR...)
+	}
+	return compileZone(zone, rrs)
+}
+
+// querySerial returns the SOA serial of a policy zone on its primary
+func (s *V1PolicyService) querySerial(zone, primary string) (uint32, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(zone, dns.TypeSOA)
+	client := &dns.Client{Timeout: s.timeout}
+	resp, _, err := client.Exchange(m, primary)
+	if err != nil {
+		return 0, fmt.Errorf("SOA query for %s to %s failed: %w", zone, primary, err)
+	}
+	for _, rr := range resp.Answer {
+		if soa, ok := rr.(*dns.SOA); ok && strings.EqualFold(soa.Hdr.Name, zone) {
+			return soa.Serial, nil
+		}
+	}
+	return 0, fmt.Errorf("no SOA record for %s from %s", zone, primary)
+}
+
+// Hit is a rule that matched a query
+type Hit struct {
+	models.PolicyHit
+	records []dns.RR
+	soa     *dns.SOA
+}
+
+// Blocklists returns the names of the policies only applied by filtering profiles
+func (s *V1PolicyService) Blocklists() []string {
+	var names []string
+	for _, p := range s.policies {
+		if p.source.ProfileOnly {
+			names = append(names, p.source.Name)
+		}
+	}
+	return names
+}
+
+// applied returns the loaded rules of a policy applied to a query, or nil; blocklists are the
+// profile-only policies applied to the client
+func (p *policy) applied(blocklists []string) *rules {
+	if p.source.ProfileOnly && !slices.Contains(blocklists, p.source.Name) {
+		return nil
+	}
+	return p.rules.Load()
+}
+
+// CheckQuery applies the QNAME triggers of the policies to the name of a query
+// blocklists are the profile-only policies applied to the client.
+func (s *V1PolicyService) CheckQuery(name string, blocklists []string) *Hit {
+	for _, p := range s.policies {
+		rs := p.applied(blocklists)
+		if rs == nil {
+			continue
+		}
+		if r := rs.qname.match(name); r != nil {
+			return p.hit(r, rs)
+		}
+	}
+	return nil
+}
+
+// CheckResponse applies the triggers of the policies to a response: the CNAME targets and
+// addresses in the answer and the name servers in the response
+func (s *V1PolicyService) CheckResponse(resp *dns.Msg, blocklists []string) *Hit {
+	var targets, nameServers []string
+	var addrs []netip.Addr
+	for _, rr := range resp.Answer {
+		switch v := rr.(type) {
+		case *dns.CNAME:
+			targets = append(targets, v.Target)
+		case *dns.A:
+			addr, _ := netip.AddrFromSlice(v.A)
+			addrs = append(addrs, addr)
+		case *dns.AAAA:
+			addr, _ := netip.AddrFromSlice(v.AAAA)
+			addrs = append(addrs, addr)
+		}
+	}
+	for _, rr := range append(resp.Answer[:len(resp.Answer):len(resp.Answer)], resp.Ns...) {
+		if ns, ok := rr.(*dns.NS); ok {
+			nameServers = append(nameServers, ns.Ns)
+		}
+	}
+
+	for _, p := range s.policies {
+		rs := p.applied(blocklists)
+		if rs == nil {
+			continue
+		}
+		for _, target := range targets {
+			if r := rs.qname.match(target); r != nil {
+				return p.hit(r, rs)
+			}
+		}
+		for _, addr := range addrs {
+			if r := rs.matchIP(addr); r != nil {
+				return p.hit(r, rs)
+			}
+		}
+		for _, ns := range nameServers {
+			if r := rs.nsdname.match(ns); r != nil {
+				return p.hit(r, rs)
+			}
+		}
+	}
+	return nil
+}
+
+// NewHit returns a rule matched outside the policies, like the rules of filtering profiles,
+// answered with its action; records are the local data of redirects
+func NewHit(hit models.PolicyHit, records []dns.RR) *Hit {
+	return &Hit{PolicyHit: hit, records: records}
+}
+
+func (p *policy) hit(r *rule, rs *rules) *Hit {
+	p.hits.Add(1)
+	return &Hit{
+		PolicyHit: models.PolicyHit{Policy: p.source.Name, Rule: r.name, Trigger: r.trigger, Action: r.action},
+		records:   r.records,
+		soa:       rs.soa,
+	}
+}
+
+// Answer sets the answer of the rule for a query in m: NXDOMAIN or NODATA with the SOA of
+// the policy zone, or the local data of the rule with the query name as owner. A CNAME in
+// the local data is answered without following it.
+func (h *Hit) Answer(m *dns.Msg, name string, qtype uint16) {
+	m.Answer, m.Ns = nil, nil
+	m.AuthenticatedData = false
+
+	switch h.Action {
+	case models.PolicyActionNXDomain:
+		m.Rcode = dns.RcodeNameError
+	case models.PolicyActionNoData:
+		m.Rcode = dns.RcodeSuccess
+	case models.PolicyActionRedirect:
+		m.Rcode = dns.RcodeSuccess
+		for _, rr := range h.records {
+			if rr.Header().Rrtype == qtype || rr.Header().Rrtype == dns.TypeCNAME || qtype == dns.TypeANY {
+				answer := dns.Copy(rr)
+				answer.Header().Name = name
+				m.Answer = append(m.Answer, answer)
+			}
+		}
+	}
+	if len(m.Answer) == 0 && h.soa != nil {
+		m.Ns = append(m.Ns, dns.Copy(h.soa))
+	}
+}
+
+// Status returns the state of the policies in their configured order
+func (s *V1PolicyService) Status() []PolicyStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status := make([]PolicyStatus, 0, len(s.policies))
+	for _, p := range s.policies {
+		st := PolicyStatus{
+			Name:        p.source.Name,
+			Type:        p.source.Type,
+			Location:    p.source.Location,
+			ProfileOnly: p.source.ProfileOnly,
+			Serial:      p.lastSerial,
+			Hits:        p.hits.Load(),
+			LastLoad:    p.lastLoad,
+			LastError:   p.lastError,
+		}
+		if p.source.Type == models.PolicyTypeAXFR {
+			st.Location += "@" + p.source.Primary
+		}
+		if rs := p.rules.Load(); rs != nil {
+			st.Loaded, st.Rules, st.Skipped = true, rs.count, rs.skipped
+		}
+		status = append(status, st)
+	}
+	return status
+}
@@ -0,0 +1,199 @@
+package v1policyservice
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/rogerwesterbo/godns/internal/models"
+)
+
+func TestParseRPZPrefix(t *testing.T) {
+	tests := []struct {
+		trigger string
+		want    string
+		wantErr bool
+	}{
+		{"32.1.2.0.192", "192.0.2.1/32", false},
+		{"24.0.2.0.192", "192.0.2.0/24", false},
+		{"128.1.zz.db8.2001", "2001:db8::1/128", false},
+		{"48.zz.db8.2001", "2001:db8::/48", false},
+		{"128.1.zz", "::1/128", false},
+		{"24.1.2.0.192", "", true}, // host bits set
+		{"33.1.2.0.192", "", true},
+		{"ip.1.2.0.192", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.trigger, func(t *testing.T) {
+			got, err := parseRPZPrefix(tt.trigger)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseRPZPrefix() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got.String() != tt.want {
+				t.Errorf("parseRPZPrefix() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompileList(t *testing.T) {
+	hosts, err := compileList(models.PolicyTypeHosts, strings.NewReader(`# ads
+127.0.0.1 localhost
+0.0.0.0 ads.example.com tracker.example.com # trailing comment
+10.0.0.5 intranet.example.com
+not-an-address example.org
+`))
+	if err != nil {
+		t.Fatalf("compileList(hosts) error = %v", err)
+	}
+	domains, err := compileList(models.PolicyTypeDomains, strings.NewReader("malware.example\n*.wild.example\n"))
+	if err != nil {
+		t.Fatalf("compileList(domains) error = %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		rules      *rules
+		qname      string
+		wantAction string
+	}{
+		{"hosts sinkhole", hosts, "ADS.example.com.", models.PolicyActionNXDomain},
+		{"hosts only match the name", hosts, "sub.ads.example.com.", ""},
+		{"hosts redirect", hosts, "intranet.example.com.", models.PolicyActionRedirect},
+		{"hosts skip localhost", hosts, "localhost.", ""},
+		{"domain", domains, "malware.example.", models.PolicyActionNXDomain},
+		{"below a domain", domains, "a.b.malware.example.", models.PolicyActionNXDomain},
+		{"wildcard domain", domains, "a.wild.example.", models.PolicyActionNXDomain},
+		{"name of a wildcard domain", domains, "wild.example.", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var action string
+			if r := tt.rules.qname.match(tt.qname); r != nil {
+				action = r.action
+			}
+			if action != tt.wantAction {
+				t.Errorf("action for %s = %q, want %q", tt.qname, action, tt.wantAction)
+			}
+		})
+	}
+	if hosts.count != 3 || hosts.skipped != 1 {
+		t.Errorf("hosts rules, skipped = %d, %d, want 3, 1", hosts.count, hosts.skipped)
+	}
+}
+
+func TestCheckResponse(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "first.rpz")
+	second := filepath.Join(dir, "second.txt")
+	writeFile(t, first, `$ORIGIN rpz.test.
+@ SOA ns.rpz.test. hostmaster.rpz.test. 1 3600 600 86400 60
+ns.evil.example.rpz-nsdname CNAME .
+24.0.2.0.192.rpz-ip CNAME *.
+32.7.2.0.192.rpz-ip CNAME rpz-passthru.
+client.rpz-client-ip CNAME .
+`)
+	writeFile(t, second, "cdn.example\n")
+
+	s := NewV1PolicyService([]models.PolicySource{
+		{Name: "first", Type: models.PolicyTypeRPZ, Location: first},
+		{Name: "second", Type: models.PolicyTypeDomains, Location: second, ProfileOnly: true},
+	}, nil, time.Hour, time.Second)
+	s.Refresh()
+
+	tests := []struct {
+		name       string
+		records    []string
+		wantPolicy string
+		wantRule   string
+	}{
+		{"response IP", []string{"www.example.com. 60 IN A 192.0.2.10"}, "first", "192.0.2.0/24"},
+		{"longest prefix", []string{"www.example.com. 60 IN A 192.0.2.7"}, "first", "192.0.2.7/32"},
+		{"name server", []string{"example.com. 60 IN NS ns.evil.example."}, "first", "ns.evil.example"},
+		{"CNAME target", []string{"www.example.com. 60 IN CNAME www.cdn.example.", "www.cdn.example. 60 IN A 198.51.100.1"}, "second", "cdn.example"},
+		{"no match", []string{"www.example.com. 60 IN AAAA 2001:db8::1"}, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := new(dns.Msg)
+			for _, s := range tt.records {
+				rr, err := dns.NewRR(s)
+				if err != nil {
+					t.Fatalf("NewRR(%q) error = %v", s, err)
+				}
+				if rr.Header().Rrtype == dns.TypeNS {
+					resp.Ns = append(resp.Ns, rr)
+				} else {
+					resp.Answer = append(resp.Answer, rr)
+				}
+			}
+
+			var policy, rule string
+			if hit := s.CheckResponse(resp, []string{"second"}); hit != nil {
+				policy, rule = hit.Policy, hit.Rule
+			}
+			if policy != tt.wantPolicy || rule != tt.wantRule {
+				t.Errorf("CheckResponse() = %q %q, want %q %q", policy, rule, tt.wantPolicy, tt.wantRule)
+			}
+		})
+	}
+
+	status := s.Status()
+	if status[0].Rules != 3 || status[0].Skipped != 1 || status[0].Serial != 1 || status[0].Hits != 3 {
+		t.Errorf("status = %+v, want 3 rules, 1 skipped, serial 1 and 3 hits", status[0])
+	}
+
+	// Changed files are reloaded, policies that fail to load keep their rules
+	writeFile(t, second, "other.example\n")
+	future := time.Now().Add(time.Minute)
+	if err := os.Chtimes(second, future, future); err != nil {
+		t.Fatalf("Chtimes() error = %v", err)
+	}
+	writeFile(t, first, "not a zone file")
+	if err := os.Chtimes(first, future, future); err != nil {
+		t.Fatalf("Chtimes() error = %v", err)
+	}
+	s.Refresh()
+	if s.CheckQuery("www.cdn.example.", []string{"second"}) != nil || s.CheckQuery("www.other.example.", []string{"second"}) == nil {
+		t.Error("domain list not reloaded")
+	}
+	if s.CheckQuery("www.other.example.", nil) != nil {
+		t.Error("profile-only blocklist applied to a client without it")
+	}
+	if s.Status()[0].LastError == "" || s.CheckResponse(&dns.Msg{Ns: []dns.RR{&dns.NS{Hdr: dns.RR_Header{Name: "example.com.", Rrtype: dns.TypeNS}, Ns: "ns.evil.example."}}}, nil) == nil {
+		t.Error("policy zone that failed to load lost its rules")
+	}
+}
+
+func TestAnswer(t *testing.T) {
+	soa := &dns.SOA{Hdr: dns.RR_Header{Name: "rpz.test.", Rrtype: dns.TypeSOA}, Ns: "ns.rpz.test.", Mbox: "hostmaster.rpz.test."}
+	hit := &Hit{
+		PolicyHit: models.PolicyHit{Action: models.PolicyActionRedirect},
+		records:   []dns.RR{addressRecord("walled.example.", netip.MustParseAddr("10.0.0.1"))},
+		soa:       soa,
+	}
+
+	m := new(dns.Msg)
+	hit.Answer(m, "Ads.Example.COM.", dns.TypeA)
+	if len(m.Answer) != 1 || m.Answer[0].Header().Name != "Ads.Example.COM." {
+		t.Errorf("redirect answer = %v, want the local data with the query name", m.Answer)
+	}
+
+	m = new(dns.Msg)
+	hit.Answer(m, "ads.example.com.", dns.TypeAAAA)
+	if m.Rcode != dns.RcodeSuccess || len(m.Answer) != 0 || len(m.Ns) != 1 {
+		t.Errorf("redirect without data of the type = %v, want NODATA with the SOA", m)
+	}
+}
+
+func writeFile(t *testing.T, name, data string) {
+	t.Helper()
+	if err := os.WriteFile(name, []byte(data), 0o600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+}
@@ -10,22 +10,27 @@ import (
 	"time"
 
 	"github.com/miekg/dns"
+	"github.com/rogerwesterbo/godns/internal/models"
 	"github.com/rogerwesterbo/godns/pkg/interfaces/valkeyinterface"
 	"github.com/vitistack/common/pkg/loggers/vlog"
 )
 
 // QueryLog represents a single DNS query log entry
 type QueryLog struct {
-	Timestamp    time.Time `json:"timestamp"`
-	ClientIP     string    `json:"client_ip"`
-	QueryName    string    `json:"query_name"`
-	QueryType    string    `json:"query_type"`
-	ResponseCode string    `json:"response_code"`
-	AnswerCount  int       `json:"answer_count"`
-	Latency      int64     `json:"latency_ms"`
-	CacheHit     bool      `json:"cache_hit"`
-	Upstream     bool      `json:"upstream"`
-	Blocked      bool      `json:"blocked"`
+	Timestamp    time.Time         `json:"timestamp"`
+	ClientIP     string            `json:"client_ip"`
+	QueryName    string            `json:"query_name"`
+	QueryType    string            `json:"query_type"`
+	ResponseCode string            `json:"response_code"`
+	AnswerCount  int               `json:"answer_count"`
+	Latency      int64             `json:"latency_ms"`
+	CacheHit     bool              `json:"cache_hit"`
+	Upstream     bool              `json:"upstream"`
+	Blocked      bool              `json:"blocked"`
+	Policy       *models.PolicyHit `json:"policy,omitempty"`       // Response policy or profile rule that matched the query
+	ClientGroup  string            `json:"client_group,omitempty"` // Client group of the client
+	Profile      string            `json:"profile,omitempty"`      // Filtering profile applied to the query
+	Transport    string            `json:"transport"`              // udp, tcp or tls
 }
 
 // QueryLogService manages DNS query logging
@@ -80,7 +85,11 @@ func (qls *QueryLogService) LogQuery(ctx context.Context,
 	latency time.Duration,
 	cacheHit bool,
 	upstream bool,
-	blocked bool) {
+	blocked bool,
+	policy *models.PolicyHit,
+	clientGroup string,
+	profile string,
+	transport string) {
 
 	if !qls.enabled.Load() {
 		return
@@ -114,6 +123,10 @@ func (qls *QueryLogService) LogQuery(ctx context.Context,
 		CacheHit:     cacheHit,
 		Upstream:     upstream,
 		Blocked:      blocked,
+		Policy:       policy,
+		ClientGroup:  clientGroup,
+		Profile:      profile,
+		Transport:    transport,
 	}
 
 	// Log to console if enabled
@@ -4,10 +4,17 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/rogerwesterbo/godns/internal/models"
+	"github.com/rogerwesterbo/godns/internal/services/v1cacheservice"
+	"github.com/rogerwesterbo/godns/internal/services/v1notifyservice"
+	"github.com/rogerwesterbo/godns/internal/services/v1zonejournal"
+	"github.com/rogerwesterbo/godns/internal/services/v1zoneservice"
 	"github.com/rogerwesterbo/godns/pkg/interfaces/valkeyinterface"
+	"github.com/vitistack/common/pkg/loggers/vlog"
 )
 
 const (
@@ -17,64 +24,104 @@ const (
 
 // V1RecordService handles DNS record operations
 type V1RecordService struct {
-	client valkeyinterface.ValkeyInterface
+	client        valkeyinterface.ValkeyInterface
+	journal       *v1zonejournal.Journal
+	notifyService *v1notifyservice.NotifyService
+	cacheService  *v1cacheservice.DNSCache
+	zoneService   *v1zoneservice.V1ZoneService
 }
 
 // NewV1RecordService creates a new record service
-func NewV1RecordService(client valkeyinterface.ValkeyInterface) *V1RecordService {
+// It shares storage, NOTIFY and the DNS cache with the zone service, so record
+// changes reach secondaries and drop cached answers like zone changes do.
+func NewV1RecordService(zoneService *v1zoneservice.V1ZoneService) *V1RecordService {
 	return &V1RecordService{
-		client: client,
+		client:        zoneService.GetClient(),
+		journal:       v1zonejournal.NewJournal(zoneService.GetClient()),
+		notifyService: zoneService.GetNotifyService(),
+		cacheService:  zoneService.GetCacheService(),
+		zoneService:   zoneService,
 	}
 }
 
-// CreateRecord adds a new record to a zone
-func (s *V1RecordService) CreateRecord(ctx context.Context, domain string, record *models.DNSRecord) error {
+// CreateRecord adds a new record to a zone, or to the records the zone serves to a view
+// The record joins the existing RRset for its name and type; only an identical
+// record (same name, type and value) is rejected.
+func (s *V1RecordService) CreateRecord(ctx context.Context, domain, view string, record *models.DNSRecord) error {
 	if !strings.HasSuffix(domain, ".") {
 		domain += "."
 	}
 
+	unlock, err := s.zoneService.LockZone(ctx, domain)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
 	// Check if zone exists
 	zone, err := s.getZone(ctx, domain)
 	if err != nil {
 		return fmt.Errorf("zone not found: %w", err)
 	}
+	if zone.IsSecondary() && view == "" {
+		return readOnlyError(domain)
+	}
+	before := snapshot(zone)
+
+	records, err := viewRecords(zone, view, true)
+	if err != nil {
+		return err
+	}
 
 	// Validate record
-	if err := s.validateRecord(record); err != nil {
+	if err := s.validateRecord(record, view); err != nil {
 		return err
 	}
 
-	// Check if record already exists
-	for _, r := range zone.Records {
-		if r.Name == record.Name && r.Type == record.Type {
-			return fmt.Errorf("record %s of type %s already exists in zone", record.Name, record.Type)
+	// Check if an identical record already exists
+	for _, r := range *records {
+		if r.SameRRSet(record) && r.GetRData() == record.GetRData() {
+			return fmt.Errorf("record %s of type %s with value %s already exists in zone", record.Name, record.Type, record.GetRData())
 		}
 	}
 
 	// Add record to zone
-	zone.Records = append(zone.Records, *record)
+	*records = append(*records, *record)
 
-	// Update zone
-	zoneData, err := json.Marshal(zone)
+	if err := models.CheckCNAMEConflicts(*records); err != nil {
+		return fmt.Errorf("invalid record: %w", err)
+	}
+
+	return s.saveChange(ctx, domain, view, before, zone, recordSetKey{name: record.Name, recordType: record.Type})
+}
+
+// GetRecordSet retrieves all records with the given name and type from a zone or one of its views
+func (s *V1RecordService) GetRecordSet(ctx context.Context, domain, view, name, recordType string) ([]models.DNSRecord, error) {
+	if !strings.HasSuffix(domain, ".") {
+		domain += "."
+	}
+
+	zone, err := s.getZone(ctx, domain)
 	if err != nil {
-		return fmt.Errorf("failed to marshal zone: %w", err)
+		return nil, fmt.Errorf("zone not found: %w", err)
 	}
 
-	zoneKey := zoneKeyPrefix + domain
-	if err := s.client.SetData(ctx, zoneKey, string(zoneData)); err != nil {
-		return fmt.Errorf("failed to update zone: %w", err)
+	records, err := viewRecords(zone, view, false)
+	if err != nil {
+		return nil, err
 	}
 
-	// Save individual record
-	if err := s.saveRecord(ctx, domain, record); err != nil {
-		return fmt.Errorf("failed to save record: %w", err)
+	set := models.FilterRecordSet(*records, name, recordType)
+	if len(set) == 0 {
+		return nil, fmt.Errorf("record not found")
 	}
 
-	return nil
+	return set, nil
 }
 
-// GetRecord retrieves a specific record from a zone
-func (s *V1RecordService) GetRecord(ctx context.Context, domain, name, recordType string) (*models.DNSRecord, error) {
+// GetRecord retrieves a specific record from a zone or one of its views
+// An empty value selects the record only if the RRset holds exactly one record.
+func (s *V1RecordService) GetRecord(ctx context.Context, domain, view, name, recordType, value string) (*models.DNSRecord, error) {
 	if !strings.HasSuffix(domain, ".") {
 		domain += "."
 	}
@@ -84,86 +131,112 @@ func (s *V1RecordService) GetRecord(ctx context.Context, domain, name, recordTyp
 		return nil, fmt.Errorf("zone not found: %w", err)
 	}
 
-	for _, record := range zone.Records {
-		if record.Name == name && record.Type == recordType {
-			return &record, nil
-		}
+	records, err := viewRecords(zone, view, false)
+	if err != nil {
+		return nil, err
+	}
+
+	idx, err := findRecord(*records, name, recordType, value)
+	if err != nil {
+		return nil, err
 	}
 
-	return nil, fmt.Errorf("record not found")
+	record := (*records)[idx]
+	return &record, nil
 }
 
-// UpdateRecord updates an existing record in a zone
-func (s *V1RecordService) UpdateRecord(ctx context.Context, domain, name, recordType string, record *models.DNSRecord) error {
+// UpdateRecord updates an existing record in a zone or one of its views
+// The record to replace is identified by name, type and value; an empty value
+// is only accepted when the RRset holds a single record.
+func (s *V1RecordService) UpdateRecord(ctx context.Context, domain, view, name, recordType, value string, record *models.DNSRecord) error {
 	if !strings.HasSuffix(domain, ".") {
 		domain += "."
 	}
 
+	unlock, err := s.zoneService.LockZone(ctx, domain)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
 	// Get zone
 	zone, err := s.getZone(ctx, domain)
 	if err != nil {
 		return fmt.Errorf("zone not found: %w", err)
 	}
-
-	// Validate record
-	if err := s.validateRecord(record); err != nil {
-		return err
+	if zone.IsSecondary() && view == "" {
+		return readOnlyError(domain)
 	}
+	before := snapshot(zone)
 
-	// Find and update the record
-	found := false
-	for i, r := range zone.Records {
-		if r.Name == name && r.Type == recordType {
-			zone.Records[i] = *record
-			found = true
-			break
-		}
+	records, err := viewRecords(zone, view, false)
+	if err != nil {
+		return err
 	}
 
-	if !found {
-		return fmt.Errorf("record not found")
+	// Validate record
+	if err := s.validateRecord(record, view); err != nil {
+		return err
 	}
 
-	// Update zone
-	zoneData, err := json.Marshal(zone)
+	// Find the record to update
+	idx, err := findRecord(*records, name, recordType, value)
 	if err != nil {
-		return fmt.Errorf("failed to marshal zone: %w", err)
+		return err
 	}
 
-	zoneKey := zoneKeyPrefix + domain
-	if err := s.client.SetData(ctx, zoneKey, string(zoneData)); err != nil {
-		return fmt.Errorf("failed to update zone: %w", err)
+	// Reject updates that would duplicate another record in the target RRset
+	for i, r := range *records {
+		if i != idx && r.SameRRSet(record) && r.GetRData() == record.GetRData() {
+			return fmt.Errorf("record %s of type %s with value %s already exists in zone", record.Name, record.Type, record.GetRData())
+		}
 	}
 
-	// Delete old record
-	oldRecordKey := recordKeyPrefix + domain + ":" + name + ":" + recordType
-	_ = s.client.DeleteData(ctx, oldRecordKey)
+	(*records)[idx] = *record
 
-	// Save updated record
-	if err := s.saveRecord(ctx, domain, record); err != nil {
-		return fmt.Errorf("failed to save record: %w", err)
+	if err := models.CheckCNAMEConflicts(*records); err != nil {
+		return fmt.Errorf("invalid record: %w", err)
 	}
 
-	return nil
+	// Refresh the old record set too, the record may have moved to another name or type
+	return s.saveChange(ctx, domain, view, before, zone,
+		recordSetKey{name: name, recordType: recordType},
+		recordSetKey{name: record.Name, recordType: record.Type})
 }
 
-// DeleteRecord deletes a record from a zone
-func (s *V1RecordService) DeleteRecord(ctx context.Context, domain, name, recordType string) error {
+// DeleteRecord deletes a record from a zone or one of its views
+// With an empty value the whole RRset for name and type is deleted.
+func (s *V1RecordService) DeleteRecord(ctx context.Context, domain, view, name, recordType, value string) error {
 	if !strings.HasSuffix(domain, ".") {
 		domain += "."
 	}
 
+	unlock, err := s.zoneService.LockZone(ctx, domain)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
 	// Get zone
 	zone, err := s.getZone(ctx, domain)
 	if err != nil {
 		return fmt.Errorf("zone not found: %w", err)
 	}
+	if zone.IsSecondary() && view == "" {
+		return readOnlyError(domain)
+	}
+	before := snapshot(zone)
+
+	records, err := viewRecords(zone, view, false)
+	if err != nil {
+		return err
+	}
 
-	// Find and remove the record
+	// Find and remove the record(s)
 	found := false
-	newRecords := make([]models.DNSRecord, 0, len(zone.Records))
-	for _, r := range zone.Records {
-		if r.Name == name && r.Type == recordType {
+	newRecords := make([]models.DNSRecord, 0, len(*records))
+	for _, r := range *records {
+		if r.Name == name && r.Type == recordType && (value == "" || r.MatchesValue(value)) {
 			found = true
 			continue
 		}
@@ -174,74 +247,147 @@ func (s *V1RecordService) DeleteRecord(ctx context.Context, domain, name, record
 		return fmt.Errorf("record not found")
 	}
 
-	zone.Records = newRecords
+	*records = newRecords
 
-	// Update zone
-	zoneData, err := json.Marshal(zone)
+	// Rewrite (or remove) the record set
+	return s.saveChange(ctx, domain, view, before, zone, recordSetKey{name: name, recordType: recordType})
+}
+
+// SetRecordEnabled sets the enabled status of a DNS record in a zone or one of its views
+// With an empty value every record in the RRset is updated.
+func (s *V1RecordService) SetRecordEnabled(ctx context.Context, domain, view, name, recordType, value string, enabled bool) error {
+	if !strings.HasSuffix(domain, ".") {
+		domain += "."
+	}
+
+	unlock, err := s.zoneService.LockZone(ctx, domain)
 	if err != nil {
-		return fmt.Errorf("failed to marshal zone: %w", err)
+		return err
 	}
+	defer unlock()
 
-	zoneKey := zoneKeyPrefix + domain
-	if err := s.client.SetData(ctx, zoneKey, string(zoneData)); err != nil {
-		return fmt.Errorf("failed to update zone: %w", err)
+	// Load zone so the in-zone record listing stays in sync
+	zone, err := s.getZone(ctx, domain)
+	if err != nil {
+		return fmt.Errorf("zone not found: %w", err)
+	}
+	if zone.IsSecondary() && view == "" {
+		return readOnlyError(domain)
 	}
+	before := snapshot(zone)
 
-	// Delete individual record
-	recordKey := recordKeyPrefix + domain + ":" + name + ":" + recordType
-	if err := s.client.DeleteData(ctx, recordKey); err != nil {
-		return fmt.Errorf("failed to delete record: %w", err)
+	records, err := viewRecords(zone, view, false)
+	if err != nil {
+		return err
 	}
 
-	return nil
+	found := false
+	for i := range *records {
+		record := &(*records)[i]
+		if record.Name == name && record.Type == recordType && (value == "" || record.MatchesValue(value)) {
+			record.Disabled = !enabled
+			found = true
+		}
+	}
+
+	if !found {
+		return fmt.Errorf("record not found")
+	}
+
+	return s.saveChange(ctx, domain, view, before, zone, recordSetKey{name: name, recordType: recordType})
 }
 
-// SetRecordEnabled sets the enabled status of a DNS record
-func (s *V1RecordService) SetRecordEnabled(ctx context.Context, domain, name, recordType string, enabled bool) error {
+// UpdateZoneRecords applies a batch of record changes to a zone as one change
+// change edits the zone's records in place; when it returns an error nothing is
+// saved. The records are validated like single record changes and the zone is
+// only saved, with a single serial bump, when its records changed. It reports
+// whether the zone changed. Batches of the same zone are applied one after another.
+func (s *V1RecordService) UpdateZoneRecords(ctx context.Context, domain string, change func(zone *models.DNSZone) error) (bool, error) {
 	if !strings.HasSuffix(domain, ".") {
 		domain += "."
 	}
 
-	// Load zone so the in-zone record listing stays in sync
+	unlock, err := s.zoneService.LockZone(ctx, domain)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
 	zone, err := s.getZone(ctx, domain)
 	if err != nil {
-		return fmt.Errorf("zone not found: %w", err)
+		return false, fmt.Errorf("zone not found: %w", err)
+	}
+	if zone.IsSecondary() {
+		return false, readOnlyError(domain)
+	}
+	before := snapshot(zone)
+
+	if err := change(zone); err != nil {
+		return false, err
 	}
 
-	var updatedRecord *models.DNSRecord
 	for i := range zone.Records {
-		if zone.Records[i].Name == name && zone.Records[i].Type == recordType {
-			zone.Records[i].Disabled = !enabled
-			updatedRecord = &zone.Records[i]
-			break
+		if err := s.validateRecord(&zone.Records[i], ""); err != nil {
+			return false, err
 		}
 	}
-
-	if updatedRecord == nil {
-		return fmt.Errorf("record not found")
+	if err := models.CheckCNAMEConflicts(zone.Records); err != nil {
+		return false, fmt.Errorf("invalid record: %w", err)
 	}
 
-	// Persist updated zone metadata
-	zoneData, err := json.Marshal(zone)
-	if err != nil {
-		return fmt.Errorf("failed to marshal zone: %w", err)
+	changed := changedRecordSets(before.Records, zone.Records)
+	if len(changed) == 0 {
+		return false, nil
 	}
 
-	zoneKey := zoneKeyPrefix + domain
-	if err := s.client.SetData(ctx, zoneKey, string(zoneData)); err != nil {
-		return fmt.Errorf("failed to update zone: %w", err)
+	if err := s.saveZone(ctx, domain, before, zone); err != nil {
+		return false, err
 	}
 
-	// Persist individual record entry
-	if err := s.saveRecord(ctx, domain, updatedRecord); err != nil {
-		return fmt.Errorf("failed to update record status: %w", err)
+	for _, set := range changed {
+		if err := s.saveRecordSet(ctx, domain, zone, set.name, set.recordType); err != nil {
+			return false, fmt.Errorf("failed to save record: %w", err)
+		}
 	}
+	s.cacheService.DeleteZone(ctx, domain)
 
-	return nil
+	return true, nil
 }
 
 // Helper functions
 
+// recordSetKey identifies an RRset by owner name and type
+type recordSetKey struct {
+	name       string
+	recordType string
+}
+
+// changedRecordSets returns the RRsets whose records differ between two versions of a zone
+func changedRecordSets(before, after []models.DNSRecord) []recordSetKey {
+	contents := func(records []models.DNSRecord) map[recordSetKey][]string {
+		sets := make(map[recordSetKey][]string)
+		for _, r := range records {
+			key := recordSetKey{name: r.Name, recordType: r.Type}
+			sets[key] = append(sets[key], fmt.Sprintf("%s|%d|%t", r.GetRData(), r.TTL, r.Disabled))
+		}
+		return sets
+	}
+	old, updated := contents(before), contents(after)
+
+	var changed []recordSetKey
+	for key, values := range updated {
+		if strings.Join(values, "\n") != strings.Join(old[key], "\n") {
+			changed = append(changed, key)
+		}
+	}
+	for key := range old {
+		if _, ok := updated[key]; !ok {
+			changed = append(changed, key)
+		}
+	}
+	return changed
+}
+
 // getZone retrieves a zone from storage
 func (s *V1RecordService) getZone(ctx context.Context, domain string) (*models.DNSZone, error) {
 	zoneKey := zoneKeyPrefix + domain
@@ -263,19 +409,153 @@ func (s *V1RecordService) getZone(ctx context.Context, domain string) (*models.D
 	return &zone, nil
 }
 
-// saveRecord saves a record to storage
-func (s *V1RecordService) saveRecord(ctx context.Context, domain string, record *models.DNSRecord) error {
-	recordKey := recordKeyPrefix + domain + ":" + record.Name + ":" + record.Type
-	recordData, err := json.Marshal(record)
+// saveZone persists the zone metadata including its record listing
+// The SOA serial is bumped, the difference to the previous version is journaled for
+// incremental zone transfers and the zone's secondaries are notified. Callers hold the
+// zone's lock from reading the zone, so serials and journal entries follow one another.
+func (s *V1RecordService) saveZone(ctx context.Context, domain string, before, zone *models.DNSZone) error {
+	zone.BumpSerial(before.SOASerial(), time.Now())
+
+	zoneData, err := json.Marshal(zone)
+	if err != nil {
+		return fmt.Errorf("failed to marshal zone: %w", err)
+	}
+
+	zoneKey := zoneKeyPrefix + domain
+	if err := s.client.SetData(ctx, zoneKey, string(zoneData)); err != nil {
+		return fmt.Errorf("failed to update zone: %w", err)
+	}
+
+	// Store the SOA record set with the new serial
+	for _, record := range zone.Records {
+		if record.Type != "SOA" {
+			continue
+		}
+		if err := s.saveRecordSet(ctx, domain, zone, record.Name, record.Type); err != nil {
+			return fmt.Errorf("failed to save SOA record: %w", err)
+		}
+	}
+
+	if err := s.journal.Record(ctx, domain, before, zone); err != nil {
+		vlog.Warnf("failed to journal change of zone %s: %v", domain, err)
+	}
+	s.notifyService.ZoneChanged(zone)
+
+	return nil
+}
+
+// saveChange persists a change to the records of a zone or of one of its views
+// Changes to the zone's own records are saved with saveZone and their RRsets are rewritten.
+// Views are only stored with the zone: they aren't transferred to secondaries, so the
+// serial stays the same and the change is neither journaled nor notified. Either way the
+// cached answers of the zone are dropped once the change is stored.
+func (s *V1RecordService) saveChange(ctx context.Context, domain, view string, before, zone *models.DNSZone, sets ...recordSetKey) error {
+	if view != "" {
+		zone.Views = slices.DeleteFunc(zone.Views, func(v models.ZoneView) bool { return len(v.Records) == 0 })
+
+		zoneData, err := json.Marshal(zone)
+		if err != nil {
+			return fmt.Errorf("failed to marshal zone: %w", err)
+		}
+		if err := s.client.SetData(ctx, zoneKeyPrefix+domain, string(zoneData)); err != nil {
+			return fmt.Errorf("failed to update zone: %w", err)
+		}
+		s.cacheService.DeleteZone(ctx, domain)
+		return nil
+	}
+
+	if err := s.saveZone(ctx, domain, before, zone); err != nil {
+		return err
+	}
+	for _, set := range sets {
+		if err := s.saveRecordSet(ctx, domain, zone, set.name, set.recordType); err != nil {
+			return fmt.Errorf("failed to save record: %w", err)
+		}
+	}
+	s.cacheService.DeleteZone(ctx, domain)
+	return nil
+}
+
+// viewRecords returns the records of a zone that a change applies to: the zone's own records
+// without a view, or the records the zone serves to the view. With create, a view the zone
+// has no records for yet is added to the zone.
+func viewRecords(zone *models.DNSZone, view string, create bool) (*[]models.DNSRecord, error) {
+	if view == "" {
+		return &zone.Records, nil
+	}
+	if err := models.ValidateViewName(view); err != nil {
+		return nil, err
+	}
+
+	zoneView := zone.View(view)
+	if zoneView == nil {
+		if !create {
+			return nil, fmt.Errorf("record not found: zone %s has no records for view %s", zone.Domain, view)
+		}
+		zone.Views = append(zone.Views, models.ZoneView{Name: view})
+		zoneView = &zone.Views[len(zone.Views)-1]
+	}
+	return &zoneView.Records, nil
+}
+
+// readOnlyError is returned for changes to records of secondary zones
+func readOnlyError(domain string) error {
+	return fmt.Errorf("zone %s is a secondary zone and read-only", domain)
+}
+
+// snapshot returns a copy of the zone that is not affected by later record changes
+func snapshot(zone *models.DNSZone) *models.DNSZone {
+	before := *zone
+	before.Records = append([]models.DNSRecord(nil), zone.Records...)
+	return &before
+}
+
+// saveRecordSet writes the RRset for name and type to storage
+// The key is removed when the zone no longer holds any record for the set.
+func (s *V1RecordService) saveRecordSet(ctx context.Context, domain string, zone *models.DNSZone, name, recordType string) error {
+	recordKey := recordKeyPrefix + domain + ":" + name + ":" + recordType
+	records := models.FilterRecordSet(zone.Records, name, recordType)
+	if len(records) == 0 {
+		return s.client.DeleteData(ctx, recordKey)
+	}
+
+	recordData, err := json.Marshal(records)
 	if err != nil {
-		return fmt.Errorf("failed to marshal record: %w", err)
+		return fmt.Errorf("failed to marshal record set: %w", err)
 	}
 
 	return s.client.SetData(ctx, recordKey, string(recordData))
 }
 
-// validateRecord validates a DNS record
-func (s *V1RecordService) validateRecord(record *models.DNSRecord) error {
+// findRecord returns the index of the record identified by name, type and value
+func findRecord(records []models.DNSRecord, name, recordType, value string) (int, error) {
+	idx := -1
+	matches := 0
+	for i, r := range records {
+		if r.Name != name || r.Type != recordType {
+			continue
+		}
+		if value != "" && !r.MatchesValue(value) {
+			continue
+		}
+		if idx == -1 {
+			idx = i
+		}
+		matches++
+	}
+
+	if idx == -1 {
+		return -1, fmt.Errorf("record not found")
+	}
+	if value == "" && matches > 1 {
+		return -1, fmt.Errorf("ambiguous record: %d %s records exist for %s, specify a value", matches, recordType, name)
+	}
+
+	return idx, nil
+}
+
+// validateRecord validates a DNS record, in a view when view is set
+func (s *V1RecordService) validateRecord(record *models.DNSRecord, view string) error {
 	// Normalize type to uppercase
 	record.Type = strings.ToUpper(record.Type)
 
@@ -288,7 +568,7 @@ func (s *V1RecordService) validateRecord(record *models.DNSRecord) error {
 	validTypes := map[string]bool{
 		"A": true, "AAAA": true, "CNAME": true, "ALIAS": true, "MX": true,
 		"NS": true, "TXT": true, "PTR": true, "SRV": true,
-		"SOA": true, "CAA": true,
+		"SOA": true, "CAA": true, "DS": true,
 	}
 	if !validTypes[record.Type] {
 		return fmt.Errorf("invalid record type: %s", record.Type)
@@ -299,5 +579,10 @@ func (s *V1RecordService) validateRecord(record *models.DNSRecord) error {
 		return err
 	}
 
+	// The SOA belongs to the zone, its serial is the same for every view
+	if view != "" && record.Type == "SOA" {
+		return fmt.Errorf("invalid record: SOA records can't be set in a view")
+	}
+
 	return nil
 }
@@ -0,0 +1,112 @@
+package v1recordservice
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/rogerwesterbo/godns/internal/models"
+	"github.com/rogerwesterbo/godns/internal/services/v1zonejournal"
+	"github.com/rogerwesterbo/godns/internal/services/v1zoneservice"
+	"github.com/rogerwesterbo/godns/internal/testutil/valkeytest"
+)
+
+func TestUpdateZoneRecordsConcurrent(t *testing.T) {
+	ctx := context.Background()
+	client := valkeytest.NewSlowValkey()
+	zoneService := v1zoneservice.NewV1ZoneService(client, nil, nil)
+	zone := &models.DNSZone{
+		Domain: "example.lan.",
+		Records: []models.DNSRecord{
+			models.NewSOARecord("example.lan.", "ns1.example.lan.", "hostmaster.example.lan.", 2024110601, 3600, 1800, 604800, 60, 3600),
+			models.NewNSRecord("example.lan.", "ns1.example.lan.", 3600),
+		},
+	}
+	if err := zoneService.CreateZone(ctx, zone); err != nil {
+		t.Fatalf("CreateZone() error = %v", err)
+	}
+
+	// Services created apart share the zone service's locks, and instances sharing
+	// a Valkey share the zone's lock in it
+	instances := []*v1zoneservice.V1ZoneService{zoneService, v1zoneservice.NewV1ZoneService(client, nil, nil)}
+	const updates = 20
+	var wg sync.WaitGroup
+	for i := range updates {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s := NewV1RecordService(instances[i%len(instances)])
+			_, err := s.UpdateZoneRecords(ctx, "example.lan.", func(zone *models.DNSZone) error {
+				zone.Records = append(zone.Records, models.NewARecord(fmt.Sprintf("host%d.example.lan.", i), fmt.Sprintf("192.168.100.%d", i+1), 300))
+				return nil
+			})
+			if err != nil {
+				t.Errorf("UpdateZoneRecords(%d) error = %v", i, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	got, err := zoneService.GetZone(ctx, "example.lan.")
+	if err != nil {
+		t.Fatalf("GetZone() error = %v", err)
+	}
+	for i := range updates {
+		if len(models.FilterRecordSet(got.Records, fmt.Sprintf("host%d.example.lan.", i), "A")) != 1 {
+			t.Errorf("record host%d.example.lan. was lost", i)
+		}
+	}
+	if !models.SerialGreater(got.SOASerial(), 2024110601) {
+		t.Errorf("SOA serial %d was not bumped", got.SOASerial())
+	}
+}
+
+func TestConcurrentChangesJournalSerials(t *testing.T) {
+	ctx := context.Background()
+	client := valkeytest.NewSlowValkey()
+	zoneService := v1zoneservice.NewV1ZoneService(client, nil, nil)
+	zone := &models.DNSZone{
+		Domain: "example.lan.",
+		Records: []models.DNSRecord{
+			models.NewSOARecord("example.lan.", "ns1.example.lan.", "hostmaster.example.lan.", 2024110601, 3600, 1800, 604800, 60, 3600),
+			models.NewNSRecord("example.lan.", "ns1.example.lan.", 3600),
+		},
+	}
+	if err := zoneService.CreateZone(ctx, zone); err != nil {
+		t.Fatalf("CreateZone() error = %v", err)
+	}
+
+	// Record changes and zone changes bump the serial and journal each change in the same order
+	const changes = 10
+	var wg sync.WaitGroup
+	for i := range changes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var err error
+			if i%2 == 0 {
+				record := models.NewARecord(fmt.Sprintf("host%d.example.lan.", i), fmt.Sprintf("192.168.100.%d", i+1), 300)
+				err = NewV1RecordService(zoneService).CreateRecord(ctx, "example.lan.", "", &record)
+			} else {
+				err = zoneService.SetZoneEnabled(ctx, "example.lan.", true)
+			}
+			if err != nil {
+				t.Errorf("change %d error = %v", i, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	got, err := zoneService.GetZone(ctx, "example.lan.")
+	if err != nil {
+		t.Fatalf("GetZone() error = %v", err)
+	}
+	entries, ok, err := v1zonejournal.NewJournal(client).Changes(ctx, "example.lan.", 2024110601, got.SOASerial())
+	if err != nil || !ok {
+		t.Fatalf("Changes() = %v, %v, want a chain up to serial %d", ok, err, got.SOASerial())
+	}
+	if len(entries) != changes {
+		t.Errorf("journal has %d changes, want %d", len(entries), changes)
+	}
+}
@@ -0,0 +1,53 @@
+package v1resolverservice
+
+import (
+	"fmt"
+
+	"github.com/miekg/dns"
+)
+
+// rootServers are the root name servers with their addresses, as published by IANA
+// (https://www.internic.net/domain/named.root). They are only used to find the current
+// root servers when the resolver starts (priming, RFC 9609).
+var rootServers = []struct {
+	name string
+	ipv4 string
+	ipv6 string
+}{
+	{"a.root-servers.net.", "198.41.0.4", "2001:503:ba3e::2:30"},
+	{"b.root-servers.net.", "170.247.170.2", "2801:1b8:10::b"},
+	{"c.root-servers.net.", "192.33.4.12", "2001:500:2::c"},
+	{"d.root-servers.net.", "199.7.91.13", "2001:500:2d::d"},
+	{"e.root-servers.net.", "192.203.230.10", "2001:500:a8::e"},
+	{"f.root-servers.net.", "192.5.5.241", "2001:500:2f::f"},
+	{"g.root-servers.net.", "192.112.36.4", "2001:500:12::d0d"},
+	{"h.root-servers.net.", "198.97.190.53", "2001:500:1::53"},
+	{"i.root-servers.net.", "192.36.148.17", "2001:7fe::53"},
+	{"j.root-servers.net.", "192.58.128.30", "2001:503:c27::2:30"},
+	{"k.root-servers.net.", "193.0.14.129", "2001:7fd::1"},
+	{"l.root-servers.net.", "199.7.83.42", "2001:500:9f::42"},
+	{"m.root-servers.net.", "202.12.27.33", "2001:dc3::35"},
+}
+
+// rootHints returns the built-in delegation of the root zone
+func rootHints() *delegation {
+	d := &delegation{zone: "."}
+	for _, server := range rootServers {
+		for _, s := range []string{
+			fmt.Sprintf(". 3600000 IN NS %s", server.name),
+			fmt.Sprintf("%s 3600000 IN A %s", server.name, server.ipv4),
+			fmt.Sprintf("%s 3600000 IN AAAA %s", server.name, server.ipv6),
+		} {
+			rr, err := dns.NewRR(s)
+			if err != nil {
+				panic(err)
+			}
+			if rr.Header().Rrtype == dns.TypeNS {
+				d.ns = append(d.ns, rr)
+			} else {
+				d.glue = append(d.glue, rr)
+			}
+		}
+	}
+	return d
+}
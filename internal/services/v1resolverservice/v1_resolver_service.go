@@ -0,0 +1,542 @@
+package v1resolverservice
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/rogerwesterbo/godns/internal/services/v1cacheservice"
+	"github.com/vitistack/common/pkg/loggers/vlog"
+)
+
+const (
+	// queryTimeout is how long an authoritative server gets to answer a query
+	queryTimeout = 2 * time.Second
+
+	// ednsBufferSize is the UDP payload size of queries to authoritative servers
+	ednsBufferSize = 1232
+
+	// Limits per client query, so broken or malicious zones can't keep the resolver busy
+	maxReferrals  = 30  // referrals and minimised queries while looking up one name
+	maxQueries    = 100 // queries sent to authoritative servers
+	maxDepth      = 4   // nested lookups of name server addresses
+	maxGluelessNS = 3   // name servers without glue whose addresses are looked up (NXNS attack)
+	maxCNAMEChain = 8   // CNAME records followed
+	maxMinimise   = 10  // minimised queries before the full name is asked (RFC 9156 section 2.3)
+
+	// delegationKeySuffix follows the zone name in the cache keys of delegations
+	delegationKeySuffix = ":NS:delegation"
+)
+
+// V1ResolverService resolves queries iteratively, starting at the root servers, instead of
+// forwarding them to an upstream server. Referrals are followed down to the authoritative
+// servers of a name. Glue is only accepted from servers of the zone it belongs to (bailiwick),
+// servers are only asked for the part of the name they need to know (QNAME minimisation,
+// RFC 9156) and the letters of names are sent in random case (0x20), which spoofed responses
+// can't repeat. The name servers of zones and their glue are kept in the DNS cache.
+type V1ResolverService struct {
+	cache             *v1cacheservice.DNSCache
+	qnameMinimisation bool
+	ipv6              bool
+	hints             *delegation
+	// query sends a query to an authoritative server over udp or tcp
+	query func(ctx context.Context, m *dns.Msg, network, server string) (*dns.Msg, error)
+}
+
+// NewV1ResolverService creates a recursive resolver that keeps delegations in the DNS cache
+// IPv6 addresses of name servers are only used when ipv6 is set.
+func NewV1ResolverService(cache *v1cacheservice.DNSCache, qnameMinimisation, ipv6 bool) *V1ResolverService {
+	return &V1ResolverService{
+		cache:             cache,
+		qnameMinimisation: qnameMinimisation,
+		ipv6:              ipv6,
+		hints:             rootHints(),
+		query:             send,
+	}
+}
+
+// send sends a query to a server with a new DNS client
+func send(ctx context.Context, m *dns.Msg, network, server string) (*dns.Msg, error) {
+	client := &dns.Client{Net: network, Timeout: queryTimeout, UDPSize: ednsBufferSize}
+	resp, _, err := client.ExchangeContext(ctx, m, server)
+	return resp, err
+}
+
+// delegation is a zone with its name servers and their addresses (glue)
+type delegation struct {
+	zone string
+	ns   []dns.RR
+	glue []dns.RR
+}
+
+// resolution is the state of the resolution of one client query
+type resolution struct {
+	s       *V1ResolverService
+	do      bool
+	queries int
+	depth   int
+}
+
+// Resolve resolves a query and returns the response for the client
+// When no authoritative server can be reached the response is SERVFAIL, with the No Reachable
+// Authority extended error for clients with EDNS (RFC 8914).
+func (s *V1ResolverService) Resolve(ctx context.Context, query *dns.Msg) (*dns.Msg, error) {
+	m := new(dns.Msg)
+	m.SetReply(query)
+	m.RecursionAvailable = true
+	if len(query.Question) != 1 {
+		m.Rcode = dns.RcodeFormatError
+		return m, nil
+	}
+
+	q := query.Question[0]
+	opt := query.IsEdns0()
+	r := &resolution{s: s, do: opt != nil && opt.Do()}
+	resp, err := r.resolve(ctx, q.Name, q.Qtype)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		vlog.Debugf("failed to resolve %s %s: %v", q.Name, dns.TypeToString[q.Qtype], err)
+		m.Rcode = dns.RcodeServerFailure
+	} else {
+		m.Rcode = resp.Rcode
+		m.Answer = resp.Answer
+		m.Ns = resp.Ns
+	}
+
+	if opt != nil {
+		m.SetEdns0(ednsBufferSize, r.do)
+		if err != nil {
+			edns := m.IsEdns0()
+			edns.Option = append(edns.Option, &dns.EDNS0_EDE{InfoCode: dns.ExtendedErrorCodeNoReachableAuthority, ExtraText: err.Error()})
+		}
+	}
+	return m, nil
+}
+
+// resolve looks up a name and follows the CNAME records in the answers
+// The authority section is only kept for negative answers.
+func (r *resolution) resolve(ctx context.Context, name string, qtype uint16) (*dns.Msg, error) {
+	var answer []dns.RR
+	for range maxCNAMEChain {
+		resp, err := r.lookup(ctx, name, qtype)
+		if err != nil {
+			return nil, err
+		}
+		if len(resp.Answer) > 0 {
+			resp.Ns = nil
+		}
+		answer = append(answer, resp.Answer...)
+
+		target := cnameTarget(resp.Answer, name, qtype)
+		if target == "" || resp.Rcode != dns.RcodeSuccess {
+			resp.Answer = answer
+			return resp, nil
+		}
+		name = target
+	}
+	return nil, fmt.Errorf("more than %d CNAME records for %s", maxCNAMEChain, name)
+}
+
+// lookup asks the authoritative servers of a name, following referrals down from the closest
+// known delegation. DS records are asked from the servers of the parent zone.
+func (r *resolution) lookup(ctx context.Context, qname string, qtype uint16) (*dns.Msg, error) {
+	name := dns.CanonicalName(qname)
+	if qtype == dns.TypeDS && name != "." {
+		name = parent(name)
+	}
+
+	d := r.closestDelegation(ctx, name)
+	labels := dns.CountLabel(qname)
+	next := dns.CountLabel(d.zone) + 1
+	minimised := 0
+	for range maxReferrals {
+		// With QNAME minimisation the servers are asked for one label below their zone,
+		// until the zone cut above the name has been found
+		qn, qt := qname, qtype
+		if r.s.qnameMinimisation && next < labels && minimised < maxMinimise {
+			qn, qt = lastLabels(qname, next), dns.TypeA
+			minimised++
+		}
+
+		resp, err := r.ask(ctx, d, qn, qt)
+		if child := referral(resp, d.zone, name); child != nil {
+			d = child
+			r.s.cacheDelegation(ctx, d)
+			next = dns.CountLabel(d.zone) + 1
+			continue
+		}
+
+		if qn != qname {
+			if err == nil && resp.Rcode == dns.RcodeSuccess {
+				// No zone cut here, the same servers are asked for the next label
+				next++
+			} else {
+				// Some servers answer NXDOMAIN for names without records of their own
+				// and others fail, so the full name is asked instead
+				minimised = maxMinimise
+			}
+			continue
+		}
+
+		return resp, err
+	}
+	return nil, fmt.Errorf("more than %d referrals for %s", maxReferrals, qname)
+}
+
+// closestDelegation returns the cached delegation closest to a name, or the root delegation
+func (r *resolution) closestDelegation(ctx context.Context, name string) *delegation {
+	for _, zone := range ancestors(name) {
+		if d := r.s.cachedDelegation(ctx, zone); d != nil {
+			return d
+		}
+	}
+	return r.prime(ctx)
+}
+
+// prime asks the root hints for the current root servers and caches them (RFC 9609)
+func (r *resolution) prime(ctx context.Context) *delegation {
+	resp, err := r.ask(ctx, r.s.hints, ".", dns.TypeNS)
+	if err != nil {
+		vlog.Warnf("failed to prime the root servers, using the root hints: %v", err)
+		return r.s.hints
+	}
+
+	d := &delegation{zone: "."}
+	for _, rr := range resp.Answer {
+		if rr.Header().Rrtype == dns.TypeNS && rr.Header().Name == "." {
+			d.ns = append(d.ns, rr)
+		}
+	}
+	d.glue = glueOf(d.ns, resp.Extra)
+	if len(r.s.addresses(d.glue)) == 0 {
+		return r.s.hints
+	}
+
+	r.s.cacheDelegation(ctx, d)
+	return d
+}
+
+// ask sends a query to the servers of a delegation in random order until one answers
+// Servers that fail, answer SERVFAIL or REFUSED, or aren't authoritative for the zone (lame)
+// are skipped.
+func (r *resolution) ask(ctx context.Context, d *delegation, name string, qtype uint16) (*dns.Msg, error) {
+	servers := r.servers(ctx, d)
+	if len(servers) == 0 {
+		return nil, fmt.Errorf("no addresses for the name servers of %s", d.zone)
+	}
+	rand.Shuffle(len(servers), func(i, j int) { servers[i], servers[j] = servers[j], servers[i] })
+
+	var lastErr error
+	for _, server := range servers {
+		if r.queries >= maxQueries {
+			return nil, fmt.Errorf("more than %d queries to resolve a name", maxQueries)
+		}
+		r.queries++
+
+		resp, err := r.exchange(ctx, server, name, qtype)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			lastErr = err
+			continue
+		}
+		if resp.Rcode != dns.RcodeSuccess && resp.Rcode != dns.RcodeNameError {
+			lastErr = fmt.Errorf("%s answered %s", server, dns.RcodeToString[resp.Rcode])
+			continue
+		}
+
+		scrub(resp, d.zone)
+		if !resp.Authoritative && len(resp.Answer) == 0 && referral(resp, d.zone, name) == nil {
+			lastErr = fmt.Errorf("%s is not authoritative for %s", server, d.zone)
+			continue
+		}
+		return resp, nil
+	}
+	return nil, fmt.Errorf("no name server of %s answered %s: %w", d.zone, name, lastErr)
+}
+
+// servers returns the addresses of the name servers of a delegation
+// Without usable glue, the addresses of a few name servers outside the zone are looked up
+// and kept as the glue of the delegation.
+func (r *resolution) servers(ctx context.Context, d *delegation) []string {
+	if addrs := r.s.addresses(d.glue); len(addrs) > 0 || r.depth >= maxDepth {
+		return addrs
+	}
+
+	var glue []dns.RR
+	looked := 0
+	for _, rr := range d.ns {
+		ns, ok := rr.(*dns.NS)
+		if !ok || dns.IsSubDomain(d.zone, ns.Ns) {
+			// Name servers inside the zone can only be reached with glue
+			continue
+		}
+		if looked == maxGluelessNS {
+			break
+		}
+		looked++
+
+		glue = append(glue, r.lookupAddresses(ctx, ns.Ns)...)
+		if len(r.s.addresses(glue)) > 0 {
+			break
+		}
+	}
+
+	if len(glue) > 0 {
+		d.glue = glue
+		r.s.cacheDelegation(ctx, d)
+	}
+	return r.s.addresses(glue)
+}
+
+// lookupAddresses resolves the addresses of a name server as glue
+func (r *resolution) lookupAddresses(ctx context.Context, name string) []dns.RR {
+	r.depth++
+	defer func() { r.depth-- }()
+
+	qtypes := []uint16{dns.TypeA}
+	if r.s.ipv6 {
+		qtypes = append(qtypes, dns.TypeAAAA)
+	}
+
+	var glue []dns.RR
+	for _, qtype := range qtypes {
+		resp, err := r.resolve(ctx, name, qtype)
+		if err != nil {
+			vlog.Debugf("failed to resolve name server %s: %v", name, err)
+			continue
+		}
+		for _, rr := range resp.Answer {
+			if rr.Header().Rrtype == qtype {
+				rr = dns.Copy(rr)
+				rr.Header().Name = name
+				glue = append(glue, rr)
+			}
+		}
+	}
+	return glue
+}
+
+// exchange sends a query to a server with the letters of the name in random case (0x20)
+// Responses that don't repeat the question exactly may be spoofed, so the query is sent again
+// over TCP, as are truncated ones. Names in the response get the case of name back.
+func (r *resolution) exchange(ctx context.Context, server, name string, qtype uint16) (*dns.Msg, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(randomCase(name), qtype)
+	m.RecursionDesired = false
+	m.SetEdns0(ednsBufferSize, r.do)
+
+	resp, err := r.s.query(ctx, m, "udp", server)
+	if err == nil && (resp.Truncated || !sameQuestion(m, resp, true)) {
+		m.Id = dns.Id()
+		resp, err = r.s.query(ctx, m, "tcp", server)
+		if err == nil && !sameQuestion(m, resp, false) {
+			err = fmt.Errorf("%s answered another question than %s", server, name)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	resp.Question = []dns.Question{{Name: name, Qtype: qtype, Qclass: dns.ClassINET}}
+	for _, section := range [][]dns.RR{resp.Answer, resp.Ns, resp.Extra} {
+		for _, rr := range section {
+			if strings.EqualFold(rr.Header().Name, name) {
+				rr.Header().Name = name
+			}
+		}
+	}
+	return resp, nil
+}
+
+// cachedDelegation returns the delegation of a zone from the cache
+func (s *V1ResolverService) cachedDelegation(ctx context.Context, zone string) *delegation {
+	m, found := s.cache.Get(ctx, zone+delegationKeySuffix)
+	if !found {
+		return nil
+	}
+	return &delegation{zone: zone, ns: m.Ns, glue: m.Extra}
+}
+
+// cacheDelegation keeps a delegation in the cache for the TTL of its NS records
+func (s *V1ResolverService) cacheDelegation(ctx context.Context, d *delegation) {
+	m := new(dns.Msg)
+	m.Ns = d.ns
+	m.Extra = d.glue
+	s.cache.Set(ctx, d.zone+delegationKeySuffix, m)
+}
+
+// addresses returns the server addresses of glue records
+func (s *V1ResolverService) addresses(glue []dns.RR) []string {
+	var addrs []string
+	for _, rr := range glue {
+		switch rr := rr.(type) {
+		case *dns.A:
+			addrs = append(addrs, net.JoinHostPort(rr.A.String(), "53"))
+		case *dns.AAAA:
+			if s.ipv6 {
+				addrs = append(addrs, net.JoinHostPort(rr.AAAA.String(), "53"))
+			}
+		}
+	}
+	return addrs
+}
+
+// referral returns the delegation in a response when it refers to a zone below the zone of the
+// server that contains name
+func referral(resp *dns.Msg, zone, name string) *delegation {
+	if resp == nil || resp.Rcode != dns.RcodeSuccess || len(resp.Answer) > 0 {
+		return nil
+	}
+
+	d := &delegation{}
+	for _, rr := range resp.Ns {
+		if rr.Header().Rrtype != dns.TypeNS {
+			continue
+		}
+		owner := dns.CanonicalName(rr.Header().Name)
+		if owner == zone || !dns.IsSubDomain(zone, owner) || !dns.IsSubDomain(owner, name) {
+			continue
+		}
+		if d.zone == "" {
+			d.zone = owner
+		}
+		if owner == d.zone {
+			d.ns = append(d.ns, rr)
+		}
+	}
+	if d.zone == "" {
+		return nil
+	}
+
+	d.glue = glueOf(d.ns, resp.Extra)
+	return d
+}
+
+// glueOf returns the address records of name servers
+func glueOf(ns, extra []dns.RR) []dns.RR {
+	names := make(map[string]bool, len(ns))
+	for _, rr := range ns {
+		if ns, ok := rr.(*dns.NS); ok {
+			names[dns.CanonicalName(ns.Ns)] = true
+		}
+	}
+
+	var glue []dns.RR
+	for _, rr := range extra {
+		switch rr.(type) {
+		case *dns.A, *dns.AAAA:
+			if names[dns.CanonicalName(rr.Header().Name)] {
+				glue = append(glue, rr)
+			}
+		}
+	}
+	return glue
+}
+
+// scrub removes the records for names outside the zone of the server from a response
+// (bailiwick), so servers can't plant records for names they aren't authoritative for
+func scrub(resp *dns.Msg, zone string) {
+	resp.Answer = inZone(resp.Answer, zone)
+	resp.Ns = inZone(resp.Ns, zone)
+	resp.Extra = inZone(resp.Extra, zone)
+}
+
+// inZone returns the records at or below a zone, and the OPT record
+func inZone(rrs []dns.RR, zone string) []dns.RR {
+	kept := rrs[:0]
+	for _, rr := range rrs {
+		if rr.Header().Rrtype == dns.TypeOPT || dns.IsSubDomain(zone, rr.Header().Name) {
+			kept = append(kept, rr)
+		}
+	}
+	return kept
+}
+
+// cnameTarget returns the name an answer continues at: the end of the CNAME chain starting at
+// name when the answer has no records of the type for it, or "" when the answer is complete
+func cnameTarget(answer []dns.RR, name string, qtype uint16) string {
+	if qtype == dns.TypeCNAME {
+		return ""
+	}
+
+	target := ""
+	for range maxCNAMEChain {
+		next := ""
+		for _, rr := range answer {
+			if !strings.EqualFold(rr.Header().Name, name) {
+				continue
+			}
+			if rr.Header().Rrtype == qtype {
+				return ""
+			}
+			if cname, ok := rr.(*dns.CNAME); ok {
+				next = cname.Target
+			}
+		}
+		if next == "" {
+			break
+		}
+		name, target = next, next
+	}
+	return target
+}
+
+// sameQuestion reports whether a response answers the question of a query, with the same
+// case of the name when exact is set
+func sameQuestion(query, resp *dns.Msg, exact bool) bool {
+	if len(resp.Question) != 1 {
+		return false
+	}
+	q, a := query.Question[0], resp.Question[0]
+	if q.Qtype != a.Qtype || q.Qclass != a.Qclass {
+		return false
+	}
+	if exact {
+		return q.Name == a.Name
+	}
+	return strings.EqualFold(q.Name, a.Name)
+}
+
+// randomCase flips the case of the letters of a name at random
+func randomCase(name string) string {
+	b := []byte(name)
+	for i, c := range b {
+		if ('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z') && rand.IntN(2) == 0 {
+			b[i] ^= 0x20
+		}
+	}
+	return string(b)
+}
+
+// ancestors returns a name and the names above it, up to the root
+func ancestors(name string) []string {
+	names := []string{name}
+	for name != "." {
+		name = parent(name)
+		names = append(names, name)
+	}
+	return names
+}
+
+// parent returns the name one label above a name
+func parent(name string) string {
+	off, end := dns.NextLabel(name, 0)
+	if end {
+		return "."
+	}
+	return name[off:]
+}
+
+// lastLabels returns the last n labels of a name
+func lastLabels(name string, n int) string {
+	offsets := dns.Split(name)
+	return name[offsets[len(offsets)-n]:]
+}
@@ -0,0 +1,287 @@
+package v1resolverservice
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/rogerwesterbo/godns/internal/services/v1cacheservice"
+)
+
+// fakeServer answers queries for a zone like an authoritative server
+type fakeServer struct {
+	zone    string
+	records []dns.RR
+	// extra records are added to every response, like a poisoning attempt
+	extra []dns.RR
+	// lowercase servers don't repeat the case of the question
+	lowercase bool
+}
+
+func (f *fakeServer) answer(query *dns.Msg) *dns.Msg {
+	resp := new(dns.Msg)
+	resp.SetReply(query)
+	name, qtype := dns.CanonicalName(query.Question[0].Name), query.Question[0].Qtype
+	if f.lowercase {
+		resp.Question[0].Name = name
+	}
+	defer func() { resp.Extra = append(resp.Extra, f.extra...) }()
+
+	// Names below a child zone are referred to its name servers
+	for _, rr := range f.records {
+		owner := rr.Header().Name
+		if rr.Header().Rrtype != dns.TypeNS || owner == f.zone || !dns.IsSubDomain(owner, name) || (owner == name && qtype == dns.TypeDS) {
+			continue
+		}
+		for _, rr := range f.records {
+			if rr.Header().Rrtype == dns.TypeNS && rr.Header().Name == owner {
+				resp.Ns = append(resp.Ns, rr)
+			}
+		}
+		resp.Extra = append(resp.Extra, f.glue(resp.Ns)...)
+		return resp
+	}
+
+	resp.Authoritative = true
+	exists := false
+	for _, rr := range f.records {
+		if dns.IsSubDomain(name, rr.Header().Name) {
+			exists = true
+		}
+		if rr.Header().Name == name && (rr.Header().Rrtype == qtype || rr.Header().Rrtype == dns.TypeCNAME) {
+			rr = dns.Copy(rr)
+			rr.Header().Name = resp.Question[0].Name
+			resp.Answer = append(resp.Answer, rr)
+		}
+	}
+	resp.Extra = append(resp.Extra, f.glue(resp.Answer)...)
+	if len(resp.Answer) == 0 {
+		if !exists {
+			resp.Rcode = dns.RcodeNameError
+		}
+		soa, _ := dns.NewRR(f.zone + " 300 IN SOA ns. hostmaster. 1 3600 600 86400 300")
+		resp.Ns = append(resp.Ns, soa)
+	}
+	return resp
+}
+
+// glue returns the address records of the name servers in NS records
+func (f *fakeServer) glue(rrs []dns.RR) []dns.RR {
+	var glue []dns.RR
+	for _, rr := range rrs {
+		if ns, ok := rr.(*dns.NS); ok {
+			for _, a := range f.records {
+				if a.Header().Name == ns.Ns && a.Header().Rrtype == dns.TypeA {
+					glue = append(glue, a)
+				}
+			}
+		}
+	}
+	return glue
+}
+
+// fakeNetwork routes queries to fake servers by address and records them
+type fakeNetwork struct {
+	mu      sync.Mutex
+	servers map[string]*fakeServer
+	log     []string
+}
+
+func (n *fakeNetwork) query(ctx context.Context, m *dns.Msg, network, server string) (*dns.Msg, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	q := m.Question[0]
+	n.log = append(n.log, fmt.Sprintf("%s %s %s %s", network, server, dns.CanonicalName(q.Name), dns.TypeToString[q.Qtype]))
+	f, ok := n.servers[server]
+	if !ok {
+		return nil, fmt.Errorf("no route to %s", server)
+	}
+	return f.answer(m), nil
+}
+
+func (n *fakeNetwork) reset() []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	log := n.log
+	n.log = nil
+	return log
+}
+
+func records(t *testing.T, rrs ...string) []dns.RR {
+	t.Helper()
+	var parsed []dns.RR
+	for _, s := range rrs {
+		rr, err := dns.NewRR(s)
+		if err != nil {
+			t.Fatalf("NewRR(%q) error = %v", s, err)
+		}
+		parsed = append(parsed, rr)
+	}
+	return parsed
+}
+
+// newTestResolver returns a resolver for a small hierarchy of fake servers:
+// the root, com. and net., example.com. with glue and example.net. without glue
+func newTestResolver(t *testing.T, qnameMinimisation bool) (*V1ResolverService, *fakeNetwork) {
+	network := &fakeNetwork{servers: map[string]*fakeServer{
+		"192.0.2.1:53": {zone: ".", records: records(t,
+			". 86400 IN NS a.root.test.",
+			"a.root.test. 86400 IN A 192.0.2.1",
+			"com. 86400 IN NS a.gtld.test.",
+			"a.gtld.test. 86400 IN A 192.0.2.2",
+			"net. 86400 IN NS b.gtld.test.",
+			"b.gtld.test. 86400 IN A 192.0.2.4",
+		)},
+		"192.0.2.2:53": {zone: "com.", records: records(t,
+			"example.com. 3600 IN NS ns1.example.com.",
+			"example.com. 3600 IN NS ns2.example.org.",
+			"ns1.example.com. 3600 IN A 192.0.2.3",
+			"example.com. 3600 IN DS 12345 13 2 0123456789ABCDEF0123456789ABCDEF0123456789ABCDEF0123456789ABCDEF",
+		), extra: records(t,
+			// Not in the bailiwick of com.
+			"ns2.example.org. 3600 IN A 203.0.113.66",
+		)},
+		"192.0.2.4:53": {zone: "net.", records: records(t,
+			"example.net. 3600 IN NS ns1.example.com.",
+		)},
+		"192.0.2.3:53": {zone: "example.com.", lowercase: true, records: records(t,
+			"example.com. 3600 IN NS ns1.example.com.",
+			"ns1.example.com. 3600 IN A 192.0.2.3",
+			"www.example.com. 300 IN A 198.51.100.1",
+			"alias.example.com. 300 IN CNAME www.example.net.",
+			"a.b.c.d.example.com. 300 IN A 198.51.100.2",
+			// example.net. is served by the same server
+			"www.example.net. 300 IN A 198.51.100.3",
+		)},
+	}}
+
+	s := NewV1ResolverService(v1cacheservice.NewDNSCache(100, time.Hour), qnameMinimisation, false)
+	s.hints = &delegation{zone: ".", ns: records(t, ". 86400 IN NS a.root.test."), glue: records(t, "a.root.test. 86400 IN A 192.0.2.1")}
+	s.query = network.query
+	return s, network
+}
+
+func resolve(t *testing.T, s *V1ResolverService, name string, qtype uint16) *dns.Msg {
+	t.Helper()
+	q := new(dns.Msg)
+	q.SetQuestion(name, qtype)
+	resp, err := s.Resolve(context.Background(), q)
+	if err != nil {
+		t.Fatalf("Resolve(%s) error = %v", name, err)
+	}
+	return resp
+}
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		name      string
+		qname     string
+		qtype     uint16
+		wantRcode int
+		want      []string
+	}{
+		{"referrals", "www.example.com.", dns.TypeA, dns.RcodeSuccess, []string{"www.example.com.\t300\tIN\tA\t198.51.100.1"}},
+		{"case of the question", "WWW.Example.COM.", dns.TypeA, dns.RcodeSuccess, []string{"WWW.Example.COM.\t300\tIN\tA\t198.51.100.1"}},
+		{"empty non-terminals", "a.b.c.d.example.com.", dns.TypeA, dns.RcodeSuccess, []string{"a.b.c.d.example.com.\t300\tIN\tA\t198.51.100.2"}},
+		{"CNAME to a glueless zone", "alias.example.com.", dns.TypeA, dns.RcodeSuccess, []string{
+			"alias.example.com.\t300\tIN\tCNAME\twww.example.net.",
+			"www.example.net.\t300\tIN\tA\t198.51.100.3",
+		}},
+		{"DS from the parent", "example.com.", dns.TypeDS, dns.RcodeSuccess, []string{
+			"example.com.\t3600\tIN\tDS\t12345 13 2 0123456789ABCDEF0123456789ABCDEF0123456789ABCDEF0123456789ABCDEF",
+		}},
+		{"NXDOMAIN", "missing.example.com.", dns.TypeA, dns.RcodeNameError, nil},
+	}
+
+	for _, minimisation := range []bool{true, false} {
+		s, _ := newTestResolver(t, minimisation)
+		for _, tt := range tests {
+			t.Run(fmt.Sprintf("%s minimisation=%t", tt.name, minimisation), func(t *testing.T) {
+				resp := resolve(t, s, tt.qname, tt.qtype)
+				if resp.Rcode != tt.wantRcode {
+					t.Fatalf("Rcode = %s, want %s", dns.RcodeToString[resp.Rcode], dns.RcodeToString[tt.wantRcode])
+				}
+				var got []string
+				for _, rr := range resp.Answer {
+					got = append(got, rr.String())
+				}
+				if !slices.Equal(got, tt.want) {
+					t.Errorf("Answer = %q, want %q", got, tt.want)
+				}
+				if !resp.RecursionAvailable {
+					t.Error("RecursionAvailable not set")
+				}
+			})
+		}
+	}
+}
+
+func TestResolveQueries(t *testing.T) {
+	tests := []struct {
+		name         string
+		minimisation bool
+		want         []string
+	}{
+		{"QNAME minimisation", true, []string{
+			"udp 192.0.2.1:53 . NS",
+			"udp 192.0.2.1:53 com. A",
+			"udp 192.0.2.2:53 example.com. A",
+			// The server doesn't repeat the case of the question, so it's asked again over TCP
+			"udp 192.0.2.3:53 www.example.com. A",
+			"tcp 192.0.2.3:53 www.example.com. A",
+		}},
+		{"full names", false, []string{
+			"udp 192.0.2.1:53 . NS",
+			"udp 192.0.2.1:53 www.example.com. A",
+			"udp 192.0.2.2:53 www.example.com. A",
+			"udp 192.0.2.3:53 www.example.com. A",
+			"tcp 192.0.2.3:53 www.example.com. A",
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, network := newTestResolver(t, tt.minimisation)
+			resolve(t, s, "www.example.com.", dns.TypeA)
+			if got := network.reset(); !slices.Equal(got, tt.want) {
+				t.Errorf("queries = %q, want %q", got, tt.want)
+			}
+
+			// The delegation of example.com. is cached, without the glue out of bailiwick
+			resolve(t, s, "www.example.com.", dns.TypeMX)
+			if got := network.reset(); len(got) != 2 || !strings.HasPrefix(got[0], "udp 192.0.2.3:53 ") {
+				t.Errorf("queries after caching = %q, want only example.com. asked", got)
+			}
+			d := s.cachedDelegation(context.Background(), "example.com.")
+			if d == nil || !slices.Equal(s.addresses(d.glue), []string{"192.0.2.3:53"}) {
+				t.Errorf("cached delegation = %+v, want only the glue of ns1.example.com.", d)
+			}
+		})
+	}
+}
+
+func TestResolveUnreachable(t *testing.T) {
+	s, network := newTestResolver(t, true)
+	network.servers = nil
+
+	q := new(dns.Msg)
+	q.SetQuestion("www.example.com.", dns.TypeA)
+	q.SetEdns0(1232, true)
+	resp, err := s.Resolve(context.Background(), q)
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	if resp.Rcode != dns.RcodeServerFailure {
+		t.Errorf("Rcode = %s, want SERVFAIL", dns.RcodeToString[resp.Rcode])
+	}
+	opt := resp.IsEdns0()
+	if opt == nil || len(opt.Option) != 1 || opt.Option[0].(*dns.EDNS0_EDE).InfoCode != dns.ExtendedErrorCodeNoReachableAuthority {
+		t.Errorf("OPT = %v, want the No Reachable Authority extended error", opt)
+	}
+}
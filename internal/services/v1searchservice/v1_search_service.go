@@ -22,6 +22,8 @@ type SearchResult struct {
 	Type   SearchResultType  `json:"type" example:"zone"`                  // Type of result (zone, record)
 	Zone   string            `json:"zone,omitempty" example:"example.lan"` // Zone name
 	Record *models.DNSRecord `json:"record,omitempty"`                     // Record details (if type is record)
+	// Wildcard is set when the record was matched because its wildcard name covers the query
+	Wildcard bool `json:"wildcard,omitempty" example:"false"`
 }
 
 // SearchResponse represents the search API response
@@ -49,6 +51,9 @@ func NewV1SearchService(zoneService *v1zoneservice.V1ZoneService) *V1SearchServi
 // - Record names
 // - Record values
 // - Record types
+//
+// Wildcard records are also returned when the query is a name they would answer for,
+// e.g. "pr-42.apps.example.lan" finds "*.apps.example.lan.".
 func (s *V1SearchService) Search(ctx context.Context, query string, types []SearchResultType) (*SearchResponse, error) {
 	if query == "" {
 		return &SearchResponse{
@@ -96,6 +101,13 @@ func (s *V1SearchService) Search(ctx context.Context, query string, types []Sear
 						Zone:   zone.Domain,
 						Record: &record,
 					})
+				} else if record.MatchesWildcard(normalizedQuery) {
+					results = append(results, SearchResult{
+						Type:     SearchResultTypeRecord,
+						Zone:     zone.Domain,
+						Record:   &record,
+						Wildcard: true,
+					})
 				}
 			}
 		}
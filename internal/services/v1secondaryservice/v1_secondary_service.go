@@ -0,0 +1,448 @@
+package v1secondaryservice
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/rogerwesterbo/godns/internal/models"
+	"github.com/rogerwesterbo/godns/internal/services/v1zoneservice"
+	"github.com/vitistack/common/pkg/loggers/vlog"
+)
+
+// SecondaryService keeps secondary zones in sync with their primaries
+// Zones are refreshed when their SOA refresh timer fires, retried after the SOA
+// retry interval when no primary answers, and stop being served once the SOA
+// expire time has passed without a successful refresh. NOTIFY messages from a
+// primary trigger an immediate refresh.
+type SecondaryService struct {
+	zoneService   *v1zoneservice.V1ZoneService
+	timeout       time.Duration
+	checkInterval time.Duration
+	now           func() time.Time
+
+	triggers chan string
+
+	mu         sync.Mutex
+	refreshing map[string]bool
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewSecondaryService creates a new secondary zone service
+// timeout applies to SOA queries and to each message of a zone transfer.
+func NewSecondaryService(zoneService *v1zoneservice.V1ZoneService, timeout time.Duration, checkInterval time.Duration) *SecondaryService {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &SecondaryService{
+		zoneService:   zoneService,
+		timeout:       timeout,
+		checkInterval: checkInterval,
+		now:           time.Now,
+		triggers:      make(chan string, 64),
+		refreshing:    make(map[string]bool),
+		ctx:           ctx,
+		cancel:        cancel,
+	}
+}
+
+// Start begins refreshing secondary zones in the background
+func (s *SecondaryService) Start() {
+	s.wg.Add(1)
+	go s.run()
+	vlog.Infof("Secondary zone refresh started (check interval: %v)", s.checkInterval)
+}
+
+// Stop stops the background refresh and waits for running refreshes to finish
+func (s *SecondaryService) Stop() {
+	s.cancel()
+	s.wg.Wait()
+}
+
+// Trigger schedules an immediate refresh of a zone
+// It never blocks; a trigger is dropped when too many are already queued.
+func (s *SecondaryService) Trigger(domain string) {
+	if s == nil {
+		return
+	}
+	select {
+	case s.triggers <- dns.CanonicalName(domain):
+	default:
+		vlog.Warnf("refresh queue full, dropping refresh of zone %s", domain)
+	}
+}
+
+// IsPrimary reports whether addr is one of the primaries of a secondary zone
+func (s *SecondaryService) IsPrimary(ctx context.Context, domain string, addr netip.Addr) bool {
+	zone, err := s.zoneService.GetZone(ctx, dns.CanonicalName(domain))
+	if err != nil || !zone.IsSecondary() {
+		return false
+	}
+
+	addr = addr.Unmap()
+	for _, primary := range zone.Primaries {
+		addrPort, err := models.ParseServerAddr(primary)
+		if err == nil && addrPort.Addr().Unmap() == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// Refresh checks the primaries of a secondary zone and transfers the zone when
+// a primary has a newer serial
+// The primaries are tried in order; the first one that answers is used.
+func (s *SecondaryService) Refresh(ctx context.Context, domain string) error {
+	domain = dns.CanonicalName(domain)
+
+	if !s.begin(domain) {
+		return nil
+	}
+	defer s.end(domain)
+
+	zone, err := s.zoneService.GetZone(ctx, domain)
+	if err != nil {
+		return err
+	}
+	if !zone.IsSecondary() {
+		return fmt.Errorf("invalid zone: %s is not a secondary zone", domain)
+	}
+
+	status := models.SecondaryStatus{}
+	if zone.SecondaryStatus != nil {
+		status = *zone.SecondaryStatus
+	}
+	now := s.now()
+	status.LastCheck = now
+
+	var lastErr error
+	for _, primary := range zone.Primaries {
+		records, err := s.refreshFrom(ctx, zone, primary)
+		if err != nil {
+			vlog.Warnf("refresh of zone %s from %s failed: %v", domain, primary, err)
+			lastErr = fmt.Errorf("%s: %w", primary, err)
+			continue
+		}
+
+		if records != nil {
+			zone.Records = records
+			vlog.Infof("Transferred zone %s from %s (serial %d, %d records)", domain, primary, zone.SOASerial(), len(records))
+		}
+
+		refresh, _, _ := soaTimers(zone)
+		status.Loaded = true
+		status.Expired = false
+		status.Primary = primary
+		status.LastRefresh = now
+		status.NextCheck = now.Add(refresh)
+		status.LastError = ""
+
+		return s.zoneService.SaveSecondaryZone(ctx, domain, records, status)
+	}
+
+	if lastErr == nil {
+		lastErr = fmt.Errorf("zone %s has no primaries", domain)
+	}
+
+	_, retry, expire := soaTimers(zone)
+	status.LastError = lastErr.Error()
+	status.NextCheck = now.Add(retry)
+	if status.Loaded && !status.Expired && now.Sub(status.LastRefresh) > expire {
+		vlog.Warnf("zone %s expired: no primary reachable since %s", domain, status.LastRefresh.Format(time.RFC3339))
+		status.Expired = true
+	}
+
+	if err := s.zoneService.SaveSecondaryZone(ctx, domain, nil, status); err != nil {
+		vlog.Warnf("failed to save refresh status of zone %s: %v", domain, err)
+	}
+
+	return lastErr
+}
+
+// refreshFrom refreshes a zone from one primary
+// It returns nil records when the zone is already current.
+func (s *SecondaryService) refreshFrom(ctx context.Context, zone *models.DNSZone, primary string) ([]models.DNSRecord, error) {
+	soa, err := s.querySOA(ctx, zone.Domain, primary)
+	if err != nil {
+		return nil, err
+	}
+
+	loaded := zone.SecondaryStatus != nil && zone.SecondaryStatus.Loaded
+	if loaded && !models.SerialGreater(soa.Serial, zone.SOASerial()) {
+		return nil, nil
+	}
+
+	if loaded {
+		current := zone.SOARecord()
+		currentSOA, err := current.ToRR()
+		if err == nil {
+			rrs, err := s.transfer(zone.Domain, primary, dns.TypeIXFR, currentSOA)
+			if err == nil {
+				var records []models.DNSRecord
+				records, err = applyTransfer(zone.Records, rrs)
+				if err == nil {
+					return records, nil
+				}
+			}
+			vlog.Debugf("IXFR of zone %s from %s failed, falling back to AXFR: %v", zone.Domain, primary, err)
+		}
+	}
+
+	rrs, err := s.transfer(zone.Domain, primary, dns.TypeAXFR, nil)
+	if err != nil {
+		return nil, err
+	}
+	return applyTransfer(nil, rrs)
+}
+
+// querySOA asks a primary for the SOA of a zone, retrying over TCP when truncated
+func (s *SecondaryService) querySOA(ctx context.Context, domain, primary string) (*dns.SOA, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(domain, dns.TypeSOA)
+
+	client := &dns.Client{Net: "udp", Timeout: s.timeout}
+	resp, _, err := client.ExchangeContext(ctx, m, primary)
+	if err == nil && resp.Truncated {
+		client.Net = "tcp"
+		resp, _, err = client.ExchangeContext(ctx, m, primary)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("SOA query failed: %w", err)
+	}
+	if resp.Rcode != dns.RcodeSuccess {
+		return nil, fmt.Errorf("SOA query failed: %s", dns.RcodeToString[resp.Rcode])
+	}
+	if !resp.Authoritative {
+		return nil, fmt.Errorf("primary is not authoritative for %s", domain)
+	}
+
+	for _, rr := range resp.Answer {
+		if soa, ok := rr.(*dns.SOA); ok && strings.EqualFold(soa.Hdr.Name, domain) {
+			return soa, nil
+		}
+	}
+	return nil, fmt.Errorf("no SOA record for %s in answer", domain)
+}
+
+// transfer runs an AXFR or IXFR from a primary and returns all received records
+func (s *SecondaryService) transfer(domain, primary string, qtype uint16, currentSOA dns.RR) ([]dns.RR, error) {
+	m := new(dns.Msg)
+	if qtype == dns.TypeIXFR {
+		m.SetIxfr(domain, currentSOA.(*dns.SOA).Serial, currentSOA.(*dns.SOA).Ns, currentSOA.(*dns.SOA).Mbox)
+	} else {
+		m.SetAxfr(domain)
+	}
+
+	t := &dns.Transfer{DialTimeout: s.timeout, ReadTimeout: s.timeout, WriteTimeout: s.timeout}
+	envelopes, err := t.In(m, primary)
+	if err != nil {
+		return nil, fmt.Errorf("%s failed: %w", dns.TypeToString[qtype], err)
+	}
+
+	var rrs []dns.RR
+	for envelope := range envelopes {
+		if envelope.Error != nil {
+			return nil, fmt.Errorf("%s failed: %w", dns.TypeToString[qtype], envelope.Error)
+		}
+		rrs = append(rrs, envelope.RR...)
+	}
+
+	return rrs, nil
+}
+
+// applyTransfer builds the records of a zone from a zone transfer response
+// A full transfer (AXFR, or an IXFR answered with the whole zone) replaces the
+// records. An incremental IXFR response is applied to current: every difference
+// sequence starts with the old SOA followed by the deleted records, then the new
+// SOA followed by the added records (RFC 1995).
+func applyTransfer(current []models.DNSRecord, rrs []dns.RR) ([]models.DNSRecord, error) {
+	if len(rrs) < 2 {
+		return nil, fmt.Errorf("incomplete zone transfer: %d records", len(rrs))
+	}
+
+	newSOA, ok := rrs[0].(*dns.SOA)
+	if !ok {
+		return nil, fmt.Errorf("zone transfer does not start with a SOA record")
+	}
+	lastSOA, ok := rrs[len(rrs)-1].(*dns.SOA)
+	if !ok || lastSOA.Serial != newSOA.Serial {
+		return nil, fmt.Errorf("incomplete zone transfer: missing closing SOA record")
+	}
+
+	body := rrs[1 : len(rrs)-1]
+
+	// Full zone: SOA, records..., SOA
+	if _, incremental := rrs[1].(*dns.SOA); !incremental || len(rrs) == 2 {
+		return toRecords(append([]dns.RR{newSOA}, body...)), nil
+	}
+
+	zone := make([]dns.RR, 0, len(current))
+	for i := range current {
+		if current[i].Type == "SOA" {
+			continue
+		}
+		rr, err := current[i].ToRR()
+		if err != nil {
+			continue
+		}
+		zone = append(zone, rr)
+	}
+
+	for i := 0; i < len(body); {
+		oldSOA, ok := body[i].(*dns.SOA)
+		if !ok {
+			return nil, fmt.Errorf("invalid incremental zone transfer: expected SOA record, got %s", dns.TypeToString[body[i].Header().Rrtype])
+		}
+		i++
+
+		deleted := make(map[string]bool)
+		for ; i < len(body); i++ {
+			if _, ok := body[i].(*dns.SOA); ok {
+				break
+			}
+			deleted[rrKey(body[i])] = true
+		}
+		if i == len(body) {
+			return nil, fmt.Errorf("invalid incremental zone transfer: difference from serial %d has no new SOA", oldSOA.Serial)
+		}
+		i++ // new SOA of this difference sequence
+
+		kept := zone[:0]
+		for _, rr := range zone {
+			if !deleted[rrKey(rr)] {
+				kept = append(kept, rr)
+			}
+		}
+		zone = kept
+
+		for ; i < len(body); i++ {
+			if _, ok := body[i].(*dns.SOA); ok {
+				break
+			}
+			zone = append(zone, body[i])
+		}
+	}
+
+	return toRecords(append([]dns.RR{newSOA}, zone...)), nil
+}
+
+// toRecords converts transferred resource records, skipping unsupported types
+func toRecords(rrs []dns.RR) []models.DNSRecord {
+	records := make([]models.DNSRecord, 0, len(rrs))
+	for _, rr := range rrs {
+		record, ok := models.RecordFromRR(rr)
+		if !ok {
+			vlog.Debugf("skipping unsupported %s record %s in zone transfer", dns.TypeToString[rr.Header().Rrtype], rr.Header().Name)
+			continue
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+// rrKey identifies a resource record independent of its TTL and name case
+func rrKey(rr dns.RR) string {
+	c := dns.Copy(rr)
+	c.Header().Ttl = 0
+	c.Header().Name = dns.CanonicalName(c.Header().Name)
+	return c.String()
+}
+
+// soaTimers returns the refresh, retry and expire timers of a zone
+func soaTimers(zone *models.DNSZone) (refresh, retry, expire time.Duration) {
+	refresh = models.DefaultSOARefresh * time.Second
+	retry = models.DefaultSOARetry * time.Second
+	expire = models.DefaultSOAExpire * time.Second
+
+	record := zone.SOARecord()
+	rr, err := record.ToRR()
+	if err != nil {
+		return refresh, retry, expire
+	}
+	soa := rr.(*dns.SOA)
+	if soa.Refresh > 0 {
+		refresh = time.Duration(soa.Refresh) * time.Second
+	}
+	if soa.Retry > 0 {
+		retry = time.Duration(soa.Retry) * time.Second
+	}
+	if soa.Expire > 0 {
+		expire = time.Duration(soa.Expire) * time.Second
+	}
+	return refresh, retry, expire
+}
+
+// run refreshes due zones periodically and on trigger
+func (s *SecondaryService) run() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.checkInterval)
+	defer ticker.Stop()
+
+	s.refreshDue()
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case domain := <-s.triggers:
+			s.refreshAsync(domain)
+		case <-ticker.C:
+			s.refreshDue()
+		}
+	}
+}
+
+// refreshDue starts a refresh of every enabled secondary zone whose next check is due
+func (s *SecondaryService) refreshDue() {
+	zones, err := s.zoneService.ListZones(s.ctx)
+	if err != nil {
+		vlog.Warnf("failed to list zones for secondary refresh: %v", err)
+		return
+	}
+
+	now := s.now()
+	for i := range zones {
+		zone := &zones[i]
+		if !zone.IsSecondary() || !zone.Enabled {
+			continue
+		}
+		if zone.SecondaryStatus != nil && zone.SecondaryStatus.NextCheck.After(now) {
+			continue
+		}
+		s.refreshAsync(zone.Domain)
+	}
+}
+
+// refreshAsync refreshes a zone in the background
+func (s *SecondaryService) refreshAsync(domain string) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		// Errors are recorded in the zone's secondary status
+		_ = s.Refresh(s.ctx, domain)
+	}()
+}
+
+// begin marks a zone as refreshing and reports false if a refresh is already running
+func (s *SecondaryService) begin(domain string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.refreshing[domain] {
+		return false
+	}
+	s.refreshing[domain] = true
+	return true
+}
+
+// end clears the refreshing mark of a zone
+func (s *SecondaryService) end(domain string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.refreshing, domain)
+}
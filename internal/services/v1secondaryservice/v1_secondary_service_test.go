@@ -0,0 +1,127 @@
+package v1secondaryservice
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/rogerwesterbo/godns/internal/models"
+)
+
+func mustRR(t *testing.T, s string) dns.RR {
+	t.Helper()
+	rr, err := dns.NewRR(s)
+	if err != nil {
+		t.Fatalf("failed to parse %q: %v", s, err)
+	}
+	return rr
+}
+
+func TestApplyTransfer(t *testing.T) {
+	soa1 := "example.lan. 3600 IN SOA ns1.example.lan. hostmaster.example.lan. 1 3600 1800 604800 300"
+	soa2 := "example.lan. 3600 IN SOA ns1.example.lan. hostmaster.example.lan. 2 3600 1800 604800 300"
+	soa3 := "example.lan. 3600 IN SOA ns1.example.lan. hostmaster.example.lan. 3 3600 1800 604800 300"
+
+	current := []models.DNSRecord{
+		models.NewSOARecord("example.lan.", "ns1.example.lan.", "hostmaster.example.lan.", 1, 3600, 1800, 604800, 300, 3600),
+		models.NewNSRecord("example.lan.", "ns1.example.lan.", 3600),
+		models.NewARecord("www.example.lan.", "192.168.1.10", 300),
+		models.NewARecord("old.example.lan.", "192.168.1.20", 300),
+	}
+
+	tests := []struct {
+		name    string
+		rrs     []string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "full zone",
+			rrs: []string{
+				soa2,
+				"example.lan. 3600 IN NS ns1.example.lan.",
+				"www.example.lan. 300 IN A 192.168.1.11",
+				soa2,
+			},
+			want: []string{"SOA example.lan.", "NS example.lan. ns1.example.lan.", "A www.example.lan. 192.168.1.11"},
+		},
+		{
+			name: "incremental",
+			rrs: []string{
+				soa3,
+				soa1,
+				"old.example.lan. 300 IN A 192.168.1.20",
+				soa2,
+				"new.example.lan. 300 IN A 192.168.1.30",
+				soa2,
+				"WWW.example.lan. 60 IN A 192.168.1.10",
+				soa3,
+				"www.example.lan. 300 IN A 192.168.1.12",
+				soa3,
+			},
+			want: []string{
+				"SOA example.lan.",
+				"NS example.lan. ns1.example.lan.",
+				"A new.example.lan. 192.168.1.30",
+				"A www.example.lan. 192.168.1.12",
+			},
+		},
+		{
+			name:    "missing closing SOA",
+			rrs:     []string{soa2, "www.example.lan. 300 IN A 192.168.1.11"},
+			wantErr: true,
+		},
+		{
+			name:    "current SOA only",
+			rrs:     []string{soa1},
+			wantErr: true,
+		},
+		{
+			name:    "difference without new SOA",
+			rrs:     []string{soa2, soa1, "old.example.lan. 300 IN A 192.168.1.20", soa2},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rrs := make([]dns.RR, 0, len(tt.rrs))
+			for _, s := range tt.rrs {
+				rrs = append(rrs, mustRR(t, s))
+			}
+
+			records, err := applyTransfer(current, rrs)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("applyTransfer() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			got := make([]string, 0, len(records))
+			for _, record := range records {
+				if record.Type == "SOA" {
+					got = append(got, "SOA "+record.Name)
+					continue
+				}
+				got = append(got, record.Type+" "+record.Name+" "+record.Value)
+			}
+			sort.Strings(got)
+			sort.Strings(tt.want)
+			if len(got) != len(tt.want) {
+				t.Fatalf("applyTransfer() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("applyTransfer() = %v, want %v", got, tt.want)
+					break
+				}
+			}
+
+			soa := models.DNSZone{Domain: "example.lan.", Records: records}
+			if want := mustRR(t, tt.rrs[0]).(*dns.SOA).Serial; soa.SOASerial() != want {
+				t.Errorf("serial = %d, want %d", soa.SOASerial(), want)
+			}
+		})
+	}
+}
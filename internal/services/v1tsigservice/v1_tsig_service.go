@@ -0,0 +1,323 @@
+package v1tsigservice
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/rogerwesterbo/godns/internal/models"
+	"github.com/rogerwesterbo/godns/pkg/interfaces/valkeyinterface"
+	"github.com/vitistack/common/pkg/loggers/vlog"
+)
+
+const (
+	tsigKeyPrefix  = "tsig:key:"
+	tsigKeyListKey = "tsig:keys:list"
+
+	// lookupTimeout bounds the Valkey lookup of a key while a DNS message is verified
+	lookupTimeout = 2 * time.Second
+)
+
+// V1TSIGService stores TSIG keys in Valkey and signs and verifies DNS messages with them
+// It implements dns.TsigProvider, so keys created or rotated through the API take
+// effect without restarting the DNS server. Keys from the configuration are
+// static: they are not stored, can't be changed through the API and are not scoped.
+type V1TSIGService struct {
+	client     valkeyinterface.ValkeyInterface
+	staticKeys map[string]models.TSIGKey
+}
+
+// NewV1TSIGService creates a new TSIG key service
+func NewV1TSIGService(client valkeyinterface.ValkeyInterface, staticKeys []models.TSIGKey) *V1TSIGService {
+	s := &V1TSIGService{
+		client:     client,
+		staticKeys: make(map[string]models.TSIGKey, len(staticKeys)),
+	}
+	for _, key := range staticKeys {
+		s.staticKeys[key.Name] = key
+	}
+	return s
+}
+
+// ListKeys returns the stored keys without their secrets
+func (s *V1TSIGService) ListKeys(ctx context.Context) ([]models.TSIGKey, error) {
+	names, err := s.listKeyNames(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]models.TSIGKey, 0, len(names))
+	for _, name := range names {
+		key, err := s.getKey(ctx, name)
+		if err != nil {
+			vlog.Warnf("failed to get TSIG key %s: %v", name, err)
+			continue
+		}
+		key.Secret = ""
+		keys = append(keys, *key)
+	}
+
+	return keys, nil
+}
+
+// GetKey returns a stored key without its secret
+func (s *V1TSIGService) GetKey(ctx context.Context, name string) (*models.TSIGKey, error) {
+	key, err := s.getKey(ctx, dns.CanonicalName(name))
+	if err != nil {
+		return nil, err
+	}
+	key.Secret = ""
+	return key, nil
+}
+
+// CreateKey validates and stores a new key
+// A secret is generated when none is given. The key is returned with its secret,
+// which can't be read back later.
+func (s *V1TSIGService) CreateKey(ctx context.Context, key *models.TSIGKey) error {
+	if key.Algorithm == "" {
+		key.Algorithm = dns.HmacSHA256
+	}
+	if key.Secret == "" {
+		if err := key.GenerateSecret(); err != nil {
+			return err
+		}
+	}
+	if err := key.Validate(); err != nil {
+		return err
+	}
+
+	if _, ok := s.staticKeys[key.Name]; ok {
+		return fmt.Errorf("TSIG key %s already exists in the server configuration", key.Name)
+	}
+	if _, err := s.client.GetData(ctx, tsigKeyPrefix+key.Name); err == nil {
+		return fmt.Errorf("TSIG key %s already exists", key.Name)
+	}
+
+	key.CreatedAt = time.Now().UTC()
+	key.RotatedAt = time.Time{}
+	if err := s.saveKey(ctx, key); err != nil {
+		return err
+	}
+
+	names, err := s.listKeyNames(ctx)
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(names, key.Name) {
+		if err := s.saveKeyNames(ctx, append(names, key.Name)); err != nil {
+			return err
+		}
+	}
+
+	vlog.Infof("Created TSIG key %s (%s)", key.Name, key.Algorithm)
+	return nil
+}
+
+// RotateKey replaces the secret of a stored key and returns the key with the new secret
+// Messages signed with the old secret fail verification from now on.
+func (s *V1TSIGService) RotateKey(ctx context.Context, name string) (*models.TSIGKey, error) {
+	key, err := s.getKey(ctx, dns.CanonicalName(name))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := key.GenerateSecret(); err != nil {
+		return nil, err
+	}
+	key.RotatedAt = time.Now().UTC()
+	if err := s.saveKey(ctx, key); err != nil {
+		return nil, err
+	}
+
+	vlog.Infof("Rotated TSIG key %s", key.Name)
+	return key, nil
+}
+
+// RevokeKey deletes a stored key; messages signed with it fail verification from now on
+func (s *V1TSIGService) RevokeKey(ctx context.Context, name string) error {
+	name = dns.CanonicalName(name)
+
+	if _, err := s.getKey(ctx, name); err != nil {
+		return err
+	}
+
+	if err := s.client.DeleteData(ctx, tsigKeyPrefix+name); err != nil {
+		return fmt.Errorf("failed to delete TSIG key: %w", err)
+	}
+
+	names, err := s.listKeyNames(ctx)
+	if err != nil {
+		return err
+	}
+	names = slices.DeleteFunc(names, func(n string) bool { return n == name })
+	if err := s.saveKeyNames(ctx, names); err != nil {
+		return err
+	}
+
+	vlog.Infof("Revoked TSIG key %s", name)
+	return nil
+}
+
+// Permits reports whether a verified key may be used for an operation on a zone
+// Keys from the configuration may be used for everything.
+func (s *V1TSIGService) Permits(ctx context.Context, name, zone, operation string) bool {
+	key, err := s.lookup(ctx, name)
+	if err != nil {
+		return false
+	}
+	return key.Permits(zone, operation)
+}
+
+// Algorithm returns the algorithm of a key, for signing the messages we send with it
+func (s *V1TSIGService) Algorithm(ctx context.Context, name string) (string, error) {
+	key, err := s.lookup(ctx, name)
+	if err != nil {
+		return "", err
+	}
+	return key.Algorithm, nil
+}
+
+// Generate signs a DNS message, implementing dns.TsigProvider
+func (s *V1TSIGService) Generate(msg []byte, t *dns.TSIG) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), lookupTimeout)
+	defer cancel()
+
+	key, err := s.lookup(ctx, t.Hdr.Name)
+	if err != nil {
+		return nil, dns.ErrSecret
+	}
+	return sign(key, msg, t.Algorithm)
+}
+
+// Verify checks the signature of a DNS message, implementing dns.TsigProvider
+func (s *V1TSIGService) Verify(msg []byte, t *dns.TSIG) error {
+	ctx, cancel := context.WithTimeout(context.Background(), lookupTimeout)
+	defer cancel()
+
+	key, err := s.lookup(ctx, t.Hdr.Name)
+	if err != nil {
+		vlog.Debugf("TSIG key %s: %v", t.Hdr.Name, err)
+		return dns.ErrSecret
+	}
+
+	expected, err := sign(key, msg, t.Algorithm)
+	if err != nil {
+		return err
+	}
+	mac, err := hex.DecodeString(t.MAC)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal(expected, mac) {
+		return dns.ErrSig
+	}
+	return nil
+}
+
+// lookup returns a key with its secret, preferring keys from the configuration
+func (s *V1TSIGService) lookup(ctx context.Context, name string) (*models.TSIGKey, error) {
+	name = dns.CanonicalName(name)
+	if key, ok := s.staticKeys[name]; ok {
+		return &key, nil
+	}
+	return s.getKey(ctx, name)
+}
+
+// sign computes the HMAC of a message with the key
+// The algorithm in the TSIG record must be the key's algorithm.
+func sign(key *models.TSIGKey, msg []byte, algorithm string) ([]byte, error) {
+	if dns.CanonicalName(algorithm) != key.Algorithm {
+		return nil, dns.ErrKeyAlg
+	}
+
+	secret, err := base64.StdEncoding.DecodeString(key.Secret)
+	if err != nil {
+		return nil, fmt.Errorf("invalid secret of TSIG key %s: %w", key.Name, err)
+	}
+
+	var h hash.Hash
+	switch key.Algorithm {
+	case dns.HmacSHA256:
+		h = hmac.New(sha256.New, secret)
+	case dns.HmacSHA512:
+		h = hmac.New(sha512.New, secret)
+	default:
+		return nil, dns.ErrKeyAlg
+	}
+	h.Write(msg)
+	return h.Sum(nil), nil
+}
+
+// getKey reads a stored key including its secret
+func (s *V1TSIGService) getKey(ctx context.Context, name string) (*models.TSIGKey, error) {
+	data, err := s.client.GetData(ctx, tsigKeyPrefix+name)
+	if err != nil {
+		if strings.Contains(err.Error(), "key not found") {
+			return nil, fmt.Errorf("TSIG key %s not found", name)
+		}
+		return nil, fmt.Errorf("failed to get TSIG key: %w", err)
+	}
+
+	var key models.TSIGKey
+	if err := json.Unmarshal([]byte(data), &key); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal TSIG key: %w", err)
+	}
+
+	return &key, nil
+}
+
+// saveKey stores a key including its secret
+func (s *V1TSIGService) saveKey(ctx context.Context, key *models.TSIGKey) error {
+	data, err := json.Marshal(key)
+	if err != nil {
+		return fmt.Errorf("failed to marshal TSIG key: %w", err)
+	}
+
+	if err := s.client.SetData(ctx, tsigKeyPrefix+key.Name, string(data)); err != nil {
+		return fmt.Errorf("failed to save TSIG key: %w", err)
+	}
+
+	return nil
+}
+
+// listKeyNames returns the names of the stored keys
+func (s *V1TSIGService) listKeyNames(ctx context.Context) ([]string, error) {
+	data, err := s.client.GetData(ctx, tsigKeyListKey)
+	if err != nil {
+		if strings.Contains(err.Error(), "key not found") {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get TSIG key list: %w", err)
+	}
+
+	var names []string
+	if err := json.Unmarshal([]byte(data), &names); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal TSIG key list: %w", err)
+	}
+
+	return names, nil
+}
+
+// saveKeyNames stores the names of the stored keys
+func (s *V1TSIGService) saveKeyNames(ctx context.Context, names []string) error {
+	data, err := json.Marshal(names)
+	if err != nil {
+		return fmt.Errorf("failed to marshal TSIG key list: %w", err)
+	}
+
+	if err := s.client.SetData(ctx, tsigKeyListKey, string(data)); err != nil {
+		return fmt.Errorf("failed to save TSIG key list: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,74 @@
+package v1tsigservice
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/rogerwesterbo/godns/internal/models"
+)
+
+// emptyValkey is a Valkey client without any keys
+type emptyValkey struct{}
+
+func (emptyValkey) GetData(ctx context.Context, key string) (string, error) {
+	return "", fmt.Errorf("key not found: %s", key)
+}
+func (emptyValkey) SetData(ctx context.Context, key string, data string) error { return nil }
+func (emptyValkey) DeleteData(ctx context.Context, key string) error           { return nil }
+func (emptyValkey) SetDataIfAbsent(ctx context.Context, key string, data string, ttl time.Duration) (bool, error) {
+	return true, nil
+}
+func (emptyValkey) DeleteDataIfEqual(ctx context.Context, key string, data string) error { return nil }
+func (emptyValkey) ListKeys(ctx context.Context) ([]string, error)                       { return nil, nil }
+func (emptyValkey) Ping(ctx context.Context) error                                       { return nil }
+
+func TestSignAndVerify(t *testing.T) {
+	key := models.TSIGKey{Name: "ddns-key", Algorithm: dns.HmacSHA512}
+	if err := key.GenerateSecret(); err != nil {
+		t.Fatalf("GenerateSecret() error = %v", err)
+	}
+	if err := key.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	s := NewV1TSIGService(emptyValkey{}, []models.TSIGKey{key})
+
+	tests := []struct {
+		name      string
+		keyName   string
+		algorithm string
+		wantErr   error
+	}{
+		{"valid signature", "ddns-key.", dns.HmacSHA512, nil},
+		{"key name case", "DDNS-Key.", dns.HmacSHA512, nil},
+		{"other algorithm", "ddns-key.", dns.HmacSHA256, dns.ErrKeyAlg},
+		{"unknown key", "other-key.", dns.HmacSHA512, dns.ErrSecret},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := new(dns.Msg)
+			m.SetUpdate("example.lan.")
+			m.SetTsig(tt.keyName, tt.algorithm, 300, time.Now().Unix())
+
+			// Sign with the configured key, then verify what the server would receive
+			signer := s
+			if tt.wantErr != nil {
+				signer = NewV1TSIGService(emptyValkey{}, []models.TSIGKey{{Name: dns.CanonicalName(tt.keyName), Algorithm: tt.algorithm, Secret: key.Secret}})
+			}
+			wire, _, err := dns.TsigGenerateWithProvider(m, signer, "", false)
+			if err != nil {
+				t.Fatalf("TsigGenerateWithProvider() error = %v", err)
+			}
+			if err := dns.TsigVerifyWithProvider(wire, s, "", false); err != tt.wantErr {
+				t.Errorf("TsigVerifyWithProvider() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if !s.Permits(context.Background(), "ddns-key.", "example.lan.", models.TSIGOperationTransfer) {
+		t.Error("a key from the configuration should not be scoped")
+	}
+}
@@ -0,0 +1,254 @@
+package v1upstream
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/rogerwesterbo/godns/internal/models"
+	"github.com/vitistack/common/pkg/loggers/vlog"
+)
+
+const (
+	forwardersKey = "dns:config:forwarders"
+
+	// forwarderReload is how often forwarders changed on other instances are picked up
+	forwarderReload = time.Minute
+)
+
+// forwarder is a conditional forwarder with its upstreams
+type forwarder struct {
+	config    models.ConditionalForwarder
+	strategy  string
+	upstreams []*upstreamState
+}
+
+// ForwarderStatus is the strategy and the status of the upstreams of a conditional forwarder
+type ForwarderStatus struct {
+	Domain    string
+	Strategy  string
+	Upstreams []UpstreamStatus
+}
+
+// ListForwarders returns the conditional forwarders
+func (s *UpstreamService) ListForwarders(ctx context.Context) ([]models.ConditionalForwarder, error) {
+	return s.loadForwarders(ctx)
+}
+
+// GetForwarder returns the conditional forwarder of a domain
+func (s *UpstreamService) GetForwarder(ctx context.Context, domain string) (*models.ConditionalForwarder, error) {
+	domain = dns.CanonicalName(domain)
+
+	forwarders, err := s.loadForwarders(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range forwarders {
+		if f.Domain == domain {
+			return &f, nil
+		}
+	}
+	return nil, fmt.Errorf("forwarder %s not found", domain)
+}
+
+// CreateForwarder sends the queries for a domain to its own upstreams
+func (s *UpstreamService) CreateForwarder(ctx context.Context, f *models.ConditionalForwarder) error {
+	if err := s.validateForwarder(f); err != nil {
+		return err
+	}
+
+	s.forwardersMu.Lock()
+	defer s.forwardersMu.Unlock()
+
+	forwarders, err := s.loadForwarders(ctx)
+	if err != nil {
+		return err
+	}
+	for _, existing := range forwarders {
+		if existing.Domain == f.Domain {
+			return fmt.Errorf("forwarder %s already exists", f.Domain)
+		}
+	}
+
+	f.CreatedAt = time.Now().UTC()
+	f.UpdatedAt = f.CreatedAt
+	if err := s.saveForwarders(ctx, append(forwarders, *f)); err != nil {
+		return err
+	}
+
+	vlog.Infof("Added forwarder %s: %s", f.Domain, strings.Join(f.Upstreams, ", "))
+	return nil
+}
+
+// UpdateForwarder replaces the upstreams and settings of the conditional forwarder of a domain
+func (s *UpstreamService) UpdateForwarder(ctx context.Context, domain string, f *models.ConditionalForwarder) error {
+	f.Domain = domain
+	if err := s.validateForwarder(f); err != nil {
+		return err
+	}
+
+	s.forwardersMu.Lock()
+	defer s.forwardersMu.Unlock()
+
+	forwarders, err := s.loadForwarders(ctx)
+	if err != nil {
+		return err
+	}
+	i := slices.IndexFunc(forwarders, func(existing models.ConditionalForwarder) bool {
+		return existing.Domain == f.Domain
+	})
+	if i < 0 {
+		return fmt.Errorf("forwarder %s not found", f.Domain)
+	}
+
+	f.CreatedAt = forwarders[i].CreatedAt
+	f.UpdatedAt = time.Now().UTC()
+	forwarders[i] = *f
+	if err := s.saveForwarders(ctx, forwarders); err != nil {
+		return err
+	}
+
+	vlog.Infof("Updated forwarder %s: %s", f.Domain, strings.Join(f.Upstreams, ", "))
+	return nil
+}
+
+// DeleteForwarder sends the queries for a domain to the default upstreams again
+func (s *UpstreamService) DeleteForwarder(ctx context.Context, domain string) error {
+	domain = dns.CanonicalName(domain)
+
+	s.forwardersMu.Lock()
+	defer s.forwardersMu.Unlock()
+
+	forwarders, err := s.loadForwarders(ctx)
+	if err != nil {
+		return err
+	}
+	kept := slices.DeleteFunc(forwarders, func(f models.ConditionalForwarder) bool {
+		return f.Domain == domain
+	})
+	if len(kept) == len(forwarders) {
+		return fmt.Errorf("forwarder %s not found", domain)
+	}
+	if err := s.saveForwarders(ctx, kept); err != nil {
+		return err
+	}
+
+	vlog.Infof("Deleted forwarder %s", domain)
+	return nil
+}
+
+// ValidatesDNSSEC reports whether answers for a name should be validated with DNSSEC
+// Names of conditional forwarders are only validated when the forwarder asks for it: private
+// domains have no chain of trust from the root, so their answers would be bogus.
+func (s *UpstreamService) ValidatesDNSSEC(name string) bool {
+	f := s.match(name)
+	return f == nil || f.config.DNSSEC
+}
+
+// validateForwarder checks a forwarder and its upstreams
+func (s *UpstreamService) validateForwarder(f *models.ConditionalForwarder) error {
+	if err := f.Validate(); err != nil {
+		return err
+	}
+	if f.Strategy != "" && !ValidStrategy(f.Strategy) {
+		return fmt.Errorf("invalid forwarder %s: unknown strategy %q (sequential, round-robin, fastest, parallel)", f.Domain, f.Strategy)
+	}
+	for _, addr := range f.Upstreams {
+		if _, err := parseUpstream(addr, s.timeout); err != nil {
+			return fmt.Errorf("invalid forwarder %s: %w", f.Domain, err)
+		}
+	}
+	return nil
+}
+
+// match returns the forwarder with the longest domain covering a name, if any
+func (s *UpstreamService) match(name string) *forwarder {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// Forwarders are sorted from the longest domain to the shortest
+	for _, f := range s.forwarders {
+		if f.config.Matches(name) {
+			return f
+		}
+	}
+	return nil
+}
+
+// loadForwarders reads the forwarders from Valkey and applies them
+func (s *UpstreamService) loadForwarders(ctx context.Context) ([]models.ConditionalForwarder, error) {
+	var forwarders []models.ConditionalForwarder
+	data, err := s.valkeyClient.GetData(ctx, forwardersKey)
+	if err != nil {
+		if !strings.Contains(err.Error(), "not found") {
+			return nil, fmt.Errorf("failed to get forwarders: %w", err)
+		}
+	} else if err := json.Unmarshal([]byte(data), &forwarders); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal forwarders: %w", err)
+	}
+
+	s.setForwarders(forwarders)
+	return forwarders, nil
+}
+
+func (s *UpstreamService) saveForwarders(ctx context.Context, forwarders []models.ConditionalForwarder) error {
+	data, err := json.Marshal(forwarders)
+	if err != nil {
+		return fmt.Errorf("failed to marshal forwarders: %w", err)
+	}
+	if err := s.valkeyClient.SetData(ctx, forwardersKey, string(data)); err != nil {
+		return fmt.Errorf("failed to save forwarders: %w", err)
+	}
+
+	s.setForwarders(forwarders)
+	return nil
+}
+
+// setForwarders replaces the forwarders; forwarders with unchanged upstreams keep their
+// connections and health, the upstreams of the others are closed
+func (s *UpstreamService) setForwarders(configs []models.ConditionalForwarder) {
+	s.mu.Lock()
+	previous := make(map[string]*forwarder, len(s.forwarders))
+	for _, f := range s.forwarders {
+		previous[f.config.Domain] = f
+	}
+
+	forwarders := make([]*forwarder, 0, len(configs))
+	for _, config := range configs {
+		strategy := config.Strategy
+		if strategy == "" {
+			strategy = s.strategy
+		}
+		if old, ok := previous[config.Domain]; ok && old.strategy == strategy && slices.Equal(old.config.Upstreams, config.Upstreams) {
+			delete(previous, config.Domain)
+			forwarders = append(forwarders, &forwarder{config: config, strategy: strategy, upstreams: old.upstreams})
+			continue
+		}
+
+		upstreams, err := s.parseUpstreams(config.Upstreams)
+		if err != nil {
+			vlog.Warnf("ignoring forwarder %s: %v", config.Domain, err)
+			continue
+		}
+		for _, u := range upstreams {
+			u.probeName = config.Domain
+		}
+		forwarders = append(forwarders, &forwarder{config: config, strategy: strategy, upstreams: upstreams})
+	}
+
+	slices.SortStableFunc(forwarders, func(a, b *forwarder) int {
+		return dns.CountLabel(b.config.Domain) - dns.CountLabel(a.config.Domain)
+	})
+	s.forwarders = forwarders
+	s.mu.Unlock()
+
+	for _, f := range previous {
+		for _, u := range f.upstreams {
+			u.upstream.Close()
+		}
+	}
+}
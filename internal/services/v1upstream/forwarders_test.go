@@ -0,0 +1,197 @@
+package v1upstream
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/rogerwesterbo/godns/internal/models"
+	"github.com/rogerwesterbo/godns/internal/testutil/valkeytest"
+)
+
+func TestForwarders(t *testing.T) {
+	ctx := context.Background()
+	client := valkeytest.NewMemoryValkey()
+	s := NewUpstreamService(client, time.Second, StrategySequential, 2, 0, nil)
+	defaultUpstream := &fakeUpstream{}
+	s.use([]*upstreamState{{addr: "default", upstream: defaultUpstream, probeName: "."}})
+
+	for _, f := range []models.ConditionalForwarder{
+		{Domain: "corp.internal", Upstreams: []string{"10.0.0.10", "tls://10.0.0.11@dc2.corp.internal"}, Strategy: StrategyFastest},
+		{Domain: "dc1.corp.internal.", Upstreams: []string{"10.0.1.10"}},
+		{Domain: "Consul", Upstreams: []string{" 127.0.0.1:8600 ", ""}},
+	} {
+		if err := s.CreateForwarder(ctx, &f); err != nil {
+			t.Fatalf("CreateForwarder(%s) error = %v", f.Domain, err)
+		}
+	}
+
+	invalid := []struct {
+		name      string
+		forwarder models.ConditionalForwarder
+		wantErr   string
+	}{
+		{"duplicate", models.ConditionalForwarder{Domain: "consul.", Upstreams: []string{"10.0.0.1"}}, "already exists"},
+		{"root", models.ConditionalForwarder{Domain: ".", Upstreams: []string{"10.0.0.1"}}, "invalid"},
+		{"no upstreams", models.ConditionalForwarder{Domain: "lab.internal"}, "invalid"},
+		{"unsupported upstream", models.ConditionalForwarder{Domain: "lab.internal", Upstreams: []string{"quic://10.0.0.1"}}, "invalid"},
+		{"unknown strategy", models.ConditionalForwarder{Domain: "lab.internal", Upstreams: []string{"10.0.0.1"}, Strategy: "random"}, "invalid"},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.CreateForwarder(ctx, &tt.forwarder)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("CreateForwarder() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	// Answer each forwarder's queries with a fake upstream
+	fakes := make(map[string]*fakeUpstream)
+	for _, f := range s.forwarders {
+		fakes[f.config.Domain] = &fakeUpstream{}
+		for _, u := range f.upstreams {
+			u.upstream = fakes[f.config.Domain]
+		}
+	}
+
+	routes := []struct {
+		name string
+		want *fakeUpstream
+	}{
+		{"host.dc1.corp.internal.", fakes["dc1.corp.internal."]},
+		{"www.corp.internal.", fakes["corp.internal."]},
+		{"CORP.internal.", fakes["corp.internal."]},
+		{"notcorp.internal.", defaultUpstream},
+		{"web.service.consul.", fakes["consul."]},
+		{"example.com.", defaultUpstream},
+	}
+	for _, tt := range routes {
+		t.Run(tt.name, func(t *testing.T) {
+			before := tt.want.queries.Load()
+			q := new(dns.Msg)
+			q.SetQuestion(tt.name, dns.TypeA)
+			if _, err := s.Forward(ctx, q); err != nil {
+				t.Fatalf("Forward() error = %v", err)
+			}
+			if tt.want.queries.Load() != before+1 {
+				t.Errorf("query for %s didn't go to the expected upstream", tt.name)
+			}
+		})
+	}
+
+	if s.ValidatesDNSSEC("www.corp.internal.") || !s.ValidatesDNSSEC("example.com.") {
+		t.Error("ValidatesDNSSEC() should be false for forwarded names and true for others")
+	}
+
+	// Updating the settings keeps the upstreams and their connections
+	update := models.ConditionalForwarder{Upstreams: []string{"10.0.0.10", "tls://10.0.0.11@dc2.corp.internal"}, Strategy: StrategyFastest, DNSSEC: true, Description: "AD"}
+	if err := s.UpdateForwarder(ctx, "corp.internal", &update); err != nil {
+		t.Fatalf("UpdateForwarder() error = %v", err)
+	}
+	if f := s.match("www.corp.internal."); f.upstreams[0].upstream != fakes["corp.internal."] || !f.config.DNSSEC {
+		t.Errorf("updated forwarder = %+v, want the same upstreams with DNSSEC validation", f.config)
+	}
+	if update.CreatedAt.IsZero() || update.Domain != "corp.internal." {
+		t.Errorf("UpdateForwarder() = %+v, want the domain and creation time kept", update)
+	}
+	if err := s.UpdateForwarder(ctx, "lab.internal", &update); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("UpdateForwarder() of a missing forwarder error = %v, want not found", err)
+	}
+
+	if err := s.DeleteForwarder(ctx, "consul"); err != nil {
+		t.Fatalf("DeleteForwarder() error = %v", err)
+	}
+	if err := s.DeleteForwarder(ctx, "consul"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("second DeleteForwarder() error = %v, want not found", err)
+	}
+	if s.match("web.service.consul.") != nil {
+		t.Error("deleted forwarder still matches")
+	}
+
+	// Other instances read the forwarders from Valkey
+	other := NewUpstreamService(client, time.Second, StrategySequential, 2, 0, nil)
+	forwarders, err := other.ListForwarders(ctx)
+	if err != nil {
+		t.Fatalf("ListForwarders() error = %v", err)
+	}
+	if len(forwarders) != 2 || other.match("host.dc1.corp.internal.").config.Domain != "dc1.corp.internal." {
+		t.Errorf("ListForwarders() = %+v, want corp.internal. and dc1.corp.internal.", forwarders)
+	}
+	if got, err := other.GetForwarder(ctx, "CORP.internal"); err != nil || got.Description != "AD" {
+		t.Errorf("GetForwarder() = %+v, %v, want the updated forwarder", got, err)
+	}
+}
+
+// fakeResolver counts the queries it resolves
+type fakeResolver struct {
+	queries int
+}
+
+func (r *fakeResolver) Resolve(ctx context.Context, query *dns.Msg) (*dns.Msg, error) {
+	r.queries++
+	resp := new(dns.Msg)
+	resp.SetReply(query)
+	return resp, nil
+}
+
+func TestUseResolver(t *testing.T) {
+	ctx := context.Background()
+	s := NewUpstreamService(valkeytest.NewMemoryValkey(), time.Second, StrategySequential, 2, 0, nil)
+	defaultUpstream := &fakeUpstream{}
+	s.use([]*upstreamState{{addr: "default", upstream: defaultUpstream, probeName: "."}})
+	if err := s.CreateForwarder(ctx, &models.ConditionalForwarder{Domain: "corp.internal", Upstreams: []string{"10.0.0.10"}}); err != nil {
+		t.Fatalf("CreateForwarder() error = %v", err)
+	}
+	forwarded := &fakeUpstream{}
+	s.forwarders[0].upstreams[0].upstream = forwarded
+
+	resolver := &fakeResolver{}
+	s.UseResolver(resolver)
+	for _, name := range []string{"example.com.", "www.corp.internal."} {
+		q := new(dns.Msg)
+		q.SetQuestion(name, dns.TypeA)
+		if _, err := s.Forward(ctx, q); err != nil {
+			t.Fatalf("Forward(%s) error = %v", name, err)
+		}
+	}
+
+	if resolver.queries != 1 || forwarded.queries.Load() != 1 || defaultUpstream.queries.Load() != 0 {
+		t.Errorf("resolver, forwarder and default upstream queries = %d, %d, %d, want 1, 1, 0",
+			resolver.queries, forwarded.queries.Load(), defaultUpstream.queries.Load())
+	}
+	if !s.Stats().Recursive {
+		t.Error("Stats().Recursive = false, want true")
+	}
+}
+
+func TestForwardersConcurrent(t *testing.T) {
+	ctx := context.Background()
+	s := NewUpstreamService(valkeytest.NewSlowValkey(), time.Second, StrategySequential, 2, 0, nil)
+
+	const changes = 10
+	var wg sync.WaitGroup
+	for i := range changes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			f := models.ConditionalForwarder{Domain: fmt.Sprintf("site%d.corp.internal.", i), Upstreams: []string{"10.0.0.10"}}
+			if err := s.CreateForwarder(ctx, &f); err != nil {
+				t.Errorf("CreateForwarder(%s) error = %v", f.Domain, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	forwarders, err := s.ListForwarders(ctx)
+	if err != nil {
+		t.Fatalf("ListForwarders() error = %v", err)
+	}
+	if len(forwarders) != changes {
+		t.Errorf("got %d forwarders, want %d", len(forwarders), changes)
+	}
+}
@@ -0,0 +1,307 @@
+package v1upstream
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Strategies for choosing the upstream of a query
+const (
+	// StrategySequential tries the upstreams in their configured order
+	StrategySequential = "sequential"
+	// StrategyRoundRobin starts with the next upstream for every query
+	StrategyRoundRobin = "round-robin"
+	// StrategyFastest starts with the upstream with the lowest average round-trip time
+	StrategyFastest = "fastest"
+	// StrategyParallel sends the query to the first upstreams at once and uses the first answer
+	StrategyParallel = "parallel"
+)
+
+const (
+	// rttSmoothing is the weight of a new round-trip time in the moving average
+	rttSmoothing = 0.3
+
+	// failureThreshold is the number of failures in a row that opens the circuit of an upstream
+	failureThreshold = 3
+
+	// circuitOpenDuration is how long an upstream with an open circuit is skipped
+	// before a query or probe may try it again
+	circuitOpenDuration = 30 * time.Second
+)
+
+// ValidStrategy reports whether strategy is a known upstream strategy
+func ValidStrategy(strategy string) bool {
+	switch strategy {
+	case StrategySequential, StrategyRoundRobin, StrategyFastest, StrategyParallel:
+		return true
+	}
+	return false
+}
+
+// upstreamState is an upstream with the health and latency seen in its answers
+type upstreamState struct {
+	addr      string
+	upstream  upstream
+	probeName string // name of the SOA query of health probes
+
+	mu                  sync.Mutex
+	rtt                 time.Duration // exponentially weighted moving average
+	consecutiveFailures int
+	openUntil           time.Time
+	queries             uint64
+	failures            uint64
+	lastError           string
+	lastSuccess         time.Time
+	lastFailure         time.Time
+}
+
+// UpstreamStatus is the health and latency of one upstream
+type UpstreamStatus struct {
+	Address             string
+	Healthy             bool
+	RTT                 time.Duration
+	Queries             uint64
+	Failures            uint64
+	ConsecutiveFailures int
+	LastError           string
+	LastSuccess         time.Time
+	LastFailure         time.Time
+}
+
+// UpstreamStats is the strategy and the status of every upstream and conditional forwarder
+type UpstreamStats struct {
+	Strategy   string
+	Recursive  bool // queries that no forwarder matches are resolved recursively
+	Upstreams  []UpstreamStatus
+	Forwarders []ForwarderStatus
+}
+
+// available reports whether the circuit of the upstream is closed, or its open time is over
+// and the next query may try it again (half-open)
+func (u *upstreamState) available(now time.Time) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return !now.Before(u.openUntil)
+}
+
+// record records the outcome of a query; err is nil for an answer and a transport error otherwise
+func (u *upstreamState) record(rtt time.Duration, err error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.queries++
+	now := time.Now()
+	if err != nil {
+		u.failures++
+		u.consecutiveFailures++
+		u.lastError = err.Error()
+		u.lastFailure = now
+		if u.consecutiveFailures >= failureThreshold {
+			u.openUntil = now.Add(circuitOpenDuration)
+		}
+		return
+	}
+
+	u.consecutiveFailures = 0
+	u.openUntil = time.Time{}
+	u.lastSuccess = now
+	if u.rtt == 0 {
+		u.rtt = rtt
+	} else {
+		u.rtt = time.Duration(rttSmoothing*float64(rtt) + (1-rttSmoothing)*float64(u.rtt))
+	}
+}
+
+// recordErrorAnswer records a SERVFAIL or REFUSED answer
+// The upstream is reachable, so the answer neither counts as a failure nor closes an open circuit.
+func (u *upstreamState) recordErrorAnswer(err error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.queries++
+	u.lastError = err.Error()
+}
+
+func (u *upstreamState) status(now time.Time) UpstreamStatus {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return UpstreamStatus{
+		Address:             u.addr,
+		Healthy:             !now.Before(u.openUntil),
+		RTT:                 u.rtt,
+		Queries:             u.queries,
+		Failures:            u.failures,
+		ConsecutiveFailures: u.consecutiveFailures,
+		LastError:           u.lastError,
+		LastSuccess:         u.lastSuccess,
+		LastFailure:         u.lastFailure,
+	}
+}
+
+func (u *upstreamState) averageRTT() time.Duration {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.rtt
+}
+
+// answerError returns why an answer can't be used: SERVFAIL and REFUSED mean the
+// upstream can't answer, another upstream may
+func answerError(resp *dns.Msg) error {
+	switch resp.Rcode {
+	case dns.RcodeServerFailure, dns.RcodeRefused:
+		return fmt.Errorf("upstream answered %s", dns.RcodeToString[resp.Rcode])
+	}
+	return nil
+}
+
+// order returns the upstreams in the order the strategy tries them
+// Upstreams with an open circuit come last, so they are only tried when all others failed.
+func order(upstreams []*upstreamState, strategy string, next uint64) []*upstreamState {
+	ordered := slices.Clone(upstreams)
+	switch strategy {
+	case StrategyRoundRobin:
+		if n := len(ordered); n > 0 {
+			start := int(next % uint64(n)) // #nosec G115 -- the result is below n
+			ordered = append(ordered[start:], ordered[:start]...)
+		}
+	case StrategyFastest:
+		// Upstreams without answers yet have no RTT and are tried first, to measure them
+		slices.SortStableFunc(ordered, func(a, b *upstreamState) int {
+			return cmp.Compare(a.averageRTT(), b.averageRTT())
+		})
+	}
+
+	now := time.Now()
+	available := make([]*upstreamState, 0, len(ordered))
+	var open []*upstreamState
+	for _, u := range ordered {
+		if u.available(now) {
+			available = append(available, u)
+		} else {
+			open = append(open, u)
+		}
+	}
+	return append(available, open...)
+}
+
+// attempt is the outcome of a query to one upstream
+type attempt struct {
+	resp *dns.Msg
+	err  error
+}
+
+// exchange sends a query to an upstream and records the outcome
+// Only transport errors and timeouts count toward the upstream's circuit; SERVFAIL and
+// REFUSED answers are returned as errors, so the query is tried at the next upstream.
+func (s *UpstreamService) exchange(ctx context.Context, u *upstreamState, query *dns.Msg) attempt {
+	start := time.Now()
+	resp, err := u.upstream.Exchange(ctx, query)
+	rtt := time.Since(start)
+	if err != nil {
+		if ctx.Err() != nil {
+			// The query was given up on, which says nothing about the upstream
+			return attempt{resp: resp, err: err}
+		}
+		u.record(rtt, err)
+		s.recordMetrics(u, rtt, err)
+		return attempt{resp: resp, err: err}
+	}
+
+	if err := answerError(resp); err != nil {
+		u.recordErrorAnswer(err)
+		s.recordMetrics(u, rtt, err)
+		return attempt{resp: resp, err: err}
+	}
+
+	u.record(rtt, nil)
+	s.recordMetrics(u, rtt, nil)
+	return attempt{resp: resp}
+}
+
+// race sends a query to several upstreams at once and returns the first usable answer,
+// or the last failure when none answered
+func (s *UpstreamService) race(ctx context.Context, upstreams []*upstreamState, query *dns.Msg) attempt {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan attempt, len(upstreams))
+	for _, u := range upstreams {
+		go func() {
+			// Each upstream gets its own copy, the transports may change the ID
+			results <- s.exchange(ctx, u, query.Copy())
+		}()
+	}
+
+	var last attempt
+	for range upstreams {
+		last = <-results
+		if last.err == nil {
+			return last
+		}
+	}
+	return last
+}
+
+// forward sends a query to the upstreams following the strategy until one answers
+// An upstream that fails or answers SERVFAIL or REFUSED is followed by the next. When all
+// of them fail, the last SERVFAIL or REFUSED answer is returned, or else the last error.
+func (s *UpstreamService) forward(ctx context.Context, upstreams []*upstreamState, strategy string, query *dns.Msg) (*dns.Msg, error) {
+	if len(upstreams) == 0 {
+		return nil, errors.New("no upstream DNS server configured")
+	}
+
+	ordered := order(upstreams, strategy, s.next.Add(1)-1)
+	var lastResp *dns.Msg
+	var lastErr error
+	if strategy == StrategyParallel {
+		n := min(max(s.raceCount, 1), len(ordered))
+		a := s.race(ctx, ordered[:n], query)
+		if a.err == nil {
+			return a.resp, nil
+		}
+		lastResp, lastErr = a.resp, a.err
+		ordered = ordered[n:]
+	}
+
+	for _, u := range ordered {
+		if ctx.Err() != nil {
+			break
+		}
+		a := s.exchange(ctx, u, query)
+		if a.err == nil {
+			return a.resp, nil
+		}
+		if a.resp != nil {
+			lastResp = a.resp
+		}
+		lastErr = a.err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if lastResp != nil {
+		return lastResp, nil
+	}
+	return nil, lastErr
+}
+
+// recordMetrics records the outcome of a query to an upstream in the metrics
+func (s *UpstreamService) recordMetrics(u *upstreamState, rtt time.Duration, err error) {
+	if s.metrics == nil {
+		return
+	}
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	s.metrics.RecordUpstreamServerQuery(u.addr, result, rtt.Seconds())
+	s.metrics.UpdateUpstreamServerHealth(u.addr, u.available(time.Now()))
+}
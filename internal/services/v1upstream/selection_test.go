@@ -0,0 +1,283 @@
+package v1upstream
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// fakeUpstream answers with an rcode after a delay, or fails
+type fakeUpstream struct {
+	rcode   int
+	delay   time.Duration
+	err     error
+	queries atomic.Int32
+}
+
+func (f *fakeUpstream) Exchange(ctx context.Context, query *dns.Msg) (*dns.Msg, error) {
+	f.queries.Add(1)
+	select {
+	case <-time.After(f.delay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if f.err != nil {
+		return nil, f.err
+	}
+	m := new(dns.Msg)
+	m.SetRcode(query, f.rcode)
+	return m, nil
+}
+
+func (f *fakeUpstream) Close() {}
+
+func newTestService(strategy string, upstreams ...*fakeUpstream) *UpstreamService {
+	s := NewUpstreamService(nil, time.Second, strategy, 2, time.Minute, nil)
+	states := make([]*upstreamState, 0, len(upstreams))
+	for i, u := range upstreams {
+		states = append(states, &upstreamState{addr: string(rune('a' + i)), upstream: u, probeName: "."})
+	}
+	s.use(states)
+	return s
+}
+
+func TestForward(t *testing.T) {
+	ok := func() *fakeUpstream { return &fakeUpstream{rcode: dns.RcodeSuccess} }
+
+	tests := []struct {
+		name        string
+		strategy    string
+		upstreams   []*fakeUpstream
+		queries     int
+		wantRcode   int
+		wantErr     bool
+		wantQueries []int32
+	}{
+		{
+			name:        "sequential uses the first upstream",
+			strategy:    StrategySequential,
+			upstreams:   []*fakeUpstream{ok(), ok()},
+			queries:     3,
+			wantQueries: []int32{3, 0},
+		},
+		{
+			name:        "SERVFAIL is retried on the next upstream",
+			strategy:    StrategySequential,
+			upstreams:   []*fakeUpstream{{rcode: dns.RcodeServerFailure}, ok()},
+			queries:     1,
+			wantQueries: []int32{1, 1},
+		},
+		{
+			name:        "REFUSED and errors are retried on the next upstream",
+			strategy:    StrategySequential,
+			upstreams:   []*fakeUpstream{{rcode: dns.RcodeRefused}, {err: errors.New("timeout")}, ok()},
+			queries:     1,
+			wantQueries: []int32{1, 1, 1},
+		},
+		{
+			name:        "NXDOMAIN is an answer",
+			strategy:    StrategySequential,
+			upstreams:   []*fakeUpstream{{rcode: dns.RcodeNameError}, ok()},
+			queries:     1,
+			wantRcode:   dns.RcodeNameError,
+			wantQueries: []int32{1, 0},
+		},
+		{
+			name:        "all failing returns the last SERVFAIL",
+			strategy:    StrategySequential,
+			upstreams:   []*fakeUpstream{{rcode: dns.RcodeServerFailure}, {err: errors.New("timeout")}},
+			queries:     1,
+			wantRcode:   dns.RcodeServerFailure,
+			wantQueries: []int32{1, 1},
+		},
+		{
+			name:        "all erroring returns the error",
+			strategy:    StrategySequential,
+			upstreams:   []*fakeUpstream{{err: errors.New("timeout")}},
+			queries:     1,
+			wantErr:     true,
+			wantQueries: []int32{1},
+		},
+		{
+			name:        "round-robin spreads queries",
+			strategy:    StrategyRoundRobin,
+			upstreams:   []*fakeUpstream{ok(), ok(), ok()},
+			queries:     6,
+			wantQueries: []int32{2, 2, 2},
+		},
+		{
+			name:        "fastest prefers the lowest RTT once measured",
+			strategy:    StrategyFastest,
+			upstreams:   []*fakeUpstream{{delay: 20 * time.Millisecond}, {delay: time.Millisecond}},
+			queries:     5,
+			wantQueries: []int32{1, 4},
+		},
+		{
+			name:        "parallel races the first upstreams",
+			strategy:    StrategyParallel,
+			upstreams:   []*fakeUpstream{{rcode: dns.RcodeServerFailure}, {delay: 10 * time.Millisecond}, ok()},
+			queries:     1,
+			wantQueries: []int32{1, 1, 0},
+		},
+		{
+			name:        "parallel falls back to the rest",
+			strategy:    StrategyParallel,
+			upstreams:   []*fakeUpstream{{err: errors.New("timeout")}, {rcode: dns.RcodeRefused}, ok()},
+			queries:     1,
+			wantQueries: []int32{1, 1, 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestService(tt.strategy, tt.upstreams...)
+			for i := 0; i < tt.queries; i++ {
+				q := new(dns.Msg)
+				q.SetQuestion("example.com.", dns.TypeA)
+				resp, err := s.Forward(context.Background(), q)
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("Forward() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				if err == nil && resp.Rcode != tt.wantRcode {
+					t.Errorf("Forward() rcode = %s, want %s", dns.RcodeToString[resp.Rcode], dns.RcodeToString[tt.wantRcode])
+				}
+			}
+			for i, u := range tt.upstreams {
+				if got := u.queries.Load(); got != tt.wantQueries[i] {
+					t.Errorf("upstream %d got %d queries, want %d", i, got, tt.wantQueries[i])
+				}
+			}
+		})
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	failing := &fakeUpstream{err: errors.New("connection refused")}
+	healthy := &fakeUpstream{rcode: dns.RcodeSuccess}
+	s := newTestService(StrategySequential, failing, healthy)
+
+	forward := func() {
+		q := new(dns.Msg)
+		q.SetQuestion("example.com.", dns.TypeA)
+		if _, err := s.Forward(context.Background(), q); err != nil {
+			t.Fatalf("Forward() error = %v", err)
+		}
+	}
+
+	// The failing upstream is tried until its circuit opens
+	for i := 0; i < failureThreshold+2; i++ {
+		forward()
+	}
+	if got := failing.queries.Load(); got != failureThreshold {
+		t.Errorf("failing upstream got %d queries, want %d before its circuit opened", got, failureThreshold)
+	}
+	stats := s.Stats()
+	if stats.Upstreams[0].Healthy || !stats.Upstreams[1].Healthy {
+		t.Errorf("Stats() = %+v, want the first upstream unhealthy and the second healthy", stats.Upstreams)
+	}
+	if stats.Upstreams[0].ConsecutiveFailures != failureThreshold || stats.Upstreams[0].LastError == "" {
+		t.Errorf("Stats() of the failing upstream = %+v, want %d failures and the error", stats.Upstreams[0], failureThreshold)
+	}
+
+	// A successful probe closes the circuit again
+	failing.err = nil
+	s.probe()
+	if !s.Stats().Upstreams[0].Healthy {
+		t.Error("upstream still unhealthy after a successful probe")
+	}
+	forward()
+	if got := failing.queries.Load(); got != failureThreshold+2 {
+		t.Errorf("recovered upstream got %d queries, want %d (probe and query)", got, failureThreshold+2)
+	}
+}
+
+func TestCircuitBreakerErrorAnswers(t *testing.T) {
+	for _, rcode := range []int{dns.RcodeServerFailure, dns.RcodeRefused} {
+		t.Run(dns.RcodeToString[rcode], func(t *testing.T) {
+			answering := &fakeUpstream{rcode: rcode}
+			healthy := &fakeUpstream{rcode: dns.RcodeSuccess}
+			s := newTestService(StrategySequential, answering, healthy)
+
+			// The upstream answers, so it is asked first every time and its circuit stays closed
+			for i := 0; i < failureThreshold+2; i++ {
+				q := new(dns.Msg)
+				q.SetQuestion("example.com.", dns.TypeA)
+				resp, err := s.Forward(context.Background(), q)
+				if err != nil || resp.Rcode != dns.RcodeSuccess {
+					t.Fatalf("Forward() = %v, %v, want the answer of the next upstream", resp, err)
+				}
+			}
+			if got := answering.queries.Load(); got != failureThreshold+2 {
+				t.Errorf("upstream got %d queries, want %d", got, failureThreshold+2)
+			}
+			status := s.Stats().Upstreams[0]
+			if !status.Healthy || status.ConsecutiveFailures != 0 || status.Failures != 0 {
+				t.Errorf("Stats() = %+v, want a healthy upstream without failures", status)
+			}
+		})
+	}
+}
+
+func TestUpstreamQuery(t *testing.T) {
+	tests := []struct {
+		name   string
+		query  func() *dns.Msg
+		wantDO bool
+	}{
+		{
+			name: "query without EDNS0 gets our OPT record",
+			query: func() *dns.Msg {
+				return new(dns.Msg).SetQuestion("example.com.", dns.TypeA)
+			},
+		},
+		{
+			name: "client options and payload size are replaced, DO is kept",
+			query: func() *dns.Msg {
+				m := new(dns.Msg).SetQuestion("example.com.", dns.TypeA)
+				m.SetEdns0(4096, true)
+				opt := m.IsEdns0()
+				opt.Option = append(opt.Option,
+					&dns.EDNS0_COOKIE{Code: dns.EDNS0COOKIE, Cookie: "0102030405060708"},
+					&dns.EDNS0_LOCAL{Code: 65001, Data: []byte{1, 2}})
+				return m
+			},
+			wantDO: true,
+		},
+		{
+			name: "client TSIG is left out",
+			query: func() *dns.Msg {
+				m := new(dns.Msg).SetQuestion("example.com.", dns.TypeA)
+				return m.SetTsig("key.", dns.HmacSHA256, 300, time.Now().Unix())
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query := tt.query()
+			extra := len(query.Extra)
+			q := upstreamQuery(query)
+
+			if len(query.Extra) != extra {
+				t.Error("the client query was modified")
+			}
+			if q.Id != query.Id {
+				t.Errorf("id = %d, want %d", q.Id, query.Id)
+			}
+			if len(q.Extra) != 1 {
+				t.Fatalf("got additional records %v, want only the OPT record", q.Extra)
+			}
+			opt := q.IsEdns0()
+			if opt == nil {
+				t.Fatal("expected an OPT record")
+			}
+			if opt.UDPSize() != ednsBufferSize || len(opt.Option) != 0 || opt.Do() != tt.wantDO {
+				t.Errorf("OPT = %v, want payload size %d, no options and DO %v", opt, ednsBufferSize, tt.wantDO)
+			}
+		})
+	}
+}
@@ -0,0 +1,310 @@
+package v1upstream
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	// dotIdleTimeout is how long an idle DNS over TLS connection is kept for reuse;
+	// servers close idle connections after a few seconds (RFC 7766 section 6.2.3)
+	dotIdleTimeout = 10 * time.Second
+
+	// maxIdleConns is the number of idle connections kept per upstream
+	maxIdleConns = 8
+
+	// sessionCacheSize is the number of TLS sessions kept for resumption per upstream
+	sessionCacheSize = 32
+
+	dohContentType = "application/dns-message"
+)
+
+// upstream sends queries to one upstream server over one transport
+type upstream interface {
+	Exchange(ctx context.Context, query *dns.Msg) (*dns.Msg, error)
+	// Close closes the idle connections of the upstream
+	Close()
+}
+
+// parseUpstream parses an upstream definition:
+//
+//	1.1.1.1:53, udp://1.1.1.1:53        plain DNS over UDP, retried over TCP when truncated
+//	tcp://1.1.1.1:53                    plain DNS over TCP
+//	tls://1.1.1.1@cloudflare-dns.com    DNS over TLS (port 853), verifying the certificate for the name after @
+//	https://dns.google/dns-query        DNS over HTTPS
+//
+// Without a name after @, DNS over TLS verifies the certificate for the host.
+func parseUpstream(addr string, timeout time.Duration) (upstream, error) {
+	scheme, rest, found := strings.Cut(addr, "://")
+	if !found {
+		scheme, rest = "udp", addr
+	}
+
+	switch scheme {
+	case "udp", "tcp":
+		hostPort, err := withDefaultPort(rest, "53")
+		if err != nil {
+			return nil, err
+		}
+		return &plainUpstream{addr: hostPort, net: scheme, timeout: timeout}, nil
+	case "tls":
+		host, serverName, _ := strings.Cut(rest, "@")
+		hostPort, err := withDefaultPort(host, "853")
+		if err != nil {
+			return nil, err
+		}
+		if serverName == "" {
+			serverName, _, _ = net.SplitHostPort(hostPort)
+		}
+		return newTLSUpstream(hostPort, serverName, timeout), nil
+	case "https":
+		u, err := url.Parse(addr)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("invalid upstream %q: invalid URL", addr)
+		}
+		if u.Path == "" {
+			u.Path = "/dns-query"
+		}
+		return newHTTPSUpstream(u.String(), timeout), nil
+	default:
+		return nil, fmt.Errorf("invalid upstream %q: unsupported scheme %s", addr, scheme)
+	}
+}
+
+// withDefaultPort adds a port to an address without one
+func withDefaultPort(addr, port string) (string, error) {
+	if addr == "" {
+		return "", fmt.Errorf("invalid upstream: missing address")
+	}
+	if _, _, err := net.SplitHostPort(addr); err == nil {
+		return addr, nil
+	}
+	host := strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")
+	if strings.ContainsAny(host, "[]/") {
+		return "", fmt.Errorf("invalid upstream address %q", addr)
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+// plainUpstream sends unencrypted queries over UDP or TCP
+type plainUpstream struct {
+	addr    string
+	net     string
+	timeout time.Duration
+}
+
+func (u *plainUpstream) Exchange(ctx context.Context, query *dns.Msg) (*dns.Msg, error) {
+	c := &dns.Client{
+		Net:            u.net,
+		Timeout:        u.timeout,
+		Dialer:         &net.Dialer{Timeout: u.timeout},
+		SingleInflight: true,
+	}
+	in, _, err := c.ExchangeContext(ctx, query, u.addr)
+	// Fallback to TCP if truncated
+	if err == nil && in != nil && in.Truncated && u.net == "udp" {
+		cTCP := &dns.Client{Net: "tcp", Timeout: u.timeout}
+		in, _, err = cTCP.ExchangeContext(ctx, query, u.addr)
+	}
+	return in, err
+}
+
+func (u *plainUpstream) Close() {}
+
+// tlsUpstream sends queries over DNS over TLS (RFC 7858) connections, which are kept
+// open for the next queries; new connections resume the TLS session of earlier ones
+type tlsUpstream struct {
+	addr      string
+	timeout   time.Duration
+	tlsConfig *tls.Config
+
+	mu   sync.Mutex
+	idle []*tlsConn
+}
+
+type tlsConn struct {
+	*dns.Conn
+	lastUsed time.Time
+}
+
+func newTLSUpstream(addr, serverName string, timeout time.Duration) *tlsUpstream {
+	return &tlsUpstream{
+		addr:    addr,
+		timeout: timeout,
+		tlsConfig: &tls.Config{
+			ServerName:         serverName,
+			MinVersion:         tls.VersionTLS12,
+			ClientSessionCache: tls.NewLRUClientSessionCache(sessionCacheSize),
+		},
+	}
+}
+
+func (u *tlsUpstream) Exchange(ctx context.Context, query *dns.Msg) (*dns.Msg, error) {
+	// A pooled connection may have been closed by the server since it was used,
+	// so a failure on one is retried on a new connection
+	if conn := u.takeIdle(); conn != nil {
+		if resp, err := u.exchangeOn(ctx, conn, query); err == nil {
+			return resp, nil
+		}
+	}
+
+	conn, err := u.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return u.exchangeOn(ctx, conn, query)
+}
+
+func (u *tlsUpstream) exchangeOn(ctx context.Context, conn *tlsConn, query *dns.Msg) (*dns.Msg, error) {
+	deadline := time.Now().Add(u.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	_ = conn.SetDeadline(deadline)
+
+	if err := conn.WriteMsg(query); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	resp, err := conn.ReadMsg()
+	if err == nil && resp.Id != query.Id {
+		err = dns.ErrId
+	}
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	u.putIdle(conn)
+	return resp, nil
+}
+
+func (u *tlsUpstream) dial(ctx context.Context) (*tlsConn, error) {
+	dialer := &tls.Dialer{
+		NetDialer: &net.Dialer{Timeout: u.timeout},
+		Config:    u.tlsConfig,
+	}
+	c, err := dialer.DialContext(ctx, "tcp", u.addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to DNS over TLS upstream %s: %w", u.addr, err)
+	}
+	return &tlsConn{Conn: &dns.Conn{Conn: c}}, nil
+}
+
+// takeIdle returns the most recently used idle connection, closing expired ones
+func (u *tlsUpstream) takeIdle() *tlsConn {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	for len(u.idle) > 0 {
+		conn := u.idle[len(u.idle)-1]
+		u.idle = u.idle[:len(u.idle)-1]
+		if time.Since(conn.lastUsed) < dotIdleTimeout {
+			return conn
+		}
+		_ = conn.Close()
+	}
+	return nil
+}
+
+func (u *tlsUpstream) putIdle(conn *tlsConn) {
+	conn.lastUsed = time.Now()
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if len(u.idle) >= maxIdleConns {
+		_ = conn.Close()
+		return
+	}
+	u.idle = append(u.idle, conn)
+}
+
+func (u *tlsUpstream) Close() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for _, conn := range u.idle {
+		_ = conn.Close()
+	}
+	u.idle = nil
+}
+
+// httpsUpstream sends queries with DNS over HTTPS (RFC 8484) POST requests
+// The HTTP client keeps connections open and resumes TLS sessions.
+type httpsUpstream struct {
+	url    string
+	client *http.Client
+}
+
+func newHTTPSUpstream(endpoint string, timeout time.Duration) *httpsUpstream {
+	return &httpsUpstream{
+		url: endpoint,
+		client: &http.Client{
+			Timeout: timeout,
+			Transport: &http.Transport{
+				Proxy:               http.ProxyFromEnvironment,
+				DialContext:         (&net.Dialer{Timeout: timeout}).DialContext,
+				TLSHandshakeTimeout: timeout,
+				TLSClientConfig: &tls.Config{
+					MinVersion:         tls.VersionTLS12,
+					ClientSessionCache: tls.NewLRUClientSessionCache(sessionCacheSize),
+				},
+				ForceAttemptHTTP2:   true,
+				MaxIdleConnsPerHost: maxIdleConns,
+				IdleConnTimeout:     90 * time.Second,
+			},
+		},
+	}
+}
+
+func (u *httpsUpstream) Exchange(ctx context.Context, query *dns.Msg) (*dns.Msg, error) {
+	// The ID is 0 on the wire so identical queries can be cached (RFC 8484 section 4.1)
+	q := query.Copy()
+	q.Id = 0
+	data, err := q.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.url, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", dohContentType)
+	req.Header.Set("Accept", dohContentType)
+
+	httpResp, err := u.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = httpResp.Body.Close() }()
+
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("DNS over HTTPS upstream %s returned %s", u.url, httpResp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(httpResp.Body, dns.MaxMsgSize))
+	if err != nil {
+		return nil, err
+	}
+
+	resp := new(dns.Msg)
+	if err := resp.Unpack(body); err != nil {
+		return nil, fmt.Errorf("invalid response from DNS over HTTPS upstream %s: %w", u.url, err)
+	}
+	resp.Id = query.Id
+	return resp, nil
+}
+
+func (u *httpsUpstream) Close() {
+	u.client.CloseIdleConnections()
+}
@@ -0,0 +1,183 @@
+package v1upstream
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestParseUpstream(t *testing.T) {
+	tests := []struct {
+		addr           string
+		wantType       string
+		wantAddr       string
+		wantServerName string
+		wantErr        bool
+	}{
+		{addr: "1.1.1.1:53", wantType: "udp", wantAddr: "1.1.1.1:53"},
+		{addr: "1.1.1.1", wantType: "udp", wantAddr: "1.1.1.1:53"},
+		{addr: "udp://[2606:4700:4700::1111]", wantType: "udp", wantAddr: "[2606:4700:4700::1111]:53"},
+		{addr: "tcp://9.9.9.9:5353", wantType: "tcp", wantAddr: "9.9.9.9:5353"},
+		{addr: "tls://1.1.1.1@cloudflare-dns.com", wantType: "tls", wantAddr: "1.1.1.1:853", wantServerName: "cloudflare-dns.com"},
+		{addr: "tls://dns.quad9.net:8853", wantType: "tls", wantAddr: "dns.quad9.net:8853", wantServerName: "dns.quad9.net"},
+		{addr: "https://dns.google/dns-query", wantType: "https", wantAddr: "https://dns.google/dns-query"},
+		{addr: "https://cloudflare-dns.com", wantType: "https", wantAddr: "https://cloudflare-dns.com/dns-query"},
+		{addr: "quic://1.1.1.1", wantErr: true},
+		{addr: "tls://", wantErr: true},
+		{addr: "https:///dns-query", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			u, err := parseUpstream(tt.addr, time.Second)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseUpstream() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			var gotType, gotAddr, gotServerName string
+			switch v := u.(type) {
+			case *plainUpstream:
+				gotType, gotAddr = v.net, v.addr
+			case *tlsUpstream:
+				gotType, gotAddr, gotServerName = "tls", v.addr, v.tlsConfig.ServerName
+			case *httpsUpstream:
+				gotType, gotAddr = "https", v.url
+			}
+			if gotType != tt.wantType || gotAddr != tt.wantAddr || gotServerName != tt.wantServerName {
+				t.Errorf("parseUpstream() = %s %s %s, want %s %s %s", gotType, gotAddr, gotServerName, tt.wantType, tt.wantAddr, tt.wantServerName)
+			}
+		})
+	}
+}
+
+// answer answers every query with an A record of 192.0.2.1
+func answer(r *dns.Msg) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetReply(r)
+	m.Answer = append(m.Answer, &dns.A{
+		Hdr: dns.RR_Header{Name: r.Question[0].Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: 60},
+		A:   net.ParseIP("192.0.2.1"),
+	})
+	return m
+}
+
+func query(name string) *dns.Msg {
+	q := new(dns.Msg)
+	q.SetQuestion(name, dns.TypeA)
+	return q
+}
+
+func TestHTTPSUpstream(t *testing.T) {
+	var gotID atomic.Int32
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost || req.Header.Get("Content-Type") != dohContentType {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		body, _ := io.ReadAll(req.Body)
+		r := new(dns.Msg)
+		if err := r.Unpack(body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		gotID.Store(int32(r.Id))
+		data, _ := answer(r).Pack()
+		w.Header().Set("Content-Type", dohContentType)
+		_, _ = w.Write(data)
+	}))
+	defer server.Close()
+
+	u := newHTTPSUpstream(server.URL+"/dns-query", 2*time.Second)
+	transport := u.client.Transport.(*http.Transport)
+	transport.TLSClientConfig.RootCAs = x509.NewCertPool()
+	transport.TLSClientConfig.RootCAs.AddCert(server.Certificate())
+
+	q := query("www.example.com.")
+	resp, err := u.Exchange(context.Background(), q)
+	if err != nil {
+		t.Fatalf("Exchange() error = %v", err)
+	}
+	if gotID.Load() != 0 {
+		t.Errorf("query ID on the wire = %d, want 0", gotID.Load())
+	}
+	if resp.Id != q.Id || len(resp.Answer) != 1 {
+		t.Errorf("response = %v, want the answer with the query's ID %d", resp, q.Id)
+	}
+
+	// The certificate must be valid for the server name
+	untrusted := newHTTPSUpstream(server.URL+"/dns-query", 2*time.Second)
+	if _, err := untrusted.Exchange(context.Background(), query("www.example.com.")); err == nil {
+		t.Error("Exchange() with an untrusted certificate succeeded")
+	}
+}
+
+func TestTLSUpstream(t *testing.T) {
+	// httptest's certificate is valid for example.com and 127.0.0.1
+	certServer := httptest.NewTLSServer(http.NotFoundHandler())
+	defer certServer.Close()
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: certServer.TLS.Certificates, MinVersion: tls.VersionTLS12})
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	var connections atomic.Int32
+	started := make(chan struct{})
+	server := &dns.Server{
+		Listener:          ln,
+		Net:               "tcp-tls",
+		MaxTCPQueries:     -1,
+		NotifyStartedFunc: func() { close(started) },
+		Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+			_ = w.WriteMsg(answer(r))
+		}),
+		DecorateReader: func(r dns.Reader) dns.Reader {
+			connections.Add(1)
+			return r
+		},
+	}
+	go func() { _ = server.ActivateAndServe() }()
+	defer func() { _ = server.Shutdown() }()
+	<-started
+
+	newUpstream := func(serverName string) *tlsUpstream {
+		u := newTLSUpstream(ln.Addr().String(), serverName, 2*time.Second)
+		u.tlsConfig.RootCAs = x509.NewCertPool()
+		u.tlsConfig.RootCAs.AddCert(certServer.Certificate())
+		return u
+	}
+
+	u := newUpstream("example.com")
+	defer u.Close()
+	for _, name := range []string{"a.example.com.", "b.example.com.", "c.example.com."} {
+		q := query(name)
+		resp, err := u.Exchange(context.Background(), q)
+		if err != nil {
+			t.Fatalf("Exchange(%s) error = %v", name, err)
+		}
+		if resp.Id != q.Id || len(resp.Answer) != 1 || resp.Answer[0].Header().Name != name {
+			t.Errorf("response = %v, want the answer for %s", resp, name)
+		}
+	}
+	if got := connections.Load(); got != 1 {
+		t.Errorf("connections = %d, want 1 reused for all queries", got)
+	}
+
+	// A certificate that isn't valid for the server name is rejected
+	wrongName := newUpstream("dns.example.net")
+	defer wrongName.Close()
+	if _, err := wrongName.Exchange(context.Background(), query("a.example.com.")); err == nil {
+		t.Error("Exchange() with the wrong server name succeeded")
+	}
+}
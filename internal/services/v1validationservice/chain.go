@@ -0,0 +1,519 @@
+package v1validationservice
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/rogerwesterbo/godns/internal/models"
+)
+
+const (
+	// maxTrustTTL bounds how long validated keys and delegations are cached
+	maxTrustTTL = time.Hour
+
+	// bogusTrustTTL bounds how long a broken chain of trust is cached
+	bogusTrustTTL = time.Minute
+
+	// maxTrustEntries bounds the number of names in the chain of trust cache
+	maxTrustEntries = 10000
+
+	// maxNSEC3Iterations is the highest NSEC3 iteration count validated; zones using more
+	// are treated as insecure (RFC 9276 section 3.2)
+	maxNSEC3Iterations = 150
+)
+
+// supportedAlgorithms are the DNSKEY algorithms signatures can be verified with
+var supportedAlgorithms = []uint8{
+	dns.RSASHA1, dns.RSASHA1NSEC3SHA1, dns.RSASHA256, dns.RSASHA512,
+	dns.ECDSAP256SHA256, dns.ECDSAP384SHA384, dns.ED25519,
+}
+
+// supportedDigests are the DS digest types DNSKEYs can be matched with
+var supportedDigests = []uint8{dns.SHA1, dns.SHA256, dns.SHA384}
+
+// zoneTrust is where the chain of trust ends for a name: the closest enclosing zone whose
+// keys were validated, or why the name is insecure or bogus
+type zoneTrust struct {
+	validation models.DNSSECValidation
+	zone       string
+	keys       []*dns.DNSKEY
+	expiresAt  time.Time
+}
+
+// validationError is a reason a response is bogus, with its Extended DNS Error info code
+type validationError struct {
+	code   uint16
+	reason string
+}
+
+func (e *validationError) Error() string {
+	return e.reason
+}
+
+func bogus(code uint16, format string, args ...any) *validationError {
+	return &validationError{code: code, reason: fmt.Sprintf(format, args...)}
+}
+
+func secure() models.DNSSECValidation {
+	return models.DNSSECValidation{Security: models.DNSSECSecure}
+}
+
+func insecure(format string, args ...any) models.DNSSECValidation {
+	return models.DNSSECValidation{Security: models.DNSSECInsecure, Reason: fmt.Sprintf(format, args...)}
+}
+
+func bogusResult(err error) models.DNSSECValidation {
+	if e, ok := err.(*validationError); ok {
+		return models.DNSSECValidation{Security: models.DNSSECBogus, InfoCode: e.code, Reason: e.reason}
+	}
+	return models.DNSSECValidation{Security: models.DNSSECBogus, InfoCode: dns.ExtendedErrorCodeDNSBogus, Reason: err.Error()}
+}
+
+// worse returns the weaker of two results: bogus over insecure over secure
+func worse(a, b models.DNSSECValidation) models.DNSSECValidation {
+	rank := map[string]int{models.DNSSECSecure: 0, models.DNSSECInsecure: 1, models.DNSSECBogus: 2}
+	if rank[b.Security] > rank[a.Security] {
+		return b
+	}
+	return a
+}
+
+// Validate checks the signatures and proofs of nonexistence of an upstream response
+// The response must be to a query sent with the DO bit.
+func (s *V1ValidationService) Validate(ctx context.Context, resp *dns.Msg) models.DNSSECValidation {
+	q := resp.Question[0]
+	qname := dns.CanonicalName(q.Name)
+	if nta := s.negativeTrustAnchor(qname); nta != nil {
+		return insecure("negative trust anchor %s", nta.Domain)
+	}
+
+	// Every RRset in the answer, following the CNAME chain to the name that answers the query
+	result := secure()
+	target := qname
+	for _, key := range rrsetKeys(resp.Answer) {
+		result = worse(result, s.validateRRset(ctx, resp, key.name, key.rrtype))
+		if result.Security == models.DNSSECBogus {
+			return result
+		}
+		if key.rrtype == dns.TypeCNAME && q.Qtype != dns.TypeCNAME && key.name == target {
+			target = dns.CanonicalName(rrset(resp.Answer, key.name, dns.TypeCNAME)[0].(*dns.CNAME).Target)
+		}
+	}
+
+	// NXDOMAIN and NODATA answers need a signed proof of nonexistence; a CNAME chain the
+	// upstream server didn't follow to its end has nothing to prove
+	answered := len(rrset(resp.Answer, target, q.Qtype)) > 0
+	if resp.Rcode == dns.RcodeNameError || (!answered && (len(resp.Answer) == 0 || len(resp.Ns) > 0)) {
+		result = worse(result, s.validateDenial(ctx, resp, target, q.Qtype))
+	}
+
+	return result
+}
+
+// validateRRset validates an RRset of the answer section against the chain of trust of its signer
+func (s *V1ValidationService) validateRRset(ctx context.Context, resp *dns.Msg, name string, rrtype uint16) models.DNSSECValidation {
+	sigs := signatures(resp.Answer, name, rrtype)
+	if len(sigs) == 0 {
+		// CNAMEs synthesised from a DNAME are not signed (RFC 6672 section 5.3.1)
+		if rrtype == dns.TypeCNAME && synthesisedFromDNAME(resp.Answer, name) {
+			return secure()
+		}
+
+		// Unsigned data is only fine in an insecure zone
+		t := s.trustAt(ctx, ownerZoneName(name, rrtype))
+		if t.validation.Security == models.DNSSECSecure {
+			return bogusResult(bogus(dns.ExtendedErrorCodeRRSIGsMissing, "%s %s is not signed", name, dns.TypeToString[rrtype]))
+		}
+		return t.validation
+	}
+
+	t, result := s.signerTrust(ctx, sigs[0].SignerName, name)
+	if t == nil {
+		return result
+	}
+
+	sig, err := verifyRRset(resp.Answer, name, rrtype, t.keys, t.zone, s.now())
+	if err != nil {
+		return bogusResult(err)
+	}
+
+	// A wildcard expansion is only valid when the queried name doesn't exist (RFC 4035 section 5.3.4)
+	if int(sig.Labels) < dns.CountLabel(name) {
+		if err := verifySection(resp.Ns, t.keys, t.zone, s.now()); err != nil {
+			return bogusResult(err)
+		}
+		if !provesWildcardExpansion(resp.Ns, name, int(sig.Labels)) {
+			return bogusResult(bogus(dns.ExtendedErrorCodeNSECMissing, "wildcard answer for %s has no proof that the name doesn't exist", name))
+		}
+	}
+
+	return result
+}
+
+// validateDenial validates the proof of nonexistence in the authority section of a negative answer
+func (s *V1ValidationService) validateDenial(ctx context.Context, resp *dns.Msg, name string, qtype uint16) models.DNSSECValidation {
+	var sigs []*dns.RRSIG
+	for _, rr := range resp.Ns {
+		if sig, ok := rr.(*dns.RRSIG); ok {
+			sigs = append(sigs, sig)
+		}
+	}
+	if len(sigs) == 0 {
+		t := s.trustAt(ctx, ownerZoneName(name, qtype))
+		if t.validation.Security == models.DNSSECSecure {
+			return bogusResult(bogus(dns.ExtendedErrorCodeNSECMissing, "negative answer for %s %s has no signed proof of nonexistence", name, dns.TypeToString[qtype]))
+		}
+		return t.validation
+	}
+
+	t, result := s.signerTrust(ctx, sigs[0].SignerName, name)
+	if t == nil {
+		return result
+	}
+	if err := verifySection(resp.Ns, t.keys, t.zone, s.now()); err != nil {
+		return bogusResult(err)
+	}
+
+	return worse(result, denial(resp.Ns, t.zone, name, qtype, resp.Rcode == dns.RcodeNameError))
+}
+
+// signerTrust returns the validated keys of the zone that signed data for name
+// When the signer's zone is insecure or bogus, that is returned as the result instead.
+func (s *V1ValidationService) signerTrust(ctx context.Context, signer, name string) (*zoneTrust, models.DNSSECValidation) {
+	signer = dns.CanonicalName(signer)
+	if !dns.IsSubDomain(signer, dns.CanonicalName(name)) {
+		return nil, bogusResult(bogus(dns.ExtendedErrorCodeDNSBogus, "%s is signed by %s, which is not one of its zones", name, signer))
+	}
+
+	t := s.trustAt(ctx, signer)
+	if t.validation.Security != models.DNSSECSecure {
+		return nil, t.validation
+	}
+	if t.zone != signer {
+		return nil, bogusResult(bogus(dns.ExtendedErrorCodeDNSKEYMissing, "%s is signed by %s, which is no signed zone", name, signer))
+	}
+	return t, secure()
+}
+
+// trustAt follows the chain of trust from the root down to a name
+func (s *V1ValidationService) trustAt(ctx context.Context, name string) *zoneTrust {
+	name = dns.CanonicalName(name)
+	if nta := s.negativeTrustAnchor(name); nta != nil {
+		return &zoneTrust{validation: insecure("negative trust anchor %s", nta.Domain)}
+	}
+	if t := s.cachedTrust(name); t != nil {
+		return t
+	}
+
+	var t *zoneTrust
+	if name == "." {
+		t = s.rootTrust(ctx)
+	} else {
+		parent := s.trustAt(ctx, parentName(name))
+		if parent.validation.Security != models.DNSSECSecure {
+			return parent
+		}
+		t = s.delegation(ctx, parent, name)
+	}
+
+	s.storeTrust(name, t)
+	return t
+}
+
+// rootTrust validates the root zone's keys with the trust anchors
+func (s *V1ValidationService) rootTrust(ctx context.Context) *zoneTrust {
+	var anchors []*dns.DS
+	for _, anchor := range s.TrustAnchors() {
+		if anchor.Trusted() {
+			anchors = append(anchors, anchor.DS())
+		}
+	}
+	if len(anchors) == 0 {
+		return s.bogusTrust(bogus(dns.ExtendedErrorCodeDNSKEYMissing, "no trusted root trust anchor"))
+	}
+	return s.zoneKeys(ctx, ".", anchors)
+}
+
+// delegation checks whether a name below a secure zone is a zone cut
+// A signed DS RRset leads to the child zone's keys, a delegation proven to have no DS record
+// makes the child zone insecure, and names that are no zone cut stay in the parent zone.
+func (s *V1ValidationService) delegation(ctx context.Context, parent *zoneTrust, name string) *zoneTrust {
+	resp, err := s.query(ctx, name, dns.TypeDS)
+	if err != nil {
+		return s.bogusTrust(bogus(dns.ExtendedErrorCodeDNSSECIndeterminate, "failed to query the DS records of %s: %v", name, err))
+	}
+	if resp.Rcode != dns.RcodeSuccess && resp.Rcode != dns.RcodeNameError {
+		return s.bogusTrust(bogus(dns.ExtendedErrorCodeDNSSECIndeterminate, "DS query for %s answered %s", name, dns.RcodeToString[resp.Rcode]))
+	}
+
+	if set := rrset(resp.Answer, name, dns.TypeDS); len(set) > 0 {
+		if _, err := verifyRRset(resp.Answer, name, dns.TypeDS, parent.keys, parent.zone, s.now()); err != nil {
+			return s.bogusTrust(err)
+		}
+		signers := make([]*dns.DS, 0, len(set))
+		for _, rr := range set {
+			signers = append(signers, rr.(*dns.DS))
+		}
+		return s.zoneKeys(ctx, name, signers)
+	}
+
+	// A CNAME can't be at a zone cut
+	if len(rrset(resp.Answer, name, dns.TypeCNAME)) > 0 {
+		if _, err := verifyRRset(resp.Answer, name, dns.TypeCNAME, parent.keys, parent.zone, s.now()); err != nil {
+			return s.bogusTrust(err)
+		}
+		return s.inZone(parent, resp.Answer)
+	}
+
+	if err := verifySection(resp.Ns, parent.keys, parent.zone, s.now()); err != nil {
+		return s.bogusTrust(err)
+	}
+	switch cut, err := delegationDenial(resp.Ns, name); {
+	case err != nil:
+		return s.bogusTrust(err)
+	case cut:
+		return &zoneTrust{
+			validation: insecure("%s is an unsigned delegation", name),
+			expiresAt:  s.trustExpiry(resp.Ns),
+		}
+	default:
+		return s.inZone(parent, resp.Ns)
+	}
+}
+
+// inZone returns the trust of a name that belongs to the parent's zone
+func (s *V1ValidationService) inZone(parent *zoneTrust, records []dns.RR) *zoneTrust {
+	t := *parent
+	if expiresAt := s.trustExpiry(records); expiresAt.Before(t.expiresAt) {
+		t.expiresAt = expiresAt
+	}
+	return &t
+}
+
+// zoneKeys fetches the DNSKEY RRset of a zone and validates it with the zone's DS records
+func (s *V1ValidationService) zoneKeys(ctx context.Context, zone string, signers []*dns.DS) *zoneTrust {
+	var supported []*dns.DS
+	for _, ds := range signers {
+		if slices.Contains(supportedAlgorithms, ds.Algorithm) && slices.Contains(supportedDigests, ds.DigestType) {
+			supported = append(supported, ds)
+		}
+	}
+	if len(supported) == 0 {
+		// Zones signed with algorithms we can't verify are treated as insecure (RFC 4035 section 5.2)
+		return &zoneTrust{validation: insecure("%s is signed with unsupported algorithms", zone), expiresAt: s.now().Add(maxTrustTTL)}
+	}
+
+	resp, err := s.query(ctx, zone, dns.TypeDNSKEY)
+	if err != nil {
+		return s.bogusTrust(bogus(dns.ExtendedErrorCodeDNSSECIndeterminate, "failed to query the DNSKEY records of %s: %v", zone, err))
+	}
+
+	var keys []*dns.DNSKEY
+	for _, rr := range rrset(resp.Answer, zone, dns.TypeDNSKEY) {
+		key := rr.(*dns.DNSKEY)
+		// Revoked keys must not be used for validation (RFC 5011 section 2.1)
+		if key.Flags&dns.ZONE != 0 && key.Flags&dns.REVOKE == 0 {
+			keys = append(keys, key)
+		}
+	}
+
+	var lastErr error = bogus(dns.ExtendedErrorCodeDNSKEYMissing, "no DNSKEY of %s matches its DS records", zone)
+	for _, key := range keys {
+		if !slices.ContainsFunc(supported, func(ds *dns.DS) bool { return matchesDS(key, ds) }) {
+			continue
+		}
+		if _, err := verifyRRset(resp.Answer, zone, dns.TypeDNSKEY, []*dns.DNSKEY{key}, zone, s.now()); err != nil {
+			lastErr = err
+			continue
+		}
+		return &zoneTrust{
+			validation: secure(),
+			zone:       zone,
+			keys:       keys,
+			expiresAt:  s.trustExpiry(resp.Answer),
+		}
+	}
+
+	return s.bogusTrust(lastErr)
+}
+
+// query sends a query for DNSSEC records upstream
+func (s *V1ValidationService) query(ctx context.Context, name string, qtype uint16) (*dns.Msg, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(name, qtype)
+	m.CheckingDisabled = true
+	m.SetEdns0(ednsBufferSize, true)
+
+	resp, err := s.upstream.Forward(ctx, m)
+	if err == nil && resp == nil {
+		err = fmt.Errorf("no response")
+	}
+	return resp, err
+}
+
+func (s *V1ValidationService) bogusTrust(err error) *zoneTrust {
+	return &zoneTrust{validation: bogusResult(err), expiresAt: s.now().Add(bogusTrustTTL)}
+}
+
+// trustExpiry returns when a result derived from records expires: at the lowest TTL, at most maxTrustTTL from now
+func (s *V1ValidationService) trustExpiry(records []dns.RR) time.Time {
+	ttl := maxTrustTTL
+	for _, rr := range records {
+		if d := time.Duration(rr.Header().Ttl) * time.Second; d < ttl {
+			ttl = d
+		}
+	}
+	return s.now().Add(ttl)
+}
+
+func (s *V1ValidationService) cachedTrust(name string) *zoneTrust {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	t := s.trust[name]
+	if t == nil || !s.now().Before(t.expiresAt) {
+		return nil
+	}
+	return t
+}
+
+func (s *V1ValidationService) storeTrust(name string, t *zoneTrust) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.trust) >= maxTrustEntries {
+		s.trust = make(map[string]*zoneTrust)
+	}
+	s.trust[name] = t
+}
+
+// verifyRRset checks that an RRset of a message section has a valid signature by one of a zone's keys
+// It returns the signature that verified.
+func verifyRRset(section []dns.RR, name string, rrtype uint16, keys []*dns.DNSKEY, zone string, now time.Time) (*dns.RRSIG, error) {
+	set := rrset(section, name, rrtype)
+	sigs := signatures(section, name, rrtype)
+	if len(sigs) == 0 {
+		return nil, bogus(dns.ExtendedErrorCodeRRSIGsMissing, "%s %s is not signed", name, dns.TypeToString[rrtype])
+	}
+
+	var err error = bogus(dns.ExtendedErrorCodeDNSKEYMissing, "%s %s is not signed by a key of %s", name, dns.TypeToString[rrtype], zone)
+	for _, sig := range sigs {
+		if !strings.EqualFold(sig.SignerName, zone) {
+			continue
+		}
+		for _, key := range keys {
+			if key.KeyTag() != sig.KeyTag || key.Algorithm != sig.Algorithm {
+				continue
+			}
+			if verr := sig.Verify(key, set); verr != nil {
+				err = bogus(dns.ExtendedErrorCodeDNSBogus, "invalid signature on %s %s: %v", name, dns.TypeToString[rrtype], verr)
+				continue
+			}
+			if !sig.ValidityPeriod(now) {
+				// Serial number arithmetic, signature times wrap around (RFC 4034 section 3.1.5)
+				if int32(sig.Inception-uint32(now.Unix())) > 0 {
+					err = bogus(dns.ExtendedErrorCodeSignatureNotYetValid, "signature on %s %s is not valid yet", name, dns.TypeToString[rrtype])
+				} else {
+					err = bogus(dns.ExtendedErrorCodeSignatureExpired, "signature on %s %s has expired", name, dns.TypeToString[rrtype])
+				}
+				continue
+			}
+			return sig, nil
+		}
+	}
+	return nil, err
+}
+
+// verifySection checks that every RRset of a message section is signed by one of a zone's keys
+func verifySection(section []dns.RR, keys []*dns.DNSKEY, zone string, now time.Time) error {
+	for _, key := range rrsetKeys(section) {
+		if _, err := verifyRRset(section, key.name, key.rrtype, keys, zone, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// matchesDS reports whether a DS record refers to the key
+func matchesDS(key *dns.DNSKEY, ds *dns.DS) bool {
+	if key.KeyTag() != ds.KeyTag || key.Algorithm != ds.Algorithm {
+		return false
+	}
+	digest := key.ToDS(ds.DigestType)
+	return digest != nil && strings.EqualFold(digest.Digest, ds.Digest)
+}
+
+// synthesisedFromDNAME reports whether a CNAME at name can be synthesised from a DNAME in the section
+func synthesisedFromDNAME(section []dns.RR, name string) bool {
+	for _, rr := range section {
+		if dname, ok := rr.(*dns.DNAME); ok && dns.IsSubDomain(dns.CanonicalName(dname.Hdr.Name), name) && !strings.EqualFold(dname.Hdr.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// rrsetKey identifies an RRset in a message section
+type rrsetKey struct {
+	name   string
+	rrtype uint16
+}
+
+// rrsetKeys lists the RRsets of a message section in order, without signatures and OPT records
+func rrsetKeys(section []dns.RR) []rrsetKey {
+	var keys []rrsetKey
+	for _, rr := range section {
+		hdr := rr.Header()
+		if hdr.Rrtype == dns.TypeRRSIG || hdr.Rrtype == dns.TypeOPT {
+			continue
+		}
+		key := rrsetKey{name: dns.CanonicalName(hdr.Name), rrtype: hdr.Rrtype}
+		if !slices.Contains(keys, key) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// rrset returns the records of an RRset in a message section
+func rrset(section []dns.RR, name string, rrtype uint16) []dns.RR {
+	var set []dns.RR
+	for _, rr := range section {
+		if hdr := rr.Header(); hdr.Rrtype == rrtype && strings.EqualFold(hdr.Name, name) {
+			set = append(set, rr)
+		}
+	}
+	return set
+}
+
+// signatures returns the RRSIGs over an RRset in a message section
+func signatures(section []dns.RR, name string, rrtype uint16) []*dns.RRSIG {
+	var sigs []*dns.RRSIG
+	for _, rr := range section {
+		if sig, ok := rr.(*dns.RRSIG); ok && sig.TypeCovered == rrtype && strings.EqualFold(sig.Hdr.Name, name) {
+			sigs = append(sigs, sig)
+		}
+	}
+	return sigs
+}
+
+// ownerZoneName returns the name whose zone holds an RRset: DS records belong to the parent side of a cut
+func ownerZoneName(name string, rrtype uint16) string {
+	if rrtype == dns.TypeDS {
+		return parentName(name)
+	}
+	return name
+}
+
+// parentName returns the name one label up
+func parentName(name string) string {
+	off, end := dns.NextLabel(name, 0)
+	if end {
+		return "."
+	}
+	return name[off:]
+}
@@ -0,0 +1,285 @@
+package v1validationservice
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/miekg/dns"
+	"github.com/rogerwesterbo/godns/internal/models"
+)
+
+// denial checks the proof of nonexistence of an NXDOMAIN or NODATA answer (RFC 4035 section 5.4,
+// RFC 5155 section 8). The authority section must be verified already.
+func denial(ns []dns.RR, zone, name string, qtype uint16, nxdomain bool) models.DNSSECValidation {
+	nsecs, nsec3s := denialRecords(ns)
+	missing := bogusResult(bogus(dns.ExtendedErrorCodeNSECMissing, "no proof that %s %s doesn't exist", name, dns.TypeToString[qtype]))
+
+	if len(nsec3s) > 0 {
+		if nsec3s[0].Iterations > maxNSEC3Iterations {
+			return insecure("%s uses %d NSEC3 iterations", zone, nsec3s[0].Iterations)
+		}
+		if nxdomain {
+			return nsec3NameError(nsec3s, zone, name, missing)
+		}
+		return nsec3NoData(nsec3s, zone, name, qtype, missing)
+	}
+
+	if nxdomain {
+		if nsecNameError(nsecs, name) {
+			return secure()
+		}
+		return missing
+	}
+	if nsecNoData(nsecs, name, qtype) {
+		return secure()
+	}
+	return missing
+}
+
+// delegationDenial checks the proof that a name has no DS records
+// It reports whether the name is a delegation to an unsigned zone; otherwise the name is no
+// zone cut or doesn't exist, and stays in the zone of its parent.
+func delegationDenial(ns []dns.RR, name string) (bool, error) {
+	nsecs, nsec3s := denialRecords(ns)
+	missing := bogus(dns.ExtendedErrorCodeNSECMissing, "no proof that %s has no DS records", name)
+
+	for _, nsec := range nsecs {
+		if strings.EqualFold(nsec.Hdr.Name, name) {
+			return delegationWithoutDS(nsec.TypeBitMap, name)
+		}
+	}
+	for _, nsec := range nsecs {
+		if nsecCovers(nsec, name) {
+			return false, nil
+		}
+	}
+
+	if len(nsec3s) == 0 {
+		return false, missing
+	}
+	if nsec3s[0].Iterations > maxNSEC3Iterations {
+		return true, nil
+	}
+	for _, nsec3 := range nsec3s {
+		if nsec3.Match(name) {
+			return delegationWithoutDS(nsec3.TypeBitMap, name)
+		}
+	}
+	for _, nsec3 := range nsec3s {
+		if nsec3.Cover(name) {
+			// An opt-out span may hide unsigned delegations (RFC 5155 section 6)
+			return nsec3.Flags&1 == 1, nil
+		}
+	}
+	return false, missing
+}
+
+// delegationWithoutDS reports whether the types at a name are those of a delegation without DS records
+func delegationWithoutDS(types []uint16, name string) (bool, error) {
+	if slices.Contains(types, dns.TypeDS) {
+		return false, bogus(dns.ExtendedErrorCodeDNSBogus, "proof of nonexistence for the DS records of %s lists DS", name)
+	}
+	return slices.Contains(types, dns.TypeNS) && !slices.Contains(types, dns.TypeSOA), nil
+}
+
+// provesWildcardExpansion reports whether the authority section proves that the name of a wildcard
+// answer doesn't exist: an NSEC covering the name, or an NSEC3 covering the next closer name
+func provesWildcardExpansion(ns []dns.RR, name string, labels int) bool {
+	nsecs, nsec3s := denialRecords(ns)
+	for _, nsec := range nsecs {
+		if nsecCovers(nsec, name) {
+			return true
+		}
+	}
+	nextCloser := lastLabels(name, labels+1)
+	for _, nsec3 := range nsec3s {
+		if nsec3.Cover(nextCloser) && !nsec3.Match(nextCloser) {
+			return true
+		}
+	}
+	return false
+}
+
+// nsecNameError checks an NSEC proof that a name and the wildcard at its closest encloser don't exist
+func nsecNameError(nsecs []*dns.NSEC, name string) bool {
+	cover := coveringNSEC(nsecs, name)
+	if cover == nil {
+		return false
+	}
+	wildcard := "*." + closestEncloser(name, cover)
+	for _, nsec := range nsecs {
+		if strings.EqualFold(nsec.Hdr.Name, wildcard) {
+			// The wildcard exists, the answer should have been synthesised from it
+			return false
+		}
+	}
+	return coveringNSEC(nsecs, wildcard) != nil
+}
+
+// nsecNoData checks an NSEC proof that a name has no records of a type
+func nsecNoData(nsecs []*dns.NSEC, name string, qtype uint16) bool {
+	for _, nsec := range nsecs {
+		if strings.EqualFold(nsec.Hdr.Name, name) {
+			return !slices.Contains(nsec.TypeBitMap, qtype) && !slices.Contains(nsec.TypeBitMap, dns.TypeCNAME)
+		}
+	}
+
+	cover := coveringNSEC(nsecs, name)
+	if cover == nil {
+		return false
+	}
+	// An empty non-terminal: names exist below it, so the next name is one of its descendants
+	if dns.IsSubDomain(name, dns.CanonicalName(cover.NextDomain)) {
+		return true
+	}
+	// A wildcard without the type at the closest encloser
+	wildcard := "*." + closestEncloser(name, cover)
+	for _, nsec := range nsecs {
+		if strings.EqualFold(nsec.Hdr.Name, wildcard) {
+			return !slices.Contains(nsec.TypeBitMap, qtype) && !slices.Contains(nsec.TypeBitMap, dns.TypeCNAME)
+		}
+	}
+	return false
+}
+
+// nsec3NameError checks an NSEC3 proof that a name doesn't exist (RFC 5155 section 8.4)
+func nsec3NameError(nsec3s []*dns.NSEC3, zone, name string, missing models.DNSSECValidation) models.DNSSECValidation {
+	encloser, nextCloser := nsec3ClosestEncloser(nsec3s, zone, name)
+	if nextCloser == nil || matchingNSEC3(nsec3s, name) != nil {
+		return missing
+	}
+	if coveringNSEC3(nsec3s, "*."+encloser) == nil {
+		return missing
+	}
+	if nextCloser.Flags&1 == 1 {
+		return insecure("%s is covered by an opt-out NSEC3", name)
+	}
+	return secure()
+}
+
+// nsec3NoData checks an NSEC3 proof that a name has no records of a type (RFC 5155 sections 8.5 to 8.7)
+func nsec3NoData(nsec3s []*dns.NSEC3, zone, name string, qtype uint16, missing models.DNSSECValidation) models.DNSSECValidation {
+	if nsec3 := matchingNSEC3(nsec3s, name); nsec3 != nil {
+		if slices.Contains(nsec3.TypeBitMap, qtype) || slices.Contains(nsec3.TypeBitMap, dns.TypeCNAME) {
+			return missing
+		}
+		return secure()
+	}
+
+	encloser, nextCloser := nsec3ClosestEncloser(nsec3s, zone, name)
+	if nextCloser == nil {
+		return missing
+	}
+	// DS queries for unsigned delegations in an opt-out span
+	if qtype == dns.TypeDS && nextCloser.Flags&1 == 1 {
+		return insecure("%s is covered by an opt-out NSEC3", name)
+	}
+	// A wildcard without the type at the closest encloser
+	if nsec3 := matchingNSEC3(nsec3s, "*."+encloser); nsec3 != nil {
+		if slices.Contains(nsec3.TypeBitMap, qtype) || slices.Contains(nsec3.TypeBitMap, dns.TypeCNAME) {
+			return missing
+		}
+		return secure()
+	}
+	return missing
+}
+
+// nsec3ClosestEncloser finds the closest encloser proof for a name: an NSEC3 matching an ancestor
+// in the zone and one covering the next closer name. It returns the encloser and the covering NSEC3.
+func nsec3ClosestEncloser(nsec3s []*dns.NSEC3, zone, name string) (string, *dns.NSEC3) {
+	for encloser := parentName(name); dns.IsSubDomain(zone, encloser); encloser = parentName(encloser) {
+		if matchingNSEC3(nsec3s, encloser) != nil {
+			nextCloser := lastLabels(name, dns.CountLabel(encloser)+1)
+			return encloser, coveringNSEC3(nsec3s, nextCloser)
+		}
+		if encloser == "." {
+			break
+		}
+	}
+	return "", nil
+}
+
+func matchingNSEC3(nsec3s []*dns.NSEC3, name string) *dns.NSEC3 {
+	for _, nsec3 := range nsec3s {
+		if nsec3.Match(name) {
+			return nsec3
+		}
+	}
+	return nil
+}
+
+func coveringNSEC3(nsec3s []*dns.NSEC3, name string) *dns.NSEC3 {
+	for _, nsec3 := range nsec3s {
+		if nsec3.Cover(name) && !nsec3.Match(name) {
+			return nsec3
+		}
+	}
+	return nil
+}
+
+func coveringNSEC(nsecs []*dns.NSEC, name string) *dns.NSEC {
+	for _, nsec := range nsecs {
+		if nsecCovers(nsec, name) {
+			return nsec
+		}
+	}
+	return nil
+}
+
+// nsecCovers reports whether a name falls between the owner and the next name of an NSEC
+func nsecCovers(nsec *dns.NSEC, name string) bool {
+	owner, next := nsec.Hdr.Name, nsec.NextDomain
+	if canonicalCompare(owner, name) >= 0 {
+		return false
+	}
+	if canonicalCompare(owner, next) < 0 {
+		return canonicalCompare(name, next) < 0
+	}
+	// The last NSEC of a zone points back to the apex
+	return dns.IsSubDomain(dns.CanonicalName(next), dns.CanonicalName(name))
+}
+
+// closestEncloser returns the longest ancestor of a name that exists according to the NSEC covering it
+func closestEncloser(name string, cover *dns.NSEC) string {
+	shared := max(dns.CompareDomainName(name, cover.Hdr.Name), dns.CompareDomainName(name, cover.NextDomain))
+	return lastLabels(name, shared)
+}
+
+// denialRecords returns the NSEC and NSEC3 records of an authority section
+func denialRecords(ns []dns.RR) ([]*dns.NSEC, []*dns.NSEC3) {
+	var nsecs []*dns.NSEC
+	var nsec3s []*dns.NSEC3
+	for _, rr := range ns {
+		switch v := rr.(type) {
+		case *dns.NSEC:
+			nsecs = append(nsecs, v)
+		case *dns.NSEC3:
+			nsec3s = append(nsec3s, v)
+		}
+	}
+	return nsecs, nsec3s
+}
+
+// lastLabels returns the ancestor of a name with the given number of labels
+func lastLabels(name string, n int) string {
+	labels := dns.SplitDomainName(name)
+	if n <= 0 {
+		return "."
+	}
+	if n > len(labels) {
+		n = len(labels)
+	}
+	return dns.Fqdn(strings.ToLower(strings.Join(labels[len(labels)-n:], ".")))
+}
+
+// canonicalCompare orders names as in RFC 4034 section 6.1: label by label from the root,
+// a name sorting before its descendants
+func canonicalCompare(a, b string) int {
+	la, lb := dns.SplitDomainName(a), dns.SplitDomainName(b)
+	for i := 1; i <= len(la) && i <= len(lb); i++ {
+		if c := strings.Compare(strings.ToLower(la[len(la)-i]), strings.ToLower(lb[len(lb)-i])); c != 0 {
+			return c
+		}
+	}
+	return len(la) - len(lb)
+}
@@ -0,0 +1,218 @@
+package v1validationservice
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/rogerwesterbo/godns/internal/models"
+	"github.com/vitistack/common/pkg/loggers/vlog"
+)
+
+const (
+	// addHoldDown is how long a new root key must be seen before it is trusted (RFC 5011 section 2.4.1)
+	addHoldDown = 30 * 24 * time.Hour
+
+	// Bounds of the active refresh interval of the root DNSKEY RRset (RFC 5011 section 2.3)
+	minRefreshInterval = time.Hour
+	maxRefreshInterval = 15 * 24 * time.Hour
+)
+
+// rootTrustAnchors are the DS records of the root zone's key signing keys published by IANA
+// (https://data.iana.org/root-anchors/root-anchors.xml)
+var rootTrustAnchors = []string{
+	"20326 8 2 E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D", // KSK-2017
+	"38696 8 2 683D2D0ACB8C9B712A1948B27F741219298D0A450D612C483AF444A4C0FB2B16", // KSK-2024
+}
+
+// RootTrustAnchors returns the built-in root trust anchors
+func RootTrustAnchors() []models.TrustAnchor {
+	anchors := make([]models.TrustAnchor, 0, len(rootTrustAnchors))
+	for _, ds := range rootTrustAnchors {
+		anchor, err := models.ParseTrustAnchor(ds)
+		if err != nil {
+			panic(err)
+		}
+		anchors = append(anchors, anchor)
+	}
+	return anchors
+}
+
+// TrustAnchors returns the root trust anchors with their RFC 5011 states
+func (s *V1ValidationService) TrustAnchors() []models.TrustAnchor {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return slices.Clone(s.anchors)
+}
+
+// LoadTrustAnchors loads the trust anchors and negative trust anchors from Valkey
+// On the first start the built-in anchors are stored. Built-in anchors added in a later
+// release are merged in; anchors revoked in the meantime stay revoked.
+func (s *V1ValidationService) LoadTrustAnchors(ctx context.Context) error {
+	var anchors []models.TrustAnchor
+	data, err := s.client.GetData(ctx, trustAnchorsKey)
+	if err != nil {
+		if !strings.Contains(err.Error(), "not found") {
+			return fmt.Errorf("failed to get trust anchors: %w", err)
+		}
+	} else if err := json.Unmarshal([]byte(data), &anchors); err != nil {
+		return fmt.Errorf("failed to unmarshal trust anchors: %w", err)
+	}
+
+	changed := err != nil
+	for _, builtin := range s.builtin {
+		known := slices.ContainsFunc(anchors, func(a models.TrustAnchor) bool {
+			return a.KeyTag == builtin.KeyTag && a.DigestType == builtin.DigestType && strings.EqualFold(a.Digest, builtin.Digest)
+		})
+		if !known {
+			anchors = append(anchors, builtin)
+			changed = true
+		}
+	}
+
+	if changed {
+		if err := s.saveTrustAnchors(ctx, anchors); err != nil {
+			return err
+		}
+	} else {
+		s.setTrustAnchors(anchors)
+	}
+	vlog.Infof("Loaded %d DNSSEC trust anchors", len(anchors))
+
+	_, err = s.loadNegativeTrustAnchors(ctx)
+	return err
+}
+
+// RefreshTrustAnchors updates the trust anchors from the root DNSKEY RRset (RFC 5011)
+// A new key signing key is trusted once it has been seen for the hold-down time, a revoked
+// key is never trusted again. The RRset must be signed by a trusted key, otherwise nothing
+// changes. It returns when the next refresh is due.
+func (s *V1ValidationService) RefreshTrustAnchors(ctx context.Context) (time.Duration, error) {
+	resp, err := s.query(ctx, ".", dns.TypeDNSKEY)
+	if err != nil {
+		return minRefreshInterval, fmt.Errorf("failed to query the root DNSKEY records: %w", err)
+	}
+
+	now := s.now().UTC()
+	anchors := s.TrustAnchors()
+
+	var keys []*dns.DNSKEY
+	for _, rr := range rrset(resp.Answer, ".", dns.TypeDNSKEY) {
+		if key := rr.(*dns.DNSKEY); key.Flags&dns.SEP != 0 {
+			keys = append(keys, key)
+		}
+	}
+	selfSigned := func(key *dns.DNSKEY) bool {
+		_, err := verifyRRset(resp.Answer, ".", dns.TypeDNSKEY, []*dns.DNSKEY{key}, ".", now)
+		return err == nil
+	}
+	anchorOf := func(key *dns.DNSKEY) int {
+		return slices.IndexFunc(anchors, func(a models.TrustAnchor) bool { return a.Matches(key) })
+	}
+
+	validated := slices.ContainsFunc(keys, func(key *dns.DNSKEY) bool {
+		i := anchorOf(key)
+		return i >= 0 && anchors[i].Trusted() && key.Flags&dns.REVOKE == 0 && selfSigned(key)
+	})
+	if !validated {
+		return minRefreshInterval, fmt.Errorf("the root DNSKEY RRset is not signed by a trusted key")
+	}
+
+	seen := make([]bool, len(anchors))
+	for _, key := range keys {
+		i := anchorOf(key)
+		switch {
+		case key.Flags&dns.REVOKE != 0:
+			// A revoked key signs the RRset itself to prove the revocation (RFC 5011 section 2.1)
+			if i >= 0 && anchors[i].State != models.TrustAnchorRevoked && selfSigned(key) {
+				vlog.Warnf("DNSSEC trust anchor %d was revoked", anchors[i].KeyTag)
+				anchors[i].State = models.TrustAnchorRevoked
+			}
+		case i < 0:
+			anchor := models.NewTrustAnchor(key.ToDS(dns.SHA256), models.TrustAnchorAddPending)
+			anchor.DNSKEY = key.String()
+			anchor.FirstSeen = &now
+			anchors = append(anchors, anchor)
+			seen = append(seen, true)
+			vlog.Infof("New root key %d seen, trusted after the hold-down time if it stays published", anchor.KeyTag)
+			i = len(anchors) - 1
+		case anchors[i].State == models.TrustAnchorAddPending && now.Sub(*anchors[i].FirstSeen) >= addHoldDown,
+			anchors[i].State == models.TrustAnchorMissing:
+			vlog.Infof("DNSSEC trust anchor %d is trusted now", anchors[i].KeyTag)
+			anchors[i].State = models.TrustAnchorValid
+		}
+
+		if i >= 0 {
+			seen[i] = true
+			anchors[i].LastSeen = &now
+			if anchors[i].DNSKEY == "" && key.Flags&dns.REVOKE == 0 {
+				anchors[i].DNSKEY = key.String()
+			}
+		}
+	}
+
+	kept := make([]models.TrustAnchor, 0, len(anchors))
+	for i, anchor := range anchors {
+		if !seen[i] {
+			switch anchor.State {
+			case models.TrustAnchorAddPending:
+				// A pending key that disappeared starts over when it is seen again
+				continue
+			case models.TrustAnchorValid:
+				anchor.State = models.TrustAnchorMissing
+			}
+		}
+		kept = append(kept, anchor)
+	}
+
+	if err := s.saveTrustAnchors(ctx, kept); err != nil {
+		return minRefreshInterval, err
+	}
+
+	// Refresh at half the RRset's TTL (RFC 5011 section 2.3)
+	next := maxRefreshInterval
+	for _, sig := range signatures(resp.Answer, ".", dns.TypeDNSKEY) {
+		next = min(next, time.Duration(sig.OrigTtl)*time.Second/2)
+	}
+	return max(next, minRefreshInterval), nil
+}
+
+func (s *V1ValidationService) saveTrustAnchors(ctx context.Context, anchors []models.TrustAnchor) error {
+	data, err := json.Marshal(anchors)
+	if err != nil {
+		return fmt.Errorf("failed to marshal trust anchors: %w", err)
+	}
+	if err := s.client.SetData(ctx, trustAnchorsKey, string(data)); err != nil {
+		return fmt.Errorf("failed to save trust anchors: %w", err)
+	}
+
+	s.setTrustAnchors(anchors)
+	return nil
+}
+
+// setTrustAnchors replaces the trust anchors; when the trusted keys changed, the validated
+// chain of trust starts over
+func (s *V1ValidationService) setTrustAnchors(anchors []models.TrustAnchor) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !slices.Equal(trustedDigests(anchors), trustedDigests(s.anchors)) {
+		s.trust = make(map[string]*zoneTrust)
+	}
+	s.anchors = anchors
+}
+
+// trustedDigests returns the digests of the trusted anchors
+func trustedDigests(anchors []models.TrustAnchor) []string {
+	var digests []string
+	for _, anchor := range anchors {
+		if anchor.Trusted() {
+			digests = append(digests, anchor.Digest)
+		}
+	}
+	return digests
+}
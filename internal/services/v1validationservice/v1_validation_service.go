@@ -0,0 +1,334 @@
+package v1validationservice
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/rogerwesterbo/godns/internal/models"
+	"github.com/rogerwesterbo/godns/pkg/interfaces/valkeyinterface"
+	"github.com/vitistack/common/pkg/loggers/vlog"
+)
+
+const (
+	trustAnchorsKey         = "dns:dnssec:trust-anchors"
+	negativeTrustAnchorsKey = "dns:dnssec:negative-trust-anchors"
+
+	// ednsBufferSize is the UDP payload size of queries sent upstream
+	ednsBufferSize = 1232
+
+	// negativeTrustAnchorReload is how often negative trust anchors added on other instances are picked up
+	negativeTrustAnchorReload = time.Minute
+)
+
+// Forwarder sends queries to the upstream server
+type Forwarder interface {
+	Forward(ctx context.Context, query *dns.Msg) (*dns.Msg, error)
+}
+
+// V1ValidationService validates upstream responses with DNSSEC (RFC 4035)
+// Queries are forwarded with the DO and CD bits, so the upstream server returns the signatures
+// and leaves validation to us. The chain of trust is followed from the root trust anchors,
+// which are kept up to date as the root zone announces new keys (RFC 5011). Negative trust
+// anchors (RFC 7646) turn validation off for domains with broken DNSSEC.
+type V1ValidationService struct {
+	client   valkeyinterface.ValkeyInterface
+	upstream Forwarder
+	builtin  []models.TrustAnchor
+	now      func() time.Time
+
+	mu      sync.RWMutex
+	anchors []models.TrustAnchor
+	ntas    []models.NegativeTrustAnchor
+	// trust caches where the chain of trust ends for the names validated so far
+	trust map[string]*zoneTrust
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewV1ValidationService creates a validating resolver in front of the upstream server
+// builtin are the trust anchors used until the root zone has been seen, normally RootTrustAnchors.
+func NewV1ValidationService(client valkeyinterface.ValkeyInterface, upstream Forwarder, builtin []models.TrustAnchor) *V1ValidationService {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &V1ValidationService{
+		client:   client,
+		upstream: upstream,
+		builtin:  builtin,
+		now:      time.Now,
+		trust:    make(map[string]*zoneTrust),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+// Start refreshes the trust anchors and reloads the negative trust anchors in the background
+func (s *V1ValidationService) Start() {
+	s.wg.Add(1)
+	go s.run()
+	vlog.Info("DNSSEC validation of upstream responses enabled")
+}
+
+// Stop stops the background refreshes
+func (s *V1ValidationService) Stop() {
+	s.cancel()
+	s.wg.Wait()
+}
+
+func (s *V1ValidationService) run() {
+	defer s.wg.Done()
+
+	refresh := time.NewTimer(0)
+	defer refresh.Stop()
+	reload := time.NewTicker(negativeTrustAnchorReload)
+	defer reload.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-refresh.C:
+			next, err := s.RefreshTrustAnchors(s.ctx)
+			if err != nil {
+				vlog.Warnf("failed to refresh DNSSEC trust anchors: %v", err)
+			}
+			refresh.Reset(next)
+		case <-reload.C:
+			if _, err := s.loadNegativeTrustAnchors(s.ctx); err != nil {
+				vlog.Warnf("failed to reload negative trust anchors: %v", err)
+			}
+		}
+	}
+}
+
+// Forward forwards a query upstream and validates the response
+// The response keeps its DNSSEC records; Respond turns it into the answer for the client.
+// Queries with the CD bit are forwarded as they are and not validated (RFC 4035 section 3.2.2),
+// as are responses that carry nothing to validate, like SERVFAIL; the validation is nil then.
+func (s *V1ValidationService) Forward(ctx context.Context, query *dns.Msg) (*dns.Msg, *models.DNSSECValidation, error) {
+	if query.CheckingDisabled || len(query.Question) != 1 {
+		resp, err := s.upstream.Forward(ctx, query)
+		return resp, nil, err
+	}
+
+	upstreamQuery := query.Copy()
+	upstreamQuery.CheckingDisabled = true
+	if opt := upstreamQuery.IsEdns0(); opt != nil {
+		opt.SetDo()
+	} else {
+		upstreamQuery.SetEdns0(ednsBufferSize, true)
+	}
+
+	resp, err := s.upstream.Forward(ctx, upstreamQuery)
+	if err != nil || resp == nil {
+		return resp, nil, err
+	}
+	if resp.Rcode != dns.RcodeSuccess && resp.Rcode != dns.RcodeNameError {
+		return resp, nil, nil
+	}
+
+	validation := s.Validate(ctx, resp)
+	if validation.Security == models.DNSSECBogus {
+		vlog.Warnf("bogus DNSSEC response for %s %s: %s", resp.Question[0].Name, dns.TypeToString[resp.Question[0].Qtype], validation.Reason)
+	}
+	return resp, &validation, nil
+}
+
+// Respond builds the answer to the client from a validated upstream response
+// Bogus responses are answered with SERVFAIL and an Extended DNS Error (RFC 8914). Secure
+// responses get the AD bit when the client asked for DNSSEC records or set the AD bit itself
+// (RFC 6840 section 5.7), and DNSSEC records the client didn't ask for are removed.
+func Respond(query, resp *dns.Msg, validation *models.DNSSECValidation) *dns.Msg {
+	if validation == nil {
+		return resp
+	}
+
+	clientOpt := query.IsEdns0()
+	if validation.Security == models.DNSSECBogus {
+		m := new(dns.Msg)
+		m.SetRcode(query, dns.RcodeServerFailure)
+		m.RecursionAvailable = true
+		if clientOpt != nil {
+			m.SetEdns0(clientOpt.UDPSize(), clientOpt.Do())
+			opt := m.IsEdns0()
+			opt.Option = append(opt.Option, &dns.EDNS0_EDE{InfoCode: validation.InfoCode, ExtraText: validation.Reason})
+		}
+		return m
+	}
+
+	dnssecOK := clientOpt != nil && clientOpt.Do()
+	m := resp.Copy()
+	m.AuthenticatedData = validation.Security == models.DNSSECSecure && (dnssecOK || query.AuthenticatedData)
+
+	if !dnssecOK {
+		qtype := query.Question[0].Qtype
+		m.Answer = withoutDNSSEC(m.Answer, qtype)
+		m.Ns = withoutDNSSEC(m.Ns, qtype)
+		m.Extra = withoutDNSSEC(m.Extra, qtype)
+	}
+
+	// The OPT record follows the client's query
+	extra := m.Extra[:0]
+	for _, rr := range m.Extra {
+		if opt, ok := rr.(*dns.OPT); ok {
+			if clientOpt == nil {
+				continue
+			}
+			opt.SetUDPSize(clientOpt.UDPSize())
+			opt.SetDo(dnssecOK)
+		}
+		extra = append(extra, rr)
+	}
+	m.Extra = extra
+
+	return m
+}
+
+// withoutDNSSEC drops the RRSIG, NSEC and NSEC3 records from a section, unless they were queried
+func withoutDNSSEC(section []dns.RR, qtype uint16) []dns.RR {
+	out := make([]dns.RR, 0, len(section))
+	for _, rr := range section {
+		switch t := rr.Header().Rrtype; t {
+		case dns.TypeRRSIG, dns.TypeNSEC, dns.TypeNSEC3:
+			if t != qtype {
+				continue
+			}
+		}
+		out = append(out, rr)
+	}
+	return out
+}
+
+// ListNegativeTrustAnchors returns the negative trust anchors that haven't expired
+func (s *V1ValidationService) ListNegativeTrustAnchors(ctx context.Context) ([]models.NegativeTrustAnchor, error) {
+	return s.loadNegativeTrustAnchors(ctx)
+}
+
+// AddNegativeTrustAnchor turns validation off for a domain and the names below it
+func (s *V1ValidationService) AddNegativeTrustAnchor(ctx context.Context, nta *models.NegativeTrustAnchor) error {
+	if err := nta.Validate(); err != nil {
+		return err
+	}
+	now := s.now().UTC()
+	if nta.Expired(now) {
+		return fmt.Errorf("invalid negative trust anchor %s: expires_at is in the past", nta.Domain)
+	}
+
+	ntas, err := s.loadNegativeTrustAnchors(ctx)
+	if err != nil {
+		return err
+	}
+	for _, existing := range ntas {
+		if existing.Domain == nta.Domain {
+			return fmt.Errorf("negative trust anchor %s already exists", nta.Domain)
+		}
+	}
+
+	nta.CreatedAt = now
+	if err := s.saveNegativeTrustAnchors(ctx, append(ntas, *nta)); err != nil {
+		return err
+	}
+
+	vlog.Infof("Added negative trust anchor %s: %s", nta.Domain, nta.Reason)
+	return nil
+}
+
+// DeleteNegativeTrustAnchor turns validation on again for a domain
+func (s *V1ValidationService) DeleteNegativeTrustAnchor(ctx context.Context, domain string) error {
+	domain = dns.CanonicalName(domain)
+
+	ntas, err := s.loadNegativeTrustAnchors(ctx)
+	if err != nil {
+		return err
+	}
+	kept := make([]models.NegativeTrustAnchor, 0, len(ntas))
+	for _, nta := range ntas {
+		if nta.Domain != domain {
+			kept = append(kept, nta)
+		}
+	}
+	if len(kept) == len(ntas) {
+		return fmt.Errorf("negative trust anchor %s not found", domain)
+	}
+
+	if err := s.saveNegativeTrustAnchors(ctx, kept); err != nil {
+		return err
+	}
+
+	vlog.Infof("Deleted negative trust anchor %s", domain)
+	return nil
+}
+
+// loadNegativeTrustAnchors reads the negative trust anchors from Valkey and applies them
+func (s *V1ValidationService) loadNegativeTrustAnchors(ctx context.Context) ([]models.NegativeTrustAnchor, error) {
+	var ntas []models.NegativeTrustAnchor
+	data, err := s.client.GetData(ctx, negativeTrustAnchorsKey)
+	if err != nil {
+		if !strings.Contains(err.Error(), "not found") {
+			return nil, fmt.Errorf("failed to get negative trust anchors: %w", err)
+		}
+	} else if err := json.Unmarshal([]byte(data), &ntas); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal negative trust anchors: %w", err)
+	}
+
+	now := s.now()
+	active := make([]models.NegativeTrustAnchor, 0, len(ntas))
+	for _, nta := range ntas {
+		if !nta.Expired(now) {
+			active = append(active, nta)
+		}
+	}
+
+	s.setNegativeTrustAnchors(active)
+	return active, nil
+}
+
+func (s *V1ValidationService) saveNegativeTrustAnchors(ctx context.Context, ntas []models.NegativeTrustAnchor) error {
+	data, err := json.Marshal(ntas)
+	if err != nil {
+		return fmt.Errorf("failed to marshal negative trust anchors: %w", err)
+	}
+	if err := s.client.SetData(ctx, negativeTrustAnchorsKey, string(data)); err != nil {
+		return fmt.Errorf("failed to save negative trust anchors: %w", err)
+	}
+
+	s.setNegativeTrustAnchors(ntas)
+	return nil
+}
+
+// setNegativeTrustAnchors replaces the negative trust anchors; validation results cached
+// before a change may be wrong now, so they are dropped
+func (s *V1ValidationService) setNegativeTrustAnchors(ntas []models.NegativeTrustAnchor) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	changed := len(ntas) != len(s.ntas)
+	for i := 0; !changed && i < len(ntas); i++ {
+		changed = ntas[i].Domain != s.ntas[i].Domain
+	}
+	s.ntas = ntas
+	if changed {
+		s.trust = make(map[string]*zoneTrust)
+	}
+}
+
+// negativeTrustAnchor returns the negative trust anchor covering a name, if any
+func (s *V1ValidationService) negativeTrustAnchor(name string) *models.NegativeTrustAnchor {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := s.now()
+	for i := range s.ntas {
+		if s.ntas[i].Covers(name, now) {
+			nta := s.ntas[i]
+			return &nta
+		}
+	}
+	return nil
+}
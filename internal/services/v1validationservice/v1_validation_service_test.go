@@ -0,0 +1,398 @@
+package v1validationservice
+
+import (
+	"context"
+	"crypto"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/rogerwesterbo/godns/internal/models"
+	"github.com/rogerwesterbo/godns/internal/testutil/valkeytest"
+)
+
+// fakeUpstream answers queries from canned responses
+type fakeUpstream struct {
+	mu      sync.Mutex
+	answers map[string]*dns.Msg
+}
+
+func (f *fakeUpstream) set(name string, qtype uint16, rcode int, answer, ns []dns.RR) {
+	m := new(dns.Msg)
+	m.SetQuestion(name, qtype)
+	m.Response = true
+	m.Rcode = rcode
+	m.Answer = answer
+	m.Ns = ns
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.answers[dns.CanonicalName(name)+"/"+dns.TypeToString[qtype]] = m
+}
+
+func (f *fakeUpstream) Forward(ctx context.Context, query *dns.Msg) (*dns.Msg, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	q := query.Question[0]
+	m, ok := f.answers[dns.CanonicalName(q.Name)+"/"+dns.TypeToString[q.Qtype]]
+	if !ok {
+		return nil, fmt.Errorf("no answer for %s %s", q.Name, dns.TypeToString[q.Qtype])
+	}
+	resp := m.Copy()
+	resp.Id = query.Id
+	return resp, nil
+}
+
+// testZone is a signed zone with a single key
+type testZone struct {
+	name string
+	key  *dns.DNSKEY
+	priv crypto.Signer
+}
+
+func newTestZone(t *testing.T, name string, flags uint16) *testZone {
+	t.Helper()
+	key := &dns.DNSKEY{
+		Hdr:       dns.RR_Header{Name: name, Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: 3600},
+		Flags:     flags,
+		Protocol:  3,
+		Algorithm: dns.ECDSAP256SHA256,
+	}
+	priv, err := key.Generate(256)
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	return &testZone{name: name, key: key, priv: priv.(crypto.Signer)}
+}
+
+// sign returns an RRset followed by its signature, valid between inception and expiration
+func (z *testZone) sign(t *testing.T, inception, expiration time.Time, rrs ...dns.RR) []dns.RR {
+	t.Helper()
+	sig := &dns.RRSIG{
+		Hdr:        dns.RR_Header{Name: rrs[0].Header().Name, Rrtype: dns.TypeRRSIG, Class: dns.ClassINET, Ttl: rrs[0].Header().Ttl},
+		KeyTag:     z.key.KeyTag(),
+		SignerName: z.name,
+		Algorithm:  z.key.Algorithm,
+		Inception:  uint32(inception.Unix()),
+		Expiration: uint32(expiration.Unix()),
+	}
+	if err := sig.Sign(z.priv, rrs); err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+	return append(rrs, sig)
+}
+
+func (z *testZone) signNow(t *testing.T, rrs ...dns.RR) []dns.RR {
+	now := time.Now()
+	return z.sign(t, now.Add(-time.Hour), now.Add(time.Hour), rrs...)
+}
+
+func mustRR(t *testing.T, s string) dns.RR {
+	t.Helper()
+	rr, err := dns.NewRR(s)
+	if err != nil {
+		t.Fatalf("NewRR(%q) error = %v", s, err)
+	}
+	return rr
+}
+
+// newTestHierarchy serves a signed root with a signed zone example. and an unsigned delegation insecure.
+func newTestHierarchy(t *testing.T) (*V1ValidationService, *fakeUpstream, *testZone) {
+	t.Helper()
+	root := newTestZone(t, ".", dns.ZONE|dns.SEP)
+	example := newTestZone(t, "example.", dns.ZONE|dns.SEP)
+
+	upstream := &fakeUpstream{answers: make(map[string]*dns.Msg)}
+	upstream.set(".", dns.TypeDNSKEY, dns.RcodeSuccess, root.signNow(t, root.key), nil)
+	upstream.set("example.", dns.TypeDS, dns.RcodeSuccess, root.signNow(t, example.key.ToDS(dns.SHA256)), nil)
+	upstream.set("example.", dns.TypeDNSKEY, dns.RcodeSuccess, example.signNow(t, example.key), nil)
+	upstream.set("www.example.", dns.TypeDS, dns.RcodeSuccess, nil,
+		example.signNow(t, mustRR(t, "www.example. 300 IN NSEC example. A RRSIG NSEC")))
+	upstream.set("insecure.", dns.TypeDS, dns.RcodeSuccess, nil,
+		root.signNow(t, mustRR(t, "insecure. 300 IN NSEC . NS RRSIG NSEC")))
+
+	anchor := models.NewTrustAnchor(root.key.ToDS(dns.SHA256), models.TrustAnchorValid)
+	s := NewV1ValidationService(valkeytest.NewMemoryValkey(), upstream, []models.TrustAnchor{anchor})
+	if err := s.LoadTrustAnchors(context.Background()); err != nil {
+		t.Fatalf("LoadTrustAnchors() error = %v", err)
+	}
+	return s, upstream, example
+}
+
+func response(name string, qtype uint16, rcode int, answer, ns []dns.RR) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetQuestion(name, qtype)
+	m.Response = true
+	m.Rcode = rcode
+	m.Answer = answer
+	m.Ns = ns
+	return m
+}
+
+func TestValidate(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+
+	tests := []struct {
+		name         string
+		nta          string
+		resp         func(t *testing.T, example *testZone) *dns.Msg
+		wantSecurity string
+		wantInfoCode uint16
+	}{
+		{
+			name: "signed answer",
+			resp: func(t *testing.T, example *testZone) *dns.Msg {
+				return response("www.example.", dns.TypeA, dns.RcodeSuccess, example.signNow(t, mustRR(t, "www.example. 300 IN A 192.0.2.1")), nil)
+			},
+			wantSecurity: models.DNSSECSecure,
+		},
+		{
+			name: "tampered answer",
+			resp: func(t *testing.T, example *testZone) *dns.Msg {
+				answer := example.signNow(t, mustRR(t, "www.example. 300 IN A 192.0.2.1"))
+				answer[0].(*dns.A).A = net.ParseIP("192.0.2.99")
+				return response("www.example.", dns.TypeA, dns.RcodeSuccess, answer, nil)
+			},
+			wantSecurity: models.DNSSECBogus,
+			wantInfoCode: dns.ExtendedErrorCodeDNSBogus,
+		},
+		{
+			name: "expired signature",
+			resp: func(t *testing.T, example *testZone) *dns.Msg {
+				answer := example.sign(t, now.Add(-48*time.Hour), now.Add(-24*time.Hour), mustRR(t, "www.example. 300 IN A 192.0.2.1"))
+				return response("www.example.", dns.TypeA, dns.RcodeSuccess, answer, nil)
+			},
+			wantSecurity: models.DNSSECBogus,
+			wantInfoCode: dns.ExtendedErrorCodeSignatureExpired,
+		},
+		{
+			name: "unsigned answer in a signed zone",
+			resp: func(t *testing.T, example *testZone) *dns.Msg {
+				return response("www.example.", dns.TypeA, dns.RcodeSuccess, []dns.RR{mustRR(t, "www.example. 300 IN A 192.0.2.1")}, nil)
+			},
+			wantSecurity: models.DNSSECBogus,
+			wantInfoCode: dns.ExtendedErrorCodeRRSIGsMissing,
+		},
+		{
+			name: "unsigned answer below an unsigned delegation",
+			resp: func(t *testing.T, example *testZone) *dns.Msg {
+				return response("host.insecure.", dns.TypeA, dns.RcodeSuccess, []dns.RR{mustRR(t, "host.insecure. 300 IN A 192.0.2.1")}, nil)
+			},
+			wantSecurity: models.DNSSECInsecure,
+		},
+		{
+			name: "NXDOMAIN with NSEC proof",
+			resp: func(t *testing.T, example *testZone) *dns.Msg {
+				ns := example.signNow(t, mustRR(t, "example. 300 IN NSEC www.example. SOA NS RRSIG NSEC DNSKEY"))
+				return response("nope.example.", dns.TypeA, dns.RcodeNameError, nil, ns)
+			},
+			wantSecurity: models.DNSSECSecure,
+		},
+		{
+			name: "NXDOMAIN without proof",
+			resp: func(t *testing.T, example *testZone) *dns.Msg {
+				ns := example.signNow(t, mustRR(t, "www.example. 300 IN NSEC example. A RRSIG NSEC"))
+				return response("nope.example.", dns.TypeA, dns.RcodeNameError, nil, ns)
+			},
+			wantSecurity: models.DNSSECBogus,
+			wantInfoCode: dns.ExtendedErrorCodeNSECMissing,
+		},
+		{
+			name: "tampered answer below a negative trust anchor",
+			nta:  "example.",
+			resp: func(t *testing.T, example *testZone) *dns.Msg {
+				answer := example.signNow(t, mustRR(t, "www.example. 300 IN A 192.0.2.1"))
+				answer[0].(*dns.A).A = net.ParseIP("192.0.2.99")
+				return response("www.example.", dns.TypeA, dns.RcodeSuccess, answer, nil)
+			},
+			wantSecurity: models.DNSSECInsecure,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _, example := newTestHierarchy(t)
+			if tt.nta != "" {
+				if err := s.AddNegativeTrustAnchor(ctx, &models.NegativeTrustAnchor{Domain: tt.nta}); err != nil {
+					t.Fatalf("AddNegativeTrustAnchor() error = %v", err)
+				}
+			}
+
+			got := s.Validate(ctx, tt.resp(t, example))
+			if got.Security != tt.wantSecurity || got.InfoCode != tt.wantInfoCode {
+				t.Errorf("Validate() = %+v, want security %s info code %d", got, tt.wantSecurity, tt.wantInfoCode)
+			}
+		})
+	}
+}
+
+func TestRespond(t *testing.T) {
+	query := new(dns.Msg)
+	query.SetQuestion("www.example.", dns.TypeA)
+	query.SetEdns0(4096, false)
+
+	resp := response("www.example.", dns.TypeA, dns.RcodeSuccess, []dns.RR{
+		mustRR(t, "www.example. 300 IN A 192.0.2.1"),
+		mustRR(t, "www.example. 300 IN RRSIG A 13 2 300 20300101000000 20200101000000 12345 example. AAAA"),
+	}, nil)
+	resp.SetEdns0(1232, true)
+
+	m := Respond(query, resp, &models.DNSSECValidation{Security: models.DNSSECSecure})
+	if len(m.Answer) != 1 || m.Answer[0].Header().Rrtype != dns.TypeA {
+		t.Errorf("Respond() answer = %v, want the A record without its signature", m.Answer)
+	}
+	if m.AuthenticatedData {
+		t.Error("Respond() set AD for a client that asked for neither DO nor AD")
+	}
+	if opt := m.IsEdns0(); opt == nil || opt.Do() || opt.UDPSize() != 4096 {
+		t.Errorf("Respond() OPT = %v, want the client's UDP size without DO", opt)
+	}
+
+	query.AuthenticatedData = true
+	if m := Respond(query, resp, &models.DNSSECValidation{Security: models.DNSSECSecure}); !m.AuthenticatedData {
+		t.Error("Respond() didn't set AD on a secure answer for a client that set AD")
+	}
+
+	m = Respond(query, resp, &models.DNSSECValidation{Security: models.DNSSECBogus, InfoCode: dns.ExtendedErrorCodeSignatureExpired, Reason: "expired"})
+	if m.Rcode != dns.RcodeServerFailure || len(m.Answer) != 0 {
+		t.Errorf("Respond() = %s with %d answers, want SERVFAIL without answers", dns.RcodeToString[m.Rcode], len(m.Answer))
+	}
+	var ede *dns.EDNS0_EDE
+	if opt := m.IsEdns0(); opt != nil {
+		for _, o := range opt.Option {
+			if e, ok := o.(*dns.EDNS0_EDE); ok {
+				ede = e
+			}
+		}
+	}
+	if ede == nil || ede.InfoCode != dns.ExtendedErrorCodeSignatureExpired {
+		t.Errorf("Respond() EDE = %v, want info code %d", ede, dns.ExtendedErrorCodeSignatureExpired)
+	}
+}
+
+func TestNegativeTrustAnchors(t *testing.T) {
+	ctx := context.Background()
+	s, _, _ := newTestHierarchy(t)
+
+	if err := s.AddNegativeTrustAnchor(ctx, &models.NegativeTrustAnchor{Domain: "Broken.Example", Reason: "expired signatures"}); err != nil {
+		t.Fatalf("AddNegativeTrustAnchor() error = %v", err)
+	}
+	err := s.AddNegativeTrustAnchor(ctx, &models.NegativeTrustAnchor{Domain: "broken.example."})
+	if err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("AddNegativeTrustAnchor() duplicate error = %v, want already exists", err)
+	}
+	err = s.AddNegativeTrustAnchor(ctx, &models.NegativeTrustAnchor{Domain: "."})
+	if err == nil || !strings.Contains(err.Error(), "invalid") {
+		t.Errorf("AddNegativeTrustAnchor() root error = %v, want invalid", err)
+	}
+	past := time.Now().Add(-time.Hour)
+	err = s.AddNegativeTrustAnchor(ctx, &models.NegativeTrustAnchor{Domain: "old.example.", ExpiresAt: &past})
+	if err == nil || !strings.Contains(err.Error(), "invalid") {
+		t.Errorf("AddNegativeTrustAnchor() expired error = %v, want invalid", err)
+	}
+
+	ntas, err := s.ListNegativeTrustAnchors(ctx)
+	if err != nil {
+		t.Fatalf("ListNegativeTrustAnchors() error = %v", err)
+	}
+	if len(ntas) != 1 || ntas[0].Domain != "broken.example." {
+		t.Fatalf("ListNegativeTrustAnchors() = %+v, want broken.example.", ntas)
+	}
+	if s.negativeTrustAnchor("www.broken.example.") == nil {
+		t.Error("negative trust anchor doesn't cover a name below its domain")
+	}
+
+	// Anchors expire on their own
+	s.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	soon := time.Now().Add(time.Hour)
+	if err := s.saveNegativeTrustAnchors(ctx, []models.NegativeTrustAnchor{{Domain: "broken.example.", ExpiresAt: &soon}}); err != nil {
+		t.Fatalf("saveNegativeTrustAnchors() error = %v", err)
+	}
+	if ntas, _ := s.ListNegativeTrustAnchors(ctx); len(ntas) != 0 {
+		t.Errorf("ListNegativeTrustAnchors() = %+v, want expired anchors removed", ntas)
+	}
+
+	if err := s.DeleteNegativeTrustAnchor(ctx, "broken.example."); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("DeleteNegativeTrustAnchor() error = %v, want not found", err)
+	}
+}
+
+func TestRefreshTrustAnchors(t *testing.T) {
+	ctx := context.Background()
+	start := time.Now()
+	inception, expiration := start.Add(-time.Hour), start.Add(90*24*time.Hour)
+
+	current := newTestZone(t, ".", dns.ZONE|dns.SEP)
+	next := newTestZone(t, ".", dns.ZONE|dns.SEP)
+	upstream := &fakeUpstream{answers: make(map[string]*dns.Msg)}
+
+	anchor := models.NewTrustAnchor(current.key.ToDS(dns.SHA256), models.TrustAnchorValid)
+	s := NewV1ValidationService(valkeytest.NewMemoryValkey(), upstream, []models.TrustAnchor{anchor})
+	if err := s.LoadTrustAnchors(ctx); err != nil {
+		t.Fatalf("LoadTrustAnchors() error = %v", err)
+	}
+
+	states := func() map[uint16]string {
+		got := make(map[uint16]string)
+		for _, a := range s.TrustAnchors() {
+			got[a.KeyTag] = a.State
+		}
+		return got
+	}
+	refresh := func(at time.Time) {
+		t.Helper()
+		s.now = func() time.Time { return at }
+		if _, err := s.RefreshTrustAnchors(ctx); err != nil {
+			t.Fatalf("RefreshTrustAnchors() error = %v", err)
+		}
+	}
+
+	// A new key signing key is published next to the current one
+	answer := current.sign(t, inception, expiration, current.key, next.key)
+	upstream.set(".", dns.TypeDNSKEY, dns.RcodeSuccess, answer, nil)
+	refresh(start)
+	if got := states()[next.key.KeyTag()]; got != models.TrustAnchorAddPending {
+		t.Fatalf("new key state = %q, want %q", got, models.TrustAnchorAddPending)
+	}
+
+	refresh(start.Add(24 * time.Hour))
+	if got := states()[next.key.KeyTag()]; got != models.TrustAnchorAddPending {
+		t.Fatalf("new key state before the hold-down = %q, want %q", got, models.TrustAnchorAddPending)
+	}
+
+	refresh(start.Add(addHoldDown + time.Hour))
+	if got := states()[next.key.KeyTag()]; got != models.TrustAnchorValid {
+		t.Fatalf("new key state after the hold-down = %q, want %q", got, models.TrustAnchorValid)
+	}
+
+	// The old key is revoked; it signs the RRset itself to prove it
+	revoked := *current
+	revokedKey := *current.key
+	revokedKey.Flags |= dns.REVOKE
+	revoked.key = &revokedKey
+	answer = revoked.sign(t, inception, expiration, &revokedKey, next.key)
+	answer = append(answer, next.sign(t, inception, expiration, &revokedKey, next.key)[2])
+	upstream.set(".", dns.TypeDNSKEY, dns.RcodeSuccess, answer, nil)
+	refresh(start.Add(addHoldDown + 2*time.Hour))
+
+	got := states()
+	if got[current.key.KeyTag()] != models.TrustAnchorRevoked {
+		t.Errorf("revoked key state = %q, want %q", got[current.key.KeyTag()], models.TrustAnchorRevoked)
+	}
+	if got[next.key.KeyTag()] != models.TrustAnchorValid {
+		t.Errorf("new key state = %q, want %q", got[next.key.KeyTag()], models.TrustAnchorValid)
+	}
+
+	// A DNSKEY RRset signed only by a key that isn't trusted is ignored
+	upstream.set(".", dns.TypeDNSKEY, dns.RcodeSuccess, revoked.sign(t, inception, expiration, &revokedKey), nil)
+	s.now = func() time.Time { return start.Add(addHoldDown + 3*time.Hour) }
+	if _, err := s.RefreshTrustAnchors(ctx); err == nil {
+		t.Error("RefreshTrustAnchors() accepted an RRset signed by a revoked key")
+	}
+}
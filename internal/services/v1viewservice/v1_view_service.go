@@ -0,0 +1,262 @@
+package v1viewservice
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rogerwesterbo/godns/internal/models"
+	"github.com/rogerwesterbo/godns/pkg/interfaces/valkeyinterface"
+	"github.com/vitistack/common/pkg/loggers/vlog"
+)
+
+const (
+	viewsKey = "dns:config:views"
+
+	// viewReload is how often views changed on other instances are picked up
+	viewReload = time.Minute
+)
+
+// viewPrefix is a client network of a view
+type viewPrefix struct {
+	prefix netip.Prefix
+	view   string
+}
+
+// V1ViewService manages split-horizon views and selects the view of DNS clients
+type V1ViewService struct {
+	valkeyClient valkeyinterface.ValkeyInterface
+
+	mu       sync.RWMutex
+	prefixes []viewPrefix // sorted from the longest prefix to the shortest
+
+	// viewsMu serializes changes to the stored views
+	viewsMu sync.Mutex
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewV1ViewService creates a new view service
+func NewV1ViewService(valkeyClient valkeyinterface.ValkeyInterface) *V1ViewService {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &V1ViewService{
+		valkeyClient: valkeyClient,
+		ctx:          ctx,
+		cancel:       cancel,
+	}
+}
+
+// Start loads the views and picks up changes made on other instances
+func (s *V1ViewService) Start() {
+	if _, err := s.loadViews(s.ctx); err != nil {
+		vlog.Warnf("failed to load views: %v", err)
+	}
+
+	s.wg.Add(1)
+	go s.run()
+}
+
+// Stop stops reloading the views
+func (s *V1ViewService) Stop() {
+	s.cancel()
+	s.wg.Wait()
+}
+
+func (s *V1ViewService) run() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(viewReload)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+			// A reload between reading and saving a change would apply the old views
+			s.viewsMu.Lock()
+			if _, err := s.loadViews(s.ctx); err != nil {
+				vlog.Warnf("failed to reload views: %v", err)
+			}
+			s.viewsMu.Unlock()
+		}
+	}
+}
+
+// Select returns the view of a client: the view with the longest prefix containing its
+// address, or "" for clients in no view
+func (s *V1ViewService) Select(ip netip.Addr) string {
+	if !ip.IsValid() {
+		return ""
+	}
+	// IPv4 clients on dual-stack sockets have IPv4-mapped addresses
+	ip = ip.Unmap()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, p := range s.prefixes {
+		if p.prefix.Contains(ip) {
+			return p.view
+		}
+	}
+	return ""
+}
+
+// ListViews returns the views
+func (s *V1ViewService) ListViews(ctx context.Context) ([]models.View, error) {
+	return s.loadViews(ctx)
+}
+
+// GetView returns a view by name
+func (s *V1ViewService) GetView(ctx context.Context, name string) (*models.View, error) {
+	name = strings.ToLower(name)
+	views, err := s.loadViews(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range views {
+		if v.Name == name {
+			return &v, nil
+		}
+	}
+	return nil, fmt.Errorf("view %s not found", name)
+}
+
+// CreateView adds a view
+func (s *V1ViewService) CreateView(ctx context.Context, v *models.View) error {
+	if err := v.Validate(); err != nil {
+		return err
+	}
+
+	s.viewsMu.Lock()
+	defer s.viewsMu.Unlock()
+
+	views, err := s.loadViews(ctx)
+	if err != nil {
+		return err
+	}
+	if slices.ContainsFunc(views, func(existing models.View) bool { return existing.Name == v.Name }) {
+		return fmt.Errorf("view %s already exists", v.Name)
+	}
+
+	v.CreatedAt = time.Now().UTC()
+	v.UpdatedAt = v.CreatedAt
+	if err := s.saveViews(ctx, append(views, *v)); err != nil {
+		return err
+	}
+
+	vlog.Infof("Added view %s: %s", v.Name, strings.Join(v.Prefixes, ", "))
+	return nil
+}
+
+// UpdateView replaces the prefixes and description of a view
+func (s *V1ViewService) UpdateView(ctx context.Context, name string, v *models.View) error {
+	v.Name = name
+	if err := v.Validate(); err != nil {
+		return err
+	}
+
+	s.viewsMu.Lock()
+	defer s.viewsMu.Unlock()
+
+	views, err := s.loadViews(ctx)
+	if err != nil {
+		return err
+	}
+	i := slices.IndexFunc(views, func(existing models.View) bool { return existing.Name == v.Name })
+	if i < 0 {
+		return fmt.Errorf("view %s not found", v.Name)
+	}
+
+	v.CreatedAt = views[i].CreatedAt
+	v.UpdatedAt = time.Now().UTC()
+	views[i] = *v
+	if err := s.saveViews(ctx, views); err != nil {
+		return err
+	}
+
+	vlog.Infof("Updated view %s: %s", v.Name, strings.Join(v.Prefixes, ", "))
+	return nil
+}
+
+// DeleteView removes a view; the overlays of zones for the view are kept but no longer served
+func (s *V1ViewService) DeleteView(ctx context.Context, name string) error {
+	name = strings.ToLower(name)
+
+	s.viewsMu.Lock()
+	defer s.viewsMu.Unlock()
+
+	views, err := s.loadViews(ctx)
+	if err != nil {
+		return err
+	}
+	kept := slices.DeleteFunc(views, func(v models.View) bool { return v.Name == name })
+	if len(kept) == len(views) {
+		return fmt.Errorf("view %s not found", name)
+	}
+	if err := s.saveViews(ctx, kept); err != nil {
+		return err
+	}
+
+	vlog.Infof("Deleted view %s", name)
+	return nil
+}
+
+// loadViews reads the views from Valkey and applies them
+func (s *V1ViewService) loadViews(ctx context.Context) ([]models.View, error) {
+	var views []models.View
+	data, err := s.valkeyClient.GetData(ctx, viewsKey)
+	if err != nil {
+		if !strings.Contains(err.Error(), "not found") {
+			return nil, fmt.Errorf("failed to get views: %w", err)
+		}
+	} else if err := json.Unmarshal([]byte(data), &views); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal views: %w", err)
+	}
+
+	s.setViews(views)
+	return views, nil
+}
+
+func (s *V1ViewService) saveViews(ctx context.Context, views []models.View) error {
+	data, err := json.Marshal(views)
+	if err != nil {
+		return fmt.Errorf("failed to marshal views: %w", err)
+	}
+	if err := s.valkeyClient.SetData(ctx, viewsKey, string(data)); err != nil {
+		return fmt.Errorf("failed to save views: %w", err)
+	}
+
+	s.setViews(views)
+	return nil
+}
+
+// setViews replaces the prefixes used to select views
+func (s *V1ViewService) setViews(views []models.View) {
+	var prefixes []viewPrefix
+	for _, v := range views {
+		for _, p := range v.Prefixes {
+			prefix, err := netip.ParsePrefix(p)
+			if err != nil {
+				vlog.Warnf("invalid prefix in view %s: %s: %v", v.Name, p, err)
+				continue
+			}
+			prefixes = append(prefixes, viewPrefix{prefix: prefix, view: v.Name})
+		}
+	}
+	slices.SortStableFunc(prefixes, func(a, b viewPrefix) int {
+		return b.prefix.Bits() - a.prefix.Bits()
+	})
+
+	s.mu.Lock()
+	s.prefixes = prefixes
+	s.mu.Unlock()
+}
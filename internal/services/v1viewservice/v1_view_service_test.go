@@ -0,0 +1,96 @@
+package v1viewservice
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/rogerwesterbo/godns/internal/models"
+	"github.com/rogerwesterbo/godns/internal/testutil/valkeytest"
+)
+
+func TestViews(t *testing.T) {
+	ctx := context.Background()
+	client := valkeytest.NewMemoryValkey()
+	s := NewV1ViewService(client)
+
+	for _, v := range []models.View{
+		{Name: "office", Prefixes: []string{"10.0.0.0/8", "fd00::/8"}},
+		{Name: "lab", Prefixes: []string{"10.20.0.0/16"}},
+	} {
+		if err := s.CreateView(ctx, &v); err != nil {
+			t.Fatalf("CreateView(%s) error = %v", v.Name, err)
+		}
+	}
+	if err := s.CreateView(ctx, &models.View{Name: "Office", Prefixes: []string{"192.168.0.0/16"}}); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("CreateView() of a duplicate error = %v, want already exists", err)
+	}
+
+	tests := []struct {
+		ip   string
+		want string
+	}{
+		{"10.1.2.3", "office"},
+		{"10.20.1.1", "lab"},
+		{"::ffff:10.20.1.1", "lab"},
+		{"fd00::53", "office"},
+		{"203.0.113.1", ""},
+	}
+	for _, tt := range tests {
+		if got := s.Select(netip.MustParseAddr(tt.ip)); got != tt.want {
+			t.Errorf("Select(%s) = %q, want %q", tt.ip, got, tt.want)
+		}
+	}
+
+	if err := s.UpdateView(ctx, "lab", &models.View{Prefixes: []string{"192.168.0.0/16"}}); err != nil {
+		t.Fatalf("UpdateView() error = %v", err)
+	}
+	if err := s.DeleteView(ctx, "office"); err != nil {
+		t.Fatalf("DeleteView() error = %v", err)
+	}
+	if err := s.DeleteView(ctx, "office"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("second DeleteView() error = %v, want not found", err)
+	}
+
+	// Other instances read the views from Valkey
+	other := NewV1ViewService(client)
+	if _, err := other.ListViews(ctx); err != nil {
+		t.Fatalf("ListViews() error = %v", err)
+	}
+	if got := other.Select(netip.MustParseAddr("192.168.1.1")); got != "lab" {
+		t.Errorf("Select() after the update = %q, want lab", got)
+	}
+	if got := other.Select(netip.MustParseAddr("10.1.2.3")); got != "" {
+		t.Errorf("Select() after deleting the view = %q, want none", got)
+	}
+}
+
+func TestViewsConcurrent(t *testing.T) {
+	ctx := context.Background()
+	s := NewV1ViewService(valkeytest.NewSlowValkey())
+
+	const changes = 10
+	var wg sync.WaitGroup
+	for i := range changes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v := models.View{Name: fmt.Sprintf("site%d", i), Prefixes: []string{fmt.Sprintf("10.%d.0.0/16", i)}}
+			if err := s.CreateView(ctx, &v); err != nil {
+				t.Errorf("CreateView(%s) error = %v", v.Name, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	views, err := s.ListViews(ctx)
+	if err != nil {
+		t.Fatalf("ListViews() error = %v", err)
+	}
+	if len(views) != changes {
+		t.Errorf("got %d views, want %d", len(views), changes)
+	}
+}
@@ -0,0 +1,197 @@
+package v1zonejournal
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rogerwesterbo/godns/internal/models"
+	"github.com/rogerwesterbo/godns/pkg/interfaces/valkeyinterface"
+)
+
+const (
+	// Valkey key prefix for zone change journals
+	journalKeyPrefix = "journal:"
+	// maxEntries bounds the number of changes kept per zone
+	maxEntries = 100
+)
+
+// Entry is one change of a zone from one SOA serial to the next
+// Removed and Added include the old and new SOA records, as required for IXFR (RFC 1995).
+type Entry struct {
+	FromSerial uint32             `json:"from_serial"`
+	ToSerial   uint32             `json:"to_serial"`
+	Removed    []models.DNSRecord `json:"removed"`
+	Added      []models.DNSRecord `json:"added"`
+	Timestamp  time.Time          `json:"timestamp"`
+}
+
+// Journal stores the change history of zones for incremental zone transfers
+type Journal struct {
+	client valkeyinterface.ValkeyInterface
+}
+
+// NewJournal creates a new zone journal
+func NewJournal(client valkeyinterface.ValkeyInterface) *Journal {
+	return &Journal{
+		client: client,
+	}
+}
+
+// Record stores the difference between two versions of a zone
+// Changes that keep the SOA serial cannot be expressed as IXFR differences, so the
+// journal is cleared instead and secondaries fall back to a full transfer.
+func (j *Journal) Record(ctx context.Context, domain string, before, after *models.DNSZone) error {
+	fromSerial := before.SOASerial()
+	toSerial := after.SOASerial()
+
+	removed := diffRecords(before.Records, after.Records)
+	added := diffRecords(after.Records, before.Records)
+	if len(removed) == 0 && len(added) == 0 {
+		return nil
+	}
+
+	if fromSerial == toSerial {
+		return j.Reset(ctx, domain)
+	}
+
+	entries, err := j.load(ctx, domain)
+	if err != nil {
+		return err
+	}
+
+	// Synthesised SOA records are not part of the stored zone, keep them in the difference
+	if !hasSOA(removed) {
+		removed = append([]models.DNSRecord{before.SOARecord()}, removed...)
+	}
+	if !hasSOA(added) {
+		added = append([]models.DNSRecord{after.SOARecord()}, added...)
+	}
+
+	entries = append(entries, Entry{
+		FromSerial: fromSerial,
+		ToSerial:   toSerial,
+		Removed:    removed,
+		Added:      added,
+		Timestamp:  time.Now().UTC(),
+	})
+	if len(entries) > maxEntries {
+		entries = entries[len(entries)-maxEntries:]
+	}
+
+	return j.save(ctx, domain, entries)
+}
+
+// Changes returns the chain of changes from fromSerial up to toSerial
+// The boolean is false when the journal cannot bridge the two serials.
+func (j *Journal) Changes(ctx context.Context, domain string, fromSerial, toSerial uint32) ([]Entry, bool, error) {
+	entries, err := j.load(ctx, domain)
+	if err != nil {
+		return nil, false, err
+	}
+
+	start := -1
+	for i := len(entries) - 1; i >= 0; i-- {
+		if entries[i].FromSerial == fromSerial {
+			start = i
+			break
+		}
+	}
+	if start == -1 {
+		return nil, false, nil
+	}
+
+	chain := make([]Entry, 0, len(entries)-start)
+	serial := fromSerial
+	for _, entry := range entries[start:] {
+		if entry.FromSerial != serial {
+			return nil, false, nil
+		}
+		chain = append(chain, entry)
+		serial = entry.ToSerial
+	}
+
+	if serial != toSerial {
+		return nil, false, nil
+	}
+
+	return chain, true, nil
+}
+
+// Reset removes the journal of a zone
+func (j *Journal) Reset(ctx context.Context, domain string) error {
+	if err := j.client.DeleteData(ctx, journalKeyPrefix+domain); err != nil {
+		return fmt.Errorf("failed to reset zone journal: %w", err)
+	}
+	return nil
+}
+
+// load reads the journal of a zone; a missing journal is empty
+func (j *Journal) load(ctx context.Context, domain string) ([]Entry, error) {
+	data, err := j.client.GetData(ctx, journalKeyPrefix+domain)
+	if err != nil {
+		if strings.Contains(err.Error(), "key not found") {
+			return []Entry{}, nil
+		}
+		return nil, fmt.Errorf("failed to get zone journal: %w", err)
+	}
+
+	var entries []Entry
+	if err := json.Unmarshal([]byte(data), &entries); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal zone journal: %w", err)
+	}
+
+	return entries, nil
+}
+
+// save writes the journal of a zone
+func (j *Journal) save(ctx context.Context, domain string, entries []Entry) error {
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return fmt.Errorf("failed to marshal zone journal: %w", err)
+	}
+
+	if err := j.client.SetData(ctx, journalKeyPrefix+domain, string(data)); err != nil {
+		return fmt.Errorf("failed to save zone journal: %w", err)
+	}
+
+	return nil
+}
+
+// diffRecords returns the served records of a that are not in b
+// Disabled records are not served and therefore not part of a transfer.
+func diffRecords(a, b []models.DNSRecord) []models.DNSRecord {
+	present := make(map[string]bool, len(b))
+	for i := range b {
+		if !b[i].Disabled {
+			present[recordKey(&b[i])] = true
+		}
+	}
+
+	result := make([]models.DNSRecord, 0)
+	for i := range a {
+		if a[i].Disabled || present[recordKey(&a[i])] {
+			continue
+		}
+		result = append(result, a[i])
+	}
+
+	return result
+}
+
+// recordKey identifies a record by owner name, type, TTL and RDATA
+func recordKey(record *models.DNSRecord) string {
+	return fmt.Sprintf("%s|%s|%d|%s", strings.ToLower(record.Name), record.Type, record.TTL, record.GetRData())
+}
+
+// hasSOA reports whether the records contain a SOA record
+func hasSOA(records []models.DNSRecord) bool {
+	for _, record := range records {
+		if record.Type == "SOA" {
+			return true
+		}
+	}
+	return false
+}
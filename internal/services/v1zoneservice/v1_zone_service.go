@@ -2,29 +2,65 @@ package v1zoneservice
 
 import (
 	"context"
+	"crypto/rand"
 	"encoding/json"
 	"fmt"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/miekg/dns"
 	"github.com/rogerwesterbo/godns/internal/models"
+	"github.com/rogerwesterbo/godns/internal/services/v1cacheservice"
+	"github.com/rogerwesterbo/godns/internal/services/v1notifyservice"
+	"github.com/rogerwesterbo/godns/internal/services/v1zonejournal"
 	"github.com/rogerwesterbo/godns/pkg/interfaces/valkeyinterface"
+	"github.com/vitistack/common/pkg/loggers/vlog"
 )
 
 const (
 	zoneKeyPrefix   = "zone:"
 	zoneListKey     = "zones:list"
 	recordKeyPrefix = "record:"
+	// Valkey key prefix for zone transfer ACLs (owned by v1zonetransferservice)
+	transferACLKeyPrefix = "transfer:acl:"
+	// Valkey key prefix for dynamic update policies (owned by v1dynamicupdateservice)
+	updatePolicyKeyPrefix = "update:policy:"
+	// Valkey key prefix for DNSSEC signing keys (owned by v1dnssecservice)
+	dnssecKeysKeyPrefix = "dnssec:keys:"
+	// Valkey key prefix for the locks of zones changed by an instance
+	zoneLockKeyPrefix = "lock:zone:"
+
+	// zoneLockTTL bounds how long the lock of an instance that stopped during a change is held
+	zoneLockTTL = 30 * time.Second
+	// zoneLockWait is how long a change waits for the lock of its zone
+	zoneLockWait = 10 * time.Second
+	// zoneLockRetry is how often a held lock is tried again
+	zoneLockRetry = 10 * time.Millisecond
 )
 
 // V1ZoneService handles DNS zone and record operations
 type V1ZoneService struct {
-	client valkeyinterface.ValkeyInterface
+	client        valkeyinterface.ValkeyInterface
+	journal       *v1zonejournal.Journal
+	notifyService *v1notifyservice.NotifyService
+	cacheService  *v1cacheservice.DNSCache
+
+	// locks holds a mutex per zone, see LockZone
+	locksMu sync.Mutex
+	locks   map[string]*sync.Mutex
 }
 
 // NewV1ZoneService creates a new zone service
-func NewV1ZoneService(client valkeyinterface.ValkeyInterface) *V1ZoneService {
+// notifyService is optional; when set, secondaries are notified of zone changes.
+// cacheService is optional; when set, cached answers of a zone are dropped when it changes.
+func NewV1ZoneService(client valkeyinterface.ValkeyInterface, notifyService *v1notifyservice.NotifyService, cacheService *v1cacheservice.DNSCache) *V1ZoneService {
 	return &V1ZoneService{
-		client: client,
+		client:        client,
+		journal:       v1zonejournal.NewJournal(client),
+		notifyService: notifyService,
+		cacheService:  cacheService,
+		locks:         make(map[string]*sync.Mutex),
 	}
 }
 
@@ -33,6 +69,72 @@ func (s *V1ZoneService) GetClient() valkeyinterface.ValkeyInterface {
 	return s.client
 }
 
+// GetNotifyService returns the NOTIFY service (used for creating dependent services)
+func (s *V1ZoneService) GetNotifyService() *v1notifyservice.NotifyService {
+	return s.notifyService
+}
+
+// GetCacheService returns the DNS cache (used for creating dependent services)
+func (s *V1ZoneService) GetCacheService() *v1cacheservice.DNSCache {
+	return s.cacheService
+}
+
+// LockZone waits until no other change of a zone is in progress and locks it for a change
+// It returns the function releasing the lock. Changes read, modify and write the zone's
+// data as a whole, so services changing zones hold the lock from reading the zone until
+// it is saved; otherwise concurrent changes would lose each other's updates or give two
+// versions of the zone the same serial. Instances sharing a Valkey also take the lock in
+// Valkey, which expires after zoneLockTTL should an instance stop during a change.
+func (s *V1ZoneService) LockZone(ctx context.Context, domain string) (unlock func(), err error) {
+	domain = strings.ToLower(dns.Fqdn(domain))
+
+	s.locksMu.Lock()
+	lock, ok := s.locks[domain]
+	if !ok {
+		lock = &sync.Mutex{}
+		s.locks[domain] = lock
+	}
+	s.locksMu.Unlock()
+
+	lock.Lock()
+	lockKey := zoneLockKeyPrefix + domain
+	token := rand.Text()
+	if err := s.acquireLock(ctx, lockKey, token); err != nil {
+		lock.Unlock()
+		return nil, fmt.Errorf("failed to lock zone %s: %w", domain, err)
+	}
+
+	return func() {
+		// The lock is released even when the change was cancelled
+		if err := s.client.DeleteDataIfEqual(context.WithoutCancel(ctx), lockKey, token); err != nil {
+			vlog.Warnf("failed to unlock zone %s, it stays locked until the lock expires: %v", domain, err)
+		}
+		lock.Unlock()
+	}, nil
+}
+
+// acquireLock sets the Valkey lock of a zone, waiting up to zoneLockWait while another instance holds it
+func (s *V1ZoneService) acquireLock(ctx context.Context, lockKey, token string) error {
+	ctx, cancel := context.WithTimeout(ctx, zoneLockWait)
+	defer cancel()
+
+	for {
+		locked, err := s.client.SetDataIfAbsent(ctx, lockKey, token, zoneLockTTL)
+		if err != nil {
+			return err
+		}
+		if locked {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("zone is locked by another change: %w", ctx.Err())
+		case <-time.After(zoneLockRetry):
+		}
+	}
+}
+
 // CreateZone creates a new DNS zone
 func (s *V1ZoneService) CreateZone(ctx context.Context, zone *models.DNSZone) error {
 	if zone.Domain == "" {
@@ -44,21 +146,44 @@ func (s *V1ZoneService) CreateZone(ctx context.Context, zone *models.DNSZone) er
 		zone.Domain += "."
 	}
 
+	unlock, err := s.LockZone(ctx, zone.Domain)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
 	// Set zone as enabled by default if not specified
 	zone.Enabled = true
 
 	// Check if zone already exists
 	zoneKey := zoneKeyPrefix + zone.Domain
-	_, err := s.client.GetData(ctx, zoneKey)
-	if err == nil {
+	if _, err := s.client.GetData(ctx, zoneKey); err == nil {
 		return fmt.Errorf("zone %s already exists", zone.Domain)
 	}
 
 	// Validate records
-	for _, record := range zone.Records {
-		if err := s.validateRecord(&record); err != nil {
-			return fmt.Errorf("invalid record: %w", err)
+	if err := s.validateRecords(zone.Records); err != nil {
+		return err
+	}
+	if err := s.validateViews(zone.Views); err != nil {
+		return err
+	}
+	if err := zone.ValidateAlsoNotify(); err != nil {
+		return err
+	}
+	if err := zone.ValidateKind(); err != nil {
+		return err
+	}
+	if err := zone.ValidateDNSSEC(); err != nil {
+		return err
+	}
+
+	// Secondary zones start empty and are filled by the first transfer
+	if zone.IsSecondary() {
+		if len(zone.Records) > 0 {
+			return fmt.Errorf("invalid zone: records of a secondary zone are transferred from its primaries")
 		}
+		zone.SecondaryStatus = &models.SecondaryStatus{}
 	}
 
 	// Save zone metadata
@@ -96,13 +221,19 @@ func (s *V1ZoneService) CreateZone(ctx context.Context, zone *models.DNSZone) er
 		}
 	}
 
-	// Save individual records
-	for _, record := range zone.Records {
-		if err := s.saveRecord(ctx, zone.Domain, &record); err != nil {
-			return fmt.Errorf("failed to save record: %w", err)
-		}
+	// Save record sets
+	if err := s.saveRecordSets(ctx, zone.Domain, zone.Records); err != nil {
+		return fmt.Errorf("failed to save record: %w", err)
+	}
+
+	// Drop any journal left behind by an earlier zone with the same name
+	if err := s.journal.Reset(ctx, zone.Domain); err != nil {
+		vlog.Warnf("failed to reset journal for zone %s: %v", zone.Domain, err)
 	}
 
+	// Answers for the zone's names may have been cached from the upstreams
+	s.cacheService.DeleteZone(ctx, zone.Domain)
+
 	return nil
 }
 
@@ -169,8 +300,14 @@ func (s *V1ZoneService) UpdateZone(ctx context.Context, domain string, zone *mod
 		domain += "."
 	}
 
+	unlock, err := s.LockZone(ctx, domain)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
 	// Check if zone exists
-	_, err := s.GetZone(ctx, domain)
+	existing, err := s.GetZone(ctx, domain)
 	if err != nil {
 		return fmt.Errorf("zone not found: %w", err)
 	}
@@ -178,16 +315,49 @@ func (s *V1ZoneService) UpdateZone(ctx context.Context, domain string, zone *mod
 	// Update domain to match the key
 	zone.Domain = domain
 
-	// Validate records
-	for _, record := range zone.Records {
-		if err := s.validateRecord(&record); err != nil {
-			return fmt.Errorf("invalid record: %w", err)
+	// Views are local to this server, so secondary zones can have them too
+	if err := s.validateViews(zone.Views); err != nil {
+		return err
+	}
+	if err := zone.ValidateAlsoNotify(); err != nil {
+		return err
+	}
+	if err := zone.ValidateKind(); err != nil {
+		return err
+	}
+	if err := zone.ValidateDNSSEC(); err != nil {
+		return err
+	}
+	// New keys of another algorithm would not match the DS record at the parent,
+	// so a signed zone keeps its algorithm until it is turned insecure
+	if existing.Signed() && zone.Signed() && zone.DNSSEC.Algorithm != existing.DNSSEC.Algorithm {
+		return fmt.Errorf("invalid DNSSEC settings: the algorithm of signed zone %s can't change, disable DNSSEC and remove the DS record at the parent first", domain)
+	}
+
+	switch {
+	case zone.IsSecondary() && existing.IsSecondary():
+		// Records of a secondary zone are read-only, only its settings change
+		zone.Records = existing.Records
+		zone.Serial = existing.Serial
+		zone.SecondaryStatus = existing.SecondaryStatus
+	case zone.IsSecondary():
+		// A primary zone turned secondary keeps serving its records until the first transfer
+		zone.Records = existing.Records
+		zone.Serial = existing.Serial
+		zone.SecondaryStatus = &models.SecondaryStatus{Loaded: len(existing.Records) > 0}
+	default:
+		// Validate records
+		if err := s.validateRecords(zone.Records); err != nil {
+			return err
 		}
+
+		// Every change gets a new SOA serial so secondaries pick it up
+		zone.BumpSerial(existing.SOASerial(), time.Now())
 	}
 
-	// Delete old records for this zone
-	if err := s.deleteZoneRecords(ctx, domain); err != nil {
-		return fmt.Errorf("failed to delete old records: %w", err)
+	// Save new record sets before the zone, so queries never miss a record of it
+	if err := s.saveRecordSets(ctx, domain, zone.Records); err != nil {
+		return fmt.Errorf("failed to save record: %w", err)
 	}
 
 	// Save updated zone
@@ -201,12 +371,15 @@ func (s *V1ZoneService) UpdateZone(ctx context.Context, domain string, zone *mod
 		return fmt.Errorf("failed to update zone: %w", err)
 	}
 
-	// Save new records
-	for _, record := range zone.Records {
-		if err := s.saveRecord(ctx, domain, &record); err != nil {
-			return fmt.Errorf("failed to save record: %w", err)
-		}
+	// Delete the record sets the zone no longer has
+	s.deleteStaleRecordSets(ctx, domain, existing.Records, zone.Records)
+
+	// Journal the change for incremental zone transfers
+	if err := s.journal.Record(ctx, domain, existing, zone); err != nil {
+		vlog.Warnf("failed to journal change of zone %s: %v", domain, err)
 	}
+	s.notifyService.ZoneChanged(zone)
+	s.cacheService.DeleteZone(ctx, domain)
 
 	return nil
 }
@@ -217,14 +390,25 @@ func (s *V1ZoneService) SetZoneEnabled(ctx context.Context, domain string, enabl
 		domain += "."
 	}
 
+	unlock, err := s.LockZone(ctx, domain)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
 	// Get the zone
 	zone, err := s.GetZone(ctx, domain)
 	if err != nil {
 		return fmt.Errorf("zone not found: %w", err)
 	}
 
-	// Update enabled status
+	// Update enabled status, the serial of secondary zones belongs to their primary
+	before := *zone
 	zone.Enabled = enabled
+	zone.Records = append([]models.DNSRecord(nil), zone.Records...)
+	if !zone.IsSecondary() {
+		zone.BumpSerial(before.SOASerial(), time.Now())
+	}
 
 	// Save updated zone
 	zoneKey := zoneKeyPrefix + domain
@@ -237,6 +421,78 @@ func (s *V1ZoneService) SetZoneEnabled(ctx context.Context, domain string, enabl
 		return fmt.Errorf("failed to update zone status: %w", err)
 	}
 
+	// Store the SOA record set with the new serial
+	if err := s.saveRecordSets(ctx, domain, soaRecords(zone.Records)); err != nil {
+		return fmt.Errorf("failed to save SOA record: %w", err)
+	}
+
+	if err := s.journal.Record(ctx, domain, &before, zone); err != nil {
+		vlog.Warnf("failed to journal change of zone %s: %v", domain, err)
+	}
+	s.notifyService.ZoneChanged(zone)
+	s.cacheService.DeleteZone(ctx, domain)
+
+	return nil
+}
+
+// SaveSecondaryZone stores the records and transfer state of a secondary zone
+// It is used by zone transfers from the primaries and bypasses the read-only
+// protection of secondary zones. With nil records only the state is updated.
+func (s *V1ZoneService) SaveSecondaryZone(ctx context.Context, domain string, records []models.DNSRecord, status models.SecondaryStatus) error {
+	if !strings.HasSuffix(domain, ".") {
+		domain += "."
+	}
+
+	unlock, err := s.LockZone(ctx, domain)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	zone, err := s.GetZone(ctx, domain)
+	if err != nil {
+		return fmt.Errorf("zone not found: %w", err)
+	}
+	if !zone.IsSecondary() {
+		return fmt.Errorf("zone %s is not a secondary zone", domain)
+	}
+
+	before := *zone
+	zone.SecondaryStatus = &status
+	if records != nil {
+		// Save the transferred record sets before the zone, so a refresh never
+		// leaves queries without the records of the zone
+		if err := s.saveRecordSets(ctx, domain, records); err != nil {
+			return fmt.Errorf("failed to save record: %w", err)
+		}
+		zone.Records = records
+	}
+
+	zoneKey := zoneKeyPrefix + domain
+	zoneData, err := json.Marshal(zone)
+	if err != nil {
+		return fmt.Errorf("failed to marshal zone: %w", err)
+	}
+
+	if err := s.client.SetData(ctx, zoneKey, string(zoneData)); err != nil {
+		return fmt.Errorf("failed to update zone: %w", err)
+	}
+
+	if records == nil {
+		// A change of the transfer state may change whether the zone is served
+		s.cacheService.DeleteZone(ctx, domain)
+		return nil
+	}
+
+	s.deleteStaleRecordSets(ctx, domain, before.Records, zone.Records)
+
+	// Journal the change so our own secondaries can transfer incrementally
+	if err := s.journal.Record(ctx, domain, &before, zone); err != nil {
+		vlog.Warnf("failed to journal change of zone %s: %v", domain, err)
+	}
+	s.notifyService.ZoneChanged(zone)
+	s.cacheService.DeleteZone(ctx, domain)
+
 	return nil
 }
 
@@ -246,9 +502,14 @@ func (s *V1ZoneService) DeleteZone(ctx context.Context, domain string) error {
 		domain += "."
 	}
 
-	// Check if zone exists
-	_, err := s.GetZone(ctx, domain)
+	unlock, err := s.LockZone(ctx, domain)
 	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	// Check if zone exists
+	if _, err := s.GetZone(ctx, domain); err != nil {
 		return fmt.Errorf("zone not found: %w", err)
 	}
 
@@ -263,6 +524,14 @@ func (s *V1ZoneService) DeleteZone(ctx context.Context, domain string) error {
 		return fmt.Errorf("failed to delete zone: %w", err)
 	}
 
+	// Delete transfer and update settings, signing keys and change history
+	_ = s.client.DeleteData(ctx, transferACLKeyPrefix+domain)
+	_ = s.client.DeleteData(ctx, updatePolicyKeyPrefix+domain)
+	_ = s.client.DeleteData(ctx, dnssecKeysKeyPrefix+domain)
+	if err := s.journal.Reset(ctx, domain); err != nil {
+		vlog.Warnf("failed to reset journal for zone %s: %v", domain, err)
+	}
+
 	// Remove from zone list
 	zones, err := s.listZoneDomains(ctx)
 	if err != nil {
@@ -285,6 +554,8 @@ func (s *V1ZoneService) DeleteZone(ctx context.Context, domain string) error {
 		return fmt.Errorf("failed to update zone list: %w", err)
 	}
 
+	s.cacheService.DeleteZone(ctx, domain)
+
 	return nil
 }
 
@@ -304,14 +575,56 @@ func (s *V1ZoneService) listZoneDomains(ctx context.Context) ([]string, error) {
 	return zones, nil
 }
 
-func (s *V1ZoneService) saveRecord(ctx context.Context, domain string, record *models.DNSRecord) error {
-	recordKey := recordKeyPrefix + domain + ":" + record.Name + ":" + record.Type
-	recordData, err := json.Marshal(record)
-	if err != nil {
-		return fmt.Errorf("failed to marshal record: %w", err)
+// saveRecordSets stores every RRset of the zone under its record key
+// All records sharing a name and type are written together as one JSON array.
+func (s *V1ZoneService) saveRecordSets(ctx context.Context, domain string, records []models.DNSRecord) error {
+	sets := make(map[string][]models.DNSRecord)
+	order := make([]string, 0)
+	for _, record := range records {
+		recordKey := recordKeyPrefix + domain + ":" + record.Name + ":" + record.Type
+		if _, exists := sets[recordKey]; !exists {
+			order = append(order, recordKey)
+		}
+		sets[recordKey] = append(sets[recordKey], record)
+	}
+
+	for _, recordKey := range order {
+		recordData, err := json.Marshal(sets[recordKey])
+		if err != nil {
+			return fmt.Errorf("failed to marshal record set: %w", err)
+		}
+		if err := s.client.SetData(ctx, recordKey, string(recordData)); err != nil {
+			return err
+		}
 	}
 
-	return s.client.SetData(ctx, recordKey, string(recordData))
+	return nil
+}
+
+// soaRecords returns the SOA records of a zone
+func soaRecords(records []models.DNSRecord) []models.DNSRecord {
+	result := make([]models.DNSRecord, 0, 1)
+	for _, record := range records {
+		if record.Type == "SOA" {
+			result = append(result, record)
+		}
+	}
+	return result
+}
+
+// deleteStaleRecordSets deletes the record keys of RRsets in old that are not in current
+func (s *V1ZoneService) deleteStaleRecordSets(ctx context.Context, domain string, old, current []models.DNSRecord) {
+	kept := make(map[string]bool, len(current))
+	for _, record := range current {
+		kept[recordKeyPrefix+domain+":"+record.Name+":"+record.Type] = true
+	}
+
+	for _, record := range old {
+		recordKey := recordKeyPrefix + domain + ":" + record.Name + ":" + record.Type
+		if !kept[recordKey] {
+			_ = s.client.DeleteData(ctx, recordKey) // Ignore errors for individual records
+		}
+	}
 }
 
 func (s *V1ZoneService) deleteZoneRecords(ctx context.Context, domain string) error {
@@ -328,6 +641,50 @@ func (s *V1ZoneService) deleteZoneRecords(ctx context.Context, domain string) er
 	return nil
 }
 
+// validateRecords validates each record and rejects identical records within an RRset
+func (s *V1ZoneService) validateRecords(records []models.DNSRecord) error {
+	for i := range records {
+		if err := s.validateRecord(&records[i]); err != nil {
+			return fmt.Errorf("invalid record: %w", err)
+		}
+		for j := 0; j < i; j++ {
+			if records[j].SameRRSet(&records[i]) && records[j].GetRData() == records[i].GetRData() {
+				return fmt.Errorf("invalid record: duplicate %s record %s with value %s",
+					records[i].Type, records[i].Name, records[i].GetRData())
+			}
+		}
+	}
+	if err := models.CheckCNAMEConflicts(records); err != nil {
+		return fmt.Errorf("invalid record: %w", err)
+	}
+	return nil
+}
+
+// validateViews validates the records a zone serves to each of its views
+func (s *V1ZoneService) validateViews(views []models.ZoneView) error {
+	for i := range views {
+		view := &views[i]
+		if err := models.ValidateViewName(view.Name); err != nil {
+			return err
+		}
+		for j := 0; j < i; j++ {
+			if views[j].Name == view.Name {
+				return fmt.Errorf("invalid zone: duplicate view %s", view.Name)
+			}
+		}
+		if err := s.validateRecords(view.Records); err != nil {
+			return fmt.Errorf("view %s: %w", view.Name, err)
+		}
+		// The SOA belongs to the zone, its serial is the same for every view
+		for _, record := range view.Records {
+			if record.Type == "SOA" {
+				return fmt.Errorf("view %s: invalid record: SOA records can't be set in a view", view.Name)
+			}
+		}
+	}
+	return nil
+}
+
 func (s *V1ZoneService) validateRecord(record *models.DNSRecord) error {
 	// Normalize type to uppercase
 	record.Type = strings.ToUpper(record.Type)
@@ -341,7 +698,7 @@ func (s *V1ZoneService) validateRecord(record *models.DNSRecord) error {
 	validTypes := map[string]bool{
 		"A": true, "AAAA": true, "CNAME": true, "ALIAS": true, "MX": true,
 		"NS": true, "TXT": true, "PTR": true, "SRV": true,
-		"SOA": true, "CAA": true,
+		"SOA": true, "CAA": true, "DS": true,
 	}
 	if !validTypes[record.Type] {
 		return fmt.Errorf("invalid record type: %s", record.Type)
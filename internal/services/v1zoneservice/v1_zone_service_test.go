@@ -0,0 +1,148 @@
+package v1zoneservice
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rogerwesterbo/godns/internal/models"
+	"github.com/rogerwesterbo/godns/internal/testutil/valkeytest"
+)
+
+// zoneWriteChecker checks on every write of the zone key that all record keys of the written zone exist
+type zoneWriteChecker struct {
+	*valkeytest.MemoryValkey
+	t *testing.T
+}
+
+func (c zoneWriteChecker) SetData(ctx context.Context, key string, data string) error {
+	if strings.HasPrefix(key, zoneKeyPrefix) {
+		var zone models.DNSZone
+		if err := json.Unmarshal([]byte(data), &zone); err != nil {
+			c.t.Fatalf("failed to unmarshal zone: %v", err)
+		}
+		for _, record := range zone.Records {
+			if _, err := c.GetData(ctx, recordKeyPrefix+zone.Domain+":"+record.Name+":"+record.Type); err != nil {
+				c.t.Errorf("zone written before the record set of %s %s", record.Name, record.Type)
+			}
+		}
+	}
+	return c.MemoryValkey.SetData(ctx, key, data)
+}
+
+func TestSaveSecondaryZone(t *testing.T) {
+	ctx := context.Background()
+	client := zoneWriteChecker{MemoryValkey: valkeytest.NewMemoryValkey(), t: t}
+	s := NewV1ZoneService(client, nil, nil)
+
+	soa := models.NewSOARecord("example.lan.", "ns1.example.lan.", "hostmaster.example.lan.", 2024110601, 3600, 1800, 604800, 60, 3600)
+	zone := &models.DNSZone{
+		Domain:    "example.lan.",
+		Kind:      models.ZoneKindSecondary,
+		Primaries: []string{"192.168.1.1"},
+	}
+	if err := s.CreateZone(ctx, zone); err != nil {
+		t.Fatalf("CreateZone() error = %v", err)
+	}
+
+	transfers := [][]models.DNSRecord{
+		{soa, models.NewARecord("old.example.lan.", "192.168.1.10", 300), models.NewARecord("web.example.lan.", "192.168.1.20", 300)},
+		{soa, models.NewARecord("web.example.lan.", "192.168.1.21", 300), models.NewARecord("new.example.lan.", "192.168.1.30", 300)},
+	}
+	for _, records := range transfers {
+		if err := s.SaveSecondaryZone(ctx, "example.lan.", records, models.SecondaryStatus{Loaded: true}); err != nil {
+			t.Fatalf("SaveSecondaryZone() error = %v", err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		exists bool
+	}{
+		{name: "old.example.lan.", exists: false},
+		{name: "web.example.lan.", exists: true},
+		{name: "new.example.lan.", exists: true},
+	}
+	for _, tt := range tests {
+		_, err := client.GetData(ctx, recordKeyPrefix+"example.lan.:"+tt.name+":A")
+		if (err == nil) != tt.exists {
+			t.Errorf("record set of %s exists = %v, want %v", tt.name, err == nil, tt.exists)
+		}
+	}
+}
+
+func TestUpdateZoneDNSSECAlgorithm(t *testing.T) {
+	ctx := context.Background()
+
+	dnssec := func(enabled bool, algorithm string) *models.DNSSECSettings {
+		return &models.DNSSECSettings{Enabled: enabled, Algorithm: algorithm}
+	}
+
+	tests := []struct {
+		name    string
+		from    *models.DNSSECSettings
+		to      *models.DNSSECSettings
+		wantErr bool
+	}{
+		{name: "signed zone keeps its algorithm", from: dnssec(true, models.DNSSECAlgorithmECDSAP256SHA256), to: dnssec(true, models.DNSSECAlgorithmECDSAP256SHA256)},
+		{name: "signed zone can't change its algorithm", from: dnssec(true, models.DNSSECAlgorithmECDSAP256SHA256), to: dnssec(true, models.DNSSECAlgorithmED25519), wantErr: true},
+		{name: "signed zone can be turned insecure", from: dnssec(true, models.DNSSECAlgorithmECDSAP256SHA256), to: dnssec(false, models.DNSSECAlgorithmED25519)},
+		{name: "insecure zone can be signed with another algorithm", from: dnssec(false, models.DNSSECAlgorithmECDSAP256SHA256), to: dnssec(true, models.DNSSECAlgorithmED25519)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewV1ZoneService(valkeytest.NewMemoryValkey(), nil, nil)
+			zone := &models.DNSZone{
+				Domain: "example.lan.",
+				Records: []models.DNSRecord{
+					models.NewSOARecord("example.lan.", "ns1.example.lan.", "hostmaster.example.lan.", 2024110601, 3600, 1800, 604800, 60, 3600),
+					models.NewNSRecord("example.lan.", "ns1.example.lan.", 3600),
+				},
+				DNSSEC: tt.from,
+			}
+			if err := s.CreateZone(ctx, zone); err != nil {
+				t.Fatalf("CreateZone() error = %v", err)
+			}
+
+			zone.DNSSEC = tt.to
+			err := s.UpdateZone(ctx, "example.lan.", zone)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("UpdateZone() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLockZoneAcrossInstances(t *testing.T) {
+	ctx := context.Background()
+	client := valkeytest.NewMemoryValkey()
+	first := NewV1ZoneService(client, nil, nil)
+	second := NewV1ZoneService(client, nil, nil)
+
+	unlock, err := first.LockZone(ctx, "Example.lan")
+	if err != nil {
+		t.Fatalf("LockZone() error = %v", err)
+	}
+
+	// Another instance waits for the lock
+	waitCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if _, err := second.LockZone(waitCtx, "example.lan."); err == nil {
+		t.Fatal("LockZone() of a zone locked by another instance succeeded")
+	}
+	if unlockOther, err := second.LockZone(ctx, "other.lan."); err != nil {
+		t.Errorf("LockZone() of another zone error = %v", err)
+	} else {
+		unlockOther()
+	}
+
+	unlock()
+	unlockSecond, err := second.LockZone(ctx, "example.lan.")
+	if err != nil {
+		t.Fatalf("LockZone() after unlocking error = %v", err)
+	}
+	unlockSecond()
+}
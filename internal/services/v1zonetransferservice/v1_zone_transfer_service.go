@@ -0,0 +1,240 @@
+package v1zonetransferservice
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"github.com/miekg/dns"
+	"github.com/rogerwesterbo/godns/internal/models"
+	"github.com/rogerwesterbo/godns/internal/services/v1zonejournal"
+	"github.com/rogerwesterbo/godns/internal/services/v1zoneservice"
+	"github.com/rogerwesterbo/godns/pkg/interfaces/valkeyinterface"
+	"github.com/vitistack/common/pkg/loggers/vlog"
+)
+
+// Valkey key prefix for zone transfer ACLs
+const transferACLKeyPrefix = "transfer:acl:"
+
+// V1ZoneTransferService builds outbound zone transfers (AXFR/IXFR) and manages their ACLs
+type V1ZoneTransferService struct {
+	client      valkeyinterface.ValkeyInterface
+	zoneService *v1zoneservice.V1ZoneService
+	journal     *v1zonejournal.Journal
+}
+
+// NewV1ZoneTransferService creates a new zone transfer service
+func NewV1ZoneTransferService(zoneService *v1zoneservice.V1ZoneService) *V1ZoneTransferService {
+	return &V1ZoneTransferService{
+		client:      zoneService.GetClient(),
+		zoneService: zoneService,
+		journal:     v1zonejournal.NewJournal(zoneService.GetClient()),
+	}
+}
+
+// GetACL returns the transfer ACL of a zone
+func (s *V1ZoneTransferService) GetACL(ctx context.Context, domain string) (*models.ZoneTransferACL, error) {
+	domain = normalizeDomain(domain)
+
+	data, err := s.client.GetData(ctx, transferACLKeyPrefix+domain)
+	if err != nil {
+		if strings.Contains(err.Error(), "key not found") {
+			return nil, fmt.Errorf("transfer ACL for zone %s not found", domain)
+		}
+		return nil, fmt.Errorf("failed to get transfer ACL: %w", err)
+	}
+
+	var acl models.ZoneTransferACL
+	if err := json.Unmarshal([]byte(data), &acl); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal transfer ACL: %w", err)
+	}
+
+	return &acl, nil
+}
+
+// SetACL validates and stores the transfer ACL of a zone
+func (s *V1ZoneTransferService) SetACL(ctx context.Context, domain string, acl *models.ZoneTransferACL) error {
+	domain = normalizeDomain(domain)
+
+	if _, err := s.zoneService.GetZone(ctx, domain); err != nil {
+		return fmt.Errorf("zone not found: %w", err)
+	}
+
+	if err := acl.Validate(); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(acl)
+	if err != nil {
+		return fmt.Errorf("failed to marshal transfer ACL: %w", err)
+	}
+
+	if err := s.client.SetData(ctx, transferACLKeyPrefix+domain, string(data)); err != nil {
+		return fmt.Errorf("failed to save transfer ACL: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteACL removes the transfer ACL of a zone, which disables transfers for it
+func (s *V1ZoneTransferService) DeleteACL(ctx context.Context, domain string) error {
+	domain = normalizeDomain(domain)
+
+	if _, err := s.GetACL(ctx, domain); err != nil {
+		return err
+	}
+
+	if err := s.client.DeleteData(ctx, transferACLKeyPrefix+domain); err != nil {
+		return fmt.Errorf("failed to delete transfer ACL: %w", err)
+	}
+
+	return nil
+}
+
+// IsAllowed reports whether a client may transfer a zone
+// Zones without an ACL cannot be transferred. tsigKey is the name of the key
+// that signed the request after successful verification, or empty.
+func (s *V1ZoneTransferService) IsAllowed(ctx context.Context, domain string, addr netip.Addr, tsigKey string) bool {
+	acl, err := s.GetACL(ctx, domain)
+	if err != nil {
+		vlog.Debugf("zone transfer of %s denied for %s: %v", domain, addr, err)
+		return false
+	}
+
+	return acl.Allows(addr, tsigKey)
+}
+
+// AXFR returns the full zone: SOA, all served records, SOA (RFC 5936)
+func (s *V1ZoneTransferService) AXFR(ctx context.Context, domain string) ([]dns.RR, error) {
+	zone, err := s.servedZone(ctx, domain)
+	if err != nil {
+		return nil, err
+	}
+
+	soa, err := s.soaRR(zone)
+	if err != nil {
+		return nil, err
+	}
+
+	rrs := []dns.RR{soa}
+	for i := range zone.Records {
+		record := &zone.Records[i]
+		if record.Disabled || record.Type == "SOA" || record.Type == "ALIAS" {
+			// ALIAS has no wire format, it only exists on this server
+			continue
+		}
+
+		rr, err := record.ToRR()
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert record %s %s: %w", record.Name, record.Type, err)
+		}
+		rrs = append(rrs, rr)
+	}
+
+	return append(rrs, dns.Copy(soa)), nil
+}
+
+// IXFR returns the changes since the client's serial (RFC 1995)
+// A secondary with the current or a newer serial receives the SOA only. When the journal cannot
+// bridge the client's serial to the current one, the full zone is returned instead.
+func (s *V1ZoneTransferService) IXFR(ctx context.Context, domain string, clientSerial uint32) ([]dns.RR, error) {
+	zone, err := s.servedZone(ctx, domain)
+	if err != nil {
+		return nil, err
+	}
+
+	soa, err := s.soaRR(zone)
+	if err != nil {
+		return nil, err
+	}
+
+	currentSerial := soa.(*dns.SOA).Serial
+	if !models.SerialGreater(currentSerial, clientSerial) {
+		return []dns.RR{soa}, nil
+	}
+
+	entries, ok, err := s.journal.Changes(ctx, zone.Domain, clientSerial, currentSerial)
+	if err != nil {
+		vlog.Warnf("failed to read journal of zone %s, sending full zone: %v", zone.Domain, err)
+	}
+	if err != nil || !ok {
+		return s.AXFR(ctx, domain)
+	}
+
+	rrs := []dns.RR{soa}
+	for _, entry := range entries {
+		removed, err := differenceRRs(entry.Removed)
+		if err != nil {
+			return nil, err
+		}
+		added, err := differenceRRs(entry.Added)
+		if err != nil {
+			return nil, err
+		}
+		rrs = append(rrs, removed...)
+		rrs = append(rrs, added...)
+	}
+
+	return append(rrs, dns.Copy(soa)), nil
+}
+
+// servedZone returns an enabled zone by its exact name
+func (s *V1ZoneTransferService) servedZone(ctx context.Context, domain string) (*models.DNSZone, error) {
+	zone, err := s.zoneService.GetZone(ctx, normalizeDomain(domain))
+	if err != nil {
+		return nil, err
+	}
+	if !zone.Serving() {
+		return nil, fmt.Errorf("zone %s is disabled or not loaded", zone.Domain)
+	}
+	return zone, nil
+}
+
+// soaRR returns the SOA resource record of a zone
+func (s *V1ZoneTransferService) soaRR(zone *models.DNSZone) (dns.RR, error) {
+	record := zone.SOARecord()
+	rr, err := record.ToRR()
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert SOA record: %w", err)
+	}
+	return rr, nil
+}
+
+// differenceRRs converts one side of a journal entry to RRs with its SOA first
+func differenceRRs(records []models.DNSRecord) ([]dns.RR, error) {
+	rrs := make([]dns.RR, 0, len(records))
+	for i := range records {
+		if records[i].Type != "SOA" {
+			continue
+		}
+		rr, err := records[i].ToRR()
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert SOA record: %w", err)
+		}
+		rrs = append(rrs, rr)
+		break
+	}
+
+	for i := range records {
+		if records[i].Type == "SOA" || records[i].Type == "ALIAS" {
+			continue
+		}
+		rr, err := records[i].ToRR()
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert record %s %s: %w", records[i].Name, records[i].Type, err)
+		}
+		rrs = append(rrs, rr)
+	}
+
+	return rrs, nil
+}
+
+// normalizeDomain returns the zone name with a trailing dot
+func normalizeDomain(domain string) string {
+	if !strings.HasSuffix(domain, ".") {
+		domain += "."
+	}
+	return domain
+}
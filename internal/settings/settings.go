@@ -21,10 +21,35 @@ func Init() {
 	viper.SetDefault(consts.DNS_SERVER_READYNESS_PROBE_PORT, ":14004")
 	viper.SetDefault(consts.DNS_ENABLE_HTTP_API, true)
 	viper.SetDefault(consts.DNS_ENABLE_ALLOWED_LANS_CHECK, false) // Default off for development
+	viper.SetDefault(consts.DNS_TCP_IDLE_TIMEOUT_SEC, 10)
+	viper.SetDefault(consts.DNS_EDNS_UDP_SIZE, 1232) // DNS flag day 2020
 	viper.SetDefault(consts.HTTP_API_PORT, ":8080")
 	viper.SetDefault(consts.HTTP_API_READINESS_PROBE_PORT, ":8081")
 	viper.SetDefault(consts.HTTP_API_LIVENESS_PROBE_PORT, ":8082")
 
+	// DNS upstream settings
+	viper.SetDefault(consts.DNS_UPSTREAM_STRATEGY, "sequential")
+	viper.SetDefault(consts.DNS_UPSTREAM_RACE_COUNT, 2)
+	viper.SetDefault(consts.DNS_UPSTREAM_HEALTH_CHECK_INTERVAL_SEC, 10)
+	viper.SetDefault(consts.DNS_RECURSION_ENABLED, false)
+	viper.SetDefault(consts.DNS_RECURSION_QNAME_MINIMISATION, true)
+	viper.SetDefault(consts.DNS_RECURSION_IPV6, false)
+
+	// DNS over TLS settings
+	viper.SetDefault(consts.DNS_TLS_ENABLED, false)
+	viper.SetDefault(consts.DNS_TLS_PORT, ":853")
+	viper.SetDefault(consts.DNS_TLS_CERT_FILE, "")
+	viper.SetDefault(consts.DNS_TLS_KEY_FILE, "")
+
+	// DNS over QUIC settings
+	viper.SetDefault(consts.DNS_DOQ_ENABLED, false)
+	viper.SetDefault(consts.DNS_DOQ_PORT, ":853")
+
+	// DNS over HTTPS settings
+	viper.SetDefault(consts.DNS_DOH_ENABLED, false)
+	viper.SetDefault(consts.DNS_DOH_PORT, ":443")
+	viper.SetDefault(consts.DNS_DOH_TRUSTED_PROXIES, "")
+
 	// DNS Cache settings
 	viper.SetDefault(consts.DNS_CACHE_ENABLED, true)
 	viper.SetDefault(consts.DNS_CACHE_SIZE, 10000)
@@ -49,6 +74,33 @@ func Init() {
 	viper.SetDefault(consts.DNS_QUERY_LOG_BUFFER_SIZE, 1000)
 	viper.SetDefault(consts.DNS_QUERY_LOG_FLUSH_INTERVAL, "1m")
 
+	// DNS NOTIFY settings
+	viper.SetDefault(consts.DNS_NOTIFY_ENABLED, true)
+	viper.SetDefault(consts.DNS_NOTIFY_TIMEOUT_SEC, 3)
+	viper.SetDefault(consts.DNS_NOTIFY_MAX_RETRIES, 5)
+	viper.SetDefault(consts.DNS_NOTIFY_RETRY_INTERVAL_SEC, 2)
+
+	// Secondary zone settings
+	viper.SetDefault(consts.DNS_SECONDARY_ENABLED, true)
+	viper.SetDefault(consts.DNS_SECONDARY_TIMEOUT_SEC, 10)
+	viper.SetDefault(consts.DNS_SECONDARY_CHECK_INTERVAL_SEC, 10)
+
+	// Response policy settings
+	viper.SetDefault(consts.DNS_RPZ_POLICIES, "")
+	viper.SetDefault(consts.DNS_RPZ_REFRESH_INTERVAL_SEC, 300)
+	viper.SetDefault(consts.DNS_RPZ_TIMEOUT_SEC, 10)
+	viper.SetDefault(consts.DNS_FILTER_BLOCKLISTS, "")
+
+	// TSIG keys
+	viper.SetDefault(consts.DNS_TSIG_KEYS, "")
+
+	// DNSSEC settings (signing is unavailable without an encryption key)
+	viper.SetDefault(consts.DNS_DNSSEC_ENCRYPTION_KEY, "")
+	viper.SetDefault(consts.DNS_DNSSEC_ZSK_LIFETIME_DAYS, 30)
+	viper.SetDefault(consts.DNS_DNSSEC_KSK_LIFETIME_DAYS, 365)
+	viper.SetDefault(consts.DNS_DNSSEC_ROLLOVER_CHECK_INTERVAL_SEC, 300)
+	viper.SetDefault(consts.DNS_DNSSEC_VALIDATION, false)
+
 	// Metrics settings
 	viper.SetDefault(consts.METRICS_ENABLED, true)
 	viper.SetDefault(consts.METRICS_PORT, ":9090")
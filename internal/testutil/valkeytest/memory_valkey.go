@@ -0,0 +1,106 @@
+// Package valkeytest provides an in-memory Valkey client for tests
+package valkeytest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rogerwesterbo/godns/pkg/interfaces/valkeyinterface"
+)
+
+var _ valkeyinterface.ValkeyInterface = (*MemoryValkey)(nil)
+
+// MemoryValkey is an in-memory stand-in for the Valkey client
+// It is safe for concurrent use and reports missing keys like the real client.
+type MemoryValkey struct {
+	mu      sync.Mutex
+	data    map[string]string
+	expires map[string]time.Time
+}
+
+// NewMemoryValkey creates an empty in-memory Valkey client
+func NewMemoryValkey() *MemoryValkey {
+	return &MemoryValkey{data: make(map[string]string), expires: make(map[string]time.Time)}
+}
+
+// GetData returns the value stored under key
+func (m *MemoryValkey) GetData(ctx context.Context, key string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	value, ok := m.get(key)
+	if !ok {
+		return "", fmt.Errorf("key not found: %s", key)
+	}
+	return value, nil
+}
+
+// SetData stores data under key
+func (m *MemoryValkey) SetData(ctx context.Context, key string, data string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.data[key] = data
+	delete(m.expires, key)
+	return nil
+}
+
+// DeleteData removes key
+func (m *MemoryValkey) DeleteData(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.data, key)
+	delete(m.expires, key)
+	return nil
+}
+
+// SetDataIfAbsent stores data under key when the key doesn't exist; the key expires after ttl
+func (m *MemoryValkey) SetDataIfAbsent(ctx context.Context, key string, data string, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.get(key); ok {
+		return false, nil
+	}
+	m.data[key] = data
+	m.expires[key] = time.Now().Add(ttl)
+	return true, nil
+}
+
+// DeleteDataIfEqual removes key while it holds data
+func (m *MemoryValkey) DeleteDataIfEqual(ctx context.Context, key string, data string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if value, ok := m.get(key); ok && value == data {
+		delete(m.data, key)
+		delete(m.expires, key)
+	}
+	return nil
+}
+
+// ListKeys returns all stored keys
+func (m *MemoryValkey) ListKeys(ctx context.Context) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	keys := make([]string, 0, len(m.data))
+	for key := range m.data {
+		if _, ok := m.get(key); ok {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// Ping always succeeds
+func (m *MemoryValkey) Ping(ctx context.Context) error {
+	return nil
+}
+
+// get returns the value of a key that has not expired; the caller holds the mutex
+func (m *MemoryValkey) get(key string) (string, bool) {
+	if expires, ok := m.expires[key]; ok && !time.Now().Before(expires) {
+		delete(m.data, key)
+		delete(m.expires, key)
+	}
+	value, ok := m.data[key]
+	return value, ok
+}
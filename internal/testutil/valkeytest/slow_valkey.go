@@ -0,0 +1,29 @@
+package valkeytest
+
+import (
+	"context"
+	"time"
+
+	"github.com/rogerwesterbo/godns/pkg/interfaces/valkeyinterface"
+)
+
+var _ valkeyinterface.ValkeyInterface = SlowValkey{}
+
+// SlowValkey delays the return of reads from a Valkey client, so concurrent
+// changes overlap between reading and saving a key
+type SlowValkey struct {
+	valkeyinterface.ValkeyInterface
+	Delay time.Duration
+}
+
+// NewSlowValkey creates an in-memory Valkey client whose reads return after a millisecond
+func NewSlowValkey() SlowValkey {
+	return SlowValkey{ValkeyInterface: NewMemoryValkey(), Delay: time.Millisecond}
+}
+
+// GetData returns the value stored under key after the delay
+func (s SlowValkey) GetData(ctx context.Context, key string) (string, error) {
+	data, err := s.ValkeyInterface.GetData(ctx, key)
+	time.Sleep(s.Delay)
+	return data, err
+}
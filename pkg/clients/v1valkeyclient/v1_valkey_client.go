@@ -166,6 +166,62 @@ func (c *V1ValkeyClient) DeleteData(ctx context.Context, key string) error {
 	})
 }
 
+// SetDataIfAbsent sets data for key when the key doesn't exist; the key expires after ttl
+func (c *V1ValkeyClient) SetDataIfAbsent(ctx context.Context, key string, data string, ttl time.Duration) (bool, error) {
+	// Create a timeout context if the parent context doesn't have a deadline
+	if _, hasDeadline := ctx.Deadline(); !hasDeadline {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	var set bool
+	err := c.retry(ctx, "SetDataIfAbsent", func() error {
+		cmd := c.client.B().Set().Key(key).Value(data).Nx().Px(ttl).Build()
+		resp := c.client.Do(ctx, cmd)
+
+		if err := resp.Error(); err != nil {
+			if !valkey.IsValkeyNil(err) {
+				return fmt.Errorf("failed to set data: %w", err)
+			}
+			// The key exists, possibly set by an earlier attempt whose reply was lost
+			current, err := c.client.Do(ctx, c.client.B().Get().Key(key).Build()).ToString()
+			if err != nil && !valkey.IsValkeyNil(err) {
+				return fmt.Errorf("failed to get data: %w", err)
+			}
+			set = err == nil && current == data
+			return nil
+		}
+		set = true
+		return nil
+	})
+
+	return set, err
+}
+
+// deleteIfEqualScript deletes a key only while it holds the given value
+const deleteIfEqualScript = `if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("DEL", KEYS[1]) end return 0`
+
+// DeleteDataIfEqual deletes key while it holds data
+func (c *V1ValkeyClient) DeleteDataIfEqual(ctx context.Context, key string, data string) error {
+	// Create a timeout context if the parent context doesn't have a deadline
+	if _, hasDeadline := ctx.Deadline(); !hasDeadline {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
+		defer cancel()
+	}
+
+	return c.retry(ctx, "DeleteDataIfEqual", func() error {
+		cmd := c.client.B().Eval().Script(deleteIfEqualScript).Numkeys(1).Key(key).Arg(data).Build()
+		resp := c.client.Do(ctx, cmd)
+
+		if err := resp.Error(); err != nil {
+			return fmt.Errorf("failed to delete data: %w", err)
+		}
+		return nil
+	})
+}
+
 // ListKeys lists all keys (WARNING: use with caution in production)
 func (c *V1ValkeyClient) ListKeys(ctx context.Context) ([]string, error) {
 	// Create a timeout context if the parent context doesn't have a deadline
@@ -13,9 +13,36 @@ var (
 	DNS_SERVER_PORT                 = "DNS_SERVER_PORT"
 	DNS_SERVER_LIVENESS_PROBE_PORT  = "DNS_SERVER_LIVENESS_PROBE_PORT"
 	DNS_SERVER_READYNESS_PROBE_PORT = "DNS_SERVER_READYNESS_PROBE_PORT"
-	DNS_UPSTREAM_SERVER             = "DNS_UPSTREAM_SERVER"
+	DNS_UPSTREAM_SERVER             = "DNS_UPSTREAM_SERVER" // comma-separated, in order
 	DNS_ENABLE_HTTP_API             = "DNS_ENABLE_HTTP_API"
 	DNS_ENABLE_ALLOWED_LANS_CHECK   = "DNS_ENABLE_ALLOWED_LANS_CHECK"
+	DNS_TCP_IDLE_TIMEOUT_SEC        = "DNS_TCP_IDLE_TIMEOUT_SEC" // idle TCP and TLS connections are closed after this time
+	DNS_EDNS_UDP_SIZE               = "DNS_EDNS_UDP_SIZE"        // EDNS0 payload size advertised to clients (RFC 6891)
+
+	// DNS upstream settings
+	DNS_UPSTREAM_STRATEGY                  = "DNS_UPSTREAM_STRATEGY" // sequential, round-robin, fastest, parallel
+	DNS_UPSTREAM_RACE_COUNT                = "DNS_UPSTREAM_RACE_COUNT"
+	DNS_UPSTREAM_HEALTH_CHECK_INTERVAL_SEC = "DNS_UPSTREAM_HEALTH_CHECK_INTERVAL_SEC"
+
+	// Recursive resolver settings, resolving from the root servers instead of the upstreams
+	DNS_RECURSION_ENABLED            = "DNS_RECURSION_ENABLED"
+	DNS_RECURSION_QNAME_MINIMISATION = "DNS_RECURSION_QNAME_MINIMISATION" // RFC 9156
+	DNS_RECURSION_IPV6               = "DNS_RECURSION_IPV6"               // also query name servers over IPv6
+
+	// DNS over TLS settings (RFC 7858)
+	DNS_TLS_ENABLED   = "DNS_TLS_ENABLED"
+	DNS_TLS_PORT      = "DNS_TLS_PORT"
+	DNS_TLS_CERT_FILE = "DNS_TLS_CERT_FILE" // PEM certificate chain, reloaded when it changes
+	DNS_TLS_KEY_FILE  = "DNS_TLS_KEY_FILE"
+
+	// DNS over QUIC settings (RFC 9250), with the DNS over TLS certificate
+	DNS_DOQ_ENABLED = "DNS_DOQ_ENABLED"
+	DNS_DOQ_PORT    = "DNS_DOQ_PORT" // UDP, so it can share the port number of DNS over TLS
+
+	// DNS over HTTPS settings (RFC 8484), with the DNS over TLS certificate
+	DNS_DOH_ENABLED         = "DNS_DOH_ENABLED"
+	DNS_DOH_PORT            = "DNS_DOH_PORT"
+	DNS_DOH_TRUSTED_PROXIES = "DNS_DOH_TRUSTED_PROXIES" // comma-separated addresses and prefixes whose X-Forwarded-For is trusted
 
 	// DNS Cache settings
 	DNS_CACHE_ENABLED     = "DNS_CACHE_ENABLED"
@@ -41,6 +68,35 @@ var (
 	DNS_QUERY_LOG_BUFFER_SIZE    = "DNS_QUERY_LOG_BUFFER_SIZE"
 	DNS_QUERY_LOG_FLUSH_INTERVAL = "DNS_QUERY_LOG_FLUSH_INTERVAL"
 
+	// DNS NOTIFY settings
+	DNS_NOTIFY_ENABLED            = "DNS_NOTIFY_ENABLED"
+	DNS_NOTIFY_TIMEOUT_SEC        = "DNS_NOTIFY_TIMEOUT_SEC"
+	DNS_NOTIFY_MAX_RETRIES        = "DNS_NOTIFY_MAX_RETRIES"
+	DNS_NOTIFY_RETRY_INTERVAL_SEC = "DNS_NOTIFY_RETRY_INTERVAL_SEC" // initial backoff, doubled after each attempt
+
+	// Secondary zone settings
+	DNS_SECONDARY_ENABLED            = "DNS_SECONDARY_ENABLED"
+	DNS_SECONDARY_TIMEOUT_SEC        = "DNS_SECONDARY_TIMEOUT_SEC"
+	DNS_SECONDARY_CHECK_INTERVAL_SEC = "DNS_SECONDARY_CHECK_INTERVAL_SEC" // how often zones are checked for a due refresh
+
+	// Response policy zones and blocklists
+	DNS_RPZ_POLICIES             = "DNS_RPZ_POLICIES" // name=type:location, comma-separated, checked in order
+	DNS_RPZ_REFRESH_INTERVAL_SEC = "DNS_RPZ_REFRESH_INTERVAL_SEC"
+	DNS_RPZ_TIMEOUT_SEC          = "DNS_RPZ_TIMEOUT_SEC" // SOA queries and each message of a policy zone transfer
+
+	// Blocklists of filtering profiles, only applied to the clients of profiles listing them
+	DNS_FILTER_BLOCKLISTS = "DNS_FILTER_BLOCKLISTS" // name=type:location, like DNS_RPZ_POLICIES
+
+	// TSIG keys (name:algorithm:secret, comma-separated)
+	DNS_TSIG_KEYS = "DNS_TSIG_KEYS"
+
+	// DNSSEC settings
+	DNS_DNSSEC_ENCRYPTION_KEY              = "DNS_DNSSEC_ENCRYPTION_KEY"              // protects the private signing keys stored in Valkey
+	DNS_DNSSEC_ZSK_LIFETIME_DAYS           = "DNS_DNSSEC_ZSK_LIFETIME_DAYS"           // days between ZSK rollovers, 0 disables them
+	DNS_DNSSEC_KSK_LIFETIME_DAYS           = "DNS_DNSSEC_KSK_LIFETIME_DAYS"           // days between KSK rollovers, 0 disables them
+	DNS_DNSSEC_ROLLOVER_CHECK_INTERVAL_SEC = "DNS_DNSSEC_ROLLOVER_CHECK_INTERVAL_SEC" // how often zones are checked for due rollover steps
+	DNS_DNSSEC_VALIDATION                  = "DNS_DNSSEC_VALIDATION"                  // validate upstream responses from the root trust anchor
+
 	// Metrics settings
 	METRICS_ENABLED = "METRICS_ENABLED"
 	METRICS_PORT    = "METRICS_PORT"
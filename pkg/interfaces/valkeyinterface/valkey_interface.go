@@ -1,11 +1,18 @@
 package valkeyinterface
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 type ValkeyInterface interface {
 	GetData(ctx context.Context, key string) (string, error)
 	SetData(ctx context.Context, key string, data string) error
 	DeleteData(ctx context.Context, key string) error
+	// SetDataIfAbsent sets data for a key that doesn't exist, expiring after ttl, and reports whether it was set
+	SetDataIfAbsent(ctx context.Context, key string, data string, ttl time.Duration) (bool, error)
+	// DeleteDataIfEqual deletes a key only while it holds data
+	DeleteDataIfEqual(ctx context.Context, key string, data string) error
 	ListKeys(ctx context.Context) ([]string, error)
 	Ping(ctx context.Context) error
 }
@@ -1,6 +1,7 @@
 import { useState, useEffect } from 'react';
 import { Dialog, Flex, TextField, Button, Text, Select } from '@radix-ui/themes';
 import * as api from '../services/api';
+import { getRecordRData } from '../utils/recordFormatting';
 
 interface RecordDialogProps {
   open: boolean;
@@ -235,7 +236,13 @@ export function RecordDialog({
       if (mode === 'create') {
         await api.createRecord(zoneDomain, recordData);
       } else if (record) {
-        await api.updateRecord(zoneDomain, record.name, record.type, recordData);
+        await api.updateRecord(
+          zoneDomain,
+          record.name,
+          record.type,
+          recordData,
+          getRecordRData(record)
+        );
       }
 
       onSuccess();
@@ -23,7 +23,7 @@ import {
 } from '@radix-ui/react-icons';
 import * as api from '../services/api';
 import { RecordDialog, SortableColumnHeader } from '../components';
-import { formatRecordValue } from '../utils/recordFormatting';
+import { formatRecordValue, getRecordRData } from '../utils/recordFormatting';
 import { useSortableData } from '../hooks';
 
 type RecordWithZone = api.DNSRecord & { zone: string };
@@ -87,7 +87,12 @@ export default function RecordsPage() {
     if (!deletingRecord) return;
 
     try {
-      await api.deleteRecord(deletingRecord.zone, deletingRecord.name, deletingRecord.type);
+      await api.deleteRecord(
+        deletingRecord.zone,
+        deletingRecord.name,
+        deletingRecord.type,
+        getRecordRData(deletingRecord)
+      );
       await loadZones(); // Reload to get updated data
       setDeletingRecord(null);
     } catch (err) {
@@ -23,10 +23,11 @@ import {
   LockClosedIcon,
   LockOpen1Icon,
   ReloadIcon,
+  DownloadIcon,
 } from '@radix-ui/react-icons';
 import * as api from '../services/api';
 import { RecordDialog, SortableColumnHeader } from '../components';
-import { formatRecordValue } from '../utils/recordFormatting';
+import { formatRecordValue, getRecordRData } from '../utils/recordFormatting';
 import { useSortableData } from '../hooks';
 
 export default function ZoneDetailPage() {
@@ -117,6 +118,17 @@ export default function ZoneDetailPage() {
     }
   };
 
+  const handleTransferZone = async () => {
+    if (!zone) return;
+
+    try {
+      await api.refreshSecondaryZone(zone.domain);
+    } catch (err) {
+      console.error('Failed to refresh secondary zone:', err);
+      setError(err instanceof Error ? err.message : 'Failed to refresh secondary zone');
+    }
+  };
+
   const handleToggleZoneStatus = async (enabled: boolean) => {
     if (!zone) return;
 
@@ -150,7 +162,12 @@ export default function ZoneDetailPage() {
     if (!zone || !deletingRecord) return;
 
     try {
-      await api.deleteRecord(zone.domain, deletingRecord.name, deletingRecord.type);
+      await api.deleteRecord(
+        zone.domain,
+        deletingRecord.name,
+        deletingRecord.type,
+        getRecordRData(deletingRecord)
+      );
       await loadZone(zone.domain);
       setDeletingRecord(null);
     } catch (err) {
@@ -167,7 +184,8 @@ export default function ZoneDetailPage() {
         zone.domain,
         togglingRecord.name,
         togglingRecord.type,
-        !!togglingRecord.disabled
+        !!togglingRecord.disabled,
+        getRecordRData(togglingRecord)
       );
       await loadZone(zone.domain);
       setTogglingRecord(null);
@@ -231,6 +249,9 @@ export default function ZoneDetailPage() {
     );
   }
 
+  // Records of secondary zones are transferred from their primaries
+  const readOnly = zone.kind === 'secondary';
+
   return (
     <Flex direction="column" gap="6">
       <Flex justify="between" align="center">
@@ -244,19 +265,43 @@ export default function ZoneDetailPage() {
               <Badge color={(zone.enabled ?? true) ? 'green' : 'red'}>
                 {(zone.enabled ?? true) ? 'Active' : 'Disabled'}
               </Badge>
+              {readOnly && (
+                <Badge color={zone.secondary_status?.expired ? 'red' : 'blue'}>
+                  {zone.secondary_status?.expired ? 'Secondary (expired)' : 'Secondary (read-only)'}
+                </Badge>
+              )}
             </Flex>
             <Text size="2" color="gray">
               {zone.records.length} record{zone.records.length !== 1 ? 's' : ''}
             </Text>
+            {readOnly && (
+              <Text as="p" size="2" color="gray">
+                Transferred from {zone.secondary_status?.primary || zone.primaries?.join(', ')}
+                {zone.secondary_status?.loaded
+                  ? ` · last refresh ${new Date(zone.secondary_status.last_refresh).toLocaleString()}`
+                  : ' · not loaded yet'}
+              </Text>
+            )}
+            {readOnly && zone.secondary_status?.last_error && (
+              <Text as="p" size="2" color="red">
+                {zone.secondary_status.last_error}
+              </Text>
+            )}
           </Box>
         </Flex>
         <Flex gap="2">
           <Button size="3" variant="soft" onClick={() => domain && loadZone(domain)}>
             <ReloadIcon /> Refresh
           </Button>
-          <Button size="3" variant="soft" onClick={handleCreateRecord}>
-            <PlusIcon /> Add Record
-          </Button>
+          {readOnly ? (
+            <Button size="3" variant="soft" onClick={handleTransferZone}>
+              <DownloadIcon /> Transfer Now
+            </Button>
+          ) : (
+            <Button size="3" variant="soft" onClick={handleCreateRecord}>
+              <PlusIcon /> Add Record
+            </Button>
+          )}
           <AlertDialog.Root>
             <AlertDialog.Trigger>
               <Button size="3" variant="soft" color={(zone.enabled ?? true) ? 'orange' : 'green'}>
@@ -454,32 +499,34 @@ export default function ZoneDetailPage() {
                         </Badge>
                       </Table.Cell>
                       <Table.Cell>
-                        <Flex gap="2">
-                          <IconButton
-                            size="1"
-                            variant="ghost"
-                            color={record.disabled ? 'green' : 'orange'}
-                            onClick={() => setTogglingRecord(record)}
-                            title={record.disabled ? 'Enable record' : 'Disable record'}
-                          >
-                            {record.disabled ? <LockOpen1Icon /> : <LockClosedIcon />}
-                          </IconButton>
-                          <IconButton
-                            size="1"
-                            variant="ghost"
-                            onClick={() => handleEditRecord(record)}
-                          >
-                            <Pencil1Icon />
-                          </IconButton>
-                          <IconButton
-                            size="1"
-                            variant="ghost"
-                            color="red"
-                            onClick={() => setDeletingRecord(record)}
-                          >
-                            <TrashIcon />
-                          </IconButton>
-                        </Flex>
+                        {!readOnly && (
+                          <Flex gap="2">
+                            <IconButton
+                              size="1"
+                              variant="ghost"
+                              color={record.disabled ? 'green' : 'orange'}
+                              onClick={() => setTogglingRecord(record)}
+                              title={record.disabled ? 'Enable record' : 'Disable record'}
+                            >
+                              {record.disabled ? <LockOpen1Icon /> : <LockClosedIcon />}
+                            </IconButton>
+                            <IconButton
+                              size="1"
+                              variant="ghost"
+                              onClick={() => handleEditRecord(record)}
+                            >
+                              <Pencil1Icon />
+                            </IconButton>
+                            <IconButton
+                              size="1"
+                              variant="ghost"
+                              color="red"
+                              onClick={() => setDeletingRecord(record)}
+                            >
+                              <TrashIcon />
+                            </IconButton>
+                          </Flex>
+                        )}
                       </Table.Cell>
                     </Table.Row>
                   ))}
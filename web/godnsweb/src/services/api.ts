@@ -36,10 +36,25 @@ export interface DNSRecord {
   disabled?: boolean;
 }
 
+export interface SecondaryStatus {
+  loaded: boolean;
+  expired: boolean;
+  primary?: string;
+  last_refresh: string;
+  last_check: string;
+  next_check: string;
+  last_error?: string;
+}
+
 export interface DNSZone {
   domain: string;
   records: DNSRecord[];
   enabled: boolean;
+
+  // Secondary zones are transferred from their primaries and read-only
+  kind?: 'primary' | 'secondary';
+  primaries?: string[];
+  secondary_status?: SecondaryStatus;
 }
 
 export interface SearchResult {
@@ -101,8 +116,8 @@ async function apiRequest<T>(endpoint: string, options: RequestInit = {}): Promi
     throw new ApiError(response.status, errorMessage, errorData);
   }
 
-  // Handle 204 No Content
-  if (response.status === 204) {
+  // Handle 202 Accepted and 204 No Content without a body
+  if (response.status === 202 || response.status === 204) {
     return undefined as T;
   }
 
@@ -145,6 +160,12 @@ export async function setZoneStatus(domain: string, enabled: boolean): Promise<v
   });
 }
 
+export async function refreshSecondaryZone(domain: string): Promise<void> {
+  return apiRequest<void>(`/api/v1/zones/${encodeURIComponent(domain)}/refresh`, {
+    method: 'POST',
+  });
+}
+
 // Record endpoints
 export async function createRecord(domain: string, record: DNSRecord): Promise<DNSRecord> {
   return apiRequest<DNSRecord>(`/api/v1/zones/${encodeURIComponent(domain)}/records`, {
@@ -153,49 +174,57 @@ export async function createRecord(domain: string, record: DNSRecord): Promise<D
   });
 }
 
-export async function getRecord(domain: string, name: string, type: string): Promise<DNSRecord> {
-  return apiRequest<DNSRecord>(
-    `/api/v1/zones/${encodeURIComponent(domain)}/records/${encodeURIComponent(name)}/${encodeURIComponent(type)}`
-  );
+// Records sharing a name and type form an RRset; `value` (the record's RDATA)
+// selects a single member of the set.
+function recordPath(domain: string, name: string, type: string, suffix = '', value?: string): string {
+  const path = `/api/v1/zones/${encodeURIComponent(domain)}/records/${encodeURIComponent(name)}/${encodeURIComponent(type)}${suffix}`;
+  return value ? `${path}?value=${encodeURIComponent(value)}` : path;
+}
+
+export async function getRecordSet(
+  domain: string,
+  name: string,
+  type: string,
+  value?: string
+): Promise<DNSRecord[]> {
+  return apiRequest<DNSRecord[]>(recordPath(domain, name, type, '', value));
 }
 
 export async function setRecordStatus(
   domain: string,
   name: string,
   type: string,
-  enabled: boolean
+  enabled: boolean,
+  value?: string
 ): Promise<void> {
-  return apiRequest<void>(
-    `/api/v1/zones/${encodeURIComponent(domain)}/records/${encodeURIComponent(name)}/${encodeURIComponent(type)}/status`,
-    {
-      method: 'PATCH',
-      body: JSON.stringify({ enabled }),
-    }
-  );
+  return apiRequest<void>(recordPath(domain, name, type, '/status', value), {
+    method: 'PATCH',
+    body: JSON.stringify({ enabled }),
+  });
 }
 
 export async function updateRecord(
   domain: string,
   name: string,
   type: string,
-  record: DNSRecord
+  record: DNSRecord,
+  value?: string
 ): Promise<DNSRecord> {
-  return apiRequest<DNSRecord>(
-    `/api/v1/zones/${encodeURIComponent(domain)}/records/${encodeURIComponent(name)}/${encodeURIComponent(type)}`,
-    {
-      method: 'PUT',
-      body: JSON.stringify(record),
-    }
-  );
+  return apiRequest<DNSRecord>(recordPath(domain, name, type, '', value), {
+    method: 'PUT',
+    body: JSON.stringify(record),
+  });
 }
 
-export async function deleteRecord(domain: string, name: string, type: string): Promise<void> {
-  return apiRequest<void>(
-    `/api/v1/zones/${encodeURIComponent(domain)}/records/${encodeURIComponent(name)}/${encodeURIComponent(type)}`,
-    {
-      method: 'DELETE',
-    }
-  );
+export async function deleteRecord(
+  domain: string,
+  name: string,
+  type: string,
+  value?: string
+): Promise<void> {
+  return apiRequest<void>(recordPath(domain, name, type, '', value), {
+    method: 'DELETE',
+  });
 }
 
 // Search endpoint
@@ -42,6 +42,54 @@ export function formatRecordValue(record: DNSRecord): string {
   }
 }
 
+/**
+ * Get the RDATA string the API uses to identify a record within its RRset
+ * (all records sharing a name and type). Mirrors DNSRecord.GetRData on the server.
+ */
+export function getRecordRData(record: DNSRecord): string {
+  switch (record.type) {
+    case 'MX':
+      if (record.mx_priority !== undefined && record.mx_host) {
+        return `${record.mx_priority} ${record.mx_host}`;
+      }
+      return record.value || '';
+
+    case 'SRV':
+      if (
+        record.srv_priority !== undefined &&
+        record.srv_weight !== undefined &&
+        record.srv_port !== undefined &&
+        record.srv_target
+      ) {
+        return `${record.srv_priority} ${record.srv_weight} ${record.srv_port} ${record.srv_target}`;
+      }
+      return record.value || '';
+
+    case 'SOA':
+      if (
+        record.soa_mname &&
+        record.soa_rname &&
+        record.soa_serial !== undefined &&
+        record.soa_refresh !== undefined &&
+        record.soa_retry !== undefined &&
+        record.soa_expire !== undefined &&
+        record.soa_minimum !== undefined
+      ) {
+        return `${record.soa_mname} ${record.soa_rname} ${record.soa_serial} ${record.soa_refresh} ${record.soa_retry} ${record.soa_expire} ${record.soa_minimum}`;
+      }
+      return record.value || '';
+
+    case 'CAA':
+      if (record.caa_flags !== undefined && record.caa_tag && record.caa_value !== undefined) {
+        return `${record.caa_flags} ${record.caa_tag} ${JSON.stringify(record.caa_value)}`;
+      }
+      return record.value || '';
+
+    default:
+      return record.value || '';
+  }
+}
+
 /**
  * Get a detailed description of a DNS record for tooltips or detailed views.
  */